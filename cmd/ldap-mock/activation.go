@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// listenFDsStart is the first file descriptor passed by systemd.
+const listenFDsStart = 3
+
+// activationRoles are the listener roles in the order sockets are assigned
+// when they are not named via FileDescriptorName=.
+var activationRoles = []string{"ldap", "mock"}
+
+// activatedListeners returns the sockets passed by systemd socket activation
+// keyed by role ("ldap", "mock"), or nil when the process was not activated.
+func activatedListeners() (map[string]net.Listener, error) {
+	if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid LISTEN_FDS: %w", err)
+	}
+
+	roles, err := activationNames(n, os.Getenv("LISTEN_FDNAMES"))
+	if err != nil {
+		return nil, err
+	}
+
+	// Do not pass the sockets on to child processes.
+	_ = os.Unsetenv("LISTEN_PID")
+	_ = os.Unsetenv("LISTEN_FDS")
+	_ = os.Unsetenv("LISTEN_FDNAMES")
+
+	listeners := make(map[string]net.Listener, len(roles))
+	for i, role := range roles {
+		f := os.NewFile(uintptr(listenFDsStart+i), role)
+
+		lis, err := net.FileListener(f)
+		_ = f.Close()
+		if err != nil {
+			for _, l := range listeners {
+				_ = l.Close()
+			}
+			return nil, fmt.Errorf("socket activation fd %d: %w", listenFDsStart+i, err)
+		}
+
+		listeners[role] = lis
+	}
+
+	return listeners, nil
+}
+
+// activationNames maps n passed sockets to listener roles. Sockets named
+// "ldap" or "mock" (FileDescriptorName=) get that role; other names fall back
+// to their position: the first socket is LDAP, the second the HTTP API.
+func activationNames(n int, fdNames string) ([]string, error) {
+	if n < 0 || n > len(activationRoles) {
+		return nil, fmt.Errorf("socket activation: got %d sockets, expected at most %d", n, len(activationRoles))
+	}
+
+	names := strings.Split(fdNames, ":")
+	roles := make([]string, n)
+	seen := make(map[string]bool, n)
+
+	for i := range roles {
+		role := activationRoles[i]
+		if i < len(names) && (names[i] == "ldap" || names[i] == "mock") {
+			role = names[i]
+		}
+
+		if seen[role] {
+			return nil, fmt.Errorf("socket activation: duplicate %q socket", role)
+		}
+		seen[role] = true
+		roles[i] = role
+	}
+
+	return roles, nil
+}
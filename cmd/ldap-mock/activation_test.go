@@ -0,0 +1,46 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestActivationNames(t *testing.T) {
+	tests := []struct {
+		name    string
+		n       int
+		fdNames string
+		want    []string
+		wantErr bool
+	}{
+		{name: "none", n: 0, want: []string{}},
+		{name: "positional", n: 2, fdNames: "ldap-mock.socket:ldap-mock.socket", want: []string{"ldap", "mock"}},
+		{name: "ldap only", n: 1, want: []string{"ldap"}},
+		{name: "named", n: 2, fdNames: "mock:ldap", want: []string{"mock", "ldap"}},
+		{name: "single named mock", n: 1, fdNames: "mock", want: []string{"mock"}},
+		{name: "duplicate", n: 2, fdNames: "ldap:ldap", wantErr: true},
+		{name: "too many", n: 3, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := activationNames(tt.n, tt.fdNames)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("roles = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestActivatedListeners_NotActivated(t *testing.T) {
+	t.Setenv("LISTEN_PID", "1")
+	t.Setenv("LISTEN_FDS", "2")
+
+	listeners, err := activatedListeners()
+	if err != nil || listeners != nil {
+		t.Errorf("expected no listeners for another pid, got %v, %v", listeners, err)
+	}
+}
@@ -0,0 +1,822 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/yaml.v2"
+
+	"github.com/rom8726/ldap-mock/pkg/ldapmock"
+)
+
+type config struct {
+	ShowVersion bool
+
+	LDAPHost     string
+	LDAPPort     string
+	LDAPNetwork  string
+	LDAPSPort    string
+	GCPort       string
+	LDAPISocket  string
+	GCAttributes string
+	MockHost     string
+	MockPort     string
+	MockNetwork  string
+	BasicAuth    string
+	APIKey       string
+	Username     string
+	Password     string
+	MockFile     string
+	MockDir      string
+	StateFile    string
+	LogLevel     string
+	TLSCert      string
+	TLSKey       string
+
+	RequestLogSamplingRate string
+
+	DrainTimeout        string
+	ScriptTimeout       string
+	MockShutdownTimeout string
+	DisableUI           string
+	UIAssetsDir         string
+	StrictMock          string
+
+	UpstreamURL      string
+	UpstreamBindDN   string
+	UpstreamPassword string
+	UpstreamShadow   string
+
+	CaptureDir    string
+	CaptureFormat string
+
+	ReadOnly        string
+	ReadOnlyMessage string
+
+	SPNEGO         string
+	SPNEGOIdentity string
+
+	DebugRuleAttribute   string
+	DebugResponseControl string
+
+	SortAttributes string
+	AttributeNames string
+
+	ChaosBindFailureRatio      string
+	ChaosBindFailureCode       string
+	ChaosMaxConcurrentSearches string
+
+	RateLimit       string
+	RateLimitBurst  string
+	RateLimitAction string
+
+	ReplicateFrom     string
+	ReplicationLag    string
+	ReplicationAPIKey string
+}
+
+// fileConfig is the layout of the -config YAML file.
+type fileConfig struct {
+	LDAP struct {
+		Host         string `yaml:"host"`
+		Port         string `yaml:"port"`
+		Network      string `yaml:"network"`
+		Socket       string `yaml:"socket"`
+		GCPort       string `yaml:"gc_port"`
+		GCAttributes string `yaml:"gc_attributes"`
+		Username     string `yaml:"username"`
+		Password     string `yaml:"password"`
+		TLS          struct {
+			Port string `yaml:"port"`
+			Cert string `yaml:"cert"`
+			Key  string `yaml:"key"`
+		} `yaml:"tls"`
+		Capture struct {
+			Dir    string `yaml:"dir"`
+			Format string `yaml:"format"`
+		} `yaml:"capture"`
+		ReadOnly             string `yaml:"read_only"`
+		ReadOnlyMessage      string `yaml:"read_only_message"`
+		SPNEGO               string `yaml:"spnego"`
+		SPNEGOIdentity       string `yaml:"spnego_identity"`
+		DebugRuleAttribute   string `yaml:"debug_rule_attribute"`
+		DebugResponseControl string `yaml:"debug_response_control"`
+		SortAttributes       string `yaml:"sort_attributes"`
+		AttributeNames       string `yaml:"attribute_names"`
+		DrainTimeout         string `yaml:"drain_timeout"`
+		ScriptTimeout        string `yaml:"script_timeout"`
+	} `yaml:"ldap"`
+	Mock struct {
+		Host            string `yaml:"host"`
+		Port            string `yaml:"port"`
+		Network         string `yaml:"network"`
+		File            string `yaml:"file"`
+		Dir             string `yaml:"dir"`
+		StateFile       string `yaml:"state_file"`
+		BasicAuth       string `yaml:"basic_auth"`
+		APIKey          string `yaml:"api_key"`
+		ShutdownTimeout string `yaml:"shutdown_timeout"`
+		DisableUI       string `yaml:"disable_ui"`
+		UIAssetsDir     string `yaml:"ui_assets_dir"`
+		Strict          string `yaml:"strict"`
+	} `yaml:"mock"`
+	Upstream struct {
+		URL      string `yaml:"url"`
+		BindDN   string `yaml:"bind_dn"`
+		Password string `yaml:"password"`
+		Shadow   string `yaml:"shadow"`
+	} `yaml:"upstream"`
+	Chaos struct {
+		BindFailureRatio      string `yaml:"bind_failure_ratio"`
+		BindFailureCode       string `yaml:"bind_failure_code"`
+		MaxConcurrentSearches string `yaml:"max_concurrent_searches"`
+	} `yaml:"chaos"`
+	RateLimit struct {
+		RequestsPerSecond string `yaml:"requests_per_second"`
+		Burst             string `yaml:"burst"`
+		Action            string `yaml:"action"`
+	} `yaml:"rate_limit"`
+	Replication struct {
+		Primary string `yaml:"primary"`
+		Lag     string `yaml:"lag"`
+		APIKey  string `yaml:"api_key"`
+	} `yaml:"replication"`
+	Log struct {
+		Level                  string `yaml:"level"`
+		RequestLogSamplingRate string `yaml:"request_log_sampling_rate"`
+	} `yaml:"log"`
+}
+
+type setting struct {
+	flag  string
+	env   string
+	def   string
+	usage string
+	field func(c *config) *string
+	file  func(f *fileConfig) string
+}
+
+var settings = []setting{
+	{
+		flag: "ldap-host", env: "LDAP_HOST",
+		usage: "LDAP listener host or interface address (all interfaces when empty)",
+		field: func(c *config) *string { return &c.LDAPHost },
+		file:  func(f *fileConfig) string { return f.LDAP.Host },
+	},
+	{
+		flag: "ldap-port", env: "LDAP_PORT", def: "389",
+		usage: "LDAP listener port",
+		field: func(c *config) *string { return &c.LDAPPort },
+		file:  func(f *fileConfig) string { return f.LDAP.Port },
+	},
+	{
+		flag: "ldap-network", env: "LDAP_NETWORK", def: "tcp",
+		usage: "LDAP listener network: tcp (dual-stack), tcp4 or tcp6",
+		field: func(c *config) *string { return &c.LDAPNetwork },
+		file:  func(f *fileConfig) string { return f.LDAP.Network },
+	},
+	{
+		flag: "ldaps-port", env: "LDAPS_PORT",
+		usage: "LDAPS listener port served next to -ldap-port (requires -tls-cert)",
+		field: func(c *config) *string { return &c.LDAPSPort },
+		file:  func(f *fileConfig) string { return f.LDAP.TLS.Port },
+	},
+	{
+		flag: "gc-port", env: "GC_PORT",
+		usage: "global catalog listener port (e.g. 3268): a read-only view of every tenant with a partial attribute set",
+		field: func(c *config) *string { return &c.GCPort },
+		file:  func(f *fileConfig) string { return f.LDAP.GCPort },
+	},
+	{
+		flag: "gc-attributes", env: "GC_ATTRIBUTES",
+		usage: "comma-separated partial attribute set returned on -gc-port (default: common Active Directory attributes)",
+		field: func(c *config) *string { return &c.GCAttributes },
+		file:  func(f *fileConfig) string { return f.LDAP.GCAttributes },
+	},
+	{
+		flag: "ldapi-socket", env: "LDAPI_SOCKET",
+		usage: "also serve LDAP on this unix socket path (ldapi://)",
+		field: func(c *config) *string { return &c.LDAPISocket },
+		file:  func(f *fileConfig) string { return f.LDAP.Socket },
+	},
+	{
+		flag: "drain-timeout", env: "LDAP_DRAIN_TIMEOUT", def: ldapmock.DefaultDrainTimeout.String(),
+		usage: "how long shutdown waits for in-flight LDAP operations before closing their connections",
+		field: func(c *config) *string { return &c.DrainTimeout },
+		file:  func(f *fileConfig) string { return f.LDAP.DrainTimeout },
+	},
+	{
+		flag: "script-timeout", env: "LDAP_SCRIPT_TIMEOUT", def: ldapmock.DefaultScriptTimeout.String(),
+		usage: "how long a rule script may run before it is interrupted",
+		field: func(c *config) *string { return &c.ScriptTimeout },
+		file:  func(f *fileConfig) string { return f.LDAP.ScriptTimeout },
+	},
+	{
+		flag: "mock-host", env: "MOCK_HOST",
+		usage: "HTTP control API host or interface address (all interfaces when empty)",
+		field: func(c *config) *string { return &c.MockHost },
+		file:  func(f *fileConfig) string { return f.Mock.Host },
+	},
+	{
+		flag: "mock-port", env: "MOCK_PORT", def: "6006",
+		usage: "HTTP control API port",
+		field: func(c *config) *string { return &c.MockPort },
+		file:  func(f *fileConfig) string { return f.Mock.Port },
+	},
+	{
+		flag: "mock-network", env: "MOCK_NETWORK", def: "tcp",
+		usage: "HTTP control API network: tcp (dual-stack), tcp4 or tcp6",
+		field: func(c *config) *string { return &c.MockNetwork },
+		file:  func(f *fileConfig) string { return f.Mock.Network },
+	},
+	{
+		flag: "mock-basic-auth", env: "MOCK_BASIC_AUTH",
+		usage: "user:password required for the HTTP control API and UI",
+		field: func(c *config) *string { return &c.BasicAuth },
+		file:  func(f *fileConfig) string { return f.Mock.BasicAuth },
+	},
+	{
+		flag: "mock-api-key", env: "MOCK_API_KEY",
+		usage: "API key accepted by the HTTP control API (X-API-Key or Authorization: Bearer)",
+		field: func(c *config) *string { return &c.APIKey },
+		file:  func(f *fileConfig) string { return f.Mock.APIKey },
+	},
+	{
+		flag: "mock-shutdown-timeout", env: "MOCK_SHUTDOWN_TIMEOUT", def: ldapmock.DefaultShutdownTimeout.String(),
+		usage: "how long shutdown waits for HTTP requests in progress, once the LDAP listeners have drained",
+		field: func(c *config) *string { return &c.MockShutdownTimeout },
+		file:  func(f *fileConfig) string { return f.Mock.ShutdownTimeout },
+	},
+	{
+		flag: "disable-ui", env: "DISABLE_UI", def: "false",
+		usage: "remove the /ui routes, leaving only the JSON API reachable",
+		field: func(c *config) *string { return &c.DisableUI },
+		file:  func(f *fileConfig) string { return f.Mock.DisableUI },
+	},
+	{
+		flag: "ui-assets-dir", env: "UI_ASSETS_DIR",
+		usage: "serve the /ui routes from this directory, falling back to the embedded bundle for missing files",
+		field: func(c *config) *string { return &c.UIAssetsDir },
+		file:  func(f *fileConfig) string { return f.Mock.UIAssetsDir },
+	},
+	{
+		flag: "strict-mock", env: "STRICT_MOCK", def: "false",
+		usage: "reject mocks with unknown fields instead of loading them with warnings",
+		field: func(c *config) *string { return &c.StrictMock },
+		file:  func(f *fileConfig) string { return f.Mock.Strict },
+	},
+	{
+		flag: "username", env: "LDAP_USERNAME",
+		usage: "bind DN accepted by the LDAP server",
+		field: func(c *config) *string { return &c.Username },
+		file:  func(f *fileConfig) string { return f.LDAP.Username },
+	},
+	{
+		flag: "password", env: "LDAP_PASSWORD",
+		usage: "bind password accepted by the LDAP server",
+		field: func(c *config) *string { return &c.Password },
+		file:  func(f *fileConfig) string { return f.LDAP.Password },
+	},
+	{
+		flag: "mock-file", env: "MOCK_FILE",
+		usage: "YAML or JSON mock loaded at startup",
+		field: func(c *config) *string { return &c.MockFile },
+		file:  func(f *fileConfig) string { return f.Mock.File },
+	},
+	{
+		flag: "mock-dir", env: "MOCK_DIR",
+		usage: "directory of YAML or JSON mocks merged in file name order and loaded at startup, instead of -mock-file",
+		field: func(c *config) *string { return &c.MockDir },
+		file:  func(f *fileConfig) string { return f.Mock.Dir },
+	},
+	{
+		flag: "state-file", env: "STATE_FILE",
+		usage: "JSON file the active mock is saved to on every change and restored from at startup, instead of -mock-file",
+		field: func(c *config) *string { return &c.StateFile },
+		file:  func(f *fileConfig) string { return f.Mock.StateFile },
+	},
+	{
+		flag: "log-level", env: "LOG_LEVEL", def: "debug",
+		usage: "log level: debug, info, warn, error",
+		field: func(c *config) *string { return &c.LogLevel },
+		file:  func(f *fileConfig) string { return f.Log.Level },
+	},
+	{
+		flag: "request-log-sampling-rate", env: "REQUEST_LOG_SAMPLING_RATE", def: "1",
+		usage: "log 1 in N successful binds and rule-matched searches; failures and unmatched searches are always logged",
+		field: func(c *config) *string { return &c.RequestLogSamplingRate },
+		file:  func(f *fileConfig) string { return f.Log.RequestLogSamplingRate },
+	},
+	{
+		flag: "tls-cert", env: "TLS_CERT",
+		usage: "PEM certificate; serves LDAPS on -ldaps-port, or on -ldap-port when that is unset",
+		field: func(c *config) *string { return &c.TLSCert },
+		file:  func(f *fileConfig) string { return f.LDAP.TLS.Cert },
+	},
+	{
+		flag: "tls-key", env: "TLS_KEY",
+		usage: "PEM private key for -tls-cert",
+		field: func(c *config) *string { return &c.TLSKey },
+		file:  func(f *fileConfig) string { return f.LDAP.TLS.Key },
+	},
+	{
+		flag: "upstream-url", env: "UPSTREAM_LDAP_URL",
+		usage: "real LDAP server (ldap://, ldaps:// or ldapi://) that searches matching no rule are forwarded to",
+		field: func(c *config) *string { return &c.UpstreamURL },
+		file:  func(f *fileConfig) string { return f.Upstream.URL },
+	},
+	{
+		flag: "upstream-bind-dn", env: "UPSTREAM_BIND_DN",
+		usage: "bind DN used for the upstream connection (anonymous when empty)",
+		field: func(c *config) *string { return &c.UpstreamBindDN },
+		file:  func(f *fileConfig) string { return f.Upstream.BindDN },
+	},
+	{
+		flag: "upstream-bind-password", env: "UPSTREAM_BIND_PASSWORD",
+		usage: "bind password for -upstream-bind-dn",
+		field: func(c *config) *string { return &c.UpstreamPassword },
+		file:  func(f *fileConfig) string { return f.Upstream.Password },
+	},
+	{
+		flag: "upstream-shadow", env: "UPSTREAM_SHADOW", def: "false",
+		usage: "also send searches the mock answers upstream and log the differences",
+		field: func(c *config) *string { return &c.UpstreamShadow },
+		file:  func(f *fileConfig) string { return f.Upstream.Shadow },
+	},
+	{
+		flag: "capture-dir", env: "CAPTURE_DIR",
+		usage: "capture raw LDAP messages of every connection into this directory (toggle at runtime with POST /config)",
+		field: func(c *config) *string { return &c.CaptureDir },
+		file:  func(f *fileConfig) string { return f.LDAP.Capture.Dir },
+	},
+	{
+		flag: "capture-format", env: "CAPTURE_FORMAT", def: ldapmock.CaptureHex,
+		usage: "capture file format: hex or pcap",
+		field: func(c *config) *string { return &c.CaptureFormat },
+		file:  func(f *fileConfig) string { return f.LDAP.Capture.Format },
+	},
+	{
+		flag: "read-only", env: "LDAP_READ_ONLY", def: "false",
+		usage: "refuse add, delete, modify and modify DN requests with unwillingToPerform (53)",
+		field: func(c *config) *string { return &c.ReadOnly },
+		file:  func(f *fileConfig) string { return f.LDAP.ReadOnly },
+	},
+	{
+		flag: "read-only-message", env: "LDAP_READ_ONLY_MESSAGE", def: ldapmock.DefaultReadOnlyMessage,
+		usage: "diagnostic message of the writes refused by -read-only",
+		field: func(c *config) *string { return &c.ReadOnlyMessage },
+		file:  func(f *fileConfig) string { return f.LDAP.ReadOnlyMessage },
+	},
+	{
+		flag: "spnego", env: "LDAP_SPNEGO", def: "false",
+		usage: "accept SASL GSS-SPNEGO and GSSAPI binds without validating Kerberos tickets",
+		field: func(c *config) *string { return &c.SPNEGO },
+		file:  func(f *fileConfig) string { return f.LDAP.SPNEGO },
+	},
+	{
+		flag: "spnego-identity", env: "LDAP_SPNEGO_IDENTITY",
+		usage: "DN the binds accepted by -spnego are made as when their principal matches no mock user",
+		field: func(c *config) *string { return &c.SPNEGOIdentity },
+		file:  func(f *fileConfig) string { return f.LDAP.SPNEGOIdentity },
+	},
+	{
+		flag: "debug-rule-attribute", env: "LDAP_DEBUG_RULE_ATTRIBUTE", def: "false",
+		usage: "add an x-mock-rule attribute naming the matched rule to returned entries (change at runtime with POST /config)",
+		field: func(c *config) *string { return &c.DebugRuleAttribute },
+		file:  func(f *fileConfig) string { return f.LDAP.DebugRuleAttribute },
+	},
+	{
+		flag: "debug-response-control", env: "LDAP_DEBUG_RESPONSE_CONTROL", def: "false",
+		usage: "return a control with the request ID and matched rule with search results (change at runtime with POST /config)",
+		field: func(c *config) *string { return &c.DebugResponseControl },
+		file:  func(f *fileConfig) string { return f.LDAP.DebugResponseControl },
+	},
+	{
+		flag: "sort-attributes", env: "LDAP_SORT_ATTRIBUTES", def: "false",
+		usage: "send the attributes of returned entries sorted by name (change at runtime with POST /config)",
+		field: func(c *config) *string { return &c.SortAttributes },
+		file:  func(f *fileConfig) string { return f.LDAP.SortAttributes },
+	},
+	{
+		flag: "attribute-names", env: "LDAP_ATTRIBUTE_NAMES", def: ldapmock.AttributeNamesDeclared,
+		usage: "case of returned attribute names: declared (as in the mock) or requested (as in the search attribute list)",
+		field: func(c *config) *string { return &c.AttributeNames },
+		file:  func(f *fileConfig) string { return f.LDAP.AttributeNames },
+	},
+	{
+		flag: "chaos-bind-failure-ratio", env: "CHAOS_BIND_FAILURE_RATIO", def: "0",
+		usage: "share of binds, from 0 to 1, failed whatever their credentials (change at runtime with POST /config)",
+		field: func(c *config) *string { return &c.ChaosBindFailureRatio },
+		file:  func(f *fileConfig) string { return f.Chaos.BindFailureRatio },
+	},
+	{
+		flag: "chaos-bind-failure-code", env: "CHAOS_BIND_FAILURE_CODE", def: "49",
+		usage: "result code of the binds failed by -chaos-bind-failure-ratio: 49 (invalidCredentials) or 52 (unavailable)",
+		field: func(c *config) *string { return &c.ChaosBindFailureCode },
+		file:  func(f *fileConfig) string { return f.Chaos.BindFailureCode },
+	},
+	{
+		flag: "chaos-max-concurrent-searches", env: "CHAOS_MAX_CONCURRENT_SEARCHES", def: "0",
+		usage: "fail searches with busy (51) while this many are in progress (0 disables)",
+		field: func(c *config) *string { return &c.ChaosMaxConcurrentSearches },
+		file:  func(f *fileConfig) string { return f.Chaos.MaxConcurrentSearches },
+	},
+	{
+		flag: "rate-limit", env: "RATE_LIMIT", def: "0",
+		usage: "binds and searches allowed per second and client IP (0 disables; change at runtime with POST /config)",
+		field: func(c *config) *string { return &c.RateLimit },
+		file:  func(f *fileConfig) string { return f.RateLimit.RequestsPerSecond },
+	},
+	{
+		flag: "rate-limit-burst", env: "RATE_LIMIT_BURST", def: "0",
+		usage: "requests a client can send at once under -rate-limit (0 is the rate rounded up)",
+		field: func(c *config) *string { return &c.RateLimitBurst },
+		file:  func(f *fileConfig) string { return f.RateLimit.Burst },
+	},
+	{
+		flag: "rate-limit-action", env: "RATE_LIMIT_ACTION", def: ldapmock.RateLimitReject,
+		usage: "what happens to requests above -rate-limit: reject (with busy (51)) or delay",
+		field: func(c *config) *string { return &c.RateLimitAction },
+		file:  func(f *fileConfig) string { return f.RateLimit.Action },
+	},
+	{
+		flag: "replicate-from", env: "REPLICATE_FROM",
+		usage: "HTTP API URL of a primary ldap-mock whose mock this instance follows as a read replica",
+		field: func(c *config) *string { return &c.ReplicateFrom },
+		file:  func(f *fileConfig) string { return f.Replication.Primary },
+	},
+	{
+		flag: "replication-lag", env: "REPLICATION_LAG", def: "0s",
+		usage: "how far the replica stays behind the changes of -replicate-from",
+		field: func(c *config) *string { return &c.ReplicationLag },
+		file:  func(f *fileConfig) string { return f.Replication.Lag },
+	},
+	{
+		flag: "replication-api-key", env: "REPLICATION_API_KEY",
+		usage: "API key of the HTTP API of -replicate-from",
+		field: func(c *config) *string { return &c.ReplicationAPIKey },
+		file:  func(f *fileConfig) string { return f.Replication.APIKey },
+	},
+}
+
+// parseConfig builds the configuration from, in increasing precedence:
+// built-in defaults, the -config YAML file, environment variables and
+// command-line flags.
+func parseConfig(args []string, output io.Writer) (config, error) {
+	fs := flag.NewFlagSet("ldap-mock", flag.ContinueOnError)
+	fs.SetOutput(output)
+
+	configPath := fs.String("config", os.Getenv("CONFIG_FILE"), "YAML server config file (env CONFIG_FILE)")
+	showVersion := fs.Bool("version", false, "print version information and exit")
+
+	flagValues := make([]*string, len(settings))
+	for i, st := range settings {
+		flagValues[i] = fs.String(st.flag, st.def, st.usage+" (env "+st.env+")")
+	}
+
+	fs.Usage = func() {
+		_, _ = fmt.Fprintf(fs.Output(), "Usage: ldap-mock [flags]\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return config{}, err
+	}
+
+	if *showVersion {
+		return config{ShowVersion: true}, nil
+	}
+
+	setFlags := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { setFlags[f.Name] = true })
+
+	var file fileConfig
+	if *configPath != "" {
+		data, err := os.ReadFile(*configPath)
+		if err != nil {
+			return config{}, fmt.Errorf("read config: %w", err)
+		}
+
+		if err := yaml.UnmarshalStrict(data, &file); err != nil {
+			return config{}, fmt.Errorf("decode config %s: %w", *configPath, err)
+		}
+	}
+
+	var cfg config
+	for i, st := range settings {
+		value := st.def
+		if v := st.file(&file); v != "" {
+			value = v
+		}
+		if v := os.Getenv(st.env); v != "" {
+			value = v
+		}
+		if setFlags[st.flag] {
+			value = *flagValues[i]
+		}
+
+		*st.field(&cfg) = value
+	}
+
+	if err := cfg.validate(); err != nil {
+		return config{}, err
+	}
+
+	return cfg, nil
+}
+
+func (c config) validate() error {
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		return errors.New("-tls-cert and -tls-key must be set together")
+	}
+
+	if c.LDAPSPort != "" && c.TLSCert == "" {
+		return errors.New("-ldaps-port requires -tls-cert and -tls-key")
+	}
+
+	if c.MockFile != "" && c.MockDir != "" {
+		return errors.New("-mock-file and -mock-dir cannot be set together")
+	}
+
+	if c.GCAttributes != "" && slices.Contains(c.globalCatalog().Attributes, "") {
+		return fmt.Errorf("invalid -gc-attributes %q: must be comma-separated attribute names", c.GCAttributes)
+	}
+
+	for _, network := range []string{c.LDAPNetwork, c.MockNetwork} {
+		switch network {
+		case "tcp", "tcp4", "tcp6":
+		default:
+			return fmt.Errorf("invalid network %q: must be tcp, tcp4 or tcp6", network)
+		}
+	}
+
+	if c.BasicAuth != "" && !strings.Contains(c.BasicAuth, ":") {
+		return errors.New("-mock-basic-auth must be user:password")
+	}
+
+	if _, err := strconv.ParseBool(c.DisableUI); err != nil {
+		return fmt.Errorf("invalid -disable-ui %q: must be true or false", c.DisableUI)
+	}
+
+	if _, err := strconv.ParseBool(c.StrictMock); err != nil {
+		return fmt.Errorf("invalid -strict-mock %q: must be true or false", c.StrictMock)
+	}
+
+	if c.UpstreamURL != "" {
+		u, err := url.Parse(c.UpstreamURL)
+		if err != nil || (u.Scheme != "ldap" && u.Scheme != "ldaps" && u.Scheme != "ldapi") {
+			return fmt.Errorf("invalid upstream URL %q: must be ldap://, ldaps:// or ldapi://", c.UpstreamURL)
+		}
+	}
+
+	if _, err := strconv.ParseBool(c.UpstreamShadow); err != nil {
+		return fmt.Errorf("invalid -upstream-shadow %q: must be true or false", c.UpstreamShadow)
+	}
+
+	if c.CaptureFormat != ldapmock.CaptureHex && c.CaptureFormat != ldapmock.CapturePcap {
+		return fmt.Errorf("invalid capture format %q: must be hex or pcap", c.CaptureFormat)
+	}
+
+	if _, err := strconv.ParseBool(c.ReadOnly); err != nil {
+		return fmt.Errorf("invalid -read-only %q: must be true or false", c.ReadOnly)
+	}
+
+	if _, err := strconv.ParseBool(c.SPNEGO); err != nil {
+		return fmt.Errorf("invalid -spnego %q: must be true or false", c.SPNEGO)
+	}
+
+	if _, err := strconv.ParseBool(c.DebugRuleAttribute); err != nil {
+		return fmt.Errorf("invalid -debug-rule-attribute %q: must be true or false", c.DebugRuleAttribute)
+	}
+
+	if _, err := strconv.ParseBool(c.DebugResponseControl); err != nil {
+		return fmt.Errorf("invalid -debug-response-control %q: must be true or false", c.DebugResponseControl)
+	}
+
+	if _, err := strconv.ParseBool(c.SortAttributes); err != nil {
+		return fmt.Errorf("invalid -sort-attributes %q: must be true or false", c.SortAttributes)
+	}
+
+	if c.AttributeNames != ldapmock.AttributeNamesDeclared && c.AttributeNames != ldapmock.AttributeNamesRequested {
+		return fmt.Errorf("invalid -attribute-names %q: must be %s or %s",
+			c.AttributeNames, ldapmock.AttributeNamesDeclared, ldapmock.AttributeNamesRequested)
+	}
+
+	ratio, err := strconv.ParseFloat(c.ChaosBindFailureRatio, 64)
+	if err != nil || ratio < 0 || ratio > 1 {
+		return fmt.Errorf("invalid -chaos-bind-failure-ratio %q: must be between 0 and 1", c.ChaosBindFailureRatio)
+	}
+
+	if code := c.ChaosBindFailureCode; code != "49" && code != "52" {
+		return fmt.Errorf("invalid -chaos-bind-failure-code %q: must be 49 or 52", code)
+	}
+
+	if n, err := strconv.Atoi(c.ChaosMaxConcurrentSearches); err != nil || n < 0 {
+		return fmt.Errorf("invalid -chaos-max-concurrent-searches %q: must be a non-negative integer", c.ChaosMaxConcurrentSearches)
+	}
+
+	if rate, err := strconv.ParseFloat(c.RateLimit, 64); err != nil || rate < 0 {
+		return fmt.Errorf("invalid -rate-limit %q: must be a non-negative number", c.RateLimit)
+	}
+
+	if n, err := strconv.Atoi(c.RateLimitBurst); err != nil || n < 0 {
+		return fmt.Errorf("invalid -rate-limit-burst %q: must be a non-negative integer", c.RateLimitBurst)
+	}
+
+	if c.RateLimitAction != ldapmock.RateLimitReject && c.RateLimitAction != ldapmock.RateLimitDelay {
+		return fmt.Errorf("invalid -rate-limit-action %q: must be %s or %s",
+			c.RateLimitAction, ldapmock.RateLimitReject, ldapmock.RateLimitDelay)
+	}
+
+	if timeout, err := time.ParseDuration(c.DrainTimeout); err != nil || timeout < 0 {
+		return fmt.Errorf("invalid -drain-timeout %q: must be a non-negative duration", c.DrainTimeout)
+	}
+
+	if timeout, err := time.ParseDuration(c.ScriptTimeout); err != nil || timeout <= 0 {
+		return fmt.Errorf("invalid -script-timeout %q: must be a positive duration", c.ScriptTimeout)
+	}
+
+	if timeout, err := time.ParseDuration(c.MockShutdownTimeout); err != nil || timeout < 0 {
+		return fmt.Errorf("invalid -mock-shutdown-timeout %q: must be a non-negative duration", c.MockShutdownTimeout)
+	}
+
+	if c.ReplicateFrom != "" {
+		u, err := url.Parse(c.ReplicateFrom)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid -replicate-from %q: must be an http:// or https:// URL", c.ReplicateFrom)
+		}
+	}
+
+	if lag, err := time.ParseDuration(c.ReplicationLag); err != nil || lag < 0 {
+		return fmt.Errorf("invalid -replication-lag %q: must be a non-negative duration", c.ReplicationLag)
+	}
+
+	if _, err := zapcore.ParseLevel(c.LogLevel); err != nil {
+		return fmt.Errorf("invalid log level %q", c.LogLevel)
+	}
+
+	if n, err := strconv.Atoi(c.RequestLogSamplingRate); err != nil || n < 1 {
+		return fmt.Errorf("invalid -request-log-sampling-rate %q: must be a positive integer", c.RequestLogSamplingRate)
+	}
+
+	return nil
+}
+
+// mockAuth returns the credentials protecting the HTTP control API.
+func (c config) mockAuth() ldapmock.MockAuth {
+	username, password, _ := strings.Cut(c.BasicAuth, ":")
+
+	return ldapmock.MockAuth{Username: username, Password: password, APIKey: c.APIKey}
+}
+
+// globalCatalog returns the global catalog settings applied at startup and on
+// reload.
+func (c config) globalCatalog() ldapmock.GlobalCatalogConfig {
+	var cfg ldapmock.GlobalCatalogConfig
+	if c.GCAttributes != "" {
+		for _, attr := range strings.Split(c.GCAttributes, ",") {
+			cfg.Attributes = append(cfg.Attributes, strings.TrimSpace(attr))
+		}
+	}
+
+	return cfg
+}
+
+// upstream returns the server searches matching no rule are forwarded to, or
+// nil when none is configured.
+func (c config) upstream() *ldapmock.Upstream {
+	if c.UpstreamURL == "" {
+		return nil
+	}
+
+	return ldapmock.NewUpstream(c.UpstreamURL, c.UpstreamBindDN, c.UpstreamPassword)
+}
+
+// shadow reports whether searches answered by the mock are also sent upstream.
+func (c config) shadow() bool {
+	shadow, _ := strconv.ParseBool(c.UpstreamShadow)
+
+	return shadow
+}
+
+// drainTimeout returns how long shutdown waits for in-flight LDAP operations.
+func (c config) drainTimeout() time.Duration {
+	timeout, _ := time.ParseDuration(c.DrainTimeout)
+
+	return timeout
+}
+
+// scriptTimeout returns how long a rule script may run.
+func (c config) scriptTimeout() time.Duration {
+	timeout, _ := time.ParseDuration(c.ScriptTimeout)
+
+	return timeout
+}
+
+// mockShutdownTimeout returns how long shutdown waits for HTTP requests in
+// progress.
+func (c config) mockShutdownTimeout() time.Duration {
+	timeout, _ := time.ParseDuration(c.MockShutdownTimeout)
+
+	return timeout
+}
+
+// capture returns the capture configuration applied at startup and on reload.
+func (c config) capture() ldapmock.CaptureConfig {
+	return ldapmock.CaptureConfig{Enabled: c.CaptureDir != "", Format: c.CaptureFormat, Dir: c.CaptureDir}
+}
+
+// ui returns the dashboard settings applied at startup and on reload.
+func (c config) ui() ldapmock.UIConfig {
+	disabled, _ := strconv.ParseBool(c.DisableUI)
+
+	return ldapmock.UIConfig{Disabled: disabled, AssetsDir: c.UIAssetsDir}
+}
+
+// mockDecoding returns the mock decoding settings applied at startup and on
+// reload.
+func (c config) mockDecoding() ldapmock.MockDecoding {
+	strict, _ := strconv.ParseBool(c.StrictMock)
+
+	return ldapmock.MockDecoding{Strict: strict}
+}
+
+// readOnly returns the read-only mode applied at startup and on reload.
+func (c config) readOnly() ldapmock.ReadOnlyConfig {
+	enabled, _ := strconv.ParseBool(c.ReadOnly)
+
+	return ldapmock.ReadOnlyConfig{Enabled: enabled, Message: c.ReadOnlyMessage}
+}
+
+// spnego returns the SPNEGO bind stub applied at startup and on reload.
+func (c config) spnego() ldapmock.SPNEGOConfig {
+	enabled, _ := strconv.ParseBool(c.SPNEGO)
+
+	return ldapmock.SPNEGOConfig{Enabled: enabled, Identity: c.SPNEGOIdentity}
+}
+
+// debug returns the debug output applied at startup and on reload.
+func (c config) debug() ldapmock.DebugConfig {
+	ruleAttribute, _ := strconv.ParseBool(c.DebugRuleAttribute)
+	responseControl, _ := strconv.ParseBool(c.DebugResponseControl)
+
+	return ldapmock.DebugConfig{RuleAttribute: ruleAttribute, ResponseControl: responseControl}
+}
+
+// responseFormat returns the encoding of search result entries applied at
+// startup and on reload.
+func (c config) responseFormat() ldapmock.ResponseFormat {
+	sortAttributes, _ := strconv.ParseBool(c.SortAttributes)
+
+	return ldapmock.ResponseFormat{SortAttributes: sortAttributes, AttributeNames: c.AttributeNames}
+}
+
+// chaos returns the injected failures applied at startup and on reload.
+func (c config) chaos() ldapmock.ChaosConfig {
+	ratio, _ := strconv.ParseFloat(c.ChaosBindFailureRatio, 64)
+	code, _ := strconv.ParseUint(c.ChaosBindFailureCode, 10, 16)
+	maxSearches, _ := strconv.Atoi(c.ChaosMaxConcurrentSearches)
+
+	return ldapmock.ChaosConfig{BindFailureRatio: ratio, BindFailureCode: uint16(code), MaxConcurrentSearches: maxSearches}
+}
+
+// rateLimit returns the per-client rate limit applied at startup and on
+// reload.
+func (c config) rateLimit() ldapmock.RateLimitConfig {
+	rate, _ := strconv.ParseFloat(c.RateLimit, 64)
+	burst, _ := strconv.Atoi(c.RateLimitBurst)
+
+	return ldapmock.RateLimitConfig{RequestsPerSecond: rate, Burst: burst, Action: c.RateLimitAction}
+}
+
+// requestLogSampling returns the request log sampling applied at startup and
+// on reload.
+func (c config) requestLogSampling() ldapmock.RequestLogSampling {
+	rate, _ := strconv.Atoi(c.RequestLogSamplingRate)
+
+	return ldapmock.RequestLogSampling{Rate: rate}
+}
+
+// replica returns the replica following -replicate-from, or nil when this
+// instance is not a replica.
+func (c config) replica(log *zap.Logger, mockSrv *ldapmock.MockServer) *ldapmock.Replica {
+	if c.ReplicateFrom == "" {
+		return nil
+	}
+
+	lag, _ := time.ParseDuration(c.ReplicationLag)
+	replica := ldapmock.NewReplica(log, c.ReplicateFrom, lag, mockSrv)
+	replica.SetAuth(ldapmock.MockAuth{APIKey: c.ReplicationAPIKey})
+
+	return replica
+}
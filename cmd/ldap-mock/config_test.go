@@ -0,0 +1,215 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	t.Setenv("LDAP_PORT", "1389")
+	t.Setenv("MOCK_PORT", "")
+	t.Setenv("LDAP_USERNAME", "cn=env")
+
+	t.Run("env fallback and defaults", func(t *testing.T) {
+		cfg, err := parseConfig(nil, io.Discard)
+		if err != nil {
+			t.Fatalf("parse: %v", err)
+		}
+
+		if cfg.LDAPPort != "1389" {
+			t.Errorf("ldap port = %q, want 1389 from env", cfg.LDAPPort)
+		}
+		if cfg.MockPort != "6006" {
+			t.Errorf("mock port = %q, want default 6006", cfg.MockPort)
+		}
+		if cfg.Username != "cn=env" {
+			t.Errorf("username = %q, want cn=env", cfg.Username)
+		}
+	})
+
+	t.Run("flags override env", func(t *testing.T) {
+		cfg, err := parseConfig([]string{"-ldap-port", "2389", "-username", "cn=flag", "-log-level", "warn"}, io.Discard)
+		if err != nil {
+			t.Fatalf("parse: %v", err)
+		}
+
+		if cfg.LDAPPort != "2389" || cfg.Username != "cn=flag" || cfg.LogLevel != "warn" {
+			t.Errorf("unexpected config: %+v", cfg)
+		}
+	})
+
+	t.Run("config file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "server.yaml")
+		data := `
+ldap:
+  port: "3389"
+  network: tcp6
+  drain_timeout: 30s
+  gc_attributes: mail,sAMAccountName
+  username: cn=file
+  password: file-pw
+  read_only: true
+  spnego: true
+  spnego_identity: cn=svc,dc=corp
+mock:
+  port: "7007"
+  file: mock.yaml
+  disable_ui: true
+  ui_assets_dir: /srv/ui
+  strict: true
+upstream:
+  url: ldaps://ldap.example.com
+  shadow: true
+chaos:
+  bind_failure_ratio: "0.25"
+rate_limit:
+  requests_per_second: "5"
+replication:
+  primary: http://primary:6006
+  lag: 2s
+log:
+  level: error
+  request_log_sampling_rate: "100"
+`
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatalf("write config: %v", err)
+		}
+
+		cfg, err := parseConfig([]string{"-config", path, "-mock-port", "8008"}, io.Discard)
+		if err != nil {
+			t.Fatalf("parse: %v", err)
+		}
+
+		want := config{
+			LDAPPort:    "1389",      // env overrides file
+			LDAPNetwork: "tcp6",      // from file
+			MockPort:    "8008",      // flag overrides file
+			MockNetwork: "tcp",       // default
+			Username:    "cn=env",    // env overrides file
+			Password:    "file-pw",   // from file
+			MockFile:    "mock.yaml", // from file
+			LogLevel:    "error",     // from file
+
+			RequestLogSamplingRate: "100", // from file
+
+			GCAttributes: "mail,sAMAccountName", // from file
+
+			UpstreamURL:    "ldaps://ldap.example.com", // from file
+			UpstreamShadow: "true",                     // from file
+
+			CaptureFormat: "hex", // default
+
+			DrainTimeout:        "30s",     // from file
+			ScriptTimeout:       "1s",      // default
+			MockShutdownTimeout: "1s",      // default
+			DisableUI:           "true",    // from file
+			UIAssetsDir:         "/srv/ui", // from file
+			StrictMock:          "true",    // from file
+
+			ReadOnly:        "true",                       // from file
+			ReadOnlyMessage: "the directory is read-only", // default
+
+			SPNEGO:         "true",           // from file
+			SPNEGOIdentity: "cn=svc,dc=corp", // from file
+
+			DebugRuleAttribute:   "false", // default
+			DebugResponseControl: "false", // default
+
+			SortAttributes: "false",    // default
+			AttributeNames: "declared", // default
+
+			ChaosBindFailureRatio:      "0.25", // from file
+			ChaosBindFailureCode:       "49",   // default
+			ChaosMaxConcurrentSearches: "0",    // default
+
+			RateLimit:       "5",      // from file
+			RateLimitBurst:  "0",      // default
+			RateLimitAction: "reject", // default
+
+			ReplicateFrom:  "http://primary:6006", // from file
+			ReplicationLag: "2s",                  // from file
+		}
+		if cfg != want {
+			t.Errorf("config = %+v, want %+v", cfg, want)
+		}
+	})
+
+	t.Run("unknown config field", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "server.yaml")
+		if err := os.WriteFile(path, []byte("ldap:\n  prot: 1\n"), 0o600); err != nil {
+			t.Fatalf("write config: %v", err)
+		}
+
+		if _, err := parseConfig([]string{"-config", path}, io.Discard); err == nil {
+			t.Error("expected error for unknown field")
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		tests := [][]string{
+			{"-tls-cert", "cert.pem"},
+			{"-log-level", "loud"},
+			{"-request-log-sampling-rate", "0"},
+			{"-request-log-sampling-rate", "often"},
+			{"-ldap-network", "udp"},
+			{"-ldaps-port", "636"},
+			{"-gc-attributes", "mail,,sn"},
+			{"-drain-timeout", "-1s"},
+			{"-drain-timeout", "forever"},
+			{"-script-timeout", "0s"},
+			{"-script-timeout", "forever"},
+			{"-mock-shutdown-timeout", "-5s"},
+			{"-mock-basic-auth", "admin"},
+			{"-disable-ui", "sometimes"},
+			{"-strict-mock", "sometimes"},
+			{"-upstream-url", "http://ldap.example.com"},
+			{"-upstream-shadow", "sometimes"},
+			{"-capture-format", "txt"},
+			{"-read-only", "maybe"},
+			{"-spnego", "kerberos"},
+			{"-debug-rule-attribute", "yes please"},
+			{"-debug-response-control", "1.2.3"},
+			{"-sort-attributes", "alphabetical"},
+			{"-attribute-names", "lower"},
+			{"-chaos-bind-failure-ratio", "1.5"},
+			{"-chaos-bind-failure-ratio", "often"},
+			{"-chaos-bind-failure-code", "50"},
+			{"-chaos-max-concurrent-searches", "-1"},
+			{"-rate-limit", "fast"},
+			{"-rate-limit", "-1"},
+			{"-rate-limit-burst", "1.5"},
+			{"-rate-limit-action", "drop"},
+			{"-replicate-from", "ldap://primary:389"},
+			{"-replication-lag", "-1s"},
+			{"-mock-file", "mock.yaml", "-mock-dir", "mocks"},
+			{"-unknown"},
+		}
+
+		for _, args := range tests {
+			if _, err := parseConfig(args, io.Discard); err == nil {
+				t.Errorf("parseConfig(%v): expected error", args)
+			}
+		}
+	})
+
+	t.Run("version", func(t *testing.T) {
+		cfg, err := parseConfig([]string{"-version"}, io.Discard)
+		if err != nil {
+			t.Fatalf("parse: %v", err)
+		}
+		if !cfg.ShowVersion {
+			t.Error("expected ShowVersion")
+		}
+	})
+
+	t.Run("help", func(t *testing.T) {
+		_, err := parseConfig([]string{"-help"}, io.Discard)
+		if !errors.Is(err, flag.ErrHelp) {
+			t.Errorf("err = %v, want flag.ErrHelp", err)
+		}
+	})
+}
@@ -0,0 +1,434 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/rom8726/ldap-mock/pkg/ldapmock"
+)
+
+func main() {
+	if err := run(); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+
+		_, _ = fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		return runReplay(context.Background(), os.Args[2:], os.Stdout)
+	}
+
+	cfg, err := parseConfig(os.Args[1:], os.Stderr)
+	if err != nil {
+		return err
+	}
+
+	if cfg.ShowVersion {
+		info := ldapmock.GetBuildInfo()
+		fmt.Printf("ldap-mock %s (commit %s, built %s, %s)\n", info.Version, info.Commit, info.BuildDate, info.GoVersion)
+
+		return nil
+	}
+
+	log, level, err := newLogger(cfg.LogLevel)
+	if err != nil {
+		return fmt.Errorf("init logger: %w", err)
+	}
+
+	defer func() { _ = log.Sync() }()
+
+	info := ldapmock.GetBuildInfo()
+	log.Info("starting ldap-mock", zap.String("version", info.Version), zap.String("commit", info.Commit))
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	requestLogger := ldapmock.NewInMemoryRequestLogger(ldapmock.DefaultRequestLogCapacity)
+
+	ldapSrv := ldapmock.NewLDAPServer(
+		log,
+		cfg.LDAPPort,
+		cfg.Username,
+		cfg.Password,
+		requestLogger,
+	)
+
+	ldapSrv.SetDrainTimeout(cfg.drainTimeout())
+	ldapSrv.SetScriptEngine(ldapmock.NewJSScriptEngine(cfg.scriptTimeout()))
+
+	if upstream := cfg.upstream(); upstream != nil {
+		ldapSrv.SetUpstream(upstream)
+		log.Info("forwarding unmatched searches upstream", zap.String("url", upstream.URL()), zap.Bool("shadow", cfg.shadow()))
+	}
+	ldapSrv.SetShadow(cfg.shadow())
+
+	if err := ldapSrv.SetCapture(cfg.capture()); err != nil {
+		return err
+	}
+	if cfg.CaptureDir != "" {
+		log.Info("capturing LDAP traffic", zap.String("dir", cfg.CaptureDir), zap.String("format", cfg.CaptureFormat))
+	}
+
+	if err := ldapSrv.SetReadOnly(cfg.readOnly()); err != nil {
+		return err
+	}
+	if cfg.readOnly().Enabled {
+		log.Info("refusing write operations")
+	}
+
+	if err := ldapSrv.SetGlobalCatalog(cfg.globalCatalog()); err != nil {
+		return err
+	}
+
+	if err := ldapSrv.SetSPNEGO(cfg.spnego()); err != nil {
+		return err
+	}
+	if spnego := cfg.spnego(); spnego.Enabled {
+		log.Info("accepting SPNEGO binds without Kerberos validation", zap.String("identity", spnego.Identity))
+	}
+
+	if err := ldapSrv.SetDebug(cfg.debug()); err != nil {
+		return err
+	}
+	if cfg.debug().RuleAttribute {
+		log.Info("naming the matched rule in returned entries", zap.String("attribute", ldapmock.DebugRuleAttribute))
+	}
+	if cfg.debug().ResponseControl {
+		log.Info("returning diagnostic controls", zap.String("oid", ldapmock.ControlTypeDiagnostic))
+	}
+
+	if err := ldapSrv.SetResponseFormat(cfg.responseFormat()); err != nil {
+		return err
+	}
+
+	if err := ldapSrv.SetChaos(cfg.chaos()); err != nil {
+		return err
+	}
+	if chaos := cfg.chaos(); chaos.BindFailureRatio > 0 {
+		log.Info("failing binds at random", zap.Float64("ratio", chaos.BindFailureRatio), zap.Uint16("code", chaos.BindFailureCode))
+	}
+	if chaos := cfg.chaos(); chaos.MaxConcurrentSearches > 0 {
+		log.Info("limiting concurrent searches", zap.Int("max", chaos.MaxConcurrentSearches))
+	}
+
+	if err := ldapSrv.SetRateLimit(cfg.rateLimit()); err != nil {
+		return err
+	}
+	if rateLimit := cfg.rateLimit(); rateLimit.RequestsPerSecond > 0 {
+		log.Info("limiting the request rate of clients", zap.Float64("requests_per_second", rateLimit.RequestsPerSecond),
+			zap.Int("burst", rateLimit.Burst), zap.String("action", rateLimit.Action))
+	}
+
+	if err := ldapSrv.SetRequestLogSampling(cfg.requestLogSampling()); err != nil {
+		return err
+	}
+	if sampling := cfg.requestLogSampling(); sampling.Rate > 1 {
+		log.Info("sampling the request log", zap.Int("rate", sampling.Rate))
+	}
+
+	defer func() {
+		if upstream := ldapSrv.Upstream(); upstream != nil {
+			_ = upstream.Close()
+		}
+	}()
+
+	if cfg.StateFile != "" {
+		ldapSrv.OnMockChange(stateFile{path: cfg.StateFile, log: log}.save)
+	}
+
+	mockSrv := ldapmock.NewMockServer(log, cfg.MockPort, ldapSrv, requestLogger)
+	mockSrv.SetAuth(cfg.mockAuth())
+	mockSrv.SetShutdownTimeout(cfg.mockShutdownTimeout())
+	if err := mockSrv.SetUI(cfg.ui()); err != nil {
+		return err
+	}
+	if cfg.ui().Disabled {
+		log.Info("UI disabled")
+	} else if cfg.UIAssetsDir != "" {
+		log.Info("serving UI assets from directory", zap.String("dir", cfg.UIAssetsDir))
+	}
+	mockSrv.SetMockDecoding(cfg.mockDecoding())
+	if cfg.mockDecoding().Strict {
+		log.Info("strict mock decoding enabled")
+	}
+
+	restored := false
+	if cfg.StateFile != "" {
+		if restored, err = loadState(mockSrv, cfg.StateFile); err != nil {
+			return err
+		}
+		if restored {
+			log.Info("mock restored from state file", zap.String("file", cfg.StateFile))
+		}
+	}
+
+	if cfg.MockFile != "" && !restored {
+		if err := loadMockFile(mockSrv, cfg.MockFile); err != nil {
+			return err
+		}
+	}
+
+	if cfg.MockDir != "" && !restored {
+		files, err := loadMockDir(mockSrv, cfg.MockDir, log)
+		if err != nil {
+			return err
+		}
+		log.Info("mock directory loaded", zap.String("dir", cfg.MockDir), zap.Int("files", files))
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	reload := &reloader{
+		log:     log,
+		level:   level,
+		ldapSrv: ldapSrv,
+		mockSrv: mockSrv,
+		args:    os.Args[1:],
+		cfg:     cfg,
+	}
+
+	group, groupCtx := errgroup.WithContext(ctx)
+	group.Go(func() error { return reload.run(groupCtx, hup) })
+	activated, err := activatedListeners()
+	if err != nil {
+		return err
+	}
+	if len(activated) > 0 {
+		log.Info("using systemd socket activation", zap.Int("sockets", len(activated)))
+	}
+
+	ldapListeners, err := listenLDAP(cfg, activated["ldap"])
+	if err != nil {
+		return err
+	}
+
+	mockLis := activated["mock"]
+	if mockLis == nil {
+		mockLis, err = net.Listen(cfg.MockNetwork, net.JoinHostPort(cfg.MockHost, cfg.MockPort))
+		if err != nil {
+			closeListeners(ldapListeners)
+			return fmt.Errorf("listen http: %w", err)
+		}
+	}
+
+	var ldapServing sync.WaitGroup
+	serveLDAP := func(serve func() error) {
+		ldapServing.Add(1)
+		group.Go(func() error {
+			defer ldapServing.Done()
+			return serve()
+		})
+	}
+
+	for _, lis := range ldapListeners {
+		if gc, ok := lis.(globalCatalogListener); ok {
+			log.Info("serving the global catalog", zap.Stringer("addr", gc.Addr()))
+			serveLDAP(func() error { return ldapSrv.ServeGlobalCatalog(groupCtx, gc.Listener) })
+			continue
+		}
+
+		serveLDAP(func() error { return ldapSrv.Serve(groupCtx, lis) })
+	}
+	if cfg.LDAPISocket != "" {
+		serveLDAP(func() error { return ldapSrv.ListenAndServeUnix(groupCtx, cfg.LDAPISocket) })
+	}
+	group.Go(func() error { return mockSrv.Serve(afterDrain(groupCtx, &ldapServing), mockLis) })
+	if replica := cfg.replica(log, mockSrv); replica != nil {
+		group.Go(func() error { return replica.Run(groupCtx) })
+	}
+
+	return group.Wait()
+}
+
+// afterDrain returns a context done once ctx is done and the LDAP servers
+// tracked by serving have drained their connections, so that the HTTP API
+// still shows the operations finished during the drain.
+func afterDrain(ctx context.Context, serving *sync.WaitGroup) context.Context {
+	drained, cancel := context.WithCancel(context.WithoutCancel(ctx))
+
+	go func() {
+		<-ctx.Done()
+		serving.Wait()
+		cancel()
+	}()
+
+	return drained
+}
+
+// globalCatalogListener marks the listener of the global catalog port, which
+// is served with ServeGlobalCatalog.
+type globalCatalogListener struct {
+	net.Listener
+}
+
+// listenLDAP binds every configured LDAP listener: the main port (an inherited
+// socket when given), the LDAPS port and the global catalog port, returned as
+// a globalCatalogListener. The main port serves LDAPS itself when a
+// certificate is set without -ldaps-port.
+func listenLDAP(cfg config, inherited net.Listener) ([]net.Listener, error) {
+	var tlsConfig *tls.Config
+	if cfg.TLSCert != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCert, cfg.TLSKey)
+		if err != nil {
+			if inherited != nil {
+				_ = inherited.Close()
+			}
+			return nil, fmt.Errorf("load TLS key pair: %w", err)
+		}
+
+		tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+
+	ports := []struct {
+		name string
+		port string
+		tls  bool
+		gc   bool
+	}{
+		{name: "LDAP", port: cfg.LDAPPort, tls: tlsConfig != nil && cfg.LDAPSPort == ""},
+		{name: "LDAPS", port: cfg.LDAPSPort, tls: true},
+		{name: "GC", port: cfg.GCPort, gc: true},
+	}
+
+	listeners := make([]net.Listener, 0, len(ports))
+	for i, p := range ports {
+		lis := inherited
+		if i > 0 || lis == nil {
+			if p.port == "" {
+				continue
+			}
+
+			var err error
+			lis, err = net.Listen(cfg.LDAPNetwork, net.JoinHostPort(cfg.LDAPHost, p.port))
+			if err != nil {
+				closeListeners(listeners)
+				return nil, fmt.Errorf("listen %s: %w", p.name, err)
+			}
+		}
+
+		if p.tls {
+			lis = tls.NewListener(lis, tlsConfig)
+		}
+		if p.gc {
+			lis = globalCatalogListener{lis}
+		}
+
+		listeners = append(listeners, lis)
+	}
+
+	return listeners, nil
+}
+
+func closeListeners(listeners []net.Listener) {
+	for _, lis := range listeners {
+		_ = lis.Close()
+	}
+}
+
+func newLogger(level string) (*zap.Logger, zap.AtomicLevel, error) {
+	lvl, err := zapcore.ParseLevel(level)
+	if err != nil {
+		return nil, zap.AtomicLevel{}, err
+	}
+
+	logCfg := zap.NewDevelopmentConfig()
+	logCfg.Level = zap.NewAtomicLevelAt(lvl)
+
+	log, err := logCfg.Build()
+	if err != nil {
+		return nil, zap.AtomicLevel{}, err
+	}
+
+	return log, logCfg.Level, nil
+}
+
+func loadMockFile(mockSrv *ldapmock.MockServer, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read mock file: %w", err)
+	}
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = mockSrv.LoadMockJSON(data)
+	} else {
+		err = mockSrv.LoadMockYAML(data)
+	}
+	if err != nil {
+		return fmt.Errorf("load mock file %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// loadMockDir merges the YAML and JSON mocks of dir, in file name order, and
+// activates the result. It returns the number of files merged. Unknown fields
+// are logged, or fail the load in strict mode, like with a single file.
+func loadMockDir(mockSrv *ldapmock.MockServer, dir string, log *zap.Logger) (int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, fmt.Errorf("read mock dir: %w", err)
+	}
+
+	var (
+		mocks   []ldapmock.LDAPMock
+		unknown []string
+	)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		switch strings.ToLower(filepath.Ext(entry.Name())) {
+		case ".yaml", ".yml", ".json":
+		default:
+			continue
+		}
+
+		mock, fields, err := readMockFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return 0, err
+		}
+
+		mocks = append(mocks, mock)
+		unknown = append(unknown, fields...)
+	}
+
+	if len(mocks) == 0 {
+		return 0, fmt.Errorf("no YAML or JSON mock in %s", dir)
+	}
+
+	if len(unknown) > 0 {
+		if mockSrv.MockDecoding().Strict {
+			return 0, fmt.Errorf("load mock dir %s: %w", dir, &ldapmock.UnknownFieldsError{Fields: unknown})
+		}
+
+		log.Warn("mock has unknown fields", zap.Strings("fields", unknown))
+	}
+
+	if err := mockSrv.LoadMock(ldapmock.MergeMocks(mocks...)); err != nil {
+		return 0, err
+	}
+
+	return len(mocks), nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/rom8726/ldap-mock/pkg/ldapmock"
+)
+
+func TestListenLDAP(t *testing.T) {
+	t.Run("plain and global catalog", func(t *testing.T) {
+		cfg := config{LDAPHost: "127.0.0.1", LDAPPort: "0", LDAPNetwork: "tcp", GCPort: "0"}
+
+		listeners, err := listenLDAP(cfg, nil)
+		if err != nil {
+			t.Fatalf("listen: %v", err)
+		}
+		defer closeListeners(listeners)
+
+		if len(listeners) != 2 {
+			t.Fatalf("expected 2 listeners, got %d", len(listeners))
+		}
+		if listeners[0].Addr().String() == listeners[1].Addr().String() {
+			t.Errorf("expected distinct addresses, got %s twice", listeners[0].Addr())
+		}
+		if _, ok := listeners[1].(globalCatalogListener); !ok {
+			t.Errorf("second listener is %T, want the global catalog", listeners[1])
+		}
+	})
+
+	t.Run("inherited socket", func(t *testing.T) {
+		inherited, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listen: %v", err)
+		}
+
+		cfg := config{LDAPPort: "389", LDAPNetwork: "tcp"}
+
+		listeners, err := listenLDAP(cfg, inherited)
+		if err != nil {
+			t.Fatalf("listen: %v", err)
+		}
+		defer closeListeners(listeners)
+
+		if len(listeners) != 1 || listeners[0] != inherited {
+			t.Errorf("expected only the inherited listener, got %v", listeners)
+		}
+	})
+
+	t.Run("invalid key pair", func(t *testing.T) {
+		cfg := config{LDAPHost: "127.0.0.1", LDAPPort: "0", LDAPNetwork: "tcp", TLSCert: "missing.pem", TLSKey: "missing.pem"}
+
+		if _, err := listenLDAP(cfg, nil); err == nil {
+			t.Error("expected error for missing key pair")
+		}
+	})
+}
+
+func TestLoadMockDir(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"10-users.yaml":  "users:\n  - cn: uid=john,dc=example\nrules:\n  - id: john\n    filter: (uid=john)\n    priority: 5\n",
+		"20-groups.json": `{"priority_offset": 100, "rules": [{"id": "admins", "filter": "(cn=admins)"}]}`,
+		"README.md":      "not a mock",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	log := zap.NewNop()
+	ldapSrv := ldapmock.NewLDAPServer(log, "0", "", "", nil)
+	mockSrv := ldapmock.NewMockServer(log, "0", ldapSrv, nil)
+
+	n, err := loadMockDir(mockSrv, dir, log)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("loaded %d files, want 2", n)
+	}
+
+	mock := ldapSrv.GetMock()
+	if len(mock.Users) != 1 || len(mock.Rules) != 2 || mock.Rules[0].ID != "john" || mock.Rules[1].Priority != 100 {
+		t.Errorf("merged mock = %+v", mock)
+	}
+
+	if _, err := loadMockDir(mockSrv, t.TempDir(), log); err == nil {
+		t.Error("expected error for a directory without mocks")
+	}
+
+	typo := filepath.Join(dir, "30-typo.yaml")
+	if err := os.WriteFile(typo, []byte("rules:\n  - filter: (uid=jane)\n    prioritiy: 5\n"), 0o600); err != nil {
+		t.Fatalf("write %s: %v", typo, err)
+	}
+	if _, err := loadMockDir(mockSrv, dir, log); err != nil {
+		t.Errorf("load with an unknown field: %v", err)
+	}
+
+	mockSrv.SetMockDecoding(ldapmock.MockDecoding{Strict: true})
+	var unknown *ldapmock.UnknownFieldsError
+	if _, err := loadMockDir(mockSrv, dir, log); !errors.As(err, &unknown) || !strings.HasPrefix(unknown.Fields[0], "30-typo.yaml: ") {
+		t.Errorf("strict load with an unknown field: %v", err)
+	}
+}
+
+func TestAfterDrain(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var serving sync.WaitGroup
+	serving.Add(1)
+
+	drained := afterDrain(ctx, &serving)
+
+	cancel()
+	select {
+	case <-drained.Done():
+		t.Fatal("done while the LDAP servers are still draining")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	serving.Done()
+	select {
+	case <-drained.Done():
+	case <-time.After(time.Second):
+		t.Fatal("not done after the LDAP servers drained")
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/rom8726/ldap-mock/pkg/ldapmock"
+)
+
+// reloader applies a re-read configuration to the running servers.
+// Listener settings (hosts, ports, networks, TLS) only take effect after a restart.
+type reloader struct {
+	log     *zap.Logger
+	level   zap.AtomicLevel
+	ldapSrv *ldapmock.LDAPServer
+	mockSrv *ldapmock.MockServer
+	args    []string
+	cfg     config
+}
+
+func (r *reloader) run(ctx context.Context, signals <-chan os.Signal) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-signals:
+			r.log.Info("reloading configuration")
+
+			if err := r.reload(); err != nil {
+				r.log.Error("reload failed, keeping current configuration", zap.Error(err))
+			}
+		}
+	}
+}
+
+func (r *reloader) reload() error {
+	cfg, err := parseConfig(r.args, io.Discard)
+	if err != nil {
+		return err
+	}
+
+	if cfg.listeners() != r.cfg.listeners() {
+		r.log.Warn("listener settings changed, restart to apply them")
+	}
+
+	if cfg.ReplicateFrom != r.cfg.ReplicateFrom || cfg.ReplicationLag != r.cfg.ReplicationLag ||
+		cfg.ReplicationAPIKey != r.cfg.ReplicationAPIKey {
+		r.log.Warn("replication settings changed, restart to apply them")
+	}
+
+	if cfg.mockDecoding() != r.cfg.mockDecoding() {
+		r.mockSrv.SetMockDecoding(cfg.mockDecoding())
+		r.log.Info("mock decoding updated", zap.Bool("strict", cfg.mockDecoding().Strict))
+	}
+
+	if cfg.MockFile != "" {
+		if err := loadMockFile(r.mockSrv, cfg.MockFile); err != nil {
+			return err
+		}
+
+		r.log.Info("mock file reloaded", zap.String("file", cfg.MockFile))
+	}
+
+	if cfg.MockDir != "" {
+		files, err := loadMockDir(r.mockSrv, cfg.MockDir, r.log)
+		if err != nil {
+			return err
+		}
+
+		r.log.Info("mock directory reloaded", zap.String("dir", cfg.MockDir), zap.Int("files", files))
+	}
+
+	if cfg.Username != r.cfg.Username || cfg.Password != r.cfg.Password {
+		r.ldapSrv.SetCredentials(cfg.Username, cfg.Password)
+		r.log.Info("bind credentials updated")
+	}
+
+	if cfg.drainTimeout() != r.cfg.drainTimeout() {
+		r.ldapSrv.SetDrainTimeout(cfg.drainTimeout())
+		r.log.Info("drain timeout updated", zap.Duration("timeout", cfg.drainTimeout()))
+	}
+
+	if cfg.mockShutdownTimeout() != r.cfg.mockShutdownTimeout() {
+		r.mockSrv.SetShutdownTimeout(cfg.mockShutdownTimeout())
+		r.log.Info("HTTP shutdown timeout updated", zap.Duration("timeout", cfg.mockShutdownTimeout()))
+	}
+
+	if cfg.ui() != r.cfg.ui() {
+		if err := r.mockSrv.SetUI(cfg.ui()); err != nil {
+			return err
+		}
+		r.log.Info("UI updated", zap.Bool("disabled", cfg.ui().Disabled), zap.String("assets_dir", cfg.UIAssetsDir))
+	}
+
+	if cfg.mockAuth() != r.cfg.mockAuth() {
+		r.mockSrv.SetAuth(cfg.mockAuth())
+		r.log.Info("HTTP API credentials updated")
+	}
+
+	if cfg.UpstreamURL != r.cfg.UpstreamURL || cfg.UpstreamBindDN != r.cfg.UpstreamBindDN ||
+		cfg.UpstreamPassword != r.cfg.UpstreamPassword {
+		previous := r.ldapSrv.Upstream()
+		r.ldapSrv.SetUpstream(cfg.upstream())
+		if previous != nil {
+			_ = previous.Close()
+		}
+
+		r.log.Info("upstream updated", zap.String("url", cfg.UpstreamURL))
+	}
+
+	if cfg.shadow() != r.cfg.shadow() {
+		r.ldapSrv.SetShadow(cfg.shadow())
+		r.log.Info("shadow mode updated", zap.Bool("shadow", cfg.shadow()))
+	}
+
+	if cfg.capture() != r.cfg.capture() {
+		if err := r.ldapSrv.SetCapture(cfg.capture()); err != nil {
+			return err
+		}
+		r.log.Info("capture updated", zap.String("dir", cfg.CaptureDir), zap.String("format", cfg.CaptureFormat))
+	}
+
+	if cfg.readOnly() != r.cfg.readOnly() {
+		if err := r.ldapSrv.SetReadOnly(cfg.readOnly()); err != nil {
+			return err
+		}
+		r.log.Info("read-only mode updated", zap.Bool("enabled", cfg.readOnly().Enabled))
+	}
+
+	if cfg.GCAttributes != r.cfg.GCAttributes {
+		if err := r.ldapSrv.SetGlobalCatalog(cfg.globalCatalog()); err != nil {
+			return err
+		}
+		r.log.Info("global catalog attributes updated", zap.String("attributes", cfg.GCAttributes))
+	}
+
+	if cfg.spnego() != r.cfg.spnego() {
+		if err := r.ldapSrv.SetSPNEGO(cfg.spnego()); err != nil {
+			return err
+		}
+		r.log.Info("SPNEGO stub updated", zap.Bool("enabled", cfg.spnego().Enabled), zap.String("identity", cfg.SPNEGOIdentity))
+	}
+
+	if cfg.debug() != r.cfg.debug() {
+		if err := r.ldapSrv.SetDebug(cfg.debug()); err != nil {
+			return err
+		}
+		r.log.Info("debug output updated", zap.Bool("rule_attribute", cfg.debug().RuleAttribute),
+			zap.Bool("response_control", cfg.debug().ResponseControl))
+	}
+
+	if cfg.responseFormat() != r.cfg.responseFormat() {
+		if err := r.ldapSrv.SetResponseFormat(cfg.responseFormat()); err != nil {
+			return err
+		}
+		r.log.Info("response format updated", zap.Bool("sort_attributes", cfg.responseFormat().SortAttributes),
+			zap.String("attribute_names", cfg.AttributeNames))
+	}
+
+	if cfg.chaos() != r.cfg.chaos() {
+		if err := r.ldapSrv.SetChaos(cfg.chaos()); err != nil {
+			return err
+		}
+		r.log.Info("chaos updated", zap.String("bind_failure_ratio", cfg.ChaosBindFailureRatio),
+			zap.String("bind_failure_code", cfg.ChaosBindFailureCode), zap.String("max_concurrent_searches", cfg.ChaosMaxConcurrentSearches))
+	}
+
+	if cfg.rateLimit() != r.cfg.rateLimit() {
+		if err := r.ldapSrv.SetRateLimit(cfg.rateLimit()); err != nil {
+			return err
+		}
+		r.log.Info("rate limit updated", zap.String("requests_per_second", cfg.RateLimit),
+			zap.String("burst", cfg.RateLimitBurst), zap.String("action", cfg.RateLimitAction))
+	}
+
+	if cfg.requestLogSampling() != r.cfg.requestLogSampling() {
+		if err := r.ldapSrv.SetRequestLogSampling(cfg.requestLogSampling()); err != nil {
+			return err
+		}
+		r.log.Info("request log sampling updated", zap.String("rate", cfg.RequestLogSamplingRate))
+	}
+
+	level, _ := zapcore.ParseLevel(cfg.LogLevel)
+	r.level.SetLevel(level)
+
+	r.cfg = cfg
+
+	return nil
+}
+
+// listeners returns the settings that only take effect after a restart.
+func (c config) listeners() [11]string {
+	return [...]string{
+		c.LDAPHost, c.LDAPPort, c.LDAPNetwork, c.LDAPSPort, c.GCPort, c.LDAPISocket,
+		c.MockHost, c.MockPort, c.MockNetwork,
+		c.TLSCert, c.TLSKey,
+	}
+}
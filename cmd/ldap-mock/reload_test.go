@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/rom8726/ldap-mock/pkg/ldapmock"
+)
+
+func TestReloader_Reload(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "server.yaml")
+	mockPath := filepath.Join(dir, "mock.yaml")
+
+	writeFile := func(path, data string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatalf("write %s: %v", path, err)
+		}
+	}
+
+	writeFile(mockPath, "users:\n  - cn: before\n")
+	writeFile(configPath, "ldap:\n  username: cn=old\nmock:\n  file: "+mockPath+"\nlog:\n  level: info\n")
+
+	args := []string{"-config", configPath}
+	cfg, err := parseConfig(args, os.Stderr)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	log := zap.NewNop()
+	ldapSrv := ldapmock.NewLDAPServer(log, "0", cfg.Username, cfg.Password, nil)
+	mockSrv := ldapmock.NewMockServer(log, "0", ldapSrv, nil)
+	level := zap.NewAtomicLevelAt(zapcore.InfoLevel)
+
+	r := &reloader{log: log, level: level, ldapSrv: ldapSrv, mockSrv: mockSrv, args: args, cfg: cfg}
+
+	writeFile(mockPath, "users:\n  - cn: after\n")
+	writeFile(configPath, "ldap:\n  username: cn=new\n  password: pw\nmock:\n  file: "+mockPath+"\nlog:\n  level: warn\n")
+
+	if err := r.reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+
+	if users := ldapSrv.GetMock().Users; len(users) != 1 || users[0].CN != "after" {
+		t.Errorf("mock users = %v, want [after]", users)
+	}
+	if err := ldapSrv.OnBind(t.Context(), ldapmock.BindRequest{DN: "cn=new", Password: "pw"}); err != nil {
+		t.Errorf("bind with reloaded credentials: %v", err)
+	}
+	if level.Level() != zapcore.WarnLevel {
+		t.Errorf("log level = %v, want warn", level.Level())
+	}
+
+	writeFile(configPath, "ldap:\n  username: [broken\n")
+	if err := r.reload(); err == nil {
+		t.Fatal("expected reload error for invalid config")
+	}
+	if r.cfg.Username != "cn=new" {
+		t.Errorf("config changed after failed reload: %+v", r.cfg)
+	}
+}
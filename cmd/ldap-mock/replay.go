@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rom8726/ldap-mock/pkg/ldapmock"
+)
+
+// errReplayChanged makes `ldap-mock replay` exit non-zero when searches
+// changed, so it can gate fixture refactors in CI.
+var errReplayChanged = errors.New("replayed searches changed")
+
+// runReplay implements `ldap-mock replay`: it re-evaluates an exported
+// request log against a mock file and prints the searches that changed.
+func runReplay(ctx context.Context, args []string, output io.Writer) error {
+	fs := flag.NewFlagSet("ldap-mock replay", flag.ContinueOnError)
+	fs.SetOutput(output)
+
+	concurrency := fs.Int("concurrency", 4, "number of searches evaluated in parallel")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+
+	fs.Usage = func() {
+		_, _ = fmt.Fprintf(fs.Output(), "Usage: ldap-mock replay [flags] <mock file> <request log>\n\n"+
+			"The request log is an export of GET /requests?format=ndjson (or GET /requests).\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("replay needs a mock file and a request log")
+	}
+
+	mock, _, err := readMockFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(fs.Arg(1))
+	if err != nil {
+		return fmt.Errorf("open request log: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	logs, err := ldapmock.ReadRequestLog(f)
+	if err != nil {
+		return err
+	}
+
+	report, err := ldapmock.Replay(ctx, mock, logs, *concurrency)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(output)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+	} else {
+		printReplayReport(output, report)
+	}
+
+	if len(report.Results) > 0 {
+		return errReplayChanged
+	}
+
+	return nil
+}
+
+func printReplayReport(w io.Writer, report ldapmock.ReplayReport) {
+	for _, result := range report.Results {
+		_, _ = fmt.Fprintf(w, "%s base=%q scope=%s filter=%s\n", result.RequestID, result.BaseDN, result.Scope, result.Filter)
+
+		if result.RuleChanged {
+			_, _ = fmt.Fprintf(w, "  rule: %s -> %s\n", replayRuleLabel(result.RecordedRule), replayRuleLabel(result.ReplayedRule))
+		}
+		if result.ResponseChanged {
+			_, _ = fmt.Fprintf(w, "  entries: [%s] -> [%s]\n",
+				strings.Join(result.RecordedDNs, "; "), strings.Join(result.ReplayedDNs, "; "))
+		}
+	}
+
+	_, _ = fmt.Fprintf(w, "%d searches replayed: %d matched a different rule, %d returned different entries\n",
+		report.Searches, report.RuleChanged, report.ResponseChanged)
+}
+
+func replayRuleLabel(rule *ldapmock.MatchedRuleLog) string {
+	switch {
+	case rule == nil:
+		return "fallback"
+	case rule.RuleID != "":
+		return fmt.Sprintf("%q", rule.RuleID)
+	default:
+		return fmt.Sprintf("%q", rule.RuleName)
+	}
+}
+
+// readMockFile decodes a YAML (or .json) mock file. It also returns the
+// fields of the file the mock has no use for, prefixed with the file name.
+func readMockFile(path string) (ldapmock.LDAPMock, []string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ldapmock.LDAPMock{}, nil, fmt.Errorf("read mock file: %w", err)
+	}
+
+	decode := ldapmock.DecodeMockYAML
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		decode = ldapmock.DecodeMockJSON
+	}
+
+	mock, unknown, err := decode(data)
+	if err != nil {
+		return ldapmock.LDAPMock{}, nil, fmt.Errorf("load mock file %s: %w", path, err)
+	}
+
+	for i := range unknown {
+		unknown[i] = filepath.Base(path) + ": " + unknown[i]
+	}
+
+	return mock, unknown, nil
+}
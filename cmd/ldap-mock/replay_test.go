@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunReplay(t *testing.T) {
+	dir := t.TempDir()
+
+	mockPath := filepath.Join(dir, "mock.yaml")
+	mock := `
+rules:
+  - id: john-v2
+    filter: "(uid=john)"
+    response:
+      users:
+        - cn: "uid=john,dc=example"
+`
+	if err := os.WriteFile(mockPath, []byte(mock), 0o600); err != nil {
+		t.Fatalf("write mock: %v", err)
+	}
+
+	logPath := filepath.Join(dir, "requests.ndjson")
+	logs := `{"request_id":"r1","type":"search","base_dn":"dc=example","scope":"sub","filter":"(uid=john)","matched_rule":{"id":"john","name":""},"response":{"returned_dns":["uid=john,dc=example"],"count":1}}
+{"request_id":"r2","type":"bind","bind_dn":"cn=admin"}
+`
+	if err := os.WriteFile(logPath, []byte(logs), 0o600); err != nil {
+		t.Fatalf("write log: %v", err)
+	}
+
+	var out bytes.Buffer
+	err := runReplay(context.Background(), []string{"-concurrency", "2", mockPath, logPath}, &out)
+	if !errors.Is(err, errReplayChanged) {
+		t.Fatalf("err = %v, want errReplayChanged", err)
+	}
+
+	for _, want := range []string{
+		`r1 base="dc=example" scope=sub filter=(uid=john)`,
+		`rule: "john" -> "john-v2"`,
+		"1 searches replayed: 1 matched a different rule, 0 returned different entries",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output %q does not contain %q", out.String(), want)
+		}
+	}
+
+	if err := runReplay(context.Background(), []string{mockPath}, &out); err == nil {
+		t.Error("expected error without a request log")
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"go.uber.org/zap"
+
+	"github.com/rom8726/ldap-mock/pkg/ldapmock"
+)
+
+// stateFile saves every mock the LDAP server activates to a JSON state
+// file, so that the mock, with the changes of LDAP writes, survives
+// restarts. save is registered with LDAPServer.OnMockChange, which calls it
+// in order.
+type stateFile struct {
+	path string
+	log  *zap.Logger
+}
+
+func (f stateFile) save(mock ldapmock.LDAPMock) {
+	if err := saveState(f.path, mock); err != nil {
+		f.log.Warn("save state file", zap.String("file", f.path), zap.Error(err))
+	}
+}
+
+// saveState writes mock to path through a temporary file, so a crash never
+// leaves a truncated state file behind.
+func saveState(path string, mock ldapmock.LDAPMock) error {
+	data, err := mock.JSON()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("create state file: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("write state file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write state file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("replace state file: %w", err)
+	}
+
+	return nil
+}
+
+// loadState loads the mock saved in the state file at path. loaded is false
+// when there is no state file yet.
+func loadState(mockSrv *ldapmock.MockServer, path string) (loaded bool, err error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("read state file: %w", err)
+	}
+
+	if err := mockSrv.LoadMockJSON(data); err != nil {
+		return false, fmt.Errorf("load state file %s: %w", path, err)
+	}
+
+	return true, nil
+}
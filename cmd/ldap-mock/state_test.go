@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/rom8726/ldap-mock/pkg/ldapmock"
+)
+
+func TestStateFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	log := zap.NewNop()
+
+	newServers := func() (*ldapmock.LDAPServer, *ldapmock.MockServer) {
+		ldapSrv := ldapmock.NewLDAPServer(log, "0", "", "", nil)
+		ldapSrv.OnMockChange(stateFile{path: path, log: log}.save)
+
+		return ldapSrv, ldapmock.NewMockServer(log, "0", ldapSrv, nil)
+	}
+
+	_, mockSrv := newServers()
+	if loaded, err := loadState(mockSrv, path); err != nil || loaded {
+		t.Fatalf("load missing state file: loaded %v, err %v", loaded, err)
+	}
+
+	if err := mockSrv.LoadMockYAML([]byte("users:\n  - cn: uid=john,dc=example\n    attrs:\n      uid: john\n")); err != nil {
+		t.Fatalf("load mock: %v", err)
+	}
+
+	ldapSrv, mockSrv := newServers()
+	if loaded, err := loadState(mockSrv, path); err != nil || !loaded {
+		t.Fatalf("load state file: loaded %v, err %v", loaded, err)
+	}
+	if users := ldapSrv.GetMock().Users; len(users) != 1 || users[0].CN != "uid=john,dc=example" {
+		t.Errorf("restored users = %v, want uid=john,dc=example", users)
+	}
+
+	// Runtime mutations from LDAP writes are saved too.
+	if err := ldapSrv.AddEntry(ldapmock.Entry{DN: "uid=jane,dc=example", Attrs: map[string][]string{"uid": {"jane"}}}); err != nil {
+		t.Fatalf("add entry: %v", err)
+	}
+
+	ldapSrv, mockSrv = newServers()
+	if loaded, err := loadState(mockSrv, path); err != nil || !loaded {
+		t.Fatalf("load state file after add: loaded %v, err %v", loaded, err)
+	}
+	if users := ldapSrv.GetMock().Users; len(users) != 2 || users[1].CN != "uid=jane,dc=example" {
+		t.Errorf("restored users after add = %v, want john and jane", users)
+	}
+
+	if tmp, _ := filepath.Glob(path + ".*.tmp"); len(tmp) != 0 {
+		t.Errorf("temporary files left behind: %v", tmp)
+	}
+
+	if err := os.WriteFile(path, []byte("{"), 0o600); err != nil {
+		t.Fatalf("write state file: %v", err)
+	}
+	if _, err := loadState(mockSrv, path); err == nil {
+		t.Error("expected error for a corrupt state file")
+	}
+}
@@ -0,0 +1,103 @@
+package ldapmock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"go.uber.org/zap"
+)
+
+// AddEntry adds entry to the current mock, exactly like an LDAP Add request:
+// to the users and groups of the tenant whose base DN contains its DN, or to
+// the top-level ones. Entries with a group object class become groups (see
+// ImportEntries). It fails with entryAlreadyExists(68) when the directory has
+// an entry with that DN.
+//
+// Unlike SetMock, statistics are kept and the schedule goes on; the change
+// still gets a new mock version and is recorded in the changelog.
+func (s *LDAPServer) AddEntry(entry Entry) error {
+	dn, err := parseEntryDN(entry.DN)
+	if err != nil {
+		return err
+	}
+
+	s.setMockMu.Lock()
+	defer s.setMockMu.Unlock()
+
+	snapshot := s.mock.Load()
+	mock := snapshot.mock.Clone()
+
+	users, groups := &mock.Users, &mock.Groups
+	if i := mock.tenantIndex(entry.DN); i >= 0 {
+		users, groups = &mock.Tenants[i].Users, &mock.Tenants[i].Groups
+	}
+
+	if slices.ContainsFunc(*users, func(user User) bool { return sameDN(user.CN, dn) }) ||
+		slices.ContainsFunc(*groups, func(group Group) bool { return sameDN(group.CN, dn) }) {
+		return ldap.NewError(ldap.LDAPResultEntryAlreadyExists, fmt.Errorf("entry %s already exists", entry.DN))
+	}
+
+	added, addedGroups := ImportEntries([]Entry{entry})
+	*users = append(*users, added...)
+	*groups = append(*groups, addedGroups...)
+
+	s.swapMock(mock, snapshot.activated)
+
+	return nil
+}
+
+// parseEntryDN returns the normalized RDNs of the DN of an entry to write, or
+// invalidDNSyntax(34) when it is empty or an RDN has no attribute type.
+func parseEntryDN(dn string) ([]string, error) {
+	rdns := splitDN(dn)
+	if len(rdns) == 0 {
+		return nil, ldap.NewError(ldap.LDAPResultInvalidDNSyntax, errors.New("empty entry DN"))
+	}
+
+	for _, rdn := range rdns {
+		if attr, _, ok := strings.Cut(rdn, "="); !ok || attr == "" {
+			return nil, ldap.NewError(ldap.LDAPResultInvalidDNSyntax, fmt.Errorf("invalid DN %q", dn))
+		}
+	}
+
+	return rdns, nil
+}
+
+// sameDN reports whether dn names the entry of the normalized RDNs rdns.
+func sameDN(dn string, rdns []string) bool {
+	return slices.Equal(splitDN(dn), rdns)
+}
+
+// serveAdd handles add requests, adding the entry to the mock (see
+// AddEntry). Read-only mode refuses them before they get here.
+func (s *LDAPServer) serveAdd(ctx context.Context, p *ber.Packet, w responseWriter) bool {
+	msgID, entry, err := parseAddRequest(p)
+	if errors.Is(err, errNotThisOperation) {
+		return false
+	}
+
+	if err != nil {
+		err = ldap.NewError(ldap.LDAPResultProtocolError, err)
+	} else {
+		err = s.AddEntry(entry)
+	}
+
+	if err != nil {
+		s.logger(ctx).Info("add failed", zap.String("dn", entry.DN), zap.Error(err))
+	} else {
+		s.logger(ctx).Info("entry added", zap.String("dn", entry.DN))
+	}
+
+	requestLog := s.newRequestLog(ctx, "add", err)
+	requestLog.BaseDN = entry.DN
+	s.logRequest(requestLog)
+
+	_ = w(newResultPacket(msgID, ldap.ApplicationAddResponse, err), 0)
+
+	return true
+}
@@ -0,0 +1,72 @@
+package ldapmock
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+	"go.uber.org/zap"
+)
+
+func TestLDAPServer_AddEntry(t *testing.T) {
+	srv := NewLDAPServer(zap.NewNop(), "0", "", "", nil)
+	srv.SetMock(LDAPMock{
+		Users:   []User{{CN: "uid=john,dc=example", Attrs: map[string]string{"uid": "john"}}},
+		Tenants: []Tenant{{Name: "acme", BaseDN: "dc=acme"}},
+	})
+
+	entries := []Entry{
+		{DN: "uid=jane,dc=example", Attrs: map[string][]string{"uid": {"jane"}, "mail": {"jane@example.com"}}},
+		{DN: "uid=joe,ou=users,dc=acme", Attrs: map[string][]string{"uid": {"joe"}}},
+		{DN: "cn=admins,dc=example", Attrs: map[string][]string{"objectClass": {"top", "groupOfNames"}, "member": {"uid=jane,dc=example"}}},
+	}
+	for _, entry := range entries {
+		if err := srv.AddEntry(entry); err != nil {
+			t.Fatalf("add %s: %v", entry.DN, err)
+		}
+	}
+
+	mock := srv.GetMock()
+	if len(mock.Users) != 2 || mock.Users[1].CN != "uid=jane,dc=example" || mock.Users[1].Attrs["mail"] != "jane@example.com" {
+		t.Errorf("users = %+v, want john and jane", mock.Users)
+	}
+	if len(mock.Tenants[0].Users) != 1 || mock.Tenants[0].Users[0].CN != "uid=joe,ou=users,dc=acme" {
+		t.Errorf("tenant users = %+v, want joe", mock.Tenants[0].Users)
+	}
+	if len(mock.Groups) != 1 || len(mock.Groups[0].Members) != 1 {
+		t.Errorf("groups = %+v, want admins with jane", mock.Groups)
+	}
+
+	if version := srv.MockVersion(); version != 4 {
+		t.Errorf("mock version = %d, want 4", version)
+	}
+	if changes, _ := srv.Changes(1); len(changes) != 3 || changes[0].Type != "add" {
+		t.Errorf("changes = %+v, want the 3 adds", changes)
+	}
+
+	result, err := srv.OnSearch(t.Context(), SearchRequest{Filter: "(uid=jane)", Scope: ScopeSub})
+	if err != nil || len(result.Users) != 1 {
+		t.Errorf("search of the added user = %v, %v", result.Users, err)
+	}
+
+	tests := []struct {
+		dn   string
+		code uint16
+	}{
+		{"UID=John, DC=Example", ldap.LDAPResultEntryAlreadyExists},
+		{"cn=admins,dc=example", ldap.LDAPResultEntryAlreadyExists},
+		{"", ldap.LDAPResultInvalidDNSyntax},
+		{"john,dc=example", ldap.LDAPResultInvalidDNSyntax},
+	}
+	for _, tt := range tests {
+		err := srv.AddEntry(Entry{DN: tt.dn})
+
+		var ldapErr *ldap.Error
+		if !errors.As(err, &ldapErr) || ldapErr.ResultCode != tt.code {
+			t.Errorf("add %q: err = %v, want result code %d", tt.dn, err, tt.code)
+		}
+	}
+	if version := srv.MockVersion(); version != 4 {
+		t.Errorf("mock version after failed adds = %d, want 4", version)
+	}
+}
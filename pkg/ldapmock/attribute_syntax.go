@@ -0,0 +1,134 @@
+package ldapmock
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// AttributeSyntax selects how search filters compare the values of an
+// attribute. Attributes without a declared syntax compare as case-insensitive
+// strings, ordered numerically when both values are integers.
+type AttributeSyntax string
+
+const (
+	// SyntaxCaseIgnore compares values as case-insensitive strings.
+	SyntaxCaseIgnore AttributeSyntax = "caseIgnore"
+	// SyntaxCaseExact compares values as case-sensitive strings, as
+	// directories do for userPassword.
+	SyntaxCaseExact AttributeSyntax = "caseExact"
+	// SyntaxInteger compares values as integers; non-integer values never
+	// match.
+	SyntaxInteger AttributeSyntax = "integer"
+	// SyntaxDN compares values as distinguished names, ignoring case and
+	// the spacing around separators.
+	SyntaxDN AttributeSyntax = "dn"
+)
+
+var knownAttributeSyntaxes = []AttributeSyntax{SyntaxCaseIgnore, SyntaxCaseExact, SyntaxInteger, SyntaxDN}
+
+func (s *AttributeSyntax) parse(v string) error {
+	for _, known := range knownAttributeSyntaxes {
+		if strings.EqualFold(v, string(known)) {
+			*s = known
+			return nil
+		}
+	}
+
+	return fmt.Errorf("invalid attribute syntax %q: must be one of caseIgnore, caseExact, integer, dn", v)
+}
+
+func (s *AttributeSyntax) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var v string
+	if err := unmarshal(&v); err != nil {
+		return err
+	}
+
+	return s.parse(v)
+}
+
+func (s *AttributeSyntax) UnmarshalJSON(data []byte) error {
+	var v string
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	return s.parse(v)
+}
+
+// AttributeSyntaxes maps attribute names, matched case-insensitively, to
+// their syntax.
+type AttributeSyntaxes map[string]AttributeSyntax
+
+// MatchEntry is like the package-level MatchEntry, comparing the values of
+// every attribute according to its syntax.
+func (s AttributeSyntaxes) MatchEntry(filter *Filter, dn string, attrs map[string]string) bool {
+	if attrs == nil {
+		attrs = map[string]string{}
+	}
+
+	return entryMatcher{dn: dn, single: attrs, syntaxes: s.lower()}.match(filter)
+}
+
+func (s AttributeSyntaxes) lower() AttributeSyntaxes {
+	if len(s) == 0 {
+		return nil
+	}
+
+	lower := make(AttributeSyntaxes, len(s))
+	for name, syntax := range s {
+		lower[strings.ToLower(name)] = syntax
+	}
+
+	return lower
+}
+
+// equal reports whether value of attr equals assertion. s must be lowered.
+func (s AttributeSyntaxes) equal(attr, value, assertion string) bool {
+	switch s[attr] {
+	case SyntaxCaseExact:
+		return value == assertion
+	case SyntaxInteger:
+		return integerMatch(value, assertion)
+	case SyntaxDN:
+		return dnMatch(value, assertion)
+	default:
+		return strings.EqualFold(value, assertion)
+	}
+}
+
+// compare orders value of attr against assertion; ok is false when the
+// values have no order under the syntax. s must be lowered.
+func (s AttributeSyntaxes) compare(attr, value, assertion string) (result int, ok bool) {
+	switch s[attr] {
+	case SyntaxCaseExact:
+		return strings.Compare(value, assertion), true
+	case SyntaxCaseIgnore, SyntaxDN:
+		return strings.Compare(strings.ToLower(value), strings.ToLower(assertion)), true
+	case SyntaxInteger:
+		v, err1 := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		a, err2 := strconv.ParseInt(strings.TrimSpace(assertion), 10, 64)
+		if err1 != nil || err2 != nil {
+			return 0, false
+		}
+		return cmp.Compare(v, a), true
+	default:
+		return compareValues(value, assertion), true
+	}
+}
+
+// dnMatch compares two DNs by their parsed RDNs, falling back to a
+// case-insensitive string comparison when either does not parse.
+func dnMatch(value, assertion string) bool {
+	v, err1 := ldap.ParseDN(value)
+	a, err2 := ldap.ParseDN(assertion)
+	if err1 != nil || err2 != nil {
+		return strings.EqualFold(value, assertion)
+	}
+
+	return v.EqualFold(a)
+}
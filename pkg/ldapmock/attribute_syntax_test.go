@@ -0,0 +1,51 @@
+package ldapmock
+
+import "testing"
+
+func TestAttributeSyntaxes_MatchEntry(t *testing.T) {
+	syntaxes := AttributeSyntaxes{
+		"userPassword": SyntaxCaseExact,
+		"UIDNumber":    SyntaxInteger,
+		"member":       SyntaxDN,
+		"employeeID":   SyntaxCaseIgnore,
+	}
+	attrs := map[string]string{
+		"userPassword": "Secret",
+		"uidNumber":    "0100",
+		"member":       "CN=John, OU=People,DC=example",
+		"employeeID":   "90",
+		"gidNumber":    "100",
+	}
+
+	tests := []struct {
+		filter string
+		want   bool
+	}{
+		{filter: "(userPassword=Secret)", want: true},
+		{filter: "(userPassword=secret)", want: false},
+		{filter: "(userPassword=Sec*)", want: true},
+		{filter: "(userPassword=sec*)", want: false},
+		{filter: "(userPassword:=secret)", want: false},
+		{filter: "(uidNumber=100)", want: true},
+		{filter: "(uidNumber>=99)", want: true},
+		{filter: "(uidNumber<=99)", want: false},
+		{filter: "(uidNumber>=abc)", want: false},
+		{filter: "(member=cn=john,ou=people,dc=example)", want: true},
+		{filter: "(member=cn=jane,ou=people,dc=example)", want: false},
+		{filter: "(employeeID>=100)", want: true},
+		{filter: "(gidNumber>=99)", want: true},
+		{filter: "(gidNumber=0100)", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			f, err := ParseFilter(tt.filter)
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			if got := syntaxes.MatchEntry(f, "", attrs); got != tt.want {
+				t.Errorf("MatchEntry = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package ldapmock
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// MockAuth protects the HTTP control API and the UI. Requests must carry
+// either the basic auth credentials or the API key (X-API-Key header or
+// "Authorization: Bearer <key>"). The zero value disables authentication.
+type MockAuth struct {
+	Username string
+	Password string
+	APIKey   string
+}
+
+func (a MockAuth) enabled() bool {
+	return a.Username != "" || a.APIKey != ""
+}
+
+func (a MockAuth) allows(r *http.Request) bool {
+	if a.APIKey != "" {
+		key := r.Header.Get("X-API-Key")
+		if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			key = bearer
+		}
+		if key != "" && secureEqual(key, a.APIKey) {
+			return true
+		}
+	}
+
+	if a.Username != "" {
+		username, password, ok := r.BasicAuth()
+		if ok && secureEqual(username, a.Username) && secureEqual(password, a.Password) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func secureEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// SetAuth requires credentials for every HTTP route; the zero MockAuth
+// disables authentication. It can be called while serving.
+func (s *MockServer) SetAuth(auth MockAuth) {
+	s.authMu.Lock()
+	defer s.authMu.Unlock()
+
+	s.auth = auth
+}
+
+func (s *MockServer) authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.authMu.RLock()
+		auth := s.auth
+		s.authMu.RUnlock()
+
+		if auth.enabled() && !auth.allows(r) {
+			if auth.Username != "" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="ldap-mock", charset="UTF-8"`)
+			}
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,61 @@
+package ldapmock
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestMockServer_Auth(t *testing.T) {
+	srv := NewMockServer(zap.NewNop(), "0", NewLDAPServer(zap.NewNop(), "0", "", "", nil), nil)
+
+	get := func(setup func(r *http.Request)) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/mock", nil)
+		if setup != nil {
+			setup(r)
+		}
+
+		rec := httptest.NewRecorder()
+		srv.srv.Handler.ServeHTTP(rec, r)
+
+		return rec
+	}
+
+	if rec := get(nil); rec.Code != http.StatusOK {
+		t.Fatalf("without auth configured: status = %d, want 200", rec.Code)
+	}
+
+	srv.SetAuth(MockAuth{Username: "admin", Password: "secret", APIKey: "key"})
+
+	tests := []struct {
+		name  string
+		setup func(r *http.Request)
+		want  int
+	}{
+		{name: "no credentials", want: http.StatusUnauthorized},
+		{name: "basic auth", setup: func(r *http.Request) { r.SetBasicAuth("admin", "secret") }, want: http.StatusOK},
+		{name: "wrong password", setup: func(r *http.Request) { r.SetBasicAuth("admin", "nope") }, want: http.StatusUnauthorized},
+		{name: "api key header", setup: func(r *http.Request) { r.Header.Set("X-API-Key", "key") }, want: http.StatusOK},
+		{name: "bearer token", setup: func(r *http.Request) { r.Header.Set("Authorization", "Bearer key") }, want: http.StatusOK},
+		{name: "wrong api key", setup: func(r *http.Request) { r.Header.Set("X-API-Key", "other") }, want: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := get(tt.setup)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if rec.Code == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("expected WWW-Authenticate challenge")
+			}
+		})
+	}
+
+	srv.SetAuth(MockAuth{})
+	if rec := get(nil); rec.Code != http.StatusOK {
+		t.Errorf("after disabling auth: status = %d, want 200", rec.Code)
+	}
+}
@@ -0,0 +1,174 @@
+package ldapmock
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Files of the archives written by MockServer.WriteBackup.
+const (
+	backupMockFile     = "mock.yaml"
+	backupCountersFile = "counters.json"
+	backupRequestsFile = "requests.json"
+)
+
+// maxBackupFileSize bounds the files read from a backup archive.
+const maxBackupFileSize = 256 << 20
+
+// backupFile is a file of a backup archive.
+type backupFile struct {
+	name string
+	data []byte
+}
+
+// Counters are the search counters of a mock holder, as saved in backups.
+type Counters struct {
+	Stats         Stats         `json:"stats"`
+	EmptySearches []EmptySearch `json:"empty_searches"`
+}
+
+// CounterRestorer is implemented by mock holders whose search counters can
+// be restored, as used by POST /restore.
+type CounterRestorer interface {
+	RestoreCounters(counters Counters)
+}
+
+// RestoreCounters replaces the search statistics with counters, as saved
+// from Stats and EmptySearches.
+func (s *LDAPServer) RestoreCounters(counters Counters) {
+	s.stats.restore(counters)
+}
+
+// WriteBackup writes the state of the mock, as served by GET /backup, to w:
+// a gzipped tar archive of the mock YAML (scheduled changes included), the
+// search counters when the mock holder collects them, and the request log.
+// RestoreBackup loads it back, on this host or another.
+func (s *MockServer) WriteBackup(w io.Writer) error {
+	yamlData, err := s.mockYAML()
+	if err != nil {
+		return err
+	}
+
+	files := []backupFile{{backupMockFile, []byte(yamlData)}}
+
+	if provider, ok := s.mockHolder.(StatsProvider); ok {
+		counters := Counters{Stats: provider.Stats(), EmptySearches: []EmptySearch{}}
+		if empty, ok := s.mockHolder.(EmptySearchProvider); ok {
+			counters.EmptySearches = empty.EmptySearches()
+		}
+
+		data, err := json.MarshalIndent(counters, "", "  ")
+		if err != nil {
+			return fmt.Errorf("encode counters: %w", err)
+		}
+		files = append(files, backupFile{backupCountersFile, data})
+	}
+
+	requests := s.requestLogger.List()
+	if requests == nil {
+		requests = []LDAPRequestLog{}
+	}
+	data, err := json.MarshalIndent(requests, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode requests: %w", err)
+	}
+	files = append(files, backupFile{backupRequestsFile, data})
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	modTime := time.Now()
+
+	for _, file := range files {
+		header := &tar.Header{Name: file.name, Mode: 0o644, Size: int64(len(file.data)), ModTime: modTime}
+		if err := tw.WriteHeader(header); err != nil {
+			return fmt.Errorf("write %s: %w", file.name, err)
+		}
+		if _, err := tw.Write(file.data); err != nil {
+			return fmt.Errorf("write %s: %w", file.name, err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	return gz.Close()
+}
+
+// RestoreBackup loads an archive written by WriteBackup, as POST /restore
+// does: the mock is activated, then the search counters (when the mock holder
+// can restore them) and the request log replace the current ones. Nothing is
+// changed when the archive is invalid.
+func (s *MockServer) RestoreBackup(r io.Reader) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("read backup: %w", err)
+	}
+	defer func() { _ = gz.Close() }()
+
+	files := make(map[string][]byte)
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("read backup: %w", err)
+		}
+
+		data, err := io.ReadAll(io.LimitReader(tr, maxBackupFileSize+1))
+		if err != nil {
+			return fmt.Errorf("read %s: %w", header.Name, err)
+		}
+		if len(data) > maxBackupFileSize {
+			return fmt.Errorf("read %s: file too large", header.Name)
+		}
+		files[header.Name] = data
+	}
+
+	yamlData, ok := files[backupMockFile]
+	if !ok {
+		return fmt.Errorf("read backup: no %s", backupMockFile)
+	}
+
+	mock, err := ParseMockYAML(yamlData)
+	if err != nil {
+		return fmt.Errorf("decode %s: %w", backupMockFile, err)
+	}
+
+	var counters *Counters
+	if data, ok := files[backupCountersFile]; ok {
+		counters = &Counters{}
+		if err := json.Unmarshal(data, counters); err != nil {
+			return fmt.Errorf("decode %s: %w", backupCountersFile, err)
+		}
+	}
+
+	var requests []LDAPRequestLog
+	if data, ok := files[backupRequestsFile]; ok {
+		if err := json.Unmarshal(data, &requests); err != nil {
+			return fmt.Errorf("decode %s: %w", backupRequestsFile, err)
+		}
+	}
+
+	s.setMock(mock, string(yamlData))
+
+	if restorer, ok := s.mockHolder.(CounterRestorer); ok && counters != nil {
+		restorer.RestoreCounters(*counters)
+	}
+
+	// The log lists the newest entries first; they are logged back oldest
+	// first.
+	s.requestLogger.Clear()
+	for i := len(requests) - 1; i >= 0; i-- {
+		s.requestLogger.Log(requests[i])
+	}
+
+	return nil
+}
@@ -0,0 +1,335 @@
+package ldapmock
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Capture formats.
+const (
+	// CaptureHex writes an annotated hex dump per message.
+	CaptureHex = "hex"
+	// CapturePcap writes a pcap file that Wireshark decodes as LDAP over
+	// TCP (IP and TCP headers are synthesized, there is no handshake).
+	CapturePcap = "pcap"
+)
+
+// CaptureConfig controls the capture of raw BER messages. When enabled,
+// every connection gets its own file in Dir.
+type CaptureConfig struct {
+	Enabled bool   `json:"enabled"`
+	Format  string `json:"format"`
+	Dir     string `json:"dir"`
+}
+
+// DefaultCaptureDir is used when capture is enabled without a directory.
+var DefaultCaptureDir = filepath.Join(os.TempDir(), "ldap-mock-capture")
+
+// SetCapture starts or stops capturing. Open connections switch to the new
+// configuration with their next message.
+func (s *LDAPServer) SetCapture(cfg CaptureConfig) error {
+	if cfg.Format == "" {
+		cfg.Format = CaptureHex
+	}
+	if cfg.Format != CaptureHex && cfg.Format != CapturePcap {
+		return fmt.Errorf("invalid capture format %q: must be %s or %s", cfg.Format, CaptureHex, CapturePcap)
+	}
+	if cfg.Dir == "" {
+		cfg.Dir = DefaultCaptureDir
+	}
+
+	if cfg.Enabled {
+		if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+			return fmt.Errorf("create capture dir: %w", err)
+		}
+	}
+
+	s.captureMu.Lock()
+	defer s.captureMu.Unlock()
+
+	s.capture = cfg
+	s.captureGen++
+
+	return nil
+}
+
+// Capture returns the current capture configuration.
+func (s *LDAPServer) Capture() CaptureConfig {
+	cfg, _ := s.captureState()
+
+	return cfg
+}
+
+func (s *LDAPServer) captureState() (CaptureConfig, uint64) {
+	s.captureMu.RLock()
+	defer s.captureMu.RUnlock()
+
+	return s.capture, s.captureGen
+}
+
+type captureDirection int
+
+const (
+	captureIn captureDirection = iota
+	captureOut
+)
+
+type captureWriter interface {
+	write(dir captureDirection, data []byte, t time.Time) error
+}
+
+var captureConnSeq atomic.Uint64
+
+// captureSession records the messages of one connection. It is only used
+// by the goroutine serving the connection.
+type captureSession struct {
+	srv  *LDAPServer
+	info ConnInfo
+	gen  uint64
+
+	file *os.File
+	buf  *bufio.Writer
+	w    captureWriter
+}
+
+func (s *LDAPServer) newCaptureSession(info ConnInfo) *captureSession {
+	return &captureSession{srv: s, info: info, gen: ^uint64(0)}
+}
+
+func (c *captureSession) record(dir captureDirection, data []byte) {
+	cfg, gen := c.srv.captureState()
+	if gen != c.gen {
+		c.close()
+		c.gen = gen
+
+		if cfg.Enabled {
+			if err := c.open(cfg); err != nil {
+				c.srv.log.Warn("open capture file", zap.Error(err))
+			}
+		}
+	}
+
+	if c.w == nil {
+		return
+	}
+
+	if err := c.w.write(dir, data, time.Now()); err != nil {
+		c.srv.log.Warn("write capture file", zap.Error(err))
+		c.close()
+		return
+	}
+
+	if err := c.buf.Flush(); err != nil {
+		c.srv.log.Warn("write capture file", zap.Error(err))
+		c.close()
+	}
+}
+
+func (c *captureSession) open(cfg CaptureConfig) error {
+	remote := "unknown"
+	if c.info.RemoteAddr != nil {
+		remote = strings.NewReplacer(":", "_", "/", "_", "[", "", "]", "").Replace(c.info.RemoteAddr.String())
+	}
+
+	name := fmt.Sprintf("%s-%d-%s.%s",
+		time.Now().UTC().Format("20060102T150405"), captureConnSeq.Add(1), remote, cfg.Format)
+
+	file, err := os.Create(filepath.Join(cfg.Dir, name))
+	if err != nil {
+		return err
+	}
+
+	c.file = file
+	c.buf = bufio.NewWriter(file)
+
+	if cfg.Format == CapturePcap {
+		c.w, err = newPcapCapture(c.buf, c.info)
+	} else {
+		c.w = &hexCapture{w: c.buf, info: c.info}
+	}
+	if err != nil {
+		c.close()
+		return err
+	}
+
+	return nil
+}
+
+func (c *captureSession) close() {
+	if c.file == nil {
+		return
+	}
+
+	_ = c.buf.Flush()
+	_ = c.file.Close()
+
+	c.file, c.buf, c.w = nil, nil, nil
+}
+
+type hexCapture struct {
+	w    *bufio.Writer
+	info ConnInfo
+}
+
+func (h *hexCapture) write(dir captureDirection, data []byte, t time.Time) error {
+	from, to := "client", "server"
+	if dir == captureOut {
+		from, to = to, from
+	}
+
+	_, err := fmt.Fprintf(h.w, "# %s %s -> %s (%d bytes) remote=%v\n%s\n",
+		t.UTC().Format(time.RFC3339Nano), from, to, len(data), h.info.RemoteAddr, hex.Dump(data))
+
+	return err
+}
+
+const (
+	pcapLinkTypeRaw = 101
+	pcapSnapLen     = 65535
+	// pcapMaxSegment keeps synthesized IPv4 packets below the 64 KiB limit.
+	pcapMaxSegment = 65000
+)
+
+// pcapCapture writes LINKTYPE_RAW packets with synthesized IP and TCP
+// headers, tracking sequence numbers per direction.
+type pcapCapture struct {
+	w *bufio.Writer
+
+	clientIP, serverIP     net.IP
+	clientPort, serverPort uint16
+	clientSeq, serverSeq   uint32
+}
+
+func newPcapCapture(w *bufio.Writer, info ConnInfo) (*pcapCapture, error) {
+	p := &pcapCapture{
+		w:          w,
+		clientIP:   net.IPv4(127, 0, 0, 1),
+		serverIP:   net.IPv4(127, 0, 0, 1),
+		clientPort: 1024,
+		serverPort: 389,
+		clientSeq:  1,
+		serverSeq:  1,
+	}
+
+	if addr, ok := info.RemoteAddr.(*net.TCPAddr); ok {
+		p.clientIP, p.clientPort = addr.IP, uint16(addr.Port)
+	}
+	if addr, ok := info.LocalAddr.(*net.TCPAddr); ok {
+		p.serverIP, p.serverPort = addr.IP, uint16(addr.Port)
+	}
+
+	// Both ends must use the same IP version.
+	if (p.clientIP.To4() == nil) != (p.serverIP.To4() == nil) {
+		p.clientIP, p.serverIP = p.clientIP.To16(), p.serverIP.To16()
+	}
+
+	header := make([]byte, 24)
+	binary.LittleEndian.PutUint32(header[0:], 0xa1b2c3d4)
+	binary.LittleEndian.PutUint16(header[4:], 2)
+	binary.LittleEndian.PutUint16(header[6:], 4)
+	binary.LittleEndian.PutUint32(header[16:], pcapSnapLen)
+	binary.LittleEndian.PutUint32(header[20:], pcapLinkTypeRaw)
+
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func (p *pcapCapture) write(dir captureDirection, data []byte, t time.Time) error {
+	for len(data) > 0 {
+		segment := data
+		if len(segment) > pcapMaxSegment {
+			segment = segment[:pcapMaxSegment]
+		}
+		data = data[len(segment):]
+
+		if err := p.writeSegment(dir, segment, t); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *pcapCapture) writeSegment(dir captureDirection, payload []byte, t time.Time) error {
+	srcIP, dstIP := p.clientIP, p.serverIP
+	srcPort, dstPort := p.clientPort, p.serverPort
+	seq, ack := &p.clientSeq, p.serverSeq
+	if dir == captureOut {
+		srcIP, dstIP = dstIP, srcIP
+		srcPort, dstPort = dstPort, srcPort
+		seq, ack = &p.serverSeq, p.clientSeq
+	}
+
+	tcp := make([]byte, 20)
+	binary.BigEndian.PutUint16(tcp[0:], srcPort)
+	binary.BigEndian.PutUint16(tcp[2:], dstPort)
+	binary.BigEndian.PutUint32(tcp[4:], *seq)
+	binary.BigEndian.PutUint32(tcp[8:], ack)
+	tcp[12] = 5 << 4
+	tcp[13] = 0x18 // PSH, ACK
+	binary.BigEndian.PutUint16(tcp[14:], 0xffff)
+
+	*seq += uint32(len(payload))
+
+	var ip []byte
+	if src4, dst4 := srcIP.To4(), dstIP.To4(); src4 != nil && dst4 != nil {
+		ip = make([]byte, 20)
+		ip[0] = 0x45
+		binary.BigEndian.PutUint16(ip[2:], uint16(len(ip)+len(tcp)+len(payload)))
+		binary.BigEndian.PutUint16(ip[6:], 0x4000) // don't fragment
+		ip[8] = 64
+		ip[9] = 6 // TCP
+		copy(ip[12:], src4)
+		copy(ip[16:], dst4)
+		binary.BigEndian.PutUint16(ip[10:], ipv4Checksum(ip))
+	} else {
+		ip = make([]byte, 40)
+		ip[0] = 0x60
+		binary.BigEndian.PutUint16(ip[4:], uint16(len(tcp)+len(payload)))
+		ip[6] = 6 // TCP
+		ip[7] = 64
+		copy(ip[8:], srcIP.To16())
+		copy(ip[24:], dstIP.To16())
+	}
+
+	length := uint32(len(ip) + len(tcp) + len(payload))
+
+	record := make([]byte, 16)
+	binary.LittleEndian.PutUint32(record[0:], uint32(t.Unix()))
+	binary.LittleEndian.PutUint32(record[4:], uint32(t.Nanosecond()/1000))
+	binary.LittleEndian.PutUint32(record[8:], length)
+	binary.LittleEndian.PutUint32(record[12:], length)
+
+	for _, b := range [][]byte{record, ip, tcp, payload} {
+		if _, err := p.w.Write(b); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func ipv4Checksum(header []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(header); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(header[i:]))
+	}
+	for sum > 0xffff {
+		sum = (sum >> 16) + (sum & 0xffff)
+	}
+
+	return ^uint16(sum)
+}
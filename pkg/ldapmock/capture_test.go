@@ -0,0 +1,64 @@
+package ldapmock
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestPcapCapture(t *testing.T) {
+	var out bytes.Buffer
+	w := bufio.NewWriter(&out)
+
+	p, err := newPcapCapture(w, ConnInfo{
+		RemoteAddr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 50000},
+		LocalAddr:  &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 389},
+	})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	now := time.Unix(1700000000, 0)
+	if err := p.write(captureIn, []byte{0x30, 0x05, 0x02, 0x01, 0x01, 0x42, 0x00}, now); err != nil {
+		t.Fatalf("write in: %v", err)
+	}
+	if err := p.write(captureOut, []byte{0x30, 0x00}, now); err != nil {
+		t.Fatalf("write out: %v", err)
+	}
+	_ = w.Flush()
+
+	data := out.Bytes()
+	if magic := binary.LittleEndian.Uint32(data); magic != 0xa1b2c3d4 {
+		t.Fatalf("magic = %x", magic)
+	}
+	if link := binary.LittleEndian.Uint32(data[20:]); link != pcapLinkTypeRaw {
+		t.Errorf("link type = %d", link)
+	}
+
+	data = data[24:]
+	if length := binary.LittleEndian.Uint32(data[8:]); length != 20+20+7 {
+		t.Fatalf("first record length = %d, want 47", length)
+	}
+
+	ip := data[16:36]
+	if ipv4Checksum(ip) != 0 {
+		t.Error("IPv4 header checksum does not verify")
+	}
+	if !net.IP(ip[12:16]).Equal(net.IPv4(10, 0, 0, 2)) {
+		t.Errorf("source IP = %v, want the client", net.IP(ip[12:16]))
+	}
+
+	tcp := data[36:56]
+	if src, dst := binary.BigEndian.Uint16(tcp[0:]), binary.BigEndian.Uint16(tcp[2:]); src != 50000 || dst != 389 {
+		t.Errorf("ports = %d -> %d, want 50000 -> 389", src, dst)
+	}
+
+	second := data[16+47:]
+	tcp = second[16+20 : 16+40]
+	if src, seq, ack := binary.BigEndian.Uint16(tcp[0:]), binary.BigEndian.Uint32(tcp[4:]), binary.BigEndian.Uint32(tcp[8:]); src != 389 || seq != 1 || ack != 8 {
+		t.Errorf("reply src=%d seq=%d ack=%d, want 389, 1, 8", src, seq, ack)
+	}
+}
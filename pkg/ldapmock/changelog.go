@@ -0,0 +1,223 @@
+package ldapmock
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultChangelogCapacity is the number of changes the changelog keeps;
+// older ones are dropped.
+const DefaultChangelogCapacity = 10000
+
+// Change types.
+const (
+	ChangeAdd    = "add"
+	ChangeDelete = "delete"
+	ChangeModify = "modify"
+)
+
+// Change is one mutation of a directory entry, like an entry of cn=changelog.
+type Change struct {
+	// Seq numbers the changes from 1, without gaps.
+	Seq  uint64    `json:"seq"`
+	Time time.Time `json:"time"`
+	Type string    `json:"type"`
+	DN   string    `json:"dn"`
+	// Attributes holds the entry after an add or modify.
+	Attributes map[string][]string `json:"attributes,omitempty"`
+	// previous holds the entry before a modify or delete, so that
+	// synchronized searches tell whether it matched their filter.
+	previous map[string][]string
+}
+
+// ChangelogProvider is implemented by mock holders that record directory
+// mutations, as used by GET /changes.
+type ChangelogProvider interface {
+	// Changes returns the changes after seq, oldest first, and the sequence
+	// number of the last change.
+	Changes(since uint64) ([]Change, uint64)
+}
+
+// changelog keeps the last changes in memory.
+type changelog struct {
+	mu       sync.Mutex
+	changes  []Change
+	last     uint64
+	capacity int
+	// notify is closed, and replaced, when changes are recorded.
+	notify chan struct{}
+}
+
+// changed returns a channel closed when the next changes are recorded.
+func (c *changelog) changed() <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.notify == nil {
+		c.notify = make(chan struct{})
+	}
+
+	return c.notify
+}
+
+// lastSeq returns the sequence number of the last change.
+func (c *changelog) lastSeq() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.last
+}
+
+// oldestSeq returns the sequence number of the oldest change kept, or the
+// next one when none is.
+func (c *changelog) oldestSeq() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.changes) == 0 {
+		return c.last + 1
+	}
+
+	return c.changes[0].Seq
+}
+
+func (c *changelog) record(changes []Change, now time.Time) {
+	if len(changes) == 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, change := range changes {
+		c.last++
+		change.Seq = c.last
+		change.Time = now.UTC()
+		c.changes = append(c.changes, change)
+	}
+
+	capacity := c.capacity
+	if capacity <= 0 {
+		capacity = DefaultChangelogCapacity
+	}
+	if extra := len(c.changes) - capacity; extra > 0 {
+		c.changes = slices.Delete(c.changes, 0, extra)
+	}
+
+	if c.notify != nil {
+		close(c.notify)
+		c.notify = nil
+	}
+}
+
+func (c *changelog) since(seq uint64) ([]Change, uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	i, _ := slices.BinarySearchFunc(c.changes, seq+1, func(change Change, seq uint64) int {
+		switch {
+		case change.Seq < seq:
+			return -1
+		case change.Seq > seq:
+			return 1
+		default:
+			return 0
+		}
+	})
+
+	return slices.Clone(c.changes[i:]), c.last
+}
+
+// latestChanges returns the last change of each entry of changes, which
+// tells its current state, in the order of changes, with the entry as it was
+// before the first one. An entry added within changes and modified since is
+// an add.
+func latestChanges(changes []Change) []Change {
+	latest := make(map[string]int, len(changes))
+	first := make(map[string]int, len(changes))
+	added := make(map[string]bool)
+	for i, change := range changes {
+		key := strings.Join(splitDN(change.DN), ",")
+		latest[key] = i
+		if _, ok := first[key]; !ok {
+			first[key] = i
+		}
+		if change.Type == ChangeAdd {
+			added[key] = true
+		}
+	}
+
+	var result []Change
+	for i, change := range changes {
+		key := strings.Join(splitDN(change.DN), ",")
+		if latest[key] != i {
+			continue
+		}
+		if change.Type == ChangeModify && added[key] {
+			change.Type = ChangeAdd
+		}
+		change.previous = changes[first[key]].previous
+
+		result = append(result, change)
+	}
+
+	return result
+}
+
+// Changes returns the directory mutations after seq, oldest first, and the
+// sequence number of the last one. Every SetMock records the entries it
+// adds, deletes or modifies.
+func (s *LDAPServer) Changes(since uint64) ([]Change, uint64) {
+	return s.changelog.since(since)
+}
+
+// mockChanges compares the users and groups of two mocks, with their tenants,
+// and returns the changes from before to after: adds and modifies in the
+// order of after, then deletes in the order of before.
+func mockChanges(before, after LDAPMock) []Change {
+	beforeEntries, beforeIndex := mockEntries(before)
+	afterEntries, afterIndex := mockEntries(after)
+
+	var changes []Change
+	for _, entry := range afterEntries {
+		previous, ok := beforeIndex[strings.ToLower(entry.DN)]
+		switch {
+		case !ok:
+			changes = append(changes, Change{Type: ChangeAdd, DN: entry.DN, Attributes: entry.Attrs})
+		case previous.DN != entry.DN || !maps.EqualFunc(previous.Attrs, entry.Attrs, slices.Equal):
+			changes = append(changes, Change{Type: ChangeModify, DN: entry.DN, Attributes: entry.Attrs, previous: previous.Attrs})
+		}
+	}
+
+	for _, entry := range beforeEntries {
+		if _, ok := afterIndex[strings.ToLower(entry.DN)]; !ok {
+			changes = append(changes, Change{Type: ChangeDelete, DN: entry.DN, previous: entry.Attrs})
+		}
+	}
+
+	return changes
+}
+
+// mockEntries returns the fallback users and groups of mock and its tenants,
+// indexed by lowercased DN.
+func mockEntries(mock LDAPMock) ([]Entry, map[string]Entry) {
+	var entries []Entry
+	appendEntries := func(users []User, groups []Group) {
+		entries = slices.AppendSeq(entries, SearchResult{Users: users, Groups: groups}.entries())
+	}
+
+	appendEntries(mock.Users, mock.Groups)
+	for _, tenant := range mock.Tenants {
+		appendEntries(tenant.Users, tenant.Groups)
+	}
+
+	index := make(map[string]Entry, len(entries))
+	for _, entry := range entries {
+		index[strings.ToLower(entry.DN)] = entry
+	}
+
+	return entries, index
+}
@@ -0,0 +1,78 @@
+package ldapmock
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMockChanges(t *testing.T) {
+	before := LDAPMock{
+		Users: []User{
+			{CN: "uid=john,dc=example", Attrs: map[string]string{"mail": "john@example"}},
+			{CN: "uid=jane,dc=example", Attrs: map[string]string{"mail": "jane@example"}},
+		},
+		Groups: []Group{{CN: "cn=admins,dc=example", Members: []string{"uid=john,dc=example"}}},
+	}
+	after := LDAPMock{
+		Users: []User{
+			{CN: "uid=john,dc=example", Attrs: map[string]string{"mail": "john@example"}},
+			{CN: "uid=joe,dc=example", Attrs: map[string]string{"mail": "joe@example"}},
+		},
+		Groups:  []Group{{CN: "cn=admins,dc=example", Members: []string{"uid=joe,dc=example"}}},
+		Tenants: []Tenant{{BaseDN: "dc=other", Users: []User{{CN: "uid=ann,dc=other"}}}},
+	}
+
+	got := mockChanges(before, after)
+	want := []Change{
+		{Type: ChangeAdd, DN: "uid=joe,dc=example", Attributes: map[string][]string{"mail": {"joe@example"}}},
+		{
+			Type: ChangeModify, DN: "cn=admins,dc=example",
+			Attributes: map[string][]string{"member": {"uid=joe,dc=example"}},
+			previous:   map[string][]string{"member": {"uid=john,dc=example"}},
+		},
+		{Type: ChangeAdd, DN: "uid=ann,dc=other", Attributes: map[string][]string{}},
+		{Type: ChangeDelete, DN: "uid=jane,dc=example", previous: map[string][]string{"mail": {"jane@example"}}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("changes = %+v, want %+v", got, want)
+	}
+
+	if changes := mockChanges(after, after.Clone()); len(changes) != 0 {
+		t.Errorf("changes between equal mocks = %+v, want none", changes)
+	}
+}
+
+func TestChangelog(t *testing.T) {
+	log := changelog{capacity: 3}
+	log.record([]Change{{Type: ChangeAdd, DN: "a"}, {Type: ChangeAdd, DN: "b"}}, time.Now())
+	log.record(nil, time.Now())
+	log.record([]Change{{Type: ChangeDelete, DN: "a"}, {Type: ChangeAdd, DN: "c"}}, time.Now())
+
+	changes, last := log.since(0)
+	if last != 4 {
+		t.Errorf("last = %d, want 4", last)
+	}
+
+	// The oldest change is dropped beyond the capacity.
+	var seqs []uint64
+	for _, change := range changes {
+		seqs = append(seqs, change.Seq)
+	}
+	if !reflect.DeepEqual(seqs, []uint64{2, 3, 4}) {
+		t.Errorf("seqs = %v, want [2 3 4]", seqs)
+	}
+
+	if changes, _ := log.since(3); len(changes) != 1 || changes[0].DN != "c" {
+		t.Errorf("since(3) = %+v, want the add of c", changes)
+	}
+	if changes, _ := log.since(4); len(changes) != 0 {
+		t.Errorf("since(4) = %+v, want none", changes)
+	}
+	if oldest := log.oldestSeq(); oldest != 2 {
+		t.Errorf("oldestSeq() = %d, want 2", oldest)
+	}
+	if oldest := (&changelog{}).oldestSeq(); oldest != 1 {
+		t.Errorf("oldestSeq() of an empty changelog = %d, want 1", oldest)
+	}
+}
@@ -0,0 +1,192 @@
+package ldapmock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// ChaosConfig injects failures into otherwise valid operations, to test the
+// retry, backoff and circuit breaker logic of clients.
+type ChaosConfig struct {
+	// BindFailureRatio is the share of binds, from 0 to 1, that fail
+	// whatever their credentials.
+	BindFailureRatio float64 `yaml:"bind_failure_ratio" json:"bind_failure_ratio"`
+	// BindFailureCode is the result code of the failed binds:
+	// invalidCredentials(49), the default, or unavailable(52).
+	BindFailureCode uint16 `yaml:"bind_failure_code" json:"bind_failure_code"`
+	// MaxConcurrentSearches fails searches with busy(51) while this many
+	// are already in progress; zero never does.
+	MaxConcurrentSearches int `yaml:"max_concurrent_searches" json:"max_concurrent_searches"`
+}
+
+func (c *ChaosConfig) validate() error {
+	if c.BindFailureRatio < 0 || c.BindFailureRatio > 1 {
+		return fmt.Errorf("invalid bind failure ratio %v: must be between 0 and 1", c.BindFailureRatio)
+	}
+
+	if c.MaxConcurrentSearches < 0 {
+		return fmt.Errorf("invalid max concurrent searches %d: must not be negative", c.MaxConcurrentSearches)
+	}
+
+	switch c.BindFailureCode {
+	case 0:
+		c.BindFailureCode = ldap.LDAPResultInvalidCredentials
+	case ldap.LDAPResultInvalidCredentials, ldap.LDAPResultUnavailable:
+	default:
+		return fmt.Errorf("invalid bind failure code %d: must be %d or %d",
+			c.BindFailureCode, ldap.LDAPResultInvalidCredentials, ldap.LDAPResultUnavailable)
+	}
+
+	return nil
+}
+
+// SetChaos replaces the injected failures; the zero ChaosConfig disables
+// them. It can be called while serving.
+func (s *LDAPServer) SetChaos(cfg ChaosConfig) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+
+	s.chaosMu.Lock()
+	defer s.chaosMu.Unlock()
+
+	s.chaos = cfg
+
+	return nil
+}
+
+// Chaos returns the current injected failures.
+func (s *LDAPServer) Chaos() ChaosConfig {
+	s.chaosMu.RLock()
+	defer s.chaosMu.RUnlock()
+
+	return s.chaos
+}
+
+// chaosBindError returns the error of a bind failed by an outage or picked
+// to fail, or nil.
+func (s *LDAPServer) chaosBindError() error {
+	if s.outageMode() == OutageUnavailable {
+		return errOutage
+	}
+
+	cfg := s.Chaos()
+	if cfg.BindFailureRatio <= 0 || rand.Float64() >= cfg.BindFailureRatio {
+		return nil
+	}
+
+	return ldap.NewError(cfg.BindFailureCode, errors.New("bind failed by chaos settings"))
+}
+
+// Outage modes.
+const (
+	// OutageUnavailable answers every bind and search with unavailable(52).
+	OutageUnavailable = "unavailable"
+	// OutageRefuse closes new connections as soon as they are accepted and
+	// open ones when they send their next message.
+	OutageRefuse = "refuse"
+)
+
+// Outage is a simulated directory outage, to rehearse failover to another
+// directory without stopping the server.
+type Outage struct {
+	Enabled bool   `json:"enabled"`
+	Mode    string `json:"mode,omitempty"`
+	// Until is when the outage ends by itself; nil lasts until it is
+	// switched off.
+	Until *time.Time `json:"until,omitempty"`
+}
+
+// SetOutage starts an outage in mode (OutageUnavailable when empty) that
+// lasts duration, or until it is switched off when duration is zero.
+// enabled false ends the current outage.
+func (s *LDAPServer) SetOutage(enabled bool, mode string, duration time.Duration) error {
+	if !enabled {
+		s.chaosMu.Lock()
+		defer s.chaosMu.Unlock()
+
+		s.outage = Outage{}
+
+		return nil
+	}
+
+	if mode == "" {
+		mode = OutageUnavailable
+	}
+	if mode != OutageUnavailable && mode != OutageRefuse {
+		return fmt.Errorf("invalid outage mode %q: must be %s or %s", mode, OutageUnavailable, OutageRefuse)
+	}
+	if duration < 0 {
+		return fmt.Errorf("invalid outage duration %v: must not be negative", duration)
+	}
+
+	outage := Outage{Enabled: true, Mode: mode}
+	if duration > 0 {
+		until := time.Now().Add(duration).UTC()
+		outage.Until = &until
+	}
+
+	s.chaosMu.Lock()
+	defer s.chaosMu.Unlock()
+
+	s.outage = outage
+
+	return nil
+}
+
+// Outage returns the current outage; the zero Outage when there is none.
+func (s *LDAPServer) Outage() Outage {
+	s.chaosMu.RLock()
+	defer s.chaosMu.RUnlock()
+
+	if s.outage.Until != nil && !time.Now().Before(*s.outage.Until) {
+		return Outage{}
+	}
+
+	return s.outage
+}
+
+func (s *LDAPServer) outageMode() string {
+	return s.Outage().Mode
+}
+
+// busyMiddleware fails searches with busy(51) above the concurrency limit of
+// the chaos settings. Searches it fails do not count as in progress.
+func (s *LDAPServer) busyMiddleware(next SearchFunc) SearchFunc {
+	return func(ctx context.Context, req SearchRequest) (SearchResult, error) {
+		limit := int64(s.Chaos().MaxConcurrentSearches)
+
+		for {
+			inFlight := s.inFlightSearches.Load()
+			if limit > 0 && inFlight >= limit {
+				return SearchResult{}, ldap.NewError(ldap.LDAPResultBusy,
+					fmt.Errorf("%d searches in progress, limit is %d", inFlight, limit))
+			}
+
+			if s.inFlightSearches.CompareAndSwap(inFlight, inFlight+1) {
+				break
+			}
+		}
+		defer s.inFlightSearches.Add(-1)
+
+		return next(ctx, req)
+	}
+}
+
+var errOutage = ldap.NewError(ldap.LDAPResultUnavailable, errors.New("directory outage simulated"))
+
+// outageMiddleware fails searches during an outage.
+func (s *LDAPServer) outageMiddleware(next SearchFunc) SearchFunc {
+	return func(ctx context.Context, req SearchRequest) (SearchResult, error) {
+		if s.outageMode() == OutageUnavailable {
+			return SearchResult{}, errOutage
+		}
+
+		return next(ctx, req)
+	}
+}
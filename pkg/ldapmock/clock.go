@@ -0,0 +1,109 @@
+package ldapmock
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ClockState is the time of the mock directory, as returned by GET /time.
+type ClockState struct {
+	Now time.Time `json:"now"`
+	// Frozen reports that Now only moves when it is advanced.
+	Frozen bool `json:"frozen"`
+	// Offset is how far Now is from the wall clock.
+	Offset Duration `json:"offset"`
+}
+
+// clock is the wall clock shifted by offset, or a time that only moves when
+// it is advanced while frozen.
+type clock struct {
+	mu       sync.RWMutex
+	offset   time.Duration
+	frozen   bool
+	frozenAt time.Time
+}
+
+func (c *clock) now() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.frozen {
+		return c.frozenAt
+	}
+
+	return time.Now().Add(c.offset)
+}
+
+func (c *clock) state() ClockState {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	wall := time.Now()
+	if c.frozen {
+		return ClockState{Now: c.frozenAt.UTC(), Frozen: true, Offset: Duration(c.frozenAt.Sub(wall))}
+	}
+
+	return ClockState{Now: wall.Add(c.offset).UTC(), Offset: Duration(c.offset)}
+}
+
+func (c *clock) set(at time.Time, freeze *bool, advance time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	wall := time.Now()
+	if !at.IsZero() {
+		c.offset, c.frozenAt = at.Sub(wall), at
+	}
+
+	if freeze != nil && *freeze != c.frozen {
+		if *freeze {
+			c.frozenAt = wall.Add(c.offset)
+		} else {
+			c.offset = c.frozenAt.Sub(wall)
+		}
+		c.frozen = *freeze
+	}
+
+	c.offset += advance
+	c.frozenAt = c.frozenAt.Add(advance)
+}
+
+func (c *clock) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.offset, c.frozen, c.frozenAt = 0, false, time.Time{}
+}
+
+// Now returns the time of the mock directory: the wall clock unless it was
+// moved or frozen with SetClock. User TTLs, scheduled changes, request log
+// and changelog timestamps and rule statistics follow it.
+func (s *LDAPServer) Now() time.Time {
+	return s.clock.now()
+}
+
+// Clock returns the time of the mock directory and how it is controlled.
+func (s *LDAPServer) Clock() ClockState {
+	return s.clock.state()
+}
+
+// SetClock moves the clock to at, unless at is zero, freezes or unfreezes it
+// when freeze is not nil, then advances it by advance, which must not be
+// negative. Scheduled changes that became due are applied at once.
+func (s *LDAPServer) SetClock(at time.Time, freeze *bool, advance time.Duration) error {
+	if advance < 0 {
+		return fmt.Errorf("invalid advance %v: must not be negative", advance)
+	}
+
+	s.clock.set(at, freeze, advance)
+	s.runSchedule()
+
+	return nil
+}
+
+// ResetClock returns to the wall clock.
+func (s *LDAPServer) ResetClock() {
+	s.clock.reset()
+	s.runSchedule()
+}
@@ -0,0 +1,46 @@
+package ldapmock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClock(t *testing.T) {
+	var c clock
+
+	if got := time.Since(c.now()).Abs(); got > time.Second {
+		t.Fatalf("wall clock off by %v", got)
+	}
+
+	freeze, unfreeze := true, false
+	at := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	c.set(at, &freeze, time.Hour)
+	if got := c.now(); !got.Equal(at.Add(time.Hour)) {
+		t.Errorf("frozen now = %v, want %v", got, at.Add(time.Hour))
+	}
+	if state := c.state(); !state.Frozen || !state.Now.Equal(at.Add(time.Hour)) {
+		t.Errorf("state = %+v", state)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	if got := c.now(); !got.Equal(at.Add(time.Hour)) {
+		t.Errorf("frozen clock moved to %v", got)
+	}
+
+	// Unfrozen, the clock runs on from where it stood.
+	c.set(time.Time{}, &unfreeze, 0)
+	if got := c.now().Sub(at.Add(time.Hour)); got < 0 || got > time.Second {
+		t.Errorf("unfrozen clock is %v past the frozen time", got)
+	}
+
+	c.set(time.Time{}, nil, 24*time.Hour)
+	if got := c.now().Sub(at.Add(25 * time.Hour)); got < 0 || got > time.Second {
+		t.Errorf("advanced clock is %v past the expected time", got)
+	}
+
+	c.reset()
+	if state := c.state(); state.Frozen || state.Offset != 0 {
+		t.Errorf("state after reset = %+v, want the wall clock", state)
+	}
+}
@@ -0,0 +1,130 @@
+package ldapmock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"go.uber.org/zap"
+)
+
+// errCompareTrue and errCompareFalse carry the result codes of a compare
+// that succeeded, without diagnostic message.
+var (
+	errCompareTrue  = ldap.NewError(ldap.LDAPResultCompareTrue, errors.New(""))
+	errCompareFalse = ldap.NewError(ldap.LDAPResultCompareFalse, errors.New(""))
+)
+
+// CompareRequest asks whether the entry DN has Value among the values of
+// Attr.
+type CompareRequest struct {
+	DN    string
+	Attr  string
+	Value string
+}
+
+// Compare answers req like an LDAP Compare request, from the users and groups
+// of the directory of its DN, as searches return them. Values are compared by
+// the declared attribute syntaxes; member and uniqueMember compare as DNs
+// unless declared otherwise. It fails with noSuchObject(32) when there is no
+// such entry and with noSuchAttribute(16) when the entry lacks the attribute.
+func (s *LDAPServer) Compare(ctx context.Context, req CompareRequest) (bool, error) {
+	rdns, err := parseEntryDN(req.DN)
+	if err != nil {
+		return false, err
+	}
+
+	mock, compiled, activated := s.currentMock(ctx)
+	entries := compiled.forBase(mock, req.DN).entries
+	if isGlobalCatalog(ctx) {
+		entries = compiled.global()
+	}
+
+	var found SearchResult
+	for _, user := range liveUsers(entries.users, activated, s.clock.now()) {
+		if sameDN(user.CN, rdns) {
+			found.Users = append(found.Users, user)
+		}
+	}
+	for _, group := range entries.groups {
+		if sameDN(group.CN, rdns) {
+			found.Groups = append(found.Groups, group)
+		}
+	}
+
+	if found.Users, found.Groups, err = computeEntries(compiled.computed, found.Users, found.Groups); err != nil {
+		return false, ldap.NewError(ldap.LDAPResultOther, err)
+	}
+
+	for entry := range found.entries() {
+		values, ok := attributeValues(entry.Attrs, req.Attr)
+		if !ok {
+			return false, ldap.NewError(ldap.LDAPResultNoSuchAttribute, fmt.Errorf("entry %s has no attribute %s", req.DN, req.Attr))
+		}
+
+		attr := strings.ToLower(req.Attr)
+		syntaxes := mock.Attributes.lower()
+		_, declared := syntaxes[attr]
+		byDN := !declared && slices.Contains(memberAttributes, attr)
+
+		return slices.ContainsFunc(values, func(value string) bool {
+			if byDN {
+				return dnMatch(value, req.Value)
+			}
+
+			return syntaxes.equal(attr, value, req.Value)
+		}), nil
+	}
+
+	return false, ldap.NewError(ldap.LDAPResultNoSuchObject, fmt.Errorf("no such entry %s", req.DN))
+}
+
+// attributeValues returns the values of attr in attrs, its name matched
+// case-insensitively.
+func attributeValues(attrs map[string][]string, attr string) ([]string, bool) {
+	for name, values := range attrs {
+		if strings.EqualFold(name, attr) {
+			return values, true
+		}
+	}
+
+	return nil, false
+}
+
+// serveCompare handles compare requests (see Compare), answering
+// compareTrue(6) or compareFalse(5).
+func (s *LDAPServer) serveCompare(ctx context.Context, p *ber.Packet, w responseWriter) bool {
+	msgID, req, err := parseCompareRequest(p)
+	if errors.Is(err, errNotThisOperation) {
+		return false
+	}
+
+	if err != nil {
+		err = ldap.NewError(ldap.LDAPResultProtocolError, err)
+	} else {
+		ctx = s.withMockSnapshot(ctx)
+
+		var equal bool
+		if equal, err = s.Compare(ctx, req); err == nil {
+			err = errCompareFalse
+			if equal {
+				err = errCompareTrue
+			}
+		}
+	}
+
+	s.logger(ctx).Info("compare", zap.String("dn", req.DN), zap.String("attribute", req.Attr),
+		zap.String("result", ldap.LDAPResultCodeMap[resultCode(err)]))
+
+	requestLog := s.newRequestLog(ctx, "compare", err)
+	requestLog.BaseDN = req.DN
+	s.logRequest(requestLog)
+
+	_ = w(newResultPacket(msgID, ldap.ApplicationCompareResponse, err), 0)
+
+	return true
+}
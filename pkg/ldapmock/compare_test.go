@@ -0,0 +1,60 @@
+package ldapmock
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+	"go.uber.org/zap"
+)
+
+func TestLDAPServer_Compare(t *testing.T) {
+	srv := NewLDAPServer(zap.NewNop(), "0", "", "", nil)
+	srv.SetMock(LDAPMock{
+		Users: []User{{CN: "uid=john,dc=example", Attrs: map[string]string{"uid": "john", "employeeNumber": "0042"}}},
+		Groups: []Group{{
+			CN:      "cn=admins,dc=example",
+			Members: []string{"uid=john,dc=example"},
+		}},
+		Attributes: AttributeSyntaxes{"employeeNumber": SyntaxInteger},
+		Tenants: []Tenant{{
+			BaseDN: "dc=acme",
+			Users:  []User{{CN: "uid=joe,dc=acme", Attrs: map[string]string{"uid": "joe"}}},
+		}},
+	})
+
+	tests := []struct {
+		name string
+		req  CompareRequest
+		want bool
+		code uint16
+	}{
+		{"equal", CompareRequest{DN: "uid=john,dc=example", Attr: "uid", Value: "John"}, true, 0},
+		{"not equal", CompareRequest{DN: "uid=john,dc=example", Attr: "uid", Value: "jane"}, false, 0},
+		{"syntax", CompareRequest{DN: "uid=john,dc=example", Attr: "employeeNumber", Value: "42"}, true, 0},
+		{"member as DN", CompareRequest{DN: "CN=Admins, DC=Example", Attr: "member", Value: "UID=John, DC=Example"}, true, 0},
+		{"not a member", CompareRequest{DN: "cn=admins,dc=example", Attr: "member", Value: "uid=jane,dc=example"}, false, 0},
+		{"tenant", CompareRequest{DN: "uid=joe,dc=acme", Attr: "UID", Value: "joe"}, true, 0},
+		{"no attribute", CompareRequest{DN: "uid=john,dc=example", Attr: "mail", Value: "john@example.com"}, false, ldap.LDAPResultNoSuchAttribute},
+		{"no entry", CompareRequest{DN: "uid=jane,dc=example", Attr: "uid", Value: "jane"}, false, ldap.LDAPResultNoSuchObject},
+		{"invalid DN", CompareRequest{Attr: "uid", Value: "jane"}, false, ldap.LDAPResultInvalidDNSyntax},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := srv.Compare(context.Background(), tt.req)
+			if tt.code == 0 {
+				if err != nil || got != tt.want {
+					t.Errorf("compare = %v, %v, want %v", got, err, tt.want)
+				}
+				return
+			}
+
+			var ldapErr *ldap.Error
+			if !errors.As(err, &ldapErr) || ldapErr.ResultCode != tt.code {
+				t.Errorf("compare err = %v, want result code %d", err, tt.code)
+			}
+		})
+	}
+}
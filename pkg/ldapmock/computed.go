@@ -0,0 +1,127 @@
+package ldapmock
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"text/template"
+)
+
+// computedAttribute is an attribute of LDAPMock.Computed with its template
+// parsed; err is why it did not parse.
+type computedAttribute struct {
+	name string
+	tmpl *template.Template
+	err  error
+}
+
+// compileComputed parses the templates of computed, ordered by attribute
+// name.
+func compileComputed(computed map[string]string) []computedAttribute {
+	attributes := make([]computedAttribute, 0, len(computed))
+	for _, name := range slices.Sorted(maps.Keys(computed)) {
+		tmpl, err := parseComputed(computed[name])
+		attributes = append(attributes, computedAttribute{name: name, tmpl: tmpl, err: err})
+	}
+
+	return attributes
+}
+
+func parseComputed(text string) (*template.Template, error) {
+	return template.New("").Funcs(templateFuncs).Option("missingkey=zero").Parse(text)
+}
+
+// computedData returns what the computed attributes of an entry are executed
+// with: its attributes by declared and lowercased name, and its DN as dn.
+func computedData(dn string, attrs map[string]string) map[string]string {
+	data := make(map[string]string, 2*len(attrs)+1)
+	for name, value := range attrs {
+		data[strings.ToLower(name)] = value
+	}
+	maps.Copy(data, attrs)
+	data["dn"] = dn
+
+	return data
+}
+
+// withComputed returns attrs with the computed attributes it does not
+// declare, ignoring case. Computed values only see declared attributes, and
+// empty ones are left out. attrs is returned as is when nothing is added.
+func withComputed(computed []computedAttribute, dn string, attrs map[string]string) (map[string]string, error) {
+	var (
+		data   map[string]string
+		result = attrs
+		copied bool
+	)
+
+	for _, attr := range computed {
+		if attr.err != nil {
+			return nil, fmt.Errorf("computed attribute %s: %w", attr.name, attr.err)
+		}
+
+		if hasAttribute(attrs, attr.name) {
+			continue
+		}
+
+		if data == nil {
+			data = computedData(dn, attrs)
+		}
+
+		var b strings.Builder
+		if err := attr.tmpl.Execute(&b, data); err != nil {
+			return nil, fmt.Errorf("computed attribute %s of %s: %w", attr.name, dn, err)
+		}
+		if b.Len() == 0 {
+			continue
+		}
+
+		if !copied {
+			result = make(map[string]string, len(attrs)+len(computed))
+			maps.Copy(result, attrs)
+			copied = true
+		}
+		result[attr.name] = b.String()
+	}
+
+	return result, nil
+}
+
+// hasAttribute reports whether attrs declares name, ignoring case.
+func hasAttribute(attrs map[string]string, name string) bool {
+	for declared := range attrs {
+		if strings.EqualFold(declared, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// computeEntries returns users and groups with their computed attributes.
+// The entries are copied when computed adds attributes to them.
+func computeEntries(computed []computedAttribute, users []User, groups []Group) ([]User, []Group, error) {
+	if len(computed) == 0 {
+		return users, groups, nil
+	}
+
+	computedUsers := slices.Clone(users)
+	for i := range computedUsers {
+		attrs, err := withComputed(computed, computedUsers[i].CN, computedUsers[i].Attrs)
+		if err != nil {
+			return nil, nil, err
+		}
+		computedUsers[i].Attrs = attrs
+	}
+
+	computedGroups := slices.Clone(groups)
+	for i := range computedGroups {
+		attrs, err := withComputed(computed, computedGroups[i].CN, computedGroups[i].Attrs)
+		if err != nil {
+			return nil, nil, err
+		}
+		computedGroups[i].Attrs = attrs
+	}
+
+	return computedUsers, computedGroups, nil
+}
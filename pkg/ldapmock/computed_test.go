@@ -0,0 +1,74 @@
+package ldapmock
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+	"go.uber.org/zap"
+)
+
+func TestLDAPServer_OnSearch_Computed(t *testing.T) {
+	john := User{CN: "uid=john,dc=example", Attrs: map[string]string{"uid": "john", "givenName": "John", "sn": "Doe"}}
+	jane := User{CN: "uid=jane,dc=example", Attrs: map[string]string{"UID": "jane", "displayName": "Jane"}}
+
+	srv := NewLDAPServer(zap.NewNop(), "0", "", "", nil)
+	srv.SetMock(LDAPMock{
+		Users: []User{john, jane},
+		Rules: []Rule{{ID: "john", Filter: "(cn=john)", Response: Response{Users: []User{john}}}},
+		Computed: map[string]string{
+			"displayName": "{{ .givenName }} {{ .sn }}",
+			"initials":    "{{ initials .givenName .sn }}",
+			"mail":        "{{ .uid }}@example.com",
+		},
+	})
+
+	tests := []struct {
+		name string
+		req  SearchRequest
+		want []map[string]string
+	}{
+		{
+			name: "rule response",
+			req:  SearchRequest{Filter: "(cn=john)", Scope: ScopeSub},
+			want: []map[string]string{
+				{"uid": "john", "givenName": "John", "sn": "Doe", "displayName": "John Doe", "initials": "JD", "mail": "john@example.com"},
+			},
+		},
+		{
+			name: "fallback entries keep declared values",
+			req:  SearchRequest{Filter: "(objectClass=*)", Scope: ScopeSub, Attributes: []string{"displayName", "initials", "mail"}},
+			want: []map[string]string{
+				{"displayName": "John Doe", "initials": "JD", "mail": "john@example.com"},
+				{"displayName": "Jane", "mail": "jane@example.com"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := srv.OnSearch(context.Background(), tt.req)
+			if err != nil {
+				t.Fatalf("search: %v", err)
+			}
+
+			var got []map[string]string
+			for _, user := range result.Users {
+				got = append(got, user.Attrs)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("attributes = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if mock := srv.GetMock(); len(mock.Users[0].Attrs) != 3 {
+		t.Errorf("mock user = %+v, want it unchanged", mock.Users[0])
+	}
+
+	srv.SetMock(LDAPMock{Users: []User{john}, Computed: map[string]string{"mail": "{{ .uid"}})
+	if _, err := srv.OnSearch(context.Background(), SearchRequest{Filter: "(uid=john)", Scope: ScopeSub}); !ldap.IsErrorWithCode(err, ldap.LDAPResultOther) {
+		t.Errorf("error = %v, want other for an invalid template", err)
+	}
+}
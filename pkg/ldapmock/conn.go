@@ -0,0 +1,433 @@
+package ldapmock
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// connIdleTimeout closes client connections that send nothing for this long.
+const connIdleTimeout = time.Minute
+
+// DefaultDrainTimeout is how long Serve waits for in-flight operations on
+// shutdown unless SetDrainTimeout says otherwise.
+const DefaultDrainTimeout = 10 * time.Second
+
+// ConnInfo describes the client connection a request arrived on.
+type ConnInfo struct {
+	RemoteAddr net.Addr
+	LocalAddr  net.Addr
+	// GlobalCatalog is set on connections to a global catalog listener (see
+	// ServeGlobalCatalog).
+	GlobalCatalog bool
+}
+
+// AddressFamily returns "ipv4" or "ipv6" for TCP connections and the network
+// name (e.g. "unix") otherwise.
+func (c ConnInfo) AddressFamily() string {
+	addr := c.RemoteAddr
+	if addr == nil {
+		addr = c.LocalAddr
+	}
+	if addr == nil {
+		return ""
+	}
+
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return addr.Network()
+	}
+
+	if tcpAddr.IP.To4() != nil {
+		return "ipv4"
+	}
+
+	return "ipv6"
+}
+
+type connInfoKey struct{}
+
+// ConnInfoFromContext returns the connection of the request being handled.
+func ConnInfoFromContext(ctx context.Context) (ConnInfo, bool) {
+	info, ok := ctx.Value(connInfoKey{}).(ConnInfo)
+
+	return info, ok
+}
+
+func withConnInfo(ctx context.Context, info ConnInfo) context.Context {
+	return context.WithValue(ctx, connInfoKey{}, info)
+}
+
+// SetDrainTimeout sets how long Serve waits on shutdown for the operations
+// in progress to finish before it closes their connections; zero closes
+// them at once. It can be called while serving.
+func (s *LDAPServer) SetDrainTimeout(timeout time.Duration) {
+	s.drainTimeout.Store(int64(max(timeout, 0)))
+}
+
+// DrainTimeout returns how long Serve waits for in-flight operations on
+// shutdown.
+func (s *LDAPServer) DrainTimeout() time.Duration {
+	return time.Duration(s.drainTimeout.Load())
+}
+
+// connSet tracks the connections of a listener so that Serve can drain them:
+// idle ones are closed at once, busy ones once their operation is done.
+type connSet struct {
+	mu       sync.Mutex
+	conns    map[net.Conn]*trackedConn
+	draining bool
+	wg       sync.WaitGroup
+}
+
+type trackedConn struct {
+	busy   bool
+	cancel context.CancelFunc
+}
+
+func newConnSet() *connSet {
+	return &connSet{conns: make(map[net.Conn]*trackedConn)}
+}
+
+// add tracks conn, whose operations are canceled with cancel. It returns
+// false once draining has started.
+func (c *connSet) add(conn net.Conn, cancel context.CancelFunc) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.draining {
+		return false
+	}
+
+	c.conns[conn] = &trackedConn{cancel: cancel}
+	c.wg.Add(1)
+
+	return true
+}
+
+func (c *connSet) remove(conn net.Conn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.conns[conn]; ok {
+		delete(c.conns, conn)
+		c.wg.Done()
+	}
+}
+
+// setBusy marks an operation on conn as started or done. It returns false
+// once draining has started, when conn is to be closed instead.
+func (c *connSet) setBusy(conn net.Conn, busy bool) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if tracked, ok := c.conns[conn]; ok {
+		tracked.busy = busy
+	}
+
+	return !c.draining
+}
+
+// drain stops tracking new connections, closes the idle ones and returns the
+// number of operations still in progress.
+func (c *connSet) drain() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.draining = true
+
+	busy := 0
+	for conn, tracked := range c.conns {
+		if tracked.busy {
+			busy++
+			continue
+		}
+
+		_ = conn.Close()
+	}
+
+	return busy
+}
+
+// closeAll cancels the operations in progress and closes their connections.
+func (c *connSet) closeAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for conn, tracked := range c.conns {
+		tracked.cancel()
+		_ = conn.Close()
+	}
+}
+
+// drainConns waits up to the drain timeout for the operations in progress on
+// conns, then closes the connections left.
+func (s *LDAPServer) drainConns(conns *connSet) {
+	busy := conns.drain()
+	if busy == 0 {
+		return
+	}
+
+	timeout := s.DrainTimeout()
+	s.log.Info("draining in-flight operations", zap.Int("operations", busy), zap.Duration("timeout", timeout))
+
+	done := make(chan struct{})
+	go func() {
+		conns.wg.Wait()
+		close(done)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+	case <-timer.C:
+		s.log.Warn("drain timeout, closing connections")
+		conns.closeAll()
+	}
+}
+
+func (s *LDAPServer) acceptLoop(lis net.Listener, conns *connSet, globalCatalog bool) error {
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			return err
+		}
+
+		if s.outageMode() == OutageRefuse {
+			_ = conn.Close()
+			continue
+		}
+
+		go s.serveConn(conn, conns, globalCatalog)
+	}
+}
+
+func (s *LDAPServer) serveConn(conn net.Conn, conns *connSet, globalCatalog bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.log.Error("panic while serving connection", zap.Any("panic", r), zap.Stringer("remote", conn.RemoteAddr()))
+		}
+	}()
+	defer func() { _ = conn.Close() }()
+
+	info := ConnInfo{
+		RemoteAddr:    conn.RemoteAddr(),
+		LocalAddr:     conn.LocalAddr(),
+		GlobalCatalog: globalCatalog,
+	}
+	ctx, cancel := context.WithCancel(withConnInfo(context.Background(), info))
+	defer cancel()
+
+	if !conns.add(conn, cancel) {
+		return
+	}
+	defer conns.remove(conn)
+
+	capture := s.newCaptureSession(info)
+	defer capture.close()
+
+	ops := &connOps{cancels: make(map[int64]context.CancelFunc)}
+	ctx = context.WithValue(ctx, connOpsKey{}, ops)
+
+	// raw keeps the bytes of the message being read, as sent by the client.
+	var raw bytes.Buffer
+	reader := io.TeeReader(conn, &raw)
+
+	// writeMu orders the responses of background operations with the others,
+	// and guards capture.
+	var writeMu sync.Mutex
+
+	for {
+		// Clients wait quietly for the results of background operations.
+		deadline := time.Now().Add(connIdleTimeout)
+		if ops.active() {
+			deadline = time.Time{}
+		}
+		_ = conn.SetReadDeadline(deadline)
+
+		raw.Reset()
+		p, err := ber.ReadPacket(reader)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				s.log.Debug("read packet", zap.Error(err))
+			}
+
+			return
+		}
+
+		writeMu.Lock()
+		capture.record(captureIn, raw.Bytes())
+		writeMu.Unlock()
+
+		if s.outageMode() == OutageRefuse || !conns.setBusy(conn, true) {
+			return
+		}
+
+		var writeErr error
+		write := func(packet *ber.Packet, bandwidth ByteRate) error {
+			writeMu.Lock()
+			defer writeMu.Unlock()
+
+			if writeErr != nil {
+				return writeErr
+			}
+
+			data := packet.Bytes()
+			if writeErr = writeThrottled(conn, data, bandwidth); writeErr != nil {
+				return writeErr
+			}
+
+			capture.record(captureOut, data)
+
+			return nil
+		}
+
+		if !s.handlePacket(ctx, p, write) {
+			if !isUnbindRequest(p) {
+				s.log.Debug("unhandled packet, closing connection")
+			}
+
+			return
+		}
+
+		writeMu.Lock()
+		err = writeErr
+		writeMu.Unlock()
+
+		if err != nil {
+			s.log.Debug("write packet", zap.Error(err))
+			return
+		}
+
+		if !conns.setBusy(conn, false) {
+			return
+		}
+	}
+}
+
+// handlePacket hands p to the first handler that takes it, with a new request
+// ID in ctx (see RequestIDFromContext).
+func (s *LDAPServer) handlePacket(ctx context.Context, p *ber.Packet, w responseWriter) bool {
+	ctx = withRequestID(ctx, uuid.NewString())
+
+	for _, h := range s.handlers {
+		if h(ctx, p, w) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// writeThrottled writes data at about bandwidth bytes per second, a tenth of
+// a second's worth at a time, or at once when bandwidth is zero.
+func writeThrottled(conn net.Conn, data []byte, bandwidth ByteRate) error {
+	if bandwidth <= 0 {
+		_, err := conn.Write(data)
+		return err
+	}
+
+	chunk := max(int(bandwidth)/10, 1)
+	start := time.Now()
+	for written := 0; written < len(data); {
+		n, err := conn.Write(data[written:min(written+chunk, len(data))])
+		if err != nil {
+			return err
+		}
+		written += n
+
+		time.Sleep(time.Until(start.Add(time.Duration(written) * time.Second / time.Duration(bandwidth))))
+	}
+
+	return nil
+}
+
+// connOps tracks the operations of a connection that go on in the
+// background after their request was handled, like persistent searches, by
+// message ID.
+type connOps struct {
+	mu      sync.Mutex
+	cancels map[int64]context.CancelFunc
+}
+
+type connOpsKey struct{}
+
+func (o *connOps) active() bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return len(o.cancels) > 0
+}
+
+// goBackground runs op in the background for the request msgID, until it
+// returns, the connection is closed or the request is abandoned. op may keep
+// writing responses with the responseWriter of the request.
+func goBackground(ctx context.Context, msgID int64, op func(ctx context.Context)) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	ops, ok := ctx.Value(connOpsKey{}).(*connOps)
+	if ok {
+		ops.mu.Lock()
+		ops.cancels[msgID] = cancel
+		ops.mu.Unlock()
+	}
+
+	go func() {
+		defer cancel()
+
+		if ok {
+			defer func() {
+				ops.mu.Lock()
+				delete(ops.cancels, msgID)
+				ops.mu.Unlock()
+			}()
+		}
+
+		op(ctx)
+	}()
+}
+
+// serveAbandon stops the background operation of the abandoned request, if
+// any. Abandon requests have no response.
+func (s *LDAPServer) serveAbandon(ctx context.Context, p *ber.Packet, _ responseWriter) bool {
+	_, op, err := operation(p, ldap.ApplicationAbandonRequest)
+	if err != nil {
+		return false
+	}
+
+	abandoned, err := ber.ParseInt64(op.Data.Bytes())
+	if err != nil {
+		s.logger(ctx).Debug("invalid abandon request", zap.Error(err))
+		return true
+	}
+
+	if ops, ok := ctx.Value(connOpsKey{}).(*connOps); ok {
+		ops.mu.Lock()
+		cancel := ops.cancels[abandoned]
+		ops.mu.Unlock()
+
+		if cancel != nil {
+			s.logger(ctx).Info("operation abandoned", zap.Int64("message_id", abandoned))
+			cancel()
+		}
+	}
+
+	return true
+}
+
+func isUnbindRequest(p *ber.Packet) bool {
+	_, _, err := operation(p, ldap.ApplicationUnbindRequest)
+
+	return err == nil
+}
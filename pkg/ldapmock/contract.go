@@ -0,0 +1,151 @@
+package ldapmock
+
+import (
+	"slices"
+	"strings"
+)
+
+// ContractFormat identifies the documents returned by GET /contracts.
+const ContractFormat = "ldap-mock-contract"
+
+// Contract is a portable, Pact-like description of the LDAP interactions a
+// consumer relies on: the expectations it registered and the request and
+// response pairs observed on the LDAP port. A provider can replay it against
+// a real directory to verify the integration.
+type Contract struct {
+	Consumer     ContractParty         `json:"consumer"`
+	Provider     ContractParty         `json:"provider"`
+	Interactions []ContractInteraction `json:"interactions"`
+	Metadata     ContractMetadata      `json:"metadata"`
+}
+
+type ContractParty struct {
+	Name string `json:"name"`
+}
+
+type ContractMetadata struct {
+	Format    string `json:"format"`
+	Version   int    `json:"version"`
+	Generator string `json:"generator"`
+}
+
+// Contract interaction sources.
+const (
+	ContractSourceExpectation = "expectation"
+	ContractSourceObserved    = "observed"
+)
+
+type ContractInteraction struct {
+	Description string `json:"description"`
+	// Source is ContractSourceExpectation or ContractSourceObserved.
+	Source   string           `json:"source"`
+	Request  ContractRequest  `json:"request"`
+	Response ContractResponse `json:"response"`
+	// Count is how many times an observed interaction happened.
+	Count int `json:"count,omitempty"`
+}
+
+type ContractRequest struct {
+	Type       string   `json:"type"`
+	BindDN     string   `json:"bind_dn,omitempty"`
+	BaseDN     string   `json:"base_dn,omitempty"`
+	Scope      string   `json:"scope,omitempty"`
+	Filter     string   `json:"filter,omitempty"`
+	Attributes []string `json:"attributes,omitempty"`
+}
+
+type ContractResponse struct {
+	Result  string   `json:"result"`
+	Entries []string `json:"entries"`
+}
+
+// BuildContract converts expectations and the request log, newest first as
+// returned by RequestLogger.List, to a contract between consumer and
+// provider. Identical observed interactions are listed once, oldest first,
+// with their count.
+func BuildContract(consumer, provider string, expectations []ExpectationStatus, logs []LDAPRequestLog) Contract {
+	contract := Contract{
+		Consumer:     ContractParty{Name: consumer},
+		Provider:     ContractParty{Name: provider},
+		Interactions: []ContractInteraction{},
+		Metadata:     ContractMetadata{Format: ContractFormat, Version: 1, Generator: "ldap-mock " + GetBuildInfo().Version},
+	}
+
+	for _, e := range expectations {
+		rule := e.Rule
+
+		description := "expectation " + rule.ID
+		if rule.Name != "" {
+			description = rule.Name
+		}
+
+		req := ContractRequest{Type: "search", BaseDN: rule.BaseDN, Filter: rule.Filter}
+		if rule.Scope != "" {
+			req.Scope = ParseScope(rule.Scope).String()
+		}
+
+		contract.Interactions = append(contract.Interactions, ContractInteraction{
+			Description: description,
+			Source:      ContractSourceExpectation,
+			Request:     req,
+			Response:    ContractResponse{Result: "Success", Entries: returnedDNs(rule.Response.Users, rule.Response.Groups)},
+		})
+	}
+
+	observed := make(map[string]int)
+	for _, entry := range slices.Backward(logs) {
+		interaction := ContractInteraction{
+			Source: ContractSourceObserved,
+			Request: ContractRequest{
+				Type:       entry.Type,
+				BindDN:     entry.BindDN,
+				BaseDN:     entry.BaseDN,
+				Scope:      entry.Scope,
+				Filter:     entry.Filter,
+				Attributes: entry.Attributes,
+			},
+			Response: ContractResponse{Result: entry.Result, Entries: entry.Response.ReturnedDNs},
+			Count:    1,
+		}
+		if interaction.Request.Type != "bind" {
+			interaction.Request.BindDN = ""
+		}
+		if interaction.Response.Entries == nil {
+			interaction.Response.Entries = []string{}
+		}
+		interaction.Description = describeInteraction(interaction.Request)
+
+		key := interactionKey(interaction)
+		if i, ok := observed[key]; ok {
+			contract.Interactions[i].Count++
+			continue
+		}
+
+		observed[key] = len(contract.Interactions)
+		contract.Interactions = append(contract.Interactions, interaction)
+	}
+
+	return contract
+}
+
+func describeInteraction(req ContractRequest) string {
+	switch {
+	case req.Type == "bind":
+		return "bind as " + req.BindDN
+	case req.Filter != "":
+		description := req.Type + " " + req.Filter
+		if req.BaseDN != "" {
+			description += " under " + req.BaseDN
+		}
+		return description
+	default:
+		return req.Type + " " + req.BaseDN
+	}
+}
+
+func interactionKey(i ContractInteraction) string {
+	return strings.Join([]string{
+		i.Request.Type, i.Request.BindDN, i.Request.BaseDN, i.Request.Scope, i.Request.Filter,
+		strings.Join(i.Request.Attributes, ","), i.Response.Result, strings.Join(i.Response.Entries, "\x00"),
+	}, "\x01")
+}
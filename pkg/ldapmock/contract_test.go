@@ -0,0 +1,55 @@
+package ldapmock
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuildContract(t *testing.T) {
+	expectations := []ExpectationStatus{{
+		Rule: Rule{ID: "expect-1", Name: "bob lookup", Filter: "(uid=bob)", Scope: "SUB",
+			Response: Response{Users: []User{{CN: "uid=bob,dc=example"}}}},
+		Times: 1,
+	}}
+
+	// Newest first, as returned by RequestLogger.List.
+	logs := []LDAPRequestLog{
+		{Type: "search", BindDN: "cn=app", BaseDN: "dc=example", Scope: "sub", Filter: "(uid=bob)", Result: "Success",
+			Response: LDAPResponseLog{ReturnedDNs: []string{"uid=bob,dc=example"}, Count: 1}},
+		{Type: "search", BindDN: "cn=app", BaseDN: "dc=example", Scope: "sub", Filter: "(uid=bob)", Result: "Success",
+			Response: LDAPResponseLog{ReturnedDNs: []string{"uid=bob,dc=example"}, Count: 1}},
+		{Type: "bind", BindDN: "cn=app", Result: "Success"},
+	}
+
+	contract := BuildContract("billing", "corp-ad", expectations, logs)
+
+	if contract.Consumer.Name != "billing" || contract.Provider.Name != "corp-ad" || contract.Metadata.Format != ContractFormat {
+		t.Errorf("header = %+v %+v %+v", contract.Consumer, contract.Provider, contract.Metadata)
+	}
+
+	want := []ContractInteraction{
+		{
+			Description: "bob lookup",
+			Source:      ContractSourceExpectation,
+			Request:     ContractRequest{Type: "search", Scope: "sub", Filter: "(uid=bob)"},
+			Response:    ContractResponse{Result: "Success", Entries: []string{"uid=bob,dc=example"}},
+		},
+		{
+			Description: "bind as cn=app",
+			Source:      ContractSourceObserved,
+			Request:     ContractRequest{Type: "bind", BindDN: "cn=app"},
+			Response:    ContractResponse{Result: "Success", Entries: []string{}},
+			Count:       1,
+		},
+		{
+			Description: "search (uid=bob) under dc=example",
+			Source:      ContractSourceObserved,
+			Request:     ContractRequest{Type: "search", BaseDN: "dc=example", Scope: "sub", Filter: "(uid=bob)"},
+			Response:    ContractResponse{Result: "Success", Entries: []string{"uid=bob,dc=example"}},
+			Count:       2,
+		},
+	}
+	if !reflect.DeepEqual(contract.Interactions, want) {
+		t.Errorf("interactions = %+v, want %+v", contract.Interactions, want)
+	}
+}
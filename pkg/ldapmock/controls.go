@@ -0,0 +1,148 @@
+package ldapmock
+
+import (
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// RequestControl is a control a client attached to a request.
+type RequestControl struct {
+	OID         string `json:"oid"`
+	Name        string `json:"name,omitempty"`
+	Criticality bool   `json:"criticality,omitempty"`
+	// Value is a PagingValue for paged results controls, a []SortKeyValue
+	// for server side sorting controls, a SyncRequestValue for content
+	// synchronization controls and a DirSyncValue for DirSync controls. The
+	// value of other controls, or of ones that do not decode, is the raw
+	// []byte (base64 in JSON); controls without a value, like the password
+	// policy request control, have none.
+	Value any `json:"value,omitempty"`
+}
+
+// PagingValue is the value of a paged results control (RFC 2696).
+type PagingValue struct {
+	Size   int64  `json:"size"`
+	Cookie []byte `json:"cookie,omitempty"`
+}
+
+// SortKeyValue is one key of a server side sorting control (RFC 2891).
+type SortKeyValue struct {
+	Attribute    string `json:"attribute"`
+	OrderingRule string `json:"ordering_rule,omitempty"`
+	Reverse      bool   `json:"reverse,omitempty"`
+}
+
+// parseControls returns the controls of the LDAP message p. Malformed
+// controls are skipped: controls only ever inform the request log.
+func parseControls(p *ber.Packet) []RequestControl {
+	if len(p.Children) < 3 {
+		return nil
+	}
+
+	packet := p.Children[2]
+	if packet.ClassType != ber.ClassContext || packet.Tag != 0 {
+		return nil
+	}
+
+	var controls []RequestControl
+	for _, child := range packet.Children {
+		if len(child.Children) == 0 {
+			continue
+		}
+
+		oid, ok := child.Children[0].Value.(string)
+		if !ok {
+			continue
+		}
+
+		control := RequestControl{OID: oid, Name: ldap.ControlTypeMap[oid]}
+		for _, field := range child.Children[1:] {
+			switch field.Tag {
+			case ber.TagBoolean:
+				control.Criticality, _ = field.Value.(bool)
+			case ber.TagOctetString:
+				control.Value = decodeControlValue(oid, field.Data.Bytes())
+			}
+		}
+
+		controls = append(controls, control)
+	}
+
+	return controls
+}
+
+// decodeControlValue decodes the value of the controls RequestControl
+// documents, falling back to the raw value.
+func decodeControlValue(oid string, raw []byte) any {
+	value, err := ber.DecodePacketErr(raw)
+	if err != nil {
+		return raw
+	}
+
+	switch oid {
+	case ldap.ControlTypePaging:
+		if len(value.Children) != 2 {
+			return raw
+		}
+
+		size, ok := value.Children[0].Value.(int64)
+		if !ok {
+			return raw
+		}
+
+		return PagingValue{Size: size, Cookie: value.Children[1].Data.Bytes()}
+	case ldap.ControlTypeServerSideSorting:
+		keys := make([]SortKeyValue, 0, len(value.Children))
+		for _, child := range value.Children {
+			if len(child.Children) == 0 {
+				return raw
+			}
+
+			key := SortKeyValue{Attribute: child.Children[0].Data.String()}
+			for _, field := range child.Children[1:] {
+				switch field.Tag {
+				case 0:
+					key.OrderingRule = field.Data.String()
+				case 1:
+					key.Reverse = len(field.Data.Bytes()) > 0 && field.Data.Bytes()[0] != 0
+				}
+			}
+
+			keys = append(keys, key)
+		}
+
+		return keys
+	case ldap.ControlTypeSyncRequest:
+		if len(value.Children) == 0 {
+			return raw
+		}
+
+		mode, ok := value.Children[0].Value.(int64)
+		if !ok {
+			return raw
+		}
+
+		sync := SyncRequestValue{Mode: mode}
+		for _, field := range value.Children[1:] {
+			switch field.Tag {
+			case ber.TagOctetString:
+				sync.Cookie = field.Data.Bytes()
+			case ber.TagBoolean:
+				sync.ReloadHint, _ = field.Value.(bool)
+			}
+		}
+
+		return sync
+	case ldap.ControlTypeDirSync:
+		if len(value.Children) != 3 {
+			return raw
+		}
+
+		flags, _ := value.Children[0].Value.(int64)
+		maxAttrCount, _ := value.Children[1].Value.(int64)
+
+		return DirSyncValue{Flags: flags, MaxAttrCount: maxAttrCount, Cookie: value.Children[2].Data.Bytes()}
+	default:
+		return raw
+	}
+}
@@ -0,0 +1,158 @@
+package ldapmock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"go.uber.org/zap"
+)
+
+// DebugRuleAttribute is the attribute added to the entries of matched
+// searches when DebugConfig.RuleAttribute is set.
+const DebugRuleAttribute = "x-mock-rule"
+
+// ControlTypeDiagnostic is the OID of the DiagnosticControl returned when
+// DebugConfig.ResponseControl is set. It is derived from a UUID (2.25 arc,
+// ITU-T X.667), so it needs no registration.
+const ControlTypeDiagnostic = "2.25.172673400912560474905428138537879024289"
+
+// DebugConfig adds mock internals to search responses, to tell in a client
+// where results come from.
+type DebugConfig struct {
+	// RuleAttribute adds a DebugRuleAttribute attribute to every entry
+	// returned for a matched rule, with the rule name (or ID, or filter).
+	// The entries of searches no rule matches get none.
+	RuleAttribute bool `json:"rule_attribute"`
+	// ResponseControl adds a DiagnosticControl to every search result done
+	// and bind response message, which leaves the entries as they are.
+	ResponseControl bool `json:"response_control"`
+}
+
+// DiagnosticControl is a response control that ties a response to the mock
+// internals: the request ID of its /requests entry and, for searches, the
+// rule that answered it, empty when no rule matched. Its value is the BER
+// encoding of
+//
+//	DiagnosticValue ::= SEQUENCE {
+//		requestID OCTET STRING,
+//		ruleID    OCTET STRING,
+//		ruleName  OCTET STRING }
+type DiagnosticControl struct {
+	RequestID string
+	RuleID    string
+	RuleName  string
+}
+
+// Encode returns the control as sent in search result done messages.
+func (c DiagnosticControl) Encode() *ber.Packet {
+	value := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Diagnostic Value")
+	value.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, c.RequestID, "Request ID"))
+	value.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, c.RuleID, "Rule ID"))
+	value.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, c.RuleName, "Rule Name"))
+
+	return ldap.NewControlString(ControlTypeDiagnostic, false, string(value.Bytes())).Encode()
+}
+
+// DecodeDiagnosticControl decodes the value of a diagnostic control, as
+// found in the ControlValue of the *ldap.ControlString a client returns for
+// it.
+func DecodeDiagnosticControl(value []byte) (DiagnosticControl, error) {
+	p, err := ber.DecodePacketErr(value)
+	if err != nil {
+		return DiagnosticControl{}, fmt.Errorf("decode diagnostic control: %w", err)
+	}
+	if len(p.Children) != 3 {
+		return DiagnosticControl{}, errors.New("decode diagnostic control: want 3 fields")
+	}
+
+	fields := make([]string, 3)
+	for i, child := range p.Children {
+		s, ok := child.Value.(string)
+		if !ok {
+			return DiagnosticControl{}, fmt.Errorf("decode diagnostic control: field %d is not a string", i+1)
+		}
+		fields[i] = s
+	}
+
+	return DiagnosticControl{RequestID: fields[0], RuleID: fields[1], RuleName: fields[2]}, nil
+}
+
+// withControls appends controls to the LDAP message msg.
+func withControls(msg *ber.Packet, controls ...*ber.Packet) *ber.Packet {
+	packet := ber.Encode(ber.ClassContext, ber.TypeConstructed, 0, nil, "Controls")
+	for _, control := range controls {
+		packet.AppendChild(control)
+	}
+
+	msg.AppendChild(packet)
+
+	return msg
+}
+
+type requestIDKey struct{}
+
+// RequestIDFromContext returns the ID the request being handled is logged
+// with in the request log and in the server log.
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requestIDKey{}).(string)
+
+	return id, ok
+}
+
+func withRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// logger returns the server logger with the request ID of ctx, if any.
+func (s *LDAPServer) logger(ctx context.Context) *zap.Logger {
+	if id, ok := RequestIDFromContext(ctx); ok {
+		return s.log.With(zap.String("request_id", id))
+	}
+
+	return s.log
+}
+
+// SetDebug switches the debug output of searches. It can be called while
+// serving.
+func (s *LDAPServer) SetDebug(cfg DebugConfig) error {
+	s.debugMu.Lock()
+	defer s.debugMu.Unlock()
+
+	s.debug = cfg
+
+	return nil
+}
+
+// Debug returns the current debug output settings.
+func (s *LDAPServer) Debug() DebugConfig {
+	s.debugMu.RLock()
+	defer s.debugMu.RUnlock()
+
+	return s.debug
+}
+
+// debugRuleName names rule in debug output: by name, then ID, then filter.
+func debugRuleName(rule *Rule) string {
+	switch {
+	case rule.Name != "":
+		return rule.Name
+	case rule.ID != "":
+		return rule.ID
+	default:
+		return rule.Filter
+	}
+}
+
+// withAttr returns a copy of e with the attribute name set to values. The
+// attributes of e are not modified, as they may be shared with the mock.
+func (e Entry) withAttr(name string, values ...string) Entry {
+	attrs := make(map[string][]string, len(e.Attrs)+1)
+	maps.Copy(attrs, e.Attrs)
+	attrs[name] = values
+
+	return Entry{DN: e.DN, Attrs: attrs}
+}
@@ -0,0 +1,238 @@
+package ldapmock
+
+import (
+	"slices"
+	"sort"
+	"strings"
+)
+
+// indexedAttributes are the attributes with a value index. Filters on them
+// only evaluate the entries the index selects instead of every entry.
+var indexedAttributes = []string{"cn", "mail", "samaccountname", "uid"}
+
+// directoryIndex holds the users and groups of one directory with their
+// attributes prepared for filter evaluation, plus sorted value indexes that
+// answer equality and initial-substring assertions.
+type directoryIndex struct {
+	users  []User
+	groups []Group
+	// attrs holds the lowercased attributes of the users, then the groups.
+	attrs []map[string][]string
+	// values maps an indexed attribute to its lowercased values, sorted.
+	values map[string][]indexedValue
+}
+
+type indexedValue struct {
+	value string
+	pos   int
+}
+
+func newDirectoryIndex(users []User, groups []Group) *directoryIndex {
+	idx := &directoryIndex{
+		users:  users,
+		groups: groups,
+		attrs:  make([]map[string][]string, 0, len(users)+len(groups)),
+		values: make(map[string][]indexedValue, len(indexedAttributes)),
+	}
+
+	for _, user := range users {
+		idx.attrs = append(idx.attrs, entryAttributes(user.CN, user.Attrs, nil))
+	}
+	for _, group := range groups {
+		idx.attrs = append(idx.attrs, entryAttributes(group.CN, group.Attrs, group.Members))
+	}
+	idx.addMembership()
+
+	for _, name := range indexedAttributes {
+		var values []indexedValue
+		for pos, attrs := range idx.attrs {
+			for _, value := range attrs[name] {
+				values = append(values, indexedValue{value: strings.ToLower(value), pos: pos})
+			}
+		}
+
+		sort.Slice(values, func(i, j int) bool {
+			if values[i].value != values[j].value {
+				return values[i].value < values[j].value
+			}
+			return values[i].pos < values[j].pos
+		})
+
+		idx.values[name] = values
+	}
+
+	return idx
+}
+
+// entryAttributes returns the attributes filters see for an entry: the DN as
+// cn, attrs under lowercased names and every member value.
+func entryAttributes(dn string, attrs map[string]string, members []string) map[string][]string {
+	values := make(map[string][]string, len(attrs)+2)
+	values["cn"] = []string{dn}
+	for k, v := range attrs {
+		values[strings.ToLower(k)] = []string{v}
+	}
+	if len(members) > 0 {
+		values["member"] = members
+	}
+
+	return values
+}
+
+// addMembership derives the membership attributes filters see from the
+// group members: memberOf on the users, with the DN of every group listing
+// them, and memberUid on the groups, with the uid of every member (the value
+// of its first RDN when the member is not a known user or has no uid). They
+// are added to the values the entries declare, so that (memberOf=<group>) and
+// (memberUid=<uid>) are answered without rules.
+func (idx *directoryIndex) addMembership() {
+	userPos := make(map[string]int, len(idx.users))
+	for pos, user := range idx.users {
+		userPos[strings.Join(splitDN(user.CN), ",")] = pos
+	}
+
+	for i, group := range idx.groups {
+		groupAttrs := idx.attrs[len(idx.users)+i]
+		for _, member := range group.Members {
+			pos, ok := userPos[strings.Join(splitDN(member), ",")]
+			if ok {
+				addValue(idx.attrs[pos], "memberof", group.CN)
+			}
+
+			switch {
+			case ok && len(idx.attrs[pos]["uid"]) > 0:
+				addValue(groupAttrs, "memberuid", idx.attrs[pos]["uid"][0])
+			default:
+				rdn, _, _ := strings.Cut(member, ",")
+				if _, value, found := strings.Cut(rdn, "="); found {
+					addValue(groupAttrs, "memberuid", strings.TrimSpace(value))
+				}
+			}
+		}
+	}
+}
+
+// addValue adds value to the attribute name of attrs unless it already has
+// it, ignoring case.
+func addValue(attrs map[string][]string, name, value string) {
+	if slices.ContainsFunc(attrs[name], func(v string) bool { return strings.EqualFold(v, value) }) {
+		return
+	}
+
+	attrs[name] = append(attrs[name], value)
+}
+
+func (idx *directoryIndex) entryDN(pos int) string {
+	if pos < len(idx.users) {
+		return idx.users[pos].CN
+	}
+
+	return idx.groups[pos-len(idx.users)].CN
+}
+
+// filter returns the users and groups matching filterStr, comparing values by
+// the declared attribute syntaxes.
+func (idx *directoryIndex) filter(filterStr string, syntaxes AttributeSyntaxes) ([]User, []Group, error) {
+	if filterStr == "(objectClass=*)" || filterStr == "" {
+		return idx.users, idx.groups, nil
+	}
+
+	filter, err := ParseFilter(filterStr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	syntaxes = syntaxes.lower()
+
+	candidates, ok := idx.candidates(filter, syntaxes)
+	if !ok {
+		candidates = make([]int, len(idx.attrs))
+		for pos := range candidates {
+			candidates[pos] = pos
+		}
+	}
+
+	users := make([]User, 0, min(len(candidates), len(idx.users)))
+	var groups []Group
+	for _, pos := range candidates {
+		if !(entryMatcher{dn: idx.entryDN(pos), attrs: idx.attrs[pos], syntaxes: syntaxes}).match(filter) {
+			continue
+		}
+
+		if pos < len(idx.users) {
+			users = append(users, idx.users[pos])
+		} else {
+			groups = append(groups, idx.groups[pos-len(idx.users)])
+		}
+	}
+
+	return users, groups, nil
+}
+
+// candidates returns the sorted positions of the entries filter can match,
+// using the value indexes; ok is false when the indexes cannot narrow the
+// search. The positions are a superset: every candidate is still evaluated.
+func (idx *directoryIndex) candidates(filter *Filter, syntaxes AttributeSyntaxes) (positions []int, ok bool) {
+	switch filter.Type {
+	case FilterAnd:
+		for _, child := range filter.Children {
+			if childPositions, childOK := idx.candidates(child, syntaxes); childOK && (!ok || len(childPositions) < len(positions)) {
+				positions, ok = childPositions, true
+			}
+		}
+		return positions, ok
+
+	case FilterOr:
+		var union []int
+		for _, child := range filter.Children {
+			childPositions, childOK := idx.candidates(child, syntaxes)
+			if !childOK {
+				return nil, false
+			}
+			union = append(union, childPositions...)
+		}
+		slices.Sort(union)
+		return slices.Compact(union), true
+
+	case FilterEqual, FilterApprox:
+		return idx.lookup(filter.Attr, syntaxes, strings.ToLower(filter.Value), false)
+
+	case FilterSubstring:
+		if filter.Initial == "" {
+			return nil, false
+		}
+		return idx.lookup(filter.Attr, syntaxes, strings.ToLower(filter.Initial), true)
+	}
+
+	return nil, false
+}
+
+// lookup returns the positions of the entries with a value of attr equal to
+// value, or starting with it for a prefix lookup.
+func (idx *directoryIndex) lookup(attr string, syntaxes AttributeSyntaxes, value string, prefix bool) ([]int, bool) {
+	values, indexed := idx.values[attr]
+	if !indexed {
+		return nil, false
+	}
+
+	// Integer and DN values are normalized before comparing, so lowercased
+	// text does not find all of them.
+	switch syntaxes[attr] {
+	case SyntaxInteger, SyntaxDN:
+		return nil, false
+	}
+
+	start := sort.Search(len(values), func(i int) bool { return values[i].value >= value })
+
+	var positions []int
+	for _, v := range values[start:] {
+		if v.value != value && (!prefix || !strings.HasPrefix(v.value, value)) {
+			break
+		}
+		positions = append(positions, v.pos)
+	}
+
+	slices.Sort(positions)
+
+	return slices.Compact(positions), true
+}
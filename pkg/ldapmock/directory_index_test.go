@@ -0,0 +1,72 @@
+package ldapmock
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestDirectoryIndex_Filter(t *testing.T) {
+	var users []User
+	for i := 0; i < 50; i++ {
+		users = append(users, User{
+			CN: fmt.Sprintf("uid=user%02d,ou=people,dc=example", i),
+			Attrs: map[string]string{
+				"uid":            fmt.Sprintf("user%02d", i),
+				"mail":           fmt.Sprintf("User%02d@Example.com", i),
+				"sAMAccountName": fmt.Sprintf("USER%02d", i),
+				"uidNumber":      fmt.Sprint(1000 + i),
+			},
+		})
+	}
+	groups := []Group{
+		{CN: "cn=admins,ou=groups,dc=example", Members: []string{"UID=User01, OU=People, DC=Example", users[2].CN, "uid=outsider,ou=people,dc=example"}},
+	}
+
+	idx := newDirectoryIndex(users, groups)
+
+	tests := []struct {
+		filter     string
+		syntaxes   AttributeSyntaxes
+		wantDNs    []string
+		wantNarrow bool
+	}{
+		{filter: "(uid=user07)", wantDNs: []string{users[7].CN}, wantNarrow: true},
+		{filter: "(mail=user07@example.com)", wantDNs: []string{users[7].CN}, wantNarrow: true},
+		{filter: "(sAMAccountName=user4*)", wantDNs: dnsOf(users[40:50]), wantNarrow: true},
+		{filter: "(&(uidNumber>=1001)(uid=user0*))", wantDNs: dnsOf(users[1:10]), wantNarrow: true},
+		{filter: "(|(uid=user01)(cn=cn=admins,ou=groups,dc=example))", wantDNs: []string{users[1].CN, groups[0].CN}, wantNarrow: true},
+		{filter: "(|(uid=user01)(uidNumber=1002))", wantDNs: []string{users[1].CN, users[2].CN}},
+		{filter: "(member=uid=user02,ou=people,dc=example)", wantDNs: []string{groups[0].CN}},
+		{filter: "(memberOf=CN=Admins,OU=Groups,DC=Example)", wantDNs: []string{users[1].CN, users[2].CN}},
+		{filter: "(&(memberOf=cn=admins,ou=groups,dc=example)(uid=user02))", wantDNs: []string{users[2].CN}, wantNarrow: true},
+		{filter: "(memberUid=user01)", wantDNs: []string{groups[0].CN}},
+		{filter: "(memberUid=outsider)", wantDNs: []string{groups[0].CN}},
+		{filter: "(uid=*er49)", wantDNs: []string{users[49].CN}},
+		{filter: "(mail=User07@Example.com)", syntaxes: AttributeSyntaxes{"mail": SyntaxCaseExact}, wantDNs: []string{users[7].CN}, wantNarrow: true},
+		{filter: "(mail=user07@example.com)", syntaxes: AttributeSyntaxes{"mail": SyntaxCaseExact}, wantDNs: []string{}, wantNarrow: true},
+		{filter: "(uid=nobody)", wantDNs: []string{}, wantNarrow: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			users, groups, err := idx.filter(tt.filter, tt.syntaxes)
+			if err != nil {
+				t.Fatalf("filter: %v", err)
+			}
+
+			if got := returnedDNs(users, groups); !reflect.DeepEqual(got, tt.wantDNs) {
+				t.Errorf("dns = %v, want %v", got, tt.wantDNs)
+			}
+
+			f, _ := ParseFilter(tt.filter)
+			if _, narrow := idx.candidates(f, tt.syntaxes.lower()); narrow != tt.wantNarrow {
+				t.Errorf("index used = %v, want %v", narrow, tt.wantNarrow)
+			}
+		})
+	}
+}
+
+func dnsOf(users []User) []string {
+	return returnedDNs(users, nil)
+}
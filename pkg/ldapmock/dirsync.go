@@ -0,0 +1,159 @@
+package ldapmock
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// DirSyncValue is the value of an Active Directory DirSync control.
+type DirSyncValue struct {
+	Flags        int64  `json:"flags"`
+	MaxAttrCount int64  `json:"max_attr_count"`
+	Cookie       []byte `json:"cookie,omitempty"`
+}
+
+// dirSyncCookiePrefix tells the DirSync cookies of the mock apart from
+// those of a real directory.
+const dirSyncCookiePrefix = "ldap-mock-dirsync:"
+
+var (
+	errInvalidDirSyncCookie = errors.New("invalid DirSync cookie")
+	// errExpiredDirSyncCookie is returned for cookies older than the oldest
+	// change the changelog keeps: the changes since are partly lost.
+	errExpiredDirSyncCookie = errors.New("DirSync cookie expired")
+)
+
+// dirSyncRequest returns the DirSync control of req.
+func dirSyncRequest(req SearchRequest) (DirSyncValue, bool) {
+	for _, control := range req.Controls {
+		if value, ok := control.Value.(DirSyncValue); ok && control.OID == ldap.ControlTypeDirSync {
+			return value, true
+		}
+	}
+
+	return DirSyncValue{}, false
+}
+
+// dirSyncCookie is the DirSync cookie of the changelog up to seq.
+func dirSyncCookie(seq uint64) []byte {
+	return []byte(dirSyncCookiePrefix + strconv.FormatUint(seq, 10))
+}
+
+// parseDirSyncCookie returns the sequence number of cookie, which must be
+// between the changes before oldest, the oldest one kept, and last.
+func parseDirSyncCookie(cookie []byte, oldest, last uint64) (uint64, error) {
+	digits, ok := strings.CutPrefix(string(cookie), dirSyncCookiePrefix)
+	if !ok {
+		return 0, errInvalidDirSyncCookie
+	}
+
+	seq, err := strconv.ParseUint(digits, 10, 64)
+	if err != nil || seq > last {
+		return 0, errInvalidDirSyncCookie
+	}
+	if seq+1 < oldest {
+		return 0, errExpiredDirSyncCookie
+	}
+
+	return seq, nil
+}
+
+// dirSyncMiddleware emulates the DirSync control of Active Directory: a
+// search without cookie returns the whole result, one with a cookie the
+// entries changed since, each once in its current state, and deleted entries
+// with isDeleted: TRUE. The result carries the cookie of the next search.
+// Entries have an objectGUID derived from their DN unless they have one.
+// Flags, the attribute count limit and the rules are not applied to changes.
+func (s *LDAPServer) dirSyncMiddleware(next SearchFunc) SearchFunc {
+	return func(ctx context.Context, req SearchRequest) (SearchResult, error) {
+		dirSync, ok := dirSyncRequest(req)
+		if !ok {
+			return next(ctx, req)
+		}
+
+		// Changes after last may be in the result too.
+		last := s.changelog.lastSeq()
+
+		var (
+			result SearchResult
+			err    error
+		)
+		if len(dirSync.Cookie) == 0 {
+			result, err = next(ctx, req)
+			if err != nil {
+				return result, err
+			}
+
+			entries := slices.Collect(result.entries())
+			result.Users, result.Groups, result.Entries = nil, nil, entries
+		} else {
+			result, last, err = s.dirSyncChanges(ctx, req, dirSync.Cookie)
+			if err != nil {
+				return SearchResult{}, err
+			}
+		}
+
+		for i, entry := range result.Entries {
+			result.Entries[i] = withObjectGUID(entry, req.Attributes)
+		}
+
+		response := &ldap.ControlDirSync{Cookie: dirSyncCookie(last)}
+		result.controls = append(result.controls, response.Encode())
+
+		return result, nil
+	}
+}
+
+// dirSyncChanges returns the entries changed since cookie that concern req
+// (see changeEntry), and the sequence number of the last change.
+func (s *LDAPServer) dirSyncChanges(ctx context.Context, req SearchRequest, cookie []byte) (SearchResult, uint64, error) {
+	mock, _, _ := s.currentMock(ctx)
+
+	seq, err := parseDirSyncCookie(cookie, s.changelog.oldestSeq(), s.changelog.lastSeq())
+	if err != nil {
+		return SearchResult{}, 0, ldap.NewError(ldap.LDAPResultUnwillingToPerform, err)
+	}
+
+	filter, err := ParseFilter(req.Filter)
+	if err != nil {
+		return SearchResult{}, 0, ldap.NewError(ldap.LDAPResultFilterError, err)
+	}
+
+	changes, last := s.changelog.since(seq)
+	syntaxes := mock.Attributes.lower()
+
+	var result SearchResult
+	for _, change := range latestChanges(changes) {
+		entry, state, ok := changeEntry(change, req, filter, syntaxes)
+		if !ok {
+			continue
+		}
+		if state == ldap.SyncStateDelete {
+			entry.Attrs = map[string][]string{"isDeleted": {"TRUE"}}
+		}
+
+		result.Entries = append(result.Entries, entry)
+	}
+
+	return result, last, nil
+}
+
+// withObjectGUID adds the objectGUID of entry, derived from its DN, when
+// requested and the entry has none.
+func withObjectGUID(entry Entry, requested []string) Entry {
+	if !attributeRequested(requested, "objectGUID") {
+		return entry
+	}
+	if _, ok := attributeValues(entry.Attrs, "objectGUID"); ok {
+		return entry
+	}
+
+	id := entryUUID(entry.DN)
+
+	return entry.withAttr("objectGUID", string(id[:]))
+}
@@ -0,0 +1,40 @@
+package ldapmock
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseDirSyncCookie(t *testing.T) {
+	// Changes 1 and 2 were dropped from a changelog with a capacity of 3.
+	log := changelog{capacity: 3}
+	for _, dn := range []string{"a", "b", "c", "d", "e"} {
+		log.record([]Change{{Type: ChangeAdd, DN: dn}}, time.Now())
+	}
+
+	tests := []struct {
+		cookie string
+		want   uint64
+		err    error
+	}{
+		{"ldap-mock-dirsync:0", 0, errExpiredDirSyncCookie},
+		{"ldap-mock-dirsync:1", 0, errExpiredDirSyncCookie},
+		{"ldap-mock-dirsync:2", 2, nil},
+		{"ldap-mock-dirsync:5", 5, nil},
+		{"ldap-mock-dirsync:6", 0, errInvalidDirSyncCookie},
+		{"ldap-mock-dirsync:x", 0, errInvalidDirSyncCookie},
+		{"5", 0, errInvalidDirSyncCookie},
+	}
+
+	for _, tt := range tests {
+		got, err := parseDirSyncCookie([]byte(tt.cookie), log.oldestSeq(), log.lastSeq())
+		if got != tt.want || !errors.Is(err, tt.err) {
+			t.Errorf("parseDirSyncCookie(%q) = %d, %v, want %d, %v", tt.cookie, got, err, tt.want, tt.err)
+		}
+	}
+
+	if cookie := dirSyncCookie(5); string(cookie) != "ldap-mock-dirsync:5" {
+		t.Errorf("dirSyncCookie(5) = %q", cookie)
+	}
+}
@@ -0,0 +1,5 @@
+// Package ldapmock implements a mock LDAP server driven by a YAML/rule based
+// spec, together with the HTTP control server used to load mocks and inspect
+// the recorded requests. It can be embedded in Go tests to run the mock
+// in-process instead of starting the ldap-mock binary.
+package ldapmock
@@ -0,0 +1,166 @@
+package ldapmock
+
+import "strings"
+
+// Sources of EffectiveRule.
+const (
+	RuleSourceMock        = "mock"
+	RuleSourceExpectation = "expectation"
+)
+
+// Actions of EffectiveRule.
+const (
+	RuleActionResponse    = "response"
+	RuleActionScript      = "script"
+	RuleActionWASM        = "wasm"
+	RuleActionPassthrough = "passthrough"
+)
+
+// EffectiveMockProvider is implemented by mock holders that can report the
+// mock as their rule engines see it, as used by GET /mock/effective.
+type EffectiveMockProvider interface {
+	EffectiveMock() EffectiveMock
+}
+
+// EffectiveMock is the mock after it is compiled, as returned by
+// GET /mock/effective: the directories searches are answered from, with their
+// rules in evaluation order and defaults resolved.
+type EffectiveMock struct {
+	// Version is the version of the mock in the history, 0 before the first
+	// SetMock.
+	Version     uint64               `json:"version"`
+	Directories []EffectiveDirectory `json:"directories"`
+}
+
+// EffectiveDirectory is the top-level directory or a tenant of an
+// EffectiveMock.
+type EffectiveDirectory struct {
+	// Tenant is the name of the tenant, empty for the top-level directory.
+	Tenant string `json:"tenant,omitempty"`
+	BaseDN string `json:"base_dn,omitempty"`
+	// Users and Groups count the fallback entries indexed for the directory.
+	Users  int             `json:"users"`
+	Groups int             `json:"groups"`
+	Rules  []EffectiveRule `json:"rules"`
+}
+
+// EffectiveRule is a rule as the engine evaluates it. Rules registered with
+// Expect are included, merged by priority with the rules of the mock.
+type EffectiveRule struct {
+	// Order is the position of the rule in evaluation order, from 1.
+	Order int    `json:"order"`
+	ID    string `json:"id,omitempty"`
+	Name  string `json:"name,omitempty"`
+	// Namespace is the namespace of the rule; rules of disabled namespaces
+	// are not listed.
+	Namespace string `json:"namespace,omitempty"`
+	// Key identifies the rule in statistics and metrics: its ID, then name,
+	// then filter.
+	Key    string `json:"key"`
+	Filter string `json:"filter"`
+	// ParsedFilter is Filter normalized, empty when it does not parse;
+	// FilterError then tells why.
+	ParsedFilter string `json:"parsed_filter,omitempty"`
+	FilterError  string `json:"filter_error,omitempty"`
+	FilterMatch  string `json:"filter_match"`
+	BaseDN       string `json:"base_dn,omitempty"`
+	// BaseDNMatch is empty when the rule matches any base DN.
+	BaseDNMatch string `json:"base_dn_match,omitempty"`
+	// Scope is "any" when the rule matches searches of every scope.
+	Scope    string `json:"scope"`
+	WhenExpr string `json:"when_expr,omitempty"`
+	Priority int    `json:"priority"`
+	// Source is RuleSourceMock or RuleSourceExpectation.
+	Source string `json:"source"`
+	// Action is RuleActionResponse, RuleActionScript, RuleActionWASM or
+	// RuleActionPassthrough.
+	Action string `json:"action"`
+}
+
+// EffectiveMock returns the current mock as the rule engines see it.
+func (s *LDAPServer) EffectiveMock() EffectiveMock {
+	snapshot := s.mock.Load()
+
+	effective := EffectiveMock{
+		Version:     snapshot.version,
+		Directories: make([]EffectiveDirectory, 0, len(snapshot.compiled.tenants)+1),
+	}
+
+	add := func(tenant, baseDN string, dir compiledDirectory) {
+		effective.Directories = append(effective.Directories, EffectiveDirectory{
+			Tenant: tenant,
+			BaseDN: baseDN,
+			Users:  len(dir.entries.users),
+			Groups: len(dir.entries.groups),
+			Rules:  effectiveRules(dir.matching),
+		})
+	}
+
+	add("", "", snapshot.compiled.root)
+	for i, tenant := range snapshot.mock.Tenants {
+		add(tenant.Name, tenant.BaseDN, snapshot.compiled.tenants[i])
+	}
+
+	return effective
+}
+
+func effectiveRules(engine *RuleEngine) []EffectiveRule {
+	rules := make([]EffectiveRule, len(engine.rules))
+	for i := range engine.rules {
+		rule := &engine.rules[i]
+
+		effective := EffectiveRule{
+			Order:       i + 1,
+			ID:          rule.ID,
+			Name:        rule.Name,
+			Namespace:   rule.Namespace,
+			Key:         latencyRuleLabel(rule),
+			Filter:      rule.Filter,
+			FilterMatch: strings.ToLower(rule.FilterMatch),
+			BaseDN:      rule.BaseDN,
+			Scope:       "any",
+			WhenExpr:    rule.WhenExpr,
+			Priority:    rule.Priority,
+			Source:      RuleSourceMock,
+			Action:      RuleActionResponse,
+		}
+
+		if f := engine.filters[i]; f.err != nil {
+			effective.FilterError = f.err.Error()
+		} else {
+			effective.ParsedFilter = f.filter.String()
+		}
+
+		if effective.FilterMatch == "" {
+			effective.FilterMatch = FilterMatchStructural
+		}
+
+		if rule.BaseDN != "" {
+			effective.BaseDNMatch = strings.ToLower(rule.BaseDNMatch)
+			if effective.BaseDNMatch == "" {
+				effective.BaseDNMatch = BaseDNExact
+			}
+		}
+
+		if rule.Scope != "" {
+			effective.Scope = ParseScope(rule.Scope).String()
+		}
+
+		if strings.HasPrefix(rule.ID, expectationIDPrefix) {
+			effective.Source = RuleSourceExpectation
+		}
+
+		switch {
+		case rule.Script != "":
+			effective.Action = RuleActionScript
+		case rule.WASM != "":
+			effective.Action = RuleActionWASM
+		case rule.Passthrough:
+			effective.Action = RuleActionPassthrough
+		}
+
+		rules[i] = effective
+	}
+
+	return rules
+}
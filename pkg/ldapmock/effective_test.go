@@ -0,0 +1,57 @@
+package ldapmock
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestLDAPServer_EffectiveMock(t *testing.T) {
+	srv := NewLDAPServer(zap.NewNop(), "0", "", "", nil)
+	srv.SetMock(LDAPMock{
+		Users:  []User{{CN: "uid=john,dc=example"}, {CN: "uid=jane,dc=example"}},
+		Groups: []Group{{CN: "cn=admins,dc=example"}},
+		Rules: []Rule{
+			{Name: "fallback", Filter: "(UID=*)"},
+			{ID: "login", Filter: "(uid=john)", BaseDN: "dc=example", Scope: "ONE", Priority: 10, Passthrough: true},
+			{Filter: "(uid=", FilterMatch: "Semantic", BaseDN: "dc=example", BaseDNMatch: "Subtree", Script: "x"},
+		},
+		Tenants: []Tenant{{Name: "acme", BaseDN: "dc=acme", Users: []User{{CN: "uid=bob,dc=acme"}}}},
+	})
+	srv.Expect().Filter("(uid=bob)").Priority(5)
+
+	effective := srv.EffectiveMock()
+	if effective.Version != 1 || len(effective.Directories) != 2 {
+		t.Fatalf("effective mock = %+v, want version 1 with 2 directories", effective)
+	}
+
+	root := effective.Directories[0]
+	if root.Users != 2 || root.Groups != 1 || len(root.Rules) != 4 {
+		t.Fatalf("root directory = %+v", root)
+	}
+
+	want := []EffectiveRule{
+		{Order: 1, ID: "login", Key: "login", Filter: "(uid=john)", ParsedFilter: "(uid=john)", FilterMatch: FilterMatchStructural,
+			BaseDN: "dc=example", BaseDNMatch: BaseDNExact, Scope: "one", Priority: 10, Source: RuleSourceMock, Action: RuleActionPassthrough},
+		{Order: 2, ID: "expect-1", Key: "expect-1", Filter: "(uid=bob)", ParsedFilter: "(uid=bob)", FilterMatch: FilterMatchStructural,
+			Scope: "any", Priority: 5, Source: RuleSourceExpectation, Action: RuleActionResponse},
+		{Order: 3, Name: "fallback", Key: "fallback", Filter: "(UID=*)", ParsedFilter: "(uid=*)", FilterMatch: FilterMatchStructural,
+			Scope: "any", Source: RuleSourceMock, Action: RuleActionResponse},
+		{Order: 4, Key: "(uid=", Filter: "(uid=", FilterMatch: FilterMatchSemantic,
+			BaseDN: "dc=example", BaseDNMatch: BaseDNSubtree, Scope: "any", Source: RuleSourceMock, Action: RuleActionScript},
+	}
+	for i, rule := range root.Rules {
+		rule.FilterError = ""
+		if rule != want[i] {
+			t.Errorf("rule %d = %+v, want %+v", i, rule, want[i])
+		}
+	}
+	if root.Rules[3].FilterError == "" {
+		t.Error("the invalid filter has no error")
+	}
+
+	tenant := effective.Directories[1]
+	if tenant.Tenant != "acme" || tenant.BaseDN != "dc=acme" || tenant.Users != 1 || len(tenant.Rules) != 1 {
+		t.Errorf("tenant directory = %+v", tenant)
+	}
+}
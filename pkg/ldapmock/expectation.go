@@ -0,0 +1,287 @@
+package ldapmock
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+const expectationIDPrefix = "expect-"
+
+// Expectation is a rule defined from Go code, mirroring the YAML rules:
+//
+//	srv.Expect().Filter("(uid=%s)", "bob").RespondUsers(bob).Times(2)
+//
+// Expectations are matched together with the mock rules (by priority) and
+// can be verified with LDAPServer.VerifyExpectations.
+type Expectation struct {
+	mu    sync.Mutex
+	rule  Rule
+	times int
+	hits  int
+	// changed is called once the rule changed.
+	changed func()
+}
+
+// Expect registers a new expectation. It matches nothing until a filter is
+// set.
+func (s *LDAPServer) Expect() *Expectation {
+	s.expectMu.Lock()
+	e := &Expectation{
+		rule:    Rule{ID: fmt.Sprintf("%s%d", expectationIDPrefix, len(s.expectations)+1)},
+		times:   -1,
+		changed: s.compileExpectations,
+	}
+	s.expectations = append(s.expectations, e)
+	s.expectMu.Unlock()
+
+	s.compileExpectations()
+
+	return e
+}
+
+// VerifyExpectations returns an error describing every expectation whose
+// call count does not match: Times(n) requires exactly n calls, otherwise at
+// least one call is required.
+func (s *LDAPServer) VerifyExpectations() error {
+	s.expectMu.Lock()
+	expectations := append([]*Expectation(nil), s.expectations...)
+	s.expectMu.Unlock()
+
+	var errs []error
+	for _, e := range expectations {
+		if err := e.verify(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// ExpectationStatus is the state of an expectation, as reported by
+// ExpectationProvider.
+type ExpectationStatus struct {
+	Rule Rule `json:"rule"`
+	// Times is the exact number of calls required, or -1 for at least one.
+	Times int `json:"times"`
+	Hits  int `json:"hits"`
+	// Error tells why the expectation is not met; it is empty when it is.
+	Error string `json:"error,omitempty"`
+}
+
+// ExpectationProvider is implemented by mock holders with expectations, as
+// used by GET /contracts.
+type ExpectationProvider interface {
+	Expectations() []ExpectationStatus
+}
+
+// Expectations returns the state of every registered expectation, in
+// registration order.
+func (s *LDAPServer) Expectations() []ExpectationStatus {
+	s.expectMu.Lock()
+	expectations := append([]*Expectation(nil), s.expectations...)
+	s.expectMu.Unlock()
+
+	statuses := make([]ExpectationStatus, 0, len(expectations))
+	for _, e := range expectations {
+		status := ExpectationStatus{Rule: e.snapshot()}
+		if err := e.verify(); err != nil {
+			status.Error = err.Error()
+		}
+
+		e.mu.Lock()
+		status.Times, status.Hits = e.times, e.hits
+		e.mu.Unlock()
+
+		statuses = append(statuses, status)
+	}
+
+	return statuses
+}
+
+// ResetExpectations removes all registered expectations.
+func (s *LDAPServer) ResetExpectations() {
+	s.expectMu.Lock()
+	s.expectations = nil
+	s.expectMu.Unlock()
+
+	s.compileExpectations()
+}
+
+// compileExpectations compiles the expectations again and merges them into
+// the rules of the current mock, so that searches only load them.
+func (s *LDAPServer) compileExpectations() {
+	s.setMockMu.Lock()
+	defer s.setMockMu.Unlock()
+
+	s.expectEngine = NewRuleEngine(s.expectationRules())
+
+	snapshot := *s.mock.Load()
+	snapshot.compiled = snapshot.compiled.withExpectations(s.expectEngine)
+	s.mock.Store(&snapshot)
+}
+
+func (s *LDAPServer) expectationRules() []Rule {
+	s.expectMu.Lock()
+	defer s.expectMu.Unlock()
+
+	rules := make([]Rule, 0, len(s.expectations))
+	for _, e := range s.expectations {
+		rules = append(rules, e.snapshot())
+	}
+
+	return rules
+}
+
+func (s *LDAPServer) recordExpectationHit(rule *Rule) {
+	if !strings.HasPrefix(rule.ID, expectationIDPrefix) {
+		return
+	}
+
+	s.expectMu.Lock()
+	defer s.expectMu.Unlock()
+
+	for _, e := range s.expectations {
+		e.mu.Lock()
+		if e.rule.ID == rule.ID {
+			e.hits++
+		}
+		e.mu.Unlock()
+	}
+}
+
+// Name sets the rule name reported in the request log.
+func (e *Expectation) Name(name string) *Expectation {
+	return e.update(func(rule *Rule) { rule.Name = name })
+}
+
+// Filter sets the LDAP filter to match. Arguments are escaped per RFC 4515
+// and substituted into format with fmt.Sprintf.
+func (e *Expectation) Filter(format string, args ...any) *Expectation {
+	filter := format
+	if len(args) > 0 {
+		escaped := make([]any, len(args))
+		for i, arg := range args {
+			escaped[i] = EscapeFilterValue(fmt.Sprint(arg))
+		}
+		filter = fmt.Sprintf(format, escaped...)
+	}
+
+	return e.update(func(rule *Rule) { rule.Filter = filter })
+}
+
+// BaseDN restricts the expectation to searches with the given base DN.
+func (e *Expectation) BaseDN(baseDN string) *Expectation {
+	return e.update(func(rule *Rule) {
+		rule.BaseDN = baseDN
+		rule.BaseDNMatch = ""
+	})
+}
+
+// BaseDNSubtree restricts the expectation to searches based at or below
+// baseDN.
+func (e *Expectation) BaseDNSubtree(baseDN string) *Expectation {
+	return e.update(func(rule *Rule) {
+		rule.BaseDN = baseDN
+		rule.BaseDNMatch = BaseDNSubtree
+	})
+}
+
+// Scope restricts the expectation to searches with the given scope:
+// "base", "one" or "sub".
+func (e *Expectation) Scope(scope string) *Expectation {
+	return e.update(func(rule *Rule) { rule.Scope = scope })
+}
+
+// Priority sets the evaluation priority relative to other rules.
+func (e *Expectation) Priority(priority int) *Expectation {
+	return e.update(func(rule *Rule) { rule.Priority = priority })
+}
+
+// RespondUsers appends users to the response.
+func (e *Expectation) RespondUsers(users ...User) *Expectation {
+	return e.update(func(rule *Rule) { rule.Response.Users = append(rule.Response.Users, users...) })
+}
+
+// RespondGroups appends groups to the response.
+func (e *Expectation) RespondGroups(groups ...Group) *Expectation {
+	return e.update(func(rule *Rule) { rule.Response.Groups = append(rule.Response.Groups, groups...) })
+}
+
+// Times sets the exact number of calls required by VerifyExpectations.
+func (e *Expectation) Times(n int) *Expectation {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.times = n
+
+	return e
+}
+
+// Hits returns how many searches matched the expectation.
+func (e *Expectation) Hits() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.hits
+}
+
+// update applies fn to the rule of e, then reports the change, so that the
+// server compiles the expectations again.
+func (e *Expectation) update(fn func(rule *Rule)) *Expectation {
+	e.mu.Lock()
+	fn(&e.rule)
+	e.mu.Unlock()
+
+	if e.changed != nil {
+		e.changed()
+	}
+
+	return e
+}
+
+func (e *Expectation) snapshot() Rule {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.rule
+}
+
+func (e *Expectation) verify() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	switch {
+	case e.times < 0 && e.hits == 0:
+		return fmt.Errorf("expectation %s: filter %q was never matched", e.describe(), e.rule.Filter)
+	case e.times >= 0 && e.hits != e.times:
+		return fmt.Errorf("expectation %s: filter %q matched %d times, want %d", e.describe(), e.rule.Filter, e.hits, e.times)
+	}
+
+	return nil
+}
+
+func (e *Expectation) describe() string {
+	if e.rule.Name != "" {
+		return e.rule.ID + " (" + e.rule.Name + ")"
+	}
+
+	return e.rule.ID
+}
+
+// EscapeFilterValue escapes the characters that are special in LDAP filter
+// values (RFC 4515).
+func EscapeFilterValue(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; c {
+		case '*', '(', ')', '\\', 0:
+			_, _ = fmt.Fprintf(&b, "\\%02x", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,107 @@
+package ldapmock
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestExpectation_MatchAndVerify(t *testing.T) {
+	srv := NewLDAPServer(zap.NewNop(), "0", "", "", nil)
+	srv.SetMock(LDAPMock{
+		Rules: []Rule{
+			{Name: "yaml-rule", Filter: "(uid=bob)", Priority: 1},
+		},
+	})
+
+	e := srv.Expect().
+		Name("bob lookup").
+		Filter("(uid=%s)", "bob").
+		Priority(10).
+		RespondUsers(User{CN: "uid=bob,dc=example,dc=com"}).
+		Times(2)
+
+	if err := srv.VerifyExpectations(); err == nil {
+		t.Fatal("expected verification error before any search")
+	}
+
+	req := SearchRequest{Filter: "(uid=bob)", Scope: ScopeSub}
+	for i := 0; i < 2; i++ {
+		result, _ := srv.OnSearch(context.Background(), req)
+		if rule := result.MatchedRule; rule == nil || rule.Name != "bob lookup" {
+			t.Fatalf("matched rule = %v, want bob lookup", rule)
+		}
+		if users := result.Users; len(users) != 1 || users[0].CN != "uid=bob,dc=example,dc=com" {
+			t.Fatalf("users = %v", users)
+		}
+	}
+
+	if e.Hits() != 2 {
+		t.Errorf("hits = %d, want 2", e.Hits())
+	}
+	if err := srv.VerifyExpectations(); err != nil {
+		t.Errorf("unexpected verification error: %v", err)
+	}
+
+	_, _ = srv.OnSearch(context.Background(), req)
+	err := srv.VerifyExpectations()
+	if err == nil || !strings.Contains(err.Error(), "matched 3 times, want 2") {
+		t.Errorf("verification error = %v, want call count mismatch", err)
+	}
+
+	srv.ResetExpectations()
+	result, _ := srv.OnSearch(context.Background(), req)
+	if rule := result.MatchedRule; rule == nil || rule.Name != "yaml-rule" {
+		t.Errorf("matched rule after reset = %v, want yaml-rule", rule)
+	}
+}
+
+func TestEscapeFilterValue(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"bob", "bob"},
+		{"a*b", `a\2ab`},
+		{"(x)", `\28x\29`},
+		{`back\slash`, `back\5cslash`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := EscapeFilterValue(tt.in); got != tt.want {
+				t.Errorf("EscapeFilterValue(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpectation_CompiledOnce(t *testing.T) {
+	srv := NewLDAPServer(zap.NewNop(), "0", "", "", nil)
+	srv.SetMock(LDAPMock{Tenants: []Tenant{{BaseDN: "dc=acme"}}})
+
+	e := srv.Expect().Filter("(uid=bob)")
+	engine := srv.mock.Load().compiled.root.matching
+
+	for range 2 {
+		if result, _ := srv.OnSearch(context.Background(), SearchRequest{Filter: "(uid=bob)", Scope: ScopeSub}); result.MatchedRule == nil {
+			t.Fatal("expectation not matched")
+		}
+	}
+	if srv.mock.Load().compiled.root.matching != engine {
+		t.Error("expectations compiled again by searches")
+	}
+
+	// Changes to an expectation and new mocks are merged in when made.
+	e.BaseDN("dc=acme")
+	if result, _ := srv.OnSearch(context.Background(), SearchRequest{BaseDN: "dc=acme", Filter: "(uid=bob)", Scope: ScopeSub}); result.MatchedRule == nil {
+		t.Error("changed expectation not matched in the tenant")
+	}
+
+	srv.SetMock(LDAPMock{})
+	if result, _ := srv.OnSearch(context.Background(), SearchRequest{BaseDN: "dc=acme", Filter: "(uid=bob)", Scope: ScopeSub}); result.MatchedRule == nil {
+		t.Error("expectation not matched after SetMock")
+	}
+}
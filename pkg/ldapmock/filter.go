@@ -0,0 +1,576 @@
+package ldapmock
+
+import (
+	"cmp"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+type FilterType int
+
+const (
+	FilterAnd FilterType = iota
+	FilterOr
+	FilterNot
+	FilterEqual
+	FilterApprox
+	FilterGreaterOrEqual
+	FilterLessOrEqual
+	FilterPresent
+	FilterSubstring
+	FilterExtensible
+)
+
+type Filter struct {
+	Type     FilterType
+	Attr     string
+	Value    string
+	Children []*Filter
+	Initial  string
+	Any      []string
+	Final    string
+	// MatchingRule and DNAttributes are set for extensible match filters
+	// (attr:dn:rule:=value). MatchingRule is lowercased.
+	MatchingRule string
+	DNAttributes bool
+}
+
+// String returns f in the LDAP string representation, normalized: attribute
+// names and matching rules are lowercased and values escaped.
+func (f *Filter) String() string {
+	var b strings.Builder
+	f.write(&b)
+
+	return b.String()
+}
+
+func (f *Filter) write(b *strings.Builder) {
+	b.WriteByte('(')
+
+	switch f.Type {
+	case FilterAnd, FilterOr, FilterNot:
+		b.WriteString(map[FilterType]string{FilterAnd: "&", FilterOr: "|", FilterNot: "!"}[f.Type])
+		for _, child := range f.Children {
+			child.write(b)
+		}
+	case FilterEqual:
+		b.WriteString(f.Attr + "=" + ldap.EscapeFilter(f.Value))
+	case FilterApprox:
+		b.WriteString(f.Attr + "~=" + ldap.EscapeFilter(f.Value))
+	case FilterGreaterOrEqual:
+		b.WriteString(f.Attr + ">=" + ldap.EscapeFilter(f.Value))
+	case FilterLessOrEqual:
+		b.WriteString(f.Attr + "<=" + ldap.EscapeFilter(f.Value))
+	case FilterPresent:
+		b.WriteString(f.Attr + "=*")
+	case FilterSubstring:
+		b.WriteString(f.Attr + "=" + ldap.EscapeFilter(f.Initial) + "*")
+		for _, part := range f.Any {
+			b.WriteString(ldap.EscapeFilter(part) + "*")
+		}
+		b.WriteString(ldap.EscapeFilter(f.Final))
+	case FilterExtensible:
+		b.WriteString(f.Attr)
+		if f.DNAttributes {
+			b.WriteString(":dn")
+		}
+		if f.MatchingRule != "" {
+			b.WriteString(":" + f.MatchingRule)
+		}
+		b.WriteString(":=" + ldap.EscapeFilter(f.Value))
+	}
+
+	b.WriteByte(')')
+}
+
+func ParseFilter(filterStr string) (*Filter, error) {
+	filterStr = strings.TrimSpace(filterStr)
+	if len(filterStr) == 0 {
+		return nil, fmt.Errorf("empty filter")
+	}
+
+	if filterStr[0] != '(' || filterStr[len(filterStr)-1] != ')' {
+		return nil, fmt.Errorf("filter must be enclosed in parentheses")
+	}
+
+	return parseFilterComp(filterStr[1 : len(filterStr)-1])
+}
+
+func parseFilterComp(s string) (*Filter, error) {
+	if len(s) == 0 {
+		return nil, fmt.Errorf("empty filter component")
+	}
+
+	switch s[0] {
+	case '&':
+		return parseFilterList(s[1:], FilterAnd)
+	case '|':
+		return parseFilterList(s[1:], FilterOr)
+	case '!':
+		child, err := ParseFilter(s[1:])
+		if err != nil {
+			return nil, fmt.Errorf("parse NOT filter: %w", err)
+		}
+		return &Filter{Type: FilterNot, Children: []*Filter{child}}, nil
+	default:
+		return parseItem(s)
+	}
+}
+
+func parseFilterList(s string, filterType FilterType) (*Filter, error) {
+	filter := &Filter{Type: filterType}
+
+	for len(s) > 0 {
+		if s[0] != '(' {
+			return nil, fmt.Errorf("expected '(' in filter list, got %c", s[0])
+		}
+
+		depth := 0
+		end := 0
+		for i, c := range s {
+			if c == '(' {
+				depth++
+			} else if c == ')' {
+				depth--
+				if depth == 0 {
+					end = i
+					break
+				}
+			}
+		}
+
+		if depth != 0 {
+			return nil, fmt.Errorf("unbalanced parentheses in filter list")
+		}
+
+		child, err := ParseFilter(s[:end+1])
+		if err != nil {
+			return nil, err
+		}
+		filter.Children = append(filter.Children, child)
+		s = s[end+1:]
+	}
+
+	if len(filter.Children) == 0 {
+		return nil, fmt.Errorf("empty filter list")
+	}
+
+	return filter, nil
+}
+
+func parseItem(s string) (*Filter, error) {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '=':
+			attr := s[:i]
+			rawValue := s[i+1:]
+			value := unescapeFilterValue(rawValue)
+
+			if i > 0 && s[i-1] == ':' {
+				return parseExtensibleFilter(s[:i-1], value)
+			}
+
+			if i > 0 && s[i-1] == '~' {
+				return &Filter{
+					Type:  FilterApprox,
+					Attr:  strings.ToLower(s[:i-1]),
+					Value: value,
+				}, nil
+			}
+
+			if i > 0 && s[i-1] == '>' {
+				return &Filter{
+					Type:  FilterGreaterOrEqual,
+					Attr:  strings.ToLower(s[:i-1]),
+					Value: value,
+				}, nil
+			}
+
+			if i > 0 && s[i-1] == '<' {
+				return &Filter{
+					Type:  FilterLessOrEqual,
+					Attr:  strings.ToLower(s[:i-1]),
+					Value: value,
+				}, nil
+			}
+
+			if rawValue == "*" {
+				return &Filter{
+					Type: FilterPresent,
+					Attr: strings.ToLower(attr),
+				}, nil
+			}
+
+			if strings.Contains(rawValue, "*") {
+				return parseSubstringFilter(attr, rawValue)
+			}
+
+			return &Filter{
+				Type:  FilterEqual,
+				Attr:  strings.ToLower(attr),
+				Value: value,
+			}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("invalid filter item: %s", s)
+}
+
+// parseExtensibleFilter parses the attr[:dn][:rule] or [:dn]:rule part of an
+// extensible match filter.
+func parseExtensibleFilter(desc, value string) (*Filter, error) {
+	parts := strings.Split(desc, ":")
+
+	filter := &Filter{
+		Type:  FilterExtensible,
+		Attr:  strings.ToLower(parts[0]),
+		Value: value,
+	}
+
+	for _, part := range parts[1:] {
+		switch {
+		case strings.EqualFold(part, "dn") && !filter.DNAttributes && filter.MatchingRule == "":
+			filter.DNAttributes = true
+		case part != "" && filter.MatchingRule == "":
+			filter.MatchingRule = strings.ToLower(part)
+		default:
+			return nil, fmt.Errorf("invalid extensible match filter: %s:=", desc)
+		}
+	}
+
+	if filter.Attr == "" && filter.MatchingRule == "" {
+		return nil, fmt.Errorf("extensible match filter without attribute needs a matching rule: %s:=", desc)
+	}
+
+	return filter, nil
+}
+
+func parseSubstringFilter(attr, value string) (*Filter, error) {
+	filter := &Filter{
+		Type: FilterSubstring,
+		Attr: strings.ToLower(attr),
+	}
+
+	parts := strings.Split(value, "*")
+
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("invalid substring filter")
+	}
+
+	if parts[0] != "" {
+		filter.Initial = unescapeFilterValue(parts[0])
+	}
+
+	if len(parts) > 1 && parts[len(parts)-1] != "" {
+		filter.Final = unescapeFilterValue(parts[len(parts)-1])
+	}
+
+	for i := 1; i < len(parts)-1; i++ {
+		if parts[i] != "" {
+			filter.Any = append(filter.Any, unescapeFilterValue(parts[i]))
+		}
+	}
+
+	return filter, nil
+}
+
+// unescapeFilterValue decodes RFC 4515 \XX hex escapes. Backslashes not
+// followed by two hex digits are kept as is.
+func unescapeFilterValue(value string) string {
+	if !strings.Contains(value, "\\") {
+		return value
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+2 < len(value) && isHex(value[i+1]) && isHex(value[i+2]) {
+			b.WriteByte(unhex(value[i+1])<<4 | unhex(value[i+2]))
+			i += 2
+			continue
+		}
+		b.WriteByte(value[i])
+	}
+
+	return b.String()
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
+
+func MatchFilter(filter *Filter, attrs map[string]string) bool {
+	return MatchEntry(filter, "", attrs)
+}
+
+// MatchEntry is like MatchFilter for the entry dn; the attributes of its RDNs
+// are matched by extensible match filters with the dn flag.
+func MatchEntry(filter *Filter, dn string, attrs map[string]string) bool {
+	return AttributeSyntaxes(nil).MatchEntry(filter, dn, attrs)
+}
+
+// entryMatcher evaluates filters against one entry; an assertion on a
+// multi-valued attribute holds when it holds for any value. Attribute names in
+// attrs and syntaxes are lowercase. An entry with single-valued attributes is
+// read from single instead, whose names match case-insensitively, so that
+// MatchEntry does not copy the attributes on every call.
+type entryMatcher struct {
+	dn       string
+	attrs    map[string][]string
+	single   map[string]string
+	syntaxes AttributeSyntaxes
+}
+
+// anyValue reports whether match holds for a value of attr.
+func (m entryMatcher) anyValue(attr string, match func(value string) bool) bool {
+	if m.single != nil {
+		value, ok := m.singleValue(attr)
+		return ok && match(value)
+	}
+
+	for _, value := range m.attrs[attr] {
+		if match(value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m entryMatcher) singleValue(attr string) (string, bool) {
+	if value, ok := m.single[attr]; ok {
+		return value, true
+	}
+
+	for name, value := range m.single {
+		if strings.EqualFold(name, attr) {
+			return value, true
+		}
+	}
+
+	return "", false
+}
+
+func (m entryMatcher) has(attr string) bool {
+	if m.single != nil {
+		_, ok := m.singleValue(attr)
+		return ok
+	}
+
+	_, ok := m.attrs[attr]
+	return ok
+}
+
+// each reports whether match holds for a value of any attribute.
+func (m entryMatcher) each(match func(name, value string) bool) bool {
+	for name, value := range m.single {
+		if match(name, value) {
+			return true
+		}
+	}
+
+	for name, values := range m.attrs {
+		for _, value := range values {
+			if match(name, value) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (m entryMatcher) match(filter *Filter) bool {
+	switch filter.Type {
+	case FilterAnd:
+		for _, child := range filter.Children {
+			if !m.match(child) {
+				return false
+			}
+		}
+		return true
+
+	case FilterOr:
+		for _, child := range filter.Children {
+			if m.match(child) {
+				return true
+			}
+		}
+		return false
+
+	case FilterNot:
+		if len(filter.Children) == 0 {
+			return true
+		}
+		return !m.match(filter.Children[0])
+
+	case FilterExtensible:
+		return m.matchExtensible(filter)
+
+	case FilterEqual, FilterApprox:
+		return m.anyValue(filter.Attr, func(val string) bool {
+			return m.syntaxes.equal(filter.Attr, val, filter.Value)
+		})
+
+	case FilterGreaterOrEqual:
+		return m.anyValue(filter.Attr, func(val string) bool {
+			c, ok := m.syntaxes.compare(filter.Attr, val, filter.Value)
+			return ok && c >= 0
+		})
+
+	case FilterLessOrEqual:
+		return m.anyValue(filter.Attr, func(val string) bool {
+			c, ok := m.syntaxes.compare(filter.Attr, val, filter.Value)
+			return ok && c <= 0
+		})
+
+	case FilterPresent:
+		return m.has(filter.Attr)
+
+	case FilterSubstring:
+		match := matchSubstring
+		if m.syntaxes[filter.Attr] == SyntaxCaseExact {
+			match = matchSubstringExact
+		}
+		return m.anyValue(filter.Attr, func(val string) bool {
+			return match(val, filter.Initial, filter.Any, filter.Final)
+		})
+	}
+
+	return false
+}
+
+// compareValues orders two attribute values: numerically when both are
+// integers, otherwise as case-insensitive strings.
+func compareValues(a, b string) int {
+	x, err1 := strconv.ParseInt(strings.TrimSpace(a), 10, 64)
+	y, err2 := strconv.ParseInt(strings.TrimSpace(b), 10, 64)
+	if err1 == nil && err2 == nil {
+		return cmp.Compare(x, y)
+	}
+
+	return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+}
+
+// Matching rules with their own semantics; other rules, including unknown
+// OIDs, compare case-insensitively like equality.
+var extensibleMatchers = map[string]func(value, assertion string) bool{
+	"2.5.13.5":               caseExactMatch,
+	"caseexactmatch":         caseExactMatch,
+	"2.5.13.14":              integerMatch,
+	"integermatch":           integerMatch,
+	"1.2.840.113556.1.4.803": bitAndMatch,
+	"1.2.840.113556.1.4.804": bitOrMatch,
+}
+
+func (m entryMatcher) matchExtensible(filter *Filter) bool {
+	match := func(name, value string) bool {
+		return m.syntaxes.equal(strings.ToLower(name), value, filter.Value)
+	}
+	if rule := extensibleMatchers[filter.MatchingRule]; rule != nil {
+		match = func(_, value string) bool { return rule(value, filter.Value) }
+	} else if filter.MatchingRule != "" {
+		match = func(_, value string) bool { return strings.EqualFold(value, filter.Value) }
+	}
+
+	matchAttr := func(name, value string) bool {
+		return (filter.Attr == "" || strings.EqualFold(name, filter.Attr)) && match(name, value)
+	}
+
+	if m.each(matchAttr) {
+		return true
+	}
+
+	if filter.DNAttributes && m.dn != "" {
+		parsed, err := ldap.ParseDN(m.dn)
+		if err != nil {
+			return false
+		}
+
+		for _, rdn := range parsed.RDNs {
+			for _, attr := range rdn.Attributes {
+				if matchAttr(attr.Type, attr.Value) {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+func caseExactMatch(value, assertion string) bool {
+	return value == assertion
+}
+
+func integerMatch(value, assertion string) bool {
+	v, err1 := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	a, err2 := strconv.ParseInt(strings.TrimSpace(assertion), 10, 64)
+
+	return err1 == nil && err2 == nil && v == a
+}
+
+// bitAndMatch is LDAP_MATCHING_RULE_BIT_AND, used by Active Directory for
+// flags such as userAccountControl.
+func bitAndMatch(value, assertion string) bool {
+	v, err1 := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	a, err2 := strconv.ParseInt(strings.TrimSpace(assertion), 10, 64)
+
+	return err1 == nil && err2 == nil && v&a == a
+}
+
+// bitOrMatch is LDAP_MATCHING_RULE_BIT_OR.
+func bitOrMatch(value, assertion string) bool {
+	v, err1 := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	a, err2 := strconv.ParseInt(strings.TrimSpace(assertion), 10, 64)
+
+	return err1 == nil && err2 == nil && v&a != 0
+}
+
+func matchSubstring(value, initial string, any []string, final string) bool {
+	lowerAny := make([]string, len(any))
+	for i, part := range any {
+		lowerAny[i] = strings.ToLower(part)
+	}
+
+	return matchSubstringExact(strings.ToLower(value), strings.ToLower(initial), lowerAny, strings.ToLower(final))
+}
+
+func matchSubstringExact(value, initial string, any []string, final string) bool {
+	if initial != "" {
+		if !strings.HasPrefix(value, initial) {
+			return false
+		}
+		value = value[len(initial):]
+	}
+
+	if final != "" {
+		if !strings.HasSuffix(value, final) {
+			return false
+		}
+		value = value[:len(value)-len(final)]
+	}
+
+	for _, part := range any {
+		idx := strings.Index(value, part)
+		if idx == -1 {
+			return false
+		}
+		value = value[idx+len(part):]
+	}
+
+	return true
+}
@@ -0,0 +1,94 @@
+package ldapmock
+
+import "strings"
+
+// filterImplies reports whether every entry req selects is also selected by
+// rule, the test of the semantic filter_match mode. The proof decomposes both
+// filters, so it is sound but not complete: when implication cannot be shown,
+// the rule does not match.
+func filterImplies(req, rule *Filter) bool {
+	// Conditions that must hold for every branch.
+	if rule.Type == FilterAnd {
+		for _, child := range rule.Children {
+			if !filterImplies(req, child) {
+				return false
+			}
+		}
+		return true
+	}
+
+	if req.Type == FilterOr {
+		for _, child := range req.Children {
+			if !filterImplies(child, rule) {
+				return false
+			}
+		}
+		return true
+	}
+
+	// Conditions where one branch is enough.
+	if rule.Type == FilterOr {
+		for _, child := range rule.Children {
+			if filterImplies(req, child) {
+				return true
+			}
+		}
+	}
+
+	if req.Type == FilterAnd {
+		for _, child := range req.Children {
+			if filterImplies(child, rule) {
+				return true
+			}
+		}
+	}
+
+	return assertionImplies(req, rule)
+}
+
+// assertionImplies compares two filters that are not AND or OR.
+func assertionImplies(req, rule *Filter) bool {
+	if req.Type == FilterNot || rule.Type == FilterNot {
+		if req.Type != rule.Type || len(req.Children) == 0 || len(rule.Children) == 0 {
+			return false
+		}
+
+		// !a selects only entries !b selects when b selects only entries a does.
+		return filterImplies(rule.Children[0], req.Children[0])
+	}
+
+	if req.Type == FilterAnd || req.Type == FilterOr || rule.Type == FilterOr {
+		return false
+	}
+
+	if req.Type == FilterExtensible || rule.Type == FilterExtensible {
+		return req.Type == rule.Type && filtersMatch(rule, req)
+	}
+
+	if !strings.EqualFold(req.Attr, rule.Attr) {
+		return false
+	}
+
+	switch rule.Type {
+	case FilterPresent:
+		// Every assertion on an attribute needs a value of it.
+		return true
+
+	case FilterSubstring:
+		if req.Type == FilterEqual {
+			return matchSubstring(req.Value, rule.Initial, rule.Any, rule.Final)
+		}
+
+	case FilterGreaterOrEqual:
+		if req.Type == FilterEqual || req.Type == FilterGreaterOrEqual {
+			return compareValues(req.Value, rule.Value) >= 0
+		}
+
+	case FilterLessOrEqual:
+		if req.Type == FilterEqual || req.Type == FilterLessOrEqual {
+			return compareValues(req.Value, rule.Value) <= 0
+		}
+	}
+
+	return req.Type == rule.Type && filtersMatch(rule, req)
+}
@@ -0,0 +1,48 @@
+package ldapmock
+
+import "testing"
+
+func TestFilterImplies(t *testing.T) {
+	tests := []struct {
+		rule string
+		req  string
+		want bool
+	}{
+		{rule: "(cn=John)", req: "(cn=john)", want: true},
+		{rule: "(cn=John)", req: "(&(objectClass=person)(cn=John))", want: true},
+		{rule: "(cn=John)", req: "(&(objectClass=person)(&(mail=*)(cn=John)))", want: true},
+		{rule: "(cn=John)", req: "(|(cn=John)(cn=Jane))", want: false},
+		{rule: "(|(cn=John)(cn=Jane))", req: "(&(objectClass=person)(cn=Jane))", want: true},
+		{rule: "(|(cn=John)(cn=Jane))", req: "(|(cn=Jane)(cn=John))", want: true},
+		{rule: "(&(objectClass=person)(cn=John))", req: "(cn=John)", want: false},
+		{rule: "(&(objectClass=person)(cn=John))", req: "(&(cn=John)(&(objectClass=person)(mail=*)))", want: true},
+		{rule: "(cn=*)", req: "(&(cn=Jo*)(mail=x))", want: true},
+		{rule: "(mail=*)", req: "(cn=John)", want: false},
+		{rule: "(cn=Jo*)", req: "(cn=John)", want: true},
+		{rule: "(cn=Jo*)", req: "(cn=Jane)", want: false},
+		{rule: "(uidNumber>=1000)", req: "(uidNumber=1500)", want: true},
+		{rule: "(uidNumber>=1000)", req: "(uidNumber>=999)", want: false},
+		{rule: "(uidNumber<=1000)", req: "(&(uidNumber<=20)(uid=x))", want: true},
+		{rule: "(!(cn=John))", req: "(!(cn=*))", want: true},
+		{rule: "(!(cn=*))", req: "(!(cn=John))", want: false},
+		{rule: "(!(cn=John))", req: "(cn=Jane)", want: false},
+		{rule: "(memberOf:1.2.840.113556.1.4.1941:=cn=admins)", req: "(&(uid=x)(memberOf:1.2.840.113556.1.4.1941:=CN=Admins))", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rule+" "+tt.req, func(t *testing.T) {
+			rule, err := ParseFilter(tt.rule)
+			if err != nil {
+				t.Fatalf("parse rule: %v", err)
+			}
+			req, err := ParseFilter(tt.req)
+			if err != nil {
+				t.Fatalf("parse request: %v", err)
+			}
+
+			if got := filterImplies(req, rule); got != tt.want {
+				t.Errorf("filterImplies = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
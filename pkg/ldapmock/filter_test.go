@@ -1,6 +1,7 @@
-package main
+package ldapmock
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -326,6 +327,36 @@ func TestMatchFilter(t *testing.T) {
 			attrs:  map[string]string{"age": "25"},
 			want:   true,
 		},
+		{
+			name:   "greater or equal numeric",
+			filter: "(age>=9)",
+			attrs:  map[string]string{"age": "18"},
+			want:   true,
+		},
+		{
+			name:   "less or equal numeric",
+			filter: "(uidNumber<=1000)",
+			attrs:  map[string]string{"uidNumber": "999"},
+			want:   true,
+		},
+		{
+			name:   "less or equal negative",
+			filter: "(balance<=-5)",
+			attrs:  map[string]string{"balance": "-10"},
+			want:   true,
+		},
+		{
+			name:   "greater or equal string fallback",
+			filter: "(sn>=m)",
+			attrs:  map[string]string{"sn": "Smith"},
+			want:   true,
+		},
+		{
+			name:   "greater or equal mixed falls back to string",
+			filter: "(age>=9)",
+			attrs:  map[string]string{"age": "18 years"},
+			want:   false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -342,6 +373,97 @@ func TestMatchFilter(t *testing.T) {
 	}
 }
 
+func TestParseFilter_Extensible(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    Filter
+		wantErr bool
+	}{
+		{
+			name:  "attribute and rule",
+			input: "(memberOf:1.2.840.113556.1.4.1941:=CN=Admins,DC=example)",
+			want:  Filter{Type: FilterExtensible, Attr: "memberof", MatchingRule: "1.2.840.113556.1.4.1941", Value: "CN=Admins,DC=example"},
+		},
+		{
+			name:  "dn flag",
+			input: "(ou:dn:=People)",
+			want:  Filter{Type: FilterExtensible, Attr: "ou", DNAttributes: true, Value: "People"},
+		},
+		{
+			name:  "rule only",
+			input: "(:dn:caseExactMatch:=John)",
+			want:  Filter{Type: FilterExtensible, DNAttributes: true, MatchingRule: "caseexactmatch", Value: "John"},
+		},
+		{
+			name:    "no attribute and no rule",
+			input:   "(:dn:=John)",
+			wantErr: true,
+		},
+		{
+			name:    "two rules",
+			input:   "(cn:2.5.13.5:2.5.13.2:=John)",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := ParseFilter(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected error, got %+v", f)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(*f, tt.want) {
+				t.Errorf("filter = %+v, want %+v", *f, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchEntry_Extensible(t *testing.T) {
+	dn := "uid=john,ou=People,dc=example"
+	attrs := map[string]string{
+		"uid":                "John",
+		"memberOf":           "CN=Admins,DC=example",
+		"userAccountControl": "514",
+	}
+
+	tests := []struct {
+		filter string
+		want   bool
+	}{
+		{filter: "(memberOf:1.2.840.113556.1.4.1941:=cn=admins,dc=example)", want: true},
+		{filter: "(memberOf:1.2.840.113556.1.4.1941:=cn=users,dc=example)", want: false},
+		{filter: "(uid:caseExactMatch:=John)", want: true},
+		{filter: "(uid:2.5.13.5:=john)", want: false},
+		{filter: "(userAccountControl:1.2.840.113556.1.4.803:=2)", want: true},
+		{filter: "(userAccountControl:1.2.840.113556.1.4.803:=16)", want: false},
+		{filter: "(userAccountControl:1.2.840.113556.1.4.804:=6)", want: true},
+		{filter: "(ou:dn:=people)", want: true},
+		{filter: "(ou:=people)", want: false},
+		{filter: "(:dn:2.5.13.5:=People)", want: true},
+		{filter: "(!(ou:dn:=people))", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			f, err := ParseFilter(tt.filter)
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			if got := MatchEntry(f, dn, attrs); got != tt.want {
+				t.Errorf("MatchEntry = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestMatchSubstring(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -407,3 +529,132 @@ func TestMatchSubstring(t *testing.T) {
 		})
 	}
 }
+
+func TestParseFilter_Escapes(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		wantType  FilterType
+		wantValue string
+		wantFinal string
+	}{
+		{
+			name:      "escaped parentheses",
+			input:     `(cn=John \28Admin\29)`,
+			wantType:  FilterEqual,
+			wantValue: "John (Admin)",
+		},
+		{
+			name:      "escaped asterisk is not a wildcard",
+			input:     `(cn=a\2ab)`,
+			wantType:  FilterEqual,
+			wantValue: "a*b",
+		},
+		{
+			name:      "escaped utf-8",
+			input:     `(cn=Jos\c3\a9)`,
+			wantType:  FilterEqual,
+			wantValue: "José",
+		},
+		{
+			name:      "dn escapes are kept",
+			input:     `(member=CN=Doe\, John,DC=com)`,
+			wantType:  FilterEqual,
+			wantValue: `CN=Doe\, John,DC=com`,
+		},
+		{
+			name:      "escaped substring part",
+			input:     `(cn=*\28x\29)`,
+			wantType:  FilterSubstring,
+			wantFinal: "(x)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := ParseFilter(tt.input)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if f.Type != tt.wantType {
+				t.Errorf("type = %v, want %v", f.Type, tt.wantType)
+			}
+			if f.Value != tt.wantValue {
+				t.Errorf("value = %q, want %q", f.Value, tt.wantValue)
+			}
+			if f.Final != tt.wantFinal {
+				t.Errorf("final = %q, want %q", f.Final, tt.wantFinal)
+			}
+		})
+	}
+}
+
+func TestFilter_String(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{input: "(UID=John)", want: "(uid=John)"},
+		{input: "(cn=John \\28Admin\\29)", want: "(cn=John \\28Admin\\29)"},
+		{input: "(mail=*)", want: "(mail=*)"},
+		{input: "(cn=jo*h*n)", want: "(cn=jo*h*n)"},
+		{input: "(cn=*doe)", want: "(cn=*doe)"},
+		{input: "(age>=18)", want: "(age>=18)"},
+		{input: "(age<=65)", want: "(age<=65)"},
+		{input: "(cn~=jon)", want: "(cn~=jon)"},
+		{input: "(OU:DN:caseIgnoreMatch:=Sales)", want: "(ou:dn:caseignorematch:=Sales)"},
+		{input: "(&(objectClass=person)(|(uid=a)(!(uid=b))))", want: "(&(objectclass=person)(|(uid=a)(!(uid=b))))"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			f, err := ParseFilter(tt.input)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := f.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+
+			again, err := ParseFilter(f.String())
+			if err != nil || !reflect.DeepEqual(again, f) {
+				t.Errorf("String() does not parse back: %+v, %v", again, err)
+			}
+		})
+	}
+}
+
+const benchmarkFilter = "(&(objectClass=person)(|(sAMAccountName=john*)(mail=*@example.com))(!(userAccountControl:1.2.840.113556.1.4.803:=2)))"
+
+func BenchmarkParseFilter(b *testing.B) {
+	b.ReportAllocs()
+
+	for b.Loop() {
+		if _, err := ParseFilter(benchmarkFilter); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMatchFilter(b *testing.B) {
+	f, err := ParseFilter(benchmarkFilter)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	attrs := map[string]string{
+		"objectClass":        "person",
+		"sAMAccountName":     "john.doe",
+		"mail":               "john.doe@example.com",
+		"userAccountControl": "512",
+		"displayName":        "John Doe",
+	}
+
+	b.ReportAllocs()
+
+	for b.Loop() {
+		if !MatchFilter(f, attrs) {
+			b.Fatal("filter does not match")
+		}
+	}
+}
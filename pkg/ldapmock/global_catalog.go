@@ -0,0 +1,132 @@
+package ldapmock
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+)
+
+// globalCatalogReadOnlyMessage is the diagnostic message of writes sent to a
+// global catalog listener.
+const globalCatalogReadOnlyMessage = "the global catalog is read-only"
+
+// DefaultGlobalCatalogAttributes is the partial attribute set global catalog
+// searches return when none is configured: the attributes Active Directory
+// replicates to the global catalog that clients commonly look up.
+var DefaultGlobalCatalogAttributes = []string{
+	"cn", "description", "displayName", "distinguishedName", "givenName", "mail", "member", "memberOf",
+	"name", "objectCategory", "objectClass", "objectGUID", "objectSid", "proxyAddresses", "sAMAccountName",
+	"sAMAccountType", "sn", "telephoneNumber", "uid", "userPrincipalName",
+}
+
+// GlobalCatalogConfig shapes what global catalog listeners (see
+// ServeGlobalCatalog) return.
+type GlobalCatalogConfig struct {
+	// Attributes is the partial attribute set: the only attributes returned,
+	// ignoring case. Empty is DefaultGlobalCatalogAttributes.
+	Attributes []string `json:"attributes"`
+}
+
+// SetGlobalCatalog replaces the global catalog settings. It can be called
+// while serving.
+func (s *LDAPServer) SetGlobalCatalog(cfg GlobalCatalogConfig) error {
+	if slices.Contains(cfg.Attributes, "") {
+		return errors.New("invalid global catalog attribute: empty name")
+	}
+
+	cfg.Attributes = slices.Clone(cfg.Attributes)
+
+	s.globalCatalogMu.Lock()
+	defer s.globalCatalogMu.Unlock()
+
+	s.globalCatalog = cfg
+
+	return nil
+}
+
+// GlobalCatalog returns the current global catalog settings.
+func (s *LDAPServer) GlobalCatalog() GlobalCatalogConfig {
+	s.globalCatalogMu.RLock()
+	defer s.globalCatalogMu.RUnlock()
+
+	return GlobalCatalogConfig{Attributes: slices.Clone(s.globalCatalog.Attributes)}
+}
+
+// ServeGlobalCatalog is like Serve for a global catalog port, such as 3268:
+// searches that no rule answers see the users and groups of the top-level
+// directory and of every tenant, only the partial attribute set is returned
+// (see SetGlobalCatalog) and writes are refused with unwillingToPerform(53).
+func (s *LDAPServer) ServeGlobalCatalog(ctx context.Context, lis net.Listener) error {
+	return s.serve(ctx, lis, true)
+}
+
+// isGlobalCatalog reports whether the request of ctx arrived on a global
+// catalog listener.
+func isGlobalCatalog(ctx context.Context) bool {
+	conn, ok := ConnInfoFromContext(ctx)
+
+	return ok && conn.GlobalCatalog
+}
+
+// globalDirectory returns the entries of the top-level directory and of
+// every tenant of mock, indexed.
+func globalDirectory(mock LDAPMock) *directoryIndex {
+	users, groups := slices.Clone(mock.Users), slices.Clone(mock.Groups)
+	for _, tenant := range mock.Tenants {
+		users = append(users, tenant.Users...)
+		groups = append(groups, tenant.Groups...)
+	}
+
+	return newDirectoryIndex(users, groups)
+}
+
+// globalCatalogMiddleware cuts the results of global catalog searches to the
+// partial attribute set.
+func (s *LDAPServer) globalCatalogMiddleware(next SearchFunc) SearchFunc {
+	return func(ctx context.Context, req SearchRequest) (SearchResult, error) {
+		result, err := next(ctx, req)
+		if !isGlobalCatalog(ctx) {
+			return result, err
+		}
+
+		attributes := s.GlobalCatalog().Attributes
+		if len(attributes) == 0 {
+			attributes = DefaultGlobalCatalogAttributes
+		}
+
+		return result.partial(attributes), err
+	}
+}
+
+// partial returns a copy of r whose entries only have the given attributes.
+func (r SearchResult) partial(attributes []string) SearchResult {
+	var users []User
+	for _, user := range r.Users {
+		users = append(users, User{CN: user.CN, Attrs: selectAttributes(user.Attrs, attributes), ExpiresIn: user.ExpiresIn})
+	}
+
+	var groups []Group
+	for _, group := range r.Groups {
+		partial := Group{CN: group.CN, Attrs: selectAttributes(group.Attrs, attributes)}
+		if attributeRequested(attributes, "member") {
+			partial.Members = group.Members
+		}
+		groups = append(groups, partial)
+	}
+
+	var entries []Entry
+	for _, entry := range r.Entries {
+		attrs := make(map[string][]string, len(entry.Attrs))
+		for name, values := range entry.Attrs {
+			if attributeRequested(attributes, name) {
+				attrs[name] = values
+			}
+		}
+		entries = append(entries, Entry{DN: entry.DN, Attrs: attrs})
+	}
+
+	r.Users, r.Groups, r.Entries = users, groups, entries
+
+	return r
+}
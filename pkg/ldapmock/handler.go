@@ -0,0 +1,385 @@
+package ldapmock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"slices"
+	"strings"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"go.uber.org/zap"
+)
+
+// Handler computes responses to LDAP operations. LDAPServer itself is the
+// default Handler (credential check and rule engine); custom handlers can
+// embed *LDAPServer to override only some operations:
+//
+//	type handler struct{ *ldapmock.LDAPServer }
+//
+//	func (h handler) OnSearch(ctx context.Context, req ldapmock.SearchRequest) (ldapmock.SearchResult, error) {
+//		if req.BaseDN == "ou=dynamic" {
+//			return ldapmock.SearchResult{Users: generate(req)}, nil
+//		}
+//		return h.LDAPServer.OnSearch(ctx, req)
+//	}
+//
+//	srv.SetHandler(handler{srv})
+//
+// Errors of type *ldap.Error are returned to the client with their result
+// code, any other error is returned as other(80).
+type Handler interface {
+	OnBind(ctx context.Context, req BindRequest) error
+	OnSearch(ctx context.Context, req SearchRequest) (SearchResult, error)
+}
+
+type BindRequest struct {
+	DN       string
+	Password string
+	// Mechanism and Credentials are set for SASL binds, which the server
+	// answers itself (see SetSPNEGO) instead of calling OnBind.
+	Mechanism   string
+	Credentials []byte
+	// Controls are the controls the client attached to the request.
+	Controls []RequestControl
+}
+
+// SearchResult is returned to the client as the Users, then the Groups, then
+// the Entries.
+type SearchResult struct {
+	Users       []User
+	Groups      []Group
+	Entries     []Entry
+	MatchedRule *Rule
+	// Upstream reports that the result was relayed from the upstream server.
+	Upstream bool
+	// ShadowDiff compares the result with the upstream answer in shadow
+	// mode (see LDAPServer.SetShadow).
+	ShadowDiff *ShadowDiff
+	// controls are sent with the search result done message.
+	controls []*ber.Packet
+	// syncStates are the sync states of Entries, by DN, after an incremental
+	// content synchronization refresh (see syncMiddleware); nil after a full
+	// one, where every entry is added.
+	syncStates map[string]ldap.ControlSyncStateState
+}
+
+// Entry is a directory entry with multi-valued attributes, such as one relayed
+// from the upstream server.
+type Entry struct {
+	DN    string              `json:"dn"`
+	Attrs map[string][]string `json:"attributes"`
+}
+
+// entries yields the users, groups and entries of r, in that order, converting
+// each one only when it is reached.
+func (r SearchResult) entries() iter.Seq[Entry] {
+	return func(yield func(Entry) bool) {
+		for _, user := range r.Users {
+			attrs := make(map[string][]string, len(user.Attrs))
+			for k, v := range user.Attrs {
+				attrs[k] = []string{v}
+			}
+
+			if !yield(Entry{DN: user.CN, Attrs: attrs}) {
+				return
+			}
+		}
+
+		for _, group := range r.Groups {
+			attrs := make(map[string][]string, len(group.Attrs)+1)
+			for k, v := range group.Attrs {
+				attrs[k] = []string{v}
+			}
+			if len(group.Members) > 0 {
+				attrs["member"] = group.Members
+			}
+
+			if !yield(Entry{DN: group.CN, Attrs: attrs}) {
+				return
+			}
+		}
+
+		for _, entry := range r.Entries {
+			if !yield(entry) {
+				return
+			}
+		}
+	}
+}
+
+// SetHandler replaces the handler for LDAP operations; nil restores the
+// default.
+func (s *LDAPServer) SetHandler(h Handler) {
+	s.handlerMu.Lock()
+	defer s.handlerMu.Unlock()
+
+	s.handler = h
+}
+
+func (s *LDAPServer) currentHandler() Handler {
+	s.handlerMu.RLock()
+	defer s.handlerMu.RUnlock()
+
+	if s.handler == nil {
+		return s
+	}
+
+	return s.handler
+}
+
+// OnBind accepts the configured username and password.
+func (s *LDAPServer) OnBind(ctx context.Context, req BindRequest) error {
+	username, password := s.credentials()
+	if req.DN == username && req.Password == password {
+		s.logger(ctx).Info("binded")
+
+		return nil
+	}
+
+	s.logger(ctx).Info("bind: invalid creds")
+
+	return ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("invalid credentials"))
+}
+
+// OnSearch answers from the first matching rule, after its delay and latency;
+// passthrough rules are answered by the upstream server. Root DSE searches are
+// answered from the root DSE of the mock, when it has one. Other searches wait
+// for the mock latency, then are forwarded to the upstream server when one is
+// set (see SetUpstream), or answered from the mock users filtered by the
+// request filter; a filter the mock cannot parse fails with filterError (87).
+func (s *LDAPServer) OnSearch(ctx context.Context, req SearchRequest) (SearchResult, error) {
+	mock, compiled, activated := s.currentMock(ctx)
+	directory := compiled.forBase(mock, req.BaseDN)
+	if isGlobalCatalog(ctx) {
+		directory.entries = compiled.global()
+	}
+
+	if rule := s.findMatchingRule(directory.matching, req); rule != nil {
+		s.logger(ctx).Info("rule matched", zap.String("rule", rule.Name))
+
+		latency := rule.Latency
+		if latency == nil {
+			latency = mock.Latency
+		}
+
+		if err := sleep(ctx, time.Duration(rule.Delay)+latency.sample()); err != nil {
+			return SearchResult{MatchedRule: rule}, err
+		}
+
+		result, err := s.ruleResult(ctx, rule, req, activated)
+		if err != nil {
+			return result, err
+		}
+
+		if result.Users, result.Groups, err = computeEntries(compiled.computed, result.Users, result.Groups); err != nil {
+			return SearchResult{MatchedRule: rule}, ldap.NewError(ldap.LDAPResultOther,
+				fmt.Errorf("response of rule %s: %w", ruleLabel(rule), err))
+		}
+
+		return result.limit(rule.Response.MaxEntries)
+	}
+
+	if result, ok := rootDSEResult(mock, req); ok {
+		return result, nil
+	}
+
+	if err := sleep(ctx, mock.Latency.sample()); err != nil {
+		return SearchResult{}, err
+	}
+
+	if upstream := s.Upstream(); upstream != nil {
+		entries, err := upstream.Search(ctx, req)
+
+		return SearchResult{Entries: entries, Upstream: true}, err
+	}
+
+	users, groups, err := directory.entries.filter(req.Filter, mock.Attributes)
+	if err != nil {
+		s.logger(ctx).Warn("invalid search filter", zap.String("filter", req.Filter), zap.Error(err))
+
+		return SearchResult{}, ldap.NewError(ldap.LDAPResultFilterError, fmt.Errorf("invalid filter %s: %w", req.Filter, err))
+	}
+
+	return fallbackResult(req, liveUsers(users, activated, s.clock.now()), groups, compiled.computed)
+}
+
+// ruleResult answers a search matched by rule from its script, its WASM
+// module, the upstream server or its response.
+func (s *LDAPServer) ruleResult(ctx context.Context, rule *Rule, req SearchRequest, activated time.Time) (SearchResult, error) {
+	if rule.Script != "" {
+		return s.runScript(ctx, rule, req)
+	}
+	if rule.WASM != "" {
+		return s.runWASM(ctx, rule, req)
+	}
+
+	if !rule.Passthrough {
+		users := liveUsers(rule.Response.Users, activated, s.clock.now())
+		if !rule.Template {
+			return SearchResult{Users: users, Groups: rule.Response.Groups, MatchedRule: rule}, nil
+		}
+
+		users, groups, err := renderResponse(users, rule.Response.Groups, newTemplateData(req, s.clock.now()))
+		if err != nil {
+			return SearchResult{MatchedRule: rule}, ldap.NewError(ldap.LDAPResultOther,
+				fmt.Errorf("response of rule %s: %w", ruleLabel(rule), err))
+		}
+
+		return SearchResult{Users: users, Groups: groups, MatchedRule: rule}, nil
+	}
+
+	upstream := s.Upstream()
+	if upstream == nil {
+		return SearchResult{MatchedRule: rule}, ldap.NewError(ldap.LDAPResultUnavailable,
+			fmt.Errorf("rule %s passes through, but no upstream is configured", ruleLabel(rule)))
+	}
+
+	entries, err := upstream.Search(ctx, req)
+
+	return SearchResult{Entries: entries, MatchedRule: rule, Upstream: true}, err
+}
+
+// limit cuts r, answered by its MatchedRule, to its first maxEntries entries:
+// users first, then groups, then entries, with sizeLimitExceeded(4) when it
+// had more. A maxEntries of zero or less keeps r whole.
+func (r SearchResult) limit(maxEntries int) (SearchResult, error) {
+	total := len(r.Users) + len(r.Groups) + len(r.Entries)
+	if maxEntries <= 0 || total <= maxEntries {
+		return r, nil
+	}
+
+	return r.window(0, maxEntries), ldap.NewError(ldap.LDAPResultSizeLimitExceeded,
+		fmt.Errorf("rule %s returns at most %d of %d entries", ruleLabel(r.MatchedRule), maxEntries, total))
+}
+
+// window returns r with only its entries from offset, counting users, then
+// groups, then entries, up to size of them.
+func (r SearchResult) window(offset, size int) SearchResult {
+	skip, left := offset, size
+	cut := func(n int) (int, int) {
+		from := min(n, skip)
+		skip -= from
+		to := from + min(n-from, left)
+		left -= to - from
+		return from, to
+	}
+
+	from, to := cut(len(r.Users))
+	r.Users = r.Users[from:to]
+	from, to = cut(len(r.Groups))
+	r.Groups = r.Groups[from:to]
+	from, to = cut(len(r.Entries))
+	r.Entries = r.Entries[from:to]
+
+	return r
+}
+
+// liveUsers drops the users whose ExpiresIn has passed at now, for a mock set
+// at activated. users is returned as is when none expires.
+func liveUsers(users []User, activated, now time.Time) []User {
+	if !slices.ContainsFunc(users, func(user User) bool { return user.ExpiresIn > 0 }) {
+		return users
+	}
+
+	live := make([]User, 0, len(users))
+	for _, user := range users {
+		if user.ExpiresIn <= 0 || now.Before(activated.Add(time.Duration(user.ExpiresIn))) {
+			live = append(live, user)
+		}
+	}
+
+	return live
+}
+
+// fallbackResult returns the entries matching no rule with their computed
+// attributes and the attributes req asked for, cut to its size limit. Cut
+// results come with sizeLimitExceeded(4), which still returns the entries.
+func fallbackResult(req SearchRequest, users []User, groups []Group, computed []computedAttribute) (SearchResult, error) {
+	var err error
+	if limit := int(req.SizeLimit); limit > 0 && len(users)+len(groups) > limit {
+		if len(users) >= limit {
+			users, groups = users[:limit], nil
+		} else {
+			groups = groups[:limit-len(users)]
+		}
+
+		err = ldap.NewError(ldap.LDAPResultSizeLimitExceeded, fmt.Errorf("size limit %d exceeded", limit))
+	}
+
+	users, groups, computeErr := computeEntries(computed, users, groups)
+	if computeErr != nil {
+		return SearchResult{}, ldap.NewError(ldap.LDAPResultOther, computeErr)
+	}
+
+	result := SearchResult{
+		Users:  make([]User, 0, len(users)),
+		Groups: make([]Group, 0, len(groups)),
+	}
+	for _, user := range users {
+		result.Users = append(result.Users, User{CN: user.CN, Attrs: selectAttributes(user.Attrs, req.Attributes)})
+	}
+	for _, group := range groups {
+		selected := Group{CN: group.CN, Attrs: selectAttributes(group.Attrs, req.Attributes)}
+		if attributeRequested(req.Attributes, "member") {
+			selected.Members = group.Members
+		}
+
+		result.Groups = append(result.Groups, selected)
+	}
+
+	return result, err
+}
+
+// selectAttributes returns the attributes of attrs named in requested.
+func selectAttributes(attrs map[string]string, requested []string) map[string]string {
+	if len(requested) == 0 || slices.Contains(requested, "*") {
+		return attrs
+	}
+
+	selected := make(map[string]string, len(requested))
+	for name, value := range attrs {
+		if attributeRequested(requested, name) {
+			selected[name] = value
+		}
+	}
+
+	return selected
+}
+
+// attributeRequested reports whether a search for requested returns the
+// attribute name: an empty list and "*" ask for all user attributes, "1.1"
+// for none.
+func attributeRequested(requested []string, name string) bool {
+	if len(requested) == 0 {
+		return true
+	}
+
+	for _, attr := range requested {
+		if attr == "*" || strings.EqualFold(attr, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sleep waits for d, or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
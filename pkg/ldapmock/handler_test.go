@@ -0,0 +1,292 @@
+package ldapmock
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"go.uber.org/zap"
+)
+
+func TestLDAPServer_OnSearch_InvalidFilter(t *testing.T) {
+	srv := NewLDAPServer(zap.NewNop(), "0", "", "", nil)
+	srv.SetMock(LDAPMock{
+		Users: []User{{CN: "uid=john,dc=example"}},
+		Rules: []Rule{{Filter: "(uid=jane)", Response: Response{Users: []User{{CN: "uid=jane,dc=example"}}}}},
+	})
+
+	result, err := srv.OnSearch(context.Background(), SearchRequest{Filter: "(uid=john", Scope: ScopeSub})
+	if !ldap.IsErrorWithCode(err, ldap.LDAPResultFilterError) {
+		t.Fatalf("error = %v, want filterError", err)
+	}
+	if len(result.Users) != 0 {
+		t.Errorf("users = %v, want none", result.Users)
+	}
+}
+
+func TestLDAPServer_SetMock_Isolated(t *testing.T) {
+	srv := NewLDAPServer(zap.NewNop(), "0", "", "", nil)
+
+	mock := LDAPMock{Users: []User{{CN: "uid=john,dc=example", Attrs: map[string]string{"uid": "john"}}}}
+	srv.SetMock(mock)
+
+	// Neither the mock passed in nor the one returned share state with the
+	// server.
+	mock.Users[0].Attrs["uid"] = "jane"
+	got := srv.GetMock()
+	got.Users[0].CN = "uid=jane,dc=example"
+
+	result, err := srv.OnSearch(context.Background(), SearchRequest{Filter: "(uid=john)", Scope: ScopeSub})
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if len(result.Users) != 1 || result.Users[0].CN != "uid=john,dc=example" {
+		t.Errorf("users = %v, want uid=john,dc=example", result.Users)
+	}
+}
+
+func TestLDAPServer_SetMock_ConcurrentSearch(t *testing.T) {
+	srv := NewLDAPServer(zap.NewNop(), "0", "", "", nil)
+	mocks := []LDAPMock{
+		{Users: []User{{CN: "uid=a,dc=example", Attrs: map[string]string{"uid": "a"}}, {CN: "uid=b,dc=example", Attrs: map[string]string{"uid": "b"}}}},
+		{Users: []User{{CN: "uid=c,dc=example", Attrs: map[string]string{"uid": "c"}}, {CN: "uid=d,dc=example", Attrs: map[string]string{"uid": "d"}}}},
+	}
+	srv.SetMock(mocks[0])
+
+	second := map[string]string{"uid=a,dc=example": "uid=b,dc=example", "uid=c,dc=example": "uid=d,dc=example"}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := range 200 {
+			srv.SetMock(mocks[i%2])
+		}
+	}()
+
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+
+		// Every search sees all the users of one mock, never a mix.
+		result, err := srv.OnSearch(context.Background(), SearchRequest{Filter: "(uid=*)", Scope: ScopeSub})
+		if err != nil {
+			t.Fatalf("search: %v", err)
+		}
+		if len(result.Users) != 2 || second[result.Users[0].CN] != result.Users[1].CN {
+			t.Fatalf("users = %v, want the users of one mock", result.Users)
+		}
+	}
+}
+
+func TestLDAPServer_MockSnapshot(t *testing.T) {
+	srv := NewLDAPServer(zap.NewNop(), "0", "", "", nil)
+	srv.SetMock(LDAPMock{Users: []User{{CN: "uid=old,dc=example", Attrs: map[string]string{"uid": "old"}}}})
+
+	ctx := srv.withMockSnapshot(context.Background())
+	srv.SetMock(LDAPMock{Users: []User{{CN: "uid=new,dc=example", Attrs: map[string]string{"uid": "new"}}}})
+
+	if version, ok := MockVersionFromContext(ctx); !ok || version != 1 || srv.MockVersion() != 2 {
+		t.Errorf("pinned version = %d, %v; current version = %d", version, ok, srv.MockVersion())
+	}
+	if again := srv.withMockSnapshot(ctx); again != ctx {
+		t.Error("the pinned mock was replaced")
+	}
+
+	result, err := srv.OnSearch(ctx, SearchRequest{Filter: "(uid=*)", Scope: ScopeSub})
+	if err != nil || len(result.Users) != 1 || result.Users[0].CN != "uid=old,dc=example" {
+		t.Errorf("search of the pinned mock = %v, %v, want uid=old", result.Users, err)
+	}
+
+	result, err = srv.OnSearch(context.Background(), SearchRequest{Filter: "(uid=*)", Scope: ScopeSub})
+	if err != nil || len(result.Users) != 1 || result.Users[0].CN != "uid=new,dc=example" {
+		t.Errorf("search of the current mock = %v, %v, want uid=new", result.Users, err)
+	}
+}
+
+func TestLDAPServer_OnSearch_Latency(t *testing.T) {
+	srv := NewLDAPServer(zap.NewNop(), "0", "", "", nil)
+	srv.SetMock(LDAPMock{
+		Users:   []User{{CN: "uid=john,dc=example", Attrs: map[string]string{"uid": "john"}}},
+		Latency: &Latency{P50: Duration(50 * time.Millisecond)},
+		Rules: []Rule{
+			{Filter: "(uid=jane)", Latency: &Latency{P50: Duration(100 * time.Millisecond)}},
+			{Filter: "(uid=joe)"},
+		},
+	})
+
+	tests := []struct {
+		filter string
+		want   time.Duration
+	}{
+		{"(uid=john)", 50 * time.Millisecond},  // fallback: mock latency
+		{"(uid=jane)", 100 * time.Millisecond}, // rule latency
+		{"(uid=joe)", 50 * time.Millisecond},   // rule without latency: mock latency
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			start := time.Now()
+			if _, err := srv.OnSearch(context.Background(), SearchRequest{Filter: tt.filter, Scope: ScopeSub}); err != nil {
+				t.Fatalf("search: %v", err)
+			}
+			if elapsed := time.Since(start); elapsed < tt.want {
+				t.Errorf("search took %v, want at least %v", elapsed, tt.want)
+			}
+		})
+	}
+}
+
+func TestLDAPServer_OnSearch_ExpiresIn(t *testing.T) {
+	srv := NewLDAPServer(zap.NewNop(), "0", "", "", nil)
+	srv.SetMock(LDAPMock{
+		Users: []User{
+			{CN: "uid=john,dc=example", Attrs: map[string]string{"uid": "john"}},
+			{CN: "uid=temp,dc=example", Attrs: map[string]string{"uid": "temp"}, ExpiresIn: Duration(100 * time.Millisecond)},
+		},
+		Rules: []Rule{{
+			Filter: "(uid=cached)",
+			Response: Response{Users: []User{
+				{CN: "uid=cached,dc=example", ExpiresIn: Duration(100 * time.Millisecond)},
+			}},
+		}},
+	})
+
+	count := func(filter string) int {
+		t.Helper()
+
+		result, err := srv.OnSearch(context.Background(), SearchRequest{Filter: filter, Scope: ScopeSub})
+		if err != nil {
+			t.Fatalf("search %s: %v", filter, err)
+		}
+
+		return len(result.Users)
+	}
+
+	if got := count("(uid=*)"); got != 2 {
+		t.Errorf("fallback users before expiry = %d, want 2", got)
+	}
+	if got := count("(uid=cached)"); got != 1 {
+		t.Errorf("rule users before expiry = %d, want 1", got)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+
+	if got := count("(uid=*)"); got != 1 {
+		t.Errorf("fallback users after expiry = %d, want 1", got)
+	}
+	if got := count("(uid=cached)"); got != 0 {
+		t.Errorf("rule users after expiry = %d, want 0", got)
+	}
+}
+
+func TestFallbackResult(t *testing.T) {
+	users := []User{
+		{CN: "uid=john,dc=example", Attrs: map[string]string{"mail": "john@example", "uid": "john"}},
+		{CN: "uid=jane,dc=example", Attrs: map[string]string{"mail": "jane@example", "uid": "jane"}},
+	}
+	groups := []Group{
+		{CN: "cn=admins,dc=example", Members: []string{"uid=john,dc=example"}, Attrs: map[string]string{"description": "admins"}},
+	}
+
+	tests := []struct {
+		name       string
+		req        SearchRequest
+		wantUsers  []User
+		wantGroups []Group
+		wantCode   uint16
+	}{
+		{
+			name:       "all attributes",
+			req:        SearchRequest{},
+			wantUsers:  users,
+			wantGroups: groups,
+		},
+		{
+			name: "requested attributes",
+			req:  SearchRequest{Attributes: []string{"MAIL", "member"}},
+			wantUsers: []User{
+				{CN: "uid=john,dc=example", Attrs: map[string]string{"mail": "john@example"}},
+				{CN: "uid=jane,dc=example", Attrs: map[string]string{"mail": "jane@example"}},
+			},
+			wantGroups: []Group{{CN: "cn=admins,dc=example", Members: []string{"uid=john,dc=example"}, Attrs: map[string]string{}}},
+		},
+		{
+			name: "no attributes",
+			req:  SearchRequest{Attributes: []string{"1.1"}},
+			wantUsers: []User{
+				{CN: "uid=john,dc=example", Attrs: map[string]string{}},
+				{CN: "uid=jane,dc=example", Attrs: map[string]string{}},
+			},
+			wantGroups: []Group{{CN: "cn=admins,dc=example", Attrs: map[string]string{}}},
+		},
+		{
+			name:       "size limit",
+			req:        SearchRequest{SizeLimit: 1},
+			wantUsers:  users[:1],
+			wantGroups: []Group{},
+			wantCode:   ldap.LDAPResultSizeLimitExceeded,
+		},
+		{
+			name:       "size limit within groups",
+			req:        SearchRequest{SizeLimit: 3},
+			wantUsers:  users,
+			wantGroups: groups,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := fallbackResult(tt.req, users, groups, nil)
+			if code := resultCode(err); code != tt.wantCode {
+				t.Fatalf("result code = %d, want %d", code, tt.wantCode)
+			}
+			if !reflect.DeepEqual(result.Users, tt.wantUsers) {
+				t.Errorf("users = %+v, want %+v", result.Users, tt.wantUsers)
+			}
+			if !reflect.DeepEqual(result.Groups, tt.wantGroups) {
+				t.Errorf("groups = %+v, want %+v", result.Groups, tt.wantGroups)
+			}
+		})
+	}
+}
+
+func TestLDAPServer_OnSearch_MaxEntries(t *testing.T) {
+	srv := NewLDAPServer(zap.NewNop(), "0", "", "", nil)
+	srv.SetMock(LDAPMock{Rules: []Rule{
+		{
+			ID:     "capped",
+			Filter: "(objectClass=*)",
+			Response: Response{
+				Users:      []User{{CN: "uid=john,dc=example"}, {CN: "uid=jane,dc=example"}},
+				Groups:     []Group{{CN: "cn=admins,dc=example"}, {CN: "cn=users,dc=example"}},
+				MaxEntries: 3,
+			},
+		},
+		{
+			ID:       "within",
+			Filter:   "(uid=john)",
+			Response: Response{Users: []User{{CN: "uid=john,dc=example"}}, MaxEntries: 1},
+		},
+	}})
+
+	result, err := srv.OnSearch(context.Background(), SearchRequest{Filter: "(objectClass=*)", Scope: ScopeSub})
+	if !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		t.Fatalf("error = %v, want sizeLimitExceeded", err)
+	}
+	if len(result.Users) != 2 || len(result.Groups) != 1 || result.Groups[0].CN != "cn=admins,dc=example" {
+		t.Errorf("result = %+v, want both users and the first group", result)
+	}
+	if result.MatchedRule == nil || result.MatchedRule.ID != "capped" {
+		t.Errorf("matched rule = %+v, want capped", result.MatchedRule)
+	}
+
+	result, err = srv.OnSearch(context.Background(), SearchRequest{Filter: "(uid=john)", Scope: ScopeSub})
+	if err != nil || len(result.Users) != 1 {
+		t.Errorf("search within the limit: result %+v, err %v", result, err)
+	}
+}
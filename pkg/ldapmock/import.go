@@ -0,0 +1,138 @@
+package ldapmock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// ImportRequest selects the entries of a real directory that POST /import
+// turns into mock users and groups.
+type ImportRequest struct {
+	// URL is the ldap://, ldaps:// or ldapi:// URL of the directory.
+	URL      string `json:"url"`
+	BindDN   string `json:"bind_dn"`
+	Password string `json:"password"`
+	BaseDN   string `json:"base_dn"`
+	// Filter defaults to (objectClass=*).
+	Filter string `json:"filter"`
+	// SizeLimit caps the number of entries; zero leaves it to the server.
+	SizeLimit int `json:"size_limit"`
+}
+
+func (r *ImportRequest) validate() error {
+	u, err := url.Parse(r.URL)
+	if err != nil || (u.Scheme != "ldap" && u.Scheme != "ldaps" && u.Scheme != "ldapi") {
+		return fmt.Errorf("invalid import URL %q: must be ldap://, ldaps:// or ldapi://", r.URL)
+	}
+
+	if r.BaseDN == "" {
+		return errors.New("invalid import: base_dn is required")
+	}
+
+	if r.SizeLimit < 0 {
+		return fmt.Errorf("invalid import size limit %d: must not be negative", r.SizeLimit)
+	}
+
+	if r.Filter == "" {
+		r.Filter = "(objectClass=*)"
+	}
+	if _, err := ldap.CompileFilter(r.Filter); err != nil {
+		return fmt.Errorf("invalid import filter %s: %w", r.Filter, err)
+	}
+
+	return nil
+}
+
+// groupObjectClasses are the object classes of the entries imported as
+// groups.
+var groupObjectClasses = []string{"group", "groupofnames", "groupofuniquenames", "posixgroup"}
+
+// memberAttributes hold the member DNs of imported groups.
+var memberAttributes = []string{"member", "uniquemember"}
+
+// ImportEntries converts directory entries to mock users and groups. Entries
+// with a group object class become groups whose members are their member and
+// uniqueMember values; the others become users. Mock attributes are
+// single-valued, so the first value of each attribute is kept, except for
+// objectClass, whose last, most specific value is kept.
+func ImportEntries(entries []Entry) ([]User, []Group) {
+	var (
+		users  []User
+		groups []Group
+	)
+
+	for _, entry := range entries {
+		attrs := make(map[string]string, len(entry.Attrs))
+		var (
+			members []string
+			isGroup bool
+		)
+
+		for name, values := range entry.Attrs {
+			lower := strings.ToLower(name)
+			switch {
+			case len(values) == 0:
+			case slices.Contains(memberAttributes, lower):
+				members = append(members, values...)
+			case lower == "objectclass":
+				attrs[name] = values[len(values)-1]
+				isGroup = isGroup || slices.ContainsFunc(values, func(v string) bool {
+					return slices.Contains(groupObjectClasses, strings.ToLower(v))
+				})
+			default:
+				attrs[name] = values[0]
+			}
+		}
+
+		if isGroup {
+			slices.Sort(members)
+			groups = append(groups, Group{CN: entry.DN, Members: members, Attrs: attrs})
+			continue
+		}
+
+		users = append(users, User{CN: entry.DN, Attrs: attrs})
+	}
+
+	return users, groups
+}
+
+// ImportDirectory searches the directory of req and replaces the fallback
+// users and groups of the current mock with the entries found, exactly like
+// POST /import. Rules and tenants are kept. A search cut by the size limit
+// still imports the entries returned.
+func (s *MockServer) ImportDirectory(ctx context.Context, req ImportRequest) (users, groups int, err error) {
+	if err := req.validate(); err != nil {
+		return 0, 0, err
+	}
+
+	directory := NewUpstream(req.URL, req.BindDN, req.Password)
+	defer func() { _ = directory.Close() }()
+
+	entries, err := directory.Search(ctx, SearchRequest{
+		BaseDN:    req.BaseDN,
+		Scope:     ScopeSub,
+		Filter:    req.Filter,
+		SizeLimit: int64(req.SizeLimit),
+	})
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return 0, 0, fmt.Errorf("import from %s: %w", req.URL, err)
+	}
+
+	mock := s.mockHolder.GetMock()
+	mock.Users, mock.Groups = ImportEntries(entries)
+
+	yamlData, err := mock.YAML()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	s.setMock(mock, string(yamlData))
+
+	return len(mock.Users), len(mock.Groups), nil
+}
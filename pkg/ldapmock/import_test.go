@@ -0,0 +1,72 @@
+package ldapmock
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestImportEntries(t *testing.T) {
+	users, groups := ImportEntries([]Entry{
+		{DN: "uid=john,dc=example", Attrs: map[string][]string{
+			"objectClass": {"top", "person", "inetOrgPerson"},
+			"uid":         {"john"},
+			"mail":        {"john@example", "j@example"},
+			"description": {},
+		}},
+		{DN: "cn=admins,dc=example", Attrs: map[string][]string{
+			"objectClass": {"top", "groupOfNames"},
+			"member":      {"uid=joe,dc=example", "uid=john,dc=example"},
+			"cn":          {"admins"},
+		}},
+		{DN: "cn=staff,dc=example", Attrs: map[string][]string{
+			"objectClass":  {"groupOfUniqueNames"},
+			"uniqueMember": {"uid=john,dc=example"},
+		}},
+	})
+
+	wantUsers := []User{{CN: "uid=john,dc=example", Attrs: map[string]string{
+		"objectClass": "inetOrgPerson",
+		"uid":         "john",
+		"mail":        "john@example",
+	}}}
+	wantGroups := []Group{
+		{
+			CN:      "cn=admins,dc=example",
+			Members: []string{"uid=joe,dc=example", "uid=john,dc=example"},
+			Attrs:   map[string]string{"objectClass": "groupOfNames", "cn": "admins"},
+		},
+		{
+			CN:      "cn=staff,dc=example",
+			Members: []string{"uid=john,dc=example"},
+			Attrs:   map[string]string{"objectClass": "groupOfUniqueNames"},
+		},
+	}
+
+	if !reflect.DeepEqual(users, wantUsers) {
+		t.Errorf("users = %+v, want %+v", users, wantUsers)
+	}
+	if !reflect.DeepEqual(groups, wantGroups) {
+		t.Errorf("groups = %+v, want %+v", groups, wantGroups)
+	}
+}
+
+func TestImportRequest_Validate(t *testing.T) {
+	req := ImportRequest{URL: "ldap://localhost:389", BaseDN: "dc=example"}
+	if err := req.validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if req.Filter != "(objectClass=*)" {
+		t.Errorf("filter = %q, want the (objectClass=*) default", req.Filter)
+	}
+
+	for _, req := range []ImportRequest{
+		{URL: "http://localhost", BaseDN: "dc=example"},
+		{URL: "ldap://localhost"},
+		{URL: "ldap://localhost", BaseDN: "dc=example", Filter: "(uid=john"},
+		{URL: "ldap://localhost", BaseDN: "dc=example", SizeLimit: -1},
+	} {
+		if err := req.validate(); err == nil {
+			t.Errorf("expected error for %+v", req)
+		}
+	}
+}
@@ -0,0 +1,5258 @@
+package ldapmock
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"golang.org/x/sync/errgroup"
+)
+
+type testServer struct {
+	ldapPort string
+	mockPort string
+	ldapSrv  *LDAPServer
+	mockSrv  *MockServer
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+func startTestServer(t *testing.T, username, password string) *testServer {
+	t.Helper()
+
+	ldapLis := listenLocal(t)
+	mockLis := listenLocal(t)
+
+	log, _ := zap.NewDevelopment()
+	requestLogger := NewInMemoryRequestLogger(DefaultRequestLogCapacity)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	ldapSrv := NewLDAPServer(log, "0", username, password, requestLogger)
+	mockSrv := NewMockServer(log, "0", ldapSrv, requestLogger)
+
+	done := make(chan struct{})
+
+	go func() {
+		group, groupCtx := errgroup.WithContext(ctx)
+		group.Go(func() error { return ldapSrv.Serve(groupCtx, ldapLis) })
+		group.Go(func() error { return mockSrv.Serve(groupCtx, mockLis) })
+		_ = group.Wait()
+		close(done)
+	}()
+
+	return &testServer{
+		ldapPort: listenerPort(ldapLis),
+		mockPort: listenerPort(mockLis),
+		ldapSrv:  ldapSrv,
+		mockSrv:  mockSrv,
+		cancel:   cancel,
+		done:     done,
+	}
+}
+
+func (s *testServer) stop() {
+	s.cancel()
+	<-s.done
+}
+
+func (s *testServer) setMock(t *testing.T, yaml string) {
+	t.Helper()
+
+	resp, err := http.Post(
+		fmt.Sprintf("http://localhost:%s/mock", s.mockPort),
+		"application/yaml",
+		bytes.NewBufferString(yaml),
+	)
+	if err != nil {
+		t.Fatalf("set mock: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("set mock: status %d", resp.StatusCode)
+	}
+}
+
+func (s *testServer) clean(t *testing.T) {
+	t.Helper()
+
+	resp, err := http.Post(
+		fmt.Sprintf("http://localhost:%s/clean", s.mockPort),
+		"",
+		nil,
+	)
+	if err != nil {
+		t.Fatalf("clean: %v", err)
+	}
+	defer resp.Body.Close()
+}
+
+func (s *testServer) ldapDial(t *testing.T) *ldap.Conn {
+	t.Helper()
+
+	conn, err := ldap.DialURL(fmt.Sprintf("ldap://localhost:%s", s.ldapPort))
+	if err != nil {
+		t.Fatalf("ldap dial: %v", err)
+	}
+
+	return conn
+}
+
+func listenLocal(t *testing.T) net.Listener {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	return l
+}
+
+func listenerPort(l net.Listener) string {
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	return port
+}
+
+func TestIntegration_Bind(t *testing.T) {
+	srv := startTestServer(t, "cn=admin", "secret")
+	defer srv.stop()
+
+	t.Run("valid credentials", func(t *testing.T) {
+		conn := srv.ldapDial(t)
+		defer conn.Close()
+
+		err := conn.Bind("cn=admin", "secret")
+		if err != nil {
+			t.Errorf("bind failed: %v", err)
+		}
+	})
+
+	t.Run("invalid credentials", func(t *testing.T) {
+		conn := srv.ldapDial(t)
+		defer conn.Close()
+
+		err := conn.Bind("cn=admin", "wrong")
+		if err == nil {
+			t.Error("expected bind to fail")
+		}
+	})
+}
+
+func TestIntegration_SearchFallback(t *testing.T) {
+	srv := startTestServer(t, "cn=admin", "secret")
+	defer srv.stop()
+
+	srv.setMock(t, `
+users:
+  - cn: john.doe
+    attrs:
+      mail: john@example.com
+      title: Developer
+  - cn: jane.doe
+    attrs:
+      mail: jane@example.com
+      title: Manager
+`)
+
+	conn := srv.ldapDial(t)
+	defer conn.Close()
+
+	err := conn.Bind("cn=admin", "secret")
+	if err != nil {
+		t.Fatalf("bind: %v", err)
+	}
+
+	result, err := conn.Search(&ldap.SearchRequest{
+		BaseDN:     "DC=example,DC=com",
+		Scope:      ldap.ScopeWholeSubtree,
+		Filter:     "(objectClass=*)",
+		Attributes: []string{"mail", "title"},
+	})
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+
+	if len(result.Entries) != 2 {
+		t.Errorf("entries = %d, want 2", len(result.Entries))
+	}
+}
+
+func TestIntegration_SearchWithFilter(t *testing.T) {
+	srv := startTestServer(t, "cn=admin", "secret")
+	defer srv.stop()
+
+	srv.setMock(t, `
+users:
+  - cn: john.doe
+    attrs:
+      mail: john@example.com
+  - cn: jane.doe
+    attrs:
+      mail: jane@example.com
+  - cn: bob.smith
+    attrs:
+      mail: bob@other.com
+`)
+
+	conn := srv.ldapDial(t)
+	defer conn.Close()
+
+	err := conn.Bind("cn=admin", "secret")
+	if err != nil {
+		t.Fatalf("bind: %v", err)
+	}
+
+	t.Run("filter by exact mail", func(t *testing.T) {
+		result, err := conn.Search(&ldap.SearchRequest{
+			BaseDN:     "DC=example,DC=com",
+			Scope:      ldap.ScopeWholeSubtree,
+			Filter:     "(mail=bob@other.com)",
+			Attributes: []string{"mail"},
+		})
+		if err != nil {
+			t.Fatalf("search: %v", err)
+		}
+
+		if len(result.Entries) != 1 {
+			t.Errorf("entries = %d, want 1", len(result.Entries))
+		}
+	})
+
+	t.Run("filter by cn", func(t *testing.T) {
+		result, err := conn.Search(&ldap.SearchRequest{
+			BaseDN:     "DC=example,DC=com",
+			Scope:      ldap.ScopeWholeSubtree,
+			Filter:     "(cn=john.doe)",
+			Attributes: []string{"mail"},
+		})
+		if err != nil {
+			t.Fatalf("search: %v", err)
+		}
+
+		if len(result.Entries) != 1 {
+			t.Errorf("entries = %d, want 1", len(result.Entries))
+		}
+
+		mail := result.Entries[0].GetAttributeValue("mail")
+		if mail != "john@example.com" {
+			t.Errorf("mail = %q, want john@example.com", mail)
+		}
+	})
+}
+
+func TestIntegration_RulesBasic(t *testing.T) {
+	srv := startTestServer(t, "cn=admin", "secret")
+	defer srv.stop()
+
+	srv.setMock(t, `
+users:
+  - cn: fallback-user
+    attrs:
+      mail: fallback@example.com
+
+rules:
+  - name: john-rule
+    filter: "(cn=john)"
+    response:
+      users:
+        - cn: john.doe
+          attrs:
+            mail: john@example.com
+            title: Developer
+`)
+
+	conn := srv.ldapDial(t)
+	defer conn.Close()
+
+	err := conn.Bind("cn=admin", "secret")
+	if err != nil {
+		t.Fatalf("bind: %v", err)
+	}
+
+	t.Run("matching rule", func(t *testing.T) {
+		result, err := conn.Search(&ldap.SearchRequest{
+			BaseDN:     "DC=example,DC=com",
+			Scope:      ldap.ScopeWholeSubtree,
+			Filter:     "(cn=john)",
+			Attributes: []string{"mail", "title"},
+		})
+		if err != nil {
+			t.Fatalf("search: %v", err)
+		}
+
+		if len(result.Entries) != 1 {
+			t.Fatalf("entries = %d, want 1", len(result.Entries))
+		}
+
+		mail := result.Entries[0].GetAttributeValue("mail")
+		if mail != "john@example.com" {
+			t.Errorf("mail = %q, want john@example.com", mail)
+		}
+	})
+
+	t.Run("fallback when no rule matches", func(t *testing.T) {
+		result, err := conn.Search(&ldap.SearchRequest{
+			BaseDN:     "DC=example,DC=com",
+			Scope:      ldap.ScopeWholeSubtree,
+			Filter:     "(cn=fallback-user)",
+			Attributes: []string{"mail"},
+		})
+		if err != nil {
+			t.Fatalf("search: %v", err)
+		}
+
+		if len(result.Entries) != 1 {
+			t.Errorf("entries = %d, want 1 (fallback user)", len(result.Entries))
+		}
+
+		mail := result.Entries[0].GetAttributeValue("mail")
+		if mail != "fallback@example.com" {
+			t.Errorf("mail = %q, want fallback@example.com", mail)
+		}
+	})
+}
+
+func TestIntegration_RulesPriority(t *testing.T) {
+	srv := startTestServer(t, "cn=admin", "secret")
+	defer srv.stop()
+
+	srv.setMock(t, `
+rules:
+  - name: low-priority
+    filter: "(cn=test)"
+    priority: 1
+    response:
+      users:
+        - cn: low
+          attrs:
+            source: low-priority
+
+  - name: high-priority
+    filter: "(cn=test)"
+    priority: 10
+    response:
+      users:
+        - cn: high
+          attrs:
+            source: high-priority
+`)
+
+	conn := srv.ldapDial(t)
+	defer conn.Close()
+
+	err := conn.Bind("cn=admin", "secret")
+	if err != nil {
+		t.Fatalf("bind: %v", err)
+	}
+
+	result, err := conn.Search(&ldap.SearchRequest{
+		BaseDN:     "DC=example,DC=com",
+		Scope:      ldap.ScopeWholeSubtree,
+		Filter:     "(cn=test)",
+		Attributes: []string{"source"},
+	})
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+
+	if len(result.Entries) != 1 {
+		t.Fatalf("entries = %d, want 1", len(result.Entries))
+	}
+
+	source := result.Entries[0].GetAttributeValue("source")
+	if source != "high-priority" {
+		t.Errorf("source = %q, want high-priority", source)
+	}
+}
+
+func TestIntegration_RulesBaseDN(t *testing.T) {
+	srv := startTestServer(t, "cn=admin", "secret")
+	defer srv.stop()
+
+	srv.setMock(t, `
+rules:
+  - name: example-rule
+    filter: "(cn=user)"
+    base_dn: "DC=example,DC=com"
+    response:
+      users:
+        - cn: example-user
+          attrs:
+            domain: example
+
+  - name: other-rule
+    filter: "(cn=user)"
+    base_dn: "DC=other,DC=com"
+    response:
+      users:
+        - cn: other-user
+          attrs:
+            domain: other
+`)
+
+	conn := srv.ldapDial(t)
+	defer conn.Close()
+
+	err := conn.Bind("cn=admin", "secret")
+	if err != nil {
+		t.Fatalf("bind: %v", err)
+	}
+
+	t.Run("example.com base", func(t *testing.T) {
+		result, err := conn.Search(&ldap.SearchRequest{
+			BaseDN:     "DC=example,DC=com",
+			Scope:      ldap.ScopeWholeSubtree,
+			Filter:     "(cn=user)",
+			Attributes: []string{"domain"},
+		})
+		if err != nil {
+			t.Fatalf("search: %v", err)
+		}
+
+		if len(result.Entries) != 1 {
+			t.Fatalf("entries = %d, want 1", len(result.Entries))
+		}
+
+		domain := result.Entries[0].GetAttributeValue("domain")
+		if domain != "example" {
+			t.Errorf("domain = %q, want example", domain)
+		}
+	})
+
+	t.Run("other.com base", func(t *testing.T) {
+		result, err := conn.Search(&ldap.SearchRequest{
+			BaseDN:     "DC=other,DC=com",
+			Scope:      ldap.ScopeWholeSubtree,
+			Filter:     "(cn=user)",
+			Attributes: []string{"domain"},
+		})
+		if err != nil {
+			t.Fatalf("search: %v", err)
+		}
+
+		if len(result.Entries) != 1 {
+			t.Fatalf("entries = %d, want 1", len(result.Entries))
+		}
+
+		domain := result.Entries[0].GetAttributeValue("domain")
+		if domain != "other" {
+			t.Errorf("domain = %q, want other", domain)
+		}
+	})
+}
+
+func TestIntegration_RulesScope(t *testing.T) {
+	srv := startTestServer(t, "cn=admin", "secret")
+	defer srv.stop()
+
+	srv.setMock(t, `
+rules:
+  - name: sub-rule
+    filter: "(cn=user)"
+    scope: "sub"
+    response:
+      users:
+        - cn: sub-user
+          attrs:
+            scope: sub
+
+  - name: base-rule
+    filter: "(cn=user)"
+    scope: "base"
+    response:
+      users:
+        - cn: base-user
+          attrs:
+            scope: base
+`)
+
+	conn := srv.ldapDial(t)
+	defer conn.Close()
+
+	err := conn.Bind("cn=admin", "secret")
+	if err != nil {
+		t.Fatalf("bind: %v", err)
+	}
+
+	t.Run("subtree scope", func(t *testing.T) {
+		result, err := conn.Search(&ldap.SearchRequest{
+			BaseDN:     "DC=example,DC=com",
+			Scope:      ldap.ScopeWholeSubtree,
+			Filter:     "(cn=user)",
+			Attributes: []string{"scope"},
+		})
+		if err != nil {
+			t.Fatalf("search: %v", err)
+		}
+
+		if len(result.Entries) != 1 {
+			t.Fatalf("entries = %d, want 1", len(result.Entries))
+		}
+
+		scope := result.Entries[0].GetAttributeValue("scope")
+		if scope != "sub" {
+			t.Errorf("scope = %q, want sub", scope)
+		}
+	})
+
+	t.Run("base scope", func(t *testing.T) {
+		result, err := conn.Search(&ldap.SearchRequest{
+			BaseDN:     "DC=example,DC=com",
+			Scope:      ldap.ScopeBaseObject,
+			Filter:     "(cn=user)",
+			Attributes: []string{"scope"},
+		})
+		if err != nil {
+			t.Fatalf("search: %v", err)
+		}
+
+		if len(result.Entries) != 1 {
+			t.Fatalf("entries = %d, want 1", len(result.Entries))
+		}
+
+		scope := result.Entries[0].GetAttributeValue("scope")
+		if scope != "base" {
+			t.Errorf("scope = %q, want base", scope)
+		}
+	})
+}
+
+func TestIntegration_RulesMultipleUsers(t *testing.T) {
+	srv := startTestServer(t, "cn=admin", "secret")
+	defer srv.stop()
+
+	srv.setMock(t, `
+rules:
+  - name: team-rule
+    filter: "(team=backend)"
+    response:
+      users:
+        - cn: john.doe
+          attrs:
+            mail: john.doe@example.com
+            team: backend
+        - cn: jane.doe
+          attrs:
+            mail: jane.doe@example.com
+            team: backend
+`)
+
+	conn := srv.ldapDial(t)
+	defer conn.Close()
+
+	err := conn.Bind("cn=admin", "secret")
+	if err != nil {
+		t.Fatalf("bind: %v", err)
+	}
+
+	result, err := conn.Search(&ldap.SearchRequest{
+		BaseDN:     "DC=example,DC=com",
+		Scope:      ldap.ScopeWholeSubtree,
+		Filter:     "(team=backend)",
+		Attributes: []string{"mail"},
+	})
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+
+	if len(result.Entries) != 2 {
+		t.Errorf("entries = %d, want 2", len(result.Entries))
+	}
+}
+
+func TestIntegration_Clean(t *testing.T) {
+	srv := startTestServer(t, "cn=admin", "secret")
+	defer srv.stop()
+
+	srv.setMock(t, `
+users:
+  - cn: test
+    attrs:
+      mail: test@example.com
+`)
+
+	conn := srv.ldapDial(t)
+	defer conn.Close()
+
+	err := conn.Bind("cn=admin", "secret")
+	if err != nil {
+		t.Fatalf("bind: %v", err)
+	}
+
+	result, err := conn.Search(&ldap.SearchRequest{
+		BaseDN:     "DC=example,DC=com",
+		Scope:      ldap.ScopeWholeSubtree,
+		Filter:     "(cn=test)",
+		Attributes: []string{"mail"},
+	})
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+
+	if len(result.Entries) != 1 {
+		t.Fatalf("entries before clean = %d, want 1", len(result.Entries))
+	}
+
+	srv.clean(t)
+
+	srv.setMock(t, `
+users:
+  - cn: new-user
+    attrs:
+      mail: new@example.com
+`)
+
+	result, err = conn.Search(&ldap.SearchRequest{
+		BaseDN:     "DC=example,DC=com",
+		Scope:      ldap.ScopeWholeSubtree,
+		Filter:     "(cn=new-user)",
+		Attributes: []string{"mail"},
+	})
+	if err != nil {
+		t.Fatalf("search after clean and new mock: %v", err)
+	}
+
+	if len(result.Entries) != 1 {
+		t.Errorf("entries after clean = %d, want 1", len(result.Entries))
+	}
+
+	mail := result.Entries[0].GetAttributeValue("mail")
+	if mail != "new@example.com" {
+		t.Errorf("mail = %q, want new@example.com", mail)
+	}
+}
+
+func TestIntegration_MultipleRulesResponse(t *testing.T) {
+	srv := startTestServer(t, "cn=admin", "secret")
+	defer srv.stop()
+
+	srv.setMock(t, `
+rules:
+  - name: developers
+    filter: "(department=engineering)"
+    response:
+      users:
+        - cn: dev1
+          attrs:
+            department: engineering
+            role: developer
+        - cn: dev2
+          attrs:
+            department: engineering
+            role: developer
+        - cn: lead
+          attrs:
+            department: engineering
+            role: lead
+`)
+
+	conn := srv.ldapDial(t)
+	defer conn.Close()
+
+	err := conn.Bind("cn=admin", "secret")
+	if err != nil {
+		t.Fatalf("bind: %v", err)
+	}
+
+	result, err := conn.Search(&ldap.SearchRequest{
+		BaseDN:     "DC=example,DC=com",
+		Scope:      ldap.ScopeWholeSubtree,
+		Filter:     "(department=engineering)",
+		Attributes: []string{"role"},
+	})
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+
+	if len(result.Entries) != 3 {
+		t.Errorf("entries = %d, want 3", len(result.Entries))
+	}
+}
+
+func TestIntegration_RequestLogAPI(t *testing.T) {
+	srv := startTestServer(t, "cn=admin", "secret")
+	defer srv.stop()
+
+	srv.setMock(t, `
+users:
+  - cn: john.doe
+    attrs:
+      mail: john@example.com
+`)
+
+	conn := srv.ldapDial(t)
+	defer conn.Close()
+
+	if err := conn.Bind("cn=admin", "secret"); err != nil {
+		t.Fatalf("bind: %v", err)
+	}
+
+	_, err := conn.Search(&ldap.SearchRequest{
+		BaseDN:     "DC=example,DC=com",
+		Scope:      ldap.ScopeWholeSubtree,
+		Filter:     "(cn=john.doe)",
+		Attributes: []string{"mail"},
+	})
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+
+	t.Run("list with limit", func(t *testing.T) {
+		resp, err := http.Get(fmt.Sprintf("http://localhost:%s/requests?limit=1", srv.mockPort))
+		if err != nil {
+			t.Fatalf("get requests: %v", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("status = %d, want 200", resp.StatusCode)
+		}
+
+		var logs []LDAPRequestLog
+		if err := json.NewDecoder(resp.Body).Decode(&logs); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+
+		if len(logs) != 1 {
+			t.Fatalf("logs length = %d, want 1", len(logs))
+		}
+		if logs[0].Filter != "(cn=john.doe)" {
+			t.Fatalf("filter = %q, want (cn=john.doe)", logs[0].Filter)
+		}
+		if logs[0].Response.Count != 1 {
+			t.Fatalf("response count = %d, want 1", logs[0].Response.Count)
+		}
+	})
+
+	t.Run("query", func(t *testing.T) {
+		query := url.Values{"query": {"(&(base_dn=dc=example,dc=com)(type=search))"}}
+		resp, err := http.Get(fmt.Sprintf("http://localhost:%s/requests?%s", srv.mockPort, query.Encode()))
+		if err != nil {
+			t.Fatalf("get requests: %v", err)
+		}
+		defer resp.Body.Close()
+
+		var logs []LDAPRequestLog
+		if err := json.NewDecoder(resp.Body).Decode(&logs); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if len(logs) != 1 || logs[0].Type != "search" {
+			t.Fatalf("logs = %+v, want the search", logs)
+		}
+
+		resp, err = http.Get(fmt.Sprintf("http://localhost:%s/requests?query=%%28type%%3Dsearch", srv.mockPort))
+		if err != nil {
+			t.Fatalf("get requests: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("invalid query: status = %d, want 400", resp.StatusCode)
+		}
+	})
+
+	t.Run("clear selectively", func(t *testing.T) {
+		clearURL := fmt.Sprintf("http://localhost:%s/requests/clear", srv.mockPort)
+
+		resp, err := http.Post(clearURL, "application/json", strings.NewReader(`{"typ":"bind"}`))
+		if err != nil {
+			t.Fatalf("clear: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("unknown criterion: status = %d, want 400", resp.StatusCode)
+		}
+
+		resp, err = http.Post(clearURL, "application/json", strings.NewReader(`{"type":"bind"}`))
+		if err != nil {
+			t.Fatalf("clear: %v", err)
+		}
+		defer resp.Body.Close()
+
+		var body struct {
+			Removed int `json:"removed"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if body.Removed != 1 {
+			t.Errorf("removed = %d, want the bind", body.Removed)
+		}
+
+		if logs := srv.ldapSrv.RequestLogger().List(); len(logs) != 1 || logs[0].Type != "search" {
+			t.Errorf("logs = %+v, want the search", logs)
+		}
+	})
+
+	t.Run("clear", func(t *testing.T) {
+		resp, err := http.Post(fmt.Sprintf("http://localhost:%s/requests/clear", srv.mockPort), "", nil)
+		if err != nil {
+			t.Fatalf("clear: %v", err)
+		}
+		resp.Body.Close()
+
+		resp, err = http.Get(fmt.Sprintf("http://localhost:%s/requests", srv.mockPort))
+		if err != nil {
+			t.Fatalf("get requests after clear: %v", err)
+		}
+		defer resp.Body.Close()
+
+		var logs []LDAPRequestLog
+		if err := json.NewDecoder(resp.Body).Decode(&logs); err != nil {
+			t.Fatalf("decode after clear: %v", err)
+		}
+
+		if len(logs) != 0 {
+			t.Fatalf("logs length after clear = %d, want 0", len(logs))
+		}
+	})
+}
+
+func TestIntegration_MockAPIAndUI(t *testing.T) {
+	srv := startTestServer(t, "cn=admin", "secret")
+	defer srv.stop()
+
+	srv.setMock(t, `
+rules:
+  - id: rule-1
+    name: test
+    filter: "(cn=user)"
+    priority: 5
+users:
+  - cn: user
+    attrs:
+      mail: user@example.com
+`)
+
+	resp, err := http.Get(fmt.Sprintf("http://localhost:%s/mock", srv.mockPort))
+	if err != nil {
+		t.Fatalf("get mock: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("mock status = %d, want 200", resp.StatusCode)
+	}
+
+	var data struct {
+		Mock LDAPMock `json:"mock"`
+		YAML string   `json:"yaml"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		t.Fatalf("decode mock: %v", err)
+	}
+
+	if data.YAML == "" {
+		t.Fatalf("expected yaml to be returned")
+	}
+	if len(data.Mock.Rules) != 1 || data.Mock.Rules[0].ID != "rule-1" {
+		t.Fatalf("rules not returned")
+	}
+	if len(data.Mock.Users) != 1 {
+		t.Fatalf("users not returned")
+	}
+
+	uiResp, err := http.Get(fmt.Sprintf("http://localhost:%s/ui", srv.mockPort))
+	if err != nil {
+		t.Fatalf("get ui: %v", err)
+	}
+	defer uiResp.Body.Close()
+
+	if uiResp.StatusCode != http.StatusOK {
+		t.Fatalf("ui status = %d, want 200", uiResp.StatusCode)
+	}
+}
+
+func TestIntegration_RulesWithGroups(t *testing.T) {
+	srv := startTestServer(t, "cn=admin", "secret")
+	defer srv.stop()
+
+	srv.setMock(t, `
+rules:
+  - name: dev-group
+    filter: "(cn=Developers)"
+    response:
+      groups:
+        - cn: CN=Developers,OU=Groups,DC=example,DC=com
+          members:
+            - CN=John.Doe,OU=Users,DC=example,DC=com
+            - CN=Alice.Smith,OU=Users,DC=example,DC=com
+          attrs:
+            description: Development team
+`)
+
+	conn := srv.ldapDial(t)
+	defer conn.Close()
+
+	err := conn.Bind("cn=admin", "secret")
+	if err != nil {
+		t.Fatalf("bind: %v", err)
+	}
+
+	result, err := conn.Search(&ldap.SearchRequest{
+		BaseDN:     "DC=example,DC=com",
+		Scope:      ldap.ScopeWholeSubtree,
+		Filter:     "(cn=Developers)",
+		Attributes: []string{"member", "description"},
+	})
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+
+	if len(result.Entries) != 1 {
+		t.Fatalf("entries = %d, want 1", len(result.Entries))
+	}
+
+	entry := result.Entries[0]
+	if entry.DN != "CN=Developers,OU=Groups,DC=example,DC=com" {
+		t.Errorf("DN = %q, want CN=Developers,OU=Groups,DC=example,DC=com", entry.DN)
+	}
+
+	members := entry.GetAttributeValues("member")
+	if len(members) != 2 {
+		t.Errorf("members count = %d, want 2", len(members))
+	}
+
+	description := entry.GetAttributeValue("description")
+	if description != "Development team" {
+		t.Errorf("description = %q, want 'Development team'", description)
+	}
+}
+
+func TestIntegration_RulesMixedResponse(t *testing.T) {
+	srv := startTestServer(t, "cn=admin", "secret")
+	defer srv.stop()
+
+	srv.setMock(t, `
+rules:
+  - name: engineering
+    filter: "(department=engineering)"
+    response:
+      users:
+        - cn: CN=Dev1,OU=Users,DC=example,DC=com
+          attrs:
+            mail: dev1@example.com
+            department: engineering
+        - cn: CN=Dev2,OU=Users,DC=example,DC=com
+          attrs:
+            mail: dev2@example.com
+            department: engineering
+      groups:
+        - cn: CN=Engineering,OU=Groups,DC=example,DC=com
+          members:
+            - CN=Dev1,OU=Users,DC=example,DC=com
+            - CN=Dev2,OU=Users,DC=example,DC=com
+          attrs:
+            description: Engineering department
+`)
+
+	conn := srv.ldapDial(t)
+	defer conn.Close()
+
+	err := conn.Bind("cn=admin", "secret")
+	if err != nil {
+		t.Fatalf("bind: %v", err)
+	}
+
+	result, err := conn.Search(&ldap.SearchRequest{
+		BaseDN:     "DC=example,DC=com",
+		Scope:      ldap.ScopeWholeSubtree,
+		Filter:     "(department=engineering)",
+		Attributes: []string{"mail", "member", "description"},
+	})
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+
+	if len(result.Entries) != 3 {
+		t.Fatalf("entries = %d, want 3 (2 users + 1 group)", len(result.Entries))
+	}
+
+	var userCount, groupCount int
+	for _, entry := range result.Entries {
+		if entry.GetAttributeValue("mail") != "" {
+			userCount++
+		}
+		if len(entry.GetAttributeValues("member")) > 0 {
+			groupCount++
+		}
+	}
+
+	if userCount != 2 {
+		t.Errorf("user count = %d, want 2", userCount)
+	}
+	if groupCount != 1 {
+		t.Errorf("group count = %d, want 1", groupCount)
+	}
+}
+
+func TestIntegration_MultipleGroups(t *testing.T) {
+	srv := startTestServer(t, "cn=admin", "secret")
+	defer srv.stop()
+
+	srv.setMock(t, `
+rules:
+  - name: user-groups
+    filter: "(objectClass=group)"
+    response:
+      groups:
+        - cn: CN=Developers,OU=Groups,DC=example,DC=com
+          members:
+            - CN=John.Doe,OU=Users,DC=example,DC=com
+          attrs:
+            description: Dev team
+        - cn: CN=Admins,OU=Groups,DC=example,DC=com
+          members:
+            - CN=Admin,OU=Users,DC=example,DC=com
+          attrs:
+            description: Admin team
+`)
+
+	conn := srv.ldapDial(t)
+	defer conn.Close()
+
+	err := conn.Bind("cn=admin", "secret")
+	if err != nil {
+		t.Fatalf("bind: %v", err)
+	}
+
+	result, err := conn.Search(&ldap.SearchRequest{
+		BaseDN:     "DC=example,DC=com",
+		Scope:      ldap.ScopeWholeSubtree,
+		Filter:     "(objectClass=group)",
+		Attributes: []string{"member", "description"},
+	})
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+
+	if len(result.Entries) != 2 {
+		t.Fatalf("entries = %d, want 2", len(result.Entries))
+	}
+}
+
+func TestIntegration_ListenOnPortZero(t *testing.T) {
+	log := zap.NewNop()
+	requestLogger := NewInMemoryRequestLogger(DefaultRequestLogCapacity)
+
+	ldapSrv := NewLDAPServer(log, "0", "", "", requestLogger)
+	mockSrv := NewMockServer(log, "0", ldapSrv, requestLogger)
+
+	if ldapSrv.Addr() != nil || mockSrv.Addr() != nil {
+		t.Fatal("expected nil addr before listening")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	group, groupCtx := errgroup.WithContext(ctx)
+	group.Go(func() error { return ldapSrv.ListenAndServe(groupCtx) })
+	group.Go(func() error { return mockSrv.ListenAndServe(groupCtx) })
+
+	deadline := time.Now().Add(5 * time.Second)
+	for ldapSrv.Addr() == nil || mockSrv.Addr() == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("servers did not start")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	for _, addr := range []net.Addr{ldapSrv.Addr(), mockSrv.Addr()} {
+		_, port, _ := net.SplitHostPort(addr.String())
+		if port == "0" {
+			t.Errorf("addr %s: expected actual bound port", addr)
+		}
+	}
+
+	conn, err := ldap.DialURL("ldap://" + ldapSrv.Addr().String())
+	if err != nil {
+		t.Fatalf("ldap dial: %v", err)
+	}
+	conn.Close()
+
+	cancel()
+	if err := group.Wait(); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+}
+
+func TestIntegration_Tenants(t *testing.T) {
+	srv := startTestServer(t, "cn=admin", "secret")
+	defer srv.stop()
+
+	srv.setMock(t, `
+users:
+  - cn: root-user
+    attrs:
+      domain: root
+
+tenants:
+  - name: example
+    base_dn: "DC=example,DC=com"
+    users:
+      - cn: example-user
+        attrs:
+          domain: example
+  - name: other
+    base_dn: "DC=other,DC=com"
+    rules:
+      - name: other-rule
+        filter: "(cn=user)"
+        response:
+          users:
+            - cn: other-user
+              attrs:
+                domain: other
+`)
+
+	conn := srv.ldapDial(t)
+	defer conn.Close()
+
+	if err := conn.Bind("cn=admin", "secret"); err != nil {
+		t.Fatalf("bind: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		baseDN     string
+		filter     string
+		wantDomain string
+	}{
+		{"tenant users", "OU=Users,DC=example,DC=com", "(objectClass=*)", "example"},
+		{"tenant rules", "DC=other,DC=com", "(cn=user)", "other"},
+		{"top-level fallback", "DC=unknown,DC=com", "(objectClass=*)", "root"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := conn.Search(&ldap.SearchRequest{
+				BaseDN:     tt.baseDN,
+				Scope:      ldap.ScopeWholeSubtree,
+				Filter:     tt.filter,
+				Attributes: []string{"domain"},
+			})
+			if err != nil {
+				t.Fatalf("search: %v", err)
+			}
+
+			if len(result.Entries) != 1 {
+				t.Fatalf("entries = %d, want 1", len(result.Entries))
+			}
+
+			domain := result.Entries[0].GetAttributeValue("domain")
+			if domain != tt.wantDomain {
+				t.Errorf("domain = %q, want %q", domain, tt.wantDomain)
+			}
+		})
+	}
+}
+
+func TestIntegration_SearchWithComplexFilter(t *testing.T) {
+	srv := startTestServer(t, "cn=admin", "secret")
+	defer srv.stop()
+
+	srv.setMock(t, `
+users:
+  - cn: john.doe
+    attrs:
+      mail: john@example.com
+      title: Developer
+  - cn: jane.doe
+    attrs:
+      mail: jane@example.com
+      title: Manager
+  - cn: bob.smith
+    attrs:
+      title: Developer
+`)
+
+	conn := srv.ldapDial(t)
+	defer conn.Close()
+
+	if err := conn.Bind("cn=admin", "secret"); err != nil {
+		t.Fatalf("bind: %v", err)
+	}
+
+	tests := []struct {
+		filter string
+		want   int
+	}{
+		{"(&(title=Developer)(mail=*))", 1},
+		{"(|(cn=john.doe)(cn=jane.doe))", 2},
+		{"(!(title=Developer))", 1},
+		{"(mail=*@example.com)", 2},
+		{"(cn=nobody)", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			result, err := conn.Search(&ldap.SearchRequest{
+				BaseDN: "DC=example,DC=com",
+				Scope:  ldap.ScopeWholeSubtree,
+				Filter: tt.filter,
+			})
+			if err != nil {
+				t.Fatalf("search: %v", err)
+			}
+
+			if len(result.Entries) != tt.want {
+				t.Errorf("entries = %d, want %d", len(result.Entries), tt.want)
+			}
+		})
+	}
+}
+
+type testHandler struct {
+	*LDAPServer
+}
+
+func (h testHandler) OnBind(_ context.Context, req BindRequest) error {
+	if req.DN == "cn=locked" {
+		return ldap.NewError(ldap.LDAPResultUnwillingToPerform, errors.New("account locked"))
+	}
+
+	return nil
+}
+
+func (h testHandler) OnSearch(ctx context.Context, req SearchRequest) (SearchResult, error) {
+	if req.BaseDN == "ou=dynamic" {
+		return SearchResult{Users: []User{{CN: "cn=echo", Attrs: map[string]string{"filter": req.Filter}}}}, nil
+	}
+
+	return h.LDAPServer.OnSearch(ctx, req)
+}
+
+func TestIntegration_CustomHandler(t *testing.T) {
+	srv := startTestServer(t, "cn=admin", "secret")
+	defer srv.stop()
+
+	srv.ldapSrv.SetHandler(testHandler{srv.ldapSrv})
+
+	srv.setMock(t, `
+users:
+  - cn: static
+`)
+
+	conn := srv.ldapDial(t)
+	defer conn.Close()
+
+	err := conn.Bind("cn=locked", "any")
+	if !ldap.IsErrorWithCode(err, ldap.LDAPResultUnwillingToPerform) {
+		t.Fatalf("bind error = %v, want unwillingToPerform", err)
+	}
+
+	if err := conn.Bind("cn=anyone", "any"); err != nil {
+		t.Fatalf("bind: %v", err)
+	}
+
+	result, err := conn.Search(&ldap.SearchRequest{
+		BaseDN:     "ou=dynamic",
+		Scope:      ldap.ScopeWholeSubtree,
+		Filter:     "(uid=bob)",
+		Attributes: []string{"filter"},
+	})
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+
+	if len(result.Entries) != 1 || result.Entries[0].GetAttributeValue("filter") != "(uid=bob)" {
+		t.Fatalf("unexpected dynamic entries: %v", result.Entries)
+	}
+
+	result, err = conn.Search(&ldap.SearchRequest{
+		BaseDN: "DC=example,DC=com",
+		Scope:  ldap.ScopeWholeSubtree,
+		Filter: "(objectClass=*)",
+	})
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+
+	if len(result.Entries) != 1 || result.Entries[0].DN != "static" {
+		t.Fatalf("default handler entries: %v", result.Entries)
+	}
+
+	srv.ldapSrv.SetHandler(nil)
+
+	if err := conn.Bind("cn=anyone", "any"); err == nil {
+		t.Fatal("expected default handler to reject bind")
+	}
+}
+
+func TestIntegration_SearchMiddleware(t *testing.T) {
+	srv := startTestServer(t, "cn=admin", "secret")
+	defer srv.stop()
+
+	var calls []string
+	srv.ldapSrv.Use(
+		func(next SearchFunc) SearchFunc {
+			return func(ctx context.Context, req SearchRequest) (SearchResult, error) {
+				calls = append(calls, "first")
+				if req.BaseDN == "ou=busy" {
+					return SearchResult{}, ldap.NewError(ldap.LDAPResultBusy, errors.New("try later"))
+				}
+				return next(ctx, req)
+			}
+		},
+		func(next SearchFunc) SearchFunc {
+			return func(ctx context.Context, req SearchRequest) (SearchResult, error) {
+				calls = append(calls, "second")
+				result, err := next(ctx, req)
+				result.Users = append(result.Users, User{CN: "injected"})
+				return result, err
+			}
+		},
+	)
+
+	srv.setMock(t, `
+users:
+  - cn: static
+`)
+
+	conn := srv.ldapDial(t)
+	defer conn.Close()
+
+	if err := conn.Bind("cn=admin", "secret"); err != nil {
+		t.Fatalf("bind: %v", err)
+	}
+
+	result, err := conn.Search(&ldap.SearchRequest{
+		BaseDN: "DC=example,DC=com",
+		Scope:  ldap.ScopeWholeSubtree,
+		Filter: "(objectClass=*)",
+	})
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+
+	if len(result.Entries) != 2 {
+		t.Fatalf("entries = %d, want 2 (static + injected)", len(result.Entries))
+	}
+	if len(calls) != 2 || calls[0] != "first" || calls[1] != "second" {
+		t.Errorf("middleware calls = %v, want [first second]", calls)
+	}
+
+	_, err = conn.Search(&ldap.SearchRequest{
+		BaseDN: "ou=busy",
+		Scope:  ldap.ScopeWholeSubtree,
+		Filter: "(objectClass=*)",
+	})
+	if !ldap.IsErrorWithCode(err, ldap.LDAPResultBusy) {
+		t.Fatalf("search error = %v, want busy", err)
+	}
+
+	logs := srv.ldapSrv.RequestLogger().List()
+	if len(logs) != 3 || logs[2].Type != "bind" {
+		t.Fatalf("logs = %+v, want 2 searches after the bind", logs)
+	}
+	if logs[0].Result != "Busy" {
+		t.Errorf("failed search logged result = %q, want Busy", logs[0].Result)
+	}
+	if logs[0].Response.Count != 0 {
+		t.Errorf("failed search logged count = %d, want 0", logs[0].Response.Count)
+	}
+	if logs[1].Response.Count != 2 {
+		t.Errorf("logged count = %d, want 2", logs[1].Response.Count)
+	}
+}
+
+func TestIntegration_SetMockJSON(t *testing.T) {
+	srv := startTestServer(t, "cn=admin", "secret")
+	defer srv.stop()
+
+	resp, err := http.Post(
+		fmt.Sprintf("http://localhost:%s/mock", srv.mockPort),
+		"application/json",
+		bytes.NewBufferString(`{"users":[{"cn":"json-user","attrs":{"mail":"json@example.com"}}]}`),
+	)
+	if err != nil {
+		t.Fatalf("set mock: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+
+	mock := srv.ldapSrv.GetMock()
+	if len(mock.Users) != 1 || mock.Users[0].Attrs["mail"] != "json@example.com" {
+		t.Fatalf("unexpected mock: %+v", mock)
+	}
+
+	resp, err = http.Get(fmt.Sprintf("http://localhost:%s/mock", srv.mockPort))
+	if err != nil {
+		t.Fatalf("get mock: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var raw struct {
+		Mock map[string]any `json:"mock"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	if _, ok := raw.Mock["users"]; !ok {
+		t.Errorf("GET /mock should use snake_case field names, got %v", raw.Mock)
+	}
+}
+
+func TestIntegration_ListenAndServeTLS(t *testing.T) {
+	certFile, keyFile := writeTestCert(t)
+
+	ldapSrv := NewLDAPServer(zap.NewNop(), "0", "cn=admin", "secret", nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() { errCh <- ldapSrv.ListenAndServeTLS(ctx, certFile, keyFile) }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for ldapSrv.Addr() == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("server did not start")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	_, port, _ := net.SplitHostPort(ldapSrv.Addr().String())
+	conn, err := ldap.DialURL("ldaps://127.0.0.1:"+port, ldap.DialWithTLSConfig(&tls.Config{InsecureSkipVerify: true}))
+	if err != nil {
+		t.Fatalf("dial ldaps: %v", err)
+	}
+
+	if err := conn.Bind("cn=admin", "secret"); err != nil {
+		t.Errorf("bind over TLS: %v", err)
+	}
+	conn.Close()
+
+	cancel()
+	if err := <-errCh; err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+}
+
+func TestIntegration_Version(t *testing.T) {
+	srv := startTestServer(t, "cn=admin", "secret")
+	defer srv.stop()
+
+	resp, err := http.Get(fmt.Sprintf("http://localhost:%s/version", srv.mockPort))
+	if err != nil {
+		t.Fatalf("get version: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var info BuildInfo
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	if info.Version != Version || info.GoVersion == "" || info.Commit == "" {
+		t.Errorf("unexpected build info: %+v", info)
+	}
+}
+
+func TestIntegration_RequestLogAddressFamily(t *testing.T) {
+	tests := []struct {
+		network string
+		addr    string
+		want    string
+	}{
+		{network: "tcp4", addr: "127.0.0.1:0", want: "ipv4"},
+		{network: "tcp6", addr: "[::1]:0", want: "ipv6"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.network, func(t *testing.T) {
+			lis, err := net.Listen(tt.network, tt.addr)
+			if err != nil {
+				t.Skipf("%s not available: %v", tt.network, err)
+			}
+
+			requestLogger := NewInMemoryRequestLogger(DefaultRequestLogCapacity)
+			ldapSrv := NewLDAPServer(zap.NewNop(), "0", "", "", requestLogger)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan error, 1)
+			go func() { done <- ldapSrv.Serve(ctx, lis) }()
+			defer func() {
+				cancel()
+				<-done
+			}()
+
+			conn, err := ldap.DialURL("ldap://" + lis.Addr().String())
+			if err != nil {
+				t.Fatalf("ldap dial: %v", err)
+			}
+			defer conn.Close()
+
+			_, err = conn.Search(ldap.NewSearchRequest("dc=example,dc=com", ldap.ScopeWholeSubtree,
+				ldap.NeverDerefAliases, 0, 0, false, "(uid=john)", nil, nil))
+			if err != nil {
+				t.Fatalf("search: %v", err)
+			}
+
+			logs := requestLogger.List()
+			if len(logs) != 1 {
+				t.Fatalf("expected 1 logged request, got %d", len(logs))
+			}
+			if logs[0].AddrFamily != tt.want {
+				t.Errorf("address family = %q, want %q", logs[0].AddrFamily, tt.want)
+			}
+			if logs[0].ClientAddr == "" {
+				t.Error("expected client address to be recorded")
+			}
+		})
+	}
+}
+
+func TestIntegration_ListenAndServeUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ldapi")
+
+	requestLogger := NewInMemoryRequestLogger(DefaultRequestLogCapacity)
+	ldapSrv := NewLDAPServer(zap.NewNop(), "0", "cn=admin", "secret", requestLogger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- ldapSrv.ListenAndServeUnix(ctx, path) }()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for ldapSrv.Addr() == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("server did not start")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	conn, err := ldap.DialURL("ldapi://" + path)
+	if err != nil {
+		t.Fatalf("ldapi dial: %v", err)
+	}
+	defer conn.Close()
+
+	if err := conn.Bind("cn=admin", "secret"); err != nil {
+		t.Fatalf("bind: %v", err)
+	}
+
+	_, err = conn.Search(ldap.NewSearchRequest("dc=example,dc=com", ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases, 0, 0, false, "(uid=john)", nil, nil))
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+
+	logs := requestLogger.List()
+	if len(logs) != 2 {
+		t.Fatalf("expected bind and search logged, got %+v", logs)
+	}
+	for _, l := range logs {
+		if l.AddrFamily != "unix" {
+			t.Errorf("%s address family = %q, want unix", l.Type, l.AddrFamily)
+		}
+	}
+}
+
+func TestIntegration_RequestStream(t *testing.T) {
+	srv := startTestServer(t, "cn=admin", "secret")
+	defer srv.stop()
+
+	resp, err := http.Get(fmt.Sprintf("http://localhost:%s/requests/stream", srv.mockPort))
+	if err != nil {
+		t.Fatalf("get stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("content type = %q, want text/event-stream", ct)
+	}
+
+	conn := srv.ldapDial(t)
+	defer conn.Close()
+
+	if err := conn.Bind("cn=admin", "wrong"); !ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+		t.Fatalf("bind error = %v, want invalid credentials", err)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+
+		var entry LDAPRequestLog
+		if err := json.Unmarshal([]byte(data), &entry); err != nil {
+			t.Fatalf("decode event: %v", err)
+		}
+		if entry.Type != "bind" || entry.BindDN != "cn=admin" || entry.Result != "Invalid Credentials" {
+			t.Errorf("event = %+v, want failed bind of cn=admin", entry)
+		}
+
+		return
+	}
+
+	t.Fatalf("stream ended without event: %v", scanner.Err())
+}
+
+func TestIntegration_Simulate(t *testing.T) {
+	srv := startTestServer(t, "", "")
+	defer srv.stop()
+
+	srv.setMock(t, `
+users:
+  - cn: uid=fallback,dc=example
+    attrs:
+      uid: fallback
+      mail: fallback@example
+  - cn: uid=other,dc=example
+    attrs:
+      uid: other
+rules:
+  - id: john
+    filter: "(uid=john)"
+    response:
+      users:
+        - cn: uid=john,dc=example
+`)
+
+	simulate := func(t *testing.T, body string) (int, Simulation) {
+		t.Helper()
+
+		resp, err := http.Post(fmt.Sprintf("http://localhost:%s/simulate", srv.mockPort), "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("post simulate: %v", err)
+		}
+		defer resp.Body.Close()
+
+		var sim Simulation
+		if resp.StatusCode == http.StatusOK {
+			if err := json.NewDecoder(resp.Body).Decode(&sim); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+		}
+
+		return resp.StatusCode, sim
+	}
+
+	t.Run("rule match", func(t *testing.T) {
+		status, sim := simulate(t, `{"base_dn":"dc=example","filter":"(uid=john)"}`)
+		if status != http.StatusOK {
+			t.Fatalf("status = %d, want 200", status)
+		}
+		if sim.MatchedRule == nil || sim.MatchedRule.RuleID != "john" {
+			t.Errorf("matched rule = %+v, want john", sim.MatchedRule)
+		}
+		if sim.Response.Count != 1 || sim.Response.ReturnedDNs[0] != "uid=john,dc=example" {
+			t.Errorf("response = %+v", sim.Response)
+		}
+	})
+
+	t.Run("fallback", func(t *testing.T) {
+		status, sim := simulate(t, `{"filter":"(uid=fallback)"}`)
+		if status != http.StatusOK {
+			t.Fatalf("status = %d, want 200", status)
+		}
+		if sim.MatchedRule != nil || len(sim.Rules) != 1 || sim.Rules[0].Reason == "" {
+			t.Errorf("simulation = %+v, want unmatched rule with reason", sim)
+		}
+		if sim.Response.Count != 1 {
+			t.Errorf("fallback count = %d, want 1", sim.Response.Count)
+		}
+	})
+
+	t.Run("entries", func(t *testing.T) {
+		status, sim := simulate(t, `{"filter":"(uid=*)","attributes":["uid"],"size_limit":1}`)
+		if status != http.StatusOK {
+			t.Fatalf("status = %d, want 200", status)
+		}
+		want := []Entry{{DN: "uid=fallback,dc=example", Attrs: map[string][]string{"uid": {"fallback"}}}}
+		if sim.Result != "Size Limit Exceeded" || !reflect.DeepEqual(sim.Entries, want) {
+			t.Errorf("result %q, entries %+v, want size limit exceeded with %+v", sim.Result, sim.Entries, want)
+		}
+	})
+
+	t.Run("root DSE", func(t *testing.T) {
+		status, sim := simulate(t, `{"scope":"base","attributes":["namingContexts"]}`)
+		if status != http.StatusOK {
+			t.Fatalf("status = %d, want 200", status)
+		}
+		want := []Entry{{DN: "", Attrs: map[string][]string{"namingContexts": {"dc=example"}}}}
+		if sim.MatchedRule != nil || sim.Result != "Success" || !reflect.DeepEqual(sim.Entries, want) {
+			t.Errorf("simulation = %+v, want the root DSE %+v", sim, want)
+		}
+		if sim.Response.Count != 1 || sim.Response.ReturnedDNs[0] != "" {
+			t.Errorf("response = %+v, want the root DSE", sim.Response)
+		}
+	})
+
+	t.Run("invalid filter", func(t *testing.T) {
+		if status, _ := simulate(t, `{"filter":"(uid=john"}`); status != http.StatusBadRequest {
+			t.Errorf("status = %d, want 400", status)
+		}
+	})
+
+	if logs := srv.ldapSrv.RequestLogger().List(); len(logs) != 0 {
+		t.Errorf("simulation was logged: %+v", logs)
+	}
+}
+
+func TestIntegration_StatsAndCoverage(t *testing.T) {
+	srv := startTestServer(t, "", "")
+	defer srv.stop()
+
+	srv.setMock(t, `
+rules:
+  - id: john
+    filter: "(uid=john)"
+    response:
+      users:
+        - cn: uid=john,dc=example
+  - id: unused
+    filter: "(uid=nobody)"
+`)
+
+	conn := srv.ldapDial(t)
+	defer conn.Close()
+
+	for _, filter := range []string{"(uid=john)", "(uid=john)", "(uid=other)"} {
+		_, err := conn.Search(ldap.NewSearchRequest("dc=example", ldap.ScopeWholeSubtree,
+			ldap.NeverDerefAliases, 0, 0, false, filter, nil, nil))
+		if err != nil {
+			t.Fatalf("search %s: %v", filter, err)
+		}
+	}
+
+	getJSON := func(t *testing.T, path string, v any) {
+		t.Helper()
+
+		resp, err := http.Get(fmt.Sprintf("http://localhost:%s%s", srv.mockPort, path))
+		if err != nil {
+			t.Fatalf("get %s: %v", path, err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("get %s: status %d", path, resp.StatusCode)
+		}
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatalf("decode %s: %v", path, err)
+		}
+	}
+
+	var stats Stats
+	getJSON(t, "/stats", &stats)
+	if stats.Searches != 3 || stats.Matched != 2 || stats.Fallback != 1 || stats.Empty != 1 {
+		t.Errorf("stats = %+v", stats)
+	}
+	if len(stats.Rules) != 1 || stats.Rules[0].RuleID != "john" || stats.Rules[0].Hits != 2 || stats.Rules[0].LastMatched == nil {
+		t.Errorf("rule stats = %+v", stats.Rules)
+	}
+
+	var coverage Coverage
+	getJSON(t, "/mock/coverage", &coverage)
+	if coverage.Total != 2 || coverage.Hit != 1 || !coverage.Rules[1].NeverHit {
+		t.Errorf("coverage = %+v", coverage)
+	}
+
+	var empty []EmptySearch
+	getJSON(t, "/requests/empty", &empty)
+	if len(empty) != 1 || empty[0].Filter != "(uid=other)" || empty[0].Count != 1 || empty[0].LastBaseDN != "dc=example" {
+		t.Errorf("empty searches = %+v", empty)
+	}
+
+	srv.clean(t)
+	getJSON(t, "/stats", &stats)
+	if stats.Searches != 0 {
+		t.Errorf("stats not reset by /clean: %+v", stats)
+	}
+}
+
+func TestIntegration_Metrics(t *testing.T) {
+	srv := startTestServer(t, "", "")
+	defer srv.stop()
+
+	srv.setMock(t, `
+rules:
+  - id: slow
+    filter: "(uid=slow)"
+    delay: 60ms
+    response:
+      users:
+        - cn: uid=slow,dc=example
+`)
+
+	conn := srv.ldapDial(t)
+	defer conn.Close()
+
+	_, err := conn.Search(ldap.NewSearchRequest("dc=example", ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases, 0, 0, false, "(uid=slow)", nil, nil))
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+
+	stats := srv.ldapSrv.Stats()
+	if len(stats.Latency) != 1 || stats.Latency[0].Rule != "slow" || stats.Latency[0].Sum < 0.06 {
+		t.Fatalf("latency = %+v, want the 60ms delay of rule slow", stats.Latency)
+	}
+
+	resp, err := http.Get(fmt.Sprintf("http://localhost:%s/metrics", srv.mockPort))
+	if err != nil {
+		t.Fatalf("get metrics: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain") {
+		t.Fatalf("metrics: status %d, content type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	for _, line := range []string{
+		`ldapmock_search_duration_seconds_bucket{rule="slow",result="Success",le="0.05"} 0`,
+		`ldapmock_search_duration_seconds_bucket{rule="slow",result="Success",le="0.1"} 1`,
+		`ldapmock_search_duration_seconds_count{rule="slow",result="Success"} 1`,
+	} {
+		if !strings.Contains(string(body), line+"\n") {
+			t.Errorf("metrics lack %s:\n%s", line, body)
+		}
+	}
+}
+
+func TestIntegration_MockLint(t *testing.T) {
+	srv := startTestServer(t, "", "")
+	defer srv.stop()
+
+	srv.setMock(t, `
+rules:
+  - id: broken
+    filter: "uid=john"
+`)
+
+	resp, err := http.Get(fmt.Sprintf("http://localhost:%s/mock/lint", srv.mockPort))
+	if err != nil {
+		t.Fatalf("lint: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var lint MockLint
+	if err := json.NewDecoder(resp.Body).Decode(&lint); err != nil {
+		t.Fatalf("decode lint: %v", err)
+	}
+	if lint.Errors != 1 || len(lint.Issues) != 1 || lint.Issues[0].Path != "rules[0].filter" || lint.Issues[0].RuleID != "broken" {
+		t.Errorf("lint = %+v", lint)
+	}
+}
+
+func TestIntegration_LDIF(t *testing.T) {
+	srv := startTestServer(t, "", "")
+	defer srv.stop()
+
+	srv.setMock(t, `
+rules:
+  - id: kept
+    filter: "(uid=kept)"
+`)
+
+	ldif := "dn: uid=john,dc=example\nuid: john\nmail: john@example.com\n"
+	resp, err := http.Post(fmt.Sprintf("http://localhost:%s/mock/ldif", srv.mockPort), "text/x-ldif", strings.NewReader(ldif))
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("import status = %d", resp.StatusCode)
+	}
+
+	mock := srv.ldapSrv.GetMock()
+	if len(mock.Users) != 1 || len(mock.Rules) != 1 {
+		t.Fatalf("mock after import = %+v, want 1 user and the kept rule", mock)
+	}
+
+	conn := srv.ldapDial(t)
+	defer conn.Close()
+
+	result, err := conn.Search(ldap.NewSearchRequest("dc=example", ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases, 0, 0, false, "(uid=john)", nil, nil))
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if len(result.Entries) != 1 || result.Entries[0].GetAttributeValue("mail") != "john@example.com" {
+		t.Errorf("imported entry not served: %+v", result.Entries)
+	}
+
+	resp, err = http.Get(fmt.Sprintf("http://localhost:%s/mock/ldif", srv.mockPort))
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), "dn: uid=john,dc=example\nmail: john@example.com\nuid: john\n") {
+		t.Errorf("export = %q", body)
+	}
+
+	resp, err = http.Post(fmt.Sprintf("http://localhost:%s/mock/ldif", srv.mockPort), "text/x-ldif", strings.NewReader("uid: broken\n"))
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("invalid import status = %d, want 400", resp.StatusCode)
+	}
+}
+
+func TestIntegration_Upstream(t *testing.T) {
+	upstream := startTestServer(t, "cn=svc,dc=example", "svc-pw")
+	defer upstream.stop()
+
+	upstream.setMock(t, `
+users:
+  - cn: "uid=john,dc=example"
+    attrs:
+      uid: john
+      mail: john@upstream.example
+rules:
+  - name: admins
+    filter: "(cn=admins)"
+    response:
+      groups:
+        - cn: "cn=admins,dc=example"
+          members:
+            - "uid=john,dc=example"
+            - "uid=jane,dc=example"
+`)
+
+	srv := startTestServer(t, "", "")
+	defer srv.stop()
+
+	srv.ldapSrv.SetUpstream(NewUpstream("ldap://127.0.0.1:"+upstream.ldapPort, "cn=svc,dc=example", "svc-pw"))
+	defer func() { _ = srv.ldapSrv.Upstream().Close() }()
+
+	srv.setMock(t, `
+rules:
+  - name: override
+    filter: "(uid=john)"
+    response:
+      users:
+        - cn: "uid=john,dc=example"
+          attrs:
+            mail: john@mock.example
+`)
+
+	conn := srv.ldapDial(t)
+	defer conn.Close()
+
+	search := func(filter string) (*ldap.SearchResult, error) {
+		return conn.Search(ldap.NewSearchRequest("dc=example", ldap.ScopeWholeSubtree,
+			ldap.NeverDerefAliases, 0, 0, false, filter, nil, nil))
+	}
+
+	result, err := search("(uid=john)")
+	if err != nil {
+		t.Fatalf("search override: %v", err)
+	}
+	if len(result.Entries) != 1 || result.Entries[0].GetAttributeValue("mail") != "john@mock.example" {
+		t.Errorf("override entries = %+v, want the mock response", result.Entries)
+	}
+
+	result, err = search("(mail=*)")
+	if err != nil {
+		t.Fatalf("search forwarded: %v", err)
+	}
+	if len(result.Entries) != 1 || result.Entries[0].GetAttributeValue("mail") != "john@upstream.example" {
+		t.Errorf("forwarded entries = %+v, want the upstream user", result.Entries)
+	}
+
+	result, err = search("(cn=admins)")
+	if err != nil {
+		t.Fatalf("search forwarded group: %v", err)
+	}
+	if len(result.Entries) != 1 || len(result.Entries[0].GetAttributeValues("member")) != 2 {
+		t.Errorf("forwarded group = %+v, want both members", result.Entries)
+	}
+
+	logs := srv.ldapSrv.RequestLogger().List()
+	if len(logs) < 2 || !logs[0].Upstream || logs[0].MatchedRule != nil {
+		t.Fatalf("latest request log = %+v, want an upstream entry", logs[0])
+	}
+	if len(logs[0].Response.ReturnedDNs) != 1 || logs[0].Response.ReturnedDNs[0] != "cn=admins,dc=example" {
+		t.Errorf("returned DNs = %v", logs[0].Response.ReturnedDNs)
+	}
+
+	upstream.stop()
+	_ = srv.ldapSrv.Upstream().Close()
+
+	_, err = search("(mail=*)")
+	if !ldap.IsErrorWithCode(err, ldap.LDAPResultUnavailable) {
+		t.Errorf("search with upstream down: err = %v, want unavailable", err)
+	}
+}
+
+func TestIntegration_UpstreamPassthrough(t *testing.T) {
+	upstream := startTestServer(t, "", "")
+	defer upstream.stop()
+
+	upstream.setMock(t, `
+users:
+  - cn: "uid=john,dc=example"
+    attrs:
+      uid: john
+`)
+
+	srv := startTestServer(t, "", "")
+	defer srv.stop()
+
+	srv.setMock(t, `
+rules:
+  - id: slow-upstream
+    filter: "(uid=john)"
+    passthrough: true
+    delay: 100ms
+`)
+
+	conn := srv.ldapDial(t)
+	defer conn.Close()
+
+	req := ldap.NewSearchRequest("dc=example", ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases, 0, 0, false, "(uid=john)", nil, nil)
+
+	_, err := conn.Search(req)
+	if !ldap.IsErrorWithCode(err, ldap.LDAPResultUnavailable) {
+		t.Errorf("passthrough without upstream: err = %v, want unavailable", err)
+	}
+
+	srv.ldapSrv.SetUpstream(NewUpstream("ldap://127.0.0.1:"+upstream.ldapPort, "", ""))
+	defer func() { _ = srv.ldapSrv.Upstream().Close() }()
+
+	start := time.Now()
+	result, err := conn.Search(req)
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("search took %v, want the rule delay of 100ms", elapsed)
+	}
+	if len(result.Entries) != 1 || result.Entries[0].DN != "uid=john,dc=example" {
+		t.Errorf("entries = %+v, want the upstream user", result.Entries)
+	}
+
+	log := srv.ldapSrv.RequestLogger().List()[0]
+	if !log.Upstream || log.MatchedRule == nil || log.MatchedRule.RuleID != "slow-upstream" {
+		t.Errorf("request log = %+v, want the passthrough rule relayed upstream", log)
+	}
+}
+
+func TestIntegration_UpstreamShadow(t *testing.T) {
+	upstream := startTestServer(t, "", "")
+	defer upstream.stop()
+
+	upstream.setMock(t, `
+users:
+  - cn: "uid=john,dc=example"
+    attrs:
+      uid: john
+      mail: john@corp.example
+`)
+
+	srv := startTestServer(t, "", "")
+	defer srv.stop()
+
+	srv.ldapSrv.SetUpstream(NewUpstream("ldap://127.0.0.1:"+upstream.ldapPort, "", ""))
+	defer func() { _ = srv.ldapSrv.Upstream().Close() }()
+	srv.ldapSrv.SetShadow(true)
+
+	srv.setMock(t, `
+rules:
+  - id: john
+    filter: "(uid=john)"
+    response:
+      users:
+        - cn: "uid=john,dc=example"
+          attrs:
+            uid: john
+            mail: john@example.com
+`)
+
+	conn := srv.ldapDial(t)
+	defer conn.Close()
+
+	result, err := conn.Search(ldap.NewSearchRequest("dc=example", ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases, 0, 0, false, "(uid=john)", nil, nil))
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if len(result.Entries) != 1 || result.Entries[0].GetAttributeValue("mail") != "john@example.com" {
+		t.Errorf("entries = %+v, want the mock response", result.Entries)
+	}
+
+	log := srv.ldapSrv.RequestLogger().List()[0]
+	if log.Upstream || log.ShadowDiff == nil {
+		t.Fatalf("request log = %+v, want a shadow diff of a mock answer", log)
+	}
+
+	want := &ShadowDiff{
+		UpstreamResult: "Success",
+		Changed: []EntryDiff{{DN: "uid=john,dc=example", Attributes: []AttributeDiff{
+			{Name: "mail", Mock: []string{"john@example.com"}, Upstream: []string{"john@corp.example"}},
+		}}},
+	}
+	if !reflect.DeepEqual(log.ShadowDiff, want) {
+		t.Errorf("shadow diff = %+v, want %+v", log.ShadowDiff, want)
+	}
+}
+
+func TestIntegration_Replay(t *testing.T) {
+	srv := startTestServer(t, "", "")
+	defer srv.stop()
+
+	srv.setMock(t, `
+rules:
+  - id: john
+    filter: "(uid=john)"
+    response:
+      users:
+        - cn: "uid=john,dc=example"
+`)
+
+	conn := srv.ldapDial(t)
+	defer conn.Close()
+
+	for _, filter := range []string{"(uid=john)", "(uid=jane)"} {
+		if _, err := conn.Search(ldap.NewSearchRequest("dc=example", ldap.ScopeWholeSubtree,
+			ldap.NeverDerefAliases, 0, 0, false, filter, nil, nil)); err != nil {
+			t.Fatalf("search %s: %v", filter, err)
+		}
+	}
+
+	resp, err := http.Get(fmt.Sprintf("http://localhost:%s/requests?format=ndjson", srv.mockPort))
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	export, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("content type = %q", ct)
+	}
+	if lines := strings.Count(string(export), "\n"); lines != 2 {
+		t.Fatalf("export has %d lines, want 2:\n%s", lines, export)
+	}
+
+	srv.setMock(t, `
+rules:
+  - id: john-renamed
+    filter: "(uid=john)"
+    response:
+      users:
+        - cn: "uid=john,dc=example"
+`)
+
+	resp, err = http.Post(fmt.Sprintf("http://localhost:%s/replay?concurrency=2", srv.mockPort),
+		"application/x-ndjson", bytes.NewReader(export))
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var report ReplayReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		t.Fatalf("decode report: %v", err)
+	}
+
+	if report.Searches != 2 || report.RuleChanged != 1 || len(report.Results) != 1 {
+		t.Fatalf("report = %+v, want one changed rule", report)
+	}
+	if got := report.Results[0].ReplayedRule; got == nil || got.RuleID != "john-renamed" {
+		t.Errorf("replayed rule = %+v, want john-renamed", got)
+	}
+
+	resp, err = http.Post(fmt.Sprintf("http://localhost:%s/replay?concurrency=0", srv.mockPort),
+		"application/x-ndjson", bytes.NewReader(export))
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400 for invalid concurrency", resp.StatusCode)
+	}
+}
+
+func TestIntegration_Capture(t *testing.T) {
+	srv := startTestServer(t, "", "")
+	defer srv.stop()
+
+	configURL := fmt.Sprintf("http://localhost:%s/config", srv.mockPort)
+
+	for _, format := range []string{CaptureHex, CapturePcap} {
+		t.Run(format, func(t *testing.T) {
+			dir := t.TempDir()
+
+			body := fmt.Sprintf(`{"capture":{"enabled":true,"format":%q,"dir":%q}}`, format, dir)
+			resp, err := http.Post(configURL, "application/json", strings.NewReader(body))
+			if err != nil {
+				t.Fatalf("enable capture: %v", err)
+			}
+
+			var cfg RuntimeConfig
+			_ = json.NewDecoder(resp.Body).Decode(&cfg)
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK || cfg.Capture == nil || !cfg.Capture.Enabled {
+				t.Fatalf("enable capture: status %d, config %+v", resp.StatusCode, cfg.Capture)
+			}
+
+			conn := srv.ldapDial(t)
+			_, err = conn.Search(ldap.NewSearchRequest("dc=example", ldap.ScopeWholeSubtree,
+				ldap.NeverDerefAliases, 0, 0, false, "(uid=john)", nil, nil))
+			conn.Close()
+			if err != nil {
+				t.Fatalf("search: %v", err)
+			}
+
+			resp, err = http.Post(configURL, "application/json", strings.NewReader(`{"capture":{"enabled":false}}`))
+			if err != nil {
+				t.Fatalf("disable capture: %v", err)
+			}
+			resp.Body.Close()
+
+			files, _ := filepath.Glob(filepath.Join(dir, "*."+format))
+			if len(files) != 1 {
+				t.Fatalf("capture files = %v, want one", files)
+			}
+
+			data, err := os.ReadFile(files[0])
+			if err != nil {
+				t.Fatalf("read capture: %v", err)
+			}
+
+			switch format {
+			case CaptureHex:
+				if !strings.Contains(string(data), "client -> server") || !strings.Contains(string(data), "server -> client") ||
+					!strings.Contains(string(data), "uid") {
+					t.Errorf("hex capture missing messages:\n%s", data)
+				}
+			case CapturePcap:
+				if len(data) < 24 || binary.LittleEndian.Uint32(data) != 0xa1b2c3d4 {
+					t.Errorf("pcap capture has no valid header")
+				}
+			}
+		})
+	}
+
+	resp, err := http.Post(configURL, "application/json", strings.NewReader(`{"capture":{"format":"txt"}}`))
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("invalid format: status %d, want 400", resp.StatusCode)
+	}
+
+	resp, err = http.Post(configURL, "application/json", strings.NewReader(`{"captrue":{}}`))
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("unknown section: status %d, want 400", resp.StatusCode)
+	}
+}
+
+func TestIntegration_ExtensibleMatchFilter(t *testing.T) {
+	srv := startTestServer(t, "", "")
+	defer srv.stop()
+
+	srv.setMock(t, `
+users:
+  - cn: "uid=john,ou=people,dc=example"
+    attrs:
+      memberOf: "cn=admins,dc=example"
+  - cn: "uid=jane,ou=people,dc=example"
+    attrs:
+      memberOf: "cn=users,dc=example"
+`)
+
+	conn := srv.ldapDial(t)
+	defer conn.Close()
+
+	result, err := conn.Search(ldap.NewSearchRequest("dc=example", ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		0, 0, false, "(memberOf:1.2.840.113556.1.4.1941:=CN=Admins,DC=example)", nil, nil))
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+
+	if len(result.Entries) != 1 || result.Entries[0].DN != "uid=john,ou=people,dc=example" {
+		t.Errorf("entries = %v, want only john", result.Entries)
+	}
+}
+
+func TestIntegration_AttributeSyntaxes(t *testing.T) {
+	srv := startTestServer(t, "", "")
+	defer srv.stop()
+
+	srv.setMock(t, `
+attributes:
+  userPassword: caseExact
+  uidNumber: integer
+users:
+  - cn: "uid=john,dc=example"
+    attrs:
+      userPassword: "Secret"
+      uidNumber: "1000"
+  - cn: "uid=jane,dc=example"
+    attrs:
+      userPassword: "secret"
+      uidNumber: "900"
+`)
+
+	conn := srv.ldapDial(t)
+	defer conn.Close()
+
+	tests := []struct {
+		filter string
+		want   string
+	}{
+		{filter: "(userPassword=secret)", want: "uid=jane,dc=example"},
+		{filter: "(uidNumber>=950)", want: "uid=john,dc=example"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			result, err := conn.Search(ldap.NewSearchRequest("dc=example", ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+				0, 0, false, tt.filter, nil, nil))
+			if err != nil {
+				t.Fatalf("search: %v", err)
+			}
+
+			if len(result.Entries) != 1 || result.Entries[0].DN != tt.want {
+				t.Errorf("entries = %v, want only %s", result.Entries, tt.want)
+			}
+		})
+	}
+}
+
+func TestIntegration_FallbackGroups(t *testing.T) {
+	srv := startTestServer(t, "", "")
+	defer srv.stop()
+
+	srv.setMock(t, `
+users:
+  - cn: "uid=john,dc=example"
+    attrs:
+      mail: "john@example"
+  - cn: "uid=jane,dc=example"
+groups:
+  - cn: "cn=admins,dc=example"
+    members:
+      - "uid=john,dc=example"
+`)
+
+	conn := srv.ldapDial(t)
+	defer conn.Close()
+
+	search := func(filter string, sizeLimit int, attrs ...string) (*ldap.SearchResult, error) {
+		return conn.Search(ldap.NewSearchRequest("dc=example", ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+			sizeLimit, 0, false, filter, attrs, nil))
+	}
+
+	result, err := search("(objectClass=*)", 0, "mail")
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if len(result.Entries) != 3 {
+		t.Fatalf("entries = %d, want users and group", len(result.Entries))
+	}
+	if got := result.Entries[0].GetAttributeValue("mail"); got != "john@example" {
+		t.Errorf("mail = %q, want john@example", got)
+	}
+	if got := result.Entries[2].GetAttributeValues("member"); len(got) != 0 {
+		t.Errorf("member = %v, want it omitted", got)
+	}
+
+	result, err = search("(member=UID=John,DC=example)", 0)
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if len(result.Entries) != 1 || result.Entries[0].DN != "cn=admins,dc=example" {
+		t.Errorf("entries = %v, want only the admins group", result.Entries)
+	}
+
+	result, err = search("(objectClass=*)", 2)
+	if !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		t.Fatalf("search error = %v, want sizeLimitExceeded", err)
+	}
+	if result == nil || len(result.Entries) != 2 {
+		t.Errorf("result = %v, want 2 entries", result)
+	}
+}
+
+func TestIntegration_LargeSearchResult(t *testing.T) {
+	srv := startTestServer(t, "", "")
+	defer srv.stop()
+
+	const count = 5000
+
+	users := make([]User, count)
+	for i := range users {
+		users[i] = User{CN: fmt.Sprintf("uid=user%d,dc=example", i), Attrs: map[string]string{"uid": fmt.Sprintf("user%d", i)}}
+	}
+	srv.ldapSrv.SetMock(LDAPMock{Users: users})
+
+	conn := srv.ldapDial(t)
+	defer conn.Close()
+
+	result, err := conn.Search(ldap.NewSearchRequest("dc=example", ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		0, 0, false, "(objectClass=*)", nil, nil))
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+
+	if len(result.Entries) != count {
+		t.Fatalf("entries = %d, want %d", len(result.Entries), count)
+	}
+	if last := result.Entries[count-1]; last.DN != users[count-1].CN || last.GetAttributeValue("uid") != "user4999" {
+		t.Errorf("last entry = %s %v, want %s", last.DN, last.Attributes, users[count-1].CN)
+	}
+}
+
+func TestIntegration_RuleBandwidth(t *testing.T) {
+	srv := startTestServer(t, "", "")
+	defer srv.stop()
+
+	description := strings.Repeat("x", 200)
+	srv.setMock(t, `
+rules:
+  - filter: "(objectClass=person)"
+    bandwidth: 1KB/s
+    response:
+      users:
+        - cn: "uid=john,dc=example"
+          attrs:
+            description: `+description+`
+        - cn: "uid=jane,dc=example"
+          attrs:
+            description: `+description+`
+`)
+
+	conn := srv.ldapDial(t)
+	defer conn.Close()
+
+	req := ldap.NewSearchRequest("dc=example", ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases, 0, 0, false, "(objectClass=person)", nil, nil)
+
+	// About 500 bytes at 1KB/s.
+	start := time.Now()
+	result, err := conn.Search(req)
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("search took %v, want the response trickled over about 500ms", elapsed)
+	}
+	if len(result.Entries) != 2 || result.Entries[1].GetAttributeValue("description") != description {
+		t.Errorf("entries = %+v, want both users", result.Entries)
+	}
+
+	conn.SetTimeout(100 * time.Millisecond)
+	if _, err := conn.Search(req); err == nil {
+		t.Error("expected a client timeout")
+	}
+}
+
+func TestIntegration_ChaosBindFailures(t *testing.T) {
+	srv := startTestServer(t, "cn=admin", "secret")
+	defer srv.stop()
+
+	configURL := fmt.Sprintf("http://localhost:%s/config", srv.mockPort)
+	setChaos := func(body string) (int, RuntimeConfig) {
+		t.Helper()
+
+		resp, err := http.Post(configURL, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("post config: %v", err)
+		}
+		defer resp.Body.Close()
+
+		var cfg RuntimeConfig
+		_ = json.NewDecoder(resp.Body).Decode(&cfg)
+
+		return resp.StatusCode, cfg
+	}
+
+	status, cfg := setChaos(`{"chaos":{"bind_failure_ratio":1,"bind_failure_code":52}}`)
+	if status != http.StatusOK || cfg.Chaos == nil || cfg.Chaos.BindFailureRatio != 1 {
+		t.Fatalf("set chaos: status %d, config %+v", status, cfg.Chaos)
+	}
+
+	conn := srv.ldapDial(t)
+	defer conn.Close()
+
+	for range 3 {
+		if err := conn.Bind("cn=admin", "secret"); !ldap.IsErrorWithCode(err, ldap.LDAPResultUnavailable) {
+			t.Fatalf("bind: err = %v, want unavailable", err)
+		}
+	}
+
+	// Left-out fields keep their values: the code stays 52.
+	if status, cfg = setChaos(`{"chaos":{"bind_failure_ratio":0}}`); status != http.StatusOK || cfg.Chaos.BindFailureCode != 52 {
+		t.Fatalf("disable chaos: status %d, config %+v", status, cfg.Chaos)
+	}
+	if err := conn.Bind("cn=admin", "secret"); err != nil {
+		t.Errorf("bind without chaos: %v", err)
+	}
+
+	for _, body := range []string{
+		`{"chaos":{"bind_failure_ratio":2}}`,
+		`{"chaos":{"bind_failure_code":50}}`,
+		`{"chaos":{"search_failure_ratio":0.5}}`,
+	} {
+		if status, _ := setChaos(body); status != http.StatusBadRequest {
+			t.Errorf("POST %s: status = %d, want 400", body, status)
+		}
+	}
+}
+
+func TestIntegration_GracefulShutdown(t *testing.T) {
+	const mock = `
+rules:
+  - filter: "(uid=slow)"
+    delay: 300ms
+    response:
+      users:
+        - cn: "uid=slow,dc=example"
+`
+	slowSearch := ldap.NewSearchRequest("dc=example", ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases, 0, 0, false, "(uid=slow)", nil, nil)
+
+	t.Run("drains in-flight searches", func(t *testing.T) {
+		srv := startTestServer(t, "", "")
+		srv.setMock(t, mock)
+
+		busy := srv.ldapDial(t)
+		defer busy.Close()
+		idle := srv.ldapDial(t)
+		defer idle.Close()
+
+		searchErr := make(chan error, 1)
+		go func() {
+			_, err := busy.Search(slowSearch)
+			searchErr <- err
+		}()
+
+		time.Sleep(100 * time.Millisecond)
+		srv.stop()
+
+		if err := <-searchErr; err != nil {
+			t.Errorf("in-flight search: %v", err)
+		}
+		if _, err := idle.Search(slowSearch); err == nil {
+			t.Error("search on an idle connection after shutdown: expected it to be closed")
+		}
+		if _, err := net.Dial("tcp", "localhost:"+srv.ldapPort); err == nil {
+			t.Error("dial after shutdown: expected the listener to be closed")
+		}
+	})
+
+	t.Run("drain timeout", func(t *testing.T) {
+		srv := startTestServer(t, "", "")
+		srv.setMock(t, mock)
+		srv.ldapSrv.SetDrainTimeout(50 * time.Millisecond)
+
+		conn := srv.ldapDial(t)
+		defer conn.Close()
+
+		searchErr := make(chan error, 1)
+		go func() {
+			_, err := conn.Search(slowSearch)
+			searchErr <- err
+		}()
+
+		time.Sleep(100 * time.Millisecond)
+
+		start := time.Now()
+		srv.stop()
+		if elapsed := time.Since(start); elapsed > 150*time.Millisecond {
+			t.Errorf("shutdown took %v, want about the drain timeout", elapsed)
+		}
+
+		if err := <-searchErr; err == nil {
+			t.Error("search cut by the drain timeout: expected an error")
+		}
+	})
+}
+
+func TestIntegration_Outage(t *testing.T) {
+	srv := startTestServer(t, "cn=admin", "secret")
+	defer srv.stop()
+
+	outageURL := fmt.Sprintf("http://localhost:%s/chaos/outage", srv.mockPort)
+	setOutage := func(body string) (int, Outage) {
+		t.Helper()
+
+		resp, err := http.Post(outageURL, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("post outage: %v", err)
+		}
+		defer resp.Body.Close()
+
+		var outage Outage
+		_ = json.NewDecoder(resp.Body).Decode(&outage)
+
+		return resp.StatusCode, outage
+	}
+
+	req := ldap.NewSearchRequest("dc=example", ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases, 0, 0, false, "(uid=john)", nil, nil)
+
+	t.Run("unavailable", func(t *testing.T) {
+		status, outage := setOutage(`{"enabled":true}`)
+		if status != http.StatusOK || !outage.Enabled || outage.Mode != OutageUnavailable || outage.Until != nil {
+			t.Fatalf("start outage: status %d, outage %+v", status, outage)
+		}
+
+		conn := srv.ldapDial(t)
+		defer conn.Close()
+
+		if err := conn.Bind("cn=admin", "secret"); !ldap.IsErrorWithCode(err, ldap.LDAPResultUnavailable) {
+			t.Errorf("bind: err = %v, want unavailable", err)
+		}
+		if _, err := conn.Search(req); !ldap.IsErrorWithCode(err, ldap.LDAPResultUnavailable) {
+			t.Errorf("search: err = %v, want unavailable", err)
+		}
+
+		if status, outage = setOutage(`{"enabled":false}`); status != http.StatusOK || outage.Enabled {
+			t.Fatalf("end outage: status %d, outage %+v", status, outage)
+		}
+		if err := conn.Bind("cn=admin", "secret"); err != nil {
+			t.Errorf("bind after outage: %v", err)
+		}
+	})
+
+	t.Run("refuse with duration", func(t *testing.T) {
+		conn := srv.ldapDial(t)
+		defer conn.Close()
+
+		status, outage := setOutage(`{"enabled":true,"mode":"refuse","duration":"300ms"}`)
+		if status != http.StatusOK || outage.Mode != OutageRefuse || outage.Until == nil {
+			t.Fatalf("start outage: status %d, outage %+v", status, outage)
+		}
+
+		if err := conn.Bind("cn=admin", "secret"); err == nil {
+			t.Error("bind on an open connection: expected the connection to be closed")
+		}
+
+		refused := srv.ldapDial(t)
+		if err := refused.Bind("cn=admin", "secret"); err == nil {
+			t.Error("bind on a new connection: expected the connection to be closed")
+		}
+		refused.Close()
+
+		time.Sleep(400 * time.Millisecond)
+
+		resp, err := http.Get(outageURL)
+		if err != nil {
+			t.Fatalf("get outage: %v", err)
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&outage)
+		resp.Body.Close()
+		if outage.Enabled {
+			t.Errorf("outage = %+v, want it ended after its duration", outage)
+		}
+
+		after := srv.ldapDial(t)
+		defer after.Close()
+		if err := after.Bind("cn=admin", "secret"); err != nil {
+			t.Errorf("bind after outage: %v", err)
+		}
+	})
+
+	for _, body := range []string{`{"enabled":true,"mode":"partial"}`, `{"enabled":true,"duration":"soon"}`, `{"on":true}`} {
+		if status, _ := setOutage(body); status != http.StatusBadRequest {
+			t.Errorf("POST %s: status = %d, want 400", body, status)
+		}
+	}
+}
+
+func TestIntegration_ChaosBusy(t *testing.T) {
+	srv := startTestServer(t, "", "")
+	defer srv.stop()
+
+	srv.setMock(t, `
+rules:
+  - filter: "(uid=slow)"
+    delay: 300ms
+    response:
+      users:
+        - cn: "uid=slow,dc=example"
+`)
+	if err := srv.ldapSrv.SetChaos(ChaosConfig{MaxConcurrentSearches: 1}); err != nil {
+		t.Fatalf("set chaos: %v", err)
+	}
+
+	search := func(conn *ldap.Conn) error {
+		_, err := conn.Search(ldap.NewSearchRequest("dc=example", ldap.ScopeWholeSubtree,
+			ldap.NeverDerefAliases, 0, 0, false, "(uid=slow)", nil, nil))
+		return err
+	}
+
+	first := srv.ldapDial(t)
+	defer first.Close()
+	second := srv.ldapDial(t)
+	defer second.Close()
+
+	firstErr := make(chan error, 1)
+	go func() { firstErr <- search(first) }()
+
+	time.Sleep(100 * time.Millisecond)
+	if err := search(second); !ldap.IsErrorWithCode(err, ldap.LDAPResultBusy) {
+		t.Errorf("search above the limit: err = %v, want busy", err)
+	}
+
+	if err := <-firstErr; err != nil {
+		t.Errorf("search within the limit: %v", err)
+	}
+	if err := search(second); err != nil {
+		t.Errorf("search after the first one finished: %v", err)
+	}
+
+	if err := srv.ldapSrv.SetChaos(ChaosConfig{MaxConcurrentSearches: -1}); err == nil {
+		t.Error("expected error for a negative limit")
+	}
+}
+
+func TestIntegration_RateLimit(t *testing.T) {
+	srv := startTestServer(t, "cn=admin", "secret")
+	defer srv.stop()
+
+	configURL := fmt.Sprintf("http://localhost:%s/config", srv.mockPort)
+	setRateLimit := func(body string) (int, RuntimeConfig) {
+		t.Helper()
+
+		resp, err := http.Post(configURL, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("post config: %v", err)
+		}
+		defer resp.Body.Close()
+
+		var cfg RuntimeConfig
+		_ = json.NewDecoder(resp.Body).Decode(&cfg)
+
+		return resp.StatusCode, cfg
+	}
+
+	search := func(conn *ldap.Conn) error {
+		_, err := conn.Search(ldap.NewSearchRequest("dc=example", ldap.ScopeWholeSubtree,
+			ldap.NeverDerefAliases, 0, 0, false, "(uid=john)", nil, nil))
+		return err
+	}
+
+	t.Run("reject", func(t *testing.T) {
+		status, cfg := setRateLimit(`{"rate_limit":{"requests_per_second":0.5,"burst":2}}`)
+		if status != http.StatusOK || cfg.RateLimit == nil || cfg.RateLimit.Action != RateLimitReject {
+			t.Fatalf("set rate limit: status %d, config %+v", status, cfg.RateLimit)
+		}
+
+		conn := srv.ldapDial(t)
+		defer conn.Close()
+
+		if err := conn.Bind("cn=admin", "secret"); err != nil {
+			t.Fatalf("bind: %v", err)
+		}
+		if err := search(conn); err != nil {
+			t.Fatalf("search within the burst: %v", err)
+		}
+		if err := search(conn); !ldap.IsErrorWithCode(err, ldap.LDAPResultBusy) {
+			t.Errorf("search above the limit: err = %v, want busy", err)
+		}
+		if err := conn.Bind("cn=admin", "secret"); !ldap.IsErrorWithCode(err, ldap.LDAPResultBusy) {
+			t.Errorf("bind above the limit: err = %v, want busy", err)
+		}
+
+		if logs := srv.ldapSrv.RequestLogger().List(); logs[0].Result != "Busy" {
+			t.Errorf("request log result = %q, want Busy", logs[0].Result)
+		}
+
+		// Changing the limit forgets past requests.
+		if status, _ := setRateLimit(`{"rate_limit":{"burst":1}}`); status != http.StatusOK {
+			t.Fatalf("change burst: status %d", status)
+		}
+		if err := search(conn); err != nil {
+			t.Errorf("search after the change: %v", err)
+		}
+	})
+
+	t.Run("delay", func(t *testing.T) {
+		if err := srv.ldapSrv.SetRateLimit(RateLimitConfig{RequestsPerSecond: 10, Burst: 1, Action: RateLimitDelay}); err != nil {
+			t.Fatalf("set rate limit: %v", err)
+		}
+		defer func() { _ = srv.ldapSrv.SetRateLimit(RateLimitConfig{}) }()
+
+		conn := srv.ldapDial(t)
+		defer conn.Close()
+
+		start := time.Now()
+		for range 3 {
+			if err := search(conn); err != nil {
+				t.Fatalf("search: %v", err)
+			}
+		}
+		if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+			t.Errorf("3 searches took %v, want them spread over at least 200ms", elapsed)
+		}
+	})
+
+	for _, body := range []string{
+		`{"rate_limit":{"requests_per_second":-1}}`,
+		`{"rate_limit":{"burst":-1}}`,
+		`{"rate_limit":{"action":"drop"}}`,
+		`{"rate_limit":{"per_client":true}}`,
+	} {
+		if status, _ := setRateLimit(body); status != http.StatusBadRequest {
+			t.Errorf("POST %s: status = %d, want 400", body, status)
+		}
+	}
+}
+
+func TestIntegration_ReadOnly(t *testing.T) {
+	srv := startTestServer(t, "", "")
+	defer srv.stop()
+
+	configURL := fmt.Sprintf("http://localhost:%s/config", srv.mockPort)
+	resp, err := http.Post(configURL, "application/json",
+		strings.NewReader(`{"read_only":{"enabled":true,"message":"replica is read-only"}}`))
+	if err != nil {
+		t.Fatalf("post config: %v", err)
+	}
+	var cfg RuntimeConfig
+	_ = json.NewDecoder(resp.Body).Decode(&cfg)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || cfg.ReadOnly == nil || !cfg.ReadOnly.Enabled {
+		t.Fatalf("enable read-only: status %d, config %+v", resp.StatusCode, cfg.ReadOnly)
+	}
+
+	conn := srv.ldapDial(t)
+	defer conn.Close()
+
+	add := ldap.NewAddRequest("uid=new,dc=example", nil)
+	add.Attribute("uid", []string{"new"})
+	modify := ldap.NewModifyRequest("uid=john,dc=example", nil)
+	modify.Replace("mail", []string{"john@example.org"})
+	del := ldap.NewDelRequest("uid=john,dc=example", nil)
+	modifyDN := ldap.NewModifyDNRequest("uid=john,dc=example", "uid=jon", true, "")
+
+	writes := map[string]func() error{
+		"add":       func() error { return conn.Add(add) },
+		"delete":    func() error { return conn.Del(del) },
+		"modify":    func() error { return conn.Modify(modify) },
+		"modify_dn": func() error { return conn.ModifyDN(modifyDN) },
+	}
+	for name, write := range writes {
+		err := write()
+
+		var ldapErr *ldap.Error
+		if !errors.As(err, &ldapErr) || ldapErr.ResultCode != ldap.LDAPResultUnwillingToPerform ||
+			!strings.Contains(ldapErr.Err.Error(), "replica is read-only") {
+			t.Errorf("%s: err = %v, want unwillingToPerform with the configured message", name, err)
+		}
+	}
+
+	logs := srv.ldapSrv.RequestLogger().List()
+	if len(logs) != len(writes) {
+		t.Fatalf("request log has %d entries, want %d", len(logs), len(writes))
+	}
+	for _, log := range logs {
+		if _, ok := writes[log.Type]; !ok || log.Result != "Unwilling To Perform" {
+			t.Errorf("request log entry %s: result %q", log.Type, log.Result)
+		}
+	}
+}
+
+func TestIntegration_Add(t *testing.T) {
+	srv := startTestServer(t, "", "")
+	defer srv.stop()
+
+	srv.setMock(t, `
+users:
+  - cn: "uid=john,dc=example"
+    attrs:
+      uid: john
+`)
+
+	conn := srv.ldapDial(t)
+	defer conn.Close()
+
+	add := ldap.NewAddRequest("uid=jane,dc=example", nil)
+	add.Attribute("objectClass", []string{"top", "inetOrgPerson"})
+	add.Attribute("uid", []string{"jane"})
+	add.Attribute("mail", []string{"jane@example.com"})
+	if err := conn.Add(add); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+
+	err := conn.Add(add)
+	if !ldap.IsErrorWithCode(err, ldap.LDAPResultEntryAlreadyExists) {
+		t.Errorf("second add: err = %v, want entryAlreadyExists", err)
+	}
+
+	res, err := conn.Search(ldap.NewSearchRequest("dc=example", ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		0, 0, false, "(uid=jane)", nil, nil))
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if len(res.Entries) != 1 || res.Entries[0].GetAttributeValue("mail") != "jane@example.com" {
+		t.Errorf("search entries = %+v, want the added entry", res.Entries)
+	}
+
+	resp, err := http.Get(fmt.Sprintf("http://localhost:%s/mock", srv.mockPort))
+	if err != nil {
+		t.Fatalf("get mock: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var data struct {
+		Mock LDAPMock `json:"mock"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		t.Fatalf("decode mock: %v", err)
+	}
+	if len(data.Mock.Users) != 2 || data.Mock.Users[1].CN != "uid=jane,dc=example" {
+		t.Errorf("mock users = %+v, want john and jane", data.Mock.Users)
+	}
+
+	logs := srv.ldapSrv.RequestLogger().List()
+	if len(logs) < 3 || logs[1].Type != "add" || logs[1].Result != "Entry Already Exists" ||
+		logs[2].Type != "add" || logs[2].Result != "Success" || logs[2].BaseDN != "uid=jane,dc=example" {
+		t.Errorf("request log = %+v, want the two adds", logs)
+	}
+}
+
+func TestIntegration_ModifyIncrement(t *testing.T) {
+	srv := startTestServer(t, "", "")
+	defer srv.stop()
+
+	srv.setMock(t, `
+users:
+  - cn: "cn=uidNext,dc=example"
+    attrs:
+      cn: uidNext
+      uidNumber: "1000"
+`)
+
+	conn := srv.ldapDial(t)
+	defer conn.Close()
+
+	res, err := conn.Search(ldap.NewSearchRequest("", ldap.ScopeBaseObject, ldap.NeverDerefAliases,
+		0, 0, false, "(objectClass=*)", []string{"supportedFeatures"}, nil))
+	if err != nil {
+		t.Fatalf("root DSE search: %v", err)
+	}
+	if len(res.Entries) != 1 || !slices.Contains(res.Entries[0].GetAttributeValues("supportedFeatures"), ModifyIncrementFeature) {
+		t.Errorf("root DSE = %+v, want the Modify-Increment feature", res.Entries)
+	}
+
+	for range 2 {
+		modify := ldap.NewModifyRequest("cn=uidNext,dc=example", nil)
+		modify.Increment("uidNumber", "1")
+		if err := conn.Modify(modify); err != nil {
+			t.Fatalf("increment: %v", err)
+		}
+	}
+
+	modify := ldap.NewModifyRequest("cn=uidNext,dc=example", nil)
+	modify.Increment("cn", "1")
+	if err := conn.Modify(modify); !ldap.IsErrorWithCode(err, ldap.LDAPResultConstraintViolation) {
+		t.Errorf("increment of cn: err = %v, want constraintViolation", err)
+	}
+
+	res, err = conn.Search(ldap.NewSearchRequest("dc=example", ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		0, 0, false, "(uidNumber=1002)", nil, nil))
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if len(res.Entries) != 1 || res.Entries[0].GetAttributeValue("uidNumber") != "1002" {
+		t.Errorf("search entries = %+v, want uidNumber 1002", res.Entries)
+	}
+
+	logs := srv.ldapSrv.RequestLogger().List()
+	if len(logs) < 3 || logs[1].Type != "modify" || logs[1].Result != "Constraint Violation" ||
+		logs[2].Type != "modify" || logs[2].Result != "Success" || logs[2].BaseDN != "cn=uidNext,dc=example" {
+		t.Errorf("request log = %+v, want the modifies", logs)
+	}
+}
+
+func TestIntegration_Compare(t *testing.T) {
+	srv := startTestServer(t, "", "")
+	defer srv.stop()
+
+	srv.setMock(t, `
+users:
+  - cn: "uid=john,dc=example"
+    attrs:
+      uid: john
+groups:
+  - cn: "cn=admins,dc=example"
+    members:
+      - "uid=john,dc=example"
+`)
+
+	conn := srv.ldapDial(t)
+	defer conn.Close()
+
+	if ok, err := conn.Compare("cn=admins,dc=example", "member", "uid=john,dc=example"); err != nil || !ok {
+		t.Errorf("compare member john = %v, %v, want true", ok, err)
+	}
+	if ok, err := conn.Compare("cn=admins,dc=example", "member", "uid=jane,dc=example"); err != nil || ok {
+		t.Errorf("compare member jane = %v, %v, want false", ok, err)
+	}
+	if _, err := conn.Compare("cn=users,dc=example", "member", "uid=john,dc=example"); !ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+		t.Errorf("compare on a missing entry: err = %v, want noSuchObject", err)
+	}
+
+	logs := srv.ldapSrv.RequestLogger().List()
+	if len(logs) != 3 || logs[2].Type != "compare" || logs[2].Result != "Compare True" || logs[1].Result != "Compare False" {
+		t.Errorf("request log = %+v, want the three compares", logs)
+	}
+}
+
+func TestIntegration_Syncrepl(t *testing.T) {
+	srv := startTestServer(t, "", "")
+	defer srv.stop()
+
+	srv.setMock(t, `
+users:
+  - cn: "uid=john,dc=example"
+    attrs:
+      uid: john
+  - cn: "uid=bob,dc=other"
+    attrs:
+      uid: bob
+`)
+
+	conn := srv.ldapDial(t)
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	resp := conn.Syncrepl(ctx, ldap.NewSearchRequest("dc=example", ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		0, 0, false, "(uid=*)", nil, nil), 16, ldap.SyncRequestModeRefreshAndPersist, nil, false)
+
+	type syncMessage struct {
+		dn    string
+		state ldap.ControlSyncStateState
+		info  bool
+	}
+	next := func() syncMessage {
+		t.Helper()
+
+		if !resp.Next() {
+			t.Fatalf("sync ended: %v", resp.Err())
+		}
+
+		var msg syncMessage
+		if entry := resp.Entry(); entry != nil {
+			msg.dn = entry.DN
+		}
+		for _, control := range resp.Controls() {
+			switch control := control.(type) {
+			case *ldap.ControlSyncState:
+				msg.state = control.State
+				if control.EntryUUID != entryUUID(msg.dn) {
+					t.Errorf("entry UUID of %s = %s", msg.dn, control.EntryUUID)
+				}
+			case *ldap.ControlSyncInfo:
+				msg.info = control.RefreshPresent != nil && control.RefreshPresent.RefreshDone
+			}
+		}
+
+		return msg
+	}
+
+	// Rules and fallback entries are not scoped by base DN: bob is sent too.
+	refresh := []syncMessage{next(), next()}
+	if refresh[0] != (syncMessage{dn: "uid=john,dc=example", state: ldap.SyncStateAdd}) ||
+		refresh[1] != (syncMessage{dn: "uid=bob,dc=other", state: ldap.SyncStateAdd}) {
+		t.Errorf("refresh = %+v, want john and bob added", refresh)
+	}
+	if msg := next(); !msg.info {
+		t.Fatalf("message = %+v, want the end of the refresh stage", msg)
+	}
+
+	writer := srv.ldapDial(t)
+	defer writer.Close()
+
+	add := ldap.NewAddRequest("uid=jane,dc=example", nil)
+	add.Attribute("uid", []string{"jane"})
+	if err := writer.Add(add); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if msg := next(); msg != (syncMessage{dn: "uid=jane,dc=example", state: ldap.SyncStateAdd}) {
+		t.Errorf("message = %+v, want jane added", msg)
+	}
+
+	// Changes out of the base DN are not sent.
+	srv.setMock(t, `
+users:
+  - cn: "uid=john,dc=example"
+    attrs:
+      uid: john
+      mail: john@example.com
+`)
+	if msg := next(); msg != (syncMessage{dn: "uid=john,dc=example", state: ldap.SyncStateModify}) {
+		t.Errorf("message = %+v, want john modified", msg)
+	}
+	if msg := next(); msg != (syncMessage{dn: "uid=jane,dc=example", state: ldap.SyncStateDelete}) {
+		t.Errorf("message = %+v, want jane deleted", msg)
+	}
+
+	res, err := writer.Search(ldap.NewSearchRequest("dc=example", ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		0, 0, false, "(uid=*)", nil, []ldap.Control{ldap.NewControlSyncRequest(ldap.SyncRequestModeRefreshOnly, nil, false)}))
+	if err != nil {
+		t.Fatalf("refreshOnly search: %v", err)
+	}
+	if len(res.Entries) != 1 || ldap.FindControl(res.Controls, ldap.ControlTypeSyncDone) == nil {
+		t.Errorf("refreshOnly result = %d entries, controls %v, want john and sync done", len(res.Entries), res.Controls)
+	}
+	// An entry that no longer matches the filter is deleted for the client.
+	srv.setMock(t, `
+users:
+  - cn: "uid=john,dc=example"
+    attrs:
+      mail: john@example.com
+`)
+	if msg := next(); msg != (syncMessage{dn: "uid=john,dc=example", state: ldap.SyncStateDelete}) {
+		t.Errorf("message = %+v, want john deleted", msg)
+	}
+}
+
+func TestIntegration_SyncreplCookie(t *testing.T) {
+	srv := startTestServer(t, "", "")
+	defer srv.stop()
+
+	srv.setMock(t, `
+users:
+  - cn: "uid=john,dc=example"
+    attrs:
+      uid: john
+  - cn: "uid=jane,dc=example"
+    attrs:
+      uid: jane
+`)
+
+	conn := srv.ldapDial(t)
+	defer conn.Close()
+
+	type syncMessage struct {
+		dn    string
+		state ldap.ControlSyncStateState
+	}
+	refresh := func(cookie []byte) ([]syncMessage, *ldap.ControlSyncDone, error) {
+		t.Helper()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		resp := conn.Syncrepl(ctx, ldap.NewSearchRequest("dc=example", ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+			0, 0, false, "(uid=*)", nil, nil), 16, ldap.SyncRequestModeRefreshOnly, cookie, false)
+
+		var (
+			messages []syncMessage
+			done     *ldap.ControlSyncDone
+		)
+		for resp.Next() {
+			for _, control := range resp.Controls() {
+				switch control := control.(type) {
+				case *ldap.ControlSyncState:
+					messages = append(messages, syncMessage{dn: resp.Entry().DN, state: control.State})
+				case *ldap.ControlSyncDone:
+					done = control
+				}
+			}
+		}
+
+		return messages, done, resp.Err()
+	}
+
+	messages, done, err := refresh(nil)
+	if err != nil || len(messages) != 2 || done == nil || done.RefreshDeletes {
+		t.Fatalf("full refresh = %+v, %+v, %v, want john and jane", messages, done, err)
+	}
+	fullCookie := done.Cookie
+
+	// Only the changes since the cookie are sent, and unchanged entries are
+	// kept.
+	srv.setMock(t, `
+users:
+  - cn: "uid=john,dc=example"
+    attrs:
+      uid: john
+      mail: john@example.com
+  - cn: "uid=joe,dc=example"
+    attrs:
+      uid: joe
+`)
+
+	messages, done, err = refresh(done.Cookie)
+	want := []syncMessage{
+		{dn: "uid=john,dc=example", state: ldap.SyncStateModify},
+		{dn: "uid=joe,dc=example", state: ldap.SyncStateAdd},
+		{dn: "uid=jane,dc=example", state: ldap.SyncStateDelete},
+	}
+	if err != nil || !reflect.DeepEqual(messages, want) {
+		t.Errorf("incremental refresh = %+v, %v, want %+v", messages, err, want)
+	}
+	if done == nil || !done.RefreshDeletes {
+		t.Fatalf("sync done = %+v, want refreshDeletes", done)
+	}
+
+	if messages, _, err := refresh(done.Cookie); err != nil || len(messages) != 0 {
+		t.Errorf("refresh without changes = %+v, %v, want none", messages, err)
+	}
+
+	// An entry that no longer matches the filter is deleted for the client.
+	srv.setMock(t, `
+users:
+  - cn: "uid=john,dc=example"
+    attrs:
+      mail: john@example.com
+  - cn: "uid=joe,dc=example"
+    attrs:
+      uid: joe
+`)
+
+	messages, done, err = refresh(done.Cookie)
+	if want := []syncMessage{{dn: "uid=john,dc=example", state: ldap.SyncStateDelete}}; err != nil || !reflect.DeepEqual(messages, want) {
+		t.Errorf("refresh after john stopped matching = %+v, %v, want %+v", messages, err, want)
+	}
+	if done == nil {
+		t.Fatal("no sync done")
+	}
+
+	// Cookies whose changes are no longer kept need a full refresh; the
+	// newest one is still good.
+	srv.ldapSrv.changelog.mu.Lock()
+	srv.ldapSrv.changelog.capacity = 1
+	srv.ldapSrv.changelog.mu.Unlock()
+
+	srv.setMock(t, `
+users:
+  - cn: "uid=joe,dc=example"
+    attrs:
+      uid: joe
+`)
+
+	if messages, _, err := refresh(done.Cookie); err != nil || len(messages) != 1 || messages[0].state != ldap.SyncStateDelete {
+		t.Errorf("refresh after the last cookie = %+v, %v, want john deleted", messages, err)
+	}
+	for _, cookie := range []string{string(fullCookie), "999999", "not a cookie"} {
+		if _, _, err := refresh([]byte(cookie)); !ldap.IsErrorWithCode(err, ldap.LDAPResultSyncRefreshRequired) {
+			t.Errorf("refresh with cookie %q: %v, want e-syncRefreshRequired", cookie, err)
+		}
+	}
+}
+
+func TestIntegration_DirSync(t *testing.T) {
+	srv := startTestServer(t, "", "")
+	defer srv.stop()
+
+	srv.setMock(t, `
+users:
+  - cn: "uid=john,dc=example"
+    attrs:
+      uid: john
+  - cn: "uid=jane,dc=example"
+    attrs:
+      uid: jane
+`)
+
+	conn := srv.ldapDial(t)
+	defer conn.Close()
+
+	// DirSync reuses the control of its request: each call needs a new one.
+	newRequest := func() *ldap.SearchRequest {
+		return ldap.NewSearchRequest("dc=example", ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+			0, 0, false, "(uid=*)", []string{"uid", "objectGUID"}, nil)
+	}
+	dirSync := func(cookie []byte) (*ldap.SearchResult, []byte) {
+		t.Helper()
+
+		res, err := conn.DirSync(newRequest(), 0, 0, cookie)
+		if err != nil {
+			t.Fatalf("dirsync: %v", err)
+		}
+
+		control, ok := ldap.FindControl(res.Controls, ldap.ControlTypeDirSync).(*ldap.ControlDirSync)
+		if !ok || len(control.Cookie) == 0 {
+			t.Fatalf("dirsync controls = %v, want a cookie", res.Controls)
+		}
+
+		return res, control.Cookie
+	}
+
+	res, cookie := dirSync(nil)
+	if len(res.Entries) != 2 {
+		t.Fatalf("full sync = %d entries, want 2", len(res.Entries))
+	}
+	if id := entryUUID("uid=john,dc=example"); string(res.Entries[0].GetRawAttributeValue("objectGUID")) != string(id[:]) {
+		t.Errorf("objectGUID of %s = %x, want %x", res.Entries[0].DN, res.Entries[0].GetRawAttributeValue("objectGUID"), id)
+	}
+
+	if res, _ = dirSync(cookie); len(res.Entries) != 0 {
+		t.Errorf("sync without changes = %d entries, want none", len(res.Entries))
+	}
+
+	add := ldap.NewAddRequest("uid=bob,dc=example", nil)
+	add.Attribute("uid", []string{"bob"})
+	if err := conn.Add(add); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	srv.setMock(t, `
+users:
+  - cn: "uid=john,dc=example"
+    attrs:
+      uid: john
+      mail: john@example.com
+  - cn: "uid=bob,dc=example"
+    attrs:
+      uid: bob
+`)
+
+	res, cookie = dirSync(cookie)
+	got := make(map[string]string, len(res.Entries))
+	for _, entry := range res.Entries {
+		got[entry.DN] = entry.GetAttributeValue("uid") + entry.GetAttributeValue("isDeleted")
+	}
+	want := map[string]string{"uid=bob,dc=example": "bob", "uid=john,dc=example": "john", "uid=jane,dc=example": "TRUE"}
+	if len(got) != len(want) || got["uid=bob,dc=example"] != "bob" || got["uid=john,dc=example"] != "john" ||
+		got["uid=jane,dc=example"] != "TRUE" {
+		t.Errorf("incremental sync = %v, want %v", got, want)
+	}
+
+	if res, _ = dirSync(cookie); len(res.Entries) != 0 {
+		t.Errorf("sync after the changes = %d entries, want none", len(res.Entries))
+	}
+
+	if _, err := conn.DirSync(newRequest(), 0, 0, []byte("foreign cookie")); !ldap.IsErrorWithCode(err, ldap.LDAPResultUnwillingToPerform) {
+		t.Errorf("dirsync with a foreign cookie: %v, want unwillingToPerform", err)
+	}
+}
+
+func TestIntegration_JSScript(t *testing.T) {
+	srv := startTestServer(t, "", "")
+	defer srv.stop()
+
+	srv.ldapSrv.SetScriptEngine(NewJSScriptEngine(100 * time.Millisecond))
+	srv.setMock(t, `
+rules:
+  - filter: "(uid=*)"
+    filter_match: semantic
+    script: |
+      var uid = request.filter.match(/uid=([^)]*)/)[1];
+      return {users: [{cn: "uid=" + uid + "," + request.base_dn, attrs: {uid: uid, mail: uid + "@example.com"}}]};
+  - filter: "(cn=*)"
+    filter_match: semantic
+    script: "while (true) {}"
+`)
+
+	conn := srv.ldapDial(t)
+	defer conn.Close()
+
+	res, err := conn.Search(ldap.NewSearchRequest("ou=people,dc=example", ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		0, 0, false, "(uid=jane)", nil, nil))
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if len(res.Entries) != 1 || res.Entries[0].DN != "uid=jane,ou=people,dc=example" ||
+		res.Entries[0].GetAttributeValue("mail") != "jane@example.com" {
+		t.Errorf("entries = %+v, want jane computed by the script", res.Entries)
+	}
+
+	_, err = conn.Search(ldap.NewSearchRequest("dc=example", ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		0, 0, false, "(cn=x)", nil, nil))
+	if !ldap.IsErrorWithCode(err, ldap.LDAPResultOther) || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("endless script: err = %v, want other with a timeout", err)
+	}
+}
+
+func TestIntegration_WASM(t *testing.T) {
+	srv := startTestServer(t, "", "")
+	defer srv.stop()
+
+	srv.setMock(t, `
+rules:
+  - filter: "(uid=*)"
+    filter_match: semantic
+    wasm: testdata/wasm/echo.wasm
+`)
+
+	conn := srv.ldapDial(t)
+	defer conn.Close()
+
+	res, err := conn.Search(ldap.NewSearchRequest("dc=example", ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		0, 0, false, "(uid=jane)", nil, nil))
+	if !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) || !strings.Contains(err.Error(), `"filter":"(uid=jane)"`) {
+		t.Errorf("err = %v, want sizeLimitExceeded with the echoed request", err)
+	}
+	if res == nil || len(res.Entries) != 1 || res.Entries[0].DN != "uid=wasm,dc=example" {
+		t.Errorf("result = %+v, want the entry of the module", res)
+	}
+}
+
+func TestIntegration_DebugRuleAttribute(t *testing.T) {
+	srv := startTestServer(t, "", "")
+	defer srv.stop()
+
+	srv.setMock(t, `
+users:
+  - cn: "uid=jane,dc=example"
+    attrs:
+      uid: jane
+rules:
+  - name: john fixture
+    filter: "(uid=john)"
+    response:
+      users:
+        - cn: "uid=john,dc=example"
+          attrs:
+            uid: john
+`)
+
+	resp, err := http.Post(fmt.Sprintf("http://localhost:%s/config", srv.mockPort), "application/json",
+		strings.NewReader(`{"debug":{"rule_attribute":true}}`))
+	if err != nil {
+		t.Fatalf("post config: %v", err)
+	}
+	var cfg RuntimeConfig
+	_ = json.NewDecoder(resp.Body).Decode(&cfg)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || cfg.Debug == nil || !cfg.Debug.RuleAttribute {
+		t.Fatalf("enable debug: status %d, config %+v", resp.StatusCode, cfg.Debug)
+	}
+
+	conn := srv.ldapDial(t)
+	defer conn.Close()
+
+	search := func(filter string) *ldap.Entry {
+		t.Helper()
+
+		result, err := conn.Search(ldap.NewSearchRequest("dc=example", ldap.ScopeWholeSubtree,
+			ldap.NeverDerefAliases, 0, 0, false, filter, nil, nil))
+		if err != nil || len(result.Entries) != 1 {
+			t.Fatalf("search %s: %v, %d entries", filter, err, len(result.Entries))
+		}
+
+		return result.Entries[0]
+	}
+
+	if got := search("(uid=john)").GetAttributeValue(DebugRuleAttribute); got != "john fixture" {
+		t.Errorf("%s of matched entry = %q, want the rule name", DebugRuleAttribute, got)
+	}
+	if got := search("(uid=jane)").GetAttributeValue(DebugRuleAttribute); got != "" {
+		t.Errorf("%s of fallback entry = %q, want none", DebugRuleAttribute, got)
+	}
+
+	if mock := srv.ldapSrv.GetMock(); len(mock.Rules[0].Response.Users[0].Attrs) != 1 {
+		t.Errorf("debug attribute leaked into the mock: %+v", mock.Rules[0].Response.Users[0].Attrs)
+	}
+}
+
+func TestIntegration_DiagnosticControl(t *testing.T) {
+	srv := startTestServer(t, "", "")
+	defer srv.stop()
+
+	srv.setMock(t, `
+rules:
+  - id: john
+    name: john fixture
+    filter: "(uid=john)"
+    response:
+      users:
+        - cn: "uid=john,dc=example"
+`)
+
+	if err := srv.ldapSrv.SetDebug(DebugConfig{ResponseControl: true}); err != nil {
+		t.Fatalf("set debug: %v", err)
+	}
+
+	conn := srv.ldapDial(t)
+	defer conn.Close()
+
+	result, err := conn.Search(ldap.NewSearchRequest("dc=example", ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases, 0, 0, false, "(uid=john)", nil, nil))
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+
+	control, ok := ldap.FindControl(result.Controls, ControlTypeDiagnostic).(*ldap.ControlString)
+	if !ok {
+		t.Fatalf("controls = %v, want a diagnostic control", result.Controls)
+	}
+
+	diagnostic, err := DecodeDiagnosticControl([]byte(control.ControlValue))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	logs := srv.ldapSrv.RequestLogger().List()
+	if len(logs) != 1 || diagnostic.RequestID != logs[0].RequestID {
+		t.Errorf("request ID = %q, want the one of the request log entry %+v", diagnostic.RequestID, logs)
+	}
+	if diagnostic.RuleID != "john" || diagnostic.RuleName != "john fixture" {
+		t.Errorf("diagnostic = %+v", diagnostic)
+	}
+	if len(result.Entries) != 1 || len(result.Entries[0].Attributes) != 0 {
+		t.Errorf("entries = %+v, want them untouched", result.Entries)
+	}
+}
+
+func TestIntegration_RequestIDCorrelation(t *testing.T) {
+	core, observed := observer.New(zap.InfoLevel)
+	requestLogger := NewInMemoryRequestLogger(DefaultRequestLogCapacity)
+	ldapSrv := NewLDAPServer(zap.New(core), "0", "cn=admin", "secret", requestLogger)
+	ldapSrv.SetMock(LDAPMock{Rules: []Rule{{ID: "john", Filter: "(uid=john)"}}})
+	if err := ldapSrv.SetDebug(DebugConfig{ResponseControl: true}); err != nil {
+		t.Fatalf("set debug: %v", err)
+	}
+
+	lis := listenLocal(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- ldapSrv.Serve(ctx, lis) }()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	conn, err := ldap.DialURL("ldap://localhost:" + listenerPort(lis))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	bind, err := conn.SimpleBind(&ldap.SimpleBindRequest{Username: "cn=admin", Password: "secret"})
+	if err != nil {
+		t.Fatalf("bind: %v", err)
+	}
+	search, err := conn.Search(ldap.NewSearchRequest("dc=example", ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases, 0, 0, false, "(uid=john)", nil, nil))
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+
+	logs := requestLogger.List()
+	if len(logs) != 2 {
+		t.Fatalf("request log has %d entries, want 2", len(logs))
+	}
+
+	for _, tt := range []struct {
+		name     string
+		controls []ldap.Control
+		entry    LDAPRequestLog
+		messages []string
+	}{
+		{name: "bind", controls: bind.Controls, entry: logs[1], messages: []string{"bind attempt", "binded"}},
+		{name: "search", controls: search.Controls, entry: logs[0], messages: []string{"search request", "rule matched"}},
+	} {
+		control, ok := ldap.FindControl(tt.controls, ControlTypeDiagnostic).(*ldap.ControlString)
+		if !ok {
+			t.Fatalf("%s: controls = %v, want a diagnostic control", tt.name, tt.controls)
+		}
+
+		diagnostic, err := DecodeDiagnosticControl([]byte(control.ControlValue))
+		if err != nil {
+			t.Fatalf("%s: decode: %v", tt.name, err)
+		}
+		if diagnostic.RequestID != tt.entry.RequestID {
+			t.Errorf("%s: request ID = %q, want %q of the request log", tt.name, diagnostic.RequestID, tt.entry.RequestID)
+		}
+
+		for _, message := range tt.messages {
+			entries := observed.FilterMessage(message).FilterField(zap.String("request_id", tt.entry.RequestID)).Len()
+			if entries != 1 {
+				t.Errorf("%s: %d %q log lines with the request ID, want 1", tt.name, entries, message)
+			}
+		}
+	}
+}
+
+func TestIntegration_SortAttributes(t *testing.T) {
+	srv := startTestServer(t, "", "")
+	defer srv.stop()
+
+	srv.setMock(t, `
+users:
+  - cn: "uid=john,dc=example"
+    attrs:
+      uid: john
+      mail: john@example.com
+      givenName: John
+      sn: Doe
+      cn: John Doe
+      Description: admin
+`)
+
+	resp, err := http.Post(fmt.Sprintf("http://localhost:%s/config", srv.mockPort), "application/json",
+		strings.NewReader(`{"response_format":{"sort_attributes":true}}`))
+	if err != nil {
+		t.Fatalf("post config: %v", err)
+	}
+	var cfg RuntimeConfig
+	_ = json.NewDecoder(resp.Body).Decode(&cfg)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || cfg.ResponseFormat == nil || !cfg.ResponseFormat.SortAttributes {
+		t.Fatalf("sort attributes: status %d, config %+v", resp.StatusCode, cfg.ResponseFormat)
+	}
+
+	conn := srv.ldapDial(t)
+	defer conn.Close()
+
+	want := []string{"cn", "Description", "givenName", "mail", "sn", "uid"}
+	for range 5 {
+		result, err := conn.Search(ldap.NewSearchRequest("dc=example", ldap.ScopeWholeSubtree,
+			ldap.NeverDerefAliases, 0, 0, false, "(uid=john)", nil, nil))
+		if err != nil || len(result.Entries) != 1 {
+			t.Fatalf("search: %v", err)
+		}
+
+		var names []string
+		for _, attr := range result.Entries[0].Attributes {
+			names = append(names, attr.Name)
+		}
+		if !slices.Equal(names, want) {
+			t.Fatalf("attributes = %v, want %v", names, want)
+		}
+	}
+}
+
+func TestIntegration_AttributeNames(t *testing.T) {
+	srv := startTestServer(t, "", "")
+	defer srv.stop()
+
+	srv.setMock(t, `
+users:
+  - cn: "CN=John Doe,DC=example"
+    attrs:
+      sAMAccountName: jdoe
+      userPrincipalName: jdoe@example.com
+`)
+
+	conn := srv.ldapDial(t)
+	defer conn.Close()
+
+	names := func(t *testing.T) []string {
+		t.Helper()
+
+		result, err := conn.Search(ldap.NewSearchRequest("DC=example", ldap.ScopeWholeSubtree,
+			ldap.NeverDerefAliases, 0, 0, false, "(SAMACCOUNTNAME=jdoe)", []string{"samaccountname", "userPrincipalName"}, nil))
+		if err != nil || len(result.Entries) != 1 {
+			t.Fatalf("search: %v", err)
+		}
+
+		var names []string
+		for _, attr := range result.Entries[0].Attributes {
+			names = append(names, attr.Name)
+		}
+		slices.Sort(names)
+
+		return names
+	}
+
+	if got, want := names(t), []string{"sAMAccountName", "userPrincipalName"}; !slices.Equal(got, want) {
+		t.Errorf("declared names = %v, want %v", got, want)
+	}
+
+	configURL := fmt.Sprintf("http://localhost:%s/config", srv.mockPort)
+	resp, err := http.Post(configURL, "application/json", strings.NewReader(`{"response_format":{"attribute_names":"requested"}}`))
+	if err != nil {
+		t.Fatalf("post config: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("post config: status %d", resp.StatusCode)
+	}
+
+	if got, want := names(t), []string{"samaccountname", "userPrincipalName"}; !slices.Equal(got, want) {
+		t.Errorf("requested names = %v, want %v", got, want)
+	}
+
+	resp, err = http.Post(configURL, "application/json", strings.NewReader(`{"response_format":{"attribute_names":"upper"}}`))
+	if err != nil {
+		t.Fatalf("post config: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("invalid attribute names: status %d, want 400", resp.StatusCode)
+	}
+}
+
+func TestIntegration_Changes(t *testing.T) {
+	srv := startTestServer(t, "", "")
+	defer srv.stop()
+
+	srv.setMock(t, `
+users:
+  - cn: "uid=john,dc=example"
+    attrs:
+      uid: john
+`)
+	srv.setMock(t, `
+users:
+  - cn: "uid=jane,dc=example"
+    attrs:
+      uid: jane
+`)
+
+	changesURL := fmt.Sprintf("http://localhost:%s/changes", srv.mockPort)
+	getChanges := func(query string) (int, []Change, uint64) {
+		t.Helper()
+
+		resp, err := http.Get(changesURL + query)
+		if err != nil {
+			t.Fatalf("get changes: %v", err)
+		}
+		defer resp.Body.Close()
+
+		var body struct {
+			Changes []Change `json:"changes"`
+			LastSeq uint64   `json:"last_seq"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&body)
+
+		return resp.StatusCode, body.Changes, body.LastSeq
+	}
+
+	status, changes, last := getChanges("")
+	if status != http.StatusOK || last != 3 || len(changes) != 3 {
+		t.Fatalf("changes: status %d, last %d, changes %+v", status, last, changes)
+	}
+	if changes[1].Type != ChangeAdd || changes[1].DN != "uid=jane,dc=example" ||
+		changes[2].Type != ChangeDelete || changes[2].DN != "uid=john,dc=example" {
+		t.Errorf("changes = %+v, want the add of jane and the delete of john", changes)
+	}
+
+	if _, changes, _ = getChanges("?since=3"); len(changes) != 0 {
+		t.Errorf("changes since 3 = %+v, want none", changes)
+	}
+
+	if status, _, _ = getChanges("?since=-1"); status != http.StatusBadRequest {
+		t.Errorf("invalid since: status = %d, want 400", status)
+	}
+}
+
+func TestIntegration_Replication(t *testing.T) {
+	primary := startTestServer(t, "", "")
+	defer primary.stop()
+	replica := startTestServer(t, "", "")
+	defer replica.stop()
+
+	primary.setMock(t, `
+users:
+  - cn: "uid=john,dc=example"
+    attrs:
+      uid: john
+`)
+
+	const lag = 500 * time.Millisecond
+
+	log, _ := zap.NewDevelopment()
+	follower := NewReplica(log, fmt.Sprintf("http://localhost:%s/", primary.mockPort), lag, replica.mockSrv)
+	follower.pollInterval = 20 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		_ = follower.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	replicaUsers := func() []string {
+		var uids []string
+		for _, user := range replica.ldapSrv.GetMock().Users {
+			uids = append(uids, user.Attrs["uid"])
+		}
+
+		return uids
+	}
+	waitForUsers := func(want string) {
+		t.Helper()
+
+		deadline := time.Now().Add(5 * time.Second)
+		for !slices.Equal(replicaUsers(), []string{want}) {
+			if time.Now().After(deadline) {
+				t.Fatalf("replica users = %v, want [%s]", replicaUsers(), want)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	waitForUsers("john")
+
+	written := time.Now()
+	primary.setMock(t, `
+users:
+  - cn: "uid=jane,dc=example"
+    attrs:
+      uid: jane
+`)
+
+	time.Sleep(lag / 2)
+	if got := replicaUsers(); !slices.Equal(got, []string{"john"}) {
+		t.Errorf("replica users before the lag = %v, want [john]", got)
+	}
+
+	waitForUsers("jane")
+	if elapsed := time.Since(written); elapsed < lag {
+		t.Errorf("change replicated after %s, want at least %s", elapsed, lag)
+	}
+
+	// The changes of a primary whose clock is frozen in the past are still
+	// lag behind.
+	freeze := true
+	if err := primary.ldapSrv.SetClock(time.Now().Add(-time.Hour), &freeze, 0); err != nil {
+		t.Fatalf("set primary clock: %v", err)
+	}
+
+	written = time.Now()
+	primary.setMock(t, `
+users:
+  - cn: "uid=joe,dc=example"
+    attrs:
+      uid: joe
+`)
+
+	time.Sleep(lag / 2)
+	if got := replicaUsers(); !slices.Equal(got, []string{"jane"}) {
+		t.Errorf("replica users before the lag = %v, want [jane]", got)
+	}
+
+	waitForUsers("joe")
+	if elapsed := time.Since(written); elapsed < lag {
+		t.Errorf("change of a frozen primary replicated after %s, want at least %s", elapsed, lag)
+	}
+}
+
+func TestIntegration_Schedule(t *testing.T) {
+	srv := startTestServer(t, "cn=admin", "secret")
+	defer srv.stop()
+
+	srv.setMock(t, `
+users:
+  - cn: "uid=john,dc=example"
+    attrs:
+      uid: john
+schedule:
+  - after: 200ms
+    add_users:
+      - cn: "uid=jane,dc=example"
+        attrs:
+          uid: jane
+    remove_users: ["uid=john,dc=example"]
+    chaos:
+      bind_failure_ratio: 1
+      bind_failure_code: 52
+`)
+
+	conn := srv.ldapDial(t)
+	defer conn.Close()
+
+	if err := conn.Bind("cn=admin", "secret"); err != nil {
+		t.Fatalf("bind: %v", err)
+	}
+
+	searchUID := func(uid string) int {
+		t.Helper()
+
+		res, err := conn.Search(ldap.NewSearchRequest("dc=example", ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+			0, 0, false, "(uid="+uid+")", nil, nil))
+		if err != nil {
+			t.Fatalf("search %s: %v", uid, err)
+		}
+
+		return len(res.Entries)
+	}
+
+	if searchUID("john") != 1 || searchUID("jane") != 0 {
+		t.Fatal("the scheduled change was applied at once")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for searchUID("jane") == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the scheduled change was not applied")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	if searchUID("john") != 0 {
+		t.Error("john was not removed")
+	}
+	if err := conn.Bind("cn=admin", "secret"); !ldap.IsErrorWithCode(err, ldap.LDAPResultUnavailable) {
+		t.Errorf("bind: err = %v, want unavailable", err)
+	}
+
+	// Setting another mock cancels the schedule of the previous one.
+	srv.setMock(t, "schedule:\n  - after: 100ms\n    add_users:\n      - cn: uid=joe,dc=example\n")
+	srv.setMock(t, "users:\n  - cn: uid=john,dc=example\n")
+	time.Sleep(300 * time.Millisecond)
+
+	if users := srv.ldapSrv.GetMock().Users; len(users) != 1 || users[0].CN != "uid=john,dc=example" {
+		t.Errorf("users = %+v, want only john", users)
+	}
+}
+
+func TestIntegration_Clock(t *testing.T) {
+	srv := startTestServer(t, "", "")
+	defer srv.stop()
+
+	timeURL := fmt.Sprintf("http://localhost:%s/time", srv.mockPort)
+	setTime := func(body string) (int, ClockState) {
+		t.Helper()
+
+		resp, err := http.Post(timeURL, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("post time: %v", err)
+		}
+		defer resp.Body.Close()
+
+		var clock ClockState
+		_ = json.NewDecoder(resp.Body).Decode(&clock)
+
+		return resp.StatusCode, clock
+	}
+
+	status, clock := setTime(`{"time":"2030-01-01T00:00:00Z","freeze":true}`)
+	start := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	if status != http.StatusOK || !clock.Frozen || !clock.Now.Equal(start) {
+		t.Fatalf("freeze: status %d, clock %+v", status, clock)
+	}
+
+	srv.setMock(t, `
+users:
+  - cn: "uid=temp,dc=example"
+    expires_in: 1h
+    attrs:
+      uid: temp
+schedule:
+  - after: 2h
+    add_users:
+      - cn: "uid=late,dc=example"
+        attrs:
+          uid: late
+`)
+
+	conn := srv.ldapDial(t)
+	defer conn.Close()
+
+	search := func(uid string) int {
+		t.Helper()
+
+		res, err := conn.Search(ldap.NewSearchRequest("dc=example", ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+			0, 0, false, "(uid="+uid+")", nil, nil))
+		if err != nil {
+			t.Fatalf("search %s: %v", uid, err)
+		}
+
+		return len(res.Entries)
+	}
+
+	if search("temp") != 1 || search("late") != 0 {
+		t.Fatal("unexpected entries before advancing the clock")
+	}
+
+	if status, clock = setTime(`{"advance":"1h"}`); status != http.StatusOK || !clock.Now.Equal(start.Add(time.Hour)) {
+		t.Fatalf("advance: status %d, clock %+v", status, clock)
+	}
+	if search("temp") != 0 {
+		t.Error("temp did not expire an hour later")
+	}
+
+	// Advancing past a scheduled change applies it at once.
+	setTime(`{"advance":"1h"}`)
+	if search("late") != 1 {
+		t.Error("the scheduled change was not applied two hours later")
+	}
+
+	// The newest request comes first.
+	requests := srv.ldapSrv.requestLogger.(*InMemoryRequestLogger).List()
+	if last := requests[0]; !last.Timestamp.Equal(start.Add(2 * time.Hour)) {
+		t.Errorf("request log timestamp = %v, want the mock time %v", last.Timestamp, start.Add(2*time.Hour))
+	}
+
+	if status, _ = setTime(`{"advance":"-1h"}`); status != http.StatusBadRequest {
+		t.Errorf("negative advance: status = %d, want 400", status)
+	}
+
+	if status, clock = setTime(`{"reset":true}`); status != http.StatusOK || clock.Frozen || clock.Offset != 0 {
+		t.Errorf("reset: status %d, clock %+v", status, clock)
+	}
+}
+
+func TestIntegration_Import(t *testing.T) {
+	source := startTestServer(t, "cn=admin", "secret")
+	defer source.stop()
+	target := startTestServer(t, "", "")
+	defer target.stop()
+
+	source.setMock(t, `
+users:
+  - cn: "uid=john,ou=people,dc=example"
+    attrs:
+      uid: john
+      mail: john@example.com
+  - cn: "uid=jane,ou=people,dc=example"
+    attrs:
+      uid: jane
+groups:
+  - cn: "cn=admins,ou=groups,dc=example"
+    members: ["uid=john,ou=people,dc=example"]
+    attrs:
+      objectClass: groupOfNames
+`)
+	target.setMock(t, `
+rules:
+  - filter: "(uid=kept)"
+    response:
+      users: []
+users:
+  - cn: "uid=old,dc=example"
+`)
+
+	importURL := fmt.Sprintf("http://localhost:%s/import", target.mockPort)
+	post := func(body string) (int, string) {
+		t.Helper()
+
+		resp, err := http.Post(importURL, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("post import: %v", err)
+		}
+		defer resp.Body.Close()
+
+		data, _ := io.ReadAll(resp.Body)
+
+		return resp.StatusCode, string(data)
+	}
+
+	sourceURL := fmt.Sprintf("ldap://localhost:%s", source.ldapPort)
+	status, body := post(fmt.Sprintf(`{"url":%q,"bind_dn":"cn=admin","password":"secret","base_dn":"dc=example","filter":"(cn=*)"}`, sourceURL))
+	if status != http.StatusOK || !strings.Contains(body, `"users":2`) || !strings.Contains(body, `"groups":1`) {
+		t.Fatalf("import: status %d, body %s", status, body)
+	}
+
+	mock := target.ldapSrv.GetMock()
+	if len(mock.Users) != 2 || mock.Users[0].CN != "uid=john,ou=people,dc=example" || mock.Users[0].Attrs["mail"] != "john@example.com" {
+		t.Errorf("users = %+v, want john and jane", mock.Users)
+	}
+	if len(mock.Groups) != 1 || !slices.Equal(mock.Groups[0].Members, []string{"uid=john,ou=people,dc=example"}) {
+		t.Errorf("groups = %+v, want admins with john", mock.Groups)
+	}
+	if len(mock.Rules) != 1 {
+		t.Errorf("rules = %+v, want the rule kept", mock.Rules)
+	}
+
+	if status, _ = post(fmt.Sprintf(`{"url":%q,"bind_dn":"cn=admin","password":"wrong","base_dn":"dc=example"}`, sourceURL)); status != http.StatusBadGateway {
+		t.Errorf("wrong password: status = %d, want 502", status)
+	}
+	if status, _ = post(`{"url":"http://localhost","base_dn":"dc=example"}`); status != http.StatusBadRequest {
+		t.Errorf("invalid URL: status = %d, want 400", status)
+	}
+}
+
+// fakeGSSAPIClient sends a made-up Kerberos token, as a client with a ticket
+// would.
+type fakeGSSAPIClient struct{}
+
+func (fakeGSSAPIClient) InitSecContext(string, []byte) ([]byte, bool, error) {
+	return []byte("fake-ap-req"), false, nil
+}
+
+func (c fakeGSSAPIClient) InitSecContextWithOptions(target string, token []byte, _ []int) ([]byte, bool, error) {
+	return c.InitSecContext(target, token)
+}
+
+func (fakeGSSAPIClient) NegotiateSaslAuth([]byte, string) ([]byte, error) { return nil, nil }
+
+func (fakeGSSAPIClient) DeleteSecContext() error { return nil }
+
+func TestIntegration_SPNEGO(t *testing.T) {
+	srv := startTestServer(t, "cn=admin", "secret")
+	defer srv.stop()
+
+	conn := srv.ldapDial(t)
+	defer conn.Close()
+
+	if err := conn.GSSAPIBind(fakeGSSAPIClient{}, "ldap/dc.corp", ""); !ldap.IsErrorWithCode(err, ldap.LDAPResultAuthMethodNotSupported) {
+		t.Fatalf("GSSAPI bind without the stub: err = %v, want authMethodNotSupported", err)
+	}
+
+	if err := srv.ldapSrv.SetSPNEGO(SPNEGOConfig{Enabled: true, Identity: "cn=svc,dc=corp"}); err != nil {
+		t.Fatalf("set SPNEGO: %v", err)
+	}
+
+	if err := conn.GSSAPIBind(fakeGSSAPIClient{}, "ldap/dc.corp", ""); err != nil {
+		t.Fatalf("GSSAPI bind: %v", err)
+	}
+
+	requests := srv.ldapSrv.requestLogger.(*InMemoryRequestLogger).List()
+	if requests[0].BindDN != "cn=svc,dc=corp" || requests[0].Result != "Success" {
+		t.Errorf("request log = %+v, want a successful bind as cn=svc,dc=corp", requests[0])
+	}
+
+	// Simple binds still go to OnBind.
+	if err := conn.Bind("cn=admin", "secret"); err != nil {
+		t.Errorf("simple bind: %v", err)
+	}
+}
+
+func TestIntegration_Contracts(t *testing.T) {
+	srv := startTestServer(t, "cn=admin", "secret")
+	defer srv.stop()
+
+	srv.setMock(t, `
+users:
+  - cn: "uid=john,dc=example"
+    attrs:
+      uid: john
+`)
+	srv.ldapSrv.Expect().Name("jane lookup").Filter("(uid=%s)", "jane").RespondUsers(User{CN: "uid=jane,dc=example"})
+
+	conn := srv.ldapDial(t)
+	defer conn.Close()
+
+	if err := conn.Bind("cn=admin", "secret"); err != nil {
+		t.Fatalf("bind: %v", err)
+	}
+	if _, err := conn.Search(ldap.NewSearchRequest("dc=example", ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		0, 0, false, "(uid=john)", nil, nil)); err != nil {
+		t.Fatalf("search: %v", err)
+	}
+
+	resp, err := http.Get(fmt.Sprintf("http://localhost:%s/contracts?consumer=billing", srv.mockPort))
+	if err != nil {
+		t.Fatalf("get contracts: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var contract Contract
+	if err := json.NewDecoder(resp.Body).Decode(&contract); err != nil {
+		t.Fatalf("decode contract: %v", err)
+	}
+
+	if contract.Consumer.Name != "billing" || contract.Provider.Name != "ldap-directory" {
+		t.Errorf("parties = %+v, %+v", contract.Consumer, contract.Provider)
+	}
+
+	var sources []string
+	for _, interaction := range contract.Interactions {
+		sources = append(sources, interaction.Source+": "+interaction.Description)
+	}
+	want := []string{
+		"expectation: jane lookup",
+		"observed: bind as cn=admin",
+		"observed: search (uid=john) under dc=example",
+	}
+	if !slices.Equal(sources, want) {
+		t.Errorf("interactions = %q, want %q", sources, want)
+	}
+}
+
+func TestIntegration_Verify(t *testing.T) {
+	srv := startTestServer(t, "", "")
+	defer srv.stop()
+
+	srv.ldapSrv.Expect().Name("john lookup").Filter("(uid=john)").Times(1)
+	srv.ldapSrv.Expect().Name("jane lookup").Filter("(uid=jane)")
+
+	conn := srv.ldapDial(t)
+	defer conn.Close()
+
+	if _, err := conn.Search(ldap.NewSearchRequest("dc=example", ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		0, 0, false, "(uid=john)", nil, nil)); err != nil {
+		t.Fatalf("search: %v", err)
+	}
+
+	fetch := func(method, path string) (string, string) {
+		t.Helper()
+
+		req, _ := http.NewRequest(method, fmt.Sprintf("http://localhost:%s%s", srv.mockPort, path), nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		defer resp.Body.Close()
+
+		data, _ := io.ReadAll(resp.Body)
+
+		return resp.Header.Get("Content-Type"), string(data)
+	}
+
+	_, body := fetch(http.MethodPost, "/verify")
+	var verification struct {
+		Satisfied    bool                `json:"satisfied"`
+		Expectations []ExpectationStatus `json:"expectations"`
+	}
+	if err := json.Unmarshal([]byte(body), &verification); err != nil {
+		t.Fatalf("decode verification: %v", err)
+	}
+	if verification.Satisfied || len(verification.Expectations) != 2 || verification.Expectations[0].Hits != 1 {
+		t.Errorf("verification = %+v, want 2 expectations, not satisfied", verification)
+	}
+
+	contentType, body := fetch(http.MethodGet, "/expectations/unmet?format=junit")
+	if contentType != "application/xml" || !strings.Contains(body, `tests="1" failures="1"`) ||
+		!strings.Contains(body, `name="expect-2 (jane lookup)"`) {
+		t.Errorf("unmet junit (%s) =\n%s", contentType, body)
+	}
+
+	contentType, body = fetch(http.MethodPost, "/verify?format=junit")
+	if contentType != "application/xml" || !strings.Contains(body, `tests="2" failures="1"`) {
+		t.Errorf("verify junit (%s) =\n%s", contentType, body)
+	}
+}
+
+func TestIntegration_SimulateBatch(t *testing.T) {
+	srv := startTestServer(t, "", "")
+	defer srv.stop()
+
+	srv.setMock(t, `
+users:
+  - cn: uid=john,dc=example
+    attrs:
+      uid: john
+  - cn: uid=jane,dc=example
+    attrs:
+      uid: jane
+rules:
+  - id: admins
+    filter: "(memberOf=cn=admins)"
+    response:
+      users:
+        - cn: uid=john,dc=example
+`)
+
+	conn := srv.ldapDial(t)
+	defer conn.Close()
+
+	if _, err := conn.Search(ldap.NewSearchRequest("dc=example", ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		0, 0, false, "(memberOf=cn=admins)", nil, nil)); err != nil {
+		t.Fatalf("search: %v", err)
+	}
+
+	resp, err := http.Post(fmt.Sprintf("http://localhost:%s/simulate/batch", srv.mockPort), "application/json",
+		strings.NewReader(`{"requests":[{"filter":"(uid=*)"},{"filter":"(uid=jane)","base_dn":"dc=example"}],"request_log":true}`))
+	if err != nil {
+		t.Fatalf("post batch: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var batch BatchSimulation
+	if err := json.NewDecoder(resp.Body).Decode(&batch); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	type row struct {
+		filter string
+		rule   string
+		count  int
+	}
+	var got []row
+	for _, r := range batch.Rows {
+		rule := ""
+		if r.MatchedRule != nil {
+			rule = r.MatchedRule.RuleID
+		}
+		got = append(got, row{r.Request.Filter, rule, r.Count})
+	}
+
+	want := []row{{"(uid=*)", "", 2}, {"(uid=jane)", "", 1}, {"(memberOf=cn=admins)", "admins", 1}}
+	if !slices.Equal(got, want) || batch.Matched != 1 || batch.Unmatched != 2 {
+		t.Errorf("batch = %+v (matched %d, unmatched %d), want %+v", got, batch.Matched, batch.Unmatched, want)
+	}
+
+	// Simulating does not log.
+	if logs := srv.ldapSrv.RequestLogger().List(); len(logs) != 1 {
+		t.Errorf("request log has %d entries, want 1", len(logs))
+	}
+}
+
+func TestIntegration_RequestLogControls(t *testing.T) {
+	srv := startTestServer(t, "cn=admin", "secret")
+	defer srv.stop()
+
+	srv.setMock(t, `
+users:
+  - cn: john
+`)
+
+	conn := srv.ldapDial(t)
+	defer conn.Close()
+
+	_, err := conn.SimpleBind(&ldap.SimpleBindRequest{
+		Username: "cn=admin",
+		Password: "secret",
+		Controls: []ldap.Control{ldap.NewControlBeheraPasswordPolicy()},
+	})
+	if err != nil {
+		t.Fatalf("bind: %v", err)
+	}
+
+	sorting := ldap.NewControlServerSideSortingWithSortKeys([]*ldap.SortKey{{AttributeType: "cn", Reverse: true}})
+	_, err = conn.SearchWithPaging(ldap.NewSearchRequest("dc=example", ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases, 0, 0, false, "(cn=john)", nil, []ldap.Control{sorting}), 50)
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+
+	logs := srv.ldapSrv.RequestLogger().List()
+	if len(logs) != 2 {
+		t.Fatalf("request log has %d entries, want 2", len(logs))
+	}
+
+	search, bind := logs[0], logs[1]
+
+	wantBind := []RequestControl{{OID: ldap.ControlTypeBeheraPasswordPolicy, Name: "Password Policy - Behera Draft"}}
+	if !reflect.DeepEqual(bind.Controls, wantBind) {
+		t.Errorf("bind controls = %+v, want %+v", bind.Controls, wantBind)
+	}
+
+	wantSearch := []RequestControl{
+		{
+			OID:   ldap.ControlTypeServerSideSorting,
+			Name:  "Server Side Sorting",
+			Value: []SortKeyValue{{Attribute: "cn", Reverse: true}},
+		},
+		{
+			OID:   ldap.ControlTypePaging,
+			Name:  "Paging",
+			Value: PagingValue{Size: 50},
+		},
+	}
+	if !reflect.DeepEqual(search.Controls, wantSearch) {
+		t.Errorf("search controls = %+v, want %+v", search.Controls, wantSearch)
+	}
+
+	paged, err := QueryRequestLog(logs, "(controls="+ldap.ControlTypePaging+")")
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if len(paged) != 1 || paged[0].Type != "search" {
+		t.Errorf("paged searches = %+v, want the search", paged)
+	}
+}
+
+func TestIntegration_GlobalCatalog(t *testing.T) {
+	srv := startTestServer(t, "", "")
+	defer srv.stop()
+
+	gcLis := listenLocal(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	gcDone := make(chan struct{})
+	go func() {
+		_ = srv.ldapSrv.ServeGlobalCatalog(ctx, gcLis)
+		close(gcDone)
+	}()
+	defer func() {
+		cancel()
+		<-gcDone
+	}()
+
+	if err := srv.ldapSrv.SetGlobalCatalog(GlobalCatalogConfig{Attributes: []string{"mail", "sAMAccountName"}}); err != nil {
+		t.Fatalf("set global catalog: %v", err)
+	}
+
+	srv.setMock(t, `
+users:
+  - cn: "cn=root,dc=corp,dc=com"
+    attrs:
+      sAMAccountName: root
+      mail: root@corp.com
+      homeDirectory: /home/root
+tenants:
+  - base_dn: "dc=emea,dc=corp,dc=com"
+    users:
+      - cn: "cn=jane,dc=emea,dc=corp,dc=com"
+        attrs:
+          sAMAccountName: jane
+          mail: jane@emea.corp.com
+          homeDirectory: /home/jane
+`)
+
+	search := func(port string) []*ldap.Entry {
+		t.Helper()
+
+		conn, err := ldap.DialURL("ldap://localhost:" + port)
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		defer conn.Close()
+
+		res, err := conn.Search(ldap.NewSearchRequest("dc=corp,dc=com", ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+			0, 0, false, "(sAMAccountName=*)", nil, nil))
+		if err != nil {
+			t.Fatalf("search: %v", err)
+		}
+
+		return res.Entries
+	}
+
+	if entries := search(srv.ldapPort); len(entries) != 1 || entries[0].GetAttributeValue("homeDirectory") == "" {
+		t.Errorf("LDAP port entries = %d, want the top-level user with all attributes", len(entries))
+	}
+
+	entries := search(listenerPort(gcLis))
+	if len(entries) != 2 || entries[1].DN != "cn=jane,dc=emea,dc=corp,dc=com" {
+		t.Fatalf("GC entries = %d, want the users of every domain", len(entries))
+	}
+	for _, entry := range entries {
+		if entry.GetAttributeValue("mail") == "" || entry.GetAttributeValue("homeDirectory") != "" {
+			t.Errorf("GC entry %s attributes = %+v, want the partial attribute set", entry.DN, entry.Attributes)
+		}
+	}
+
+	conn, err := ldap.DialURL("ldap://localhost:" + listenerPort(gcLis))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	if err := conn.Del(ldap.NewDelRequest("cn=jane,dc=emea,dc=corp,dc=com", nil)); !ldap.IsErrorWithCode(err, ldap.LDAPResultUnwillingToPerform) {
+		t.Errorf("GC delete err = %v, want unwillingToPerform", err)
+	}
+}
+
+func TestIntegration_RootDSE(t *testing.T) {
+	srv := startTestServer(t, "", "")
+	defer srv.stop()
+
+	srv.setMock(t, `
+root_dse:
+  supported_controls:
+    - 1.2.840.113556.1.4.319
+    - 1.2.840.113556.1.4.473
+  supported_extensions:
+    - 1.3.6.1.4.1.4203.1.11.3
+users:
+  - cn: "uid=john,dc=example"
+`)
+
+	conn := srv.ldapDial(t)
+	defer conn.Close()
+
+	search := func(filter string, attrs ...string) []*ldap.Entry {
+		t.Helper()
+
+		res, err := conn.Search(ldap.NewSearchRequest("", ldap.ScopeBaseObject, ldap.NeverDerefAliases,
+			0, 0, false, filter, attrs, nil))
+		if err != nil {
+			t.Fatalf("search %s %v: %v", filter, attrs, err)
+		}
+
+		return res.Entries
+	}
+
+	entries := search("(objectClass=*)", "supportedControl", "supportedExtension")
+	if len(entries) != 1 || entries[0].DN != "" {
+		t.Fatalf("entries = %+v, want the root DSE", entries)
+	}
+	if got := entries[0].GetAttributeValues("supportedControl"); !reflect.DeepEqual(got,
+		[]string{"1.2.840.113556.1.4.319", "1.2.840.113556.1.4.473"}) {
+		t.Errorf("supportedControl = %v", got)
+	}
+	if got := entries[0].GetAttributeValues("supportedExtension"); !reflect.DeepEqual(got, []string{"1.3.6.1.4.1.4203.1.11.3"}) {
+		t.Errorf("supportedExtension = %v", got)
+	}
+
+	if entries := search("(objectClass=*)", "+"); len(entries) != 1 || len(entries[0].GetAttributeValues("supportedControl")) != 2 {
+		t.Errorf("operational attributes = %+v, want supportedControl", entries)
+	}
+	if entries := search("(supportedControl=1.2.840.113556.1.4.319)", "1.1"); len(entries) != 1 || len(entries[0].Attributes) != 0 {
+		t.Errorf("entries = %+v, want the root DSE without attributes", entries)
+	}
+	if entries := search("(supportedControl=1.3.6.1.4.1.4203.1.9.1.1)"); len(entries) != 0 {
+		t.Errorf("entries = %+v, want none for an unsupported control", entries)
+	}
+
+	srv.setMock(t, `
+root_dse:
+  supported_extensions:
+    - 1.3.6.1.4.1.4203.1.11.3
+`)
+	if entries := search("(objectClass=*)", "supportedControl"); len(entries) != 1 || !reflect.DeepEqual(entries[0].GetAttributeValues("supportedControl"),
+		[]string{ldap.ControlTypeSyncRequest, ldap.ControlTypeDirSync}) {
+		t.Errorf("entries = %+v, want the implemented controls advertised", entries)
+	}
+
+	// Paged results are only implemented when the mock simulates paging.
+	srv.setMock(t, `
+paging: {}
+`)
+	if entries := search("(objectClass=*)", "supportedControl"); len(entries) != 1 || !reflect.DeepEqual(entries[0].GetAttributeValues("supportedControl"),
+		[]string{ldap.ControlTypePaging, ldap.ControlTypeSyncRequest, ldap.ControlTypeDirSync}) {
+		t.Errorf("entries = %+v, want paged results advertised", entries)
+	}
+}
+
+func TestIntegration_RootDSEDefaults(t *testing.T) {
+	srv := startTestServer(t, "", "")
+	defer srv.stop()
+
+	srv.setMock(t, `
+tenants:
+  - base_dn: "dc=example,dc=com"
+  - base_dn: "dc=other,dc=com"
+`)
+
+	conn := srv.ldapDial(t)
+	defer conn.Close()
+
+	rootDSE := func() *ldap.Entry {
+		t.Helper()
+
+		res, err := conn.Search(ldap.NewSearchRequest("", ldap.ScopeBaseObject, ldap.NeverDerefAliases,
+			0, 0, false, "(objectClass=*)", []string{"+"}, nil))
+		if err != nil || len(res.Entries) != 1 {
+			t.Fatalf("search root DSE: %v, %v", res, err)
+		}
+
+		return res.Entries[0]
+	}
+
+	entry := rootDSE()
+	if got := entry.GetAttributeValues("namingContexts"); !reflect.DeepEqual(got, []string{"dc=example,dc=com", "dc=other,dc=com"}) {
+		t.Errorf("namingContexts = %v, want the tenant base DNs", got)
+	}
+	if got := entry.GetAttributeValue("supportedLDAPVersion"); got != "3" {
+		t.Errorf("supportedLDAPVersion = %q, want 3", got)
+	}
+	if got := entry.GetAttributeValue("vendorName"); got != DefaultVendorName {
+		t.Errorf("vendorName = %q, want %q", got, DefaultVendorName)
+	}
+	if got := entry.GetAttributeValue("vendorVersion"); got != Version {
+		t.Errorf("vendorVersion = %q, want %q", got, Version)
+	}
+
+	srv.setMock(t, `
+users:
+  - cn: "uid=john,ou=People,DC=Example,DC=Com"
+groups:
+  - cn: "cn=admins,ou=Groups,dc=example,dc=com"
+`)
+
+	if got := rootDSE().GetAttributeValues("namingContexts"); !reflect.DeepEqual(got, []string{"dc=example,dc=com"}) {
+		t.Errorf("namingContexts = %v, want the common suffix of the entries", got)
+	}
+
+	srv.setMock(t, `
+users:
+  - cn: "uid=john,dc=example"
+  - cn: "uid=jane,dc=other"
+`)
+
+	if got := rootDSE().GetAttributeValues("namingContexts"); len(got) != 0 {
+		t.Errorf("namingContexts = %v, want none without a common suffix", got)
+	}
+
+	srv.setMock(t, `
+root_dse:
+  naming_contexts:
+    - "dc=corp,dc=com"
+  vendor_name: "Microsoft Corporation"
+`)
+
+	entry = rootDSE()
+	if got := entry.GetAttributeValues("namingContexts"); !reflect.DeepEqual(got, []string{"dc=corp,dc=com"}) {
+		t.Errorf("namingContexts = %v, want the configured one", got)
+	}
+	if got := entry.GetAttributeValue("vendorName"); got != "Microsoft Corporation" {
+		t.Errorf("vendorName = %q, want the configured one", got)
+	}
+}
+
+func TestIntegration_Paging(t *testing.T) {
+	srv := startTestServer(t, "", "")
+	defer srv.stop()
+
+	users := `
+users:
+  - cn: "uid=u1,dc=example"
+  - cn: "uid=u2,dc=example"
+  - cn: "uid=u3,dc=example"
+  - cn: "uid=u4,dc=example"
+  - cn: "uid=u5,dc=example"
+`
+
+	conn := srv.ldapDial(t)
+	defer conn.Close()
+
+	search := func() ([]string, time.Duration) {
+		t.Helper()
+
+		start := time.Now()
+		res, err := conn.SearchWithPaging(ldap.NewSearchRequest("dc=example", ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+			0, 0, false, "(objectClass=*)", nil, nil), 2)
+		if err != nil {
+			t.Fatalf("paged search: %v", err)
+		}
+
+		var dns []string
+		for _, entry := range res.Entries {
+			dns = append(dns, entry.DN)
+		}
+
+		return dns, time.Since(start)
+	}
+
+	wantDNs := []string{"uid=u1,dc=example", "uid=u2,dc=example", "uid=u3,dc=example", "uid=u4,dc=example", "uid=u5,dc=example"}
+
+	srv.setMock(t, users)
+	if dns, _ := search(); !reflect.DeepEqual(dns, wantDNs) {
+		t.Errorf("unpaged dns = %v, want %v", dns, wantDNs)
+	}
+	if logs := srv.ldapSrv.RequestLogger().List(); len(logs) != 1 {
+		t.Errorf("request log has %d searches without paging, want 1", len(logs))
+	}
+
+	srv.setMock(t, users+`
+paging:
+  page_delay: 50ms
+`)
+	srv.ldapSrv.RequestLogger().Clear()
+
+	dns, elapsed := search()
+	if !reflect.DeepEqual(dns, wantDNs) {
+		t.Errorf("paged dns = %v, want %v", dns, wantDNs)
+	}
+	// The second page waits 50ms and the third 100ms.
+	if elapsed < 150*time.Millisecond {
+		t.Errorf("paged search took %v, want at least 150ms", elapsed)
+	}
+
+	logs := srv.ldapSrv.RequestLogger().List()
+	if len(logs) != 3 {
+		t.Fatalf("request log has %d searches, want one per page", len(logs))
+	}
+	if got := logs[0].Response.ReturnedDNs; !reflect.DeepEqual(got, wantDNs[4:]) {
+		t.Errorf("last page dns = %v, want %v", got, wantDNs[4:])
+	}
+
+	control := ldap.NewControlPaging(2)
+	control.SetCookie([]byte("garbage"))
+	_, err := conn.Search(ldap.NewSearchRequest("dc=example", ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		0, 0, false, "(objectClass=*)", nil, []ldap.Control{control}))
+	if !ldap.IsErrorWithCode(err, ldap.LDAPResultUnwillingToPerform) {
+		t.Errorf("search with an invalid cookie: err = %v, want unwillingToPerform", err)
+	}
+}
+
+func TestIntegration_Schema(t *testing.T) {
+	srv := startTestServer(t, "", "")
+	defer srv.stop()
+
+	resp, err := http.Get(fmt.Sprintf("http://localhost:%s/schema.json", srv.mockPort))
+	if err != nil {
+		t.Fatalf("get schema: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var schema map[string]any
+	if err := json.NewDecoder(resp.Body).Decode(&schema); err != nil {
+		t.Fatalf("decode schema: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/schema+json" {
+		t.Errorf("status %d, content type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	if schema["$id"] != MockSchemaID {
+		t.Errorf("$id = %v, want %s", schema["$id"], MockSchemaID)
+	}
+}
+
+func TestIntegration_BackupRestore(t *testing.T) {
+	src := startTestServer(t, "", "")
+	defer src.stop()
+
+	mockYAML := `
+rules:
+  - id: john
+    filter: "(uid=john)"
+    response:
+      users:
+        - cn: "uid=john,dc=example"
+`
+	src.setMock(t, mockYAML)
+
+	conn := src.ldapDial(t)
+	defer conn.Close()
+
+	for _, filter := range []string{"(uid=john)", "(uid=nobody)"} {
+		if _, err := conn.Search(ldap.NewSearchRequest("dc=example", ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+			0, 0, false, filter, nil, nil)); err != nil {
+			t.Fatalf("search %s: %v", filter, err)
+		}
+	}
+
+	resp, err := http.Get(fmt.Sprintf("http://localhost:%s/backup", src.mockPort))
+	if err != nil {
+		t.Fatalf("get backup: %v", err)
+	}
+	defer resp.Body.Close()
+
+	archive, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read backup: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/gzip" {
+		t.Fatalf("backup: status %d, content type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	dst := startTestServer(t, "", "")
+	defer dst.stop()
+
+	restore := func(body []byte) int {
+		t.Helper()
+
+		resp, err := http.Post(fmt.Sprintf("http://localhost:%s/restore", dst.mockPort), "application/gzip", bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("restore: %v", err)
+		}
+		defer resp.Body.Close()
+
+		return resp.StatusCode
+	}
+
+	if status := restore([]byte("not an archive")); status != http.StatusBadRequest {
+		t.Errorf("restore of an invalid archive: status %d, want 400", status)
+	}
+	if status := restore(archive); status != http.StatusOK {
+		t.Fatalf("restore: status %d", status)
+	}
+
+	if got := dst.mockSrv.lastMockYAML; got != mockYAML {
+		t.Errorf("mock YAML = %q, want %q", got, mockYAML)
+	}
+	if got, want := dst.ldapSrv.Stats(), src.ldapSrv.Stats(); !reflect.DeepEqual(got, want) {
+		t.Errorf("stats = %+v, want %+v", got, want)
+	}
+	if got, want := dst.ldapSrv.EmptySearches(), src.ldapSrv.EmptySearches(); !reflect.DeepEqual(got, want) {
+		t.Errorf("empty searches = %+v, want %+v", got, want)
+	}
+
+	got, want := dst.mockSrv.requestLogger.List(), src.mockSrv.requestLogger.List()
+	if len(got) != len(want) || len(got) == 0 || got[0].RequestID != want[0].RequestID {
+		t.Errorf("request log = %+v, want %+v", got, want)
+	}
+
+	dstConn := dst.ldapDial(t)
+	defer dstConn.Close()
+
+	res, err := dstConn.Search(ldap.NewSearchRequest("dc=example", ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		0, 0, false, "(uid=john)", nil, nil))
+	if err != nil || len(res.Entries) != 1 {
+		t.Errorf("search after restore: %v, %+v", err, res)
+	}
+}
+
+func TestIntegration_BackupAfterAdd(t *testing.T) {
+	src := startTestServer(t, "", "")
+	defer src.stop()
+
+	src.setMock(t, `
+users:
+  - cn: "uid=john,dc=example"
+    attrs:
+      uid: john
+`)
+
+	conn := src.ldapDial(t)
+	defer conn.Close()
+
+	add := ldap.NewAddRequest("uid=jane,dc=example", nil)
+	add.Attribute("uid", []string{"jane"})
+	if err := conn.Add(add); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+
+	resp, err := http.Get(fmt.Sprintf("http://localhost:%s/mock", src.mockPort))
+	if err != nil {
+		t.Fatalf("get mock: %v", err)
+	}
+	var data struct {
+		YAML string `json:"yaml"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&data)
+	resp.Body.Close()
+	if err != nil || !strings.Contains(data.YAML, "uid=jane,dc=example") {
+		t.Errorf("mock YAML = %q, %v, want the added entry", data.YAML, err)
+	}
+
+	resp, err = http.Get(fmt.Sprintf("http://localhost:%s/backup", src.mockPort))
+	if err != nil {
+		t.Fatalf("get backup: %v", err)
+	}
+	archive, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("read backup: %v", err)
+	}
+
+	dst := startTestServer(t, "", "")
+	defer dst.stop()
+
+	resp, err = http.Post(fmt.Sprintf("http://localhost:%s/restore", dst.mockPort), "application/gzip", bytes.NewReader(archive))
+	if err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("restore: status %d", resp.StatusCode)
+	}
+
+	dstConn := dst.ldapDial(t)
+	defer dstConn.Close()
+
+	res, err := dstConn.Search(ldap.NewSearchRequest("dc=example", ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		0, 0, false, "(uid=jane)", nil, nil))
+	if err != nil || len(res.Entries) != 1 {
+		t.Errorf("search of the added entry after restore: %v, %+v", err, res)
+	}
+}
+
+func TestIntegration_DisableUI(t *testing.T) {
+	srv := startTestServer(t, "", "")
+	defer srv.stop()
+
+	status := func(path string) int {
+		t.Helper()
+
+		resp, err := http.Get(fmt.Sprintf("http://localhost:%s%s", srv.mockPort, path))
+		if err != nil {
+			t.Fatalf("get %s: %v", path, err)
+		}
+		resp.Body.Close()
+
+		return resp.StatusCode
+	}
+
+	setUI := func(body string) {
+		t.Helper()
+
+		resp, err := http.Post(fmt.Sprintf("http://localhost:%s/config", srv.mockPort), "application/json",
+			strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("post config: %v", err)
+		}
+		var cfg RuntimeConfig
+		_ = json.NewDecoder(resp.Body).Decode(&cfg)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || cfg.UI == nil {
+			t.Fatalf("post config %s: status %d, config %+v", body, resp.StatusCode, cfg.UI)
+		}
+	}
+
+	if got := status("/ui"); got != http.StatusOK {
+		t.Errorf("GET /ui: status %d, want 200", got)
+	}
+
+	setUI(`{"ui":{"disabled":true}}`)
+	for _, path := range []string{"/ui", "/ui/", "/ui/assets/app.js"} {
+		if got := status(path); got != http.StatusNotFound {
+			t.Errorf("GET %s with the UI disabled: status %d, want 404", path, got)
+		}
+	}
+	if got := status("/version"); got != http.StatusOK {
+		t.Errorf("GET /version with the UI disabled: status %d, want 200", got)
+	}
+
+	setUI(`{"ui":{"disabled":false}}`)
+	if got := status("/ui/assets/app.js"); got != http.StatusOK {
+		t.Errorf("GET /ui/assets/app.js with the UI enabled again: status %d, want 200", got)
+	}
+}
+
+func TestIntegration_RequestLogSampling(t *testing.T) {
+	srv := startTestServer(t, "", "")
+	defer srv.stop()
+
+	srv.setMock(t, `
+rules:
+  - id: john
+    filter: "(uid=john)"
+    response:
+      users:
+        - cn: "uid=john,dc=example"
+`)
+
+	resp, err := http.Post(fmt.Sprintf("http://localhost:%s/config", srv.mockPort), "application/json",
+		strings.NewReader(`{"request_log_sampling":{"rate":3}}`))
+	if err != nil {
+		t.Fatalf("post config: %v", err)
+	}
+	var cfg RuntimeConfig
+	_ = json.NewDecoder(resp.Body).Decode(&cfg)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || cfg.RequestLogSampling == nil || cfg.RequestLogSampling.Rate != 3 {
+		t.Fatalf("set sampling: status %d, config %+v", resp.StatusCode, cfg.RequestLogSampling)
+	}
+
+	conn := srv.ldapDial(t)
+	defer conn.Close()
+
+	filters := []string{"(uid=john)", "(uid=john)", "(uid=nobody)", "(uid=john)", "(uid=john)", "(uid=john)", "(uid=nobody)", "(uid=john)"}
+	for _, filter := range filters {
+		if _, err := conn.Search(ldap.NewSearchRequest("dc=example", ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+			0, 0, false, filter, nil, nil)); err != nil {
+			t.Fatalf("search %s: %v", filter, err)
+		}
+	}
+
+	var matched, unmatched int
+	for _, entry := range srv.ldapSrv.RequestLogger().List() {
+		if entry.MatchedRule != nil {
+			matched++
+		} else {
+			unmatched++
+		}
+	}
+	if matched != 2 || unmatched != 2 {
+		t.Errorf("logged %d matched and %d unmatched searches, want 1 in 3 of the 6 matched and both unmatched", matched, unmatched)
+	}
+	if stats := srv.ldapSrv.Stats(); stats.Searches != len(filters) {
+		t.Errorf("stats count %d searches, want %d", stats.Searches, len(filters))
+	}
+}
+
+func TestIntegration_MockDiff(t *testing.T) {
+	srv := startTestServer(t, "", "")
+	defer srv.stop()
+
+	srv.setMock(t, `
+users:
+  - cn: "uid=john,dc=example"
+rules:
+  - id: login
+    filter: "(uid=john)"
+`)
+	srv.setMock(t, `
+users:
+  - cn: "uid=jane,dc=example"
+rules:
+  - id: login
+    filter: "(uid=jane)"
+`)
+
+	get := func(path string, v any) int {
+		t.Helper()
+
+		resp, err := http.Get(fmt.Sprintf("http://localhost:%s%s", srv.mockPort, path))
+		if err != nil {
+			t.Fatalf("get %s: %v", path, err)
+		}
+		defer resp.Body.Close()
+
+		if v != nil && resp.StatusCode == http.StatusOK {
+			if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+				t.Fatalf("decode %s: %v", path, err)
+			}
+		}
+
+		return resp.StatusCode
+	}
+
+	var history []MockVersion
+	if status := get("/mock/history", &history); status != http.StatusOK || len(history) != 2 || history[1].Version != 2 {
+		t.Fatalf("history: status %d, %+v", status, history)
+	}
+
+	var diff MockDiff
+	if status := get("/mock/diff?from=1", &diff); status != http.StatusOK {
+		t.Fatalf("diff: status %d", status)
+	}
+	if diff.From != 1 || diff.To != 2 || len(diff.Users) != 2 || len(diff.Rules) != 1 ||
+		diff.Users[0].Change != DiffAdded || diff.Users[1].Change != DiffRemoved || diff.Rules[0].Change != DiffChanged {
+		t.Errorf("diff = %+v", diff)
+	}
+
+	if status := get("/mock/diff?from=1&to=9", nil); status != http.StatusNotFound {
+		t.Errorf("diff with an unknown version: status %d, want 404", status)
+	}
+	if status := get("/mock/diff?to=2", nil); status != http.StatusBadRequest {
+		t.Errorf("diff without from: status %d, want 400", status)
+	}
+}
+
+func TestIntegration_EffectiveMock(t *testing.T) {
+	srv := startTestServer(t, "", "")
+	defer srv.stop()
+
+	srv.setMock(t, `
+users:
+  - cn: "uid=john,dc=example"
+rules:
+  - filter: "(UID=*)"
+  - id: login
+    filter: "(uid=john)"
+    priority: 10
+`)
+
+	resp, err := http.Get(fmt.Sprintf("http://localhost:%s/mock/effective", srv.mockPort))
+	if err != nil {
+		t.Fatalf("get effective mock: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var effective EffectiveMock
+	if err := json.NewDecoder(resp.Body).Decode(&effective); err != nil {
+		t.Fatalf("decode effective mock: %v", err)
+	}
+
+	if len(effective.Directories) != 1 {
+		t.Fatalf("effective mock = %+v, want one directory", effective)
+	}
+	rules := effective.Directories[0].Rules
+	if effective.Directories[0].Users != 1 || len(rules) != 2 ||
+		rules[0].ID != "login" || rules[1].ParsedFilter != "(uid=*)" || rules[1].Scope != "any" {
+		t.Errorf("effective mock = %+v", effective)
+	}
+}
+
+func TestIntegration_MockUnknownFields(t *testing.T) {
+	srv := startTestServer(t, "", "")
+	defer srv.stop()
+
+	post := func(path, body string) (int, string) {
+		t.Helper()
+
+		resp, err := http.Post(fmt.Sprintf("http://localhost:%s%s", srv.mockPort, path), "application/yaml",
+			strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("post %s: %v", path, err)
+		}
+		defer resp.Body.Close()
+
+		data, _ := io.ReadAll(resp.Body)
+
+		return resp.StatusCode, string(data)
+	}
+
+	typo := "rules:\n  - filter: (uid=john)\n    prioritiy: 5\n"
+
+	status, body := post("/mock", typo)
+	var resp struct {
+		Warnings []string `json:"warnings"`
+	}
+	if err := json.Unmarshal([]byte(body), &resp); err != nil || status != http.StatusOK ||
+		len(resp.Warnings) != 1 || !strings.Contains(resp.Warnings[0], "prioritiy") {
+		t.Fatalf("POST /mock with a typo: status %d, body %q", status, body)
+	}
+	if rules := srv.ldapSrv.GetMock().Rules; len(rules) != 1 {
+		t.Errorf("mock with a typo not loaded: %+v", rules)
+	}
+
+	if status, body := post("/mock", "rules:\n  - filter: (uid=jane)\n"); status != http.StatusOK || body != "" {
+		t.Errorf("POST /mock: status %d, body %q, want no warnings", status, body)
+	}
+
+	if status, body := post("/config", `{"mock_decoding":{"strict":true}}`); status != http.StatusOK {
+		t.Fatalf("POST /config: status %d, body %q", status, body)
+	}
+
+	if status, body := post("/mock", typo); status == http.StatusOK || !strings.Contains(body, "prioritiy") {
+		t.Errorf("strict POST /mock with a typo: status %d, body %q", status, body)
+	}
+	if rules := srv.ldapSrv.GetMock().Rules; len(rules) != 1 || rules[0].Filter != "(uid=jane)" {
+		t.Errorf("mock rejected in strict mode was loaded: %+v", rules)
+	}
+}
+
+func TestIntegration_Namespaces(t *testing.T) {
+	srv := startTestServer(t, "", "")
+	defer srv.stop()
+
+	srv.setMock(t, `
+rules:
+  - namespace: team-a
+    filter: "(uid=john)"
+    response:
+      users:
+        - cn: "uid=john,dc=example"
+  - namespace: team-b
+    filter: "(uid=jane)"
+`)
+
+	do := func(method, path string) int {
+		t.Helper()
+
+		req, err := http.NewRequest(method, fmt.Sprintf("http://localhost:%s%s", srv.mockPort, path), nil)
+		if err != nil {
+			t.Fatalf("new request: %v", err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		resp.Body.Close()
+
+		return resp.StatusCode
+	}
+
+	search := func() int {
+		t.Helper()
+
+		conn := srv.ldapDial(t)
+		defer conn.Close()
+
+		res, err := conn.Search(ldap.NewSearchRequest("dc=example", ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+			0, 0, false, "(uid=john)", nil, nil))
+		if err != nil {
+			t.Fatalf("search: %v", err)
+		}
+
+		return len(res.Entries)
+	}
+
+	if status := do(http.MethodPost, "/mock/namespaces/team-a/disable"); status != http.StatusOK {
+		t.Fatalf("disable: status %d", status)
+	}
+
+	resp, err := http.Get(fmt.Sprintf("http://localhost:%s/mock/namespaces", srv.mockPort))
+	if err != nil {
+		t.Fatalf("get namespaces: %v", err)
+	}
+	var namespaces []Namespace
+	_ = json.NewDecoder(resp.Body).Decode(&namespaces)
+	resp.Body.Close()
+	want := []Namespace{{Name: "team-a", Rules: 1, Disabled: true}, {Name: "team-b", Rules: 1}}
+	if !reflect.DeepEqual(namespaces, want) {
+		t.Errorf("namespaces = %+v, want %+v", namespaces, want)
+	}
+
+	if n := search(); n != 0 {
+		t.Errorf("search with team-a disabled returned %d entries, want 0", n)
+	}
+
+	if status := do(http.MethodPost, "/mock/namespaces/team-a/enable"); status != http.StatusOK {
+		t.Fatalf("enable: status %d", status)
+	}
+	if n := search(); n != 1 {
+		t.Errorf("search with team-a enabled returned %d entries, want 1", n)
+	}
+
+	if status := do(http.MethodDelete, "/mock/namespaces/team-a"); status != http.StatusOK {
+		t.Fatalf("delete: status %d", status)
+	}
+	if status := do(http.MethodDelete, "/mock/namespaces/team-a"); status != http.StatusNotFound {
+		t.Errorf("delete a deleted namespace: status %d, want 404", status)
+	}
+	if rules := srv.ldapSrv.GetMock().Rules; len(rules) != 1 || rules[0].Namespace != "team-b" {
+		t.Errorf("rules after delete = %+v", rules)
+	}
+}
+
+func TestIntegration_RequestLogMockVersion(t *testing.T) {
+	srv := startTestServer(t, "", "")
+	defer srv.stop()
+
+	conn := srv.ldapDial(t)
+	defer conn.Close()
+
+	search := func() {
+		t.Helper()
+
+		if _, err := conn.Search(ldap.NewSearchRequest("dc=example", ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+			0, 0, false, "(uid=john)", nil, nil)); err != nil {
+			t.Fatalf("search: %v", err)
+		}
+	}
+
+	srv.setMock(t, "users:\n  - cn: uid=john,dc=example\n")
+	search()
+	srv.setMock(t, "users:\n  - cn: uid=jane,dc=example\n")
+	search()
+
+	var versions []uint64
+	for _, entry := range srv.ldapSrv.RequestLogger().List() {
+		if entry.Type == "search" {
+			versions = append(versions, entry.MockVersion)
+		}
+	}
+	if !reflect.DeepEqual(versions, []uint64{2, 1}) {
+		t.Errorf("mock versions of the searches = %v, want [2 1]", versions)
+	}
+}
+
+func TestIntegration_WaitForRequests(t *testing.T) {
+	srv := startTestServer(t, "", "")
+	defer srv.stop()
+
+	srv.setMock(t, "users:\n  - cn: uid=bob,dc=example\n    attrs:\n      uid: bob\n")
+
+	wait := func(query string) (int, RequestWait) {
+		t.Helper()
+
+		resp, err := http.Get(fmt.Sprintf("http://localhost:%s/requests/wait?%s", srv.mockPort, query))
+		if err != nil {
+			t.Fatalf("wait: %v", err)
+		}
+		defer resp.Body.Close()
+
+		var result RequestWait
+		_ = json.NewDecoder(resp.Body).Decode(&result)
+
+		return resp.StatusCode, result
+	}
+
+	search := func(filter string) {
+		conn := srv.ldapDial(t)
+		defer conn.Close()
+
+		_, _ = conn.Search(ldap.NewSearchRequest("dc=example", ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+			0, 0, false, filter, nil, nil))
+	}
+
+	search("(uid=bob)")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		time.Sleep(100 * time.Millisecond)
+		search("(uid=alice)")
+		search("(&(objectClass=person)(uid=bob))")
+	}()
+
+	status, result := wait("filter=%28uid%3Dbob%29&count=2&timeout=5s")
+	<-done
+	if status != http.StatusOK || !result.Satisfied || result.Count != 2 ||
+		result.Requests[0].Filter != "(&(objectClass=person)(uid=bob))" || result.Requests[1].Filter != "(uid=bob)" {
+		t.Errorf("wait: status %d, %+v", status, result)
+	}
+
+	status, result = wait("filter=%28uid%3Dbob%29&count=3&timeout=100ms")
+	if status != http.StatusRequestTimeout || result.Satisfied || result.Count != 2 {
+		t.Errorf("wait with a timeout: status %d, %+v", status, result)
+	}
+
+	if status, _ := wait("count=0"); status != http.StatusBadRequest {
+		t.Errorf("wait with count=0: status %d, want 400", status)
+	}
+}
@@ -0,0 +1,65 @@
+package ldapmock
+
+import (
+	"encoding/xml"
+	"io"
+)
+
+// JUnit XML documents, as produced by POST /verify?format=junit.
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes expectations as a JUnit XML test suite with one test case
+// per expectation, failed when it is not met.
+func WriteJUnit(w io.Writer, expectations []ExpectationStatus) error {
+	suite := junitTestSuite{Name: "ldap-mock expectations", Tests: len(expectations), Cases: []junitTestCase{}}
+
+	for _, e := range expectations {
+		name := e.Rule.ID
+		if e.Rule.Name != "" {
+			name += " (" + e.Rule.Name + ")"
+		}
+
+		testCase := junitTestCase{ClassName: "ldap-mock.expectations", Name: name}
+		if e.Error != "" {
+			suite.Failures++
+			testCase.Failure = &junitFailure{Message: e.Error, Text: e.Error}
+		}
+
+		suite.Cases = append(suite.Cases, testCase)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(junitTestSuites{Suites: []junitTestSuite{suite}}); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n")
+
+	return err
+}
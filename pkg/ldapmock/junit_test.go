@@ -0,0 +1,31 @@
+package ldapmock
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteJUnit(t *testing.T) {
+	var b strings.Builder
+	err := WriteJUnit(&b, []ExpectationStatus{
+		{Rule: Rule{ID: "expect-1", Name: "bob lookup"}, Times: 1, Hits: 1},
+		{Rule: Rule{ID: "expect-2"}, Times: -1, Error: `expectation expect-2: filter "(uid=<jane>)" was never matched`},
+	})
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	want := `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites>
+  <testsuite name="ldap-mock expectations" tests="2" failures="1">
+    <testcase classname="ldap-mock.expectations" name="expect-1 (bob lookup)"></testcase>
+    <testcase classname="ldap-mock.expectations" name="expect-2">
+      <failure message="expectation expect-2: filter &#34;(uid=&lt;jane&gt;)&#34; was never matched">expectation expect-2: filter &#34;(uid=&lt;jane&gt;)&#34; was never matched</failure>
+    </testcase>
+  </testsuite>
+</testsuites>
+`
+	if b.String() != want {
+		t.Errorf("junit =\n%s\nwant\n%s", b.String(), want)
+	}
+}
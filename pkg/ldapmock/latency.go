@@ -0,0 +1,106 @@
+package ldapmock
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// Standard normal quantiles of the 95th and 99th percentiles.
+const (
+	z95 = 1.6449
+	z99 = 2.3263
+)
+
+// Latency is a random delay with a realistic spread. Delays follow a
+// log-normal distribution with median P50, shaped either by the percentiles
+// P95 and P99, which the delays then hit, or by Sigma, the standard
+// deviation of their logarithm. Jitter adds a uniform delay on top.
+type Latency struct {
+	P50    Duration `yaml:"p50,omitempty" json:"p50,omitempty"`
+	P95    Duration `yaml:"p95,omitempty" json:"p95,omitempty"`
+	P99    Duration `yaml:"p99,omitempty" json:"p99,omitempty"`
+	Sigma  float64  `yaml:"sigma,omitempty" json:"sigma,omitempty"`
+	Jitter Duration `yaml:"jitter,omitempty" json:"jitter,omitempty"`
+}
+
+func (l *Latency) validate() error {
+	switch {
+	case l.P50 < 0 || l.P95 < 0 || l.P99 < 0 || l.Jitter < 0 || l.Sigma < 0:
+		return errors.New("invalid latency: durations and sigma must not be negative")
+	case l.P50 == 0 && (l.P95 != 0 || l.P99 != 0 || l.Sigma != 0):
+		return errors.New("invalid latency: p95, p99 and sigma need p50")
+	case l.Sigma != 0 && (l.P95 != 0 || l.P99 != 0):
+		return errors.New("invalid latency: set either sigma or p95/p99")
+	case l.P95 != 0 && l.P95 < l.P50:
+		return fmt.Errorf("invalid latency: p95 %s is below p50 %s", l.P95, l.P50)
+	case l.P99 != 0 && l.P99 < max(l.P50, l.P95):
+		return fmt.Errorf("invalid latency: p99 %s is below p50 and p95", l.P99)
+	}
+
+	return nil
+}
+
+func (l *Latency) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain Latency
+	if err := unmarshal((*plain)(l)); err != nil {
+		return err
+	}
+
+	return l.validate()
+}
+
+func (l *Latency) UnmarshalJSON(data []byte) error {
+	type plain Latency
+	if err := json.Unmarshal(data, (*plain)(l)); err != nil {
+		return err
+	}
+
+	return l.validate()
+}
+
+// sample draws a delay; a nil Latency has none.
+func (l *Latency) sample() time.Duration {
+	if l == nil {
+		return 0
+	}
+
+	return l.at(rand.NormFloat64()) + jitter(time.Duration(l.Jitter))
+}
+
+// at returns the delay at z, a standard normal deviate: P50 at 0, P95 at
+// z95 and P99 at z99.
+func (l *Latency) at(z float64) time.Duration {
+	p50 := float64(l.P50)
+	if p50 == 0 {
+		return 0
+	}
+
+	sigma := l.Sigma
+	switch {
+	case l.P95 != 0:
+		sigma = math.Log(float64(l.P95)/p50) / z95
+	case l.P99 != 0:
+		sigma = math.Log(float64(l.P99)/p50) / z99
+	}
+
+	// Above the 95th percentile a P99 steeper or flatter than the body of
+	// the distribution sets the tail, so that both percentiles hold.
+	if l.P95 != 0 && l.P99 != 0 && z > z95 {
+		tail := math.Log(float64(l.P99)/float64(l.P95)) / (z99 - z95)
+		return time.Duration(float64(l.P95) * math.Exp(tail*(z-z95)))
+	}
+
+	return time.Duration(p50 * math.Exp(sigma*z))
+}
+
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+
+	return rand.N(d)
+}
@@ -0,0 +1,100 @@
+package ldapmock
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestLatency_Percentiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		latency Latency
+		want    map[float64]time.Duration
+	}{
+		{
+			name:    "p50 only",
+			latency: Latency{P50: Duration(20 * time.Millisecond)},
+			want:    map[float64]time.Duration{-3: 20 * time.Millisecond, 0: 20 * time.Millisecond, z99: 20 * time.Millisecond},
+		},
+		{
+			name:    "p95 and p99",
+			latency: Latency{P50: Duration(20 * time.Millisecond), P95: Duration(80 * time.Millisecond), P99: Duration(500 * time.Millisecond)},
+			want:    map[float64]time.Duration{0: 20 * time.Millisecond, z95: 80 * time.Millisecond, z99: 500 * time.Millisecond},
+		},
+		{
+			name:    "p99 only",
+			latency: Latency{P50: Duration(10 * time.Millisecond), P99: Duration(100 * time.Millisecond)},
+			want:    map[float64]time.Duration{0: 10 * time.Millisecond, z99: 100 * time.Millisecond},
+		},
+		{
+			name:    "sigma",
+			latency: Latency{P50: Duration(10 * time.Millisecond), Sigma: 1},
+			want:    map[float64]time.Duration{0: 10 * time.Millisecond, 1: 27182818 * time.Nanosecond},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for z, want := range tt.want {
+				if got := tt.latency.at(z); (got - want).Abs() > 10*time.Microsecond {
+					t.Errorf("at(%v) = %v, want %v", z, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLatency_Sample(t *testing.T) {
+	var none *Latency
+	if got := none.sample(); got != 0 {
+		t.Errorf("nil latency sample = %v, want 0", got)
+	}
+
+	latency := &Latency{
+		P50:    Duration(20 * time.Millisecond),
+		P95:    Duration(80 * time.Millisecond),
+		Jitter: Duration(time.Millisecond),
+	}
+
+	samples := make([]time.Duration, 10000)
+	for i := range samples {
+		samples[i] = latency.sample()
+	}
+	slices.Sort(samples)
+
+	// Jitter shifts the percentiles by up to a millisecond.
+	if p50 := samples[5000]; p50 < 18*time.Millisecond || p50 > 23*time.Millisecond {
+		t.Errorf("sampled p50 = %v, want about 20ms", p50)
+	}
+	if p95 := samples[9500]; p95 < 65*time.Millisecond || p95 > 95*time.Millisecond {
+		t.Errorf("sampled p95 = %v, want about 80ms", p95)
+	}
+}
+
+func TestParseMock_Latency(t *testing.T) {
+	mock, err := ParseMockYAML([]byte("latency:\n  p50: 5ms\nrules:\n  - filter: (uid=a)\n    latency:\n      p50: 20ms\n      p95: 80ms\n      jitter: 2ms\n"))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	want := Latency{P50: Duration(20 * time.Millisecond), P95: Duration(80 * time.Millisecond), Jitter: Duration(2 * time.Millisecond)}
+	if mock.Rules[0].Latency == nil || *mock.Rules[0].Latency != want {
+		t.Errorf("rule latency = %+v, want %+v", mock.Rules[0].Latency, want)
+	}
+	if mock.Latency == nil || mock.Latency.P50 != Duration(5*time.Millisecond) {
+		t.Errorf("mock latency = %+v, want p50 5ms", mock.Latency)
+	}
+
+	for _, latency := range []string{
+		`{"p95":"80ms"}`,
+		`{"p50":"80ms","p95":"20ms"}`,
+		`{"p50":"20ms","p95":"80ms","p99":"50ms"}`,
+		`{"p50":"20ms","p95":"80ms","sigma":0.5}`,
+		`{"p50":"20ms","sigma":-1}`,
+		`{"p50":"fast"}`,
+	} {
+		if _, err := ParseMockJSON([]byte(`{"latency":` + latency + `}`)); err == nil {
+			t.Errorf("expected error for latency %s", latency)
+		}
+	}
+}
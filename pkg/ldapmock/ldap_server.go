@@ -0,0 +1,512 @@
+package ldapmock
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"go.uber.org/zap"
+)
+
+type LDAPServer struct {
+	handlers []requestHandlerFunc
+	port     string
+	username string
+	password string
+	credMu   sync.RWMutex
+	log      *zap.Logger
+
+	mock atomic.Pointer[mockSnapshot]
+	// setMockMu orders SetMock calls, so changes are recorded in order.
+	setMockMu sync.Mutex
+	// mockHooks are called with every mock activated, under setMockMu.
+	mockHooks []func(mock LDAPMock)
+	changelog changelog
+	history   mockHistory
+	// scheduleSteps are the changes of the current mock not applied yet;
+	// scheduleTimer fires when the first one is due.
+	scheduleSteps []scheduledStep
+	scheduleTimer *time.Timer
+	clock         clock
+
+	addr   net.Addr
+	addrMu sync.Mutex
+
+	expectations []*Expectation
+	expectMu     sync.Mutex
+	// expectEngine holds the expectations compiled, merged into the rules of
+	// each mock snapshot; it is set under setMockMu.
+	expectEngine *RuleEngine
+
+	handler   Handler
+	handlerMu sync.RWMutex
+
+	middlewares  []SearchMiddleware
+	middlewareMu sync.RWMutex
+
+	stats searchStats
+
+	upstream   *Upstream
+	upstreamMu sync.RWMutex
+	shadow     atomic.Bool
+
+	capture    CaptureConfig
+	captureGen uint64
+	captureMu  sync.RWMutex
+
+	chaos   ChaosConfig
+	outage  Outage
+	chaosMu sync.RWMutex
+
+	inFlightSearches atomic.Int64
+	drainTimeout     atomic.Int64
+
+	rateLimit        RateLimitConfig
+	rateLimitBuckets map[string]*tokenBucket
+	rateLimitMu      sync.RWMutex
+
+	readOnly   ReadOnlyConfig
+	readOnlyMu sync.RWMutex
+
+	globalCatalog   GlobalCatalogConfig
+	globalCatalogMu sync.RWMutex
+
+	spnego   SPNEGOConfig
+	spnegoMu sync.RWMutex
+
+	script   ScriptEngine
+	wasm     ScriptEngine
+	scriptMu sync.RWMutex
+
+	debug   DebugConfig
+	debugMu sync.RWMutex
+
+	responseFormat   ResponseFormat
+	responseFormatMu sync.RWMutex
+
+	requestLogger RequestLogger
+
+	requestLogSampling   RequestLogSampling
+	requestLogSeq        atomic.Uint64
+	requestLogSamplingMu sync.RWMutex
+}
+
+func NewLDAPServer(
+	log *zap.Logger,
+	port string,
+	username string,
+	password string,
+	requestLogger RequestLogger,
+) *LDAPServer {
+	if requestLogger == nil {
+		requestLogger = NewInMemoryRequestLogger(DefaultRequestLogCapacity)
+	}
+
+	s := &LDAPServer{
+		port:           port,
+		username:       username,
+		password:       password,
+		log:            log.Named("ldap_server"),
+		requestLogger:  requestLogger,
+		capture:        CaptureConfig{Format: CaptureHex, Dir: DefaultCaptureDir},
+		chaos:          ChaosConfig{BindFailureCode: ldap.LDAPResultInvalidCredentials},
+		rateLimit:      RateLimitConfig{Action: RateLimitReject},
+		readOnly:       ReadOnlyConfig{Message: DefaultReadOnlyMessage},
+		responseFormat: ResponseFormat{AttributeNames: AttributeNamesDeclared},
+		script:         NewJSScriptEngine(0),
+		wasm:           NewWASMEngine(0),
+	}
+	s.mock.Store(&mockSnapshot{compiled: compileMock(LDAPMock{}).withExpectations(nil)})
+	s.drainTimeout.Store(int64(DefaultDrainTimeout))
+
+	s.initHandlers()
+
+	return s
+}
+
+// ListenAndServe listens on the configured port (use "0" for a random free
+// port, see Addr) and serves LDAP until ctx is done.
+func (s *LDAPServer) ListenAndServe(ctx context.Context) error {
+	lis, err := net.Listen("tcp", net.JoinHostPort("", s.port))
+	if err != nil {
+		return fmt.Errorf("listen LDAP: %w", err)
+	}
+
+	return s.Serve(ctx, lis)
+}
+
+// ListenAndServeTLS is like ListenAndServe but serves LDAPS with the given
+// PEM certificate and key.
+func (s *LDAPServer) ListenAndServeTLS(ctx context.Context, certFile, keyFile string) error {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return fmt.Errorf("load TLS key pair: %w", err)
+	}
+
+	lis, err := net.Listen("tcp", net.JoinHostPort("", s.port))
+	if err != nil {
+		return fmt.Errorf("listen LDAPS: %w", err)
+	}
+
+	return s.Serve(ctx, tls.NewListener(lis, &tls.Config{Certificates: []tls.Certificate{cert}}))
+}
+
+// ListenAndServeUnix serves LDAP on a unix domain socket (ldapi://) at path.
+// A stale socket file left by a previous run is removed first.
+func (s *LDAPServer) ListenAndServeUnix(ctx context.Context, path string) error {
+	if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("remove stale socket: %w", err)
+		}
+	}
+
+	lis, err := net.Listen("unix", path)
+	if err != nil {
+		return fmt.Errorf("listen ldapi: %w", err)
+	}
+
+	return s.Serve(ctx, lis)
+}
+
+// Serve serves LDAP on an already bound listener until ctx is done.
+// The listener is closed on return, after the operations in progress have
+// finished or the drain timeout (see SetDrainTimeout) has passed, and so are
+// the connections. Serve may be called concurrently for several listeners;
+// they share the mock state and request log.
+func (s *LDAPServer) Serve(ctx context.Context, lis net.Listener) error {
+	return s.serve(ctx, lis, false)
+}
+
+func (s *LDAPServer) serve(ctx context.Context, lis net.Listener, globalCatalog bool) error {
+	s.addrMu.Lock()
+	if s.addr == nil {
+		s.addr = lis.Addr()
+	}
+	s.addrMu.Unlock()
+
+	conns := newConnSet()
+
+	go func() {
+		err := s.acceptLoop(lis, conns, globalCatalog)
+		if err != nil && !errors.Is(err, net.ErrClosed) {
+			panic(fmt.Errorf("LDAP serve: %v", err))
+		}
+	}()
+
+	s.log.Info("server started", zap.Stringer("addr", lis.Addr()))
+	<-ctx.Done()
+	s.log.Info("shutdown...")
+
+	err := lis.Close()
+	s.drainConns(conns)
+
+	return err
+}
+
+// Addr returns the address of the first listener the server was started on,
+// or nil before it started listening.
+func (s *LDAPServer) Addr() net.Addr {
+	s.addrMu.Lock()
+	defer s.addrMu.Unlock()
+
+	return s.addr
+}
+
+// mockSnapshot is the mock served at one time with its parsed rules and entry
+// indexes. Snapshots are never modified: SetMock swaps in a new one, so a
+// search sees a single mock from start to end.
+type mockSnapshot struct {
+	mock     LDAPMock
+	compiled compiledMock
+	// activated is when SetMock was given the mock; user TTLs count from it.
+	activated time.Time
+	// version numbers the mock in the history, 0 before the first SetMock.
+	version uint64
+}
+
+// SetMock replaces the mock, records the entries it changes (see Changes),
+// resets the search statistics and starts the schedule of the mock. The
+// server keeps its own copy of mock, so the caller may modify it afterwards.
+// Rule filters are parsed and the entries indexed here, once per mock.
+func (s *LDAPServer) SetMock(mock LDAPMock) {
+	mock = mock.Clone()
+
+	s.setMockMu.Lock()
+	defer s.setMockMu.Unlock()
+
+	activated := s.clock.now()
+	s.swapMock(mock, activated)
+	s.stats.reset()
+	s.startSchedule(mock.Schedule, activated)
+}
+
+// swapMock activates mock, which the server owns, and records it in the
+// history with the entries it changes. The caller holds setMockMu.
+func (s *LDAPServer) swapMock(mock LDAPMock, activated time.Time) {
+	now := s.clock.now()
+	version := s.history.record(mock, now)
+	compiled := compileMock(mock).withExpectations(s.expectEngine)
+	previous := s.mock.Swap(&mockSnapshot{mock: mock, compiled: compiled, activated: activated, version: version})
+	s.changelog.record(mockChanges(previous.mock, mock), now)
+
+	for _, hook := range s.mockHooks {
+		hook(mock.Clone())
+	}
+}
+
+// OnMockChange registers fn to be called with a copy of every mock the
+// server activates: set with SetMock, changed by LDAP writes or by the
+// schedule. Calls are made in order, as the mock changes; fn must not set
+// the mock itself.
+func (s *LDAPServer) OnMockChange(fn func(mock LDAPMock)) {
+	s.setMockMu.Lock()
+	defer s.setMockMu.Unlock()
+
+	s.mockHooks = append(s.mockHooks, fn)
+}
+
+// SetCredentials replaces the bind DN and password accepted by the default
+// handler. Established connections are not affected.
+func (s *LDAPServer) SetCredentials(username, password string) {
+	s.credMu.Lock()
+	defer s.credMu.Unlock()
+
+	s.username = username
+	s.password = password
+}
+
+func (s *LDAPServer) credentials() (string, string) {
+	s.credMu.RLock()
+	defer s.credMu.RUnlock()
+
+	return s.username, s.password
+}
+
+// GetMock returns a copy of the current mock that the caller may modify.
+func (s *LDAPServer) GetMock() LDAPMock {
+	return s.mock.Load().mock.Clone()
+}
+
+// MockVersion returns the version of the current mock, as listed by
+// MockHistory; 0 before the first SetMock.
+func (s *LDAPServer) MockVersion() uint64 {
+	return s.mock.Load().version
+}
+
+type mockSnapshotKey struct{}
+
+// withMockSnapshot pins the current mock to ctx, unless one already is, so
+// that a whole search is answered from one version of the mock even when it
+// is replaced meanwhile.
+func (s *LDAPServer) withMockSnapshot(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(mockSnapshotKey{}).(*mockSnapshot); ok {
+		return ctx
+	}
+
+	return context.WithValue(ctx, mockSnapshotKey{}, s.mock.Load())
+}
+
+// snapshot returns the mock pinned to ctx, or the current one.
+func (s *LDAPServer) snapshot(ctx context.Context) *mockSnapshot {
+	if snapshot, ok := ctx.Value(mockSnapshotKey{}).(*mockSnapshot); ok {
+		return snapshot
+	}
+
+	return s.mock.Load()
+}
+
+// MockVersionFromContext returns the version of the mock the search being
+// handled is answered from.
+func MockVersionFromContext(ctx context.Context) (uint64, bool) {
+	snapshot, ok := ctx.Value(mockSnapshotKey{}).(*mockSnapshot)
+	if !ok {
+		return 0, false
+	}
+
+	return snapshot.version, true
+}
+
+// currentMock returns the mock of ctx (see withMockSnapshot), its compiled
+// form and when it was set. The mock and its compiled form are shared and
+// must not be modified.
+func (s *LDAPServer) currentMock(ctx context.Context) (LDAPMock, compiledMock, time.Time) {
+	snapshot := s.snapshot(ctx)
+
+	return snapshot.mock, snapshot.compiled, snapshot.activated
+}
+
+func (s *LDAPServer) initHandlers() {
+	s.handlers = append(s.handlers,
+		s.serveBind,
+		s.serveSearch,
+		s.serveCompare,
+		s.serveReadOnly,
+		s.serveAdd,
+		s.serveModify,
+		s.serveAbandon,
+	)
+}
+
+func (s *LDAPServer) serveBind(ctx context.Context, p *ber.Packet, w responseWriter) bool {
+	msgID, req, err := parseBindRequest(p)
+	if errors.Is(err, errNotThisOperation) {
+		return false
+	}
+
+	s.logger(ctx).Info("bind attempt")
+
+	var serverCreds []byte
+	if err == nil {
+		err = s.rateLimitError(ctx)
+	}
+	if err == nil {
+		err = s.chaosBindError()
+	}
+	if err == nil {
+		if req.Mechanism != "" {
+			req.DN, serverCreds, err = s.saslBind(req)
+		} else {
+			err = s.currentHandler().OnBind(ctx, req)
+		}
+	}
+
+	s.logBind(ctx, req, err)
+
+	response := newBindResponse(msgID, err, serverCreds)
+	if s.Debug().ResponseControl {
+		requestID, _ := RequestIDFromContext(ctx)
+		response = withControls(response, DiagnosticControl{RequestID: requestID}.Encode())
+	}
+
+	_ = w(response, 0)
+
+	return true
+}
+
+// serveSearch encodes and sends the result entries one at a time, so a large
+// result never has all of its messages in memory at once. The response to a
+// rule with a bandwidth is written at that rate. In debug mode (see SetDebug)
+// the entries name the matched rule and the result carries a
+// DiagnosticControl. Searches with a content synchronization control get
+// their entries with sync state controls, only those changed since their
+// cookie when they have one (see syncMiddleware); in refreshAndPersist mode,
+// the changes of the directory are then sent until the search is abandoned.
+func (s *LDAPServer) serveSearch(ctx context.Context, p *ber.Packet, w responseWriter) bool {
+	msgID, req, err := parseSearchRequest(p)
+	if errors.Is(err, errNotThisOperation) {
+		return false
+	}
+	if err != nil {
+		s.logger(ctx).Warn("invalid search request", zap.Error(err))
+		_ = w(newResultPacket(msgID, ldap.ApplicationSearchResultDone, ldap.NewError(ldap.LDAPResultProtocolError, err)), 0)
+		return true
+	}
+
+	sync, syncing := syncRequest(req)
+	// Changes after seq reach persistent searches; they may be in the
+	// result too.
+	seq := s.changelog.lastSeq()
+
+	ctx = s.withMockSnapshot(ctx)
+	result, err := s.searchChain()(ctx, req)
+	if err != nil && resultCode(err) != ldap.LDAPResultSizeLimitExceeded {
+		result = SearchResult{}
+	}
+
+	debug, format := s.Debug(), s.ResponseFormat()
+	requestedNames := format.AttributeNames == AttributeNamesRequested && len(req.Attributes) > 0
+
+	var (
+		bandwidth ByteRate
+		ruleName  string
+	)
+	if result.MatchedRule != nil {
+		bandwidth = result.MatchedRule.Bandwidth
+		if debug.RuleAttribute {
+			ruleName = debugRuleName(result.MatchedRule)
+		}
+	}
+
+	for entry := range result.entries() {
+		if requestedNames {
+			entry = entry.withRequestedNames(req.Attributes)
+		}
+		if ruleName != "" {
+			entry = entry.withAttr(DebugRuleAttribute, ruleName)
+		}
+		packet := newSearchEntryPacket(msgID, entry.DN, entry.Attrs, format.SortAttributes)
+		if syncing {
+			state, ok := result.syncStates[entry.DN]
+			if !ok {
+				state = ldap.SyncStateAdd
+			}
+			packet = withControls(packet, syncStateControl(state, entry.DN, nil))
+		}
+		if w(packet, bandwidth) != nil {
+			return true
+		}
+	}
+
+	controls := result.controls
+	if debug.ResponseControl {
+		requestID, _ := RequestIDFromContext(ctx)
+		diagnostic := DiagnosticControl{RequestID: requestID}
+		if result.MatchedRule != nil {
+			diagnostic.RuleID, diagnostic.RuleName = result.MatchedRule.ID, result.MatchedRule.Name
+		}
+
+		controls = append(controls, diagnostic.Encode())
+	}
+
+	if syncing && err == nil {
+		incremental := result.syncStates != nil
+		if sync.Mode == SyncModeRefreshAndPersist {
+			_ = w(newSyncInfoPacket(msgID, syncCookie(seq), incremental), bandwidth)
+			goBackground(ctx, msgID, func(ctx context.Context) { s.persistSync(ctx, msgID, req, seq, w) })
+
+			return true
+		}
+
+		controls = append(controls, syncDoneControl(syncCookie(seq), incremental))
+	}
+
+	done := newResultPacket(msgID, ldap.ApplicationSearchResultDone, err)
+	if len(controls) > 0 {
+		done = withControls(done, controls...)
+	}
+
+	_ = w(done, bandwidth)
+
+	return true
+}
+
+func (s *LDAPServer) findMatchingRule(engine *RuleEngine, req SearchRequest) *Rule {
+	if len(engine.rules) == 0 {
+		return nil
+	}
+
+	rule := engine.FindMatchingRule(req)
+	if rule != nil {
+		s.recordExpectationHit(rule)
+	}
+
+	return rule
+}
+
+func (s *LDAPServer) RequestLogger() RequestLogger {
+	return s.requestLogger
+}
+
+// filterEntries returns the users and groups matching filterStr, comparing
+// values by the declared attribute syntaxes.
+func filterEntries(users []User, groups []Group, filterStr string, syntaxes AttributeSyntaxes) ([]User, []Group, error) {
+	return newDirectoryIndex(users, groups).filter(filterStr, syntaxes)
+}
@@ -0,0 +1,176 @@
+// Package ldapmocktest starts an in-process ldap-mock for Go tests.
+//
+//	srv := ldapmocktest.Start(t)
+//	srv.SetMock(ldapmock.LDAPMock{Users: []ldapmock.User{{CN: "cn=john"}}})
+//	conn, _ := ldap.DialURL(srv.LDAPURL())
+package ldapmocktest
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"testing"
+
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/rom8726/ldap-mock/pkg/ldapmock"
+)
+
+const (
+	DefaultBindDN       = "cn=admin"
+	DefaultBindPassword = "secret"
+)
+
+// Server is an ldap-mock running inside the current test process.
+type Server struct {
+	LDAP *ldapmock.LDAPServer
+	Mock *ldapmock.MockServer
+
+	BindDN       string
+	BindPassword string
+
+	ldapAddr      string
+	mockAddr      string
+	requestLogger ldapmock.RequestLogger
+}
+
+type Option func(*options)
+
+type options struct {
+	bindDN       string
+	bindPassword string
+	logger       *zap.Logger
+}
+
+// WithCredentials sets the DN and password accepted by the LDAP bind.
+func WithCredentials(bindDN, bindPassword string) Option {
+	return func(o *options) {
+		o.bindDN = bindDN
+		o.bindPassword = bindPassword
+	}
+}
+
+// WithLogger sets the logger used by both servers (zap.NewNop by default).
+func WithLogger(log *zap.Logger) Option {
+	return func(o *options) {
+		o.logger = log
+	}
+}
+
+// Start runs the LDAP and control servers on free local ports and stops
+// them when the test finishes.
+func Start(t testing.TB, opts ...Option) *Server {
+	t.Helper()
+
+	o := options{
+		bindDN:       DefaultBindDN,
+		bindPassword: DefaultBindPassword,
+		logger:       zap.NewNop(),
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	requestLogger := ldapmock.NewInMemoryRequestLogger(ldapmock.DefaultRequestLogCapacity)
+
+	ldapLis := listenLocal(t)
+	mockLis := listenLocal(t)
+
+	s := &Server{
+		BindDN:        o.bindDN,
+		BindPassword:  o.bindPassword,
+		ldapAddr:      ldapLis.Addr().String(),
+		mockAddr:      mockLis.Addr().String(),
+		requestLogger: requestLogger,
+	}
+
+	s.LDAP = ldapmock.NewLDAPServer(o.logger, "0", o.bindDN, o.bindPassword, requestLogger)
+	s.Mock = ldapmock.NewMockServer(o.logger, "0", s.LDAP, requestLogger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	group, groupCtx := errgroup.WithContext(ctx)
+	group.Go(func() error { return s.LDAP.Serve(groupCtx, ldapLis) })
+	group.Go(func() error { return s.Mock.Serve(groupCtx, mockLis) })
+
+	t.Cleanup(func() {
+		cancel()
+		if err := group.Wait(); err != nil {
+			t.Errorf("ldapmocktest: stop servers: %v", err)
+		}
+	})
+
+	return s
+}
+
+// LDAPURL returns the ldap:// URL of the LDAP listener.
+func (s *Server) LDAPURL() string {
+	return "ldap://" + s.ldapAddr
+}
+
+// MockURL returns the base http:// URL of the control server.
+func (s *Server) MockURL() string {
+	return "http://" + s.mockAddr
+}
+
+// SetMock replaces the active mock.
+func (s *Server) SetMock(mock ldapmock.LDAPMock) {
+	s.LDAP.SetMock(mock)
+}
+
+// SetMockYAML loads a YAML mock through the control API, exactly as
+// POST /mock does for out-of-process clients.
+func (s *Server) SetMockYAML(t testing.TB, yamlMock string) {
+	t.Helper()
+
+	resp, err := http.Post(s.MockURL()+"/mock", "application/x-yaml", bytes.NewBufferString(yamlMock))
+	if err != nil {
+		t.Fatalf("ldapmocktest: set mock: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("ldapmocktest: set mock: status %d", resp.StatusCode)
+	}
+}
+
+// Clean removes the active mock.
+func (s *Server) Clean() {
+	s.LDAP.SetMock(ldapmock.LDAPMock{})
+}
+
+// Expect registers a Go-defined rule, see ldapmock.Expectation.
+func (s *Server) Expect() *ldapmock.Expectation {
+	return s.LDAP.Expect()
+}
+
+// AssertExpectations fails the test if any expectation was not met.
+func (s *Server) AssertExpectations(t testing.TB) {
+	t.Helper()
+
+	if err := s.LDAP.VerifyExpectations(); err != nil {
+		t.Errorf("ldapmocktest: %v", err)
+	}
+}
+
+// Requests returns the recorded LDAP requests, newest first.
+func (s *Server) Requests() []ldapmock.LDAPRequestLog {
+	return s.requestLogger.List()
+}
+
+// ClearRequests drops all recorded LDAP requests.
+func (s *Server) ClearRequests() {
+	s.requestLogger.Clear()
+}
+
+func listenLocal(t testing.TB) net.Listener {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ldapmocktest: listen: %v", err)
+	}
+
+	return lis
+}
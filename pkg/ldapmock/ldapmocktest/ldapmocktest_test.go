@@ -0,0 +1,151 @@
+package ldapmocktest
+
+import (
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+
+	"github.com/rom8726/ldap-mock/pkg/ldapmock"
+)
+
+func TestStart(t *testing.T) {
+	srv := Start(t)
+
+	srv.SetMock(ldapmock.LDAPMock{
+		Users: []ldapmock.User{
+			{CN: "john.doe", Attrs: map[string]string{"mail": "john@example.com"}},
+		},
+	})
+
+	conn, err := ldap.DialURL(srv.LDAPURL())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	if err := conn.Bind(srv.BindDN, srv.BindPassword); err != nil {
+		t.Fatalf("bind: %v", err)
+	}
+
+	result, err := conn.Search(&ldap.SearchRequest{
+		BaseDN:     "DC=example,DC=com",
+		Scope:      ldap.ScopeWholeSubtree,
+		Filter:     "(cn=john.doe)",
+		Attributes: []string{"mail"},
+	})
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+
+	if len(result.Entries) != 1 {
+		t.Fatalf("entries = %d, want 1", len(result.Entries))
+	}
+
+	requests := srv.Requests()
+	if len(requests) != 2 || requests[1].Type != "bind" {
+		t.Fatalf("requests = %+v, want search after bind", requests)
+	}
+	if requests[0].Filter != "(cn=john.doe)" {
+		t.Errorf("filter = %q, want (cn=john.doe)", requests[0].Filter)
+	}
+
+	srv.ClearRequests()
+	if len(srv.Requests()) != 0 {
+		t.Error("requests not cleared")
+	}
+}
+
+func TestServer_SetMockYAML(t *testing.T) {
+	srv := Start(t, WithCredentials("cn=root", "pw"))
+
+	srv.SetMockYAML(t, `
+users:
+  - cn: jane.doe
+`)
+
+	mock := srv.LDAP.GetMock()
+	if len(mock.Users) != 1 || mock.Users[0].CN != "jane.doe" {
+		t.Fatalf("mock users = %v, want jane.doe", mock.Users)
+	}
+
+	conn, err := ldap.DialURL(srv.LDAPURL())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	if err := conn.Bind("cn=root", "pw"); err != nil {
+		t.Fatalf("bind: %v", err)
+	}
+}
+
+func TestServer_Expect(t *testing.T) {
+	srv := Start(t)
+
+	srv.Expect().
+		Filter("(uid=%s)", "bob").
+		RespondUsers(ldapmock.User{CN: "uid=bob,dc=example,dc=com", Attrs: map[string]string{"mail": "bob@example.com"}}).
+		Times(1)
+
+	conn, err := ldap.DialURL(srv.LDAPURL())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	if err := conn.Bind(srv.BindDN, srv.BindPassword); err != nil {
+		t.Fatalf("bind: %v", err)
+	}
+
+	result, err := conn.Search(&ldap.SearchRequest{
+		BaseDN:     "dc=example,dc=com",
+		Scope:      ldap.ScopeWholeSubtree,
+		Filter:     "(uid=bob)",
+		Attributes: []string{"mail"},
+	})
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+
+	if len(result.Entries) != 1 || result.Entries[0].GetAttributeValue("mail") != "bob@example.com" {
+		t.Fatalf("unexpected entries: %v", result.Entries)
+	}
+
+	srv.AssertExpectations(t)
+}
+
+func TestServer_Script(t *testing.T) {
+	srv := Start(t)
+
+	srv.SetMockYAML(t, `
+rules:
+  - filter: "(uid=*)"
+    filter_match: semantic
+    script: |
+      var uid = request.filter.match(/uid=([^)]*)/)[1];
+      return {users: [{cn: "uid=" + uid + "," + request.base_dn, attrs: {uid: uid}}]};
+`)
+
+	conn, err := ldap.DialURL(srv.LDAPURL())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	if err := conn.Bind(srv.BindDN, srv.BindPassword); err != nil {
+		t.Fatalf("bind: %v", err)
+	}
+
+	result, err := conn.Search(&ldap.SearchRequest{
+		BaseDN: "dc=example,dc=com",
+		Scope:  ldap.ScopeWholeSubtree,
+		Filter: "(uid=carol)",
+	})
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+
+	if len(result.Entries) != 1 || result.Entries[0].DN != "uid=carol,dc=example,dc=com" {
+		t.Fatalf("unexpected entries: %v", result.Entries)
+	}
+}
@@ -0,0 +1,228 @@
+package ldapmock
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// ParseLDIF reads the entries of an LDIF content file (RFC 2849) as mock
+// users. Mock user attributes are single-valued, so only the first value of a
+// multi-valued attribute is kept. Change records other than add are rejected.
+func ParseLDIF(r io.Reader) ([]User, error) {
+	lines, err := unfoldLDIF(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		users   []User
+		current *User
+	)
+
+	flush := func() {
+		if current != nil {
+			users = append(users, *current)
+			current = nil
+		}
+	}
+
+	for i, line := range lines {
+		if line.text == "" {
+			flush()
+			continue
+		}
+
+		name, value, err := parseLDIFLine(line.text)
+		if err != nil {
+			return nil, fmt.Errorf("ldif line %d: %w", line.number, err)
+		}
+
+		switch {
+		case current == nil && strings.EqualFold(name, "version") && i == 0:
+			continue
+		case current == nil:
+			if !strings.EqualFold(name, "dn") {
+				return nil, fmt.Errorf("ldif line %d: expected dn, got %q", line.number, name)
+			}
+			current = &User{CN: value, Attrs: map[string]string{}}
+		case strings.EqualFold(name, "changetype"):
+			if !strings.EqualFold(value, "add") {
+				return nil, fmt.Errorf("ldif line %d: unsupported changetype %q", line.number, value)
+			}
+		default:
+			if _, ok := current.Attrs[name]; !ok {
+				current.Attrs[name] = value
+			}
+		}
+	}
+	flush()
+
+	return users, nil
+}
+
+type ldifLine struct {
+	number int
+	text   string
+}
+
+// unfoldLDIF joins continuation lines and drops comments.
+func unfoldLDIF(r io.Reader) ([]ldifLine, error) {
+	var lines []ldifLine
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	number := 0
+	inComment := false
+	for scanner.Scan() {
+		number++
+		text := strings.TrimSuffix(scanner.Text(), "\r")
+
+		if strings.HasPrefix(text, " ") {
+			if inComment {
+				continue
+			}
+			if len(lines) == 0 || lines[len(lines)-1].text == "" {
+				return nil, fmt.Errorf("ldif line %d: continuation without a preceding line", number)
+			}
+			lines[len(lines)-1].text += text[1:]
+			continue
+		}
+
+		inComment = strings.HasPrefix(text, "#")
+		if inComment {
+			continue
+		}
+
+		lines = append(lines, ldifLine{number: number, text: text})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read ldif: %w", err)
+	}
+
+	return lines, nil
+}
+
+func parseLDIFLine(line string) (string, string, error) {
+	name, value, ok := strings.Cut(line, ":")
+	if !ok || name == "" {
+		return "", "", fmt.Errorf("invalid line %q", line)
+	}
+
+	switch {
+	case strings.HasPrefix(value, ":"):
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value[1:]))
+		if err != nil {
+			return "", "", fmt.Errorf("attribute %s: invalid base64: %w", name, err)
+		}
+		return name, string(decoded), nil
+	case strings.HasPrefix(value, "<"):
+		return "", "", fmt.Errorf("attribute %s: URL values are not supported", name)
+	default:
+		return name, strings.TrimLeft(value, " "), nil
+	}
+}
+
+// LDIF encodes every entry the mock can return (fallback and tenant users and
+// groups, then rule response users and groups) as an LDIF content file. Entries
+// are written once per DN, attributes in name order.
+func (m LDAPMock) LDIF() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("version: 1\n")
+
+	seen := make(map[string]bool)
+	writeEntry := func(dn string, attrs map[string]string, members []string) {
+		key := strings.ToLower(dn)
+		if dn == "" || seen[key] {
+			return
+		}
+		seen[key] = true
+
+		buf.WriteString("\n")
+		writeLDIFAttr(&buf, "dn", dn)
+
+		names := make([]string, 0, len(attrs))
+		for name := range attrs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			writeLDIFAttr(&buf, name, attrs[name])
+		}
+		for _, member := range members {
+			writeLDIFAttr(&buf, "member", member)
+		}
+	}
+
+	writeRules := func(rules []Rule) {
+		for _, rule := range rules {
+			for _, user := range rule.Response.Users {
+				writeEntry(user.CN, user.Attrs, nil)
+			}
+			for _, group := range rule.Response.Groups {
+				writeEntry(group.CN, group.Attrs, group.Members)
+			}
+		}
+	}
+
+	writeDirectory := func(users []User, groups []Group) {
+		for _, user := range users {
+			writeEntry(user.CN, user.Attrs, nil)
+		}
+		for _, group := range groups {
+			writeEntry(group.CN, group.Attrs, group.Members)
+		}
+	}
+
+	writeDirectory(m.Users, m.Groups)
+	for _, tenant := range m.Tenants {
+		writeDirectory(tenant.Users, tenant.Groups)
+	}
+	writeRules(m.Rules)
+	for _, tenant := range m.Tenants {
+		writeRules(tenant.Rules)
+	}
+
+	return buf.Bytes()
+}
+
+func writeLDIFAttr(buf *bytes.Buffer, name, value string) {
+	if isSafeLDIFString(value) {
+		_, _ = fmt.Fprintf(buf, "%s: %s\n", name, value)
+		return
+	}
+
+	_, _ = fmt.Fprintf(buf, "%s:: %s\n", name, base64.StdEncoding.EncodeToString([]byte(value)))
+}
+
+// isSafeLDIFString reports whether value can be written without base64
+// (SAFE-STRING in RFC 2849).
+func isSafeLDIFString(value string) bool {
+	if value == "" {
+		return true
+	}
+
+	switch value[0] {
+	case ' ', ':', '<':
+		return false
+	}
+	if value[len(value)-1] == ' ' {
+		return false
+	}
+
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c == 0 || c == '\n' || c == '\r' || c > 127 {
+			return false
+		}
+	}
+
+	return true
+}
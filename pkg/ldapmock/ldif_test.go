@@ -0,0 +1,96 @@
+package ldapmock
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseLDIF(t *testing.T) {
+	data := `version: 1
+# exported from a real directory
+dn: uid=john,ou=people,dc=example,dc=com
+objectClass: inetOrgPerson
+objectClass: person
+uid: john
+description: a long value that is
+  folded
+cn:: Sm9zw6k=
+
+dn: uid=jane,ou=people,dc=example,dc=com
+changetype: add
+mail: jane@example.com
+`
+
+	users, err := ParseLDIF(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	want := []User{
+		{CN: "uid=john,ou=people,dc=example,dc=com", Attrs: map[string]string{
+			"objectClass": "inetOrgPerson",
+			"uid":         "john",
+			"description": "a long value that is folded",
+			"cn":          "José",
+		}},
+		{CN: "uid=jane,ou=people,dc=example,dc=com", Attrs: map[string]string{
+			"mail": "jane@example.com",
+		}},
+	}
+	if !reflect.DeepEqual(users, want) {
+		t.Errorf("users = %+v, want %+v", users, want)
+	}
+}
+
+func TestParseLDIF_Errors(t *testing.T) {
+	tests := map[string]string{
+		"missing dn":     "uid: john\n",
+		"modify":         "dn: uid=john\nchangetype: modify\n",
+		"bad base64":     "dn: uid=john\ncn:: !!!\n",
+		"url value":      "dn: uid=john\njpegPhoto:< file:///tmp/photo.jpg\n",
+		"no colon":       "dn: uid=john\nbroken\n",
+		"leading indent": " dn: uid=john\n",
+	}
+
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParseLDIF(strings.NewReader(data)); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestLDAPMock_LDIF(t *testing.T) {
+	mock := LDAPMock{
+		Users: []User{{CN: "uid=john,dc=example", Attrs: map[string]string{"uid": "john", "cn": "José"}}},
+		Rules: []Rule{{Response: Response{
+			Users:  []User{{CN: "UID=john,DC=example"}},
+			Groups: []Group{{CN: "cn=admins,dc=example", Members: []string{"uid=john,dc=example"}, Attrs: map[string]string{"cn": "admins"}}},
+		}}},
+	}
+
+	got := string(mock.LDIF())
+	want := `version: 1
+
+dn: uid=john,dc=example
+cn:: Sm9zw6k=
+uid: john
+
+dn: cn=admins,dc=example
+cn: admins
+member: uid=john,dc=example
+`
+	if got != want {
+		t.Errorf("LDIF:\n%s\nwant:\n%s", got, want)
+	}
+
+	users, err := ParseLDIF(strings.NewReader(got))
+	if err != nil {
+		t.Fatalf("parse exported LDIF: %v", err)
+	}
+	if len(users) != 2 || users[0].Attrs["cn"] != "José" {
+		t.Errorf("round trip = %+v", users)
+	}
+}
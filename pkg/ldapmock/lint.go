@@ -0,0 +1,324 @@
+package ldapmock
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"text/template"
+)
+
+// Lint issue severities. An error makes a rule or tenant never do what it
+// says; a warning points at a likely mistake.
+const (
+	LintError   = "error"
+	LintWarning = "warning"
+)
+
+// LintIssue is one problem found in a mock. Path locates it, e.g.
+// tenants[0].rules[2].filter.
+type LintIssue struct {
+	Severity string `json:"severity"`
+	Path     string `json:"path"`
+	Tenant   string `json:"tenant,omitempty"`
+	RuleID   string `json:"rule_id,omitempty"`
+	RuleName string `json:"rule_name,omitempty"`
+	Message  string `json:"message"`
+}
+
+// MockLint is the outcome of linting a mock, as returned by GET /mock/lint.
+type MockLint struct {
+	Errors   int         `json:"errors"`
+	Warnings int         `json:"warnings"`
+	Issues   []LintIssue `json:"issues"`
+}
+
+// LintMock checks the consistency of a mock that parsed: rule filters,
+// scopes, matching modes, conditions and templates that cannot work, rules
+// that can never match, and response users missing attributes their own rule
+// filter asserts. Rules are checked in their order in the mock.
+func LintMock(mock LDAPMock) MockLint {
+	lint := MockLint{Issues: []LintIssue{}}
+
+	ids := make(map[string]string)
+	lintRules := func(prefix, tenant string, rules []Rule) {
+		for i := range rules {
+			rule := &rules[i]
+			path := fmt.Sprintf("%srules[%d]", prefix, i)
+
+			report := func(severity, field, format string, args ...any) {
+				issuePath := path
+				if field != "" {
+					issuePath += "." + field
+				}
+
+				lint.add(LintIssue{
+					Severity: severity,
+					Path:     issuePath,
+					Tenant:   tenant,
+					RuleID:   rule.ID,
+					RuleName: rule.Name,
+					Message:  fmt.Sprintf(format, args...),
+				})
+			}
+
+			if rule.ID != "" {
+				if first, ok := ids[rule.ID]; ok {
+					report(LintError, "id", "id %q is also used by %s, so their statistics are merged", rule.ID, first)
+				} else {
+					ids[rule.ID] = path
+				}
+			}
+
+			lintRule(rule, report)
+
+			if j := shadowingRule(rules, i); j >= 0 {
+				report(LintWarning, "", "never matches: rule %s at %srules[%d] matches the same searches and is evaluated first",
+					ruleLabel(&rules[j]), prefix, j)
+			}
+		}
+	}
+
+	lintRules("", "", mock.Rules)
+
+	for i := range mock.Tenants {
+		tenant := &mock.Tenants[i]
+		prefix := fmt.Sprintf("tenants[%d].", i)
+
+		if len(splitDN(tenant.BaseDN)) == 0 {
+			lint.add(LintIssue{
+				Severity: LintError,
+				Path:     prefix + "base_dn",
+				Tenant:   tenant.Name,
+				Message:  "the tenant has no base DN, so it serves no search",
+			})
+		}
+
+		lintRules(prefix, tenant.Name, tenant.Rules)
+	}
+
+	for _, attr := range compileComputed(mock.Computed) {
+		if attr.err != nil {
+			lint.add(LintIssue{
+				Severity: LintError,
+				Path:     "computed." + attr.name,
+				Message:  fmt.Sprintf("invalid template %q: %v", mock.Computed[attr.name], attr.err),
+			})
+		}
+	}
+
+	return lint
+}
+
+func (l *MockLint) add(issue LintIssue) {
+	switch issue.Severity {
+	case LintError:
+		l.Errors++
+	case LintWarning:
+		l.Warnings++
+	}
+
+	l.Issues = append(l.Issues, issue)
+}
+
+// lintRule checks the fields of rule on their own.
+func lintRule(rule *Rule, report func(severity, field, format string, args ...any)) {
+	filter, err := ParseFilter(rule.Filter)
+	if err != nil {
+		report(LintError, "filter", "invalid filter %q: %v", rule.Filter, err)
+	}
+
+	switch strings.ToLower(rule.Scope) {
+	case "", "base", "one", "sub":
+	default:
+		report(LintError, "scope", "invalid scope %q: must be base, one or sub", rule.Scope)
+	}
+
+	switch strings.ToLower(rule.FilterMatch) {
+	case "", FilterMatchStructural, FilterMatchSemantic:
+	default:
+		report(LintError, "filter_match", "invalid filter_match %q: must be %s or %s",
+			rule.FilterMatch, FilterMatchStructural, FilterMatchSemantic)
+	}
+
+	switch strings.ToLower(rule.BaseDNMatch) {
+	case "", BaseDNExact, BaseDNSubtree:
+	default:
+		report(LintError, "base_dn_match", "invalid base_dn_match %q: must be %s or %s",
+			rule.BaseDNMatch, BaseDNExact, BaseDNSubtree)
+	}
+
+	if when := parseWhen(rule.WhenExpr); when.err != nil {
+		report(LintError, "when_expr", "invalid when_expr: %v", when.err)
+	}
+
+	if rule.Response.MaxEntries < 0 {
+		report(LintError, "response.max_entries", "invalid max_entries %d: must not be negative", rule.Response.MaxEntries)
+	}
+
+	switch {
+	case rule.Script != "":
+		if rule.WASM != "" {
+			report(LintWarning, "wasm", "wasm is ignored: the script answers matched searches")
+		}
+		if rule.Passthrough {
+			report(LintWarning, "passthrough", "passthrough is ignored: the script answers matched searches")
+		}
+		if rule.Template {
+			report(LintWarning, "template", "template is ignored: the script answers matched searches")
+		}
+		return
+	case rule.WASM != "":
+		if rule.Passthrough {
+			report(LintWarning, "passthrough", "passthrough is ignored: the WASM module answers matched searches")
+		}
+		if rule.Template {
+			report(LintWarning, "template", "template is ignored: the WASM module answers matched searches")
+		}
+		return
+	case rule.Passthrough:
+		if rule.Template {
+			report(LintWarning, "template", "template is ignored: matched searches are passed through")
+		}
+		return
+	case rule.Template:
+		lintTemplates(rule.Response, report)
+	}
+
+	if filter == nil {
+		return
+	}
+
+	required := make(map[string]bool)
+	assertedAttrs(filter, required)
+
+	for i, user := range rule.Response.Users {
+		var missing []string
+		for attr := range required {
+			if !hasAttr(user, attr) {
+				missing = append(missing, attr)
+			}
+		}
+		if len(missing) == 0 {
+			continue
+		}
+
+		slices.Sort(missing)
+		report(LintWarning, fmt.Sprintf("response.users[%d]", i),
+			"user %q has no %s, which the rule filter asserts", user.CN, strings.Join(missing, ", "))
+	}
+}
+
+// lintTemplates reports the response texts of a templated rule that do not
+// parse as templates.
+func lintTemplates(resp Response, report func(severity, field, format string, args ...any)) {
+	check := func(field, text string) {
+		if !strings.Contains(text, "{{") {
+			return
+		}
+
+		if _, err := template.New("").Funcs(templateFuncs).Parse(text); err != nil {
+			report(LintError, field, "invalid template %q: %v", text, err)
+		}
+	}
+
+	checkAttrs := func(field string, attrs map[string]string) {
+		for _, name := range slices.Sorted(maps.Keys(attrs)) {
+			check(field+".attrs."+name, attrs[name])
+		}
+	}
+
+	for i, user := range resp.Users {
+		field := fmt.Sprintf("response.users[%d]", i)
+		check(field+".cn", user.CN)
+		checkAttrs(field, user.Attrs)
+	}
+
+	for i, group := range resp.Groups {
+		field := fmt.Sprintf("response.groups[%d]", i)
+		check(field+".cn", group.CN)
+		checkAttrs(field, group.Attrs)
+
+		for j, member := range group.Members {
+			check(fmt.Sprintf("%s.members[%d]", field, j), member)
+		}
+	}
+}
+
+// assertedAttrs adds to attrs the attributes every entry matching f has: the
+// attributes of its assertions, outside OR and NOT.
+func assertedAttrs(f *Filter, attrs map[string]bool) {
+	switch f.Type {
+	case FilterAnd:
+		for _, child := range f.Children {
+			assertedAttrs(child, attrs)
+		}
+	case FilterOr, FilterNot:
+	case FilterExtensible:
+		if f.Attr != "" && !f.DNAttributes {
+			attrs[f.Attr] = true
+		}
+	default:
+		attrs[f.Attr] = true
+	}
+}
+
+// hasAttr reports whether user has the attribute attr, a lowercase name,
+// among its attributes or in the RDN of its DN.
+func hasAttr(user User, attr string) bool {
+	for name := range user.Attrs {
+		if strings.EqualFold(name, attr) {
+			return true
+		}
+	}
+
+	if rdns := splitDN(user.CN); len(rdns) > 0 {
+		for _, ava := range strings.Split(rdns[0], "+") {
+			if name, _, ok := strings.Cut(ava, "="); ok && strings.EqualFold(strings.TrimSpace(name), attr) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// shadowingRule returns the index of a rule of rules evaluated before rule i
+// that matches the same searches unconditionally, or -1.
+func shadowingRule(rules []Rule, i int) int {
+	rule := &rules[i]
+	if _, err := ParseFilter(rule.Filter); err != nil {
+		return -1
+	}
+
+	for j := range rules {
+		other := &rules[j]
+		if j == i || other.Priority < rule.Priority || (other.Priority == rule.Priority && j > i) {
+			continue
+		}
+
+		if other.WhenExpr == "" &&
+			strings.EqualFold(strings.TrimSpace(other.Filter), strings.TrimSpace(rule.Filter)) &&
+			strings.EqualFold(other.BaseDN, rule.BaseDN) &&
+			sameMode(other.BaseDNMatch, rule.BaseDNMatch, BaseDNExact) &&
+			sameMode(other.FilterMatch, rule.FilterMatch, FilterMatchStructural) &&
+			strings.EqualFold(other.Scope, rule.Scope) {
+			return j
+		}
+	}
+
+	return -1
+}
+
+// sameMode reports whether the matching modes a and b are the same, where
+// an empty mode is def.
+func sameMode(a, b, def string) bool {
+	if a == "" {
+		a = def
+	}
+	if b == "" {
+		b = def
+	}
+
+	return strings.EqualFold(a, b)
+}
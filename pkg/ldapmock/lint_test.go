@@ -0,0 +1,112 @@
+package ldapmock
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLintMock(t *testing.T) {
+	mock, err := ParseMockYAML([]byte(`
+rules:
+  - id: john
+    filter: "(&(uid=john)(mail=*))"
+    response:
+      users:
+        - cn: uid=john,dc=example
+          attrs:
+            mail: john@example.com
+        - cn: cn=jane,dc=example
+  - id: broken
+    filter: "(uid=john"
+    scope: subtree
+    filter_match: fuzzy
+    when_expr: "request.scope =="
+    response:
+      max_entries: -1
+  - id: copy
+    filter: "(&(uid=john)(mail=*))"
+  - id: scripted
+    filter: "(uid=x)"
+    script: run
+    passthrough: true
+  - id: templated
+    filter: "(uid=y)"
+    template: true
+    response:
+      users:
+        - cn: "uid={{ .Values.uid"
+  - id: compiled
+    filter: "(uid=z)"
+    wasm: responder.wasm
+    template: true
+tenants:
+  - name: acme
+    rules:
+      - id: john
+        filter: "(uid=*)"
+        priority: 1
+        response:
+          users:
+            - cn: uid=a,dc=acme
+              attrs:
+                UID: a
+computed:
+  displayName: "{{ .givenName }} {{ .sn }}"
+  initials: "{{ initials .givenName"
+`))
+	if err != nil {
+		t.Fatalf("parse mock: %v", err)
+	}
+
+	lint := LintMock(mock)
+
+	want := []struct {
+		severity string
+		path     string
+		message  string
+	}{
+		{LintWarning, "rules[0].response.users[1]", `user "cn=jane,dc=example" has no mail, uid`},
+		{LintError, "rules[1].filter", `invalid filter "(uid=john"`},
+		{LintError, "rules[1].scope", `invalid scope "subtree"`},
+		{LintError, "rules[1].filter_match", `invalid filter_match "fuzzy"`},
+		{LintError, "rules[1].when_expr", "invalid when_expr"},
+		{LintError, "rules[1].response.max_entries", "invalid max_entries -1"},
+		{LintWarning, "rules[2]", `never matches: rule "john" at rules[0]`},
+		{LintWarning, "rules[3].passthrough", "passthrough is ignored"},
+		{LintError, "rules[4].response.users[0].cn", "invalid template"},
+		{LintWarning, "rules[5].template", "the WASM module answers matched searches"},
+		{LintError, "tenants[0].base_dn", "no base DN"},
+		{LintError, "tenants[0].rules[0].id", `id "john" is also used by rules[0]`},
+		{LintError, "computed.initials", "invalid template"},
+	}
+
+	if len(lint.Issues) != len(want) {
+		t.Fatalf("issues = %+v, want %d", lint.Issues, len(want))
+	}
+
+	for i, w := range want {
+		issue := lint.Issues[i]
+		if issue.Severity != w.severity || issue.Path != w.path || !strings.Contains(issue.Message, w.message) {
+			t.Errorf("issue %d = %+v, want %s at %s: %s", i, issue, w.severity, w.path, w.message)
+		}
+	}
+
+	if lint.Errors != 9 || lint.Warnings != 4 {
+		t.Errorf("errors, warnings = %d, %d; want 9, 4", lint.Errors, lint.Warnings)
+	}
+	if tenant := lint.Issues[11]; tenant.Tenant != "acme" || tenant.RuleID != "john" {
+		t.Errorf("tenant issue = %+v", tenant)
+	}
+}
+
+func TestLintMock_Clean(t *testing.T) {
+	lint := LintMock(LDAPMock{Rules: []Rule{
+		{ID: "a", Filter: "(uid=john)", Response: Response{Users: []User{{CN: "uid=john,dc=example"}}}},
+		{ID: "b", Filter: "(uid=john)", Scope: "base"},
+		{ID: "c", Filter: "(|(uid=john)(mail=john@example.com))", Priority: 1},
+	}})
+
+	if len(lint.Issues) != 0 {
+		t.Errorf("issues = %+v, want none", lint.Issues)
+	}
+}
@@ -0,0 +1,99 @@
+package ldapmock
+
+import (
+	"maps"
+	"slices"
+)
+
+// MergeMocks merges mocks, such as the files of a mock directory, into one,
+// in order: users, groups, rules and scheduled changes are appended, tenants
+// with the same base DN are merged, and attribute syntaxes, computed
+// attributes, the root DSE, latency and paging of later mocks override those
+// of earlier ones; a namespace disabled in any mock is disabled. The priority
+// of the rules of each mock, including tenant rules and scheduled ones, is
+// raised by its PriorityOffset; rules with the same priority keep the merge
+// order.
+// The mocks are not modified.
+func MergeMocks(mocks ...LDAPMock) LDAPMock {
+	var merged LDAPMock
+
+	for _, mock := range mocks {
+		mock = mock.Clone()
+		offsetRules(mock.Rules, mock.PriorityOffset)
+		for i := range mock.Schedule {
+			offsetRules(mock.Schedule[i].AddRules, mock.PriorityOffset)
+		}
+
+		merged.Users = append(merged.Users, mock.Users...)
+		merged.Groups = append(merged.Groups, mock.Groups...)
+		merged.Rules = append(merged.Rules, mock.Rules...)
+		merged.Schedule = append(merged.Schedule, mock.Schedule...)
+
+		for _, tenant := range mock.Tenants {
+			offsetRules(tenant.Rules, mock.PriorityOffset)
+			merged.Tenants = mergeTenant(merged.Tenants, tenant)
+		}
+
+		if mock.Attributes != nil {
+			if merged.Attributes == nil {
+				merged.Attributes = make(AttributeSyntaxes, len(mock.Attributes))
+			}
+			maps.Copy(merged.Attributes, mock.Attributes)
+		}
+
+		if mock.Computed != nil {
+			if merged.Computed == nil {
+				merged.Computed = make(map[string]string, len(mock.Computed))
+			}
+			maps.Copy(merged.Computed, mock.Computed)
+		}
+
+		if mock.RootDSE != nil {
+			merged.RootDSE = mock.RootDSE
+		}
+
+		if mock.Latency != nil {
+			merged.Latency = mock.Latency
+		}
+
+		if mock.Paging != nil {
+			merged.Paging = mock.Paging
+		}
+
+		for _, name := range mock.DisabledNamespaces {
+			if !slices.Contains(merged.DisabledNamespaces, name) {
+				merged.DisabledNamespaces = append(merged.DisabledNamespaces, name)
+			}
+		}
+	}
+
+	return merged
+}
+
+func offsetRules(rules []Rule, offset int) {
+	for i := range rules {
+		rules[i].Priority += offset
+	}
+}
+
+// mergeTenant appends the directory of tenant to the tenant of tenants with
+// the same base DN, or appends tenant.
+func mergeTenant(tenants []Tenant, tenant Tenant) []Tenant {
+	for i := range tenants {
+		existing := &tenants[i]
+		if !slices.Equal(splitDN(existing.BaseDN), splitDN(tenant.BaseDN)) {
+			continue
+		}
+
+		if existing.Name == "" {
+			existing.Name = tenant.Name
+		}
+		existing.Users = append(existing.Users, tenant.Users...)
+		existing.Groups = append(existing.Groups, tenant.Groups...)
+		existing.Rules = append(existing.Rules, tenant.Rules...)
+
+		return tenants
+	}
+
+	return append(tenants, tenant)
+}
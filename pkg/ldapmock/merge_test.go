@@ -0,0 +1,51 @@
+package ldapmock
+
+import (
+	"testing"
+)
+
+func TestMergeMocks(t *testing.T) {
+	users := LDAPMock{
+		Users:      []User{{CN: "uid=john,dc=example"}},
+		Rules:      []Rule{{ID: "john", Filter: "(uid=john)", Priority: 1}},
+		Attributes: AttributeSyntaxes{"uidNumber": SyntaxInteger},
+		Computed:   map[string]string{"mail": "{{ .uid }}@example.com"},
+		Tenants:    []Tenant{{Name: "acme", BaseDN: "dc=acme,dc=com", Rules: []Rule{{ID: "acme-users"}}}},
+	}
+	groups := LDAPMock{
+		PriorityOffset: 100,
+		Groups:         []Group{{CN: "cn=admins,dc=example"}},
+		Rules:          []Rule{{ID: "admins", Filter: "(cn=admins)"}},
+		Tenants: []Tenant{
+			{BaseDN: "DC=Acme, DC=com", Rules: []Rule{{ID: "acme-groups", Priority: 2}}},
+			{Name: "globex", BaseDN: "dc=globex,dc=com"},
+		},
+		Schedule: []ScheduledChange{{AddRules: []Rule{{ID: "later"}}}},
+		Computed: map[string]string{"mail": "{{ .cn }}@example.com"},
+	}
+
+	merged := MergeMocks(users, groups)
+
+	if len(merged.Users) != 1 || len(merged.Groups) != 1 || merged.PriorityOffset != 0 {
+		t.Errorf("merged = %+v", merged)
+	}
+	if len(merged.Rules) != 2 || merged.Rules[0].Priority != 1 || merged.Rules[1].ID != "admins" || merged.Rules[1].Priority != 100 {
+		t.Errorf("rules = %+v", merged.Rules)
+	}
+	if len(merged.Tenants) != 2 || len(merged.Tenants[0].Rules) != 2 || merged.Tenants[0].Rules[1].Priority != 102 {
+		t.Errorf("tenants = %+v", merged.Tenants)
+	}
+	if len(merged.Schedule) != 1 || merged.Schedule[0].AddRules[0].Priority != 100 {
+		t.Errorf("schedule = %+v", merged.Schedule)
+	}
+	if merged.Attributes["uidNumber"] != SyntaxInteger {
+		t.Errorf("attributes = %+v", merged.Attributes)
+	}
+	if merged.Computed["mail"] != "{{ .cn }}@example.com" {
+		t.Errorf("computed = %+v", merged.Computed)
+	}
+
+	if groups.Rules[0].Priority != 0 || groups.Tenants[0].Rules[0].Priority != 2 {
+		t.Error("MergeMocks modified its input")
+	}
+}
@@ -0,0 +1,145 @@
+package ldapmock
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LatencyBuckets are the upper bounds, in seconds, of the search latency
+// histograms; the last, implicit bucket is +Inf.
+var LatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// LatencyHistogram is the distribution of the response times of the
+// searches answered by one rule with one result, from the search request to
+// the result handed to the connection; the writing of throttled results is
+// not included.
+type LatencyHistogram struct {
+	// Rule identifies the matched rule by ID, then name, then filter; it is
+	// empty for the searches no rule matched.
+	Rule string `json:"rule"`
+	// Result is the LDAP result, such as Success or Busy.
+	Result string `json:"result"`
+	Count  int    `json:"count"`
+	// Sum is the total response time in seconds.
+	Sum float64 `json:"sum"`
+	// Buckets count the searches at or below each of LatencyBuckets,
+	// cumulatively like Prometheus histograms.
+	Buckets []LatencyBucket `json:"buckets"`
+}
+
+// LatencyBucket counts the searches that took at most LE seconds.
+type LatencyBucket struct {
+	LE    float64 `json:"le"`
+	Count int     `json:"count"`
+}
+
+type latencyKey struct {
+	rule   string
+	result string
+}
+
+// latencyHistogram holds the per-bucket (not cumulative) counts of a
+// LatencyHistogram, with the +Inf bucket last.
+type latencyHistogram struct {
+	counts []int
+	sum    time.Duration
+}
+
+func (h *latencyHistogram) observe(d time.Duration) {
+	if h.counts == nil {
+		h.counts = make([]int, len(LatencyBuckets)+1)
+	}
+
+	i, _ := slices.BinarySearch(LatencyBuckets, d.Seconds())
+	h.counts[i]++
+	h.sum += d
+}
+
+func (h *latencyHistogram) snapshot(key latencyKey) LatencyHistogram {
+	histogram := LatencyHistogram{
+		Rule:    key.rule,
+		Result:  key.result,
+		Sum:     h.sum.Seconds(),
+		Buckets: make([]LatencyBucket, len(LatencyBuckets)),
+	}
+
+	for i, le := range LatencyBuckets {
+		histogram.Count += h.counts[i]
+		histogram.Buckets[i] = LatencyBucket{LE: le, Count: histogram.Count}
+	}
+	histogram.Count += h.counts[len(LatencyBuckets)]
+
+	return histogram
+}
+
+// latencyRuleLabel names rule in latency histograms.
+func latencyRuleLabel(rule *Rule) string {
+	switch {
+	case rule == nil:
+		return ""
+	case rule.ID != "":
+		return rule.ID
+	case rule.Name != "":
+		return rule.Name
+	default:
+		return rule.Filter
+	}
+}
+
+// sortLatency orders histograms by rule, then result.
+func sortLatency(histograms []LatencyHistogram) {
+	slices.SortFunc(histograms, func(a, b LatencyHistogram) int {
+		if c := cmp.Compare(a.Rule, b.Rule); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Result, b.Result)
+	})
+}
+
+// writeMetrics writes stats in the Prometheus text exposition format.
+func writeMetrics(w io.Writer, stats Stats) error {
+	var b strings.Builder
+
+	b.WriteString("# HELP ldapmock_searches_total Searches served since the mock was last set, by outcome.\n")
+	b.WriteString("# TYPE ldapmock_searches_total counter\n")
+	for _, outcome := range []struct {
+		name  string
+		count int
+	}{
+		{"matched", stats.Matched},
+		{"fallback", stats.Fallback},
+		{"failed", stats.Failed},
+	} {
+		fmt.Fprintf(&b, "ldapmock_searches_total{outcome=%q} %d\n", outcome.name, outcome.count)
+	}
+
+	b.WriteString("# HELP ldapmock_search_duration_seconds Search response time by matched rule and result.\n")
+	b.WriteString("# TYPE ldapmock_search_duration_seconds histogram\n")
+	for _, h := range stats.Latency {
+		labels := fmt.Sprintf(`rule="%s",result="%s"`, escapeLabel(h.Rule), escapeLabel(h.Result))
+
+		for _, bucket := range h.Buckets {
+			fmt.Fprintf(&b, "ldapmock_search_duration_seconds_bucket{%s,le=\"%s\"} %d\n",
+				labels, strconv.FormatFloat(bucket.LE, 'g', -1, 64), bucket.Count)
+		}
+		fmt.Fprintf(&b, "ldapmock_search_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, h.Count)
+		fmt.Fprintf(&b, "ldapmock_search_duration_seconds_sum{%s} %s\n", labels, strconv.FormatFloat(h.Sum, 'g', -1, 64))
+		fmt.Fprintf(&b, "ldapmock_search_duration_seconds_count{%s} %d\n", labels, h.Count)
+	}
+
+	_, err := io.WriteString(w, b.String())
+
+	return err
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escapeLabel escapes a Prometheus label value.
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
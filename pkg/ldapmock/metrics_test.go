@@ -0,0 +1,91 @@
+package ldapmock
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+func TestSearchStatsLatency(t *testing.T) {
+	var st searchStats
+
+	rule := &Rule{ID: "slow"}
+	st.observeLatency(rule, nil, 30*time.Millisecond)
+	st.observeLatency(rule, nil, 100*time.Millisecond)
+	st.observeLatency(rule, nil, 20*time.Second)
+	st.observeLatency(rule, ldap.NewError(ldap.LDAPResultBusy, errors.New("busy")), time.Millisecond)
+	st.observeLatency(nil, nil, time.Millisecond)
+
+	latency := st.snapshot().Latency
+	if len(latency) != 3 {
+		t.Fatalf("latency = %+v, want 3 histograms", latency)
+	}
+
+	if latency[0].Rule != "" || latency[0].Result != "Success" || latency[0].Count != 1 {
+		t.Errorf("fallback histogram = %+v", latency[0])
+	}
+	if latency[1].Rule != "slow" || latency[1].Result != "Busy" || latency[1].Buckets[0].Count != 1 {
+		t.Errorf("busy histogram = %+v", latency[1])
+	}
+
+	success := latency[2]
+	if success.Rule != "slow" || success.Result != "Success" || success.Count != 3 {
+		t.Fatalf("success histogram = %+v", success)
+	}
+	if want := 20.13; success.Sum < want-1e-9 || success.Sum > want+1e-9 {
+		t.Errorf("sum = %v, want %v", success.Sum, want)
+	}
+
+	// Buckets are cumulative and include their upper bound.
+	want := map[float64]int{0.025: 0, 0.05: 1, 0.1: 2, 10: 2}
+	for _, bucket := range success.Buckets {
+		if count, ok := want[bucket.LE]; ok && bucket.Count != count {
+			t.Errorf("bucket le=%v count = %d, want %d", bucket.LE, bucket.Count, count)
+		}
+	}
+
+	// 31406ns is 3.1406e-05s, which converts back to 31405.999...ns.
+	st.observeLatency(nil, nil, 31406*time.Nanosecond)
+
+	var restored searchStats
+	restored.restore(Counters{Stats: st.snapshot()})
+	if got, want := restored.snapshot().Latency, st.snapshot().Latency; !reflect.DeepEqual(got, want) {
+		t.Errorf("restored latency = %+v, want %+v", got, want)
+	}
+
+	st.reset()
+	if latency := st.snapshot().Latency; len(latency) != 0 {
+		t.Errorf("after reset = %+v", latency)
+	}
+}
+
+func TestWriteMetrics(t *testing.T) {
+	var st searchStats
+	st.observeLatency(&Rule{Filter: `(cn="quoted")`}, nil, 7*time.Millisecond)
+
+	stats := st.snapshot()
+	stats.Matched = 1
+
+	var b strings.Builder
+	if err := writeMetrics(&b, stats); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	for _, line := range []string{
+		`ldapmock_searches_total{outcome="matched"} 1`,
+		`# TYPE ldapmock_search_duration_seconds histogram`,
+		`ldapmock_search_duration_seconds_bucket{rule="(cn=\"quoted\")",result="Success",le="0.005"} 0`,
+		`ldapmock_search_duration_seconds_bucket{rule="(cn=\"quoted\")",result="Success",le="0.01"} 1`,
+		`ldapmock_search_duration_seconds_bucket{rule="(cn=\"quoted\")",result="Success",le="+Inf"} 1`,
+		`ldapmock_search_duration_seconds_sum{rule="(cn=\"quoted\")",result="Success"} 0.007`,
+		`ldapmock_search_duration_seconds_count{rule="(cn=\"quoted\")",result="Success"} 1`,
+	} {
+		if !strings.Contains(b.String(), line+"\n") {
+			t.Errorf("metrics lack %s:\n%s", line, b.String())
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package ldapmock
+
+import (
+	"context"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// SearchFunc handles one search request.
+type SearchFunc func(ctx context.Context, req SearchRequest) (SearchResult, error)
+
+// SearchMiddleware wraps search handling, e.g. to inject failures, delay
+// responses or collect metrics:
+//
+//	srv.Use(func(next ldapmock.SearchFunc) ldapmock.SearchFunc {
+//		return func(ctx context.Context, req ldapmock.SearchRequest) (ldapmock.SearchResult, error) {
+//			time.Sleep(100 * time.Millisecond)
+//			return next(ctx, req)
+//		}
+//	})
+type SearchMiddleware func(next SearchFunc) SearchFunc
+
+// Use appends middlewares to the search chain. They run in the order given,
+// inside the built-in logging, shadow and statistics middlewares (so the request log
+// records what they return) and around the Handler.
+func (s *LDAPServer) Use(middlewares ...SearchMiddleware) {
+	s.middlewareMu.Lock()
+	defer s.middlewareMu.Unlock()
+
+	s.middlewares = append(s.middlewares, middlewares...)
+}
+
+func (s *LDAPServer) searchChain() SearchFunc {
+	s.middlewareMu.RLock()
+	middlewares := make([]SearchMiddleware, 0, len(s.middlewares)+11)
+	middlewares = append(middlewares, s.logSearchMiddleware, s.requestLogMiddleware, s.outageMiddleware,
+		s.rateLimitMiddleware, s.busyMiddleware, s.shadowMiddleware, s.statsMiddleware, s.globalCatalogMiddleware,
+		s.dirSyncMiddleware, s.syncMiddleware, s.pagingMiddleware)
+	middlewares = append(middlewares, s.middlewares...)
+	s.middlewareMu.RUnlock()
+
+	handler := s.currentHandler()
+	next := SearchFunc(handler.OnSearch)
+
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		next = middlewares[i](next)
+	}
+
+	return next
+}
+
+func (s *LDAPServer) logSearchMiddleware(next SearchFunc) SearchFunc {
+	return func(ctx context.Context, req SearchRequest) (SearchResult, error) {
+		log := s.logger(ctx)
+		log.Info("search request",
+			zap.String("base_dn", req.BaseDN),
+			zap.String("filter", req.Filter),
+			zap.Stringer("scope", req.Scope),
+		)
+
+		result, err := next(ctx, req)
+		if err != nil {
+			log.Info("search failed", zap.Error(err))
+		}
+
+		return result, err
+	}
+}
+
+func (s *LDAPServer) requestLogMiddleware(next SearchFunc) SearchFunc {
+	return func(ctx context.Context, req SearchRequest) (SearchResult, error) {
+		result, err := next(ctx, req)
+
+		dns := []string{}
+		if err == nil {
+			dns = returnedDNs(result.Users, result.Groups)
+			for _, entry := range result.Entries {
+				dns = append(dns, entry.DN)
+			}
+		}
+
+		requestLog := s.newRequestLog(ctx, "search", err)
+		requestLog.BaseDN = req.BaseDN
+		requestLog.Scope = req.Scope.String()
+		requestLog.Filter = req.Filter
+		requestLog.Attributes = req.Attributes
+		requestLog.Controls = req.Controls
+		requestLog.Upstream = result.Upstream
+		requestLog.ShadowDiff = result.ShadowDiff
+		requestLog.Response = LDAPResponseLog{
+			ReturnedDNs: dns,
+			Count:       len(dns),
+		}
+
+		if result.MatchedRule != nil {
+			requestLog.MatchedRule = &MatchedRuleLog{
+				RuleID:   result.MatchedRule.ID,
+				RuleName: result.MatchedRule.Name,
+			}
+		}
+
+		s.logRequest(requestLog)
+
+		return result, err
+	}
+}
+
+// logBind records a bind attempt in the request log.
+func (s *LDAPServer) logBind(ctx context.Context, req BindRequest, err error) {
+	requestLog := s.newRequestLog(ctx, "bind", err)
+	requestLog.BindDN = req.DN
+	requestLog.Controls = req.Controls
+
+	s.logRequest(requestLog)
+}
+
+func (s *LDAPServer) newRequestLog(ctx context.Context, typ string, err error) LDAPRequestLog {
+	requestLog := LDAPRequestLog{
+		Timestamp:   s.clock.now().UTC(),
+		Type:        typ,
+		MockVersion: s.snapshot(ctx).version,
+		Result:      ldap.LDAPResultCodeMap[resultCode(err)],
+	}
+
+	if id, ok := RequestIDFromContext(ctx); ok {
+		requestLog.RequestID = id
+	} else {
+		requestLog.RequestID = uuid.NewString()
+	}
+
+	if conn, ok := ConnInfoFromContext(ctx); ok {
+		if conn.RemoteAddr != nil {
+			requestLog.ClientAddr = conn.RemoteAddr.String()
+		}
+		requestLog.AddrFamily = conn.AddressFamily()
+	}
+
+	return requestLog
+}
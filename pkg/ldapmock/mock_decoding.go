@@ -0,0 +1,107 @@
+package ldapmock
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v2"
+)
+
+// MockDecoding controls how POST /mock and the Load methods of MockServer
+// treat mock fields they do not know, as part of the runtime config of
+// /config.
+type MockDecoding struct {
+	// Strict rejects mocks with unknown fields, e.g. a misspelt priority;
+	// otherwise they are loaded and the fields reported as warnings.
+	Strict bool `json:"strict"`
+}
+
+// UnknownFieldsError is returned when a mock with unknown fields is loaded
+// in strict mode.
+type UnknownFieldsError struct {
+	// Fields describes the unknown fields, e.g.
+	// "line 4: field prioritiy not found in type ldapmock.Rule".
+	Fields []string
+}
+
+func (e *UnknownFieldsError) Error() string {
+	return "unknown fields: " + strings.Join(e.Fields, "; ")
+}
+
+// SetMockDecoding replaces the mock decoding settings. It can be called
+// while serving.
+func (s *MockServer) SetMockDecoding(cfg MockDecoding) {
+	s.decodingMu.Lock()
+	defer s.decodingMu.Unlock()
+
+	s.decoding = cfg
+}
+
+// MockDecoding returns the current mock decoding settings.
+func (s *MockServer) MockDecoding() MockDecoding {
+	s.decodingMu.RLock()
+	defer s.decodingMu.RUnlock()
+
+	return s.decoding
+}
+
+// DecodeMockYAML decodes a mock spec like ParseMockYAML and also returns the
+// fields it ignored because LDAPMock has no such field, or sets them twice.
+func DecodeMockYAML(data []byte) (LDAPMock, []string, error) {
+	mock, err := ParseMockYAML(data)
+	if err != nil {
+		return LDAPMock{}, nil, err
+	}
+
+	var strict LDAPMock
+	if err := yaml.UnmarshalStrict(data, &strict); err != nil {
+		var typeErr *yaml.TypeError
+		if !errors.As(err, &typeErr) {
+			return LDAPMock{}, nil, fmt.Errorf("decode yaml mock: %w", err)
+		}
+
+		return mock, typeErr.Errors, nil
+	}
+
+	return mock, nil, nil
+}
+
+// DecodeMockJSON decodes a mock spec like ParseMockJSON and also returns the
+// first field it ignored because LDAPMock has no such field. Fields of
+// latencies and scheduled changes are not checked.
+func DecodeMockJSON(data []byte) (LDAPMock, []string, error) {
+	mock, err := ParseMockJSON(data)
+	if err != nil {
+		return LDAPMock{}, nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	var strict LDAPMock
+	if err := dec.Decode(&strict); err != nil {
+		return mock, []string{strings.TrimPrefix(err.Error(), "json: ")}, nil
+	}
+
+	return mock, nil, nil
+}
+
+// checkUnknownFields fails with the unknown fields of a mock in strict mode,
+// and logs them otherwise.
+func (s *MockServer) checkUnknownFields(fields []string) error {
+	if len(fields) == 0 {
+		return nil
+	}
+
+	if s.MockDecoding().Strict {
+		return &UnknownFieldsError{Fields: fields}
+	}
+
+	s.log.Warn("mock has unknown fields", zap.Strings("fields", fields))
+
+	return nil
+}
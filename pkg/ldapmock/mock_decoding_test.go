@@ -0,0 +1,58 @@
+package ldapmock
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDecodeMockYAML(t *testing.T) {
+	mock, unknown, err := DecodeMockYAML([]byte(`
+users:
+  - cn: uid=john,dc=example
+    atrs:
+      mail: john@example.com
+rules:
+  - filter: (uid=john)
+    prioritiy: 5
+    latency:
+      p50: 10ms
+      p51: 20ms
+`))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	if len(mock.Users) != 1 || len(mock.Rules) != 1 || mock.Rules[0].Filter != "(uid=john)" {
+		t.Errorf("mock = %+v", mock)
+	}
+
+	if len(unknown) != 3 ||
+		!strings.Contains(unknown[0], "field atrs not found") ||
+		!strings.Contains(unknown[1], "field prioritiy not found") ||
+		!strings.Contains(unknown[2], "field p51 not found") {
+		t.Errorf("unknown fields = %q", unknown)
+	}
+
+	if _, unknown, err := DecodeMockYAML([]byte("rules:\n  - filter: (uid=john)\n    priority: 5\n")); err != nil || unknown != nil {
+		t.Errorf("valid mock: unknown fields %q, %v", unknown, err)
+	}
+
+	if _, _, err := DecodeMockYAML([]byte("rules: [")); err == nil {
+		t.Error("expected error for invalid YAML")
+	}
+}
+
+func TestDecodeMockJSON(t *testing.T) {
+	mock, unknown, err := DecodeMockJSON([]byte(`{"rules": [{"filter": "(uid=john)", "prioritiy": 5}]}`))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	if len(mock.Rules) != 1 || len(unknown) != 1 || !strings.Contains(unknown[0], `"prioritiy"`) {
+		t.Errorf("mock = %+v, unknown fields = %q", mock, unknown)
+	}
+
+	if _, unknown, err := DecodeMockJSON([]byte(`{"rules": [{"filter": "(uid=john)"}]}`)); err != nil || unknown != nil {
+		t.Errorf("valid mock: unknown fields %q, %v", unknown, err)
+	}
+}
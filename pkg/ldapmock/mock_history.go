@@ -0,0 +1,211 @@
+package ldapmock
+
+import (
+	"cmp"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMockHistoryCapacity is the number of mock versions the history
+// keeps; older ones are dropped.
+const DefaultMockHistoryCapacity = 100
+
+// Kinds of ItemDiff changes.
+const (
+	DiffAdded   = "added"
+	DiffRemoved = "removed"
+	DiffChanged = "changed"
+)
+
+// MockVersion is a mock the server served. Every SetMock and every applied
+// scheduled change makes a new version, numbered from 1.
+type MockVersion struct {
+	Version uint64    `json:"version"`
+	Time    time.Time `json:"time"`
+}
+
+// MockHistoryProvider is implemented by mock holders that keep the mocks they
+// served, as used by GET /mock/history and GET /mock/diff.
+type MockHistoryProvider interface {
+	// MockHistory returns the versions kept, oldest first.
+	MockHistory() []MockVersion
+	// MockAt returns a copy of the mock of version; ok is false when the
+	// version is not kept.
+	MockAt(version uint64) (mock LDAPMock, ok bool)
+}
+
+// mockHistory keeps the last mock versions in memory.
+type mockHistory struct {
+	mu       sync.Mutex
+	versions []MockVersion
+	mocks    []LDAPMock
+	last     uint64
+	capacity int
+}
+
+// record adds mock, which must not be modified afterwards, and returns its
+// version.
+func (h *mockHistory) record(mock LDAPMock, now time.Time) uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.last++
+	h.versions = append(h.versions, MockVersion{Version: h.last, Time: now.UTC()})
+	h.mocks = append(h.mocks, mock)
+
+	capacity := h.capacity
+	if capacity <= 0 {
+		capacity = DefaultMockHistoryCapacity
+	}
+	if extra := len(h.versions) - capacity; extra > 0 {
+		h.versions = slices.Delete(h.versions, 0, extra)
+		h.mocks = slices.Delete(h.mocks, 0, extra)
+	}
+
+	return h.last
+}
+
+func (h *mockHistory) list() []MockVersion {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return slices.Clone(h.versions)
+}
+
+func (h *mockHistory) at(version uint64) (LDAPMock, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	i, ok := slices.BinarySearchFunc(h.versions, version, func(v MockVersion, version uint64) int {
+		return cmp.Compare(v.Version, version)
+	})
+	if !ok {
+		return LDAPMock{}, false
+	}
+
+	return h.mocks[i].Clone(), true
+}
+
+// MockHistory returns the last DefaultMockHistoryCapacity mock versions,
+// oldest first.
+func (s *LDAPServer) MockHistory() []MockVersion {
+	return s.history.list()
+}
+
+// MockAt returns a copy of the mock of version, if it is still in the
+// history.
+func (s *LDAPServer) MockAt(version uint64) (LDAPMock, bool) {
+	return s.history.at(version)
+}
+
+// MockDiff is what changed between two mock versions, as returned by
+// GET /mock/diff: the users, groups and rules of the top-level directory and
+// of the tenants that were added, removed or changed.
+type MockDiff struct {
+	From   uint64            `json:"from"`
+	To     uint64            `json:"to"`
+	Users  []ItemDiff[User]  `json:"users"`
+	Groups []ItemDiff[Group] `json:"groups"`
+	Rules  []ItemDiff[Rule]  `json:"rules"`
+}
+
+// ItemDiff is a user, group or rule of a MockDiff. Before is nil for added
+// items, After for removed ones.
+type ItemDiff[T any] struct {
+	// Key is the DN of users and groups, and the ID, name or filter of rules.
+	Key string `json:"key"`
+	// Tenant is the name of the tenant of the item, empty for the top-level
+	// directory.
+	Tenant string `json:"tenant,omitempty"`
+	Change string `json:"change"`
+	Before *T     `json:"before,omitempty"`
+	After  *T     `json:"after,omitempty"`
+}
+
+// DiffMocks compares two mocks. Users and groups are matched by DN ignoring
+// case, rules by ID, then name, then filter; items are listed in the order
+// of after, then the removed ones in the order of before.
+func DiffMocks(before, after LDAPMock) MockDiff {
+	diff := MockDiff{Users: []ItemDiff[User]{}, Groups: []ItemDiff[Group]{}, Rules: []ItemDiff[Rule]{}}
+
+	userKey := func(user User) (string, string) { return strings.ToLower(user.CN), user.CN }
+	groupKey := func(group Group) (string, string) { return strings.ToLower(group.CN), group.CN }
+	rulesKey := func(rule Rule) (string, string) { return ruleKey(&rule), latencyRuleLabel(&rule) }
+
+	add := func(tenant string, beforeDir, afterDir Tenant) {
+		diff.Users = append(diff.Users, diffItems(tenant, beforeDir.Users, afterDir.Users, userKey)...)
+		diff.Groups = append(diff.Groups, diffItems(tenant, beforeDir.Groups, afterDir.Groups, groupKey)...)
+		diff.Rules = append(diff.Rules, diffItems(tenant, beforeDir.Rules, afterDir.Rules, rulesKey)...)
+	}
+
+	add("", Tenant{Users: before.Users, Groups: before.Groups, Rules: before.Rules},
+		Tenant{Users: after.Users, Groups: after.Groups, Rules: after.Rules})
+
+	beforeTenants := make(map[string]Tenant, len(before.Tenants))
+	for _, tenant := range before.Tenants {
+		beforeTenants[tenant.Name] = tenant
+	}
+	afterTenants := make(map[string]bool, len(after.Tenants))
+	for _, tenant := range after.Tenants {
+		afterTenants[tenant.Name] = true
+		add(tenant.Name, beforeTenants[tenant.Name], tenant)
+	}
+	for _, tenant := range before.Tenants {
+		if !afterTenants[tenant.Name] {
+			add(tenant.Name, tenant, Tenant{})
+		}
+	}
+
+	return diff
+}
+
+// diffItems compares the items of one directory. key returns what items are
+// matched on and their ItemDiff key; items with the same key are matched in
+// order.
+func diffItems[T any](tenant string, before, after []T, key func(T) (string, string)) []ItemDiff[T] {
+	// occurrences numbers the items with the same key.
+	occurrences := func(items []T) []string {
+		seen := make(map[string]int, len(items))
+		keys := make([]string, len(items))
+		for i, item := range items {
+			match, _ := key(item)
+			keys[i] = match + "#" + strconv.Itoa(seen[match])
+			seen[match]++
+		}
+		return keys
+	}
+
+	beforeKeys, afterKeys := occurrences(before), occurrences(after)
+	beforeIndex := make(map[string]int, len(before))
+	for i, k := range beforeKeys {
+		beforeIndex[k] = i
+	}
+	afterIndex := make(map[string]bool, len(after))
+
+	var diffs []ItemDiff[T]
+	for i := range after {
+		afterIndex[afterKeys[i]] = true
+		_, label := key(after[i])
+
+		j, ok := beforeIndex[afterKeys[i]]
+		switch {
+		case !ok:
+			diffs = append(diffs, ItemDiff[T]{Key: label, Tenant: tenant, Change: DiffAdded, After: &after[i]})
+		case !reflect.DeepEqual(before[j], after[i]):
+			diffs = append(diffs, ItemDiff[T]{Key: label, Tenant: tenant, Change: DiffChanged, Before: &before[j], After: &after[i]})
+		}
+	}
+
+	for i := range before {
+		if !afterIndex[beforeKeys[i]] {
+			_, label := key(before[i])
+			diffs = append(diffs, ItemDiff[T]{Key: label, Tenant: tenant, Change: DiffRemoved, Before: &before[i]})
+		}
+	}
+
+	return diffs
+}
@@ -0,0 +1,95 @@
+package ldapmock
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDiffMocks(t *testing.T) {
+	before := LDAPMock{
+		Users: []User{
+			{CN: "uid=john,dc=example", Attrs: map[string]string{"mail": "john@example.com"}},
+			{CN: "uid=jane,dc=example"},
+		},
+		Rules: []Rule{
+			{ID: "login", Filter: "(uid=john)"},
+			{Filter: "(uid=old)"},
+		},
+		Tenants: []Tenant{
+			{Name: "acme", BaseDN: "dc=acme", Users: []User{{CN: "uid=bob,dc=acme"}}},
+			{Name: "gone", BaseDN: "dc=gone", Groups: []Group{{CN: "cn=admins,dc=gone"}}},
+		},
+	}
+	after := LDAPMock{
+		Users: []User{
+			{CN: "UID=John,DC=example", Attrs: map[string]string{"mail": "john@example.org"}},
+			{CN: "uid=alice,dc=example"},
+		},
+		Rules: []Rule{
+			{ID: "login", Filter: "(|(uid=john)(mail=john@*))"},
+		},
+		Tenants: []Tenant{
+			{Name: "acme", BaseDN: "dc=acme", Users: []User{{CN: "uid=bob,dc=acme"}}},
+		},
+	}
+
+	diff := DiffMocks(before, after)
+
+	summary := func(key, tenant, change string) string { return change + " " + tenant + "/" + key }
+	var got []string
+	for _, d := range diff.Users {
+		got = append(got, summary(d.Key, d.Tenant, d.Change))
+	}
+	for _, d := range diff.Groups {
+		got = append(got, summary(d.Key, d.Tenant, d.Change))
+	}
+	for _, d := range diff.Rules {
+		got = append(got, summary(d.Key, d.Tenant, d.Change))
+	}
+
+	want := []string{
+		"changed /UID=John,DC=example",
+		"added /uid=alice,dc=example",
+		"removed /uid=jane,dc=example",
+		"removed gone/cn=admins,dc=gone",
+		"changed /login",
+		"removed /(uid=old)",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("diff = %q, want %q", got, want)
+	}
+
+	changed := diff.Users[0]
+	if changed.Before.Attrs["mail"] != "john@example.com" || changed.After.Attrs["mail"] != "john@example.org" {
+		t.Errorf("changed user = %+v -> %+v", changed.Before, changed.After)
+	}
+	if diff.Users[1].Before != nil || diff.Users[2].After != nil {
+		t.Errorf("added and removed users have a before or after: %+v", diff.Users)
+	}
+
+	if diff := DiffMocks(after, after); len(diff.Users)+len(diff.Groups)+len(diff.Rules) != 0 {
+		t.Errorf("diff of a mock with itself = %+v, want nothing", diff)
+	}
+}
+
+func TestMockHistory(t *testing.T) {
+	history := mockHistory{capacity: 2}
+	now := time.Date(2026, 1, 31, 10, 0, 0, 0, time.UTC)
+
+	for i, cn := range []string{"uid=a", "uid=b", "uid=c"} {
+		if version := history.record(LDAPMock{Users: []User{{CN: cn}}}, now); version != uint64(i+1) {
+			t.Errorf("version of %s = %d, want %d", cn, version, i+1)
+		}
+	}
+
+	if got := history.list(); len(got) != 2 || got[0].Version != 2 || got[1].Version != 3 {
+		t.Errorf("history = %+v, want versions 2 and 3", got)
+	}
+	if _, ok := history.at(1); ok {
+		t.Error("version 1 is still in the history")
+	}
+	if mock, ok := history.at(2); !ok || mock.Users[0].CN != "uid=b" {
+		t.Errorf("version 2 = %+v, %v", mock, ok)
+	}
+}
@@ -0,0 +1,1025 @@
+package ldapmock
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"go.uber.org/zap"
+)
+
+// DefaultShutdownTimeout is how long Serve waits for HTTP requests in
+// progress on shutdown unless SetShutdownTimeout says otherwise.
+const DefaultShutdownTimeout = time.Second
+
+type MockHolder interface {
+	SetMock(mock LDAPMock)
+	GetMock() LDAPMock
+}
+
+// MockChangeNotifier is implemented by mock holders whose mock also changes
+// by other means than SetMock, such as LDAP writes, like LDAPServer.
+type MockChangeNotifier interface {
+	OnMockChange(fn func(mock LDAPMock))
+}
+
+type MockServer struct {
+	srv http.Server
+
+	port          string
+	log           *zap.Logger
+	mockHolder    MockHolder
+	requestLogger RequestLogger
+	mockMu        sync.RWMutex
+	lastMockYAML  string
+	// nextMockYAML is the YAML of the mock being set, for mock holders that
+	// notify changes (see MockChangeNotifier).
+	nextMockYAML *string
+	notified     bool
+	// setMockMu orders setMock calls, so that each YAML goes with its mock.
+	setMockMu sync.Mutex
+
+	addr   net.Addr
+	addrMu sync.Mutex
+
+	auth   MockAuth
+	authMu sync.RWMutex
+
+	ui   UIConfig
+	uiMu sync.RWMutex
+
+	decoding   MockDecoding
+	decodingMu sync.RWMutex
+
+	shutdownTimeout atomic.Int64
+}
+
+func NewMockServer(log *zap.Logger, port string, mockHolder MockHolder, requestLogger RequestLogger) *MockServer {
+	if requestLogger == nil {
+		requestLogger = NewInMemoryRequestLogger(DefaultRequestLogCapacity)
+	}
+
+	s := &MockServer{
+		port:          port,
+		log:           log.Named("mock_server"),
+		mockHolder:    mockHolder,
+		requestLogger: requestLogger,
+	}
+	s.shutdownTimeout.Store(int64(DefaultShutdownTimeout))
+
+	if notifier, ok := mockHolder.(MockChangeNotifier); ok {
+		s.notified = true
+		notifier.OnMockChange(s.mockChanged)
+	}
+
+	s.initHandlers()
+
+	return s
+}
+
+// ListenAndServe listens on the configured port (use "0" for a random free
+// port, see Addr) and serves the control API until ctx is done.
+func (s *MockServer) ListenAndServe(ctx context.Context) error {
+	lis, err := net.Listen("tcp", net.JoinHostPort("", s.port))
+	if err != nil {
+		return fmt.Errorf("listen http: %w", err)
+	}
+
+	return s.Serve(ctx, lis)
+}
+
+// Serve serves the control API on an already bound listener until ctx is
+// done, then waits up to the shutdown timeout (see SetShutdownTimeout) for
+// the requests in progress. Event streams end with ctx.
+func (s *MockServer) Serve(ctx context.Context, lis net.Listener) error {
+	s.addrMu.Lock()
+	s.addr = lis.Addr()
+	s.addrMu.Unlock()
+
+	// Request contexts end on shutdown so that open event streams return.
+	s.srv.BaseContext = func(net.Listener) context.Context { return ctx }
+
+	go func() {
+		err := s.srv.Serve(lis)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			panic(fmt.Errorf("HTTP serve: %v", err))
+		}
+	}()
+
+	s.log.Info("server started", zap.Stringer("addr", lis.Addr()))
+	<-ctx.Done()
+	s.log.Info("shutdown...")
+
+	ctxTimeout, cancel := context.WithTimeout(context.Background(), s.ShutdownTimeout())
+	defer cancel()
+
+	return s.srv.Shutdown(ctxTimeout)
+}
+
+// SetShutdownTimeout sets how long Serve waits on shutdown for the HTTP
+// requests in progress, such as large exports, before it fails. It can be
+// called while serving.
+func (s *MockServer) SetShutdownTimeout(timeout time.Duration) {
+	s.shutdownTimeout.Store(int64(max(timeout, 0)))
+}
+
+// ShutdownTimeout returns how long Serve waits for the HTTP requests in
+// progress on shutdown.
+func (s *MockServer) ShutdownTimeout() time.Duration {
+	return time.Duration(s.shutdownTimeout.Load())
+}
+
+// Addr returns the address the server is bound to, or nil before it
+// started listening.
+func (s *MockServer) Addr() net.Addr {
+	s.addrMu.Lock()
+	defer s.addrMu.Unlock()
+
+	return s.addr
+}
+
+// LoadMockYAML activates a YAML mock, exactly like POST /mock. Unknown
+// fields are logged, or fail the load in strict mode (see SetMockDecoding).
+func (s *MockServer) LoadMockYAML(data []byte) error {
+	_, err := s.loadMockYAML(data)
+
+	return err
+}
+
+// LoadMockJSON activates a JSON mock, exactly like POST /mock with
+// Content-Type: application/json.
+func (s *MockServer) LoadMockJSON(data []byte) error {
+	_, err := s.loadMockJSON(data)
+
+	return err
+}
+
+// loadMockYAML activates a YAML mock and returns its unknown fields.
+func (s *MockServer) loadMockYAML(data []byte) ([]string, error) {
+	mock, unknown, err := DecodeMockYAML(data)
+	if err != nil {
+		return nil, fmt.Errorf("decode mock: %w", err)
+	}
+
+	if err := s.checkUnknownFields(unknown); err != nil {
+		return nil, fmt.Errorf("decode mock: %w", err)
+	}
+
+	s.setMock(mock, string(data))
+
+	return unknown, nil
+}
+
+// loadMockJSON activates a JSON mock and returns its unknown fields.
+func (s *MockServer) loadMockJSON(data []byte) ([]string, error) {
+	mock, unknown, err := DecodeMockJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("decode mock: %w", err)
+	}
+
+	if err := s.checkUnknownFields(unknown); err != nil {
+		return nil, fmt.Errorf("decode mock: %w", err)
+	}
+
+	return unknown, s.LoadMock(mock)
+}
+
+// LoadMock activates mock, exactly like POST /mock with its YAML encoding.
+func (s *MockServer) LoadMock(mock LDAPMock) error {
+	yamlData, err := mock.YAML()
+	if err != nil {
+		return err
+	}
+
+	s.setMock(mock, string(yamlData))
+
+	return nil
+}
+
+// ImportLDIF replaces the fallback users of the current mock with the entries
+// of an LDIF file, exactly like POST /mock/ldif. Rules and tenants are kept.
+func (s *MockServer) ImportLDIF(r io.Reader) (int, error) {
+	users, err := ParseLDIF(r)
+	if err != nil {
+		return 0, err
+	}
+
+	mock := s.mockHolder.GetMock()
+	mock.Users = users
+
+	yamlData, err := mock.YAML()
+	if err != nil {
+		return 0, err
+	}
+
+	s.setMock(mock, string(yamlData))
+
+	return len(users), nil
+}
+
+// setMock sets mock, whose YAML is yamlData. Calls are made one at a time,
+// from setting the pending YAML to the change notification that takes it.
+func (s *MockServer) setMock(mock LDAPMock, yamlData string) {
+	s.setMockMu.Lock()
+	defer s.setMockMu.Unlock()
+
+	if !s.notified {
+		s.mockHolder.SetMock(mock)
+
+		s.mockMu.Lock()
+		s.lastMockYAML = yamlData
+		s.mockMu.Unlock()
+
+		return
+	}
+
+	s.mockMu.Lock()
+	s.nextMockYAML = &yamlData
+	s.mockMu.Unlock()
+
+	s.mockHolder.SetMock(mock)
+}
+
+// mockChanged keeps the YAML of the mock in step with the mock holder: the
+// YAML of the mock being set, or none once the mock changed otherwise, e.g.
+// by an LDAP write, so that it is generated from the current mock.
+func (s *MockServer) mockChanged(LDAPMock) {
+	s.mockMu.Lock()
+	defer s.mockMu.Unlock()
+
+	s.lastMockYAML = ""
+	if s.nextMockYAML != nil {
+		s.lastMockYAML = *s.nextMockYAML
+		s.nextMockYAML = nil
+	}
+}
+
+// mockYAML returns the YAML of the current mock: as it was loaded, or
+// generated when the mock changed since.
+func (s *MockServer) mockYAML() (string, error) {
+	s.mockMu.RLock()
+	yamlData := s.lastMockYAML
+	s.mockMu.RUnlock()
+
+	if yamlData != "" {
+		return yamlData, nil
+	}
+
+	data, err := s.mockHolder.GetMock().YAML()
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+func (s *MockServer) initHandlers() {
+	router := httprouter.New()
+
+	router.POST("/mock", func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		s.log.Info("mock request")
+
+		defer func() { _ = r.Body.Close() }()
+
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(fmt.Sprintf("read body: %v", err)))
+			return
+		}
+
+		load := s.loadMockYAML
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/json" {
+			load = s.loadMockJSON
+		}
+
+		unknown, err := load(data)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(err.Error()))
+			return
+		}
+
+		if len(unknown) == 0 {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		resp := struct {
+			Warnings []string `json:"warnings"`
+		}{
+			Warnings: unknown,
+		}
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			s.log.Warn("encode mock warnings", zap.Error(err))
+		}
+	})
+
+	router.POST("/clean", func(http.ResponseWriter, *http.Request, httprouter.Params) {
+		s.log.Info("clean request")
+		s.mockHolder.SetMock(LDAPMock{})
+	})
+
+	router.GET("/requests", func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		limitParam := r.URL.Query().Get("limit")
+		limit := -1
+		if limitParam != "" {
+			val, err := strconv.Atoi(limitParam)
+			if err != nil || val < 0 {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte("invalid limit"))
+				return
+			}
+			limit = val
+		}
+
+		logs := s.requestLogger.List()
+		if query := r.URL.Query().Get("query"); query != "" {
+			var err error
+			if logs, err = QueryRequestLog(logs, query); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(err.Error()))
+				return
+			}
+		}
+		if limit >= 0 && len(logs) > limit {
+			logs = logs[:limit]
+		}
+
+		if r.URL.Query().Get("format") == "ndjson" {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			enc := json.NewEncoder(w)
+			for _, entry := range logs {
+				if err := enc.Encode(entry); err != nil {
+					s.log.Warn("encode requests", zap.Error(err))
+					return
+				}
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(logs); err != nil {
+			s.log.Warn("encode requests", zap.Error(err))
+		}
+	})
+
+	router.GET("/requests/stream", s.streamRequests)
+	router.GET("/requests/wait", s.waitRequests)
+
+	router.GET("/requests/empty", func(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+		provider, ok := s.mockHolder.(EmptySearchProvider)
+		if !ok {
+			w.WriteHeader(http.StatusNotImplemented)
+			_, _ = w.Write([]byte("empty searches are not tracked"))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(provider.EmptySearches()); err != nil {
+			s.log.Warn("encode empty searches", zap.Error(err))
+		}
+	})
+
+	router.POST("/requests/clear", s.clearRequests)
+
+	router.GET("/backup", func(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+		s.log.Info("backup request")
+
+		var buf bytes.Buffer
+		if err := s.WriteBackup(&buf); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(err.Error()))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Header().Set("Content-Disposition", `attachment; filename="ldap-mock-backup.tar.gz"`)
+		_, _ = w.Write(buf.Bytes())
+	})
+
+	router.POST("/restore", func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		s.log.Info("restore request")
+
+		defer func() { _ = r.Body.Close() }()
+
+		if err := s.RestoreBackup(r.Body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(err.Error()))
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+
+	router.GET("/mock", func(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+		mock := s.mockHolder.GetMock()
+
+		yamlData, err := s.mockYAML()
+		if err != nil {
+			s.log.Warn("encode mock YAML", zap.Error(err))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		resp := struct {
+			Mock LDAPMock `json:"mock"`
+			YAML string   `json:"yaml"`
+		}{
+			Mock: mock,
+			YAML: yamlData,
+		}
+
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(resp); err != nil {
+			s.log.Warn("encode mock", zap.Error(err))
+		}
+	})
+
+	router.GET("/mock/history", func(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+		provider, ok := s.mockHolder.(MockHistoryProvider)
+		if !ok {
+			w.WriteHeader(http.StatusNotImplemented)
+			_, _ = w.Write([]byte("the mock history is not kept"))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(provider.MockHistory()); err != nil {
+			s.log.Warn("encode mock history", zap.Error(err))
+		}
+	})
+
+	router.GET("/mock/diff", s.diffMocks)
+
+	router.GET("/mock/effective", func(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+		provider, ok := s.mockHolder.(EffectiveMockProvider)
+		if !ok {
+			w.WriteHeader(http.StatusNotImplemented)
+			_, _ = w.Write([]byte("the effective mock is not available"))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(provider.EffectiveMock()); err != nil {
+			s.log.Warn("encode effective mock", zap.Error(err))
+		}
+	})
+
+	router.GET("/mock/namespaces", func(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(s.mockHolder.GetMock().Namespaces()); err != nil {
+			s.log.Warn("encode namespaces", zap.Error(err))
+		}
+	})
+
+	router.POST("/mock/namespaces/:name/enable", s.toggleNamespace(false))
+	router.POST("/mock/namespaces/:name/disable", s.toggleNamespace(true))
+
+	router.DELETE("/mock/namespaces/:name", func(w http.ResponseWriter, _ *http.Request, ps httprouter.Params) {
+		name := ps.ByName("name")
+		s.log.Info("delete namespace request", zap.String("namespace", name))
+
+		removed, err := s.DeleteNamespace(name)
+		if err != nil {
+			writeNamespaceError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]int{"removed": removed})
+	})
+
+	router.POST("/simulate", func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		defer func() { _ = r.Body.Close() }()
+
+		var body SimulationRequest
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(fmt.Sprintf("decode request: %v", err)))
+			return
+		}
+
+		req := body.searchRequest()
+		if _, err := ParseFilter(req.Filter); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(fmt.Sprintf("invalid filter: %v", err)))
+			return
+		}
+
+		sim := Simulate(s.mockHolder.GetMock(), req)
+
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(sim); err != nil {
+			s.log.Warn("encode simulation", zap.Error(err))
+		}
+	})
+
+	router.POST("/simulate/batch", func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		defer func() { _ = r.Body.Close() }()
+
+		var body struct {
+			Requests []SimulationRequest `json:"requests"`
+			// RequestLog adds the searches of the request log, oldest first.
+			RequestLog bool `json:"request_log"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(fmt.Sprintf("decode request: %v", err)))
+			return
+		}
+
+		reqs := body.Requests
+		if body.RequestLog {
+			reqs = append(reqs, loggedSearches(s.requestLogger.List())...)
+		}
+
+		batch := SimulateBatch(s.mockHolder.GetMock(), reqs)
+
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(batch); err != nil {
+			s.log.Warn("encode batch simulation", zap.Error(err))
+		}
+	})
+
+	router.POST("/replay", func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		defer func() { _ = r.Body.Close() }()
+
+		concurrency := 1
+		if param := r.URL.Query().Get("concurrency"); param != "" {
+			val, err := strconv.Atoi(param)
+			if err != nil || val < 1 {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte("invalid concurrency"))
+				return
+			}
+			concurrency = val
+		}
+
+		logs, err := ReadRequestLog(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(err.Error()))
+			return
+		}
+
+		report, err := Replay(r.Context(), s.mockHolder.GetMock(), logs, concurrency)
+		if err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte(err.Error()))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			s.log.Warn("encode replay", zap.Error(err))
+		}
+	})
+
+	router.GET("/mock/ldif", func(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+		w.Header().Set("Content-Type", "text/x-ldif; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="mock.ldif"`)
+		_, _ = w.Write(s.mockHolder.GetMock().LDIF())
+	})
+
+	router.POST("/mock/ldif", func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		s.log.Info("ldif import request")
+
+		defer func() { _ = r.Body.Close() }()
+
+		count, err := s.ImportLDIF(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(err.Error()))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]int{"imported": count})
+	})
+
+	router.POST("/import", func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		defer func() { _ = r.Body.Close() }()
+
+		var req ImportRequest
+		dec := json.NewDecoder(r.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(fmt.Sprintf("decode import: %v", err)))
+			return
+		}
+
+		s.log.Info("import request", zap.String("url", req.URL), zap.String("base_dn", req.BaseDN), zap.String("filter", req.Filter))
+
+		if err := req.validate(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(err.Error()))
+			return
+		}
+
+		users, groups, err := s.ImportDirectory(r.Context(), req)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			_, _ = w.Write([]byte(err.Error()))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]int{"users": users, "groups": groups})
+	})
+
+	router.GET("/stats", func(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+		provider, ok := s.mockHolder.(StatsProvider)
+		if !ok {
+			w.WriteHeader(http.StatusNotImplemented)
+			_, _ = w.Write([]byte("statistics are not collected"))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(provider.Stats()); err != nil {
+			s.log.Warn("encode stats", zap.Error(err))
+		}
+	})
+
+	router.GET("/metrics", func(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+		provider, ok := s.mockHolder.(StatsProvider)
+		if !ok {
+			w.WriteHeader(http.StatusNotImplemented)
+			_, _ = w.Write([]byte("statistics are not collected"))
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		if err := writeMetrics(w, provider.Stats()); err != nil {
+			s.log.Warn("write metrics", zap.Error(err))
+		}
+	})
+
+	router.GET("/mock/coverage", func(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+		provider, ok := s.mockHolder.(StatsProvider)
+		if !ok {
+			w.WriteHeader(http.StatusNotImplemented)
+			_, _ = w.Write([]byte("statistics are not collected"))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(MockCoverage(s.mockHolder.GetMock(), provider.Stats())); err != nil {
+			s.log.Warn("encode coverage", zap.Error(err))
+		}
+	})
+
+	router.GET("/mock/lint", func(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(LintMock(s.mockHolder.GetMock())); err != nil {
+			s.log.Warn("encode lint", zap.Error(err))
+		}
+	})
+
+	router.GET("/schema.json", func(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+		w.Header().Set("Content-Type", "application/schema+json")
+		_, _ = w.Write(MockSchema())
+	})
+
+	router.GET("/contracts", func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		consumer, provider := r.URL.Query().Get("consumer"), r.URL.Query().Get("provider")
+		if consumer == "" {
+			consumer = "ldap-client"
+		}
+		if provider == "" {
+			provider = "ldap-directory"
+		}
+
+		var expectations []ExpectationStatus
+		if expectationProvider, ok := s.mockHolder.(ExpectationProvider); ok {
+			expectations = expectationProvider.Expectations()
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(BuildContract(consumer, provider, expectations, s.requestLogger.List())); err != nil {
+			s.log.Warn("encode contract", zap.Error(err))
+		}
+	})
+
+	router.POST("/verify", func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		s.writeExpectations(w, r, false)
+	})
+	router.GET("/expectations/unmet", func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		s.writeExpectations(w, r, true)
+	})
+
+	router.GET("/changes", s.listChanges)
+
+	router.GET("/config", s.getConfig)
+	router.POST("/config", s.updateConfig)
+
+	router.GET("/chaos/outage", s.getOutage)
+	router.POST("/chaos/outage", s.updateOutage)
+
+	router.GET("/time", s.getTime)
+	router.POST("/time", s.updateTime)
+
+	router.GET("/version", func(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(GetBuildInfo()); err != nil {
+			s.log.Warn("encode version", zap.Error(err))
+		}
+	})
+
+	ui := http.HandlerFunc(s.serveUI)
+	router.Handler(http.MethodGet, "/ui", ui)
+	router.Handler(http.MethodGet, "/ui/*path", ui)
+
+	s.srv.Handler = s.authMiddleware(router)
+}
+
+// diffMocks compares the mock versions of the from and to query parameters;
+// to defaults to the current version.
+func (s *MockServer) diffMocks(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	provider, ok := s.mockHolder.(MockHistoryProvider)
+	if !ok {
+		w.WriteHeader(http.StatusNotImplemented)
+		_, _ = w.Write([]byte("the mock history is not kept"))
+		return
+	}
+
+	from, err := strconv.ParseUint(r.URL.Query().Get("from"), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("invalid from"))
+		return
+	}
+
+	var to uint64
+	if param := r.URL.Query().Get("to"); param != "" {
+		if to, err = strconv.ParseUint(param, 10, 64); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte("invalid to"))
+			return
+		}
+	} else if history := provider.MockHistory(); len(history) > 0 {
+		to = history[len(history)-1].Version
+	}
+
+	mocks := make([]LDAPMock, 0, 2)
+	for _, version := range []uint64{from, to} {
+		mock, ok := provider.MockAt(version)
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(fmt.Sprintf("mock version %d is not in the history", version)))
+			return
+		}
+		mocks = append(mocks, mock)
+	}
+
+	diff := DiffMocks(mocks[0], mocks[1])
+	diff.From, diff.To = from, to
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(diff); err != nil {
+		s.log.Warn("encode mock diff", zap.Error(err))
+	}
+}
+
+// clearRequests empties the request log or, when the body has criteria (see
+// RequestClearCriteria), removes the entries matching them and reports how
+// many.
+func (s *MockServer) clearRequests(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	defer func() { _ = r.Body.Close() }()
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(fmt.Sprintf("read body: %v", err)))
+		return
+	}
+
+	if len(bytes.TrimSpace(data)) == 0 {
+		s.log.Info("requests clear")
+		s.requestLogger.Clear()
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	var criteria RequestClearCriteria
+	if err := decodeStrict(data, &criteria); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(fmt.Sprintf("decode criteria: %v", err)))
+		return
+	}
+
+	remover, ok := s.requestLogger.(RequestRemover)
+	if !ok {
+		w.WriteHeader(http.StatusNotImplemented)
+		_, _ = w.Write([]byte("the request log cannot be cleared selectively"))
+		return
+	}
+
+	removed := remover.Remove(criteria.matches)
+	s.log.Info("requests clear", zap.String("type", criteria.Type), zap.Time("before", criteria.Before),
+		zap.String("matched_rule", criteria.MatchedRule), zap.Int("removed", removed))
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]int{"removed": removed})
+}
+
+// toggleNamespace handles POST /mock/namespaces/{name}/disable and /enable.
+func (s *MockServer) toggleNamespace(disabled bool) httprouter.Handle {
+	return func(w http.ResponseWriter, _ *http.Request, ps httprouter.Params) {
+		name := ps.ByName("name")
+		s.log.Info("namespace request", zap.String("namespace", name), zap.Bool("disabled", disabled))
+
+		if err := s.SetNamespaceDisabled(name, disabled); err != nil {
+			writeNamespaceError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func writeNamespaceError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errUnknownNamespace) {
+		w.WriteHeader(http.StatusNotFound)
+	} else {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	_, _ = w.Write([]byte(err.Error()))
+}
+
+// writeExpectations reports the expectations, only the unmet ones when
+// unmetOnly is set, as JSON or, with the format=junit query parameter, as a
+// JUnit XML test suite.
+func (s *MockServer) writeExpectations(w http.ResponseWriter, r *http.Request, unmetOnly bool) {
+	provider, ok := s.mockHolder.(ExpectationProvider)
+	if !ok {
+		w.WriteHeader(http.StatusNotImplemented)
+		_, _ = w.Write([]byte("expectations are not supported"))
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "junit" {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("invalid format: must be json or junit"))
+		return
+	}
+
+	expectations := provider.Expectations()
+	satisfied := true
+	for _, e := range expectations {
+		satisfied = satisfied && e.Error == ""
+	}
+	if unmetOnly {
+		expectations = slices.DeleteFunc(expectations, func(e ExpectationStatus) bool { return e.Error == "" })
+	}
+
+	if format == "junit" {
+		w.Header().Set("Content-Type", "application/xml")
+		if err := WriteJUnit(w, expectations); err != nil {
+			s.log.Warn("encode junit", zap.Error(err))
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	resp := struct {
+		Satisfied    bool                `json:"satisfied"`
+		Expectations []ExpectationStatus `json:"expectations"`
+	}{satisfied, expectations}
+	if err := enc.Encode(resp); err != nil {
+		s.log.Warn("encode expectations", zap.Error(err))
+	}
+}
+
+// listChanges returns the directory mutations after the since query
+// parameter (0 when absent) and the sequence number of the last one.
+func (s *MockServer) listChanges(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	provider, ok := s.mockHolder.(ChangelogProvider)
+	if !ok {
+		w.WriteHeader(http.StatusNotImplemented)
+		_, _ = w.Write([]byte("changes are not recorded"))
+		return
+	}
+
+	var since uint64
+	if param := r.URL.Query().Get("since"); param != "" {
+		var err error
+		if since, err = strconv.ParseUint(param, 10, 64); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(fmt.Sprintf("invalid since %q: must be a sequence number", param)))
+			return
+		}
+	}
+
+	changes, last := provider.Changes(since)
+	if changes == nil {
+		changes = []Change{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(struct {
+		Changes []Change `json:"changes"`
+		LastSeq uint64   `json:"last_seq"`
+	}{changes, last}); err != nil {
+		s.log.Warn("encode changes", zap.Error(err))
+	}
+}
+
+// streamRequestsHeartbeat keeps idle event streams open through proxies.
+const streamRequestsHeartbeat = 15 * time.Second
+
+// streamRequests sends new request log entries as server-sent events until
+// the client disconnects.
+func (s *MockServer) streamRequests(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	subscriber, ok := s.requestLogger.(RequestSubscriber)
+	if !ok {
+		w.WriteHeader(http.StatusNotImplemented)
+		_, _ = w.Write([]byte("request logger does not support streaming"))
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte("streaming unsupported"))
+		return
+	}
+
+	entries, unsubscribe := subscriber.Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(streamRequestsHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			_, _ = io.WriteString(w, ": ping\n\n")
+		case entry := <-entries:
+			data, err := json.Marshal(entry)
+			if err != nil {
+				s.log.Warn("encode request", zap.Error(err))
+				continue
+			}
+
+			_, _ = fmt.Fprintf(w, "event: request\ndata: %s\n\n", data)
+		}
+
+		flusher.Flush()
+	}
+}
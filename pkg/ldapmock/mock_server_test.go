@@ -0,0 +1,72 @@
+package ldapmock
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// slowMockHolder holds the first mock set until another is set, or for
+// 100ms.
+type slowMockHolder struct {
+	mu      sync.Mutex
+	mock    LDAPMock
+	calls   int
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (h *slowMockHolder) SetMock(mock LDAPMock) {
+	h.mu.Lock()
+	h.mock = mock
+	h.calls++
+	first := h.calls == 1
+	h.mu.Unlock()
+
+	if first {
+		close(h.entered)
+		select {
+		case <-h.release:
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+func (h *slowMockHolder) GetMock() LDAPMock {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.mock
+}
+
+func TestMockServer_ConcurrentLoads(t *testing.T) {
+	holder := &slowMockHolder{entered: make(chan struct{}), release: make(chan struct{})}
+	srv := NewMockServer(zap.NewNop(), "0", holder, nil)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := srv.LoadMockYAML([]byte("# first\nusers:\n  - cn: uid=first\n")); err != nil {
+			t.Errorf("first load: %v", err)
+		}
+	}()
+
+	<-holder.entered
+	if err := srv.LoadMockYAML([]byte("# second\nusers:\n  - cn: uid=second\n")); err != nil {
+		t.Fatalf("second load: %v", err)
+	}
+	close(holder.release)
+	<-done
+
+	// The YAML kept is that of the mock served.
+	yamlData, err := srv.mockYAML()
+	if err != nil {
+		t.Fatalf("mock YAML: %v", err)
+	}
+	if users := holder.GetMock().Users; len(users) != 1 || !strings.Contains(yamlData, users[0].CN) {
+		t.Errorf("mock YAML %q for users %+v", yamlData, users)
+	}
+}
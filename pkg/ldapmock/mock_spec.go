@@ -0,0 +1,384 @@
+package ldapmock
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+type LDAPMock struct {
+	// Users and Groups answer the searches no rule matches.
+	Users   []User   `yaml:"users,omitempty" json:"users,omitempty"`
+	Groups  []Group  `yaml:"groups,omitempty" json:"groups,omitempty"`
+	Rules   []Rule   `yaml:"rules,omitempty" json:"rules,omitempty"`
+	Tenants []Tenant `yaml:"tenants,omitempty" json:"tenants,omitempty"`
+	// Attributes declares how filters compare the values of attributes,
+	// for the users and groups of every tenant.
+	Attributes AttributeSyntaxes `yaml:"attributes,omitempty" json:"attributes,omitempty"`
+	// Computed adds attributes to the users and groups returned by searches,
+	// as text/template templates over the other attributes of the entry,
+	// e.g. displayName: "{{.givenName}} {{.sn}}". Entries declaring an
+	// attribute keep their value.
+	Computed map[string]string `yaml:"computed,omitempty" json:"computed,omitempty"`
+	// RootDSE configures the entry answering base searches of the empty DN
+	// that no rule matches; nil serves the defaults.
+	RootDSE *RootDSE `yaml:"root_dse,omitempty" json:"root_dse,omitempty"`
+	// Latency delays every search whose rule has no latency of its own.
+	Latency *Latency `yaml:"latency,omitempty" json:"latency,omitempty"`
+	// Paging returns the results of searches carrying the paged results
+	// control one page at a time; nil returns them at once.
+	Paging *Paging `yaml:"paging,omitempty" json:"paging,omitempty"`
+	// Schedule mutates the mock at set times after it is activated.
+	Schedule []ScheduledChange `yaml:"schedule,omitempty" json:"schedule,omitempty"`
+	// DisabledNamespaces lists the namespaces whose rules are ignored, as
+	// if they were not in the mock.
+	DisabledNamespaces []string `yaml:"disabled_namespaces,omitempty" json:"disabled_namespaces,omitempty"`
+	// PriorityOffset is added to the priority of the rules of the mock when
+	// MergeMocks merges it with others, e.g. the files of a mock directory.
+	PriorityOffset int `yaml:"priority_offset,omitempty" json:"priority_offset,omitempty"`
+}
+
+type Tenant struct {
+	Name   string  `yaml:"name,omitempty" json:"name,omitempty"`
+	BaseDN string  `yaml:"base_dn" json:"base_dn"`
+	Users  []User  `yaml:"users,omitempty" json:"users,omitempty"`
+	Groups []Group `yaml:"groups,omitempty" json:"groups,omitempty"`
+	Rules  []Rule  `yaml:"rules,omitempty" json:"rules,omitempty"`
+}
+
+type User struct {
+	CN    string            `yaml:"cn" json:"cn"`
+	Attrs map[string]string `yaml:"attrs,omitempty" json:"attrs,omitempty"`
+	// ExpiresIn removes the user from search results that long after the
+	// mock is set; zero never does.
+	ExpiresIn Duration `yaml:"expires_in,omitempty" json:"expires_in,omitempty"`
+}
+
+type Group struct {
+	CN      string            `yaml:"cn" json:"cn"`
+	Members []string          `yaml:"members,omitempty" json:"members,omitempty"`
+	Attrs   map[string]string `yaml:"attrs,omitempty" json:"attrs,omitempty"`
+}
+
+type Rule struct {
+	ID   string `yaml:"id,omitempty" json:"id,omitempty"`
+	Name string `yaml:"name,omitempty" json:"name,omitempty"`
+	// Namespace groups rules, e.g. the fixtures of one team, so they can be
+	// disabled or deleted together (see LDAPMock.DisabledNamespaces).
+	Namespace string `yaml:"namespace,omitempty" json:"namespace,omitempty"`
+	Filter    string `yaml:"filter" json:"filter"`
+	// FilterMatch is FilterMatchStructural (the default) or
+	// FilterMatchSemantic.
+	FilterMatch string `yaml:"filter_match,omitempty" json:"filter_match,omitempty"`
+	BaseDN      string `yaml:"base_dn,omitempty" json:"base_dn,omitempty"`
+	// BaseDNMatch is BaseDNExact (the default) or BaseDNSubtree.
+	BaseDNMatch string `yaml:"base_dn_match,omitempty" json:"base_dn_match,omitempty"`
+	Scope       string `yaml:"scope,omitempty" json:"scope,omitempty"`
+	// WhenExpr is a condition on the request, in CEL, that must also hold
+	// for the rule to match, e.g.
+	// request.filter.contains("uid=") && request.scope == "sub".
+	WhenExpr string `yaml:"when_expr,omitempty" json:"when_expr,omitempty"`
+	Priority int    `yaml:"priority,omitempty" json:"priority,omitempty"`
+	// Passthrough forwards matched searches to the upstream server instead
+	// of returning Response (see LDAPServer.SetUpstream).
+	Passthrough bool `yaml:"passthrough,omitempty" json:"passthrough,omitempty"`
+	// Delay is waited before a matched search is answered, plus a sample
+	// of Latency (or of the mock latency when the rule has none).
+	Delay   Duration `yaml:"delay,omitempty" json:"delay,omitempty"`
+	Latency *Latency `yaml:"latency,omitempty" json:"latency,omitempty"`
+	// Bandwidth limits how fast the response to a matched search is
+	// written; zero writes it at once.
+	Bandwidth ByteRate `yaml:"bandwidth,omitempty" json:"bandwidth,omitempty"`
+	// Script computes the response to matched searches instead of Response,
+	// with the engine set by LDAPServer.SetScriptEngine (JavaScript, see
+	// JSScriptEngine, in the standalone binary).
+	Script string `yaml:"script,omitempty" json:"script,omitempty"`
+	// WASM is the path of a WASM module computing the response to matched
+	// searches instead of Response, with the engine set by
+	// LDAPServer.SetWASMEngine (see WASMEngine). Script wins over it.
+	WASM string `yaml:"wasm,omitempty" json:"wasm,omitempty"`
+	// Template executes the DNs, attribute values and members of Response as
+	// text/template templates with the TemplateData of each search.
+	Template bool     `yaml:"template,omitempty" json:"template,omitempty"`
+	Response Response `yaml:"response" json:"response"`
+}
+
+// Rule.BaseDNMatch values.
+const (
+	// BaseDNExact matches searches based at the rule base DN.
+	BaseDNExact = "exact"
+	// BaseDNSubtree matches searches based at or below the rule base DN.
+	BaseDNSubtree = "subtree"
+)
+
+// Rule.FilterMatch values.
+const (
+	// FilterMatchStructural matches request filters with the shape of the
+	// rule filter: the same operators, where a rule AND may be a subset of
+	// the request AND and a rule OR matches any of its alternatives.
+	FilterMatchStructural = "structural"
+	// FilterMatchSemantic matches request filters that only select entries
+	// the rule filter selects, however they are nested.
+	FilterMatchSemantic = "semantic"
+)
+
+type Response struct {
+	Users  []User  `yaml:"users,omitempty" json:"users,omitempty"`
+	Groups []Group `yaml:"groups,omitempty" json:"groups,omitempty"`
+	// MaxEntries returns only the first entries of matched searches, users
+	// first, with sizeLimitExceeded(4) when there are more, as a server
+	// enforced size limit would whatever the client asks for. It applies to
+	// scripted and passed through responses too; zero is no limit.
+	MaxEntries int `yaml:"max_entries,omitempty" json:"max_entries,omitempty"`
+}
+
+// Clone returns a deep copy of the mock that shares no slices or maps with m.
+func (m LDAPMock) Clone() LDAPMock {
+	clone := LDAPMock{
+		Users:      cloneUsers(m.Users),
+		Groups:     cloneGroups(m.Groups),
+		Rules:      cloneRules(m.Rules),
+		Attributes: maps.Clone(m.Attributes),
+		Computed:   maps.Clone(m.Computed),
+		RootDSE:    cloneRootDSE(m.RootDSE),
+		Latency:    cloneLatency(m.Latency),
+		Paging:     clonePaging(m.Paging),
+		Schedule:   cloneSchedule(m.Schedule),
+
+		DisabledNamespaces: slices.Clone(m.DisabledNamespaces),
+		PriorityOffset:     m.PriorityOffset,
+	}
+
+	if m.Tenants != nil {
+		clone.Tenants = make([]Tenant, len(m.Tenants))
+		for i, tenant := range m.Tenants {
+			clone.Tenants[i] = Tenant{
+				Name:   tenant.Name,
+				BaseDN: tenant.BaseDN,
+				Users:  cloneUsers(tenant.Users),
+				Groups: cloneGroups(tenant.Groups),
+				Rules:  cloneRules(tenant.Rules),
+			}
+		}
+	}
+
+	return clone
+}
+
+func cloneUsers(users []User) []User {
+	if users == nil {
+		return nil
+	}
+
+	clone := make([]User, len(users))
+	for i, user := range users {
+		clone[i] = User{CN: user.CN, Attrs: maps.Clone(user.Attrs), ExpiresIn: user.ExpiresIn}
+	}
+
+	return clone
+}
+
+func cloneGroups(groups []Group) []Group {
+	if groups == nil {
+		return nil
+	}
+
+	clone := make([]Group, len(groups))
+	for i, group := range groups {
+		clone[i] = Group{CN: group.CN, Members: slices.Clone(group.Members), Attrs: maps.Clone(group.Attrs)}
+	}
+
+	return clone
+}
+
+func cloneRules(rules []Rule) []Rule {
+	if rules == nil {
+		return nil
+	}
+
+	clone := make([]Rule, len(rules))
+	for i, rule := range rules {
+		clone[i] = rule
+		clone[i].Latency = cloneLatency(rule.Latency)
+		clone[i].Response = Response{
+			Users:      cloneUsers(rule.Response.Users),
+			Groups:     cloneGroups(rule.Response.Groups),
+			MaxEntries: rule.Response.MaxEntries,
+		}
+	}
+
+	return clone
+}
+
+func cloneLatency(latency *Latency) *Latency {
+	if latency == nil {
+		return nil
+	}
+
+	clone := *latency
+
+	return &clone
+}
+
+// Duration is a time.Duration written as a Go duration string ("250ms") in
+// mocks.
+type Duration time.Duration
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d *Duration) parse(s string) error {
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: %w", s, err)
+	}
+
+	*d = Duration(v)
+
+	return nil
+}
+
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return d.String(), nil
+}
+
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+
+	return d.parse(s)
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	return d.parse(s)
+}
+
+// ByteRate is a rate in bytes per second, written in mocks as a size per
+// second ("512B/s", "1KB/s", "2MB/s"; units are powers of 1024).
+type ByteRate int64
+
+var byteRateUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"B", 1},
+}
+
+func (r ByteRate) String() string {
+	for _, unit := range byteRateUnits {
+		if r != 0 && int64(r)%unit.size == 0 {
+			return fmt.Sprintf("%d%s/s", int64(r)/unit.size, unit.suffix)
+		}
+	}
+
+	return "0B/s"
+}
+
+func (r *ByteRate) parse(s string) error {
+	value := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "/S")
+	for _, unit := range byteRateUnits {
+		number, ok := strings.CutSuffix(value, unit.suffix)
+		if !ok {
+			continue
+		}
+
+		n, err := strconv.ParseInt(strings.TrimSpace(number), 10, 64)
+		if err != nil || n < 0 {
+			break
+		}
+
+		*r = ByteRate(n * unit.size)
+
+		return nil
+	}
+
+	return fmt.Errorf("invalid byte rate %q: want a size per second such as 1KB/s", s)
+}
+
+func (r ByteRate) MarshalYAML() (interface{}, error) {
+	return r.String(), nil
+}
+
+func (r *ByteRate) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+
+	return r.parse(s)
+}
+
+func (r ByteRate) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.String())
+}
+
+func (r *ByteRate) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	return r.parse(s)
+}
+
+// ParseMockYAML decodes a mock spec in the YAML format accepted by POST /mock.
+// Unknown fields are ignored; DecodeMockYAML reports them.
+func ParseMockYAML(data []byte) (LDAPMock, error) {
+	var mock LDAPMock
+	if err := yaml.Unmarshal(data, &mock); err != nil {
+		return LDAPMock{}, fmt.Errorf("decode yaml mock: %w", err)
+	}
+
+	return mock, nil
+}
+
+// ParseMockJSON decodes a mock spec in JSON, using the same field names as
+// the YAML format.
+func ParseMockJSON(data []byte) (LDAPMock, error) {
+	var mock LDAPMock
+	if err := json.Unmarshal(data, &mock); err != nil {
+		return LDAPMock{}, fmt.Errorf("decode json mock: %w", err)
+	}
+
+	return mock, nil
+}
+
+// YAML encodes the mock spec as YAML.
+func (m LDAPMock) YAML() ([]byte, error) {
+	data, err := yaml.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("encode yaml mock: %w", err)
+	}
+
+	return data, nil
+}
+
+// JSON encodes the mock spec as JSON.
+func (m LDAPMock) JSON() ([]byte, error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("encode json mock: %w", err)
+	}
+
+	return data, nil
+}
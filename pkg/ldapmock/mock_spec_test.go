@@ -0,0 +1,195 @@
+package ldapmock
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLDAPMock_RoundTrip(t *testing.T) {
+	mock := LDAPMock{
+		Users: []User{
+			{CN: "cn=john", Attrs: map[string]string{"mail": "john@example.com"}},
+		},
+		Groups: []Group{
+			{CN: "cn=admins", Members: []string{"cn=john"}},
+		},
+		Rules: []Rule{
+			{
+				ID:        "rule-1",
+				Name:      "groups",
+				Filter:    "(objectClass=group)",
+				BaseDN:    "dc=example,dc=com",
+				Scope:     "sub",
+				Priority:  5,
+				Delay:     Duration(250 * time.Millisecond),
+				Bandwidth: ByteRate(2048),
+				Latency:   &Latency{P50: Duration(20 * time.Millisecond), P99: Duration(time.Second), Jitter: Duration(time.Millisecond)},
+				Response: Response{
+					Groups: []Group{{CN: "cn=devs", Members: []string{"cn=john"}}},
+				},
+			},
+		},
+		Tenants: []Tenant{
+			{
+				Name: "other", BaseDN: "dc=other,dc=com", Users: []User{{CN: "cn=jane"}},
+				Rules: []Rule{{Filter: "(uid=*)", Passthrough: true}},
+			},
+		},
+		Attributes: AttributeSyntaxes{"userPassword": SyntaxCaseExact, "member": SyntaxDN},
+		Latency:    &Latency{P50: Duration(5 * time.Millisecond), Sigma: 0.5},
+	}
+
+	t.Run("yaml", func(t *testing.T) {
+		data, err := mock.YAML()
+		if err != nil {
+			t.Fatalf("encode: %v", err)
+		}
+
+		got, err := ParseMockYAML(data)
+		if err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+
+		if !reflect.DeepEqual(got, mock) {
+			t.Errorf("round trip = %+v, want %+v", got, mock)
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		data, err := mock.JSON()
+		if err != nil {
+			t.Fatalf("encode: %v", err)
+		}
+
+		got, err := ParseMockJSON(data)
+		if err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+
+		if !reflect.DeepEqual(got, mock) {
+			t.Errorf("round trip = %+v, want %+v", got, mock)
+		}
+	})
+}
+
+func TestParseMockJSON_FieldNames(t *testing.T) {
+	mock, err := ParseMockJSON([]byte(`{"rules":[{"id":"r1","base_dn":"dc=com","filter":"(cn=a)","response":{"users":[{"cn":"a"}]}}]}`))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	if len(mock.Rules) != 1 || mock.Rules[0].BaseDN != "dc=com" || len(mock.Rules[0].Response.Users) != 1 {
+		t.Errorf("unexpected mock: %+v", mock)
+	}
+}
+
+func TestParseMock_Duration(t *testing.T) {
+	mock, err := ParseMockYAML([]byte("rules:\n  - filter: (uid=a)\n    delay: 1.5s\n"))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got := time.Duration(mock.Rules[0].Delay); got != 1500*time.Millisecond {
+		t.Errorf("delay = %v, want 1.5s", got)
+	}
+
+	if _, err := ParseMockYAML([]byte("rules:\n  - filter: (uid=a)\n    delay: soon\n")); err == nil {
+		t.Error("expected error for invalid yaml duration")
+	}
+	if _, err := ParseMockJSON([]byte(`{"rules":[{"filter":"(uid=a)","delay":100}]}`)); err == nil {
+		t.Error("expected error for numeric json duration")
+	}
+}
+
+func TestParseMock_ByteRate(t *testing.T) {
+	tests := []struct {
+		value string
+		want  ByteRate
+	}{
+		{"512B/s", 512},
+		{"1KB/s", 1024},
+		{"3kb/s", 3 * 1024},
+		{"2MB/s", 2 << 20},
+		{"10KB", 10 * 1024},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			mock, err := ParseMockYAML([]byte("rules:\n  - filter: (uid=a)\n    bandwidth: " + tt.value + "\n"))
+			if err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if got := mock.Rules[0].Bandwidth; got != tt.want {
+				t.Errorf("bandwidth = %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	if got := ByteRate(1536).String(); got != "1536B/s" {
+		t.Errorf("String() = %q, want 1536B/s", got)
+	}
+
+	for _, value := range []string{"fast", "-1KB/s", "1GB/s", "KB/s"} {
+		if _, err := ParseMockYAML([]byte("rules:\n  - filter: (uid=a)\n    bandwidth: " + value + "\n")); err == nil {
+			t.Errorf("expected error for bandwidth %q", value)
+		}
+	}
+}
+
+func TestParseMock_AttributeSyntax(t *testing.T) {
+	mock, err := ParseMockYAML([]byte("attributes:\n  uidNumber: Integer\n  member: dn\n"))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	want := AttributeSyntaxes{"uidNumber": SyntaxInteger, "member": SyntaxDN}
+	if !reflect.DeepEqual(mock.Attributes, want) {
+		t.Errorf("attributes = %v, want %v", mock.Attributes, want)
+	}
+
+	if _, err := ParseMockYAML([]byte("attributes:\n  uidNumber: number\n")); err == nil {
+		t.Error("expected error for unknown yaml syntax")
+	}
+	if _, err := ParseMockJSON([]byte(`{"attributes":{"uidNumber":"number"}}`)); err == nil {
+		t.Error("expected error for unknown json syntax")
+	}
+}
+
+func TestLDAPMock_Clone(t *testing.T) {
+	mock := LDAPMock{
+		Users:  []User{{CN: "cn=john", Attrs: map[string]string{"mail": "john@example.com"}}},
+		Groups: []Group{{CN: "cn=admins", Members: []string{"cn=john"}}},
+		Rules: []Rule{{
+			Filter:   "(uid=john)",
+			Response: Response{Users: []User{{CN: "cn=john", Attrs: map[string]string{"uid": "john"}}}},
+		}},
+		Tenants:    []Tenant{{BaseDN: "dc=other", Users: []User{{CN: "cn=jane", Attrs: map[string]string{"uid": "jane"}}}}},
+		Attributes: AttributeSyntaxes{"uid": SyntaxCaseExact},
+		Latency:    &Latency{P50: Duration(time.Millisecond)},
+		Schedule: []ScheduledChange{{
+			After:    Duration(time.Second),
+			AddUsers: []User{{CN: "cn=joe", Attrs: map[string]string{"uid": "joe"}}},
+			Chaos:    &ChaosConfig{BindFailureRatio: 0.5},
+		}},
+	}
+
+	clone := mock.Clone()
+	if !reflect.DeepEqual(clone, mock) {
+		t.Fatalf("clone = %+v, want %+v", clone, mock)
+	}
+
+	clone.Users[0].Attrs["mail"] = "changed"
+	clone.Groups[0].Members[0] = "changed"
+	clone.Rules[0].Response.Users[0].Attrs["uid"] = "changed"
+	clone.Tenants[0].Users[0].Attrs["uid"] = "changed"
+	clone.Attributes["uid"] = SyntaxInteger
+	clone.Latency.P50 = 0
+	clone.Schedule[0].AddUsers[0].Attrs["uid"] = "changed"
+	clone.Schedule[0].Chaos.BindFailureRatio = 1
+
+	if mock.Users[0].Attrs["mail"] != "john@example.com" || mock.Groups[0].Members[0] != "cn=john" ||
+		mock.Rules[0].Response.Users[0].Attrs["uid"] != "john" || mock.Tenants[0].Users[0].Attrs["uid"] != "jane" ||
+		mock.Attributes["uid"] != SyntaxCaseExact || mock.Latency.P50 != Duration(time.Millisecond) ||
+		mock.Schedule[0].AddUsers[0].Attrs["uid"] != "joe" || mock.Schedule[0].Chaos.BindFailureRatio != 0.5 {
+		t.Errorf("modifying the clone changed the mock: %+v", mock)
+	}
+}
@@ -0,0 +1,261 @@
+package ldapmock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"go.uber.org/zap"
+)
+
+// ModifyIncrementFeature is the OID of the Modify-Increment extension
+// (RFC 4525), advertised in the supportedFeatures of the root DSE.
+const ModifyIncrementFeature = "1.3.6.1.1.14"
+
+// Modification.Op values, in the order of their codes on the wire.
+const (
+	ModifyAdd     = "add"
+	ModifyDelete  = "delete"
+	ModifyReplace = "replace"
+	// ModifyIncrement adds its single value to an integer attribute
+	// (RFC 4525).
+	ModifyIncrement = "increment"
+)
+
+var modifyOps = []string{ModifyAdd, ModifyDelete, ModifyReplace, ModifyIncrement}
+
+// Modification is one change of a modify request.
+type Modification struct {
+	Op     string
+	Attr   string
+	Values []string
+}
+
+// ModifyRequest applies Changes, in order, to the entry DN.
+type ModifyRequest struct {
+	DN      string
+	Changes []Modification
+}
+
+// ModifyEntry applies req to the current mock, exactly like an LDAP Modify
+// request: the changes apply to the user or group of that DN, in the tenant
+// whose base DN contains it or at the top level, all or none of them. Mock
+// attributes are single-valued, so adding a value to an attribute that has
+// one fails with attributeOrValueExists(20), and only the first value of a
+// replace is kept; member and uniqueMember change the members of groups.
+// Increments fail with constraintViolation(19) on attributes that are not
+// integers. It fails with noSuchObject(32) when there is no such entry and
+// with noSuchAttribute(16) when deleting or incrementing a missing attribute.
+//
+// Like AddEntry, statistics are kept and the schedule goes on; the change
+// gets a new mock version and is recorded in the changelog.
+func (s *LDAPServer) ModifyEntry(req ModifyRequest) error {
+	dn, err := parseEntryDN(req.DN)
+	if err != nil {
+		return err
+	}
+
+	s.setMockMu.Lock()
+	defer s.setMockMu.Unlock()
+
+	snapshot := s.mock.Load()
+	mock := snapshot.mock.Clone()
+
+	users, groups := mock.Users, mock.Groups
+	if i := mock.tenantIndex(req.DN); i >= 0 {
+		users, groups = mock.Tenants[i].Users, mock.Tenants[i].Groups
+	}
+
+	var (
+		attrs   *map[string]string
+		members *[]string
+	)
+	if i := slices.IndexFunc(users, func(user User) bool { return sameDN(user.CN, dn) }); i >= 0 {
+		attrs = &users[i].Attrs
+	} else if i := slices.IndexFunc(groups, func(group Group) bool { return sameDN(group.CN, dn) }); i >= 0 {
+		attrs, members = &groups[i].Attrs, &groups[i].Members
+	} else {
+		return ldap.NewError(ldap.LDAPResultNoSuchObject, fmt.Errorf("no such entry %s", req.DN))
+	}
+
+	if *attrs == nil {
+		*attrs = make(map[string]string, len(req.Changes))
+	}
+
+	syntaxes := mock.Attributes.lower()
+	for _, change := range req.Changes {
+		if members != nil && slices.Contains(memberAttributes, strings.ToLower(change.Attr)) {
+			err = modifyMembers(members, change)
+		} else {
+			err = modifyAttribute(*attrs, change, syntaxes)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	s.swapMock(mock, snapshot.activated)
+
+	return nil
+}
+
+// modifyAttribute applies change to the single-valued attributes attrs.
+// syntaxes must be lowered.
+func modifyAttribute(attrs map[string]string, change Modification, syntaxes AttributeSyntaxes) error {
+	name := change.Attr
+	for key := range attrs {
+		if strings.EqualFold(key, change.Attr) {
+			name = key
+			break
+		}
+	}
+
+	attr := strings.ToLower(change.Attr)
+	current, present := attrs[name]
+
+	switch change.Op {
+	case ModifyAdd:
+		if len(change.Values) == 0 {
+			return nil
+		}
+		if present {
+			return ldap.NewError(ldap.LDAPResultAttributeOrValueExists,
+				fmt.Errorf("attribute %s has a value and mock attributes are single-valued", change.Attr))
+		}
+
+		attrs[name] = change.Values[0]
+	case ModifyDelete:
+		if !present || len(change.Values) > 0 && !slices.ContainsFunc(change.Values, func(value string) bool {
+			return syntaxes.equal(attr, current, value)
+		}) {
+			return ldap.NewError(ldap.LDAPResultNoSuchAttribute, fmt.Errorf("no such attribute or value %s", change.Attr))
+		}
+
+		delete(attrs, name)
+	case ModifyReplace:
+		delete(attrs, name)
+		if len(change.Values) > 0 {
+			attrs[name] = change.Values[0]
+		}
+	case ModifyIncrement:
+		if !present {
+			return ldap.NewError(ldap.LDAPResultNoSuchAttribute, fmt.Errorf("no such attribute %s", change.Attr))
+		}
+
+		value, err := increment(attr, current, change.Values, syntaxes)
+		if err != nil {
+			return err
+		}
+
+		attrs[name] = value
+	default:
+		return ldap.NewError(ldap.LDAPResultProtocolError, fmt.Errorf("unknown modification %q", change.Op))
+	}
+
+	return nil
+}
+
+// increment returns current, the value of attr, plus the single value of
+// an increment modification. syntaxes must be lowered.
+func increment(attr, current string, values []string, syntaxes AttributeSyntaxes) (string, error) {
+	if syntax, ok := syntaxes[attr]; ok && syntax != SyntaxInteger {
+		return "", ldap.NewError(ldap.LDAPResultConstraintViolation, fmt.Errorf("attribute %s is not an integer", attr))
+	}
+	if len(values) != 1 {
+		return "", ldap.NewError(ldap.LDAPResultProtocolError, errors.New("increment needs exactly one value"))
+	}
+
+	delta, err := strconv.ParseInt(strings.TrimSpace(values[0]), 10, 64)
+	if err != nil {
+		return "", ldap.NewError(ldap.LDAPResultInvalidAttributeSyntax, fmt.Errorf("increment %q is not an integer", values[0]))
+	}
+
+	n, err := strconv.ParseInt(strings.TrimSpace(current), 10, 64)
+	if err != nil {
+		return "", ldap.NewError(ldap.LDAPResultConstraintViolation, fmt.Errorf("value of %s is not an integer", attr))
+	}
+
+	sum := n + delta
+	if (delta > 0 && sum < n) || (delta < 0 && sum > n) {
+		return "", ldap.NewError(ldap.LDAPResultConstraintViolation, fmt.Errorf("increment of %s overflows", attr))
+	}
+
+	return strconv.FormatInt(sum, 10), nil
+}
+
+// modifyMembers applies change, of the member or uniqueMember attribute,
+// to the members of a group.
+func modifyMembers(members *[]string, change Modification) error {
+	isMember := func(dn string) bool {
+		return slices.ContainsFunc(*members, func(member string) bool { return dnMatch(member, dn) })
+	}
+
+	switch change.Op {
+	case ModifyAdd:
+		for _, dn := range change.Values {
+			if isMember(dn) {
+				return ldap.NewError(ldap.LDAPResultAttributeOrValueExists, fmt.Errorf("%s is already a member", dn))
+			}
+
+			*members = append(*members, dn)
+		}
+	case ModifyDelete:
+		if len(*members) == 0 {
+			return ldap.NewError(ldap.LDAPResultNoSuchAttribute, fmt.Errorf("no such attribute %s", change.Attr))
+		}
+		if len(change.Values) == 0 {
+			*members = nil
+			return nil
+		}
+
+		for _, dn := range change.Values {
+			if !isMember(dn) {
+				return ldap.NewError(ldap.LDAPResultNoSuchAttribute, fmt.Errorf("%s is not a member", dn))
+			}
+
+			*members = slices.DeleteFunc(*members, func(member string) bool { return dnMatch(member, dn) })
+		}
+	case ModifyReplace:
+		*members = slices.Clone(change.Values)
+	case ModifyIncrement:
+		return ldap.NewError(ldap.LDAPResultConstraintViolation, fmt.Errorf("attribute %s is not an integer", change.Attr))
+	default:
+		return ldap.NewError(ldap.LDAPResultProtocolError, fmt.Errorf("unknown modification %q", change.Op))
+	}
+
+	return nil
+}
+
+// serveModify handles modify requests, changing the entry in the mock (see
+// ModifyEntry). Read-only mode refuses them before they get here.
+func (s *LDAPServer) serveModify(ctx context.Context, p *ber.Packet, w responseWriter) bool {
+	msgID, req, err := parseModifyRequest(p)
+	if errors.Is(err, errNotThisOperation) {
+		return false
+	}
+
+	if err != nil {
+		err = ldap.NewError(ldap.LDAPResultProtocolError, err)
+	} else {
+		err = s.ModifyEntry(req)
+	}
+
+	if err != nil {
+		s.logger(ctx).Info("modify failed", zap.String("dn", req.DN), zap.Error(err))
+	} else {
+		s.logger(ctx).Info("entry modified", zap.String("dn", req.DN), zap.Int("changes", len(req.Changes)))
+	}
+
+	requestLog := s.newRequestLog(ctx, "modify", err)
+	requestLog.BaseDN = req.DN
+	s.logRequest(requestLog)
+
+	_ = w(newResultPacket(msgID, ldap.ApplicationModifyResponse, err), 0)
+
+	return true
+}
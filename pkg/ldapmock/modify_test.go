@@ -0,0 +1,105 @@
+package ldapmock
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+	"go.uber.org/zap"
+)
+
+func TestLDAPServer_ModifyEntry(t *testing.T) {
+	srv := NewLDAPServer(zap.NewNop(), "0", "", "", nil)
+	srv.SetMock(LDAPMock{
+		Users: []User{{CN: "cn=uidNext,dc=example", Attrs: map[string]string{"uidNumber": "1000", "cn": "uidNext"}}},
+		Groups: []Group{{
+			CN:      "cn=admins,dc=example",
+			Members: []string{"uid=john,dc=example"},
+		}},
+		Attributes: AttributeSyntaxes{"cn": SyntaxCaseIgnore},
+		Tenants: []Tenant{{
+			BaseDN: "dc=acme",
+			Users:  []User{{CN: "uid=joe,dc=acme", Attrs: map[string]string{"uid": "joe"}}},
+		}},
+	})
+
+	requests := []ModifyRequest{
+		{DN: "CN=UIDNext, DC=Example", Changes: []Modification{
+			{Op: ModifyIncrement, Attr: "UIDNUMBER", Values: []string{"5"}},
+			{Op: ModifyIncrement, Attr: "uidNumber", Values: []string{"-2"}},
+			{Op: ModifyAdd, Attr: "description", Values: []string{"counter"}},
+		}},
+		{DN: "cn=admins,dc=example", Changes: []Modification{
+			{Op: ModifyAdd, Attr: "member", Values: []string{"uid=jane,dc=example"}},
+			{Op: ModifyDelete, Attr: "member", Values: []string{"UID=John, DC=Example"}},
+		}},
+		{DN: "uid=joe,dc=acme", Changes: []Modification{
+			{Op: ModifyReplace, Attr: "uid", Values: []string{"joseph"}},
+			{Op: ModifyReplace, Attr: "mail"},
+		}},
+	}
+	for _, req := range requests {
+		if err := srv.ModifyEntry(req); err != nil {
+			t.Fatalf("modify %s: %v", req.DN, err)
+		}
+	}
+
+	mock := srv.GetMock()
+	if attrs := mock.Users[0].Attrs; attrs["uidNumber"] != "1003" || attrs["description"] != "counter" {
+		t.Errorf("counter attributes = %v, want uidNumber 1003 and a description", attrs)
+	}
+	if members := mock.Groups[0].Members; len(members) != 1 || members[0] != "uid=jane,dc=example" {
+		t.Errorf("members = %v, want jane", members)
+	}
+	if attrs := mock.Tenants[0].Users[0].Attrs; len(attrs) != 1 || attrs["uid"] != "joseph" {
+		t.Errorf("tenant user attributes = %v, want uid joseph", attrs)
+	}
+	if changes, _ := srv.Changes(3); len(changes) != 3 || changes[0].Type != ChangeModify {
+		t.Errorf("changes = %+v, want the 3 modifies", changes)
+	}
+
+	tests := []struct {
+		name string
+		req  ModifyRequest
+		code uint16
+	}{
+		{"no entry", ModifyRequest{DN: "uid=jane,dc=example"}, ldap.LDAPResultNoSuchObject},
+		{"invalid DN", ModifyRequest{}, ldap.LDAPResultInvalidDNSyntax},
+		{"increment missing", ModifyRequest{DN: "cn=uidNext,dc=example", Changes: []Modification{
+			{Op: ModifyIncrement, Attr: "gidNumber", Values: []string{"1"}},
+		}}, ldap.LDAPResultNoSuchAttribute},
+		{"increment string", ModifyRequest{DN: "cn=uidNext,dc=example", Changes: []Modification{
+			{Op: ModifyIncrement, Attr: "description", Values: []string{"1"}},
+		}}, ldap.LDAPResultConstraintViolation},
+		{"increment declared syntax", ModifyRequest{DN: "cn=uidNext,dc=example", Changes: []Modification{
+			{Op: ModifyIncrement, Attr: "cn", Values: []string{"1"}},
+		}}, ldap.LDAPResultConstraintViolation},
+		{"increment by string", ModifyRequest{DN: "cn=uidNext,dc=example", Changes: []Modification{
+			{Op: ModifyIncrement, Attr: "uidNumber", Values: []string{"one"}},
+		}}, ldap.LDAPResultInvalidAttributeSyntax},
+		{"increment members", ModifyRequest{DN: "cn=admins,dc=example", Changes: []Modification{
+			{Op: ModifyIncrement, Attr: "member", Values: []string{"1"}},
+		}}, ldap.LDAPResultConstraintViolation},
+		{"add existing", ModifyRequest{DN: "cn=uidNext,dc=example", Changes: []Modification{
+			{Op: ModifyIncrement, Attr: "uidNumber", Values: []string{"1"}},
+			{Op: ModifyAdd, Attr: "cn", Values: []string{"other"}},
+		}}, ldap.LDAPResultAttributeOrValueExists},
+		{"delete value", ModifyRequest{DN: "cn=uidNext,dc=example", Changes: []Modification{
+			{Op: ModifyDelete, Attr: "description", Values: []string{"other"}},
+		}}, ldap.LDAPResultNoSuchAttribute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ldapErr *ldap.Error
+			if err := srv.ModifyEntry(tt.req); !errors.As(err, &ldapErr) || ldapErr.ResultCode != tt.code {
+				t.Errorf("modify err = %v, want result code %d", err, tt.code)
+			}
+		})
+	}
+
+	// Failed modifies change nothing, not even the changes before the failing one.
+	if value := srv.GetMock().Users[0].Attrs["uidNumber"]; value != "1003" {
+		t.Errorf("uidNumber after failed modifies = %s, want 1003", value)
+	}
+}
@@ -0,0 +1,214 @@
+package ldapmock
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+var errUnknownNamespace = errors.New("unknown namespace")
+
+// Namespace is a set of rules sharing Rule.Namespace, as listed by
+// GET /mock/namespaces.
+type Namespace struct {
+	Name string `json:"name"`
+	// Rules counts the rules of the namespace in every directory, scheduled
+	// ones included.
+	Rules    int  `json:"rules"`
+	Disabled bool `json:"disabled"`
+}
+
+// Namespaces lists the namespaces of the rules of the mock, and those
+// disabled, by name.
+func (m LDAPMock) Namespaces() []Namespace {
+	counts := make(map[string]int)
+	count := func(rules []Rule) {
+		for _, rule := range rules {
+			if rule.Namespace != "" {
+				counts[rule.Namespace]++
+			}
+		}
+	}
+
+	count(m.Rules)
+	for _, tenant := range m.Tenants {
+		count(tenant.Rules)
+	}
+	for _, change := range m.Schedule {
+		count(change.AddRules)
+	}
+
+	for _, name := range m.DisabledNamespaces {
+		if _, ok := counts[name]; !ok {
+			counts[name] = 0
+		}
+	}
+
+	namespaces := make([]Namespace, 0, len(counts))
+	for name, rules := range counts {
+		namespaces = append(namespaces, Namespace{
+			Name:     name,
+			Rules:    rules,
+			Disabled: slices.Contains(m.DisabledNamespaces, name),
+		})
+	}
+
+	slices.SortFunc(namespaces, func(a, b Namespace) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return namespaces
+}
+
+// hasNamespace reports whether name is listed by Namespaces.
+func (m LDAPMock) hasNamespace(name string) bool {
+	return slices.ContainsFunc(m.Namespaces(), func(namespace Namespace) bool {
+		return namespace.Name == name
+	})
+}
+
+// activeRules returns rules without those of the disabled namespaces.
+func (m LDAPMock) activeRules(rules []Rule) []Rule {
+	if len(m.DisabledNamespaces) == 0 {
+		return rules
+	}
+
+	return slices.DeleteFunc(slices.Clone(rules), func(rule Rule) bool {
+		return rule.Namespace != "" && slices.Contains(m.DisabledNamespaces, rule.Namespace)
+	})
+}
+
+// NamespaceEditor is implemented by mock holders that can change the
+// namespaces of their current mock in place, as used by
+// /mock/namespaces/{name}.
+type NamespaceEditor interface {
+	SetNamespaceDisabled(name string, disabled bool) error
+	DeleteNamespace(name string) (int, error)
+}
+
+// setNamespaceDisabled disables the rules of a namespace, or enables them
+// back.
+func (m *LDAPMock) setNamespaceDisabled(name string, disabled bool) error {
+	if !m.hasNamespace(name) {
+		return fmt.Errorf("%w %q", errUnknownNamespace, name)
+	}
+
+	m.DisabledNamespaces = slices.DeleteFunc(m.DisabledNamespaces, func(n string) bool { return n == name })
+	if disabled {
+		m.DisabledNamespaces = append(m.DisabledNamespaces, name)
+	}
+
+	return nil
+}
+
+// deleteNamespace removes the rules of a namespace from every directory and
+// from the schedule, and returns how many were removed.
+func (m *LDAPMock) deleteNamespace(name string) (int, error) {
+	if !m.hasNamespace(name) {
+		return 0, fmt.Errorf("%w %q", errUnknownNamespace, name)
+	}
+
+	removed := 0
+	remove := func(rules []Rule) []Rule {
+		n := len(rules)
+		rules = removeNamespaceRules(rules, name)
+		removed += n - len(rules)
+
+		return rules
+	}
+
+	m.Rules = remove(m.Rules)
+	for i := range m.Tenants {
+		m.Tenants[i].Rules = remove(m.Tenants[i].Rules)
+	}
+	for i := range m.Schedule {
+		m.Schedule[i].AddRules = remove(m.Schedule[i].AddRules)
+	}
+	m.DisabledNamespaces = slices.DeleteFunc(m.DisabledNamespaces, func(n string) bool { return n == name })
+
+	return removed, nil
+}
+
+func removeNamespaceRules(rules []Rule, name string) []Rule {
+	return slices.DeleteFunc(rules, func(rule Rule) bool { return rule.Namespace == name })
+}
+
+// SetNamespaceDisabled disables the rules of a namespace, or enables them
+// back. Nothing else changes: the schedule goes on, user TTLs still count
+// from when the mock was set and the statistics are kept.
+func (s *LDAPServer) SetNamespaceDisabled(name string, disabled bool) error {
+	s.setMockMu.Lock()
+	defer s.setMockMu.Unlock()
+
+	snapshot := s.mock.Load()
+	mock := snapshot.mock.Clone()
+	if err := mock.setNamespaceDisabled(name, disabled); err != nil {
+		return err
+	}
+
+	s.swapMock(mock, snapshot.activated)
+
+	return nil
+}
+
+// DeleteNamespace removes the rules of a namespace from every directory and
+// from the schedule, the steps still to come included, and returns how many
+// were removed. Like SetNamespaceDisabled, nothing else changes.
+func (s *LDAPServer) DeleteNamespace(name string) (int, error) {
+	s.setMockMu.Lock()
+	defer s.setMockMu.Unlock()
+
+	snapshot := s.mock.Load()
+	mock := snapshot.mock.Clone()
+	removed, err := mock.deleteNamespace(name)
+	if err != nil {
+		return 0, err
+	}
+
+	// The steps share their rules with the mocks kept in the history.
+	for i := range s.scheduleSteps {
+		step := &s.scheduleSteps[i]
+		step.change.AddRules = removeNamespaceRules(slices.Clone(step.change.AddRules), name)
+	}
+
+	s.swapMock(mock, snapshot.activated)
+
+	return removed, nil
+}
+
+// SetNamespaceDisabled disables the rules of a namespace, or enables them
+// back, exactly like POST /mock/namespaces/{name}/disable and /enable.
+func (s *MockServer) SetNamespaceDisabled(name string, disabled bool) error {
+	if editor, ok := s.mockHolder.(NamespaceEditor); ok {
+		return editor.SetNamespaceDisabled(name, disabled)
+	}
+
+	mock := s.mockHolder.GetMock()
+	if err := mock.setNamespaceDisabled(name, disabled); err != nil {
+		return err
+	}
+
+	return s.LoadMock(mock)
+}
+
+// DeleteNamespace removes the rules of a namespace from every directory and
+// from the schedule, exactly like DELETE /mock/namespaces/{name}, and returns
+// how many were removed.
+func (s *MockServer) DeleteNamespace(name string) (int, error) {
+	if editor, ok := s.mockHolder.(NamespaceEditor); ok {
+		return editor.DeleteNamespace(name)
+	}
+
+	mock := s.mockHolder.GetMock()
+	removed, err := mock.deleteNamespace(name)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := s.LoadMock(mock); err != nil {
+		return 0, err
+	}
+
+	return removed, nil
+}
@@ -0,0 +1,162 @@
+package ldapmock
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestLDAPMock_Namespaces(t *testing.T) {
+	mock := LDAPMock{
+		Rules: []Rule{
+			{Namespace: "billing", Filter: "(uid=a)"},
+			{Filter: "(uid=b)"},
+		},
+		Tenants:            []Tenant{{BaseDN: "dc=acme", Rules: []Rule{{Namespace: "auth", Filter: "(uid=c)"}}}},
+		Schedule:           []ScheduledChange{{AddRules: []Rule{{Namespace: "billing", Filter: "(uid=d)"}}}},
+		DisabledNamespaces: []string{"auth", "legacy"},
+	}
+
+	want := []Namespace{
+		{Name: "auth", Rules: 1, Disabled: true},
+		{Name: "billing", Rules: 2},
+		{Name: "legacy", Disabled: true},
+	}
+	if got := mock.Namespaces(); !reflect.DeepEqual(got, want) {
+		t.Errorf("namespaces = %+v, want %+v", got, want)
+	}
+
+	if rules := mock.activeRules(mock.Tenants[0].Rules); len(rules) != 0 {
+		t.Errorf("active tenant rules = %+v, want none", rules)
+	}
+	if rules := mock.activeRules(mock.Rules); len(rules) != 2 {
+		t.Errorf("active rules = %+v, want both", rules)
+	}
+}
+
+func TestMockServer_Namespaces(t *testing.T) {
+	ldapSrv := NewLDAPServer(zap.NewNop(), "0", "", "", nil)
+	srv := NewMockServer(zap.NewNop(), "0", ldapSrv, nil)
+
+	if err := srv.LoadMock(LDAPMock{Rules: []Rule{
+		{Namespace: "team-a", Filter: "(uid=a)", Response: Response{Users: []User{{CN: "uid=a"}}}},
+		{Namespace: "team-b", Filter: "(uid=b)"},
+		{Namespace: "team-a", Filter: "(uid=c)"},
+	}}); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	search := func() *Rule {
+		result, err := ldapSrv.OnSearch(t.Context(), SearchRequest{Filter: "(uid=a)", Scope: ScopeSub})
+		if err != nil {
+			t.Fatalf("search: %v", err)
+		}
+		return result.MatchedRule
+	}
+
+	if err := srv.SetNamespaceDisabled("team-a", true); err != nil {
+		t.Fatalf("disable: %v", err)
+	}
+	if rule := search(); rule != nil {
+		t.Errorf("rule of a disabled namespace matched: %+v", rule)
+	}
+
+	if err := srv.SetNamespaceDisabled("team-a", false); err != nil {
+		t.Fatalf("enable: %v", err)
+	}
+	if rule := search(); rule == nil || rule.Namespace != "team-a" {
+		t.Errorf("matched rule = %+v, want the team-a rule", rule)
+	}
+
+	removed, err := srv.DeleteNamespace("team-a")
+	if err != nil || removed != 2 {
+		t.Fatalf("delete: removed %d, %v", removed, err)
+	}
+	if rules := ldapSrv.GetMock().Rules; len(rules) != 1 || rules[0].Namespace != "team-b" {
+		t.Errorf("rules after delete = %+v", rules)
+	}
+
+	if err := srv.SetNamespaceDisabled("team-a", true); !errors.Is(err, errUnknownNamespace) {
+		t.Errorf("disable a deleted namespace: %v, want unknown namespace", err)
+	}
+}
+
+func TestLDAPServer_NamespacesKeepSchedule(t *testing.T) {
+	srv := NewLDAPServer(zap.NewNop(), "0", "", "", nil)
+
+	freeze := true
+	if err := srv.SetClock(time.Now(), &freeze, 0); err != nil {
+		t.Fatalf("freeze clock: %v", err)
+	}
+
+	srv.SetMock(LDAPMock{
+		Users: []User{
+			{CN: "uid=john,dc=example", Attrs: map[string]string{"uid": "john"}},
+			{CN: "uid=temp,dc=example", Attrs: map[string]string{"uid": "temp"}, ExpiresIn: Duration(time.Minute)},
+		},
+		Rules: []Rule{{Namespace: "team-a", Filter: "(uid=a)"}},
+		Schedule: []ScheduledChange{
+			{After: Duration(time.Minute), AddRules: []Rule{{Namespace: "team-b", Filter: "(uid=b)"}}},
+			{After: Duration(time.Hour), AddRules: []Rule{
+				{Namespace: "team-a", Filter: "(uid=c)"},
+				{Namespace: "team-b", Filter: "(uid=d)"},
+			}},
+		},
+	})
+
+	if err := srv.SetClock(time.Time{}, nil, 2*time.Minute); err != nil {
+		t.Fatalf("advance clock: %v", err)
+	}
+
+	users := func() int {
+		t.Helper()
+
+		result, err := srv.OnSearch(t.Context(), SearchRequest{Filter: "(uid=*)", Scope: ScopeSub})
+		if err != nil {
+			t.Fatalf("search: %v", err)
+		}
+
+		return len(result.Users)
+	}
+
+	if got := len(srv.GetMock().Rules); got != 2 {
+		t.Fatalf("rules after the first step = %d, want 2", got)
+	}
+	if got := users(); got != 1 {
+		t.Fatalf("users after the TTL = %d, want 1", got)
+	}
+
+	if err := srv.SetNamespaceDisabled("team-a", true); err != nil {
+		t.Fatalf("disable: %v", err)
+	}
+	if got := len(srv.GetMock().Rules); got != 2 {
+		t.Errorf("rules after disable = %d, want 2: the applied step ran again", got)
+	}
+	if got := users(); got != 1 {
+		t.Errorf("users after disable = %d, want 1: the expired user came back", got)
+	}
+
+	removed, err := srv.DeleteNamespace("team-a")
+	if err != nil || removed != 2 {
+		t.Fatalf("delete: removed %d, %v", removed, err)
+	}
+	if got := users(); got != 1 {
+		t.Errorf("users after delete = %d, want 1", got)
+	}
+
+	// The next step still comes, without the deleted rules.
+	if err := srv.SetClock(time.Time{}, nil, time.Hour); err != nil {
+		t.Fatalf("advance clock: %v", err)
+	}
+
+	var filters []string
+	for _, rule := range srv.GetMock().Rules {
+		filters = append(filters, rule.Filter)
+	}
+	if want := []string{"(uid=b)", "(uid=d)"}; !reflect.DeepEqual(filters, want) {
+		t.Errorf("rules after the last step = %v, want %v", filters, want)
+	}
+}
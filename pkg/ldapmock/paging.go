@@ -0,0 +1,119 @@
+package ldapmock
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// Paging makes the server answer searches carrying the paged results control
+// (RFC 2696) one page at a time, instead of returning every entry at once.
+type Paging struct {
+	// PageDelay is waited once more for each page after the first: the
+	// second page waits PageDelay, the third twice as long, and so on, as
+	// paged searches slow down on large Active Directory domains.
+	PageDelay Duration `yaml:"page_delay,omitempty" json:"page_delay,omitempty"`
+}
+
+func clonePaging(p *Paging) *Paging {
+	if p == nil {
+		return nil
+	}
+
+	clone := *p
+
+	return &clone
+}
+
+// pagingRequest returns the paged results control of req.
+func pagingRequest(req SearchRequest) (PagingValue, bool) {
+	for _, control := range req.Controls {
+		if value, ok := control.Value.(PagingValue); ok && control.OID == ldap.ControlTypePaging {
+			return value, true
+		}
+	}
+
+	return PagingValue{}, false
+}
+
+// pagingCursor is where a paged search resumes, as encoded in the cookies
+// the server returns.
+type pagingCursor struct {
+	page   int
+	offset int
+}
+
+func (c pagingCursor) cookie() []byte {
+	return fmt.Appendf(nil, "%d:%d", c.page, c.offset)
+}
+
+func parsePagingCookie(cookie []byte) (pagingCursor, error) {
+	var cursor pagingCursor
+	if len(cookie) == 0 {
+		return cursor, nil
+	}
+
+	if _, err := fmt.Sscanf(string(cookie), "%d:%d", &cursor.page, &cursor.offset); err != nil ||
+		cursor.page < 0 || cursor.offset < 0 {
+		return pagingCursor{}, fmt.Errorf("invalid paged results cookie %q", cookie)
+	}
+
+	return cursor, nil
+}
+
+// pagingResponse returns the paged results control of a response: the total
+// number of entries and the cookie of the next page, empty after the last.
+func pagingResponse(total int, cookie []byte) *ldap.ControlPaging {
+	control := ldap.NewControlPaging(uint32(total))
+	control.SetCookie(cookie)
+
+	return control
+}
+
+// pagingMiddleware returns one page of the result of searches carrying the
+// paged results control when the mock simulates paging. Every page is a new
+// search: the cookie holds the offset of the next page, so pages follow the
+// current mock.
+func (s *LDAPServer) pagingMiddleware(next SearchFunc) SearchFunc {
+	return func(ctx context.Context, req SearchRequest) (SearchResult, error) {
+		mock, _, _ := s.currentMock(ctx)
+		paging, ok := pagingRequest(req)
+		if mock.Paging == nil || !ok {
+			return next(ctx, req)
+		}
+
+		cursor, err := parsePagingCookie(paging.Cookie)
+		if err != nil {
+			return SearchResult{}, ldap.NewError(ldap.LDAPResultUnwillingToPerform, err)
+		}
+
+		// A size of zero abandons the paged search.
+		if paging.Size <= 0 {
+			return SearchResult{controls: []*ber.Packet{pagingResponse(0, nil).Encode()}}, nil
+		}
+
+		if err := sleep(ctx, time.Duration(cursor.page)*time.Duration(mock.Paging.PageDelay)); err != nil {
+			return SearchResult{}, err
+		}
+
+		result, err := next(ctx, req)
+		if err != nil && resultCode(err) != ldap.LDAPResultSizeLimitExceeded {
+			return result, err
+		}
+
+		total := len(result.Users) + len(result.Groups) + len(result.Entries)
+		size := int(paging.Size)
+		result = result.window(cursor.offset, size)
+
+		var cookie []byte
+		if cursor.offset+size < total {
+			cookie = pagingCursor{page: cursor.page + 1, offset: cursor.offset + size}.cookie()
+		}
+		result.controls = append(result.controls, pagingResponse(total, cookie).Encode())
+
+		return result, err
+	}
+}
@@ -0,0 +1,299 @@
+package ldapmock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+var errNotThisOperation = errors.New("not this operation")
+
+// responseWriter sends one response message to the client, at most
+// bandwidth bytes per second when it is not zero. Once a write fails, the
+// connection is closed after the handler returns.
+type responseWriter func(p *ber.Packet, bandwidth ByteRate) error
+
+// requestHandlerFunc handles one LDAPMessage, writing its responses to w as
+// they are built. Returning false passes the packet to the next handler.
+type requestHandlerFunc func(ctx context.Context, p *ber.Packet, w responseWriter) bool
+
+// operation returns the message ID and the protocol operation of an
+// LDAPMessage, or errNotThisOperation if it is not of the given application
+// tag.
+func operation(p *ber.Packet, tag ber.Tag) (int64, *ber.Packet, error) {
+	if p == nil || len(p.Children) < 2 {
+		return 0, nil, errNotThisOperation
+	}
+
+	msgID, ok := p.Children[0].Value.(int64)
+	if !ok {
+		return 0, nil, errNotThisOperation
+	}
+
+	op := p.Children[1]
+	if op.ClassType != ber.ClassApplication || op.Tag != tag {
+		return 0, nil, errNotThisOperation
+	}
+
+	return msgID, op, nil
+}
+
+func parseBindRequest(p *ber.Packet) (int64, BindRequest, error) {
+	msgID, op, err := operation(p, ldap.ApplicationBindRequest)
+	if err != nil {
+		return 0, BindRequest{}, err
+	}
+
+	if len(op.Children) < 3 {
+		return msgID, BindRequest{}, fmt.Errorf("bind request: expected 3 elements, got %d", len(op.Children))
+	}
+
+	req := BindRequest{
+		DN:       string(op.Children[1].ByteValue),
+		Controls: parseControls(p),
+	}
+
+	auth := op.Children[2]
+	switch {
+	case auth.ClassType == ber.ClassContext && auth.Tag == 0:
+		req.Password = string(auth.Data.Bytes())
+	case auth.ClassType == ber.ClassContext && auth.Tag == 3 && len(auth.Children) > 0:
+		req.Mechanism = string(auth.Children[0].ByteValue)
+		if len(auth.Children) > 1 {
+			req.Credentials = auth.Children[1].ByteValue
+		}
+	default:
+		return msgID, req, ldap.NewError(ldap.LDAPResultAuthMethodNotSupported, errors.New("only simple and SASL binds are supported"))
+	}
+
+	return msgID, req, nil
+}
+
+func parseSearchRequest(p *ber.Packet) (int64, SearchRequest, error) {
+	msgID, op, err := operation(p, ldap.ApplicationSearchRequest)
+	if err != nil {
+		return 0, SearchRequest{}, err
+	}
+
+	if len(op.Children) < 8 {
+		return msgID, SearchRequest{}, fmt.Errorf("search request: expected 8 elements, got %d", len(op.Children))
+	}
+
+	fields := op.Children
+
+	scope, ok := fields[1].Value.(int64)
+	if !ok {
+		return msgID, SearchRequest{}, errors.New("search request: invalid scope")
+	}
+
+	sizeLimit, _ := fields[3].Value.(int64)
+	timeLimit, _ := fields[4].Value.(int64)
+	typesOnly, _ := fields[5].Value.(bool)
+
+	filter, err := ldap.DecompileFilter(fields[6])
+	if err != nil {
+		return msgID, SearchRequest{}, fmt.Errorf("search request: %w", err)
+	}
+
+	attributes := make([]string, 0, len(fields[7].Children))
+	for _, attr := range fields[7].Children {
+		attributes = append(attributes, string(attr.ByteValue))
+	}
+
+	req := SearchRequest{
+		BaseDN:     string(fields[0].ByteValue),
+		Scope:      LDAPScope(scope),
+		Filter:     filter,
+		Attributes: attributes,
+		SizeLimit:  sizeLimit,
+		TimeLimit:  timeLimit,
+		TypesOnly:  typesOnly,
+		Controls:   parseControls(p),
+	}
+
+	return msgID, req, nil
+}
+
+func parseAddRequest(p *ber.Packet) (int64, Entry, error) {
+	msgID, op, err := operation(p, ldap.ApplicationAddRequest)
+	if err != nil {
+		return 0, Entry{}, err
+	}
+
+	if len(op.Children) < 2 {
+		return msgID, Entry{}, fmt.Errorf("add request: expected 2 elements, got %d", len(op.Children))
+	}
+
+	entry := Entry{
+		DN:    string(op.Children[0].ByteValue),
+		Attrs: make(map[string][]string, len(op.Children[1].Children)),
+	}
+
+	for _, attr := range op.Children[1].Children {
+		if len(attr.Children) < 2 {
+			return msgID, Entry{}, errors.New("add request: invalid attribute")
+		}
+
+		name := string(attr.Children[0].ByteValue)
+		for _, value := range attr.Children[1].Children {
+			entry.Attrs[name] = append(entry.Attrs[name], string(value.ByteValue))
+		}
+	}
+
+	return msgID, entry, nil
+}
+
+func parseCompareRequest(p *ber.Packet) (int64, CompareRequest, error) {
+	msgID, op, err := operation(p, ldap.ApplicationCompareRequest)
+	if err != nil {
+		return 0, CompareRequest{}, err
+	}
+
+	if len(op.Children) < 2 || len(op.Children[1].Children) < 2 {
+		return msgID, CompareRequest{}, errors.New("compare request: expected an entry and an assertion")
+	}
+
+	ava := op.Children[1].Children
+	req := CompareRequest{
+		DN:    string(op.Children[0].ByteValue),
+		Attr:  string(ava[0].ByteValue),
+		Value: string(ava[1].ByteValue),
+	}
+
+	return msgID, req, nil
+}
+
+func parseModifyRequest(p *ber.Packet) (int64, ModifyRequest, error) {
+	msgID, op, err := operation(p, ldap.ApplicationModifyRequest)
+	if err != nil {
+		return 0, ModifyRequest{}, err
+	}
+
+	if len(op.Children) < 2 {
+		return msgID, ModifyRequest{}, fmt.Errorf("modify request: expected 2 elements, got %d", len(op.Children))
+	}
+
+	req := ModifyRequest{DN: string(op.Children[0].ByteValue)}
+	for _, change := range op.Children[1].Children {
+		if len(change.Children) < 2 || len(change.Children[1].Children) < 2 {
+			return msgID, req, errors.New("modify request: invalid change")
+		}
+
+		code, ok := change.Children[0].Value.(int64)
+		if !ok || code < 0 || code >= int64(len(modifyOps)) {
+			return msgID, req, fmt.Errorf("modify request: unknown operation %v", change.Children[0].Value)
+		}
+
+		attr := change.Children[1].Children
+		modification := Modification{Op: modifyOps[code], Attr: string(attr[0].ByteValue)}
+		for _, value := range attr[1].Children {
+			modification.Values = append(modification.Values, string(value.ByteValue))
+		}
+
+		req.Changes = append(req.Changes, modification)
+	}
+
+	return msgID, req, nil
+}
+
+func newMessage(msgID int64) *ber.Packet {
+	msg := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	msg.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, msgID, "MessageID"))
+
+	return msg
+}
+
+// resultCode maps a handler error to an LDAP result code. A nil err is
+// success; *ldap.Error carries its result code, anything else is other(80).
+func resultCode(err error) uint16 {
+	if err == nil {
+		return ldap.LDAPResultSuccess
+	}
+
+	var ldapErr *ldap.Error
+	if errors.As(err, &ldapErr) {
+		return ldapErr.ResultCode
+	}
+
+	return ldap.LDAPResultOther
+}
+
+// newResultPacket builds an LDAPResult response with the result code of err
+// (see resultCode).
+func newResultPacket(msgID int64, tag ber.Tag, err error) *ber.Packet {
+	code := resultCode(err)
+	matchedDN := ""
+	message := ""
+
+	if err != nil {
+		message = err.Error()
+
+		var ldapErr *ldap.Error
+		if errors.As(err, &ldapErr) {
+			matchedDN = ldapErr.MatchedDN
+			message = ""
+			if ldapErr.Err != nil {
+				message = ldapErr.Err.Error()
+			}
+		}
+	}
+
+	result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, ldap.ApplicationMap[uint8(tag)])
+	result.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "Result Code"))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, matchedDN, "Matched DN"))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, message, "Diagnostic Message"))
+
+	msg := newMessage(msgID)
+	msg.AppendChild(result)
+
+	return msg
+}
+
+// newSearchEntryPacket encodes a search result entry. Its attributes are in
+// map order, or sorted by name ignoring case if sortAttrs is set.
+func newSearchEntryPacket(msgID int64, dn string, attrs map[string][]string, sortAttrs bool) *ber.Packet {
+	entry := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	entry.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, dn, "Object Name"))
+
+	names := maps.Keys(attrs)
+	if sortAttrs {
+		names = slices.Values(slices.SortedFunc(names, compareAttributeNames))
+	}
+
+	attributes := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+	for name := range names {
+		values := attrs[name]
+		attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+
+		vals := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		for _, value := range values {
+			vals.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "Value"))
+		}
+
+		attr.AppendChild(vals)
+		attributes.AppendChild(attr)
+	}
+	entry.AppendChild(attributes)
+
+	msg := newMessage(msgID)
+	msg.AppendChild(entry)
+
+	return msg
+}
+
+// compareAttributeNames orders attribute names ignoring case, then by case so
+// that names differing only in case keep a stable order.
+func compareAttributeNames(a, b string) int {
+	if c := strings.Compare(strings.ToLower(a), strings.ToLower(b)); c != 0 {
+		return c
+	}
+
+	return strings.Compare(a, b)
+}
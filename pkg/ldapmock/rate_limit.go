@@ -0,0 +1,193 @@
+package ldapmock
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// Rate limit actions.
+const (
+	// RateLimitReject fails the requests above the limit with busy(51).
+	RateLimitReject = "reject"
+	// RateLimitDelay holds the requests above the limit until the client is
+	// back under it.
+	RateLimitDelay = "delay"
+)
+
+// maxRateLimitClients is the number of clients tracked before the ones back
+// under their limit are forgotten.
+const maxRateLimitClients = 1024
+
+// RateLimitConfig limits the binds and searches of every client IP, to test
+// client-side rate limiting and backoff. Connections without an IP, such as
+// LDAPI ones, share a limit.
+type RateLimitConfig struct {
+	// RequestsPerSecond is the sustained rate allowed per client; zero
+	// disables the limit.
+	RequestsPerSecond float64 `json:"requests_per_second"`
+	// Burst is the number of requests a client can send at once; zero is
+	// RequestsPerSecond rounded up.
+	Burst int `json:"burst"`
+	// Action is RateLimitReject, the default, or RateLimitDelay.
+	Action string `json:"action"`
+}
+
+func (c *RateLimitConfig) validate() error {
+	if c.RequestsPerSecond < 0 || math.IsInf(c.RequestsPerSecond, 0) || math.IsNaN(c.RequestsPerSecond) {
+		return fmt.Errorf("invalid requests per second %v: must be a non-negative number", c.RequestsPerSecond)
+	}
+
+	if c.Burst < 0 {
+		return fmt.Errorf("invalid burst %d: must not be negative", c.Burst)
+	}
+
+	switch strings.ToLower(c.Action) {
+	case "":
+		c.Action = RateLimitReject
+	case RateLimitReject, RateLimitDelay:
+		c.Action = strings.ToLower(c.Action)
+	default:
+		return fmt.Errorf("invalid rate limit action %q: must be %s or %s", c.Action, RateLimitReject, RateLimitDelay)
+	}
+
+	return nil
+}
+
+func (c RateLimitConfig) burst() float64 {
+	if c.Burst > 0 {
+		return float64(c.Burst)
+	}
+
+	return max(1, math.Ceil(c.RequestsPerSecond))
+}
+
+// SetRateLimit replaces the per-client rate limit and forgets past requests;
+// the zero RateLimitConfig disables it. It can be called while serving.
+func (s *LDAPServer) SetRateLimit(cfg RateLimitConfig) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+
+	s.rateLimitMu.Lock()
+	defer s.rateLimitMu.Unlock()
+
+	s.rateLimit = cfg
+	s.rateLimitBuckets = nil
+
+	return nil
+}
+
+// RateLimit returns the current per-client rate limit.
+func (s *LDAPServer) RateLimit() RateLimitConfig {
+	s.rateLimitMu.RLock()
+	defer s.rateLimitMu.RUnlock()
+
+	return s.rateLimit
+}
+
+// tokenBucket holds the requests a client can still send at once, as of last.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// takeToken takes a request from the bucket of client. It returns false when
+// the request is to be rejected, and how long it must wait otherwise.
+func (s *LDAPServer) takeToken(client string, now time.Time) (time.Duration, bool) {
+	s.rateLimitMu.Lock()
+	defer s.rateLimitMu.Unlock()
+
+	cfg := s.rateLimit
+	if cfg.RequestsPerSecond <= 0 {
+		return 0, true
+	}
+
+	burst := cfg.burst()
+	refill := func(b *tokenBucket) {
+		b.tokens = min(burst, b.tokens+now.Sub(b.last).Seconds()*cfg.RequestsPerSecond)
+		b.last = now
+	}
+
+	if s.rateLimitBuckets == nil {
+		s.rateLimitBuckets = make(map[string]*tokenBucket)
+	}
+
+	bucket, ok := s.rateLimitBuckets[client]
+	if !ok {
+		if len(s.rateLimitBuckets) >= maxRateLimitClients {
+			for name, b := range s.rateLimitBuckets {
+				if refill(b); b.tokens >= burst {
+					delete(s.rateLimitBuckets, name)
+				}
+			}
+		}
+
+		bucket = &tokenBucket{tokens: burst, last: now}
+		s.rateLimitBuckets[client] = bucket
+	}
+
+	refill(bucket)
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return 0, true
+	}
+	if cfg.Action == RateLimitReject {
+		return 0, false
+	}
+
+	// The request waits for its token, which later requests queue behind.
+	wait := time.Duration((1 - bucket.tokens) / cfg.RequestsPerSecond * float64(time.Second))
+	bucket.tokens--
+
+	return wait, true
+}
+
+// rateLimitError returns the error of a request above the rate limit of its
+// client, or nil once it may proceed.
+func (s *LDAPServer) rateLimitError(ctx context.Context) error {
+	client := ""
+	if conn, ok := ConnInfoFromContext(ctx); ok && conn.RemoteAddr != nil {
+		client = conn.RemoteAddr.String()
+		if host, _, err := net.SplitHostPort(client); err == nil {
+			client = host
+		}
+	}
+
+	wait, ok := s.takeToken(client, time.Now())
+	if !ok {
+		return ldap.NewError(ldap.LDAPResultBusy,
+			fmt.Errorf("client %s exceeds %v requests per second", client, s.RateLimit().RequestsPerSecond))
+	}
+
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ldap.NewError(ldap.LDAPResultUnavailable, ctx.Err())
+	}
+}
+
+// rateLimitMiddleware applies the rate limit to searches.
+func (s *LDAPServer) rateLimitMiddleware(next SearchFunc) SearchFunc {
+	return func(ctx context.Context, req SearchRequest) (SearchResult, error) {
+		if err := s.rateLimitError(ctx); err != nil {
+			return SearchResult{}, err
+		}
+
+		return next(ctx, req)
+	}
+}
@@ -0,0 +1,101 @@
+package ldapmock
+
+import (
+	"context"
+	"errors"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"go.uber.org/zap"
+)
+
+// DefaultReadOnlyMessage is the diagnostic message of writes refused in
+// read-only mode when none is configured.
+const DefaultReadOnlyMessage = "the directory is read-only"
+
+// ReadOnlyConfig makes the server refuse every write operation (add, delete,
+// modify, modify DN) with unwillingToPerform(53) and Message.
+type ReadOnlyConfig struct {
+	Enabled bool   `json:"enabled"`
+	Message string `json:"message"`
+}
+
+// writeOperations maps the write requests to their response tags and the
+// request log type.
+var writeOperations = []struct {
+	request  ber.Tag
+	response ber.Tag
+	typ      string
+}{
+	{ldap.ApplicationAddRequest, ldap.ApplicationAddResponse, "add"},
+	{ldap.ApplicationDelRequest, ldap.ApplicationDelResponse, "delete"},
+	{ldap.ApplicationModifyRequest, ldap.ApplicationModifyResponse, "modify"},
+	{ldap.ApplicationModifyDNRequest, ldap.ApplicationModifyDNResponse, "modify_dn"},
+}
+
+// SetReadOnly switches read-only mode; an empty message uses
+// DefaultReadOnlyMessage. It can be called while serving.
+func (s *LDAPServer) SetReadOnly(cfg ReadOnlyConfig) error {
+	if cfg.Message == "" {
+		cfg.Message = DefaultReadOnlyMessage
+	}
+
+	s.readOnlyMu.Lock()
+	defer s.readOnlyMu.Unlock()
+
+	s.readOnly = cfg
+
+	return nil
+}
+
+// ReadOnly returns the current read-only mode.
+func (s *LDAPServer) ReadOnly() ReadOnlyConfig {
+	s.readOnlyMu.RLock()
+	defer s.readOnlyMu.RUnlock()
+
+	return s.readOnly
+}
+
+// serveReadOnly refuses write operations in read-only mode and on global
+// catalog listeners. Otherwise they are left to the next handlers.
+func (s *LDAPServer) serveReadOnly(ctx context.Context, p *ber.Packet, w responseWriter) bool {
+	cfg := s.ReadOnly()
+	if isGlobalCatalog(ctx) {
+		cfg = ReadOnlyConfig{Enabled: true, Message: globalCatalogReadOnlyMessage}
+	}
+	if !cfg.Enabled {
+		return false
+	}
+
+	for _, write := range writeOperations {
+		msgID, op, err := operation(p, write.request)
+		if err != nil {
+			continue
+		}
+
+		err = ldap.NewError(ldap.LDAPResultUnwillingToPerform, errors.New(cfg.Message))
+		dn := entryDNOf(op)
+
+		s.logger(ctx).Info("write refused in read-only mode", zap.String("operation", write.typ), zap.String("dn", dn))
+
+		requestLog := s.newRequestLog(ctx, write.typ, err)
+		requestLog.BaseDN = dn
+		s.logRequest(requestLog)
+
+		_ = w(newResultPacket(msgID, write.response, err), 0)
+
+		return true
+	}
+
+	return false
+}
+
+// entryDNOf returns the DN a write request targets: the whole value of a
+// delete request, the first element of the others.
+func entryDNOf(op *ber.Packet) string {
+	if len(op.Children) == 0 {
+		return op.Data.String()
+	}
+
+	return string(op.Children[0].ByteValue)
+}
@@ -0,0 +1,199 @@
+package ldapmock
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+)
+
+// ReplayResult is a recorded search whose outcome changed under the replayed
+// mock.
+type ReplayResult struct {
+	RequestID       string          `json:"request_id"`
+	BaseDN          string          `json:"base_dn"`
+	Scope           string          `json:"scope"`
+	Filter          string          `json:"filter"`
+	RecordedRule    *MatchedRuleLog `json:"recorded_rule,omitempty"`
+	ReplayedRule    *MatchedRuleLog `json:"replayed_rule,omitempty"`
+	RuleChanged     bool            `json:"rule_changed"`
+	RecordedDNs     []string        `json:"recorded_dns"`
+	ReplayedDNs     []string        `json:"replayed_dns"`
+	ResponseChanged bool            `json:"response_changed"`
+}
+
+// ReplayReport summarizes a replay, as returned by POST /replay. Results only
+// lists the searches that changed, in log order.
+type ReplayReport struct {
+	Searches        int            `json:"searches"`
+	RuleChanged     int            `json:"rule_changed"`
+	ResponseChanged int            `json:"response_changed"`
+	Results         []ReplayResult `json:"results"`
+}
+
+// ReadRequestLog decodes request log entries exported as NDJSON (one entry
+// per line) or as the JSON array returned by GET /requests.
+func ReadRequestLog(r io.Reader) ([]LDAPRequestLog, error) {
+	br := bufio.NewReader(r)
+
+	first, err := firstNonSpace(br)
+	if err != nil {
+		if err == io.EOF {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read request log: %w", err)
+	}
+
+	dec := json.NewDecoder(br)
+
+	if first == '[' {
+		var logs []LDAPRequestLog
+		if err := dec.Decode(&logs); err != nil {
+			return nil, fmt.Errorf("decode request log: %w", err)
+		}
+		return logs, nil
+	}
+
+	var logs []LDAPRequestLog
+	for {
+		var entry LDAPRequestLog
+		if err := dec.Decode(&entry); err == io.EOF {
+			return logs, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("decode request log entry %d: %w", len(logs)+1, err)
+		}
+
+		logs = append(logs, entry)
+	}
+}
+
+func firstNonSpace(br *bufio.Reader) (byte, error) {
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+
+		switch b {
+		case ' ', '\t', '\r', '\n':
+			continue
+		}
+
+		return b, br.UnreadByte()
+	}
+}
+
+// Replay re-evaluates the recorded searches of logs against mock, using up
+// to concurrency workers, and reports the searches that now match a
+// different rule or return different entries. Responses are only compared
+// for searches that succeeded and were not answered by the upstream server.
+func Replay(ctx context.Context, mock LDAPMock, logs []LDAPRequestLog, concurrency int) (ReplayReport, error) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	searches := make([]LDAPRequestLog, 0, len(logs))
+	for _, entry := range logs {
+		if entry.Type == "search" {
+			searches = append(searches, entry)
+		}
+	}
+
+	results := make([]*ReplayResult, len(searches))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := range jobs {
+				results[i] = replaySearch(mock, searches[i])
+			}
+		}()
+	}
+
+	var err error
+feed:
+	for i := range searches {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			err = ctx.Err()
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err != nil {
+		return ReplayReport{}, err
+	}
+
+	report := ReplayReport{Searches: len(searches), Results: []ReplayResult{}}
+	for _, result := range results {
+		if result == nil {
+			continue
+		}
+
+		if result.RuleChanged {
+			report.RuleChanged++
+		}
+		if result.ResponseChanged {
+			report.ResponseChanged++
+		}
+
+		report.Results = append(report.Results, *result)
+	}
+
+	return report, nil
+}
+
+// replaySearch returns nil when the outcome of entry did not change.
+func replaySearch(mock LDAPMock, entry LDAPRequestLog) *ReplayResult {
+	sim := Simulate(mock, SearchRequest{
+		BaseDN:     entry.BaseDN,
+		Scope:      ParseScope(entry.Scope),
+		Filter:     entry.Filter,
+		Attributes: entry.Attributes,
+	})
+
+	result := &ReplayResult{
+		RequestID:    entry.RequestID,
+		BaseDN:       entry.BaseDN,
+		Scope:        entry.Scope,
+		Filter:       entry.Filter,
+		RecordedRule: entry.MatchedRule,
+		ReplayedRule: sim.MatchedRule,
+		RecordedDNs:  entry.Response.ReturnedDNs,
+		ReplayedDNs:  sim.Response.ReturnedDNs,
+	}
+	if result.RecordedDNs == nil {
+		result.RecordedDNs = []string{}
+	}
+
+	result.RuleChanged = !sameRule(entry.MatchedRule, sim.MatchedRule)
+
+	succeeded := entry.Result == "" || entry.Result == "Success"
+	if succeeded && !entry.Upstream {
+		result.ResponseChanged = !slices.Equal(result.RecordedDNs, result.ReplayedDNs)
+	}
+
+	if !result.RuleChanged && !result.ResponseChanged {
+		return nil
+	}
+
+	return result
+}
+
+func sameRule(a, b *MatchedRuleLog) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return *a == *b
+}
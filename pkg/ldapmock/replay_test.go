@@ -0,0 +1,73 @@
+package ldapmock
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestReadRequestLog(t *testing.T) {
+	tests := map[string]string{
+		"ndjson": `{"request_id":"a","type":"search"}` + "\n\n" + `{"request_id":"b","type":"bind"}` + "\n",
+		"array":  ` [{"request_id":"a","type":"search"},{"request_id":"b","type":"bind"}]`,
+	}
+
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			logs, err := ReadRequestLog(strings.NewReader(data))
+			if err != nil {
+				t.Fatalf("read: %v", err)
+			}
+			if len(logs) != 2 || logs[0].RequestID != "a" || logs[1].Type != "bind" {
+				t.Errorf("logs = %+v", logs)
+			}
+		})
+	}
+
+	if _, err := ReadRequestLog(strings.NewReader("{not json}\n")); err == nil {
+		t.Error("expected error for invalid entry")
+	}
+}
+
+func TestReplay(t *testing.T) {
+	mock := LDAPMock{
+		Users: []User{{CN: "uid=jane,dc=example", Attrs: map[string]string{"uid": "jane"}}},
+		Rules: []Rule{
+			{ID: "john", Filter: "(uid=john)", Response: Response{Users: []User{{CN: "uid=john,dc=example"}}}},
+		},
+	}
+
+	search := func(id, filter string, rule *MatchedRuleLog, dns ...string) LDAPRequestLog {
+		return LDAPRequestLog{
+			RequestID:   id,
+			Type:        "search",
+			Scope:       "sub",
+			Filter:      filter,
+			MatchedRule: rule,
+			Result:      "Success",
+			Response:    LDAPResponseLog{ReturnedDNs: dns, Count: len(dns)},
+		}
+	}
+
+	logs := []LDAPRequestLog{
+		search("unchanged", "(uid=john)", &MatchedRuleLog{RuleID: "john"}, "uid=john,dc=example"),
+		search("rule", "(uid=john)", nil, "uid=john,dc=example"),
+		search("response", "(uid=jane)", nil),
+		{RequestID: "bind", Type: "bind"},
+	}
+
+	report, err := Replay(context.Background(), mock, logs, 3)
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+
+	if report.Searches != 3 || report.RuleChanged != 1 || report.ResponseChanged != 1 {
+		t.Errorf("report = %+v, want 3 searches, 1 rule and 1 response change", report)
+	}
+	if len(report.Results) != 2 || report.Results[0].RequestID != "rule" || report.Results[1].RequestID != "response" {
+		t.Fatalf("results = %+v, want rule then response", report.Results)
+	}
+	if got := report.Results[1].ReplayedDNs; len(got) != 1 || got[0] != "uid=jane,dc=example" {
+		t.Errorf("replayed DNs = %v", got)
+	}
+}
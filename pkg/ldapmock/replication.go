@@ -0,0 +1,177 @@
+package ldapmock
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// DefaultReplicationPollInterval is how often a replica asks its primary for
+// new changes.
+const DefaultReplicationPollInterval = 200 * time.Millisecond
+
+// Replica keeps the mock of a MockServer in step with the mock of a primary
+// ldap-mock instance, lag behind it, like a read replica that is behind its
+// primary. It follows the changelog of the primary (GET /changes) and, once
+// it sees new changes, fetches the mock of the primary (GET /mock) and
+// activates it lag after it saw them. The lag is measured with the clock of
+// the replica: the clock of the primary may be frozen or moved.
+//
+// Only directory changes are followed: a mock that changes only the rules of
+// the primary reaches the replica with the next directory change.
+type Replica struct {
+	primary string
+	lag     time.Duration
+	target  *MockServer
+	log     *zap.Logger
+	client  *http.Client
+
+	auth         MockAuth
+	pollInterval time.Duration
+}
+
+// NewReplica returns a replica applying the mock of the primary whose HTTP
+// control API is at primaryURL (e.g. http://primary:6006) to target.
+func NewReplica(log *zap.Logger, primaryURL string, lag time.Duration, target *MockServer) *Replica {
+	return &Replica{
+		primary:      strings.TrimSuffix(primaryURL, "/"),
+		lag:          lag,
+		target:       target,
+		log:          log,
+		client:       &http.Client{Timeout: 10 * time.Second},
+		pollInterval: DefaultReplicationPollInterval,
+	}
+}
+
+// SetAuth sets the credentials of the control API of the primary. Basic
+// credentials can also be given in the primary URL.
+func (r *Replica) SetAuth(auth MockAuth) {
+	r.auth = auth
+}
+
+// pendingMock is a mock of the primary waiting for the replication lag.
+type pendingMock struct {
+	at   time.Time
+	mock json.RawMessage
+}
+
+// Run replicates the primary until ctx is done. Errors reaching the primary
+// are logged and retried at the next poll.
+func (r *Replica) Run(ctx context.Context) error {
+	r.log.Info("replicating primary", zap.String("url", r.primary), zap.Duration("lag", r.lag))
+
+	var (
+		pending  []pendingMock
+		lastSeq  uint64
+		synced   bool
+		nextPoll time.Time
+	)
+
+	for {
+		now := time.Now()
+
+		if !now.Before(nextPoll) {
+			nextPoll = now.Add(r.pollInterval)
+
+			changed, seq, err := r.poll(ctx, lastSeq, synced)
+			if err != nil && ctx.Err() == nil {
+				r.log.Warn("poll primary", zap.String("url", r.primary), zap.Error(err))
+			} else if changed {
+				mock, err := r.fetchMock(ctx)
+				if err != nil {
+					r.log.Warn("fetch primary mock", zap.String("url", r.primary), zap.Error(err))
+				} else {
+					pending = append(pending, pendingMock{at: now.Add(r.lag), mock: mock})
+					lastSeq, synced = seq, true
+				}
+			}
+		}
+
+		// Only the newest due mock matters: it includes the older ones.
+		due := 0
+		for due < len(pending) && !now.Before(pending[due].at) {
+			due++
+		}
+		if due > 0 {
+			if err := r.target.LoadMockJSON(pending[due-1].mock); err != nil {
+				r.log.Warn("apply primary mock", zap.Error(err))
+			} else {
+				r.log.Debug("primary mock replicated", zap.Uint64("seq", lastSeq))
+			}
+			pending = pending[due:]
+		}
+
+		wait := time.Until(nextPoll)
+		if len(pending) > 0 {
+			wait = min(wait, time.Until(pending[0].at))
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(wait):
+		}
+	}
+}
+
+// poll reports whether the primary changed after seq. The first poll always
+// reports a change, so that the replica starts from the current mock of the
+// primary; so does a primary that restarted, with a lower last sequence
+// number.
+func (r *Replica) poll(ctx context.Context, seq uint64, synced bool) (changed bool, last uint64, err error) {
+	var resp struct {
+		LastSeq uint64 `json:"last_seq"`
+	}
+	if err := r.get(ctx, "/changes?since="+strconv.FormatUint(seq, 10), &resp); err != nil {
+		return false, 0, err
+	}
+
+	return !synced || resp.LastSeq != seq, resp.LastSeq, nil
+}
+
+func (r *Replica) fetchMock(ctx context.Context) (json.RawMessage, error) {
+	var resp struct {
+		Mock json.RawMessage `json:"mock"`
+	}
+	if err := r.get(ctx, "/mock", &resp); err != nil {
+		return nil, err
+	}
+
+	return resp.Mock, nil
+}
+
+func (r *Replica) get(ctx context.Context, path string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.primary+path, nil)
+	if err != nil {
+		return err
+	}
+
+	if r.auth.APIKey != "" {
+		req.Header.Set("X-API-Key", r.auth.APIKey)
+	}
+	if r.auth.Username != "" {
+		req.SetBasicAuth(r.auth.Username, r.auth.Password)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", path, resp.Status)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("decode %s: %w", path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,229 @@
+package ldapmock
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultRequestLogCapacity = 1000
+)
+
+type LDAPRequestLog struct {
+	Timestamp time.Time `json:"timestamp"`
+	RequestID string    `json:"request_id"`
+	Type      string    `json:"type"`
+	// MockVersion is the version of the mock the request was answered from
+	// (see LDAPServer.MockHistory).
+	MockVersion uint64           `json:"mock_version,omitempty"`
+	ClientAddr  string           `json:"client_addr,omitempty"`
+	AddrFamily  string           `json:"address_family,omitempty"`
+	BindDN      string           `json:"bind_dn,omitempty"`
+	BaseDN      string           `json:"base_dn"`
+	Scope       string           `json:"scope"`
+	Filter      string           `json:"filter"`
+	Attributes  []string         `json:"attributes,omitempty"`
+	Controls    []RequestControl `json:"controls,omitempty"`
+	MatchedRule *MatchedRuleLog  `json:"matched_rule,omitempty"`
+	Upstream    bool             `json:"upstream,omitempty"`
+	ShadowDiff  *ShadowDiff      `json:"shadow_diff,omitempty"`
+	Result      string           `json:"result,omitempty"`
+	Response    LDAPResponseLog  `json:"response"`
+}
+
+type MatchedRuleLog struct {
+	RuleID   string `json:"id"`
+	RuleName string `json:"name"`
+}
+
+type LDAPResponseLog struct {
+	ReturnedDNs []string `json:"returned_dns"`
+	Count       int      `json:"count"`
+}
+
+type RequestLogger interface {
+	Log(req LDAPRequestLog)
+	List() []LDAPRequestLog
+	Clear()
+}
+
+// RequestSubscriber is implemented by request loggers that can stream new
+// entries, as used by GET /requests/stream. Entries are dropped for
+// subscribers that do not keep up; the returned func unsubscribes.
+type RequestSubscriber interface {
+	Subscribe() (<-chan LDAPRequestLog, func())
+}
+
+// RequestRemover is implemented by request loggers that can remove some of
+// their entries, as used by POST /requests/clear with criteria.
+type RequestRemover interface {
+	// Remove removes the entries match reports and returns how many it
+	// removed.
+	Remove(match func(LDAPRequestLog) bool) int
+}
+
+// RequestClearCriteria selects the entries POST /requests/clear removes:
+// those matching every criterion set.
+type RequestClearCriteria struct {
+	// Type is the request type, such as bind or search, ignoring case.
+	Type string `json:"type,omitempty"`
+	// Before selects the entries logged before this time.
+	Before time.Time `json:"before"`
+	// MatchedRule is the ID or name of the rule the entries matched.
+	MatchedRule string `json:"matched_rule,omitempty"`
+}
+
+func (c RequestClearCriteria) matches(entry LDAPRequestLog) bool {
+	if c.Type != "" && !strings.EqualFold(entry.Type, c.Type) {
+		return false
+	}
+
+	if !c.Before.IsZero() && !entry.Timestamp.Before(c.Before) {
+		return false
+	}
+
+	if c.MatchedRule != "" && (entry.MatchedRule == nil ||
+		(entry.MatchedRule.RuleID != c.MatchedRule && entry.MatchedRule.RuleName != c.MatchedRule)) {
+		return false
+	}
+
+	return true
+}
+
+// requestSubscriberBuffer is the number of entries buffered per subscriber.
+const requestSubscriberBuffer = 64
+
+type InMemoryRequestLogger struct {
+	mu       sync.Mutex
+	buffer   []LDAPRequestLog
+	head     int
+	count    int
+	capacity int
+
+	subscribers map[chan LDAPRequestLog]struct{}
+}
+
+func NewInMemoryRequestLogger(capacity int) *InMemoryRequestLogger {
+	if capacity <= 0 {
+		capacity = DefaultRequestLogCapacity
+	}
+
+	return &InMemoryRequestLogger{
+		buffer:   make([]LDAPRequestLog, capacity),
+		capacity: capacity,
+	}
+}
+
+func (l *InMemoryRequestLogger) Log(req LDAPRequestLog) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.capacity == 0 {
+		return
+	}
+
+	entry := cloneRequestLog(req)
+
+	for ch := range l.subscribers {
+		select {
+		case ch <- cloneRequestLog(req):
+		default:
+		}
+	}
+
+	if l.count < l.capacity {
+		idx := (l.head + l.count) % l.capacity
+		l.buffer[idx] = entry
+		l.count++
+		return
+	}
+
+	l.buffer[l.head] = entry
+	l.head = (l.head + 1) % l.capacity
+}
+
+func (l *InMemoryRequestLogger) List() []LDAPRequestLog {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.count == 0 {
+		return nil
+	}
+
+	result := make([]LDAPRequestLog, 0, l.count)
+
+	for i := 0; i < l.count; i++ {
+		idx := (l.head + l.count - 1 - i + l.capacity) % l.capacity
+		result = append(result, cloneRequestLog(l.buffer[idx]))
+	}
+
+	return result
+}
+
+func (l *InMemoryRequestLogger) Subscribe() (<-chan LDAPRequestLog, func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ch := make(chan LDAPRequestLog, requestSubscriberBuffer)
+	if l.subscribers == nil {
+		l.subscribers = make(map[chan LDAPRequestLog]struct{})
+	}
+	l.subscribers[ch] = struct{}{}
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+
+			delete(l.subscribers, ch)
+		})
+	}
+
+	return ch, unsubscribe
+}
+
+func (l *InMemoryRequestLogger) Clear() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.head = 0
+	l.count = 0
+}
+
+// Remove removes the entries match reports, keeping the order of the others.
+func (l *InMemoryRequestLogger) Remove(match func(LDAPRequestLog) bool) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	kept := make([]LDAPRequestLog, 0, l.count)
+	for i := 0; i < l.count; i++ {
+		entry := l.buffer[(l.head+i)%l.capacity]
+		if !match(entry) {
+			kept = append(kept, entry)
+		}
+	}
+
+	removed := l.count - len(kept)
+
+	clear(l.buffer)
+	copy(l.buffer, kept)
+	l.head, l.count = 0, len(kept)
+
+	return removed
+}
+
+func cloneRequestLog(src LDAPRequestLog) LDAPRequestLog {
+	dst := src
+
+	if src.Attributes != nil {
+		dst.Attributes = append([]string(nil), src.Attributes...)
+	}
+
+	if src.Response.ReturnedDNs != nil {
+		dst.Response.ReturnedDNs = append([]string(nil), src.Response.ReturnedDNs...)
+	}
+
+	return dst
+}
@@ -0,0 +1,58 @@
+package ldapmock
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestInMemoryRequestLogger_Remove(t *testing.T) {
+	start := time.Date(2026, 1, 31, 10, 0, 0, 0, time.UTC)
+
+	logger := NewInMemoryRequestLogger(4)
+	for i, entry := range []LDAPRequestLog{
+		{RequestID: "1", Type: "bind"},
+		{RequestID: "2", Type: "search", MatchedRule: &MatchedRuleLog{RuleID: "setup"}},
+		{RequestID: "3", Type: "search", MatchedRule: &MatchedRuleLog{RuleName: "login"}},
+		{RequestID: "4", Type: "search"},
+		{RequestID: "5", Type: "bind"},
+		{RequestID: "6", Type: "search", MatchedRule: &MatchedRuleLog{RuleID: "setup"}},
+	} {
+		entry.Timestamp = start.Add(time.Duration(i) * time.Minute)
+		logger.Log(entry)
+	}
+
+	ids := func() []string {
+		var ids []string
+		for _, entry := range logger.List() {
+			ids = append(ids, entry.RequestID)
+		}
+		return ids
+	}
+
+	tests := []struct {
+		name     string
+		criteria RequestClearCriteria
+		removed  int
+		want     []string
+	}{
+		{name: "matched rule ID", criteria: RequestClearCriteria{MatchedRule: "setup"}, removed: 1, want: []string{"5", "4", "3"}},
+		{name: "type ignoring case", criteria: RequestClearCriteria{Type: "BIND"}, removed: 1, want: []string{"4", "3"}},
+		{name: "every criterion", criteria: RequestClearCriteria{Type: "bind", MatchedRule: "login"}, removed: 0, want: []string{"4", "3"}},
+		{name: "before", criteria: RequestClearCriteria{Before: start.Add(3 * time.Minute)}, removed: 1, want: []string{"4"}},
+	}
+
+	for _, tt := range tests {
+		if removed := logger.Remove(tt.criteria.matches); removed != tt.removed {
+			t.Errorf("%s: removed %d, want %d", tt.name, removed, tt.removed)
+		}
+		if got := ids(); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: log = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	logger.Log(LDAPRequestLog{RequestID: "7"})
+	if got := ids(); !slices.Equal(got, []string{"7", "4"}) {
+		t.Errorf("log after removals = %v, want 7 then 4", got)
+	}
+}
@@ -0,0 +1,86 @@
+package ldapmock
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// requestLogSyntaxes are the syntaxes of the request log fields compared by
+// request log queries; the other fields are case-insensitive strings.
+var requestLogSyntaxes = AttributeSyntaxes{
+	"bind_dn":      SyntaxDN,
+	"base_dn":      SyntaxDN,
+	"returned_dns": SyntaxDN,
+	"count":        SyntaxInteger,
+	"mock_version": SyntaxInteger,
+	"request_id":   SyntaxCaseExact,
+}
+
+// QueryRequestLog returns the entries of logs matching query, an LDAP filter
+// on the request log fields, such as (&(type=search)(base_dn=dc=example)).
+// Fields are named like their JSON counterparts; attributes and returned_dns
+// are multi-valued, controls holds the control OIDs, matched_rule is the rule ID, matched_rule_name its name,
+// count and mock_version are integers, upstream is TRUE or FALSE and timestamp is in RFC 3339 format, in UTC.
+func QueryRequestLog(logs []LDAPRequestLog, query string) ([]LDAPRequestLog, error) {
+	filter, err := ParseFilter(query)
+	if err != nil {
+		return nil, fmt.Errorf("invalid query %s: %w", query, err)
+	}
+
+	syntaxes := requestLogSyntaxes.lower()
+
+	matched := make([]LDAPRequestLog, 0, len(logs))
+	for _, entry := range logs {
+		if (entryMatcher{attrs: requestLogFields(entry), syntaxes: syntaxes}).match(filter) {
+			matched = append(matched, entry)
+		}
+	}
+
+	return matched, nil
+}
+
+// requestLogFields returns the queryable fields of entry; empty ones are
+// absent, so that presence filters tell them apart.
+func requestLogFields(entry LDAPRequestLog) map[string][]string {
+	fields := map[string][]string{
+		"timestamp": {entry.Timestamp.UTC().Format(time.RFC3339Nano)},
+		"upstream":  {strings.ToUpper(strconv.FormatBool(entry.Upstream))},
+		"count":     {strconv.Itoa(entry.Response.Count)},
+	}
+
+	set := func(name, value string) {
+		if value != "" {
+			fields[name] = []string{value}
+		}
+	}
+
+	set("request_id", entry.RequestID)
+	set("type", entry.Type)
+	set("client_addr", entry.ClientAddr)
+	set("address_family", entry.AddrFamily)
+	set("bind_dn", entry.BindDN)
+	set("base_dn", entry.BaseDN)
+	set("scope", entry.Scope)
+	set("filter", entry.Filter)
+	set("result", entry.Result)
+	if entry.MockVersion > 0 {
+		set("mock_version", strconv.FormatUint(entry.MockVersion, 10))
+	}
+	if entry.MatchedRule != nil {
+		set("matched_rule", entry.MatchedRule.RuleID)
+		set("matched_rule_name", entry.MatchedRule.RuleName)
+	}
+	if len(entry.Attributes) > 0 {
+		fields["attributes"] = entry.Attributes
+	}
+	for _, control := range entry.Controls {
+		fields["controls"] = append(fields["controls"], control.OID)
+	}
+	if len(entry.Response.ReturnedDNs) > 0 {
+		fields["returned_dns"] = entry.Response.ReturnedDNs
+	}
+
+	return fields
+}
@@ -0,0 +1,59 @@
+package ldapmock
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestQueryRequestLog(t *testing.T) {
+	logs := []LDAPRequestLog{
+		{RequestID: "3", Type: "search", MockVersion: 12, BaseDN: "DC=Example,DC=Com", Filter: "(uid=john)", Result: "Success",
+			Timestamp: time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC), Attributes: []string{"mail", "cn"},
+			MatchedRule: &MatchedRuleLog{RuleID: "john", RuleName: "John lookup"},
+			Response:    LDAPResponseLog{ReturnedDNs: []string{"uid=john,dc=example,dc=com"}, Count: 1}},
+		{RequestID: "2", Type: "search", MockVersion: 9, BaseDN: "ou=other", Filter: "(cn=*)", Result: "No Such Object", Upstream: true,
+			Timestamp: time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)},
+		{RequestID: "1", Type: "bind", BindDN: "cn=admin,dc=example,dc=com", Result: "Success",
+			Timestamp: time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)},
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"(&(base_dn=dc=example,dc=com)(type=search))", []string{"3"}},
+		{"(type=search)", []string{"3", "2"}},
+		{"(!(result=success))", []string{"2"}},
+		{"(bind_dn=*)", []string{"1"}},
+		{"(attributes=MAIL)", []string{"3"}},
+		{"(returned_dns=UID=John,DC=Example,DC=Com)", []string{"3"}},
+		{"(&(matched_rule=john)(matched_rule_name=*lookup))", []string{"3"}},
+		{"(upstream=TRUE)", []string{"2"}},
+		{"(count>=1)", []string{"3"}},
+		{"(mock_version>=10)", []string{"3"}},
+		{"(timestamp>=2026-01-01T10:00:00Z)", []string{"3", "2"}},
+		{"(|(request_id=1)(filter=\\28cn=\\2a\\29))", []string{"2", "1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			matched, err := QueryRequestLog(logs, tt.query)
+			if err != nil {
+				t.Fatalf("query: %v", err)
+			}
+
+			var got []string
+			for _, entry := range matched {
+				got = append(got, entry.RequestID)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("matched %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := QueryRequestLog(logs, "(type=search"); err == nil {
+		t.Error("expected an error for an invalid query")
+	}
+}
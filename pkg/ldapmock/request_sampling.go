@@ -0,0 +1,54 @@
+package ldapmock
+
+import (
+	"errors"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// RequestLogSampling thins out the request log for high request volumes.
+type RequestLogSampling struct {
+	// Rate logs one in Rate of the successful binds and of the searches a
+	// rule answered, so that soak tests neither slow down on the log nor evict
+	// the interesting entries; 0 and 1 log all of them. Failed requests and
+	// the searches no rule matched are always logged, and statistics count
+	// every request.
+	Rate int `json:"rate"`
+}
+
+// SetRequestLogSampling replaces the request log sampling. It can be called
+// while serving.
+func (s *LDAPServer) SetRequestLogSampling(cfg RequestLogSampling) error {
+	if cfg.Rate < 0 {
+		return errors.New("invalid request log sampling rate: must not be negative")
+	}
+
+	s.requestLogSamplingMu.Lock()
+	defer s.requestLogSamplingMu.Unlock()
+
+	s.requestLogSampling = cfg
+	s.requestLogSeq.Store(0)
+
+	return nil
+}
+
+// RequestLogSampling returns the current request log sampling.
+func (s *LDAPServer) RequestLogSampling() RequestLogSampling {
+	s.requestLogSamplingMu.RLock()
+	defer s.requestLogSamplingMu.RUnlock()
+
+	return s.requestLogSampling
+}
+
+// logRequest adds requestLog to the request log, unless it is sampled out.
+func (s *LDAPServer) logRequest(requestLog LDAPRequestLog) {
+	rate := s.RequestLogSampling().Rate
+	always := requestLog.Result != ldap.LDAPResultCodeMap[ldap.LDAPResultSuccess] ||
+		(requestLog.Type == "search" && requestLog.MatchedRule == nil)
+
+	if rate > 1 && !always && (s.requestLogSeq.Add(1)-1)%uint64(rate) != 0 {
+		return
+	}
+
+	s.requestLogger.Log(requestLog)
+}
@@ -0,0 +1,177 @@
+package ldapmock
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"go.uber.org/zap"
+)
+
+// DefaultRequestWaitTimeout is how long GET /requests/wait blocks without a
+// timeout parameter; maxRequestWaitTimeout bounds the parameter.
+const (
+	DefaultRequestWaitTimeout = 10 * time.Second
+	maxRequestWaitTimeout     = 5 * time.Minute
+)
+
+// RequestWait is the outcome of GET /requests/wait.
+type RequestWait struct {
+	// Satisfied reports whether Count entries matched before the timeout.
+	Satisfied bool `json:"satisfied"`
+	Count     int  `json:"count"`
+	// Requests are the matching entries seen, newest first.
+	Requests []LDAPRequestLog `json:"requests"`
+}
+
+// WaitForRequests blocks until count entries of the request log match, those
+// already logged included, or ctx is done. It returns the matching entries,
+// newest first, with ctx.Err() when there are fewer than count.
+func (s *MockServer) WaitForRequests(ctx context.Context, match func(LDAPRequestLog) bool, count int) ([]LDAPRequestLog, error) {
+	subscriber, ok := s.requestLogger.(RequestSubscriber)
+	if !ok {
+		return nil, errors.New("request logger does not support waiting")
+	}
+
+	// Subscribe before listing, so that no entry is missed. Subscribers miss
+	// the entries logged while their channel is full, so it only tells when
+	// to list the entries again; those seen are told apart by request ID.
+	entries, unsubscribe := subscriber.Subscribe()
+	defer unsubscribe()
+
+	var matched []LDAPRequestLog
+	seen := make(map[string]bool)
+	scan := func() {
+		logged := s.requestLogger.List()
+		for i := len(logged) - 1; i >= 0 && len(matched) < count; i-- {
+			if seen[logged[i].RequestID] {
+				continue
+			}
+
+			seen[logged[i].RequestID] = true
+			if match(logged[i]) {
+				matched = append(matched, logged[i])
+			}
+		}
+	}
+
+	scan()
+
+	var err error
+	for len(matched) < count && err == nil {
+		select {
+		case <-ctx.Done():
+			// Entries logged since the last wake-up count too.
+			if scan(); len(matched) < count {
+				err = ctx.Err()
+			}
+		case <-entries:
+			scan()
+		}
+	}
+
+	slices.Reverse(matched)
+
+	return matched, err
+}
+
+// requestMatcher returns whether entries match the filter and query
+// parameters of GET /requests/wait: filter selects the searches a rule with
+// that filter would match, query is a request log query (see
+// QueryRequestLog).
+func requestMatcher(filter, query string) (func(LDAPRequestLog) bool, error) {
+	var engine *RuleEngine
+	if filter != "" {
+		if _, err := ParseFilter(filter); err != nil {
+			return nil, fmt.Errorf("invalid filter %s: %w", filter, err)
+		}
+		engine = NewRuleEngine([]Rule{{Filter: filter}})
+	}
+
+	if query != "" {
+		if _, err := QueryRequestLog(nil, query); err != nil {
+			return nil, err
+		}
+	}
+
+	return func(entry LDAPRequestLog) bool {
+		if engine != nil && (entry.Type != "search" || engine.FindMatchingRule(SearchRequest{Filter: entry.Filter}) == nil) {
+			return false
+		}
+
+		if query != "" {
+			matched, _ := QueryRequestLog([]LDAPRequestLog{entry}, query)
+			return len(matched) > 0
+		}
+
+		return true
+	}, nil
+}
+
+// waitRequests handles GET /requests/wait: it answers 200 OK once count
+// requests (1 by default) matching filter and query were logged, or
+// 408 Request Timeout after timeout.
+func (s *MockServer) waitRequests(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	if _, ok := s.requestLogger.(RequestSubscriber); !ok {
+		w.WriteHeader(http.StatusNotImplemented)
+		_, _ = w.Write([]byte("request logger does not support waiting"))
+		return
+	}
+
+	params := r.URL.Query()
+
+	count := 1
+	if param := params.Get("count"); param != "" {
+		val, err := strconv.Atoi(param)
+		if err != nil || val < 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte("invalid count: must be a positive integer"))
+			return
+		}
+		count = val
+	}
+
+	timeout := DefaultRequestWaitTimeout
+	if param := params.Get("timeout"); param != "" {
+		val, err := time.ParseDuration(param)
+		if err != nil || val <= 0 || val > maxRequestWaitTimeout {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(fmt.Sprintf("invalid timeout: must be a duration up to %s", maxRequestWaitTimeout)))
+			return
+		}
+		timeout = val
+	}
+
+	match, err := requestMatcher(params.Get("filter"), params.Get("query"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	requests, err := s.WaitForRequests(ctx, match, count)
+	wait := RequestWait{Satisfied: err == nil, Count: len(requests), Requests: requests}
+	if wait.Requests == nil {
+		wait.Requests = []LDAPRequestLog{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !wait.Satisfied {
+		w.WriteHeader(http.StatusRequestTimeout)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(wait); err != nil {
+		s.log.Warn("encode request wait", zap.Error(err))
+	}
+}
@@ -0,0 +1,116 @@
+package ldapmock
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// lossyRequestLogger wakes subscribers only when the test says so, like a
+// subscriber channel that dropped entries.
+type lossyRequestLogger struct {
+	*InMemoryRequestLogger
+	wake chan LDAPRequestLog
+}
+
+func (l lossyRequestLogger) Subscribe() (<-chan LDAPRequestLog, func()) {
+	return l.wake, func() {}
+}
+
+func TestWaitForRequests_DroppedEntries(t *testing.T) {
+	logger := lossyRequestLogger{InMemoryRequestLogger: NewInMemoryRequestLogger(10), wake: make(chan LDAPRequestLog, 1)}
+	srv := NewMockServer(zap.NewNop(), "0", nil, logger)
+
+	logger.Log(LDAPRequestLog{RequestID: "1", Type: "search"})
+
+	type waited struct {
+		requests []LDAPRequestLog
+		err      error
+	}
+	done := make(chan waited)
+	wait := func(count int, timeout time.Duration) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		requests, err := srv.WaitForRequests(ctx, func(LDAPRequestLog) bool { return true }, count)
+		done <- waited{requests, err}
+	}
+
+	ids := func(requests []LDAPRequestLog) []string {
+		var ids []string
+		for _, request := range requests {
+			ids = append(ids, request.RequestID)
+		}
+		return ids
+	}
+
+	// One wake-up for two entries.
+	go wait(3, 5*time.Second)
+	logger.Log(LDAPRequestLog{RequestID: "2", Type: "search"})
+	logger.Log(LDAPRequestLog{RequestID: "3", Type: "search"})
+	logger.wake <- LDAPRequestLog{}
+
+	got := <-done
+	if got.err != nil || !slices.Equal(ids(got.requests), []string{"3", "2", "1"}) {
+		t.Errorf("requests = %v, %v, want 3, 2 and 1", ids(got.requests), got.err)
+	}
+
+	// No wake-up at all: the entries are listed again before timing out.
+	go wait(4, 100*time.Millisecond)
+	logger.Log(LDAPRequestLog{RequestID: "4", Type: "search"})
+
+	got = <-done
+	if got.err != nil || len(got.requests) != 4 {
+		t.Errorf("requests = %v, %v, want 4 without timing out", ids(got.requests), got.err)
+	}
+
+	go wait(5, 50*time.Millisecond)
+
+	got = <-done
+	if !errors.Is(got.err, context.DeadlineExceeded) || len(got.requests) != 4 {
+		t.Errorf("requests = %v, %v, want 4 and the deadline", ids(got.requests), got.err)
+	}
+}
+
+func TestRequestMatcher(t *testing.T) {
+	entries := []LDAPRequestLog{
+		{Type: "search", Filter: "(&(objectClass=user)(uid=bob))", BaseDN: "dc=example"},
+		{Type: "search", Filter: "(uid=alice)", BaseDN: "dc=example"},
+		{Type: "search", Filter: "(uid=bob)", BaseDN: "ou=other"},
+		{Type: "bind", BindDN: "uid=bob,dc=example"},
+	}
+
+	tests := []struct {
+		filter, query string
+		want          []bool
+	}{
+		{"", "", []bool{true, true, true, true}},
+		{"(uid=bob)", "", []bool{true, false, true, false}},
+		{"(uid=bob)", "(base_dn=dc=example)", []bool{true, false, false, false}},
+		{"", "(type=bind)", []bool{false, false, false, true}},
+	}
+
+	for _, tt := range tests {
+		match, err := requestMatcher(tt.filter, tt.query)
+		if err != nil {
+			t.Fatalf("matcher %q %q: %v", tt.filter, tt.query, err)
+		}
+
+		for i, entry := range entries {
+			if got := match(entry); got != tt.want[i] {
+				t.Errorf("filter %q, query %q: match(%+v) = %v, want %v", tt.filter, tt.query, entry, got, tt.want[i])
+			}
+		}
+	}
+
+	if _, err := requestMatcher("(uid=bob", ""); err == nil {
+		t.Error("expected an error for an invalid filter")
+	}
+	if _, err := requestMatcher("", "(type=search"); err == nil {
+		t.Error("expected an error for an invalid query")
+	}
+}
@@ -0,0 +1,87 @@
+package ldapmock
+
+import (
+	"fmt"
+	"maps"
+	"strings"
+)
+
+// ResponseFormat.AttributeNames values.
+const (
+	// AttributeNamesDeclared sends attribute names exactly as the mock
+	// declares them, like Active Directory sends its camelCase names
+	// whatever case the client asked for.
+	AttributeNamesDeclared = "declared"
+	// AttributeNamesRequested sends the attributes named in the search
+	// attribute list as spelled there, like OpenLDAP does.
+	AttributeNamesRequested = "requested"
+)
+
+// ResponseFormat controls how search result entries are encoded.
+type ResponseFormat struct {
+	// SortAttributes sends the attributes of every entry in alphabetical
+	// order of their names, ignoring case, instead of the varying order of
+	// Go maps, for snapshot-based assertions. Values keep their order.
+	SortAttributes bool `json:"sort_attributes"`
+	// AttributeNames is AttributeNamesDeclared (the default) or
+	// AttributeNamesRequested. Filters and attribute lists match names
+	// ignoring case either way.
+	AttributeNames string `json:"attribute_names"`
+}
+
+// SetResponseFormat changes how search result entries are encoded. It can
+// be called while serving.
+func (s *LDAPServer) SetResponseFormat(format ResponseFormat) error {
+	switch strings.ToLower(format.AttributeNames) {
+	case "":
+		format.AttributeNames = AttributeNamesDeclared
+	case AttributeNamesDeclared, AttributeNamesRequested:
+		format.AttributeNames = strings.ToLower(format.AttributeNames)
+	default:
+		return fmt.Errorf("invalid attribute names %q: must be %s or %s",
+			format.AttributeNames, AttributeNamesDeclared, AttributeNamesRequested)
+	}
+
+	s.responseFormatMu.Lock()
+	defer s.responseFormatMu.Unlock()
+
+	s.responseFormat = format
+
+	return nil
+}
+
+// ResponseFormat returns how search result entries are encoded.
+func (s *LDAPServer) ResponseFormat() ResponseFormat {
+	s.responseFormatMu.RLock()
+	defer s.responseFormatMu.RUnlock()
+
+	return s.responseFormat
+}
+
+// withRequestedNames returns e with the attributes named in requested
+// renamed as spelled there. The attributes of e are not modified.
+func (e Entry) withRequestedNames(requested []string) Entry {
+	var renamed map[string][]string
+	for name, values := range e.Attrs {
+		for _, attr := range requested {
+			if attr == name || !strings.EqualFold(attr, name) {
+				continue
+			}
+
+			if renamed == nil {
+				renamed = maps.Clone(e.Attrs)
+			}
+
+			delete(renamed, name)
+			renamed[attr] = values
+
+			break
+		}
+	}
+
+	if renamed == nil {
+		return e
+	}
+
+	return Entry{DN: e.DN, Attrs: renamed}
+}
@@ -0,0 +1,207 @@
+package ldapmock
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// DefaultVendorName is the vendorName of the root DSE when none is
+// configured.
+const DefaultVendorName = "ldap-mock"
+
+// defaultSupportedControls are the controls the server implements: content
+// synchronization and DirSync, and paged results when the mock simulates
+// paging.
+var defaultSupportedControls = []string{ldap.ControlTypeSyncRequest, ldap.ControlTypeDirSync}
+
+// RootDSE is what the mock advertises in its root DSE, the entry returned
+// to base searches of the empty DN that clients read to detect the features
+// of a server. Empty fields get defaults (see LDAPMock.rootDSE).
+type RootDSE struct {
+	// NamingContexts are the suffixes the server holds; the base DNs of the
+	// tenants by default, or without tenants the suffix common to the users
+	// and groups.
+	NamingContexts []string `yaml:"naming_contexts,omitempty" json:"naming_contexts,omitempty"`
+	// SupportedLDAPVersions are listed in supportedLDAPVersion; 3 by
+	// default.
+	SupportedLDAPVersions []string `yaml:"supported_ldap_versions,omitempty" json:"supported_ldap_versions,omitempty"`
+	// SupportedControls are the OIDs listed in supportedControl, e.g.
+	// 1.2.840.113556.1.4.319 for paged results; by default the controls the
+	// server implements for the mock.
+	SupportedControls []string `yaml:"supported_controls,omitempty" json:"supported_controls,omitempty"`
+	// SupportedExtensions are the OIDs listed in supportedExtension, e.g.
+	// 1.3.6.1.4.1.4203.1.11.3 for Who am I?.
+	SupportedExtensions []string `yaml:"supported_extensions,omitempty" json:"supported_extensions,omitempty"`
+	// SupportedFeatures are the OIDs listed in supportedFeatures;
+	// ModifyIncrementFeature by default.
+	SupportedFeatures []string `yaml:"supported_features,omitempty" json:"supported_features,omitempty"`
+	// VendorName defaults to DefaultVendorName, VendorVersion to the
+	// version of the mock.
+	VendorName    string `yaml:"vendor_name,omitempty" json:"vendor_name,omitempty"`
+	VendorVersion string `yaml:"vendor_version,omitempty" json:"vendor_version,omitempty"`
+}
+
+func cloneRootDSE(dse *RootDSE) *RootDSE {
+	if dse == nil {
+		return nil
+	}
+
+	clone := *dse
+	clone.NamingContexts = slices.Clone(dse.NamingContexts)
+	clone.SupportedLDAPVersions = slices.Clone(dse.SupportedLDAPVersions)
+	clone.SupportedControls = slices.Clone(dse.SupportedControls)
+	clone.SupportedExtensions = slices.Clone(dse.SupportedExtensions)
+	clone.SupportedFeatures = slices.Clone(dse.SupportedFeatures)
+
+	return &clone
+}
+
+// rootDSE returns the root DSE of the mock with the defaults of its empty
+// fields filled in.
+func (m LDAPMock) rootDSE() *RootDSE {
+	dse := cloneRootDSE(m.RootDSE)
+	if dse == nil {
+		dse = &RootDSE{}
+	}
+
+	if len(dse.NamingContexts) == 0 {
+		for _, tenant := range m.Tenants {
+			dse.NamingContexts = append(dse.NamingContexts, tenant.BaseDN)
+		}
+	}
+	if len(dse.NamingContexts) == 0 {
+		if suffix := m.commonSuffix(); suffix != "" {
+			dse.NamingContexts = []string{suffix}
+		}
+	}
+	if len(dse.SupportedControls) == 0 {
+		if m.Paging != nil {
+			dse.SupportedControls = append(dse.SupportedControls, ldap.ControlTypePaging)
+		}
+		dse.SupportedControls = append(dse.SupportedControls, defaultSupportedControls...)
+	}
+	if len(dse.SupportedLDAPVersions) == 0 {
+		dse.SupportedLDAPVersions = []string{"3"}
+	}
+	if len(dse.SupportedFeatures) == 0 {
+		dse.SupportedFeatures = []string{ModifyIncrementFeature}
+	}
+	if dse.VendorName == "" {
+		dse.VendorName = DefaultVendorName
+	}
+	if dse.VendorVersion == "" {
+		dse.VendorVersion = Version
+	}
+
+	return dse
+}
+
+// commonSuffix returns the normalized suffix the parent DNs of the users and
+// groups have in common, or "" when they have none.
+func (m LDAPMock) commonSuffix() string {
+	var (
+		suffix []string
+		found  bool
+	)
+	common := func(dn string) {
+		rdns := splitDN(dn)
+		if len(rdns) == 0 {
+			return
+		}
+
+		parent := rdns[1:]
+		if !found {
+			suffix, found = parent, true
+			return
+		}
+
+		n := 0
+		for n < len(suffix) && n < len(parent) && suffix[len(suffix)-1-n] == parent[len(parent)-1-n] {
+			n++
+		}
+		suffix = suffix[len(suffix)-n:]
+	}
+
+	for _, user := range m.Users {
+		common(user.CN)
+	}
+	for _, group := range m.Groups {
+		common(group.CN)
+	}
+
+	return strings.Join(suffix, ",")
+}
+
+// isRootDSESearch reports whether req reads the root DSE.
+func isRootDSESearch(req SearchRequest) bool {
+	return strings.TrimSpace(req.BaseDN) == "" && req.Scope == ScopeBase
+}
+
+// entry returns the root DSE entry with the attributes requested asks for.
+// Its attributes are operational, so "+" asks for them too.
+func (dse *RootDSE) entry(requested []string) Entry {
+	attrs := map[string][]string{"objectClass": {"top"}}
+	if len(dse.NamingContexts) > 0 {
+		attrs["namingContexts"] = dse.NamingContexts
+	}
+	if len(dse.SupportedLDAPVersions) > 0 {
+		attrs["supportedLDAPVersion"] = dse.SupportedLDAPVersions
+	}
+	if len(dse.SupportedControls) > 0 {
+		attrs["supportedControl"] = dse.SupportedControls
+	}
+	if len(dse.SupportedExtensions) > 0 {
+		attrs["supportedExtension"] = dse.SupportedExtensions
+	}
+	if len(dse.SupportedFeatures) > 0 {
+		attrs["supportedFeatures"] = dse.SupportedFeatures
+	}
+	if dse.VendorName != "" {
+		attrs["vendorName"] = []string{dse.VendorName}
+	}
+	if dse.VendorVersion != "" {
+		attrs["vendorVersion"] = []string{dse.VendorVersion}
+	}
+
+	if slices.Contains(requested, "+") {
+		return Entry{Attrs: attrs}
+	}
+
+	for name := range attrs {
+		if !attributeRequested(requested, name) {
+			delete(attrs, name)
+		}
+	}
+
+	return Entry{Attrs: attrs}
+}
+
+// rootDSEResult answers req from the root DSE of mock, when it is a root DSE
+// search; the result has no entry when the filter does not match. ok is
+// false for other searches.
+func rootDSEResult(mock LDAPMock, req SearchRequest) (result SearchResult, ok bool) {
+	if !isRootDSESearch(req) {
+		return SearchResult{}, false
+	}
+
+	dse := mock.rootDSE()
+	entry := dse.entry(nil)
+	if req.Filter != "" {
+		filter, err := ParseFilter(req.Filter)
+		if err != nil {
+			return SearchResult{}, false
+		}
+
+		attrs := make(map[string][]string, len(entry.Attrs))
+		for name, values := range entry.Attrs {
+			attrs[strings.ToLower(name)] = values
+		}
+		if !(entryMatcher{attrs: attrs}).match(filter) {
+			return SearchResult{Entries: []Entry{}}, true
+		}
+	}
+
+	return SearchResult{Entries: []Entry{dse.entry(req.Attributes)}}, true
+}
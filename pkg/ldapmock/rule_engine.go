@@ -0,0 +1,441 @@
+package ldapmock
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// RuleEngine evaluates rules in priority order; rules with the same priority
+// keep their order. Rule filters and conditions are parsed once, when the
+// engine is built.
+type RuleEngine struct {
+	rules   []Rule
+	filters []parsedFilter
+	whens   []parsedWhen
+}
+
+type parsedFilter struct {
+	text   string
+	filter *Filter
+	err    error
+}
+
+func parseFilter(text string) parsedFilter {
+	f, err := ParseFilter(text)
+
+	return parsedFilter{text: text, filter: f, err: err}
+}
+
+func NewRuleEngine(rules []Rule) *RuleEngine {
+	sortedRules := make([]Rule, len(rules))
+	copy(sortedRules, rules)
+
+	sort.SliceStable(sortedRules, func(i, j int) bool {
+		return sortedRules[i].Priority > sortedRules[j].Priority
+	})
+
+	filters := make([]parsedFilter, len(sortedRules))
+	whens := make([]parsedWhen, len(sortedRules))
+	for i := range sortedRules {
+		filters[i] = parseFilter(sortedRules[i].Filter)
+		whens[i] = parseWhen(sortedRules[i].WhenExpr)
+	}
+
+	return &RuleEngine{rules: sortedRules, filters: filters, whens: whens}
+}
+
+// merge returns an engine that also evaluates the rules of other, after the
+// rules of e with the same priority. Nothing is parsed again.
+func (e *RuleEngine) merge(other *RuleEngine) *RuleEngine {
+	if other == nil || len(other.rules) == 0 {
+		return e
+	}
+
+	merged := &RuleEngine{
+		rules:   make([]Rule, 0, len(e.rules)+len(other.rules)),
+		filters: make([]parsedFilter, 0, len(e.rules)+len(other.rules)),
+		whens:   make([]parsedWhen, 0, len(e.rules)+len(other.rules)),
+	}
+
+	i, j := 0, 0
+	for i < len(e.rules) || j < len(other.rules) {
+		if j == len(other.rules) || (i < len(e.rules) && e.rules[i].Priority >= other.rules[j].Priority) {
+			merged.rules = append(merged.rules, e.rules[i])
+			merged.filters = append(merged.filters, e.filters[i])
+			merged.whens = append(merged.whens, e.whens[i])
+			i++
+		} else {
+			merged.rules = append(merged.rules, other.rules[j])
+			merged.filters = append(merged.filters, other.filters[j])
+			merged.whens = append(merged.whens, other.whens[j])
+			j++
+		}
+	}
+
+	return merged
+}
+
+type LDAPScope int
+
+const (
+	ScopeBase LDAPScope = iota
+	ScopeOne
+	ScopeSub
+)
+
+func ParseScope(s string) LDAPScope {
+	switch strings.ToLower(s) {
+	case "base":
+		return ScopeBase
+	case "one":
+		return ScopeOne
+	case "sub":
+		return ScopeSub
+	default:
+		return ScopeSub
+	}
+}
+
+func (s LDAPScope) String() string {
+	switch s {
+	case ScopeBase:
+		return "base"
+	case ScopeOne:
+		return "one"
+	case ScopeSub:
+		return "sub"
+	default:
+		return "sub"
+	}
+}
+
+type SearchRequest struct {
+	BaseDN     string
+	Scope      LDAPScope
+	Filter     string
+	Attributes []string
+	SizeLimit  int64
+	TimeLimit  int64
+	TypesOnly  bool
+	// Controls are the controls the client attached to the request.
+	Controls []RequestControl
+}
+
+func (e *RuleEngine) FindMatchingRule(req SearchRequest) *Rule {
+	reqFilter := parseFilter(req.Filter)
+
+	for i := range e.rules {
+		if e.check(i, req, reqFilter) == noMismatch {
+			return &e.rules[i]
+		}
+	}
+
+	return nil
+}
+
+// RuleEvaluation explains the outcome of one rule for a request.
+type RuleEvaluation struct {
+	RuleID   string `json:"id"`
+	RuleName string `json:"name"`
+	Priority int    `json:"priority"`
+	Matched  bool   `json:"matched"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// Explain evaluates every rule against req in evaluation order. At most one
+// evaluation is Matched: the rule FindMatchingRule returns.
+func (e *RuleEngine) Explain(req SearchRequest) []RuleEvaluation {
+	evaluations := make([]RuleEvaluation, 0, len(e.rules))
+	reqFilter := parseFilter(req.Filter)
+
+	var winner *Rule
+	for i := range e.rules {
+		rule := &e.rules[i]
+
+		eval := RuleEvaluation{
+			RuleID:   rule.ID,
+			RuleName: rule.Name,
+			Priority: rule.Priority,
+			Reason:   e.reason(i, req, reqFilter),
+		}
+
+		switch {
+		case eval.Reason != "":
+		case winner != nil:
+			eval.Reason = "also matches, but rule " + ruleLabel(winner) + " is evaluated first"
+		default:
+			eval.Matched = true
+			winner = rule
+		}
+
+		evaluations = append(evaluations, eval)
+	}
+
+	return evaluations
+}
+
+// mismatch tells why a rule does not match a request. Checks return a
+// mismatch and only Explain formats it, so that FindMatchingRule does not
+// allocate for the rules it skips.
+type mismatch int
+
+const (
+	noMismatch mismatch = iota
+	baseDNMismatch
+	scopeMismatch
+	filterMismatch
+	invalidBaseDNMatch
+	invalidFilterMatch
+	invalidRuleFilter
+	invalidRequestFilter
+	whenMismatch
+	invalidWhenExpr
+	whenExprError
+)
+
+// check returns why rule i does not match req, or noMismatch.
+func (e *RuleEngine) check(i int, req SearchRequest, reqFilter parsedFilter) mismatch {
+	rule := &e.rules[i]
+
+	if rule.BaseDN != "" {
+		switch strings.ToLower(rule.BaseDNMatch) {
+		case "", BaseDNExact:
+			if !strings.EqualFold(rule.BaseDN, req.BaseDN) {
+				return baseDNMismatch
+			}
+		case BaseDNSubtree:
+			if !hasDNSuffix(splitDN(req.BaseDN), splitDN(rule.BaseDN)) {
+				return baseDNMismatch
+			}
+		default:
+			return invalidBaseDNMatch
+		}
+	}
+
+	if rule.Scope != "" && ParseScope(rule.Scope) != req.Scope {
+		return scopeMismatch
+	}
+
+	var match func(rule, req *Filter) bool
+	switch strings.ToLower(rule.FilterMatch) {
+	case "", FilterMatchStructural:
+		match = filtersMatch
+	case FilterMatchSemantic:
+		match = semanticMatch
+	default:
+		return invalidFilterMatch
+	}
+
+	ruleFilter := e.filters[i]
+	if ruleFilter.err != nil {
+		return invalidRuleFilter
+	}
+
+	if reqFilter.err != nil {
+		return invalidRequestFilter
+	}
+
+	if !match(ruleFilter.filter, reqFilter.filter) {
+		return filterMismatch
+	}
+
+	if when := e.whens[i]; when.text != "" {
+		if when.err != nil {
+			return invalidWhenExpr
+		}
+
+		holds, err := evalWhen(when.program, req)
+		if err != nil {
+			return whenExprError
+		}
+		if !holds {
+			return whenMismatch
+		}
+	}
+
+	return noMismatch
+}
+
+// reason describes why rule i does not match req, or returns "" if it
+// matches.
+func (e *RuleEngine) reason(i int, req SearchRequest, reqFilter parsedFilter) string {
+	rule := &e.rules[i]
+
+	switch e.check(i, req, reqFilter) {
+	case baseDNMismatch:
+		if strings.EqualFold(rule.BaseDNMatch, BaseDNSubtree) {
+			return fmt.Sprintf("base DN %q is not within %q", req.BaseDN, rule.BaseDN)
+		}
+		return fmt.Sprintf("base DN %q does not match %q", rule.BaseDN, req.BaseDN)
+	case scopeMismatch:
+		return fmt.Sprintf("scope %s does not match %s", ParseScope(rule.Scope), req.Scope)
+	case filterMismatch:
+		return fmt.Sprintf("filter %s does not match %s", rule.Filter, req.Filter)
+	case invalidBaseDNMatch:
+		return fmt.Sprintf("invalid base_dn_match %q: must be %s or %s", rule.BaseDNMatch, BaseDNExact, BaseDNSubtree)
+	case invalidFilterMatch:
+		return fmt.Sprintf("invalid filter_match %q: must be %s or %s", rule.FilterMatch, FilterMatchStructural, FilterMatchSemantic)
+	case invalidRuleFilter:
+		return fmt.Sprintf("invalid rule filter: %v", e.filters[i].err)
+	case invalidRequestFilter:
+		return fmt.Sprintf("invalid request filter: %v", reqFilter.err)
+	case whenMismatch:
+		return fmt.Sprintf("when_expr %s is false", rule.WhenExpr)
+	case invalidWhenExpr:
+		return fmt.Sprintf("invalid when_expr: %v", e.whens[i].err)
+	case whenExprError:
+		_, err := evalWhen(e.whens[i].program, req)
+		return fmt.Sprintf("when_expr %s failed: %v", rule.WhenExpr, err)
+	default:
+		return ""
+	}
+}
+
+func matchRuleFilter(ruleFilter, reqFilter string) bool {
+	return NewRuleEngine([]Rule{{Filter: ruleFilter}}).FindMatchingRule(SearchRequest{Filter: reqFilter}) != nil
+}
+
+func semanticMatch(rule, req *Filter) bool {
+	return filterImplies(req, rule)
+}
+
+func ruleLabel(rule *Rule) string {
+	switch {
+	case rule.ID != "":
+		return strconv.Quote(rule.ID)
+	case rule.Name != "":
+		return strconv.Quote(rule.Name)
+	default:
+		return "with filter " + rule.Filter
+	}
+}
+
+func filtersMatch(rule, req *Filter) bool {
+	if rule.Type != req.Type {
+		if rule.Type == FilterOr {
+			for _, child := range rule.Children {
+				if filtersMatch(child, req) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if req.Type == FilterAnd {
+			for _, child := range req.Children {
+				if filtersMatch(rule, child) {
+					return true
+				}
+			}
+			return false
+		}
+
+		return false
+	}
+
+	switch rule.Type {
+	case FilterAnd, FilterOr:
+		if len(rule.Children) > len(req.Children) {
+			return false
+		}
+		for _, ruleChild := range rule.Children {
+			found := false
+			for _, reqChild := range req.Children {
+				if filtersMatch(ruleChild, reqChild) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+		return true
+
+	case FilterNot:
+		if len(rule.Children) == 0 || len(req.Children) == 0 {
+			return len(rule.Children) == len(req.Children)
+		}
+		return filtersMatch(rule.Children[0], req.Children[0])
+
+	case FilterEqual, FilterApprox, FilterGreaterOrEqual, FilterLessOrEqual:
+		if !strings.EqualFold(rule.Attr, req.Attr) {
+			return false
+		}
+		if strings.Contains(rule.Value, "*") {
+			return wildcardMatch(rule.Value, req.Value)
+		}
+		return strings.EqualFold(rule.Value, req.Value)
+
+	case FilterExtensible:
+		if !strings.EqualFold(rule.Attr, req.Attr) || rule.MatchingRule != req.MatchingRule ||
+			rule.DNAttributes != req.DNAttributes {
+			return false
+		}
+		if strings.Contains(rule.Value, "*") {
+			return wildcardMatch(rule.Value, req.Value)
+		}
+		return strings.EqualFold(rule.Value, req.Value)
+
+	case FilterPresent:
+		return strings.EqualFold(rule.Attr, req.Attr)
+
+	case FilterSubstring:
+		if !strings.EqualFold(rule.Attr, req.Attr) {
+			return false
+		}
+		if rule.Initial != "" && !strings.EqualFold(rule.Initial, req.Initial) {
+			return false
+		}
+		if rule.Final != "" && !strings.EqualFold(rule.Final, req.Final) {
+			return false
+		}
+		if len(rule.Any) > 0 {
+			if len(rule.Any) != len(req.Any) {
+				return false
+			}
+			for i := range rule.Any {
+				if !strings.EqualFold(rule.Any[i], req.Any[i]) {
+					return false
+				}
+			}
+		}
+		return true
+	}
+
+	return false
+}
+
+// wildcardMatch reports whether str matches pattern, where * matches any run
+// of characters, ignoring case.
+func wildcardMatch(pattern, str string) bool {
+	pattern = strings.ToLower(pattern)
+	str = strings.ToLower(str)
+
+	// On a mismatch, retry from the last * with it matching one more byte.
+	p, s := 0, 0
+	star, next := -1, 0
+	for s < len(str) {
+		switch {
+		case p < len(pattern) && pattern[p] == '*':
+			star, next = p, s
+			p++
+		case p < len(pattern) && pattern[p] == str[s]:
+			p++
+			s++
+		case star >= 0:
+			next++
+			p, s = star+1, next
+		default:
+			return false
+		}
+	}
+
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+
+	return p == len(pattern)
+}
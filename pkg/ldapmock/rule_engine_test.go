@@ -1,6 +1,8 @@
-package main
+package ldapmock
 
 import (
+	"fmt"
+	"reflect"
 	"testing"
 )
 
@@ -171,6 +173,35 @@ func TestFindMatchingRule_BaseDNMatch(t *testing.T) {
 	})
 }
 
+func TestFindMatchingRule_BaseDNSubtree(t *testing.T) {
+	tests := []struct {
+		name      string
+		baseMatch string
+		baseDN    string
+		want      bool
+	}{
+		{name: "same base", baseMatch: BaseDNSubtree, baseDN: "dc=example,dc=com", want: true},
+		{name: "subordinate base", baseMatch: BaseDNSubtree, baseDN: "OU=People, DC=Example,DC=com", want: true},
+		{name: "superior base", baseMatch: BaseDNSubtree, baseDN: "dc=com", want: false},
+		{name: "partial RDN", baseMatch: BaseDNSubtree, baseDN: "dc=myexample,dc=com", want: false},
+		{name: "exact subordinate", baseMatch: BaseDNExact, baseDN: "ou=people,dc=example,dc=com", want: false},
+		{name: "unknown mode", baseMatch: "prefix", baseDN: "dc=example,dc=com", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := NewRuleEngine([]Rule{
+				{Filter: "(cn=John)", BaseDN: "DC=example,DC=com", BaseDNMatch: tt.baseMatch},
+			})
+
+			rule := engine.FindMatchingRule(SearchRequest{BaseDN: tt.baseDN, Filter: "(cn=John)"})
+			if got := rule != nil; got != tt.want {
+				t.Errorf("matched = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestFindMatchingRule_ScopeMatch(t *testing.T) {
 	rules := []Rule{
 		{
@@ -287,6 +318,12 @@ func TestWildcardMatch(t *testing.T) {
 		{"*Doe", "Smith", false},
 		{"J*n*e", "Jane", true},
 		{"J*n*e", "Janine", true},
+		{"J*n*e", "Janina", false},
+		{"*", "", true},
+		{"a*b*c", "aXbYbZc", true},
+		{"j.doe", "J.Doe", true},
+		{"j.doe", "jXdoe", false},
+		{"(admin)*", "(Admin)s", true},
 	}
 
 	for _, tt := range tests {
@@ -312,6 +349,18 @@ func TestFiltersMatch(t *testing.T) {
 			reqFilter:  "(cn=John)",
 			want:       true,
 		},
+		{
+			name:       "extensible match",
+			ruleFilter: "(memberOf:1.2.840.113556.1.4.1941:=*admins*)",
+			reqFilter:  "(memberOf:1.2.840.113556.1.4.1941:=CN=Admins,DC=example)",
+			want:       true,
+		},
+		{
+			name:       "extensible match different rule",
+			ruleFilter: "(memberOf:1.2.840.113556.1.4.1941:=CN=Admins,DC=example)",
+			reqFilter:  "(memberOf=CN=Admins,DC=example)",
+			want:       false,
+		},
 		{
 			name:       "case insensitive attr",
 			ruleFilter: "(cn=John)",
@@ -371,3 +420,123 @@ func TestFiltersMatch(t *testing.T) {
 		})
 	}
 }
+
+func TestFindMatchingRule_FilterMatchMode(t *testing.T) {
+	req := SearchRequest{Filter: "(&(objectClass=person)(|(uid=x)(cn=John)))"}
+
+	tests := []struct {
+		mode string
+		want bool
+	}{
+		{mode: "", want: false},
+		{mode: FilterMatchStructural, want: false},
+		{mode: FilterMatchSemantic, want: true},
+		{mode: "fuzzy", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			engine := NewRuleEngine([]Rule{{Filter: "(|(uid=x)(cn=John)(cn=Jane))", FilterMatch: tt.mode}})
+
+			if got := engine.FindMatchingRule(req) != nil; got != tt.want {
+				t.Errorf("matched = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRuleEngine_Explain(t *testing.T) {
+	engine := NewRuleEngine([]Rule{
+		{ID: "admins", Filter: "(memberOf=cn=admins)", Priority: 10},
+		{ID: "other-base", Filter: "(uid=*)", BaseDN: "ou=other", Priority: 5},
+		{ID: "base-scope", Filter: "(uid=*)", Scope: "base", Priority: 3},
+		{ID: "john-first", Filter: "(uid=john)", Priority: 2},
+		{ID: "john", Filter: "(uid=john)", Priority: 1},
+	})
+
+	evals := engine.Explain(SearchRequest{BaseDN: "dc=example", Scope: ScopeSub, Filter: "(uid=john)"})
+
+	want := []struct {
+		id      string
+		matched bool
+		reason  string
+	}{
+		{"admins", false, "filter (memberOf=cn=admins) does not match (uid=john)"},
+		{"other-base", false, `base DN "ou=other" does not match "dc=example"`},
+		{"base-scope", false, "scope base does not match sub"},
+		{"john-first", true, ""},
+		{"john", false, `also matches, but rule "john-first" is evaluated first`},
+	}
+
+	if len(evals) != len(want) {
+		t.Fatalf("evaluations = %d, want %d", len(evals), len(want))
+	}
+
+	for i, w := range want {
+		got := evals[i]
+		if got.RuleID != w.id || got.Matched != w.matched || got.Reason != w.reason {
+			t.Errorf("evaluation %d = %+v, want id=%s matched=%v reason=%q", i, got, w.id, w.matched, w.reason)
+		}
+	}
+}
+
+func TestRuleEngine_Merge(t *testing.T) {
+	var rules []Rule
+	for i := 0; i < 20; i++ {
+		rules = append(rules, Rule{ID: fmt.Sprintf("mock-%d", i), Filter: "(uid=*)", Priority: i % 2})
+	}
+
+	engine := NewRuleEngine(rules).merge(NewRuleEngine([]Rule{
+		{ID: "extra-low", Filter: "(uid=*)", Priority: 0},
+		{ID: "extra-high", Filter: "(uid=*)", Priority: 5},
+		{ID: "extra-one", Filter: "(uid=*)", Priority: 1},
+	}))
+
+	var got []string
+	for _, rule := range engine.rules {
+		got = append(got, rule.ID)
+	}
+
+	want := []string{"extra-high"}
+	for _, priority := range []int{1, 0} {
+		for i := priority; i < 20; i += 2 {
+			want = append(want, fmt.Sprintf("mock-%d", i))
+		}
+		if priority == 1 {
+			want = append(want, "extra-one")
+		} else {
+			want = append(want, "extra-low")
+		}
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("order = %v, want %v", got, want)
+	}
+
+	for i, rule := range engine.rules {
+		if engine.filters[i].text != rule.Filter || engine.filters[i].filter == nil {
+			t.Errorf("filter %d = %+v, want parsed %s", i, engine.filters[i], rule.Filter)
+		}
+	}
+}
+
+func BenchmarkFindMatchingRule(b *testing.B) {
+	rules := make([]Rule, 0, 200)
+	for i := 0; i < 200; i++ {
+		rules = append(rules, Rule{
+			ID:     fmt.Sprintf("rule-%d", i),
+			Filter: fmt.Sprintf("(&(objectClass=person)(sAMAccountName=user%d*))", i),
+		})
+	}
+
+	engine := NewRuleEngine(rules)
+	req := SearchRequest{Scope: ScopeSub, Filter: "(&(objectClass=person)(sAMAccountName=user199*)(mail=*))"}
+
+	b.ReportAllocs()
+
+	for b.Loop() {
+		if engine.FindMatchingRule(req) == nil {
+			b.Fatal("no rule matched")
+		}
+	}
+}
@@ -0,0 +1,511 @@
+package ldapmock
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"go.uber.org/zap"
+)
+
+// RuntimeConfig holds the settings that can be changed while the server
+// runs, as returned by GET /config. POST /config takes the same layout;
+// sections and fields left out keep their current values.
+type RuntimeConfig struct {
+	Capture            *CaptureConfig      `json:"capture,omitempty"`
+	Chaos              *ChaosConfig        `json:"chaos,omitempty"`
+	RateLimit          *RateLimitConfig    `json:"rate_limit,omitempty"`
+	ReadOnly           *ReadOnlyConfig     `json:"read_only,omitempty"`
+	Debug              *DebugConfig        `json:"debug,omitempty"`
+	ResponseFormat     *ResponseFormat     `json:"response_format,omitempty"`
+	UI                 *UIConfig           `json:"ui,omitempty"`
+	RequestLogSampling *RequestLogSampling `json:"request_log_sampling,omitempty"`
+	MockDecoding       *MockDecoding       `json:"mock_decoding,omitempty"`
+}
+
+// CaptureController is implemented by mock holders that can capture LDAP
+// traffic, as used by /config.
+type CaptureController interface {
+	Capture() CaptureConfig
+	SetCapture(cfg CaptureConfig) error
+}
+
+// ChaosController is implemented by mock holders that can inject failures,
+// as used by /config.
+type ChaosController interface {
+	Chaos() ChaosConfig
+	SetChaos(cfg ChaosConfig) error
+}
+
+// RateLimitController is implemented by mock holders that can limit the
+// request rate of clients, as used by /config.
+type RateLimitController interface {
+	RateLimit() RateLimitConfig
+	SetRateLimit(cfg RateLimitConfig) error
+}
+
+// ReadOnlyController is implemented by mock holders that can refuse writes,
+// as used by /config.
+type ReadOnlyController interface {
+	ReadOnly() ReadOnlyConfig
+	SetReadOnly(cfg ReadOnlyConfig) error
+}
+
+// DebugController is implemented by mock holders that can add debug output
+// to search responses, as used by /config.
+type DebugController interface {
+	Debug() DebugConfig
+	SetDebug(cfg DebugConfig) error
+}
+
+// ResponseFormatController is implemented by mock holders whose encoding of
+// search result entries can change, as used by /config.
+type ResponseFormatController interface {
+	ResponseFormat() ResponseFormat
+	SetResponseFormat(format ResponseFormat) error
+}
+
+// RequestLogSamplingController is implemented by mock holders that can
+// sample the request log, as used by /config.
+type RequestLogSamplingController interface {
+	RequestLogSampling() RequestLogSampling
+	SetRequestLogSampling(cfg RequestLogSampling) error
+}
+
+// OutageController is implemented by mock holders that can simulate an
+// outage, as used by /chaos/outage.
+type OutageController interface {
+	Outage() Outage
+	SetOutage(enabled bool, mode string, duration time.Duration) error
+}
+
+// ClockController is implemented by mock holders with a controllable clock,
+// as used by /time.
+type ClockController interface {
+	Clock() ClockState
+	// SetClock moves the clock to at, unless at is zero, freezes or
+	// unfreezes it when freeze is not nil, then advances it by advance.
+	SetClock(at time.Time, freeze *bool, advance time.Duration) error
+	// ResetClock returns to the wall clock.
+	ResetClock()
+}
+
+func (s *MockServer) runtimeConfig() RuntimeConfig {
+	var cfg RuntimeConfig
+
+	if ctrl, ok := s.mockHolder.(CaptureController); ok {
+		capture := ctrl.Capture()
+		cfg.Capture = &capture
+	}
+
+	if ctrl, ok := s.mockHolder.(ChaosController); ok {
+		chaos := ctrl.Chaos()
+		cfg.Chaos = &chaos
+	}
+
+	if ctrl, ok := s.mockHolder.(RateLimitController); ok {
+		rateLimit := ctrl.RateLimit()
+		cfg.RateLimit = &rateLimit
+	}
+
+	if ctrl, ok := s.mockHolder.(ReadOnlyController); ok {
+		readOnly := ctrl.ReadOnly()
+		cfg.ReadOnly = &readOnly
+	}
+
+	if ctrl, ok := s.mockHolder.(DebugController); ok {
+		debug := ctrl.Debug()
+		cfg.Debug = &debug
+	}
+
+	if ctrl, ok := s.mockHolder.(ResponseFormatController); ok {
+		format := ctrl.ResponseFormat()
+		cfg.ResponseFormat = &format
+	}
+
+	ui := s.UI()
+	cfg.UI = &ui
+
+	if ctrl, ok := s.mockHolder.(RequestLogSamplingController); ok {
+		sampling := ctrl.RequestLogSampling()
+		cfg.RequestLogSampling = &sampling
+	}
+
+	decoding := s.MockDecoding()
+	cfg.MockDecoding = &decoding
+
+	return cfg
+}
+
+func (s *MockServer) getConfig(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	s.writeConfig(w)
+}
+
+func (s *MockServer) updateConfig(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	defer func() { _ = r.Body.Close() }()
+
+	var body struct {
+		Capture            json.RawMessage `json:"capture"`
+		Chaos              json.RawMessage `json:"chaos"`
+		RateLimit          json.RawMessage `json:"rate_limit"`
+		ReadOnly           json.RawMessage `json:"read_only"`
+		Debug              json.RawMessage `json:"debug"`
+		ResponseFormat     json.RawMessage `json:"response_format"`
+		UI                 json.RawMessage `json:"ui"`
+		RequestLogSampling json.RawMessage `json:"request_log_sampling"`
+		MockDecoding       json.RawMessage `json:"mock_decoding"`
+	}
+
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(fmt.Sprintf("decode config: %v", err)))
+		return
+	}
+
+	if body.Capture != nil {
+		ctrl, ok := s.mockHolder.(CaptureController)
+		if !ok {
+			w.WriteHeader(http.StatusNotImplemented)
+			_, _ = w.Write([]byte("capture is not supported"))
+			return
+		}
+
+		capture := ctrl.Capture()
+		if err := decodeStrict(body.Capture, &capture); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(fmt.Sprintf("decode capture: %v", err)))
+			return
+		}
+
+		if err := ctrl.SetCapture(capture); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(err.Error()))
+			return
+		}
+
+		s.log.Info("capture updated", zap.Bool("enabled", capture.Enabled), zap.String("format", capture.Format))
+	}
+
+	if body.Chaos != nil {
+		ctrl, ok := s.mockHolder.(ChaosController)
+		if !ok {
+			w.WriteHeader(http.StatusNotImplemented)
+			_, _ = w.Write([]byte("chaos is not supported"))
+			return
+		}
+
+		chaos := ctrl.Chaos()
+		if err := decodeStrict(body.Chaos, &chaos); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(fmt.Sprintf("decode chaos: %v", err)))
+			return
+		}
+
+		if err := ctrl.SetChaos(chaos); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(err.Error()))
+			return
+		}
+
+		s.log.Info("chaos updated", zap.Float64("bind_failure_ratio", chaos.BindFailureRatio),
+			zap.Uint16("bind_failure_code", chaos.BindFailureCode), zap.Int("max_concurrent_searches", chaos.MaxConcurrentSearches))
+	}
+
+	if body.RateLimit != nil {
+		ctrl, ok := s.mockHolder.(RateLimitController)
+		if !ok {
+			w.WriteHeader(http.StatusNotImplemented)
+			_, _ = w.Write([]byte("rate limiting is not supported"))
+			return
+		}
+
+		rateLimit := ctrl.RateLimit()
+		if err := decodeStrict(body.RateLimit, &rateLimit); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(fmt.Sprintf("decode rate_limit: %v", err)))
+			return
+		}
+
+		if err := ctrl.SetRateLimit(rateLimit); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(err.Error()))
+			return
+		}
+
+		s.log.Info("rate limit updated", zap.Float64("requests_per_second", rateLimit.RequestsPerSecond),
+			zap.Int("burst", rateLimit.Burst), zap.String("action", rateLimit.Action))
+	}
+
+	if body.ReadOnly != nil {
+		ctrl, ok := s.mockHolder.(ReadOnlyController)
+		if !ok {
+			w.WriteHeader(http.StatusNotImplemented)
+			_, _ = w.Write([]byte("read-only mode is not supported"))
+			return
+		}
+
+		readOnly := ctrl.ReadOnly()
+		if err := decodeStrict(body.ReadOnly, &readOnly); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(fmt.Sprintf("decode read_only: %v", err)))
+			return
+		}
+
+		if err := ctrl.SetReadOnly(readOnly); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(err.Error()))
+			return
+		}
+
+		s.log.Info("read-only mode updated", zap.Bool("enabled", readOnly.Enabled))
+	}
+
+	if body.Debug != nil {
+		ctrl, ok := s.mockHolder.(DebugController)
+		if !ok {
+			w.WriteHeader(http.StatusNotImplemented)
+			_, _ = w.Write([]byte("debug output is not supported"))
+			return
+		}
+
+		debug := ctrl.Debug()
+		if err := decodeStrict(body.Debug, &debug); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(fmt.Sprintf("decode debug: %v", err)))
+			return
+		}
+
+		if err := ctrl.SetDebug(debug); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(err.Error()))
+			return
+		}
+
+		s.log.Info("debug output updated", zap.Bool("rule_attribute", debug.RuleAttribute),
+			zap.Bool("response_control", debug.ResponseControl))
+	}
+
+	if body.ResponseFormat != nil {
+		ctrl, ok := s.mockHolder.(ResponseFormatController)
+		if !ok {
+			w.WriteHeader(http.StatusNotImplemented)
+			_, _ = w.Write([]byte("the response format cannot be changed"))
+			return
+		}
+
+		format := ctrl.ResponseFormat()
+		if err := decodeStrict(body.ResponseFormat, &format); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(fmt.Sprintf("decode response_format: %v", err)))
+			return
+		}
+
+		if err := ctrl.SetResponseFormat(format); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(err.Error()))
+			return
+		}
+
+		s.log.Info("response format updated", zap.Bool("sort_attributes", format.SortAttributes),
+			zap.String("attribute_names", format.AttributeNames))
+	}
+
+	if body.RequestLogSampling != nil {
+		ctrl, ok := s.mockHolder.(RequestLogSamplingController)
+		if !ok {
+			w.WriteHeader(http.StatusNotImplemented)
+			_, _ = w.Write([]byte("request log sampling is not supported"))
+			return
+		}
+
+		sampling := ctrl.RequestLogSampling()
+		if err := decodeStrict(body.RequestLogSampling, &sampling); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(fmt.Sprintf("decode request_log_sampling: %v", err)))
+			return
+		}
+
+		if err := ctrl.SetRequestLogSampling(sampling); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(err.Error()))
+			return
+		}
+
+		s.log.Info("request log sampling updated", zap.Int("rate", sampling.Rate))
+	}
+
+	if body.UI != nil {
+		ui := s.UI()
+		if err := decodeStrict(body.UI, &ui); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(fmt.Sprintf("decode ui: %v", err)))
+			return
+		}
+
+		if err := s.SetUI(ui); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(err.Error()))
+			return
+		}
+
+		s.log.Info("UI updated", zap.Bool("disabled", ui.Disabled), zap.String("assets_dir", ui.AssetsDir))
+	}
+
+	if body.MockDecoding != nil {
+		decoding := s.MockDecoding()
+		if err := decodeStrict(body.MockDecoding, &decoding); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(fmt.Sprintf("decode mock_decoding: %v", err)))
+			return
+		}
+
+		s.SetMockDecoding(decoding)
+		s.log.Info("mock decoding updated", zap.Bool("strict", decoding.Strict))
+	}
+
+	s.writeConfig(w)
+}
+
+func (s *MockServer) getOutage(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	ctrl, ok := s.mockHolder.(OutageController)
+	if !ok {
+		w.WriteHeader(http.StatusNotImplemented)
+		_, _ = w.Write([]byte("outages are not supported"))
+		return
+	}
+
+	s.writeOutage(w, ctrl.Outage())
+}
+
+func (s *MockServer) updateOutage(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	defer func() { _ = r.Body.Close() }()
+
+	ctrl, ok := s.mockHolder.(OutageController)
+	if !ok {
+		w.WriteHeader(http.StatusNotImplemented)
+		_, _ = w.Write([]byte("outages are not supported"))
+		return
+	}
+
+	var body struct {
+		Enabled  bool     `json:"enabled"`
+		Mode     string   `json:"mode"`
+		Duration Duration `json:"duration"`
+	}
+
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(fmt.Sprintf("decode outage: %v", err)))
+		return
+	}
+
+	if err := ctrl.SetOutage(body.Enabled, body.Mode, time.Duration(body.Duration)); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+
+	outage := ctrl.Outage()
+	if outage.Enabled {
+		s.log.Warn("outage started", zap.String("mode", outage.Mode), zap.Stringer("duration", body.Duration))
+	} else {
+		s.log.Info("outage ended")
+	}
+
+	s.writeOutage(w, outage)
+}
+
+func (s *MockServer) writeOutage(w http.ResponseWriter, outage Outage) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(outage); err != nil {
+		s.log.Warn("encode outage", zap.Error(err))
+	}
+}
+
+func (s *MockServer) getTime(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	ctrl, ok := s.mockHolder.(ClockController)
+	if !ok {
+		w.WriteHeader(http.StatusNotImplemented)
+		_, _ = w.Write([]byte("the clock cannot be controlled"))
+		return
+	}
+
+	s.writeClock(w, ctrl.Clock())
+}
+
+// updateTime resets the clock, moves it to time, freezes or unfreezes it and
+// advances it, in that order, as the body asks.
+func (s *MockServer) updateTime(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	defer func() { _ = r.Body.Close() }()
+
+	ctrl, ok := s.mockHolder.(ClockController)
+	if !ok {
+		w.WriteHeader(http.StatusNotImplemented)
+		_, _ = w.Write([]byte("the clock cannot be controlled"))
+		return
+	}
+
+	var body struct {
+		Reset   bool      `json:"reset"`
+		Time    time.Time `json:"time"`
+		Freeze  *bool     `json:"freeze"`
+		Advance Duration  `json:"advance"`
+	}
+
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(fmt.Sprintf("decode time: %v", err)))
+		return
+	}
+
+	if body.Reset {
+		ctrl.ResetClock()
+	}
+
+	if err := ctrl.SetClock(body.Time, body.Freeze, time.Duration(body.Advance)); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+
+	clock := ctrl.Clock()
+	s.log.Info("clock updated", zap.Time("now", clock.Now), zap.Bool("frozen", clock.Frozen))
+
+	s.writeClock(w, clock)
+}
+
+func (s *MockServer) writeClock(w http.ResponseWriter, clock ClockState) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(clock); err != nil {
+		s.log.Warn("encode clock", zap.Error(err))
+	}
+}
+
+func (s *MockServer) writeConfig(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(s.runtimeConfig()); err != nil {
+		s.log.Warn("encode config", zap.Error(err))
+	}
+}
+
+func decodeStrict(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	return dec.Decode(v)
+}
@@ -0,0 +1,223 @@
+package ldapmock
+
+import (
+	"bytes"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// SASL mechanisms accepted by the SPNEGO stub.
+const (
+	MechanismGSSSPNEGO = "GSS-SPNEGO"
+	MechanismGSSAPI    = "GSSAPI"
+)
+
+// SPNEGOConfig makes the server accept SASL GSS-SPNEGO and GSSAPI binds
+// without validating any Kerberos ticket, so clients hard-coded to
+// integrated authentication can complete the handshake in tests.
+//
+// Kerberos tokens are accepted at once; their client principal is encrypted,
+// so the bind is made as Identity. NTLM tokens wrapped in SPNEGO get a
+// challenge, then the user of the NTLM authenticate message is mapped to the
+// mock user whose sAMAccountName or userPrincipalName matches, falling back
+// to Identity.
+type SPNEGOConfig struct {
+	Enabled  bool   `json:"enabled"`
+	Identity string `json:"identity"`
+}
+
+// SetSPNEGO switches the SPNEGO stub. It can be called while serving.
+func (s *LDAPServer) SetSPNEGO(cfg SPNEGOConfig) error {
+	s.spnegoMu.Lock()
+	defer s.spnegoMu.Unlock()
+
+	s.spnego = cfg
+
+	return nil
+}
+
+// SPNEGO returns the current SPNEGO stub settings.
+func (s *LDAPServer) SPNEGO() SPNEGOConfig {
+	s.spnegoMu.RLock()
+	defer s.spnegoMu.RUnlock()
+
+	return s.spnego
+}
+
+// Object identifiers of the mechanisms negotiated by SPNEGO.
+var (
+	oidKerberos = asn1.ObjectIdentifier{1, 2, 840, 113554, 1, 2, 2}
+	oidNTLM     = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 2, 10}
+)
+
+// SPNEGO negotiation states (RFC 4178).
+const (
+	negAcceptCompleted  = 0
+	negAcceptIncomplete = 1
+)
+
+var ntlmSignature = []byte("NTLMSSP\x00")
+
+// saslBind answers a SASL bind: the identity the bind is made as, the server
+// credentials to return and the result, saslBindInProgress(14) while an NTLM
+// handshake goes on.
+func (s *LDAPServer) saslBind(req BindRequest) (string, []byte, error) {
+	cfg := s.SPNEGO()
+	if !cfg.Enabled || (req.Mechanism != MechanismGSSSPNEGO && req.Mechanism != MechanismGSSAPI) {
+		return req.DN, nil, ldap.NewError(ldap.LDAPResultAuthMethodNotSupported,
+			fmt.Errorf("SASL mechanism %q is not supported", req.Mechanism))
+	}
+
+	i := bytes.Index(req.Credentials, ntlmSignature)
+	if req.Mechanism == MechanismGSSAPI || i < 0 {
+		// A Kerberos AP-REQ, or the empty token that ends a GSSAPI exchange.
+		var creds []byte
+		if req.Mechanism == MechanismGSSSPNEGO {
+			creds = negTokenResp(negAcceptCompleted, oidKerberos, nil)
+		}
+
+		return cfg.Identity, creds, nil
+	}
+
+	msg := req.Credentials[i:]
+	if len(msg) < 12 {
+		return req.DN, nil, ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("truncated NTLM message"))
+	}
+
+	switch binary.LittleEndian.Uint32(msg[8:12]) {
+	case 1: // NEGOTIATE
+		return req.DN, negTokenResp(negAcceptIncomplete, oidNTLM, ntlmChallenge()),
+			ldap.NewError(ldap.LDAPResultSaslBindInProgress, nil)
+	case 3: // AUTHENTICATE
+		user, domain, err := ntlmUser(msg)
+		if err != nil {
+			return req.DN, nil, ldap.NewError(ldap.LDAPResultInvalidCredentials, err)
+		}
+
+		identity := s.principalIdentity(user, domain)
+		if identity == "" {
+			identity = cfg.Identity
+		}
+
+		return identity, negTokenResp(negAcceptCompleted, oidNTLM, nil), nil
+	default:
+		return req.DN, nil, ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("unexpected NTLM message"))
+	}
+}
+
+// principalIdentity returns the DN of the fallback user whose sAMAccountName
+// is user or whose userPrincipalName is user@domain, or "".
+func (s *LDAPServer) principalIdentity(user, domain string) string {
+	mock := s.mock.Load().mock
+	for _, u := range mock.Users {
+		for name, value := range u.Attrs {
+			switch {
+			case strings.EqualFold(name, "sAMAccountName") && strings.EqualFold(value, user),
+				strings.EqualFold(name, "userPrincipalName") && domain != "" && strings.EqualFold(value, user+"@"+domain):
+				return u.CN
+			}
+		}
+	}
+
+	return ""
+}
+
+// negTokenResp encodes an SPNEGO NegTokenResp (RFC 4178) with an optional
+// response token.
+func negTokenResp(state int, mech asn1.ObjectIdentifier, token []byte) []byte {
+	resp := struct {
+		NegState      asn1.Enumerated       `asn1:"explicit,tag:0"`
+		SupportedMech asn1.ObjectIdentifier `asn1:"explicit,tag:1"`
+		ResponseToken []byte                `asn1:"explicit,optional,tag:2"`
+	}{asn1.Enumerated(state), mech, token}
+
+	data, _ := asn1.Marshal(resp)
+	data, _ = asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 1, IsCompound: true, Bytes: data})
+
+	return data
+}
+
+// ntlmChallenge returns an NTLM CHALLENGE message with a fixed server
+// challenge and an empty target information list.
+func ntlmChallenge() []byte {
+	const (
+		headerLen = 48
+		flags     = 0x00000001 | // NEGOTIATE_UNICODE
+			0x00000004 | // REQUEST_TARGET
+			0x00000200 | // NEGOTIATE_NTLM
+			0x00008000 | // NEGOTIATE_ALWAYS_SIGN
+			0x00080000 | // NEGOTIATE_EXTENDED_SESSIONSECURITY
+			0x00800000 // NEGOTIATE_TARGET_INFO
+	)
+
+	targetInfo := []byte{0, 0, 0, 0} // MsvAvEOL
+
+	msg := make([]byte, headerLen, headerLen+len(targetInfo))
+	copy(msg, ntlmSignature)
+	binary.LittleEndian.PutUint32(msg[8:], 2)
+	binary.LittleEndian.PutUint32(msg[16:], headerLen) // empty target name
+	binary.LittleEndian.PutUint32(msg[20:], flags)
+	copy(msg[24:32], "mockchal")
+	binary.LittleEndian.PutUint16(msg[40:], uint16(len(targetInfo)))
+	binary.LittleEndian.PutUint16(msg[42:], uint16(len(targetInfo)))
+	binary.LittleEndian.PutUint32(msg[44:], headerLen)
+
+	return append(msg, targetInfo...)
+}
+
+// ntlmUser returns the user and domain names of an NTLM AUTHENTICATE
+// message.
+func ntlmUser(msg []byte) (user, domain string, err error) {
+	if len(msg) < 64 {
+		return "", "", errors.New("truncated NTLM authenticate message")
+	}
+
+	unicode := binary.LittleEndian.Uint32(msg[60:64])&0x1 != 0
+
+	field := func(at int) (string, error) {
+		length := int(binary.LittleEndian.Uint16(msg[at:]))
+		offset := int(binary.LittleEndian.Uint32(msg[at+4:]))
+		if offset+length > len(msg) {
+			return "", errors.New("NTLM field out of bounds")
+		}
+
+		value := msg[offset : offset+length]
+		if !unicode {
+			return string(value), nil
+		}
+
+		units := make([]uint16, len(value)/2)
+		for i := range units {
+			units[i] = binary.LittleEndian.Uint16(value[2*i:])
+		}
+
+		return string(utf16.Decode(units)), nil
+	}
+
+	if domain, err = field(28); err != nil {
+		return "", "", err
+	}
+	if user, err = field(36); err != nil {
+		return "", "", err
+	}
+
+	return user, domain, nil
+}
+
+// newBindResponse returns a bind response carrying the server SASL
+// credentials, if any.
+func newBindResponse(msgID int64, err error, serverCreds []byte) *ber.Packet {
+	p := newResultPacket(msgID, ldap.ApplicationBindResponse, err)
+	if serverCreds != nil {
+		p.Children[1].AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimitive, 7, string(serverCreds), "Server SASL Credentials"))
+	}
+
+	return p
+}
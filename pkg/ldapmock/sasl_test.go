@@ -0,0 +1,87 @@
+package ldapmock
+
+import (
+	"encoding/asn1"
+	"encoding/binary"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/go-ldap/ldap/v3"
+	"go.uber.org/zap"
+)
+
+// ntlmAuthenticate returns an NTLM AUTHENTICATE message for user in domain,
+// with Unicode strings.
+func ntlmAuthenticate(user, domain string) []byte {
+	encode := func(s string) []byte {
+		units := utf16.Encode([]rune(s))
+		data := make([]byte, 2*len(units))
+		for i, u := range units {
+			binary.LittleEndian.PutUint16(data[2*i:], u)
+		}
+		return data
+	}
+
+	domainData, userData := encode(domain), encode(user)
+
+	msg := make([]byte, 64)
+	copy(msg, ntlmSignature)
+	binary.LittleEndian.PutUint32(msg[8:], 3)
+	binary.LittleEndian.PutUint16(msg[28:], uint16(len(domainData)))
+	binary.LittleEndian.PutUint32(msg[32:], 64)
+	binary.LittleEndian.PutUint16(msg[36:], uint16(len(userData)))
+	binary.LittleEndian.PutUint32(msg[40:], uint32(64+len(domainData)))
+	binary.LittleEndian.PutUint32(msg[60:], 1) // NEGOTIATE_UNICODE
+
+	return append(append(msg, domainData...), userData...)
+}
+
+func TestLDAPServer_SASLBind(t *testing.T) {
+	srv := NewLDAPServer(zap.NewNop(), "0", "", "", nil)
+	srv.SetMock(LDAPMock{Users: []User{
+		{CN: "cn=John,ou=users,dc=corp", Attrs: map[string]string{"sAMAccountName": "john"}},
+	}})
+
+	spnego := BindRequest{Mechanism: MechanismGSSSPNEGO, Credentials: []byte("kerberos-ap-req")}
+	if _, _, err := srv.saslBind(spnego); !ldap.IsErrorWithCode(err, ldap.LDAPResultAuthMethodNotSupported) {
+		t.Fatalf("disabled: err = %v, want authMethodNotSupported", err)
+	}
+
+	_ = srv.SetSPNEGO(SPNEGOConfig{Enabled: true, Identity: "cn=svc,dc=corp"})
+
+	identity, creds, err := srv.saslBind(spnego)
+	if err != nil || identity != "cn=svc,dc=corp" {
+		t.Fatalf("kerberos: identity %q, err %v", identity, err)
+	}
+
+	var resp asn1.RawValue
+	if _, err := asn1.Unmarshal(creds, &resp); err != nil || resp.Class != asn1.ClassContextSpecific || resp.Tag != 1 {
+		t.Errorf("kerberos: server credentials %x are not a NegTokenResp", creds)
+	}
+
+	negotiate := append([]byte("spnego-wrapper"), ntlmSignature...)
+	negotiate = binary.LittleEndian.AppendUint32(negotiate, 1)
+	_, creds, err = srv.saslBind(BindRequest{Mechanism: MechanismGSSSPNEGO, Credentials: negotiate})
+	if !ldap.IsErrorWithCode(err, ldap.LDAPResultSaslBindInProgress) || len(creds) == 0 {
+		t.Fatalf("ntlm negotiate: err %v, credentials %x", err, creds)
+	}
+
+	tests := []struct {
+		user, domain string
+		want         string
+	}{
+		{"JOHN", "CORP", "cn=John,ou=users,dc=corp"},
+		{"jane", "CORP", "cn=svc,dc=corp"},
+	}
+	for _, tt := range tests {
+		authenticate := append([]byte("spnego-wrapper"), ntlmAuthenticate(tt.user, tt.domain)...)
+		identity, _, err := srv.saslBind(BindRequest{Mechanism: MechanismGSSSPNEGO, Credentials: authenticate})
+		if err != nil || identity != tt.want {
+			t.Errorf("ntlm %s\\%s: identity %q, err %v, want %q", tt.domain, tt.user, identity, err, tt.want)
+		}
+	}
+
+	if _, _, err := srv.saslBind(BindRequest{Mechanism: "DIGEST-MD5"}); !ldap.IsErrorWithCode(err, ldap.LDAPResultAuthMethodNotSupported) {
+		t.Errorf("DIGEST-MD5: err = %v, want authMethodNotSupported", err)
+	}
+}
@@ -0,0 +1,195 @@
+package ldapmock
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ScheduledChange mutates the active mock After it was set, so multi-phase
+// scenarios ("the user appears after 30s") run unattended. Users and groups
+// are added to the fallback entries, replacing those with the same DN;
+// removals match DNs in the fallback entries and in every tenant. Rules are
+// removed by ID or name and added after the remaining rules.
+type ScheduledChange struct {
+	After        Duration `yaml:"after" json:"after"`
+	AddUsers     []User   `yaml:"add_users,omitempty" json:"add_users,omitempty"`
+	RemoveUsers  []string `yaml:"remove_users,omitempty" json:"remove_users,omitempty"`
+	AddGroups    []Group  `yaml:"add_groups,omitempty" json:"add_groups,omitempty"`
+	RemoveGroups []string `yaml:"remove_groups,omitempty" json:"remove_groups,omitempty"`
+	AddRules     []Rule   `yaml:"add_rules,omitempty" json:"add_rules,omitempty"`
+	RemoveRules  []string `yaml:"remove_rules,omitempty" json:"remove_rules,omitempty"`
+	// Chaos replaces the injected failures of the server (see SetChaos).
+	Chaos *ChaosConfig `yaml:"chaos,omitempty" json:"chaos,omitempty"`
+}
+
+func (c *ScheduledChange) validate() error {
+	if c.After < 0 {
+		return errors.New("invalid schedule: after must not be negative")
+	}
+
+	if c.Chaos != nil {
+		return c.Chaos.validate()
+	}
+
+	return nil
+}
+
+func (c *ScheduledChange) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain ScheduledChange
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+
+	return c.validate()
+}
+
+func (c *ScheduledChange) UnmarshalJSON(data []byte) error {
+	type plain ScheduledChange
+	if err := json.Unmarshal(data, (*plain)(c)); err != nil {
+		return err
+	}
+
+	return c.validate()
+}
+
+// apply mutates mock; Chaos is applied by the server.
+func (c ScheduledChange) apply(mock *LDAPMock) {
+	removeUsers := func(users []User, dns []string) []User {
+		return slices.DeleteFunc(users, func(user User) bool { return containsDN(dns, user.CN) })
+	}
+	removeGroups := func(groups []Group, dns []string) []Group {
+		return slices.DeleteFunc(groups, func(group Group) bool { return containsDN(dns, group.CN) })
+	}
+	removeRules := func(rules []Rule) []Rule {
+		return slices.DeleteFunc(rules, func(rule Rule) bool {
+			return (rule.ID != "" && slices.Contains(c.RemoveRules, rule.ID)) ||
+				(rule.Name != "" && slices.Contains(c.RemoveRules, rule.Name))
+		})
+	}
+
+	addedUsers := make([]string, len(c.AddUsers))
+	for i, user := range c.AddUsers {
+		addedUsers[i] = user.CN
+	}
+	addedGroups := make([]string, len(c.AddGroups))
+	for i, group := range c.AddGroups {
+		addedGroups[i] = group.CN
+	}
+
+	// The TTL of an added user counts from the change, not from the mock.
+	added := cloneUsers(c.AddUsers)
+	for i := range added {
+		if added[i].ExpiresIn > 0 {
+			added[i].ExpiresIn += c.After
+		}
+	}
+
+	mock.Users = append(removeUsers(mock.Users, slices.Concat(c.RemoveUsers, addedUsers)), added...)
+	mock.Groups = append(removeGroups(mock.Groups, slices.Concat(c.RemoveGroups, addedGroups)), cloneGroups(c.AddGroups)...)
+	mock.Rules = append(removeRules(mock.Rules), cloneRules(c.AddRules)...)
+
+	for i := range mock.Tenants {
+		tenant := &mock.Tenants[i]
+		tenant.Users = removeUsers(tenant.Users, c.RemoveUsers)
+		tenant.Groups = removeGroups(tenant.Groups, c.RemoveGroups)
+		tenant.Rules = removeRules(tenant.Rules)
+	}
+}
+
+func containsDN(dns []string, dn string) bool {
+	return slices.ContainsFunc(dns, func(d string) bool { return strings.EqualFold(d, dn) })
+}
+
+func cloneSchedule(schedule []ScheduledChange) []ScheduledChange {
+	if schedule == nil {
+		return nil
+	}
+
+	clone := make([]ScheduledChange, len(schedule))
+	for i, change := range schedule {
+		clone[i] = ScheduledChange{
+			After:        change.After,
+			AddUsers:     cloneUsers(change.AddUsers),
+			RemoveUsers:  slices.Clone(change.RemoveUsers),
+			AddGroups:    cloneGroups(change.AddGroups),
+			RemoveGroups: slices.Clone(change.RemoveGroups),
+			AddRules:     cloneRules(change.AddRules),
+			RemoveRules:  slices.Clone(change.RemoveRules),
+		}
+		if change.Chaos != nil {
+			chaos := *change.Chaos
+			clone[i].Chaos = &chaos
+		}
+	}
+
+	return clone
+}
+
+// scheduledStep is a change of the current schedule, due at the mock time.
+type scheduledStep struct {
+	at     time.Time
+	change ScheduledChange
+}
+
+// startSchedule drops the steps of the previous mock and schedules those of
+// a mock set at activated. The caller holds setMockMu.
+func (s *LDAPServer) startSchedule(schedule []ScheduledChange, activated time.Time) {
+	s.scheduleSteps = s.scheduleSteps[:0]
+	for _, change := range schedule {
+		s.scheduleSteps = append(s.scheduleSteps, scheduledStep{at: activated.Add(time.Duration(change.After)), change: change})
+	}
+	slices.SortStableFunc(s.scheduleSteps, func(a, b scheduledStep) int { return a.at.Compare(b.at) })
+
+	s.armSchedule()
+}
+
+// runSchedule applies the steps that are due and waits for the next one,
+// after the clock moved or the timer fired.
+func (s *LDAPServer) runSchedule() {
+	s.setMockMu.Lock()
+	defer s.setMockMu.Unlock()
+
+	s.armSchedule()
+}
+
+// armSchedule applies the due steps and sets the timer for the next one. A
+// frozen clock only moves through SetClock, which runs the schedule itself.
+// The caller holds setMockMu.
+func (s *LDAPServer) armSchedule() {
+	if s.scheduleTimer != nil {
+		s.scheduleTimer.Stop()
+		s.scheduleTimer = nil
+	}
+
+	now := s.clock.now()
+	for len(s.scheduleSteps) > 0 && !now.Before(s.scheduleSteps[0].at) {
+		s.applyScheduled(s.scheduleSteps[0].change)
+		s.scheduleSteps = s.scheduleSteps[1:]
+	}
+
+	if len(s.scheduleSteps) == 0 || s.clock.state().Frozen {
+		return
+	}
+
+	s.scheduleTimer = time.AfterFunc(s.scheduleSteps[0].at.Sub(now), s.runSchedule)
+}
+
+// applyScheduled applies change to the current mock. The caller holds
+// setMockMu.
+func (s *LDAPServer) applyScheduled(change ScheduledChange) {
+	snapshot := s.mock.Load()
+	mock := snapshot.mock.Clone()
+	change.apply(&mock)
+	s.swapMock(mock, snapshot.activated)
+
+	if change.Chaos != nil {
+		_ = s.SetChaos(*change.Chaos)
+	}
+
+	s.log.Info("scheduled change applied", zap.Stringer("after", change.After))
+}
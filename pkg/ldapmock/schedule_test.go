@@ -0,0 +1,83 @@
+package ldapmock
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseMock_Schedule(t *testing.T) {
+	mock, err := ParseMockYAML([]byte(`
+schedule:
+  - after: 30s
+    add_users:
+      - cn: uid=jane,dc=example
+        attrs:
+          uid: jane
+    remove_rules: [lookup]
+    chaos:
+      bind_failure_ratio: 0.5
+`))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	want := []ScheduledChange{{
+		After:       Duration(30 * time.Second),
+		AddUsers:    []User{{CN: "uid=jane,dc=example", Attrs: map[string]string{"uid": "jane"}}},
+		RemoveRules: []string{"lookup"},
+		Chaos:       &ChaosConfig{BindFailureRatio: 0.5, BindFailureCode: 49},
+	}}
+	if !reflect.DeepEqual(mock.Schedule, want) {
+		t.Errorf("schedule = %+v, want %+v", mock.Schedule, want)
+	}
+
+	for _, spec := range []string{
+		"schedule:\n  - after: -1s\n",
+		"schedule:\n  - after: soon\n",
+		"schedule:\n  - after: 1s\n    chaos:\n      bind_failure_ratio: 2\n",
+	} {
+		if _, err := ParseMockYAML([]byte(spec)); err == nil {
+			t.Errorf("expected error for %q", spec)
+		}
+	}
+
+	if _, err := ParseMockJSON([]byte(`{"schedule":[{"after":"1s","chaos":{"bind_failure_code":50}}]}`)); err == nil {
+		t.Error("expected error for an invalid chaos code")
+	}
+}
+
+func TestScheduledChange_Apply(t *testing.T) {
+	mock := LDAPMock{
+		Users: []User{
+			{CN: "uid=john,dc=example", Attrs: map[string]string{"uid": "john"}},
+			{CN: "uid=jane,dc=example", Attrs: map[string]string{"uid": "jane"}},
+		},
+		Groups: []Group{{CN: "cn=admins,dc=example"}},
+		Rules:  []Rule{{ID: "a", Filter: "(uid=a)"}, {Name: "b", Filter: "(uid=b)"}},
+		Tenants: []Tenant{{
+			BaseDN: "dc=other",
+			Users:  []User{{CN: "uid=ann,dc=other"}},
+			Rules:  []Rule{{ID: "a", Filter: "(uid=a)"}},
+		}},
+	}
+
+	ScheduledChange{
+		After:        Duration(time.Minute),
+		AddUsers:     []User{{CN: "UID=jane,dc=example", Attrs: map[string]string{"uid": "jane", "mail": "jane@example"}, ExpiresIn: Duration(time.Second)}},
+		RemoveUsers:  []string{"uid=JOHN,dc=example", "uid=ann,dc=other"},
+		RemoveGroups: []string{"cn=admins,dc=example"},
+		AddRules:     []Rule{{ID: "c", Filter: "(uid=c)"}},
+		RemoveRules:  []string{"a", "b"},
+	}.apply(&mock)
+
+	want := LDAPMock{
+		Users:   []User{{CN: "UID=jane,dc=example", Attrs: map[string]string{"uid": "jane", "mail": "jane@example"}, ExpiresIn: Duration(time.Minute + time.Second)}},
+		Groups:  []Group{},
+		Rules:   []Rule{{ID: "c", Filter: "(uid=c)"}},
+		Tenants: []Tenant{{BaseDN: "dc=other", Users: []User{}, Rules: []Rule{}}},
+	}
+	if !reflect.DeepEqual(mock, want) {
+		t.Errorf("mock = %+v, want %+v", mock, want)
+	}
+}
@@ -0,0 +1,133 @@
+package ldapmock
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// MockSchemaID is the $id of the JSON Schema returned by MockSchema.
+const MockSchemaID = "https://github.com/rom8726/ldap-mock/schema.json"
+
+// durationPattern matches the Go duration strings of Duration fields.
+const durationPattern = `^(0|-?(([0-9]+(\.[0-9]*)?|\.[0-9]+)(ns|us|µs|μs|ms|s|m|h))+)$`
+
+// byteRatePattern matches the sizes per second of ByteRate fields.
+const byteRatePattern = `^ *[0-9]+ *([KkMm]?[Bb]) *(/ *[Ss])? *$`
+
+var (
+	durationType        = reflect.TypeFor[Duration]()
+	byteRateType        = reflect.TypeFor[ByteRate]()
+	attributeSyntaxType = reflect.TypeFor[AttributeSyntax]()
+)
+
+// schemaRequired lists the fields of the mock types that must be set, by
+// type and YAML name.
+var schemaRequired = map[reflect.Type][]string{
+	reflect.TypeFor[User]():            {"cn"},
+	reflect.TypeFor[Group]():           {"cn"},
+	reflect.TypeFor[Rule]():            {"filter"},
+	reflect.TypeFor[Tenant]():          {"base_dn"},
+	reflect.TypeFor[ScheduledChange](): {"after"},
+}
+
+// schemaEnums lists the values of the string fields of the mock types that
+// only take a few, by type and YAML name.
+var schemaEnums = map[reflect.Type]map[string][]string{
+	reflect.TypeFor[Rule](): {
+		"scope":         {"base", "one", "sub"},
+		"filter_match":  {FilterMatchStructural, FilterMatchSemantic},
+		"base_dn_match": {BaseDNExact, BaseDNSubtree},
+	},
+}
+
+// MockSchema returns the JSON Schema (draft 2020-12) of the mocks accepted by
+// POST /mock, in YAML or JSON, as served at /schema.json. Editors use it to
+// complete and check fixtures, and CI jobs to validate them. Unknown fields are
+// rejected, so that typos do not go unnoticed.
+func MockSchema() []byte {
+	defs := make(map[string]any)
+	root := schemaObject(reflect.TypeFor[LDAPMock](), defs)
+	root["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	root["$id"] = MockSchemaID
+	root["title"] = "ldap-mock mock"
+	root["$defs"] = defs
+
+	data, _ := json.MarshalIndent(root, "", "  ")
+
+	return data
+}
+
+// schemaObject returns the schema of the struct type t, whose field types
+// are added to defs.
+func schemaObject(t reflect.Type, defs map[string]any) map[string]any {
+	properties := make(map[string]any)
+	for i := range t.NumField() {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if name == "" || name == "-" || !field.IsExported() {
+			continue
+		}
+
+		property := schemaFor(field.Type, defs)
+		if values, ok := schemaEnums[t][name]; ok {
+			property = map[string]any{"type": "string", "enum": values}
+		}
+
+		properties[name] = property
+	}
+
+	object := map[string]any{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	if required, ok := schemaRequired[t]; ok {
+		object["required"] = required
+	}
+
+	return object
+}
+
+// schemaFor returns the schema of values of type t.
+func schemaFor(t reflect.Type, defs map[string]any) map[string]any {
+	switch t {
+	case durationType:
+		return map[string]any{"type": "string", "pattern": durationPattern, "description": "Go duration, e.g. 250ms or 1m30s"}
+	case byteRateType:
+		return map[string]any{"type": "string", "pattern": byteRatePattern, "description": "size per second, e.g. 512B/s, 1KB/s or 2MB/s"}
+	case attributeSyntaxType:
+		values := make([]string, len(knownAttributeSyntaxes))
+		for i, syntax := range knownAttributeSyntaxes {
+			values[i] = string(syntax)
+		}
+		return map[string]any{"type": "string", "enum": values}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return schemaFor(t.Elem(), defs)
+	case reflect.Struct:
+		if _, ok := defs[t.Name()]; !ok {
+			defs[t.Name()] = nil // placeholder against recursive types
+			defs[t.Name()] = schemaObject(t, defs)
+		}
+		return map[string]any{"$ref": "#/$defs/" + t.Name()}
+	case reflect.Slice:
+		return map[string]any{"type": "array", "items": schemaFor(t.Elem(), defs)}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": schemaFor(t.Elem(), defs)}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	default:
+		return map[string]any{}
+	}
+}
@@ -0,0 +1,66 @@
+package ldapmock
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestMockSchema(t *testing.T) {
+	var schema struct {
+		Schema     string                     `json:"$schema"`
+		Properties map[string]json.RawMessage `json:"properties"`
+		Defs       map[string]struct {
+			Properties           map[string]map[string]any `json:"properties"`
+			Required             []string                  `json:"required"`
+			AdditionalProperties *bool                     `json:"additionalProperties"`
+		} `json:"$defs"`
+	}
+	if err := json.Unmarshal(MockSchema(), &schema); err != nil {
+		t.Fatalf("decode schema: %v", err)
+	}
+
+	mockType := reflect.TypeFor[LDAPMock]()
+	for i := range mockType.NumField() {
+		name := yamlName(mockType.Field(i))
+		if _, ok := schema.Properties[name]; !ok {
+			t.Errorf("schema has no property %q", name)
+		}
+	}
+
+	rule := schema.Defs["Rule"]
+	if !slices.Equal(rule.Required, []string{"filter"}) || rule.AdditionalProperties == nil || *rule.AdditionalProperties {
+		t.Errorf("Rule schema = %+v, want filter required and no other property", rule)
+	}
+	if got := rule.Properties["scope"]["enum"]; !reflect.DeepEqual(got, []any{"base", "one", "sub"}) {
+		t.Errorf("scope enum = %v", got)
+	}
+	if got := rule.Properties["response"]["$ref"]; got != "#/$defs/Response" {
+		t.Errorf("response = %v, want a reference to Response", rule.Properties["response"])
+	}
+	if got := schema.Defs["Response"].Properties["max_entries"]["type"]; got != "integer" {
+		t.Errorf("max_entries type = %v, want integer", got)
+	}
+
+	duration := regexp.MustCompile(durationPattern)
+	for value, want := range map[string]bool{"250ms": true, "1m30s": true, "0": true, "1.5h": true, "5": false, "soon": false} {
+		if duration.MatchString(value) != want {
+			t.Errorf("duration pattern matches %q: %v, want %v", value, !want, want)
+		}
+	}
+
+	byteRate := regexp.MustCompile(byteRatePattern)
+	for value, want := range map[string]bool{"512B/s": true, "1KB/s": true, "2mb": true, "fast": false} {
+		if byteRate.MatchString(value) != want {
+			t.Errorf("byte rate pattern matches %q: %v, want %v", value, !want, want)
+		}
+	}
+}
+
+func yamlName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	return name
+}
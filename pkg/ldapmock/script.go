@@ -0,0 +1,103 @@
+package ldapmock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// ScriptRequest is the parsed search a rule script receives.
+type ScriptRequest struct {
+	BaseDN     string   `json:"base_dn"`
+	Scope      string   `json:"scope"`
+	Filter     string   `json:"filter"`
+	Attributes []string `json:"attributes"`
+	SizeLimit  int64    `json:"size_limit"`
+	TimeLimit  int64    `json:"time_limit"`
+	TypesOnly  bool     `json:"types_only"`
+}
+
+// ScriptResult is the answer of a rule script. A non-zero ResultCode ends the
+// search with that code and Message; the entries are only sent along with
+// sizeLimitExceeded(4), which lets a script return one slice of a result.
+type ScriptResult struct {
+	Users      []User  `json:"users"`
+	Groups     []Group `json:"groups"`
+	ResultCode uint16  `json:"result_code"`
+	Message    string  `json:"message"`
+}
+
+// ScriptEngine runs the script of a rule (Rule.Script) for a matched search.
+// Implementations embed a sandboxed interpreter, such as goja or gopher-lua,
+// and must return when ctx is done.
+type ScriptEngine interface {
+	Run(ctx context.Context, script string, req ScriptRequest) (ScriptResult, error)
+}
+
+// ScriptEngineFunc adapts a function to ScriptEngine.
+type ScriptEngineFunc func(ctx context.Context, script string, req ScriptRequest) (ScriptResult, error)
+
+func (f ScriptEngineFunc) Run(ctx context.Context, script string, req ScriptRequest) (ScriptResult, error) {
+	return f(ctx, script, req)
+}
+
+// SetScriptEngine sets the engine running rule scripts; nil removes it, and
+// rules with a script then fail with unwillingToPerform(53). A
+// JSScriptEngine is set by default.
+func (s *LDAPServer) SetScriptEngine(engine ScriptEngine) {
+	s.scriptMu.Lock()
+	defer s.scriptMu.Unlock()
+
+	s.script = engine
+}
+
+// ScriptEngine returns the engine running rule scripts, or nil.
+func (s *LDAPServer) ScriptEngine() ScriptEngine {
+	s.scriptMu.RLock()
+	defer s.scriptMu.RUnlock()
+
+	return s.script
+}
+
+// runScript answers req with the script of rule.
+func (s *LDAPServer) runScript(ctx context.Context, rule *Rule, req SearchRequest) (SearchResult, error) {
+	engine := s.ScriptEngine()
+	if engine == nil {
+		return SearchResult{MatchedRule: rule}, ldap.NewError(ldap.LDAPResultUnwillingToPerform,
+			fmt.Errorf("rule %s has a script, but no script engine is set", ruleLabel(rule)))
+	}
+
+	result, err := engine.Run(ctx, rule.Script, scriptRequest(req))
+
+	return scriptSearchResult(rule, "script", result, err)
+}
+
+func scriptRequest(req SearchRequest) ScriptRequest {
+	return ScriptRequest{
+		BaseDN:     req.BaseDN,
+		Scope:      req.Scope.String(),
+		Filter:     req.Filter,
+		Attributes: req.Attributes,
+		SizeLimit:  req.SizeLimit,
+		TimeLimit:  req.TimeLimit,
+		TypesOnly:  req.TypesOnly,
+	}
+}
+
+// scriptSearchResult is the search result of the run of the script or WASM
+// module (what) of rule.
+func scriptSearchResult(rule *Rule, what string, result ScriptResult, err error) (SearchResult, error) {
+	if err != nil {
+		return SearchResult{MatchedRule: rule}, ldap.NewError(ldap.LDAPResultOther,
+			fmt.Errorf("%s of rule %s: %w", what, ruleLabel(rule), err))
+	}
+
+	searchResult := SearchResult{Users: result.Users, Groups: result.Groups, MatchedRule: rule}
+	if result.ResultCode != ldap.LDAPResultSuccess {
+		return searchResult, ldap.NewError(result.ResultCode, errors.New(result.Message))
+	}
+
+	return searchResult, nil
+}
@@ -0,0 +1,137 @@
+package ldapmock
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// DefaultScriptTimeout is how long a JavaScript rule script may run when
+// JSScriptEngine has no timeout.
+const DefaultScriptTimeout = time.Second
+
+// maxScriptCallStack bounds the recursion of scripts.
+const maxScriptCallStack = 1024
+
+// JSScriptEngine runs rule scripts as JavaScript (ECMAScript 5.1 and most
+// of ES6) with goja. A script is the body of a function of request, the
+// ScriptRequest with its JSON field names, returning the ScriptResult as an
+// object, e.g. return {users: [{cn: "uid=" + request.base_dn}]}. Attribute
+// values must be strings.
+//
+// Each run gets its own runtime, without file system, network or process
+// access. Scripts are interrupted once Timeout has passed, so a loop cannot
+// hold a connection, or when the search is abandoned.
+type JSScriptEngine struct {
+	// Timeout bounds the run time of each script; zero is
+	// DefaultScriptTimeout.
+	Timeout time.Duration
+
+	programs sync.Map // script -> compiledScript
+}
+
+type compiledScript struct {
+	program *goja.Program
+	err     error
+}
+
+// NewJSScriptEngine returns an engine running scripts for at most timeout,
+// or DefaultScriptTimeout when it is zero.
+func NewJSScriptEngine(timeout time.Duration) *JSScriptEngine {
+	return &JSScriptEngine{Timeout: timeout}
+}
+
+// Run runs script for req. Scripts are compiled once.
+func (e *JSScriptEngine) Run(ctx context.Context, script string, req ScriptRequest) (ScriptResult, error) {
+	program, err := e.compile(script)
+	if err != nil {
+		return ScriptResult{}, err
+	}
+
+	timeout := e.Timeout
+	if timeout <= 0 {
+		timeout = DefaultScriptTimeout
+	}
+
+	vm := goja.New()
+	vm.SetFieldNameMapper(goja.TagFieldNameMapper("json", true))
+	vm.SetMaxCallStackSize(maxScriptCallStack)
+
+	timer := time.AfterFunc(timeout, func() { vm.Interrupt(fmt.Errorf("script timed out after %s", timeout)) })
+	defer timer.Stop()
+
+	stop := context.AfterFunc(ctx, func() { vm.Interrupt(ctx.Err()) })
+	defer stop()
+
+	fn, err := vm.RunProgram(program)
+	if err != nil {
+		return ScriptResult{}, scriptError(err)
+	}
+
+	call, ok := goja.AssertFunction(fn)
+	if !ok {
+		return ScriptResult{}, errors.New("script is not a function body")
+	}
+
+	if req.Attributes == nil {
+		req.Attributes = []string{}
+	}
+
+	value, err := call(goja.Undefined(), vm.ToValue(req))
+	if err != nil {
+		return ScriptResult{}, scriptError(err)
+	}
+	if goja.IsUndefined(value) || goja.IsNull(value) {
+		return ScriptResult{}, errors.New("script returned no result")
+	}
+
+	data, err := json.Marshal(value.Export())
+	if err != nil {
+		return ScriptResult{}, fmt.Errorf("script result: %w", err)
+	}
+
+	var result ScriptResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		return ScriptResult{}, fmt.Errorf("script result: %w", err)
+	}
+
+	return result, nil
+}
+
+func (e *JSScriptEngine) compile(script string) (*goja.Program, error) {
+	if compiled, ok := e.programs.Load(script); ok {
+		return compiled.(compiledScript).program, compiled.(compiledScript).err
+	}
+
+	program, err := goja.Compile("script", "(function (request) {\n"+script+"\n})", true)
+	if err != nil {
+		err = fmt.Errorf("compile script: %w", err)
+	}
+
+	e.programs.Store(script, compiledScript{program: program, err: err})
+
+	return program, err
+}
+
+// scriptError unwraps the cause of an interrupted script.
+func scriptError(err error) error {
+	var (
+		interrupted *goja.InterruptedError
+		overflow    *goja.StackOverflowError
+	)
+	switch {
+	case errors.As(err, &interrupted):
+		if cause, ok := interrupted.Value().(error); ok {
+			return cause
+		}
+	case errors.As(err, &overflow):
+		return fmt.Errorf("script exceeded the maximum call stack size of %d", maxScriptCallStack)
+	}
+
+	return err
+}
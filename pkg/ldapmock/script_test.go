@@ -0,0 +1,115 @@
+package ldapmock
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"go.uber.org/zap"
+)
+
+func TestLDAPServer_OnSearch_Script(t *testing.T) {
+	srv := NewLDAPServer(zap.NewNop(), "0", "", "", nil)
+	srv.SetMock(LDAPMock{Rules: []Rule{
+		{ID: "reflect", Filter: "(uid=*)", FilterMatch: FilterMatchSemantic, Script: "reflect"},
+		{ID: "page", Filter: "(cn=*)", FilterMatch: FilterMatchSemantic, Script: "page"},
+		{ID: "broken", Filter: "(mail=*)", FilterMatch: FilterMatchSemantic, Script: "broken"},
+	}})
+
+	search := func(filter string, sizeLimit int64) (SearchResult, error) {
+		return srv.OnSearch(context.Background(), SearchRequest{Filter: filter, Scope: ScopeSub, SizeLimit: sizeLimit})
+	}
+
+	if _, ok := srv.ScriptEngine().(*JSScriptEngine); !ok {
+		t.Errorf("default engine = %T, want *JSScriptEngine", srv.ScriptEngine())
+	}
+
+	srv.SetScriptEngine(nil)
+	if _, err := search("(uid=john)", 0); !ldap.IsErrorWithCode(err, ldap.LDAPResultUnwillingToPerform) {
+		t.Fatalf("without an engine: err = %v, want unwillingToPerform", err)
+	}
+
+	srv.SetScriptEngine(ScriptEngineFunc(func(_ context.Context, script string, req ScriptRequest) (ScriptResult, error) {
+		switch script {
+		case "reflect":
+			return ScriptResult{Users: []User{{CN: "cn=reflected", Attrs: map[string]string{"filter": req.Filter, "scope": req.Scope}}}}, nil
+		case "page":
+			var users []User
+			for i := range req.SizeLimit {
+				users = append(users, User{CN: "cn=user" + strconv.FormatInt(i, 10)})
+			}
+			return ScriptResult{Users: users, ResultCode: ldap.LDAPResultSizeLimitExceeded, Message: "more to come"}, nil
+		default:
+			return ScriptResult{}, errors.New("boom")
+		}
+	}))
+
+	result, err := search("(uid=john)", 0)
+	if err != nil || len(result.Users) != 1 || result.Users[0].Attrs["filter"] != "(uid=john)" || result.Users[0].Attrs["scope"] != "sub" {
+		t.Errorf("reflect: result %+v, err %v", result, err)
+	}
+	if result.MatchedRule == nil || result.MatchedRule.ID != "reflect" {
+		t.Errorf("reflect: matched rule = %v, want reflect", result.MatchedRule)
+	}
+
+	result, err = search("(cn=x)", 3)
+	if !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) || len(result.Users) != 3 {
+		t.Errorf("page: %d users, err %v, want 3 and sizeLimitExceeded", len(result.Users), err)
+	}
+
+	if _, err := search("(mail=x)", 0); !ldap.IsErrorWithCode(err, ldap.LDAPResultOther) {
+		t.Errorf("broken: err = %v, want other", err)
+	}
+}
+
+func TestJSScriptEngine_Run(t *testing.T) {
+	engine := NewJSScriptEngine(50 * time.Millisecond)
+	req := ScriptRequest{BaseDN: "dc=example", Scope: "sub", Filter: "(uid=john)", SizeLimit: 2}
+
+	result, err := engine.Run(context.Background(), `
+		var users = [];
+		for (var i = 0; i < request.size_limit; i++) {
+			users.push({cn: "uid=user" + i + "," + request.base_dn, attrs: {filter: request.filter}});
+		}
+		return {users: users, result_code: 4, message: "more to come"};
+	`, req)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if len(result.Users) != 2 || result.Users[1].CN != "uid=user1,dc=example" || result.Users[1].Attrs["filter"] != "(uid=john)" ||
+		result.ResultCode != ldap.LDAPResultSizeLimitExceeded || result.Message != "more to come" {
+		t.Errorf("result = %+v", result)
+	}
+
+	tests := []struct {
+		name    string
+		script  string
+		wantErr string
+	}{
+		{"syntax", `return {`, "compile script"},
+		{"exception", `throw new Error("boom")`, "boom"},
+		{"no result", `var x = 1;`, "no result"},
+		{"not strings", `return {users: [{cn: "cn=x", attrs: {n: 1}}]}`, "script result"},
+		{"endless loop", `for (;;) {}`, "timed out"},
+		{"deep recursion", `function f() { return f(); } return f();`, "call stack"},
+		{"no host access", `return require("fs")`, "require is not defined"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := engine.Run(context.Background(), tt.script, req); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := NewJSScriptEngine(time.Minute).Run(ctx, `for (;;) {}`, req); !errors.Is(err, context.Canceled) {
+		t.Errorf("abandoned: err = %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,167 @@
+package ldapmock
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// ShadowDiff compares the answer of the mock to a search with the answer of
+// the upstream server, as recorded in the request log in shadow mode.
+type ShadowDiff struct {
+	Equal          bool   `json:"equal"`
+	UpstreamResult string `json:"upstream_result"`
+	UpstreamError  string `json:"upstream_error,omitempty"`
+	// Missing lists the DNs only the upstream server returned.
+	Missing []string `json:"missing,omitempty"`
+	// Unexpected lists the DNs only the mock returned.
+	Unexpected []string    `json:"unexpected,omitempty"`
+	Changed    []EntryDiff `json:"changed,omitempty"`
+}
+
+// EntryDiff lists the attributes of an entry whose values differ.
+type EntryDiff struct {
+	DN         string          `json:"dn"`
+	Attributes []AttributeDiff `json:"attributes"`
+}
+
+type AttributeDiff struct {
+	Name     string   `json:"name"`
+	Mock     []string `json:"mock"`
+	Upstream []string `json:"upstream"`
+}
+
+// SetShadow turns shadow mode on or off. In shadow mode every search the mock
+// answers itself is also sent to the upstream server (see SetUpstream); the
+// mock answer is returned and the differences are recorded in the request log.
+func (s *LDAPServer) SetShadow(enabled bool) {
+	s.shadow.Store(enabled)
+}
+
+func (s *LDAPServer) shadowMiddleware(next SearchFunc) SearchFunc {
+	return func(ctx context.Context, req SearchRequest) (SearchResult, error) {
+		result, err := next(ctx, req)
+
+		upstream := s.Upstream()
+		if upstream == nil || !s.shadow.Load() || result.Upstream {
+			return result, err
+		}
+
+		var mockEntries []Entry
+		if err == nil {
+			mockEntries = resultEntries(result)
+		}
+
+		upstreamEntries, upstreamErr := upstream.Search(ctx, req)
+
+		result.ShadowDiff = diffResults(req, mockEntries, err, upstreamEntries, upstreamErr)
+
+		return result, err
+	}
+}
+
+// diffResults compares entries by DN. Attributes are compared when the mock
+// entry has them or the request asked for them by name, since fixtures
+// usually hold only the attributes a client reads.
+func diffResults(req SearchRequest, mockEntries []Entry, mockErr error, upstreamEntries []Entry, upstreamErr error) *ShadowDiff {
+	diff := &ShadowDiff{
+		UpstreamResult: ldap.LDAPResultCodeMap[resultCode(upstreamErr)],
+	}
+	if upstreamErr != nil {
+		diff.UpstreamError = upstreamErr.Error()
+	}
+
+	upstreamByDN := make(map[string]Entry, len(upstreamEntries))
+	for _, entry := range upstreamEntries {
+		upstreamByDN[strings.ToLower(entry.DN)] = entry
+	}
+
+	mockDNs := make(map[string]bool, len(mockEntries))
+	for _, entry := range mockEntries {
+		key := strings.ToLower(entry.DN)
+		mockDNs[key] = true
+
+		upstreamEntry, ok := upstreamByDN[key]
+		if !ok {
+			diff.Unexpected = append(diff.Unexpected, entry.DN)
+			continue
+		}
+
+		if attrs := diffAttributes(req.Attributes, entry, upstreamEntry); len(attrs) > 0 {
+			diff.Changed = append(diff.Changed, EntryDiff{DN: entry.DN, Attributes: attrs})
+		}
+	}
+
+	for _, entry := range upstreamEntries {
+		if !mockDNs[strings.ToLower(entry.DN)] {
+			diff.Missing = append(diff.Missing, entry.DN)
+		}
+	}
+
+	diff.Equal = resultCode(mockErr) == resultCode(upstreamErr) &&
+		len(diff.Missing) == 0 && len(diff.Unexpected) == 0 && len(diff.Changed) == 0
+
+	return diff
+}
+
+func diffAttributes(requested []string, mockEntry, upstreamEntry Entry) []AttributeDiff {
+	mockAttrs := lowerAttrs(mockEntry.Attrs)
+	upstreamAttrs := lowerAttrs(upstreamEntry.Attrs)
+
+	names := make(map[string]string, len(mockEntry.Attrs)+len(requested))
+	for name := range mockEntry.Attrs {
+		names[strings.ToLower(name)] = name
+	}
+	for _, name := range requested {
+		if name != "*" && name != "+" && name != "1.1" {
+			names[strings.ToLower(name)] = name
+		}
+	}
+
+	keys := make([]string, 0, len(names))
+	for key := range names {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var diffs []AttributeDiff
+	for _, key := range keys {
+		mockValues := sortedValues(mockAttrs[key])
+		upstreamValues := sortedValues(upstreamAttrs[key])
+
+		if !slices.Equal(mockValues, upstreamValues) {
+			diffs = append(diffs, AttributeDiff{Name: names[key], Mock: mockValues, Upstream: upstreamValues})
+		}
+	}
+
+	return diffs
+}
+
+func lowerAttrs(attrs map[string][]string) map[string][]string {
+	lower := make(map[string][]string, len(attrs))
+	for name, values := range attrs {
+		key := strings.ToLower(name)
+		lower[key] = append(lower[key], values...)
+	}
+
+	return lower
+}
+
+func sortedValues(values []string) []string {
+	sorted := make([]string, len(values))
+	copy(sorted, values)
+	sort.Strings(sorted)
+
+	return sorted
+}
+
+// resultEntries returns the entries of result in the order they are sent to
+// the client.
+func resultEntries(result SearchResult) []Entry {
+	entries := make([]Entry, 0, len(result.Users)+len(result.Groups)+len(result.Entries))
+
+	return slices.AppendSeq(entries, result.entries())
+}
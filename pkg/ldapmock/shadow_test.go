@@ -0,0 +1,71 @@
+package ldapmock
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+func TestDiffResults(t *testing.T) {
+	john := Entry{DN: "uid=john,dc=example", Attrs: map[string][]string{"mail": {"john@example.com"}}}
+	jane := Entry{DN: "uid=jane,dc=example", Attrs: map[string][]string{"mail": {"jane@example.com"}}}
+
+	tests := []struct {
+		name        string
+		attributes  []string
+		mock        []Entry
+		mockErr     error
+		upstream    []Entry
+		upstreamErr error
+		want        ShadowDiff
+	}{
+		{
+			name:     "equal",
+			mock:     []Entry{john},
+			upstream: []Entry{{DN: "UID=John,DC=example", Attrs: map[string][]string{"Mail": {"john@example.com"}, "cn": {"John"}}}},
+			want:     ShadowDiff{Equal: true, UpstreamResult: "Success"},
+		},
+		{
+			name:     "missing and unexpected",
+			mock:     []Entry{john},
+			upstream: []Entry{jane},
+			want: ShadowDiff{
+				UpstreamResult: "Success",
+				Missing:        []string{"uid=jane,dc=example"},
+				Unexpected:     []string{"uid=john,dc=example"},
+			},
+		},
+		{
+			name:       "changed and requested attributes",
+			attributes: []string{"cn"},
+			mock:       []Entry{john},
+			upstream:   []Entry{{DN: john.DN, Attrs: map[string][]string{"mail": {"john@corp.example"}, "cn": {"John"}}}},
+			want: ShadowDiff{
+				UpstreamResult: "Success",
+				Changed: []EntryDiff{{DN: john.DN, Attributes: []AttributeDiff{
+					{Name: "cn", Mock: []string{}, Upstream: []string{"John"}},
+					{Name: "mail", Mock: []string{"john@example.com"}, Upstream: []string{"john@corp.example"}},
+				}}},
+			},
+		},
+		{
+			name:        "result code",
+			upstreamErr: ldap.NewError(ldap.LDAPResultNoSuchObject, errors.New("no such object")),
+			want: ShadowDiff{
+				UpstreamResult: "No Such Object",
+				UpstreamError:  `LDAP Result Code 32 "No Such Object": no such object`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := diffResults(SearchRequest{Attributes: tt.attributes}, tt.mock, tt.mockErr, tt.upstream, tt.upstreamErr)
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("diff = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package ldapmock
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// Simulation is the outcome of evaluating a search against a mock without
+// serving it, as returned by POST /simulate.
+type Simulation struct {
+	Tenant      string           `json:"tenant,omitempty"`
+	MatchedRule *MatchedRuleLog  `json:"matched_rule,omitempty"`
+	Rules       []RuleEvaluation `json:"rules"`
+	// Result is the result code the search would end with. It is empty when
+	// the answer is not known without serving it: the matched rule passes
+	// through to the upstream server or runs a script, as Note tells.
+	Result string `json:"result,omitempty"`
+	Note   string `json:"note,omitempty"`
+	// Entries are the entries the search would return, with the attributes
+	// it asked for.
+	Entries  []Entry         `json:"entries"`
+	Response LDAPResponseLog `json:"response"`
+}
+
+// Simulate evaluates req against mock the way the default handler does,
+// explaining every rule, and reads the root DSE for base searches of the
+// empty DN that no rule matches. Nothing is recorded in the request log.
+// Templated responses are rendered with the current time, and every user is
+// live.
+func Simulate(mock LDAPMock, req SearchRequest) Simulation {
+	var sim Simulation
+	if tenant := mock.findTenant(req.BaseDN); tenant != nil {
+		sim.Tenant = tenant.Name
+	}
+
+	users, groups, rules := mock.directoryFor(req.BaseDN)
+	engine := NewRuleEngine(rules)
+	sim.Rules = engine.Explain(req)
+
+	var (
+		result SearchResult
+		err    error
+	)
+	if rule := engine.FindMatchingRule(req); rule != nil {
+		sim.MatchedRule = &MatchedRuleLog{RuleID: rule.ID, RuleName: rule.Name}
+
+		switch {
+		case rule.Script != "":
+			sim.Note = "the rule script computes the entries"
+		case rule.WASM != "":
+			sim.Note = "the rule WASM module computes the entries"
+		case rule.Passthrough:
+			sim.Note = "the search is passed through to the upstream server"
+		case rule.Template:
+			result.Users, result.Groups, err = renderResponse(rule.Response.Users, rule.Response.Groups, newTemplateData(req, time.Now()))
+			if err != nil {
+				err = ldap.NewError(ldap.LDAPResultOther, fmt.Errorf("response of rule %s: %w", ruleLabel(rule), err))
+			}
+		default:
+			result.Users, result.Groups = rule.Response.Users, rule.Response.Groups
+		}
+
+		if err == nil {
+			if result.Users, result.Groups, err = computeEntries(compileComputed(mock.Computed), result.Users, result.Groups); err != nil {
+				err = ldap.NewError(ldap.LDAPResultOther, fmt.Errorf("response of rule %s: %w", ruleLabel(rule), err))
+			}
+		}
+	} else if dse, ok := rootDSEResult(mock, req); ok {
+		result = dse
+	} else {
+		if users, groups, err = filterEntries(users, groups, req.Filter, mock.Attributes); err != nil {
+			err = ldap.NewError(ldap.LDAPResultFilterError, fmt.Errorf("invalid filter %s: %w", req.Filter, err))
+		} else {
+			result, err = fallbackResult(req, users, groups, compileComputed(mock.Computed))
+		}
+	}
+
+	if sim.Note == "" {
+		sim.Result = ldap.LDAPResultCodeMap[resultCode(err)]
+	}
+
+	// As served, failed searches only return entries with sizeLimitExceeded.
+	if err != nil && resultCode(err) != ldap.LDAPResultSizeLimitExceeded {
+		result = SearchResult{}
+	}
+
+	sim.Entries = slices.Collect(result.entries())
+	if sim.Entries == nil {
+		sim.Entries = []Entry{}
+	}
+
+	dns := returnedDNs(result.Users, result.Groups)
+	for _, entry := range result.Entries {
+		dns = append(dns, entry.DN)
+	}
+	sim.Response = LDAPResponseLog{ReturnedDNs: dns, Count: len(dns)}
+
+	return sim
+}
+
+// SimulationRequest is a search to simulate, as accepted by POST /simulate.
+type SimulationRequest struct {
+	BaseDN string `json:"base_dn"`
+	Scope  string `json:"scope"`
+	// Filter defaults to (objectClass=*).
+	Filter     string   `json:"filter"`
+	Attributes []string `json:"attributes,omitempty"`
+	SizeLimit  int64    `json:"size_limit,omitempty"`
+}
+
+func (r SimulationRequest) searchRequest() SearchRequest {
+	filter := r.Filter
+	if filter == "" {
+		filter = "(objectClass=*)"
+	}
+
+	return SearchRequest{
+		BaseDN:     r.BaseDN,
+		Scope:      ParseScope(r.Scope),
+		Filter:     filter,
+		Attributes: r.Attributes,
+		SizeLimit:  r.SizeLimit,
+	}
+}
+
+// BatchSimulation is the outcome of simulating many searches, as returned by
+// POST /simulate/batch: one row per search, in order.
+type BatchSimulation struct {
+	Rows      []BatchSimulationRow `json:"rows"`
+	Matched   int                  `json:"matched"`
+	Unmatched int                  `json:"unmatched"`
+}
+
+type BatchSimulationRow struct {
+	Request     SimulationRequest `json:"request"`
+	Tenant      string            `json:"tenant,omitempty"`
+	MatchedRule *MatchedRuleLog   `json:"matched_rule"`
+	Result      string            `json:"result,omitempty"`
+	Note        string            `json:"note,omitempty"`
+	Count       int               `json:"count"`
+}
+
+// SimulateBatch simulates every search of reqs against mock, so that a
+// refactored rule set can be checked against many searches in one call.
+func SimulateBatch(mock LDAPMock, reqs []SimulationRequest) BatchSimulation {
+	batch := BatchSimulation{Rows: make([]BatchSimulationRow, 0, len(reqs))}
+
+	for _, req := range reqs {
+		sim := Simulate(mock, req.searchRequest())
+
+		batch.Rows = append(batch.Rows, BatchSimulationRow{
+			Request:     req,
+			Tenant:      sim.Tenant,
+			MatchedRule: sim.MatchedRule,
+			Result:      sim.Result,
+			Note:        sim.Note,
+			Count:       sim.Response.Count,
+		})
+
+		if sim.MatchedRule != nil {
+			batch.Matched++
+		} else {
+			batch.Unmatched++
+		}
+	}
+
+	return batch
+}
+
+// loggedSearches returns the searches of logs, newest first as returned by
+// RequestLogger.List, as simulation requests, oldest first.
+func loggedSearches(logs []LDAPRequestLog) []SimulationRequest {
+	var reqs []SimulationRequest
+	for _, entry := range slices.Backward(logs) {
+		if entry.Type == "search" {
+			reqs = append(reqs, SimulationRequest{
+				BaseDN:     entry.BaseDN,
+				Scope:      entry.Scope,
+				Filter:     entry.Filter,
+				Attributes: entry.Attributes,
+			})
+		}
+	}
+
+	return reqs
+}
+
+func returnedDNs(users []User, groups []Group) []string {
+	dns := make([]string, 0, len(users)+len(groups))
+	for _, user := range users {
+		dns = append(dns, user.CN)
+	}
+	for _, group := range groups {
+		dns = append(dns, group.CN)
+	}
+
+	return dns
+}
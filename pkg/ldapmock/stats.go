@@ -0,0 +1,341 @@
+package ldapmock
+
+import (
+	"cmp"
+	"context"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// RuleStats counts the searches a rule answered. Rules are identified by ID,
+// then name, then filter.
+type RuleStats struct {
+	RuleID      string     `json:"id"`
+	RuleName    string     `json:"name"`
+	Filter      string     `json:"filter"`
+	Hits        int        `json:"hits"`
+	LastMatched *time.Time `json:"last_matched,omitempty"`
+}
+
+// Stats summarizes the searches served since the mock was last set, as
+// returned by GET /stats.
+type Stats struct {
+	Searches int `json:"searches"`
+	Matched  int `json:"matched"`
+	Fallback int `json:"fallback"`
+	Failed   int `json:"failed"`
+	// Empty counts the searches that succeeded without returning entries.
+	Empty int         `json:"empty"`
+	Rules []RuleStats `json:"rules"`
+	// Latency holds the response time histograms by rule and result.
+	Latency []LatencyHistogram `json:"latency"`
+}
+
+// EmptySearch counts the searches with one filter that succeeded without
+// returning entries, as listed by GET /requests/empty.
+type EmptySearch struct {
+	Filter string `json:"filter"`
+	Count  int    `json:"count"`
+	// LastBaseDN is the base DN of the last of these searches.
+	LastBaseDN string    `json:"last_base_dn"`
+	LastSeen   time.Time `json:"last_seen"`
+}
+
+// EmptySearchProvider is implemented by mock holders that track the filters
+// of empty searches, as used by GET /requests/empty.
+type EmptySearchProvider interface {
+	EmptySearches() []EmptySearch
+}
+
+// StatsProvider is implemented by mock holders that collect search
+// statistics, as used by GET /stats and GET /mock/coverage.
+type StatsProvider interface {
+	Stats() Stats
+}
+
+type searchStats struct {
+	mu       sync.Mutex
+	searches int
+	matched  int
+	fallback int
+	failed   int
+	rules    map[string]*RuleStats
+	order    []string
+	// empty holds the empty searches by filter.
+	empty      map[string]*EmptySearch
+	emptyCount int
+	latency    map[latencyKey]*latencyHistogram
+}
+
+func (st *searchStats) record(req SearchRequest, rule *Rule, entries int, err error, now time.Time) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.searches++
+
+	if err == nil && entries == 0 {
+		st.emptyCount++
+
+		if st.empty == nil {
+			st.empty = make(map[string]*EmptySearch)
+		}
+
+		es, ok := st.empty[req.Filter]
+		if !ok {
+			es = &EmptySearch{Filter: req.Filter}
+			st.empty[req.Filter] = es
+		}
+
+		es.Count++
+		es.LastBaseDN, es.LastSeen = req.BaseDN, now
+	}
+
+	switch {
+	case err != nil:
+		st.failed++
+		return
+	case rule == nil:
+		st.fallback++
+		return
+	}
+
+	st.matched++
+
+	key := ruleKey(rule)
+	if st.rules == nil {
+		st.rules = make(map[string]*RuleStats)
+	}
+
+	rs, ok := st.rules[key]
+	if !ok {
+		rs = &RuleStats{RuleID: rule.ID, RuleName: rule.Name, Filter: rule.Filter}
+		st.rules[key] = rs
+		st.order = append(st.order, key)
+	}
+
+	rs.Hits++
+	rs.LastMatched = &now
+}
+
+// observeLatency adds the response time d of a search answered by rule, nil
+// when none matched, with err to the latency histograms.
+func (st *searchStats) observeLatency(rule *Rule, err error, d time.Duration) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	key := latencyKey{rule: latencyRuleLabel(rule), result: ldap.LDAPResultCodeMap[resultCode(err)]}
+	if st.latency == nil {
+		st.latency = make(map[latencyKey]*latencyHistogram)
+	}
+
+	h, ok := st.latency[key]
+	if !ok {
+		h = &latencyHistogram{}
+		st.latency[key] = h
+	}
+
+	h.observe(d)
+}
+
+func (st *searchStats) snapshot() Stats {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	stats := Stats{
+		Searches: st.searches,
+		Matched:  st.matched,
+		Fallback: st.fallback,
+		Failed:   st.failed,
+		Empty:    st.emptyCount,
+		Rules:    make([]RuleStats, 0, len(st.order)),
+		Latency:  make([]LatencyHistogram, 0, len(st.latency)),
+	}
+
+	for _, key := range st.order {
+		stats.Rules = append(stats.Rules, *st.rules[key])
+	}
+
+	for key, h := range st.latency {
+		stats.Latency = append(stats.Latency, h.snapshot(key))
+	}
+	sortLatency(stats.Latency)
+
+	return stats
+}
+
+func (st *searchStats) reset() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.searches, st.matched, st.fallback, st.failed = 0, 0, 0, 0
+	st.rules = nil
+	st.order = nil
+	st.empty, st.emptyCount = nil, 0
+	st.latency = nil
+}
+
+// restore replaces the statistics with counters. Latency histograms whose
+// buckets are not LatencyBuckets are dropped.
+func (st *searchStats) restore(counters Counters) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	stats := counters.Stats
+	st.searches, st.matched, st.fallback, st.failed = stats.Searches, stats.Matched, stats.Fallback, stats.Failed
+	st.emptyCount = stats.Empty
+
+	st.rules, st.order = make(map[string]*RuleStats, len(stats.Rules)), nil
+	for _, rs := range stats.Rules {
+		key := ruleKey(&Rule{ID: rs.RuleID, Name: rs.RuleName, Filter: rs.Filter})
+		if _, ok := st.rules[key]; !ok {
+			st.order = append(st.order, key)
+		}
+		st.rules[key] = &rs
+	}
+
+	st.empty = make(map[string]*EmptySearch, len(counters.EmptySearches))
+	for _, es := range counters.EmptySearches {
+		st.empty[es.Filter] = &es
+	}
+
+	st.latency = make(map[latencyKey]*latencyHistogram, len(stats.Latency))
+	for _, h := range stats.Latency {
+		if len(h.Buckets) != len(LatencyBuckets) {
+			continue
+		}
+
+		counts := make([]int, len(LatencyBuckets)+1)
+		previous := 0
+		for i, bucket := range h.Buckets {
+			counts[i] = bucket.Count - previous
+			previous = bucket.Count
+		}
+		counts[len(LatencyBuckets)] = h.Count - previous
+
+		// Rounded, as seconds do not convert back to nanoseconds exactly.
+		sum := time.Duration(math.Round(h.Sum * float64(time.Second)))
+		st.latency[latencyKey{rule: h.Rule, result: h.Result}] = &latencyHistogram{counts: counts, sum: sum}
+	}
+}
+
+// emptySearches returns the empty searches, most frequent first, then by
+// filter.
+func (st *searchStats) emptySearches() []EmptySearch {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	searches := make([]EmptySearch, 0, len(st.empty))
+	for _, es := range st.empty {
+		searches = append(searches, *es)
+	}
+
+	slices.SortFunc(searches, func(a, b EmptySearch) int {
+		if c := cmp.Compare(b.Count, a.Count); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Filter, b.Filter)
+	})
+
+	return searches
+}
+
+func ruleKey(rule *Rule) string {
+	switch {
+	case rule.ID != "":
+		return "id:" + rule.ID
+	case rule.Name != "":
+		return "name:" + rule.Name
+	default:
+		return "filter:" + rule.Filter
+	}
+}
+
+// Stats returns the search statistics since the mock was last set.
+func (s *LDAPServer) Stats() Stats {
+	return s.stats.snapshot()
+}
+
+// EmptySearches returns the filters of the searches that succeeded without
+// returning entries since the mock was last set.
+func (s *LDAPServer) EmptySearches() []EmptySearch {
+	return s.stats.emptySearches()
+}
+
+func (s *LDAPServer) statsMiddleware(next SearchFunc) SearchFunc {
+	return func(ctx context.Context, req SearchRequest) (SearchResult, error) {
+		start := time.Now()
+		result, err := next(ctx, req)
+		s.stats.observeLatency(result.MatchedRule, err, time.Since(start))
+
+		entries := len(result.Users) + len(result.Groups) + len(result.Entries)
+		s.stats.record(req, result.MatchedRule, entries, err, s.clock.now().UTC())
+
+		return result, err
+	}
+}
+
+// RuleCoverage reports whether a rule of the mock has answered any search.
+type RuleCoverage struct {
+	RuleID      string     `json:"id"`
+	RuleName    string     `json:"name"`
+	Tenant      string     `json:"tenant,omitempty"`
+	Hits        int        `json:"hits"`
+	LastMatched *time.Time `json:"last_matched,omitempty"`
+	NeverHit    bool       `json:"never_hit"`
+}
+
+// Coverage lists every rule of a mock with its hits, as returned by
+// GET /mock/coverage.
+type Coverage struct {
+	Total   int            `json:"total"`
+	Hit     int            `json:"hit"`
+	Percent float64        `json:"percent"`
+	Rules   []RuleCoverage `json:"rules"`
+}
+
+// MockCoverage matches the rules of mock against stats.
+func MockCoverage(mock LDAPMock, stats Stats) Coverage {
+	hits := make(map[string]RuleStats, len(stats.Rules))
+	for _, rs := range stats.Rules {
+		hits[ruleKey(&Rule{ID: rs.RuleID, Name: rs.RuleName, Filter: rs.Filter})] = rs
+	}
+
+	coverage := Coverage{Rules: []RuleCoverage{}}
+
+	add := func(tenant string, rules []Rule) {
+		for i := range rules {
+			rule := &rules[i]
+			rs := hits[ruleKey(rule)]
+
+			coverage.Rules = append(coverage.Rules, RuleCoverage{
+				RuleID:      rule.ID,
+				RuleName:    rule.Name,
+				Tenant:      tenant,
+				Hits:        rs.Hits,
+				LastMatched: rs.LastMatched,
+				NeverHit:    rs.Hits == 0,
+			})
+
+			if rs.Hits > 0 {
+				coverage.Hit++
+			}
+		}
+	}
+
+	add("", mock.Rules)
+	for _, tenant := range mock.Tenants {
+		add(tenant.Name, tenant.Rules)
+	}
+
+	coverage.Total = len(coverage.Rules)
+	if coverage.Total > 0 {
+		coverage.Percent = float64(coverage.Hit) * 100 / float64(coverage.Total)
+	}
+
+	return coverage
+}
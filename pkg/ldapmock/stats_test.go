@@ -0,0 +1,74 @@
+package ldapmock
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSearchStats(t *testing.T) {
+	var st searchStats
+
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	req := SearchRequest{BaseDN: "dc=example", Filter: "(uid=x)"}
+	st.record(req, &Rule{ID: "a"}, 1, nil, now)
+	st.record(req, &Rule{ID: "a"}, 0, nil, now.Add(time.Minute))
+	st.record(req, &Rule{Filter: "(uid=x)"}, 0, nil, now)
+	st.record(SearchRequest{BaseDN: "ou=people", Filter: "(uid=y)"}, nil, 0, nil, now)
+	st.record(req, nil, 0, errors.New("boom"), now)
+
+	stats := st.snapshot()
+	if stats.Searches != 5 || stats.Matched != 3 || stats.Fallback != 1 || stats.Failed != 1 || stats.Empty != 3 {
+		t.Errorf("stats = %+v", stats)
+	}
+	if len(stats.Rules) != 2 || stats.Rules[0].Hits != 2 || !stats.Rules[0].LastMatched.Equal(now.Add(time.Minute)) {
+		t.Errorf("rule stats = %+v", stats.Rules)
+	}
+
+	empty := st.emptySearches()
+	if len(empty) != 2 || empty[0].Filter != "(uid=x)" || empty[0].Count != 2 || !empty[0].LastSeen.Equal(now) {
+		t.Fatalf("empty searches = %+v", empty)
+	}
+	if empty[1].Filter != "(uid=y)" || empty[1].LastBaseDN != "ou=people" {
+		t.Errorf("empty search = %+v", empty[1])
+	}
+
+	st.reset()
+	if stats := st.snapshot(); stats.Searches != 0 || stats.Empty != 0 || len(stats.Rules) != 0 || len(st.emptySearches()) != 0 {
+		t.Errorf("after reset = %+v", stats)
+	}
+}
+
+func TestMockCoverage(t *testing.T) {
+	mock := LDAPMock{
+		Rules: []Rule{
+			{ID: "hit"},
+			{Filter: "(uid=anonymous)"},
+			{ID: "never"},
+		},
+		Tenants: []Tenant{
+			{Name: "acme", Rules: []Rule{{Name: "acme-rule"}}},
+		},
+	}
+
+	stats := Stats{Rules: []RuleStats{
+		{RuleID: "hit", Hits: 3},
+		{Filter: "(uid=anonymous)", Hits: 1},
+		{RuleName: "acme-rule", Hits: 2},
+		{RuleID: "removed", Hits: 5},
+	}}
+
+	coverage := MockCoverage(mock, stats)
+
+	if coverage.Total != 4 || coverage.Hit != 3 || coverage.Percent != 75 {
+		t.Errorf("coverage = %d/%d (%v%%), want 3/4 (75%%)", coverage.Hit, coverage.Total, coverage.Percent)
+	}
+
+	never := coverage.Rules[2]
+	if never.RuleID != "never" || !never.NeverHit {
+		t.Errorf("rule 2 = %+v, want never hit", never)
+	}
+	if tenant := coverage.Rules[3]; tenant.Tenant != "acme" || tenant.Hits != 2 {
+		t.Errorf("tenant rule = %+v", tenant)
+	}
+}
@@ -0,0 +1,275 @@
+package ldapmock
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// Modes of a content synchronization request (RFC 4533).
+const (
+	SyncModeRefreshOnly       int64 = 1
+	SyncModeRefreshAndPersist int64 = 3
+)
+
+// SyncRequestValue is the value of a content synchronization request
+// control (RFC 4533).
+type SyncRequestValue struct {
+	Mode       int64  `json:"mode"`
+	Cookie     []byte `json:"cookie,omitempty"`
+	ReloadHint bool   `json:"reload_hint,omitempty"`
+}
+
+// syncRequest returns the content synchronization control of req.
+func syncRequest(req SearchRequest) (SyncRequestValue, bool) {
+	for _, control := range req.Controls {
+		if value, ok := control.Value.(SyncRequestValue); ok && control.OID == ldap.ControlTypeSyncRequest {
+			return value, true
+		}
+	}
+
+	return SyncRequestValue{}, false
+}
+
+var (
+	errInvalidSyncCookie = errors.New("invalid sync cookie")
+	// errExpiredSyncCookie is returned for cookies older than the oldest
+	// change the changelog keeps: the changes since are partly lost.
+	errExpiredSyncCookie = errors.New("sync cookie expired")
+)
+
+// syncCookie is the cookie of the changelog up to seq.
+func syncCookie(seq uint64) []byte {
+	return []byte(strconv.FormatUint(seq, 10))
+}
+
+// parseSyncCookie returns the sequence number of cookie, which must be
+// between the changes before oldest, the oldest one kept, and last.
+func parseSyncCookie(cookie []byte, oldest, last uint64) (uint64, error) {
+	seq, err := strconv.ParseUint(string(cookie), 10, 64)
+	if err != nil || seq > last {
+		return 0, errInvalidSyncCookie
+	}
+	if seq+1 < oldest {
+		return 0, errExpiredSyncCookie
+	}
+
+	return seq, nil
+}
+
+// syncMiddleware serves the refresh stage of content synchronization
+// searches with a cookie incrementally (RFC 4533): the entries changed
+// since, each once in its current state and with its sync state, deleted
+// entries included. Cookies whose changes the changelog no longer keeps
+// fail with e-syncRefreshRequired(4096), so that the client starts over
+// with a full refresh. Like DirSync, the rules are not applied to changes.
+func (s *LDAPServer) syncMiddleware(next SearchFunc) SearchFunc {
+	return func(ctx context.Context, req SearchRequest) (SearchResult, error) {
+		sync, ok := syncRequest(req)
+		if !ok || len(sync.Cookie) == 0 {
+			return next(ctx, req)
+		}
+
+		mock, _, _ := s.currentMock(ctx)
+
+		seq, err := parseSyncCookie(sync.Cookie, s.changelog.oldestSeq(), s.changelog.lastSeq())
+		if err != nil {
+			return SearchResult{}, ldap.NewError(ldap.LDAPResultSyncRefreshRequired, err)
+		}
+
+		filter, err := ParseFilter(req.Filter)
+		if err != nil {
+			return SearchResult{}, ldap.NewError(ldap.LDAPResultFilterError, err)
+		}
+
+		changes, _ := s.changelog.since(seq)
+		syntaxes := mock.Attributes.lower()
+
+		result := SearchResult{syncStates: make(map[string]ldap.ControlSyncStateState)}
+		for _, change := range latestChanges(changes) {
+			entry, state, ok := changeEntry(change, req, filter, syntaxes)
+			if !ok {
+				continue
+			}
+
+			result.Entries = append(result.Entries, entry)
+			result.syncStates[entry.DN] = state
+		}
+
+		return result, nil
+	}
+}
+
+// syncState is the sync state of an entry after a change of changeType.
+func syncState(changeType string) ldap.ControlSyncStateState {
+	switch changeType {
+	case ChangeModify:
+		return ldap.SyncStateModify
+	case ChangeDelete:
+		return ldap.SyncStateDelete
+	default:
+		return ldap.SyncStateAdd
+	}
+}
+
+// entryUUID identifies the entry dn in sync state controls: the same DN,
+// whatever its case and spacing, always gets the same UUID.
+func entryUUID(dn string) uuid.UUID {
+	return uuid.NewSHA1(uuid.NameSpaceX500, []byte(strings.Join(splitDN(dn), ",")))
+}
+
+// syncStateControl encodes the sync state control of an entry sent by a
+// synchronized search.
+func syncStateControl(state ldap.ControlSyncStateState, dn string, cookie []byte) *ber.Packet {
+	id := entryUUID(dn)
+
+	value := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Sync State Value")
+	value.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(state), "State"))
+	value.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, string(id[:]), "Entry UUID"))
+	if cookie != nil {
+		value.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, string(cookie), "Cookie"))
+	}
+
+	return ldap.NewControlString(ldap.ControlTypeSyncState, false, string(value.Bytes())).Encode()
+}
+
+// syncDoneControl encodes the sync done control ending a refreshOnly
+// search. Without refreshDeletes, entries not sent are gone; with it, after
+// an incremental refresh, they are unchanged.
+func syncDoneControl(cookie []byte, refreshDeletes bool) *ber.Packet {
+	value := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Sync Done Value")
+	value.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, string(cookie), "Cookie"))
+	if refreshDeletes {
+		value.AppendChild(ber.NewBoolean(ber.ClassUniversal, ber.TypePrimitive, ber.TagBoolean, true, "Refresh Deletes"))
+	}
+
+	return ldap.NewControlString(ldap.ControlTypeSyncDone, false, string(value.Bytes())).Encode()
+}
+
+// newSyncInfoPacket builds the sync info message ending the refresh stage of
+// a refreshAndPersist search: a refreshPresent with the cookie, the refresh
+// being done, or a refreshDelete after an incremental refresh.
+func newSyncInfoPacket(msgID int64, cookie []byte, refreshDeletes bool) *ber.Packet {
+	tag, description := ber.Tag(ldap.SyncInfoRefreshPresent), "Refresh Present"
+	if refreshDeletes {
+		tag, description = ber.Tag(ldap.SyncInfoRefreshDelete), "Refresh Delete"
+	}
+
+	present := ber.Encode(ber.ClassContext, ber.TypeConstructed, tag, nil, description)
+	present.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, string(cookie), "Cookie"))
+
+	response := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationIntermediateResponse, nil, "Intermediate Response")
+	response.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimitive, 0, ldap.ControlTypeSyncInfo, "Response Name"))
+	response.AppendChild(ber.NewString(ber.ClassContext, ber.TypePrimitive, 1, string(present.Bytes()), "Response Value"))
+
+	msg := newMessage(msgID)
+	msg.AppendChild(response)
+
+	return msg
+}
+
+// inScope reports whether the entry dn is within the scope of a search of
+// base.
+func inScope(dn, base string, scope LDAPScope) bool {
+	rdns, baseRDNs := splitDN(dn), splitDN(base)
+	if !hasDNSuffix(rdns, baseRDNs) {
+		return false
+	}
+
+	switch scope {
+	case ScopeBase:
+		return len(rdns) == len(baseRDNs)
+	case ScopeOne:
+		return len(rdns) == len(baseRDNs)+1
+	default:
+		return true
+	}
+}
+
+// persistSync sends the changes of the changelog after seq that concern req
+// (see changeEntry), as entries with a sync state control, until ctx is
+// done.
+func (s *LDAPServer) persistSync(ctx context.Context, msgID int64, req SearchRequest, seq uint64, w responseWriter) {
+	filter, err := ParseFilter(req.Filter)
+	if err != nil {
+		return
+	}
+
+	for {
+		// Take the notification before reading, so that no change is missed.
+		changed := s.changelog.changed()
+
+		changes, last := s.changelog.since(seq)
+		syntaxes := s.mock.Load().mock.Attributes.lower()
+		for _, change := range changes {
+			entry, state, ok := changeEntry(change, req, filter, syntaxes)
+			if !ok {
+				continue
+			}
+
+			packet := newSearchEntryPacket(msgID, entry.DN, entry.Attrs, s.ResponseFormat().SortAttributes)
+			if w(withControls(packet, syncStateControl(state, entry.DN, syncCookie(change.Seq))), 0) != nil {
+				return
+			}
+
+			s.logger(ctx).Debug("sync change sent", zap.String("type", change.Type), zap.String("dn", change.DN))
+		}
+		seq = last
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-changed:
+		}
+	}
+}
+
+// changeEntry returns the entry change sends to a synchronized search of
+// req, with the attributes it asks for, and its sync state; ok is false when
+// the entry is out of the scope of req, or added or modified and matching
+// filter neither before nor after. An entry that stops matching filter is
+// sent as deleted, and deleted entries have no attributes. syntaxes must be
+// lowered.
+func changeEntry(change Change, req SearchRequest, filter *Filter, syntaxes AttributeSyntaxes) (entry Entry, state ldap.ControlSyncStateState, ok bool) {
+	if !inScope(change.DN, req.BaseDN, req.Scope) {
+		return Entry{}, 0, false
+	}
+
+	entry = Entry{DN: change.DN}
+	if change.Type == ChangeDelete {
+		return entry, ldap.SyncStateDelete, true
+	}
+
+	if !entryMatches(change.DN, change.Attributes, filter, syntaxes) {
+		if change.previous != nil && entryMatches(change.DN, change.previous, filter, syntaxes) {
+			return entry, ldap.SyncStateDelete, true
+		}
+
+		return Entry{}, 0, false
+	}
+
+	entry.Attrs = make(map[string][]string, len(change.Attributes))
+	for name, values := range change.Attributes {
+		if attributeRequested(req.Attributes, name) {
+			entry.Attrs[name] = values
+		}
+	}
+
+	return entry, syncState(change.Type), true
+}
+
+// entryMatches reports whether the entry dn with attrs matches filter.
+func entryMatches(dn string, attrs map[string][]string, filter *Filter, syntaxes AttributeSyntaxes) bool {
+	lowered := make(map[string][]string, len(attrs))
+	for name, values := range attrs {
+		lowered[strings.ToLower(name)] = values
+	}
+
+	return entryMatcher{dn: dn, attrs: lowered, syntaxes: syntaxes}.match(filter)
+}
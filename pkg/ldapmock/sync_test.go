@@ -0,0 +1,111 @@
+package ldapmock
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"go.uber.org/zap"
+)
+
+func TestInScope(t *testing.T) {
+	tests := []struct {
+		dn    string
+		scope LDAPScope
+		want  bool
+	}{
+		{"dc=example", ScopeBase, true},
+		{"uid=john,dc=example", ScopeBase, false},
+		{"UID=John, DC=Example", ScopeOne, true},
+		{"uid=john,ou=users,dc=example", ScopeOne, false},
+		{"uid=john,ou=users,dc=example", ScopeSub, true},
+		{"uid=john,dc=other", ScopeSub, false},
+	}
+
+	for _, tt := range tests {
+		if got := inScope(tt.dn, "dc=example", tt.scope); got != tt.want {
+			t.Errorf("inScope(%s, %s) = %v, want %v", tt.dn, tt.scope, got, tt.want)
+		}
+	}
+}
+
+func TestParseSyncCookie(t *testing.T) {
+	tests := []struct {
+		cookie string
+		want   uint64
+		err    error
+	}{
+		{"1", 0, errExpiredSyncCookie},
+		{"2", 2, nil},
+		{"5", 5, nil},
+		{"6", 0, errInvalidSyncCookie},
+		{"ldap-mock-dirsync:5", 0, errInvalidSyncCookie},
+	}
+
+	for _, tt := range tests {
+		got, err := parseSyncCookie([]byte(tt.cookie), 3, 5)
+		if got != tt.want || !errors.Is(err, tt.err) {
+			t.Errorf("parseSyncCookie(%q) = %d, %v, want %d, %v", tt.cookie, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestLatestChanges(t *testing.T) {
+	changes := []Change{
+		{Seq: 1, Type: ChangeModify, DN: "uid=john,dc=example", previous: map[string][]string{"uid": {"john"}}},
+		{Seq: 2, Type: ChangeAdd, DN: "uid=jane,dc=example"},
+		{Seq: 3, Type: ChangeModify, DN: "UID=Jane, DC=Example", previous: map[string][]string{"uid": {"jane"}}},
+		{Seq: 4, Type: ChangeDelete, DN: "uid=john,dc=example", previous: map[string][]string{"mail": {"john@example"}}},
+		{Seq: 5, Type: ChangeModify, DN: "uid=joe,dc=example"},
+	}
+
+	// The entries are as they were before the first change.
+	want := []Change{
+		{Seq: 3, Type: ChangeAdd, DN: "UID=Jane, DC=Example"},
+		{Seq: 4, Type: ChangeDelete, DN: "uid=john,dc=example", previous: map[string][]string{"uid": {"john"}}},
+		{Seq: 5, Type: ChangeModify, DN: "uid=joe,dc=example"},
+	}
+	if got := latestChanges(changes); !reflect.DeepEqual(got, want) {
+		t.Errorf("latestChanges = %+v, want %+v", got, want)
+	}
+}
+
+func TestLDAPServer_ServeAbandon(t *testing.T) {
+	srv := NewLDAPServer(zap.NewNop(), "0", "", "", nil)
+	ops := &connOps{cancels: make(map[int64]context.CancelFunc)}
+	ctx := context.WithValue(context.Background(), connOpsKey{}, ops)
+
+	done := make(chan struct{})
+	goBackground(ctx, 7, func(ctx context.Context) {
+		<-ctx.Done()
+		close(done)
+	})
+	if !ops.active() {
+		t.Fatal("background operation not tracked")
+	}
+
+	msg := newMessage(8)
+	msg.AppendChild(ber.NewInteger(ber.ClassApplication, ber.TypePrimitive, ldap.ApplicationAbandonRequest, int64(7), "Abandon Request"))
+	p, err := ber.DecodePacketErr(msg.Bytes())
+	if err != nil {
+		t.Fatalf("decode abandon request: %v", err)
+	}
+
+	if !srv.serveAbandon(ctx, p, nil) {
+		t.Fatal("abandon request not handled")
+	}
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("background operation not abandoned")
+	}
+
+	for ops.active() {
+		time.Sleep(time.Millisecond)
+	}
+}
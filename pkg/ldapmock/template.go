@@ -0,0 +1,170 @@
+package ldapmock
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// TemplateData is what the response templates of a rule with Template set
+// are executed with.
+type TemplateData struct {
+	Request SearchRequest
+	// Values holds the value of each equality assertion of the request
+	// filter, by lowercased attribute name.
+	Values map[string]string
+	// Now is the time of the mock clock.
+	Now time.Time
+}
+
+// templateFuncs are the helpers of response templates, in addition to the
+// text/template built-ins.
+var templateFuncs = template.FuncMap{
+	"upper":        strings.ToUpper,
+	"lower":        strings.ToLower,
+	"sprintf":      fmt.Sprintf,
+	"dnEscape":     ldap.EscapeDN,
+	"filterEscape": ldap.EscapeFilter,
+	"initials": func(values ...string) string {
+		var b strings.Builder
+		for _, value := range values {
+			for _, word := range strings.Fields(value) {
+				r, _ := utf8.DecodeRuneInString(word)
+				b.WriteRune(unicode.ToUpper(r))
+			}
+		}
+		return b.String()
+	},
+	"base64": func(s string) string {
+		return base64.StdEncoding.EncodeToString([]byte(s))
+	},
+	"dateAdd": func(d string, t time.Time) (time.Time, error) {
+		duration, err := time.ParseDuration(d)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return t.Add(duration), nil
+	},
+	"date": func(layout string, t time.Time) string {
+		return t.UTC().Format(layout)
+	},
+	"generalizedTime": func(t time.Time) string {
+		return t.UTC().Format("20060102150405Z")
+	},
+	"hash": func(algorithm, s string) (string, error) {
+		newHash, ok := templateHashes[strings.ToLower(algorithm)]
+		if !ok {
+			return "", fmt.Errorf("unknown hash %q: must be md5, sha1, sha256 or sha512", algorithm)
+		}
+		h := newHash()
+		h.Write([]byte(s))
+		return hex.EncodeToString(h.Sum(nil)), nil
+	},
+}
+
+var templateHashes = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// newTemplateData returns the data the response templates of req are
+// executed with.
+func newTemplateData(req SearchRequest, now time.Time) TemplateData {
+	data := TemplateData{Request: req, Values: map[string]string{}, Now: now}
+
+	var collect func(f *Filter)
+	collect = func(f *Filter) {
+		if f.Type == FilterEqual {
+			if _, ok := data.Values[strings.ToLower(f.Attr)]; !ok {
+				data.Values[strings.ToLower(f.Attr)] = f.Value
+			}
+		}
+		for _, child := range f.Children {
+			collect(child)
+		}
+	}
+
+	if f, err := ParseFilter(req.Filter); err == nil {
+		collect(f)
+	}
+
+	return data
+}
+
+// renderTemplate executes text as a template with data.
+func renderTemplate(text string, data TemplateData) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+
+	tmpl, err := template.New("").Funcs(templateFuncs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
+}
+
+// renderResponse returns copies of users and groups whose DNs, attribute
+// values and members are executed as templates with data.
+func renderResponse(users []User, groups []Group, data TemplateData) ([]User, []Group, error) {
+	var err error
+	render := func(text string) string {
+		if err != nil {
+			return ""
+		}
+
+		var out string
+		if out, err = renderTemplate(text, data); err != nil {
+			err = fmt.Errorf("template %q: %w", text, err)
+		}
+
+		return out
+	}
+
+	renderAttrs := func(attrs map[string]string) {
+		for name, value := range attrs {
+			attrs[name] = render(value)
+		}
+	}
+
+	renderedUsers := cloneUsers(users)
+	for i := range renderedUsers {
+		renderedUsers[i].CN = render(renderedUsers[i].CN)
+		renderAttrs(renderedUsers[i].Attrs)
+	}
+
+	renderedGroups := cloneGroups(groups)
+	for i := range renderedGroups {
+		renderedGroups[i].CN = render(renderedGroups[i].CN)
+		renderAttrs(renderedGroups[i].Attrs)
+		for j, member := range renderedGroups[i].Members {
+			renderedGroups[i].Members[j] = render(member)
+		}
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return renderedUsers, renderedGroups, nil
+}
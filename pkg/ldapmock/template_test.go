@@ -0,0 +1,98 @@
+package ldapmock
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"go.uber.org/zap"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	data := newTemplateData(SearchRequest{
+		BaseDN: "ou=people,dc=example",
+		Scope:  ScopeSub,
+		Filter: "(&(objectClass=person)(|(uid=John)(mail=john@example)))",
+	}, time.Date(2026, 1, 31, 12, 0, 0, 0, time.UTC))
+
+	tests := []struct {
+		text    string
+		want    string
+		wantErr string
+	}{
+		{text: "plain {value}", want: "plain {value}"},
+		{text: "{{ .Values.uid | lower }}", want: "john"},
+		{text: "{{ upper .Values.uid }}@{{ .Request.BaseDN }}", want: "JOHN@ou=people,dc=example"},
+		{text: `{{ sprintf "%s-%03d" .Values.objectclass 7 }}`, want: "person-007"},
+		{text: `cn={{ dnEscape "Doe, John" }}`, want: `cn=Doe\, John`},
+		{text: `{{ filterEscape "a*b" }}`, want: `a\2ab`},
+		{text: "{{ base64 .Values.mail }}", want: "am9obkBleGFtcGxl"},
+		{text: `{{ dateAdd "48h" .Now | generalizedTime }}`, want: "20260202120000Z"},
+		{text: `{{ date "2006-01-02" .Now }}`, want: "2026-01-31"},
+		{text: `{{ hash "sha256" "secret" }}`, want: "2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b"},
+		{text: `{{ initials "jean claude" "van damme" }}`, want: "JCVD"},
+		{text: "{{ .Values.missing }}", want: ""},
+		{text: `{{ hash "crc32" "x" }}`, wantErr: `unknown hash "crc32"`},
+		{text: `{{ dateAdd "soon" .Now }}`, wantErr: "invalid duration"},
+		{text: "{{ .Values.uid", wantErr: "unclosed action"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got, err := renderTemplate(tt.text, data)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("rendered %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLDAPServer_OnSearch_Template(t *testing.T) {
+	srv := NewLDAPServer(zap.NewNop(), "0", "", "", nil)
+	srv.SetMock(LDAPMock{Rules: []Rule{
+		{
+			ID:          "echo",
+			Filter:      "(uid=*)",
+			FilterMatch: FilterMatchSemantic,
+			Template:    true,
+			Response: Response{
+				Users:  []User{{CN: "uid={{ .Values.uid }},dc=example", Attrs: map[string]string{"mail": "{{ .Values.uid }}@example"}}},
+				Groups: []Group{{CN: "cn=staff,dc=example", Members: []string{"uid={{ .Values.uid }},dc=example"}}},
+			},
+		},
+		{ID: "broken", Filter: "(cn=*)", FilterMatch: FilterMatchSemantic, Template: true, Response: Response{
+			Users: []User{{CN: "cn={{ .Nope }}"}},
+		}},
+	}})
+
+	result, err := srv.OnSearch(context.Background(), SearchRequest{Filter: "(uid=jane)", Scope: ScopeSub})
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if len(result.Users) != 1 || result.Users[0].CN != "uid=jane,dc=example" || result.Users[0].Attrs["mail"] != "jane@example" {
+		t.Errorf("users = %+v, want uid=jane,dc=example with mail jane@example", result.Users)
+	}
+	if len(result.Groups) != 1 || result.Groups[0].Members[0] != "uid=jane,dc=example" {
+		t.Errorf("groups = %+v, want member uid=jane,dc=example", result.Groups)
+	}
+
+	// The mock keeps its templates.
+	if mock := srv.GetMock(); mock.Rules[0].Response.Users[0].CN != "uid={{ .Values.uid }},dc=example" {
+		t.Errorf("mock rule user = %s, want the template", mock.Rules[0].Response.Users[0].CN)
+	}
+
+	if _, err := srv.OnSearch(context.Background(), SearchRequest{Filter: "(cn=x)", Scope: ScopeSub}); !ldap.IsErrorWithCode(err, ldap.LDAPResultOther) {
+		t.Errorf("broken template: err = %v, want other", err)
+	}
+}
@@ -0,0 +1,169 @@
+package ldapmock
+
+import (
+	"slices"
+	"strings"
+	"sync"
+)
+
+// directoryFor returns the users, groups and rules serving the given search
+// base. The tenant with the longest base DN that contains the search base wins;
+// requests outside every tenant are served from the top-level directory.
+func (m LDAPMock) directoryFor(baseDN string) ([]User, []Group, []Rule) {
+	tenant := m.findTenant(baseDN)
+	if tenant == nil {
+		return m.Users, m.Groups, m.activeRules(m.Rules)
+	}
+
+	return tenant.Users, tenant.Groups, m.activeRules(tenant.Rules)
+}
+
+func (m LDAPMock) findTenant(baseDN string) *Tenant {
+	if i := m.tenantIndex(baseDN); i >= 0 {
+		return &m.Tenants[i]
+	}
+
+	return nil
+}
+
+// tenantIndex returns the index of the tenant serving baseDN, or -1.
+func (m LDAPMock) tenantIndex(baseDN string) int {
+	var (
+		found     = -1
+		foundSize int
+	)
+
+	reqParts := splitDN(baseDN)
+
+	for i := range m.Tenants {
+		tenantParts := splitDN(m.Tenants[i].BaseDN)
+		if len(tenantParts) == 0 || !hasDNSuffix(reqParts, tenantParts) {
+			continue
+		}
+
+		if found < 0 || len(tenantParts) > foundSize {
+			found = i
+			foundSize = len(tenantParts)
+		}
+	}
+
+	return found
+}
+
+// compiledMock holds what searches need from each directory of a mock, built
+// once when the mock is set: the rule engine and the entry index, plus the
+// computed attributes of the mock.
+type compiledMock struct {
+	root     compiledDirectory
+	tenants  []compiledDirectory
+	computed []computedAttribute
+	// global indexes the entries of every directory for global catalog
+	// searches, on first use.
+	global func() *directoryIndex
+}
+
+type compiledDirectory struct {
+	rules *RuleEngine
+	// matching evaluates rules and the expectations of the server, as
+	// searches do (see compiledMock.withExpectations).
+	matching *RuleEngine
+	entries  *directoryIndex
+}
+
+func compileMock(mock LDAPMock) compiledMock {
+	compiled := compiledMock{
+		root:     compiledDirectory{rules: NewRuleEngine(mock.activeRules(mock.Rules)), entries: newDirectoryIndex(mock.Users, mock.Groups)},
+		tenants:  make([]compiledDirectory, len(mock.Tenants)),
+		computed: compileComputed(mock.Computed),
+		global:   sync.OnceValue(func() *directoryIndex { return globalDirectory(mock) }),
+	}
+	for i, tenant := range mock.Tenants {
+		compiled.tenants[i] = compiledDirectory{
+			rules:   NewRuleEngine(mock.activeRules(tenant.Rules)),
+			entries: newDirectoryIndex(tenant.Users, tenant.Groups),
+		}
+	}
+
+	return compiled
+}
+
+// withExpectations returns c with the rules of each directory merged with
+// expectations, the compiled expectations of the server.
+func (c compiledMock) withExpectations(expectations *RuleEngine) compiledMock {
+	c.root.matching = c.root.rules.merge(expectations)
+	c.tenants = slices.Clone(c.tenants)
+	for i := range c.tenants {
+		c.tenants[i].matching = c.tenants[i].rules.merge(expectations)
+	}
+
+	return c
+}
+
+// forBase returns the directory of mock serving baseDN; mock must be the mock
+// c was compiled from.
+func (c compiledMock) forBase(mock LDAPMock, baseDN string) compiledDirectory {
+	if i := mock.tenantIndex(baseDN); i >= 0 {
+		return c.tenants[i]
+	}
+
+	return c.root
+}
+
+// splitDN splits a DN into normalized RDNs: lowercased, with insignificant
+// spaces around the separators removed. Escaped commas are kept intact.
+func splitDN(dn string) []string {
+	dn = strings.TrimSpace(dn)
+	if dn == "" {
+		return nil
+	}
+
+	var (
+		parts   []string
+		current strings.Builder
+		escaped bool
+	)
+
+	for _, c := range dn {
+		switch {
+		case escaped:
+			current.WriteRune(c)
+			escaped = false
+		case c == '\\':
+			current.WriteRune(c)
+			escaped = true
+		case c == ',':
+			parts = append(parts, normalizeRDN(current.String()))
+			current.Reset()
+		default:
+			current.WriteRune(c)
+		}
+	}
+
+	parts = append(parts, normalizeRDN(current.String()))
+
+	return parts
+}
+
+func normalizeRDN(rdn string) string {
+	attr, value, ok := strings.Cut(rdn, "=")
+	if !ok {
+		return strings.ToLower(strings.TrimSpace(rdn))
+	}
+
+	return strings.ToLower(strings.TrimSpace(attr)) + "=" + strings.ToLower(strings.TrimSpace(value))
+}
+
+func hasDNSuffix(dn, suffix []string) bool {
+	if len(suffix) > len(dn) {
+		return false
+	}
+
+	offset := len(dn) - len(suffix)
+	for i := range suffix {
+		if dn[offset+i] != suffix[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,80 @@
+package ldapmock
+
+import (
+	"testing"
+)
+
+func TestLDAPMock_DirectoryFor(t *testing.T) {
+	mock := LDAPMock{
+		Users: []User{{CN: "root-user"}},
+		Tenants: []Tenant{
+			{
+				Name:   "example",
+				BaseDN: "DC=example,DC=com",
+				Users:  []User{{CN: "example-user"}},
+			},
+			{
+				Name:   "example-eu",
+				BaseDN: "DC=eu,DC=example,DC=com",
+				Users:  []User{{CN: "eu-user"}},
+			},
+			{
+				Name:   "other",
+				BaseDN: "dc=other, dc=com",
+				Users:  []User{{CN: "other-user"}},
+			},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		baseDN   string
+		wantUser string
+	}{
+		{"exact tenant base", "DC=example,DC=com", "example-user"},
+		{"subordinate base", "OU=Users,DC=example,DC=com", "example-user"},
+		{"longest suffix wins", "OU=Users,DC=eu,DC=example,DC=com", "eu-user"},
+		{"case and spacing insensitive", "ou=people,DC=Other,DC=COM", "other-user"},
+		{"outside all tenants", "DC=unknown,DC=com", "root-user"},
+		{"suffix must match whole RDNs", "DC=myexample,DC=com", "root-user"},
+		{"empty base", "", "root-user"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users, _, _ := mock.directoryFor(tt.baseDN)
+			if len(users) != 1 {
+				t.Fatalf("users = %d, want 1", len(users))
+			}
+			if users[0].CN != tt.wantUser {
+				t.Errorf("user = %v, want %v", users[0].CN, tt.wantUser)
+			}
+		})
+	}
+}
+
+func TestSplitDN(t *testing.T) {
+	tests := []struct {
+		dn   string
+		want []string
+	}{
+		{"", nil},
+		{"DC=example,DC=com", []string{"dc=example", "dc=com"}},
+		{" CN = John , DC=com ", []string{"cn=john", "dc=com"}},
+		{`CN=Doe\, John,DC=com`, []string{`cn=doe\, john`, "dc=com"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dn, func(t *testing.T) {
+			got := splitDN(tt.dn)
+			if len(got) != len(tt.want) {
+				t.Fatalf("splitDN(%q) = %v, want %v", tt.dn, got, tt.want)
+			}
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Errorf("splitDN(%q)[%d] = %q, want %q", tt.dn, i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,247 @@
+//go:build ignore
+
+// gen writes the WASM modules the WASMEngine tests load, so that they need
+// no WASM toolchain: go run gen.go, in this directory.
+//
+// echo.wasm answers every search with uid=wasm,dc=example and
+// sizeLimitExceeded(4), the request JSON being the message:
+//
+//	(module
+//	  (memory (export "memory") 2)
+//	  (global $heap (mut i32) (i32.const 1024))
+//	  (data (i32.const 16) "{\"result_code\":4,...,\"message\":\"")  ;; prefix
+//	  (data (i32.const 512) "\"}")                                     ;; suffix
+//	  (func (export "alloc") (param $size i32) (result i32) ...)        ;; bump allocator
+//	  (func $copy (param $dst i32) (param $src i32) (param $n i32) (result i32) ...)
+//	  (func (export "respond") (param $ptr i32) (param $len i32) (result i64)
+//	    ;; prefix, the request with " and \ escaped, suffix
+//	    ...))
+//
+// spin.wasm never returns from respond.
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+)
+
+const (
+	typeI32 = 0x7f
+	typeI64 = 0x7e
+
+	opBlock     = 0x02
+	opLoop      = 0x03
+	opIf        = 0x04
+	opEnd       = 0x0b
+	opBr        = 0x0c
+	opBrIf      = 0x0d
+	opReturn    = 0x0f
+	opCall      = 0x10
+	opLocalGet  = 0x20
+	opLocalSet  = 0x21
+	opLocalTee  = 0x22
+	opGlobalGet = 0x23
+	opGlobalSet = 0x24
+	opLoad8U    = 0x2d
+	opStore8    = 0x3a
+	opI32Const  = 0x41
+	opI32Eqz    = 0x45
+	opI32Eq     = 0x46
+	opI32GeU    = 0x4f
+	opI32Add    = 0x6a
+	opI32Sub    = 0x6b
+	opI32Or     = 0x72
+	opI64Shl    = 0x86
+	opI64Or     = 0x84
+	opI64Const  = 0x42
+	opI64ExtU   = 0xad
+	blockVoid   = 0x40
+)
+
+const (
+	prefixAt = 16
+	suffixAt = 512
+	heapAt   = 1024
+)
+
+var (
+	prefix = `{"result_code":4,"users":[{"cn":"uid=wasm,dc=example","attrs":{"uid":"wasm"}}],"message":"`
+	suffix = `"}`
+)
+
+func uleb(v uint64) []byte {
+	var out []byte
+	for {
+		b := byte(v & 0x7f)
+		v >>= 7
+		if v != 0 {
+			out = append(out, b|0x80)
+			continue
+		}
+		return append(out, b)
+	}
+}
+
+func sleb(v int64) []byte {
+	var out []byte
+	for {
+		b := byte(v & 0x7f)
+		v >>= 7
+		if (v == 0 && b&0x40 == 0) || (v == -1 && b&0x40 != 0) {
+			return append(out, b)
+		}
+		out = append(out, b|0x80)
+	}
+}
+
+func vec(items ...[]byte) []byte {
+	out := uleb(uint64(len(items)))
+	for _, item := range items {
+		out = append(out, item...)
+	}
+	return out
+}
+
+func name(s string) []byte {
+	return append(uleb(uint64(len(s))), s...)
+}
+
+func section(id byte, body []byte) []byte {
+	return append(append([]byte{id}, uleb(uint64(len(body)))...), body...)
+}
+
+func funcType(params, results []byte) []byte {
+	return append(append([]byte{0x60}, vec(splitBytes(params)...)...), vec(splitBytes(results)...)...)
+}
+
+func splitBytes(b []byte) [][]byte {
+	out := make([][]byte, len(b))
+	for i := range b {
+		out[i] = b[i : i+1]
+	}
+	return out
+}
+
+func i32(v int32) []byte { return append([]byte{opI32Const}, sleb(int64(v))...) }
+
+func op(code byte, imm ...uint64) []byte {
+	out := []byte{code}
+	for _, v := range imm {
+		out = append(out, uleb(v)...)
+	}
+	return out
+}
+
+func code(locals []byte, body ...[]byte) []byte {
+	var decls [][]byte
+	for _, local := range locals {
+		decls = append(decls, []byte{1, local})
+	}
+
+	fn := vec(decls...)
+	for _, b := range body {
+		fn = append(fn, b...)
+	}
+	fn = append(fn, opEnd)
+
+	return append(uleb(uint64(len(fn))), fn...)
+}
+
+func module(respond []byte, respondLocals []byte) []byte {
+	var m bytes.Buffer
+	m.Write([]byte("\x00asm\x01\x00\x00\x00"))
+
+	m.Write(section(1, vec(
+		funcType([]byte{typeI32}, []byte{typeI32}),                   // alloc
+		funcType([]byte{typeI32, typeI32, typeI32}, []byte{typeI32}), // copy
+		funcType([]byte{typeI32, typeI32}, []byte{typeI64}),          // respond
+	)))
+	m.Write(section(3, vec([]byte{0}, []byte{1}, []byte{2})))
+	m.Write(section(5, vec([]byte{0x00, 2})))
+	m.Write(section(6, vec(append(append([]byte{typeI32, 1}, i32(heapAt)...), opEnd))))
+	m.Write(section(7, vec(
+		append(name("memory"), 0x02, 0),
+		append(name("alloc"), 0x00, 0),
+		append(name("respond"), 0x00, 2),
+	)))
+
+	alloc := code(nil,
+		op(opGlobalGet, 0),
+		op(opGlobalGet, 0), op(opLocalGet, 0), op(opI32Add), op(opGlobalSet, 0),
+	)
+
+	// copy: locals 0 dst, 1 src, 2 n.
+	copyFn := code(nil,
+		[]byte{opBlock, blockVoid, opLoop, blockVoid},
+		op(opLocalGet, 2), op(opI32Eqz), op(opBrIf, 1),
+		op(opLocalGet, 0), op(opLocalGet, 1), op(opLoad8U, 0, 0), op(opStore8, 0, 0),
+		op(opLocalGet, 0), i32(1), op(opI32Add), op(opLocalSet, 0),
+		op(opLocalGet, 1), i32(1), op(opI32Add), op(opLocalSet, 1),
+		op(opLocalGet, 2), i32(1), op(opI32Sub), op(opLocalSet, 2),
+		op(opBr, 0),
+		[]byte{opEnd, opEnd},
+		op(opLocalGet, 0),
+	)
+
+	m.Write(section(10, vec(alloc, copyFn, code(respondLocals, respond))))
+
+	data := func(at int32, s string) []byte {
+		return append(append(append([]byte{0}, i32(at)...), opEnd), name(s)...)
+	}
+	m.Write(section(11, vec(data(prefixAt, prefix), data(suffixAt, suffix))))
+
+	return m.Bytes()
+}
+
+// echoRespond: locals 0 ptr, 1 len, 2 out, 3 p, 4 i, 5 b.
+func echoRespond() []byte {
+	var body []byte
+	add := func(parts ...[]byte) {
+		for _, part := range parts {
+			body = append(body, part...)
+		}
+	}
+
+	add(op(opGlobalGet, 0), op(opLocalTee, 2))
+	add(i32(prefixAt), i32(int32(len(prefix))), op(opCall, 1), op(opLocalSet, 3))
+
+	add([]byte{opBlock, blockVoid, opLoop, blockVoid})
+	add(op(opLocalGet, 4), op(opLocalGet, 1), op(opI32GeU), op(opBrIf, 1))
+	add(op(opLocalGet, 0), op(opLocalGet, 4), op(opI32Add), op(opLoad8U, 0, 0), op(opLocalSet, 5))
+	// if b == '"' || b == '\\' { *p++ = '\\' }
+	add(op(opLocalGet, 5), i32('"'), op(opI32Eq), op(opLocalGet, 5), i32('\\'), op(opI32Eq), op(opI32Or))
+	add([]byte{opIf, blockVoid})
+	add(op(opLocalGet, 3), i32('\\'), op(opStore8, 0, 0))
+	add(op(opLocalGet, 3), i32(1), op(opI32Add), op(opLocalSet, 3))
+	add([]byte{opEnd})
+	add(op(opLocalGet, 3), op(opLocalGet, 5), op(opStore8, 0, 0))
+	add(op(opLocalGet, 3), i32(1), op(opI32Add), op(opLocalSet, 3))
+	add(op(opLocalGet, 4), i32(1), op(opI32Add), op(opLocalSet, 4))
+	add(op(opBr, 0), []byte{opEnd, opEnd})
+
+	add(op(opLocalGet, 3), i32(suffixAt), i32(int32(len(suffix))), op(opCall, 1), op(opLocalSet, 3))
+	add(op(opLocalGet, 3), op(opGlobalSet, 0))
+
+	// (out << 32) | (p - out)
+	add(op(opLocalGet, 2), []byte{opI64ExtU}, []byte{opI64Const}, sleb(32), []byte{opI64Shl})
+	add(op(opLocalGet, 3), op(opLocalGet, 2), op(opI32Sub), []byte{opI64ExtU}, []byte{opI64Or})
+	add([]byte{opReturn})
+
+	return body
+}
+
+func spinRespond() []byte {
+	return []byte{opLoop, blockVoid, opBr, 0, opEnd, opI64Const, 0}
+}
+
+func main() {
+	echo := module(echoRespond(), []byte{typeI32, typeI32, typeI32, typeI32})
+	if err := os.WriteFile("echo.wasm", echo, 0o644); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := os.WriteFile("spin.wasm", module(spinRespond(), nil), 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
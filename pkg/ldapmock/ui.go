@@ -0,0 +1,129 @@
+package ldapmock
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// uiFiles holds the dashboard served under /ui: index.html and its assets.
+//
+//go:embed ui
+var uiFiles embed.FS
+
+// UIConfig controls the dashboard served under /ui, as part of the runtime
+// config of /config.
+type UIConfig struct {
+	// Disabled removes the /ui routes: they answer 404 Not Found, leaving only
+	// the JSON API reachable.
+	Disabled bool `json:"disabled"`
+	// AssetsDir serves the dashboard from a local directory: its files take
+	// precedence over the embedded bundle, which still provides the others, so
+	// the console can be customized or extended without a rebuild.
+	AssetsDir string `json:"assets_dir,omitempty"`
+}
+
+// SetUI replaces the dashboard settings. It can be called while serving.
+func (s *MockServer) SetUI(cfg UIConfig) error {
+	if cfg.AssetsDir != "" {
+		fi, err := os.Stat(cfg.AssetsDir)
+		if err != nil {
+			return fmt.Errorf("invalid UI assets dir: %w", err)
+		}
+		if !fi.IsDir() {
+			return fmt.Errorf("invalid UI assets dir %q: not a directory", cfg.AssetsDir)
+		}
+	}
+
+	s.uiMu.Lock()
+	defer s.uiMu.Unlock()
+
+	s.ui = cfg
+
+	return nil
+}
+
+// UI returns the current dashboard settings.
+func (s *MockServer) UI() UIConfig {
+	s.uiMu.RLock()
+	defer s.uiMu.RUnlock()
+
+	return s.ui
+}
+
+// serveUI serves the dashboard as configured by SetUI, or 404 Not Found
+// while it is disabled.
+func (s *MockServer) serveUI(w http.ResponseWriter, r *http.Request) {
+	cfg := s.UI()
+	if cfg.Disabled {
+		http.NotFound(w, r)
+		return
+	}
+
+	fsys := embeddedUI()
+	if cfg.AssetsDir != "" {
+		fsys = overlayFS{upper: os.DirFS(cfg.AssetsDir), lower: fsys}
+	}
+
+	uiHandler(fsys).ServeHTTP(w, r)
+}
+
+// overlayFS opens the files of upper, and those upper does not have from
+// lower.
+type overlayFS struct {
+	upper, lower fs.FS
+}
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	f, err := o.upper.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return o.lower.Open(name)
+	}
+
+	return f, err
+}
+
+func embeddedUI() fs.FS {
+	sub, err := fs.Sub(uiFiles, "ui")
+	if err != nil {
+		panic(err)
+	}
+
+	return sub
+}
+
+// uiHandler serves the dashboard from fsys. Paths that are not files get
+// index.html so client-side routes under /ui/ keep working on reload.
+func uiHandler(fsys fs.FS) http.Handler {
+	files := http.FileServer(http.FS(fsys))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(path.Clean("/"+strings.TrimPrefix(r.URL.Path, "/ui")), "/")
+
+		if name != "" && name != "index.html" {
+			if fi, err := fs.Stat(fsys, name); err == nil && !fi.IsDir() {
+				r = r.Clone(r.Context())
+				r.URL.Path = "/" + name
+				files.ServeHTTP(w, r)
+				return
+			} else if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		index, err := fs.ReadFile(fsys, "index.html")
+		if err != nil {
+			http.Error(w, "UI not available", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write(index)
+	})
+}
@@ -0,0 +1,363 @@
+const tabs = document.querySelectorAll('button.tab');
+tabs.forEach(btn => btn.addEventListener('click', () => switchTab(btn.dataset.tab)));
+
+function switchTab(name) {
+  tabs.forEach(b => b.classList.toggle('active', b.dataset.tab === name));
+  document.querySelectorAll('main section').forEach(sec => {
+    sec.classList.toggle('active', sec.id === 'tab-' + name);
+  });
+  if (name === 'requests') loadRequests();
+  if (name === 'rules') { loadMock(); loadStats(); }
+  if (name === 'mock') loadMock();
+}
+
+document.getElementById('btn-refresh-requests').onclick = loadRequests;
+document.getElementById('btn-clear-requests').onclick = clearRequests;
+document.getElementById('btn-refresh-rules').onclick = () => { loadMock(); loadStats(); };
+document.getElementById('btn-refresh-mock').onclick = loadMock;
+document.getElementById('btn-import-ldif').onclick = () => document.getElementById('ldif-file').click();
+document.getElementById('ldif-file').onchange = e => importLDIF(e.target);
+
+let currentRequests = [];
+
+async function loadRequests() {
+  setInfo('requests', 'Loading...');
+  try {
+    const res = await fetch('/requests?limit=200');
+    if (!res.ok) throw new Error(await res.text());
+    currentRequests = await res.json();
+    renderRequests(currentRequests);
+    setInfo('requests', currentRequests.length + ' items');
+  } catch (e) {
+    setInfo('requests', 'Error: ' + e.message);
+  }
+}
+
+function renderRequests(items) {
+  const tbody = document.querySelector('#requests-table tbody');
+  tbody.innerHTML = '';
+  items.forEach((req, idx) => {
+    tbody.appendChild(requestRow(req));
+    if (idx === 0) showRequestDetails(req);
+  });
+  if (items.length === 0) {
+    document.getElementById('request-details').textContent = 'No requests yet';
+  }
+}
+
+function requestRow(req) {
+  const tr = document.createElement('tr');
+  const respCount = req.type === 'search' && req.response ? req.response.count : '';
+  tr.innerHTML =
+    '<td>' + esc(formatTime(req.timestamp)) + '</td>' +
+    '<td>' + esc(req.type || '') + '</td>' +
+    '<td>' + esc(req.type === 'bind' ? (req.bind_dn || '') : (req.base_dn || '')) + '</td>' +
+    '<td>' + highlightFilter(req.filter || '') + '</td>' +
+    '<td>' + ruleBadge(req) + '</td>' +
+    '<td>' + resultBadge(req) + '</td>' +
+    '<td>' + respCount + '</td>';
+  tr.onclick = () => showRequestDetails(req);
+  return tr;
+}
+
+function ruleBadge(req) {
+  if (req.type !== 'search') return '';
+  if (req.upstream) return '<span class="badge warn">upstream</span>';
+  if (!req.matched_rule) return '<span class="badge none">fallback</span>';
+  return '<span class="badge rule">' + esc(req.matched_rule.name || req.matched_rule.id || 'matched') + '</span>';
+}
+
+function resultBadge(req) {
+  if (!req.result) return '';
+  let out = '<span class="badge ' + (req.result === 'Success' ? 'ok' : 'fail') + '">' + esc(req.result) + '</span>';
+  if (req.shadow_diff && !req.shadow_diff.equal) out += ' <span class="badge warn" title="differs from upstream">diff</span>';
+  return out;
+}
+
+// highlightFilter colours an LDAP filter: operators, attribute names and values.
+function highlightFilter(filter) {
+  if (!filter) return '';
+  let out = '';
+  let i = 0;
+  while (i < filter.length) {
+    const c = filter[i];
+    if (c === '(' || c === ')') {
+      out += '<span class="f-paren">' + c + '</span>';
+      i++;
+    } else if ((c === '&' || c === '|' || c === '!') && filter[i - 1] === '(') {
+      out += '<span class="f-op">' + esc(c) + '</span>';
+      i++;
+    } else {
+      let end = filter.indexOf(')', i);
+      if (end < 0) end = filter.length;
+      const item = filter.slice(i, end);
+      const m = item.match(/^([^=<>~:]*)(:[^=]*)?(~=|>=|<=|:=|=)(.*)$/);
+      if (m) {
+        out += '<span class="f-attr">' + esc(m[1] + (m[2] || '')) + '</span>' +
+          '<span class="f-op">' + esc(m[3]) + '</span>' +
+          '<span class="f-val">' + esc(m[4]) + '</span>';
+      } else {
+        out += esc(item);
+      }
+      i = end;
+    }
+  }
+  return '<code class="filter">' + out + '</code>';
+}
+
+function showRequestDetails(req) {
+  const el = document.getElementById('request-details');
+  const attrs = req.attributes && req.attributes.length ? req.attributes.join(', ') : '—';
+  const dnList = req.response && req.response.returned_dns ? req.response.returned_dns.join('\n') : '';
+  const client = req.client_addr ? req.client_addr + (req.address_family ? ' (' + req.address_family + ')' : '') : '—';
+  let html =
+    '<div><span class="meta">Time:</span> ' + esc(formatTime(req.timestamp)) + '</div>' +
+    '<div><span class="meta">Type:</span> ' + esc(req.type || '') + '</div>' +
+    '<div><span class="meta">Client:</span> ' + esc(client) + '</div>' +
+    '<div><span class="meta">Result:</span> ' + (resultBadge(req) || '—') + '</div>';
+  if (req.type === 'bind') {
+    html += '<div><span class="meta">Bind DN:</span> ' + esc(req.bind_dn || '(anonymous)') + '</div>';
+  } else {
+    html +=
+      '<div><span class="meta">BaseDN:</span> ' + esc(req.base_dn || '') + '</div>' +
+      '<div><span class="meta">Scope:</span> ' + esc(req.scope || '') + '</div>' +
+      '<div><span class="meta">Filter:</span> ' + highlightFilter(req.filter || '') + '</div>' +
+      '<div><span class="meta">Attributes:</span> ' + esc(attrs) + '</div>' +
+      '<div><span class="meta">Matched rule:</span> ' + ruleBadge(req) + '</div>' +
+      '<div><span class="meta">Response count:</span> ' + (req.response ? req.response.count : '') + '</div>' +
+      '<div class="meta">Returned DNs:</div>' +
+      '<pre>' + esc(dnList || '—') + '</pre>';
+  }
+  el.innerHTML = html;
+}
+
+// Live mode: subscribe to /requests/stream and prepend entries as they arrive.
+let liveSource = null;
+const maxLiveRows = 500;
+
+document.getElementById('live-toggle').onchange = e => setLive(e.target.checked);
+
+function setLive(on) {
+  if (liveSource) {
+    liveSource.close();
+    liveSource = null;
+  }
+  document.getElementById('live-dot').classList.toggle('on', on);
+  if (!on) return;
+
+  liveSource = new EventSource('/requests/stream');
+  liveSource.addEventListener('request', e => {
+    const req = JSON.parse(e.data);
+    currentRequests.unshift(req);
+    currentRequests.length = Math.min(currentRequests.length, maxLiveRows);
+
+    const tbody = document.querySelector('#requests-table tbody');
+    const tr = requestRow(req);
+    tr.classList.add('fresh');
+    tbody.insertBefore(tr, tbody.firstChild);
+    while (tbody.children.length > maxLiveRows) tbody.removeChild(tbody.lastChild);
+    setInfo('requests', currentRequests.length + ' items (live)');
+  });
+  liveSource.onerror = () => setInfo('requests', 'Live stream disconnected, retrying...');
+}
+
+async function clearRequests() {
+  setInfo('requests', 'Clearing...');
+  try {
+    const res = await fetch('/requests/clear', { method: 'POST' });
+    if (!res.ok) throw new Error(await res.text());
+    await loadRequests();
+  } catch (e) {
+    setInfo('requests', 'Error: ' + e.message);
+  }
+}
+
+async function loadMock() {
+  setInfo('rules', 'Loading...');
+  setInfo('mock', 'Loading...');
+  try {
+    const res = await fetch('/mock');
+    if (!res.ok) throw new Error(await res.text());
+    const data = await res.json();
+    renderRules(data.mock?.rules || [], data.yaml);
+    renderMockUsers(data.mock?.users || [], data.mock?.groups || []);
+    setInfo('rules', (data.mock?.rules || []).length + ' rules');
+    setInfo('mock', (data.mock?.users || []).length + ' users, ' + (data.mock?.groups || []).length + ' groups');
+  } catch (e) {
+    setInfo('rules', 'Error: ' + e.message);
+    setInfo('mock', 'Error: ' + e.message);
+  }
+}
+
+function renderRules(rules, yaml) {
+  const list = document.getElementById('rules-list');
+  list.innerHTML = '';
+  if (!rules.length) {
+    list.innerHTML = '<div class="muted">No rules loaded</div>';
+  }
+  rules.forEach(rule => {
+    const div = document.createElement('div');
+    div.className = 'card';
+    const usersCount = rule.response?.users?.length || 0;
+    const groupsCount = rule.response?.groups?.length || 0;
+    const responseInfo = usersCount + ' users, ' + groupsCount + ' groups';
+    div.innerHTML =
+      '<div class="tag">ID: ' + (rule.id || '—') + '</div>' +
+      '<div class="tag">Name: ' + (rule.name || '—') + '</div>' +
+      '<div class="meta">Filter: ' + (rule.filter || '') + '</div>' +
+      '<div class="meta">BaseDN: ' + (rule.base_dn || '—') + (rule.base_dn_match === 'subtree' ? ' (subtree)' : '') + '</div>' +
+      '<div class="meta">Scope: ' + (rule.scope || '—') + '</div>' +
+      (rule.when_expr ? '<div class="meta">When: ' + rule.when_expr + '</div>' : '') +
+      '<div class="meta">Priority: ' + ((rule.priority ?? 0)) + '</div>' +
+      '<div class="meta">Response: ' + responseInfo + '</div>';
+    list.appendChild(div);
+  });
+  document.getElementById('rules-yaml').textContent = yaml || 'No YAML loaded';
+}
+
+async function loadStats() {
+  try {
+    const [statsRes, coverageRes] = await Promise.all([fetch('/stats'), fetch('/mock/coverage')]);
+    if (!statsRes.ok) throw new Error(await statsRes.text());
+    if (!coverageRes.ok) throw new Error(await coverageRes.text());
+    renderStats(await statsRes.json(), await coverageRes.json());
+  } catch (e) {
+    document.getElementById('stats-summary').textContent = 'Error: ' + e.message;
+  }
+}
+
+function renderStats(stats, coverage) {
+  document.getElementById('stats-summary').textContent =
+    coverage.hit + ' of ' + coverage.total + ' rules hit (' + Math.round(coverage.percent) + '%) · ' +
+    stats.searches + ' searches: ' + stats.matched + ' matched a rule, ' +
+    stats.fallback + ' fallback, ' + stats.failed + ' failed';
+
+  const tbody = document.querySelector('#coverage-table tbody');
+  tbody.innerHTML = '';
+  (coverage.rules || []).forEach(r => {
+    const tr = document.createElement('tr');
+    tr.innerHTML =
+      '<td>' + esc(r.name || r.id || '—') + '</td>' +
+      '<td>' + esc(r.tenant || '') + '</td>' +
+      '<td>' + r.hits + '</td>' +
+      '<td>' + esc(formatTime(r.last_matched)) + '</td>' +
+      '<td>' + (r.never_hit ? '<span class="badge warn">never hit</span>' : '<span class="badge ok">hit</span>') + '</td>';
+    tbody.appendChild(tr);
+  });
+}
+
+// importLDIF replaces the fallback users with the entries of the chosen file.
+async function importLDIF(input) {
+  const file = input.files[0];
+  input.value = '';
+  if (!file) return;
+  if (!confirm('Replace the fallback users with the entries of ' + file.name + '?')) return;
+
+  setInfo('mock', 'Importing...');
+  try {
+    const res = await fetch('/mock/ldif', { method: 'POST', headers: { 'Content-Type': 'text/x-ldif' }, body: await file.text() });
+    if (!res.ok) throw new Error(await res.text());
+    const data = await res.json();
+    await loadMock();
+    setInfo('mock', 'Imported ' + data.imported + ' entries from ' + file.name);
+  } catch (e) {
+    setInfo('mock', 'Error: ' + e.message);
+  }
+}
+
+function renderMockUsers(users, groups) {
+  const list = document.getElementById('mock-users');
+  list.innerHTML = '';
+  if (!users.length && !groups.length) {
+    list.innerHTML = '<div class="muted">No users loaded</div>';
+  }
+  users.forEach(u => {
+    const div = document.createElement('div');
+    div.className = 'card';
+    const attrs = u.attrs ? Object.entries(u.attrs).map(([k,v]) => '<div><span class="meta">' + k + ':</span> ' + v + '</div>').join('') : '';
+    div.innerHTML =
+      '<div class="tag">CN: ' + u.cn + '</div>' +
+      (attrs || '<div class="muted">No attributes</div>');
+    list.appendChild(div);
+  });
+  groups.forEach(g => {
+    const div = document.createElement('div');
+    div.className = 'card';
+    const members = (g.members || []).map(m => '<div><span class="meta">member:</span> ' + m + '</div>').join('');
+    div.innerHTML =
+      '<div class="tag">Group: ' + g.cn + '</div>' +
+      (members || '<div class="muted">No members</div>');
+    list.appendChild(div);
+  });
+}
+
+function esc(value) {
+  return String(value).replace(/[&<>"']/g, c => ({ '&': '&amp;', '<': '&lt;', '>': '&gt;', '"': '&quot;', "'": '&#39;' }[c]));
+}
+
+document.getElementById('tester-form').onsubmit = e => {
+  e.preventDefault();
+  simulate();
+};
+
+async function simulate() {
+  setInfo('tester', 'Testing...');
+  try {
+    const res = await fetch('/simulate', {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({
+        filter: document.getElementById('tester-filter').value,
+        base_dn: document.getElementById('tester-base-dn').value,
+        scope: document.getElementById('tester-scope').value,
+      }),
+    });
+    if (!res.ok) throw new Error(await res.text());
+    renderSimulation(await res.json());
+    setInfo('tester', '');
+  } catch (e) {
+    setInfo('tester', 'Error: ' + e.message);
+  }
+}
+
+function renderSimulation(sim) {
+  const rule = sim.matched_rule
+    ? '<span class="badge rule">' + esc(sim.matched_rule.name || sim.matched_rule.id || 'matched') + '</span>'
+    : '<span class="badge none">no rule matched, fallback users are filtered</span>';
+  const dns = sim.response && sim.response.returned_dns ? sim.response.returned_dns.join('\n') : '';
+  document.getElementById('tester-result').innerHTML =
+    (sim.tenant ? '<div><span class="meta">Tenant:</span> ' + esc(sim.tenant) + '</div>' : '') +
+    '<div><span class="meta">Answered by:</span> ' + rule + '</div>' +
+    '<div><span class="meta">Entries:</span> ' + (sim.response ? sim.response.count : 0) + '</div>' +
+    '<pre>' + esc(dns || '—') + '</pre>';
+
+  const tbody = document.querySelector('#tester-table tbody');
+  tbody.innerHTML = '';
+  (sim.rules || []).forEach(r => {
+    const tr = document.createElement('tr');
+    if (r.matched) tr.className = 'matched';
+    tr.innerHTML =
+      '<td>' + esc(r.name || r.id || '—') + '</td>' +
+      '<td>' + (r.priority ?? 0) + '</td>' +
+      '<td>' + (r.matched ? '<span class="badge ok">matches</span>' : esc(r.reason || '')) + '</td>';
+    tbody.appendChild(tr);
+  });
+  if (!(sim.rules || []).length) {
+    tbody.innerHTML = '<tr><td colspan="3" class="muted">No rules for this base DN</td></tr>';
+  }
+}
+
+function setInfo(scope, text) {
+  const el = document.getElementById(scope + '-info');
+  if (el) el.textContent = text;
+}
+
+function formatTime(ts) {
+  if (!ts) return '';
+  const d = new Date(ts);
+  if (Number.isNaN(d.getTime())) return ts;
+  return d.toLocaleString();
+}
+
+// initial load
+loadRequests();
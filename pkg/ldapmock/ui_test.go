@@ -0,0 +1,108 @@
+package ldapmock
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"go.uber.org/zap"
+)
+
+func TestUIHandler(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.html":    {Data: []byte("<html>index</html>")},
+		"assets/app.js": {Data: []byte("console.log('app')")},
+	}
+
+	tests := []struct {
+		path        string
+		wantBody    string
+		contentType string
+	}{
+		{path: "/ui", wantBody: "index", contentType: "text/html"},
+		{path: "/ui/", wantBody: "index", contentType: "text/html"},
+		{path: "/ui/index.html", wantBody: "index", contentType: "text/html"},
+		{path: "/ui/assets/app.js", wantBody: "console.log", contentType: "text/javascript"},
+		{path: "/ui/requests/42", wantBody: "index", contentType: "text/html"},
+		{path: "/ui/assets", wantBody: "index", contentType: "text/html"},
+		{path: "/ui/../mock_server.go", wantBody: "index", contentType: "text/html"},
+	}
+
+	handler := uiHandler(fsys)
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200", rec.Code)
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("body = %q, want %q", rec.Body.String(), tt.wantBody)
+			}
+			if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, tt.contentType) {
+				t.Errorf("content type = %q, want %s", ct, tt.contentType)
+			}
+		})
+	}
+}
+
+func TestEmbeddedUI(t *testing.T) {
+	for _, name := range []string{"index.html", "assets/app.js", "assets/app.css"} {
+		if _, err := embeddedUI().Open(name); err != nil {
+			t.Errorf("embedded UI misses %s: %v", name, err)
+		}
+	}
+}
+
+func TestOverlayFS(t *testing.T) {
+	fsys := overlayFS{
+		upper: fstest.MapFS{
+			"index.html":      {Data: []byte("<html>custom</html>")},
+			"assets/extra.js": {Data: []byte("console.log('extra')")},
+		},
+		lower: fstest.MapFS{
+			"index.html":    {Data: []byte("<html>index</html>")},
+			"assets/app.js": {Data: []byte("console.log('app')")},
+		},
+	}
+
+	handler := uiHandler(fsys)
+
+	for path, want := range map[string]string{
+		"/ui":                 "custom",
+		"/ui/assets/extra.js": "extra",
+		"/ui/assets/app.js":   "app",
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("GET %s: status %d, body %q, want %q", path, rec.Code, rec.Body.String(), want)
+		}
+	}
+}
+
+func TestMockServer_SetUI(t *testing.T) {
+	srv := NewMockServer(zap.NewNop(), "0", NewLDAPServer(zap.NewNop(), "0", "", "", nil), nil)
+
+	if err := srv.SetUI(UIConfig{AssetsDir: t.TempDir()}); err != nil {
+		t.Errorf("set UI with a directory: %v", err)
+	}
+
+	file := filepath.Join(t.TempDir(), "index.html")
+	if err := os.WriteFile(file, []byte("<html></html>"), 0o600); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	for _, dir := range []string{file, filepath.Join(t.TempDir(), "missing")} {
+		if err := srv.SetUI(UIConfig{AssetsDir: dir}); err == nil {
+			t.Errorf("set UI with assets dir %s: expected error", dir)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package ldapmock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// Upstream is a real LDAP server that searches are forwarded to. It keeps
+// one connection, dialed on first use and re-dialed after network errors.
+type Upstream struct {
+	url      string
+	bindDN   string
+	password string
+
+	mu   sync.Mutex
+	conn *ldap.Conn
+}
+
+// NewUpstream returns an upstream for url (ldap://, ldaps:// or ldapi://).
+// The connection binds as bindDN when it is not empty.
+func NewUpstream(url, bindDN, password string) *Upstream {
+	return &Upstream{url: url, bindDN: bindDN, password: password}
+}
+
+// URL returns the upstream server URL.
+func (u *Upstream) URL() string {
+	return u.url
+}
+
+// Search forwards req upstream. Result codes returned by the upstream server
+// are relayed as *ldap.Error; an unreachable upstream is reported as
+// unavailable(52).
+func (u *Upstream) Search(ctx context.Context, req SearchRequest) ([]Entry, error) {
+	searchReq := ldap.NewSearchRequest(
+		req.BaseDN,
+		int(req.Scope),
+		ldap.NeverDerefAliases,
+		int(req.SizeLimit),
+		int(req.TimeLimit),
+		req.TypesOnly,
+		req.Filter,
+		req.Attributes,
+		nil,
+	)
+
+	for attempt := 0; ; attempt++ {
+		conn, err := u.connection()
+		if err != nil {
+			return nil, ldap.NewError(ldap.LDAPResultUnavailable, fmt.Errorf("upstream %s: %w", u.url, err))
+		}
+
+		entries, err := searchUpstream(ctx, conn, searchReq)
+		if ldap.IsErrorWithCode(err, ldap.ErrorNetwork) {
+			u.reset(conn)
+
+			if attempt == 0 && len(entries) == 0 {
+				continue
+			}
+
+			return nil, ldap.NewError(ldap.LDAPResultUnavailable, fmt.Errorf("upstream %s: %w", u.url, err))
+		}
+
+		var ldapErr *ldap.Error
+		if err != nil && (!errors.As(err, &ldapErr) || ldapErr.ResultCode >= ldap.ErrorNetwork) {
+			// Client-side errors of the ldap package have no LDAP result code.
+			return nil, ldap.NewError(ldap.LDAPResultOther, fmt.Errorf("upstream %s: %w", u.url, err))
+		}
+
+		return entries, err
+	}
+}
+
+func searchUpstream(ctx context.Context, conn *ldap.Conn, req *ldap.SearchRequest) ([]Entry, error) {
+	resp := conn.SearchAsync(ctx, req, 0)
+
+	var entries []Entry
+	for resp.Next() {
+		e := resp.Entry()
+		if e == nil {
+			continue
+		}
+
+		attrs := make(map[string][]string, len(e.Attributes))
+		for _, attr := range e.Attributes {
+			attrs[attr.Name] = attr.Values
+		}
+
+		entries = append(entries, Entry{DN: e.DN, Attrs: attrs})
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, resp.Err()
+}
+
+// Close closes the upstream connection, if any.
+func (u *Upstream) Close() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.conn == nil {
+		return nil
+	}
+
+	err := u.conn.Close()
+	u.conn = nil
+
+	return err
+}
+
+func (u *Upstream) connection() (*ldap.Conn, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.conn != nil && !u.conn.IsClosing() {
+		return u.conn, nil
+	}
+
+	conn, err := ldap.DialURL(u.url)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.bindDN != "" {
+		if err := conn.Bind(u.bindDN, u.password); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("bind: %w", err)
+		}
+	}
+
+	u.conn = conn
+
+	return conn, nil
+}
+
+func (u *Upstream) reset(conn *ldap.Conn) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	_ = conn.Close()
+	if u.conn == conn {
+		u.conn = nil
+	}
+}
+
+// SetUpstream forwards searches that match no rule to upstream instead of
+// answering them from the mock users; nil turns forwarding off.
+func (s *LDAPServer) SetUpstream(upstream *Upstream) {
+	s.upstreamMu.Lock()
+	defer s.upstreamMu.Unlock()
+
+	s.upstream = upstream
+}
+
+// Upstream returns the server searches are forwarded to, or nil.
+func (s *LDAPServer) Upstream() *Upstream {
+	s.upstreamMu.RLock()
+	defer s.upstreamMu.RUnlock()
+
+	return s.upstream
+}
@@ -0,0 +1,55 @@
+package ldapmock
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Build information, injected at build time:
+//
+//	go build -ldflags "-X github.com/rom8726/ldap-mock/pkg/ldapmock.Version=1.2.3 \
+//	  -X github.com/rom8726/ldap-mock/pkg/ldapmock.Commit=$(git rev-parse HEAD) \
+//	  -X github.com/rom8726/ldap-mock/pkg/ldapmock.BuildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildDate = ""
+)
+
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+}
+
+// GetBuildInfo returns the injected build information. Commit and build
+// date fall back to the VCS stamp recorded by the Go toolchain.
+func GetBuildInfo() BuildInfo {
+	info := BuildInfo{
+		Version:   Version,
+		Commit:    Commit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+	}
+
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range bi.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = setting.Value
+			case setting.Key == "vcs.time" && info.BuildDate == "":
+				info.BuildDate = setting.Value
+			}
+		}
+	}
+
+	if info.Commit == "" {
+		info.Commit = "unknown"
+	}
+	if info.BuildDate == "" {
+		info.BuildDate = "unknown"
+	}
+
+	return info
+}
@@ -0,0 +1,222 @@
+package ldapmock
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+// DefaultWASMTimeout is how long the WASM module of a rule may run when
+// WASMEngine has no timeout.
+const DefaultWASMTimeout = time.Second
+
+// maxWASMMemoryPages bounds the memory of a module instance: 64 MiB.
+const maxWASMMemoryPages = 1024
+
+// WASMEngine runs the WASM modules of rules (Rule.WASM) with wazero, so that
+// responses can be computed by code compiled from any language. A module is
+// the file at the path of the rule and must export:
+//
+//   - memory, its linear memory;
+//   - alloc(size i32) i32, returning where the host may write size bytes;
+//   - respond(ptr i32, len i32) i64, answering the ScriptRequest JSON at ptr
+//     with the ScriptResult JSON at the upper 32 bits of its result, of the
+//     length in the lower 32 bits.
+//
+// It is the ABI of ScriptEngine: request in, entries and result code out.
+// Modules may import WASI (wasi_snapshot_preview1), without file system,
+// environment or clock access beyond what WASI gives by default; a reactor's
+// _initialize is called. Each run gets a new instance of the module, which is
+// compiled once per modification of its file, and is stopped once Timeout
+// has passed or the search is abandoned.
+type WASMEngine struct {
+	// Timeout bounds the run time of each module; zero is
+	// DefaultWASMTimeout.
+	Timeout time.Duration
+
+	once    sync.Once
+	runtime wazero.Runtime
+	err     error
+
+	mu      sync.Mutex
+	modules map[string]compiledWASM
+}
+
+type compiledWASM struct {
+	modTime time.Time
+	size    int64
+	module  wazero.CompiledModule
+	err     error
+}
+
+// NewWASMEngine returns an engine running modules for at most timeout, or
+// DefaultWASMTimeout when it is zero.
+func NewWASMEngine(timeout time.Duration) *WASMEngine {
+	return &WASMEngine{Timeout: timeout}
+}
+
+// Run runs the module at path for req.
+func (e *WASMEngine) Run(ctx context.Context, path string, req ScriptRequest) (ScriptResult, error) {
+	timeout := e.Timeout
+	if timeout <= 0 {
+		timeout = DefaultWASMTimeout
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	result, err := e.run(runCtx, path, req)
+	if err != nil && ctx.Err() == nil && errors.Is(runCtx.Err(), context.DeadlineExceeded) {
+		return ScriptResult{}, fmt.Errorf("module timed out after %s", timeout)
+	}
+
+	return result, err
+}
+
+func (e *WASMEngine) run(ctx context.Context, path string, req ScriptRequest) (ScriptResult, error) {
+	compiled, err := e.compile(ctx, path)
+	if err != nil {
+		return ScriptResult{}, err
+	}
+
+	mod, err := e.runtime.InstantiateModule(ctx, compiled, wazero.NewModuleConfig().
+		WithName("").WithStartFunctions("_initialize"))
+	if err != nil {
+		return ScriptResult{}, fmt.Errorf("instantiate module: %w", err)
+	}
+	defer func() { _ = mod.Close(context.Background()) }()
+
+	alloc, respond := mod.ExportedFunction("alloc"), mod.ExportedFunction("respond")
+	memory := mod.ExportedMemory("memory")
+	if alloc == nil || respond == nil || memory == nil {
+		return ScriptResult{}, errors.New("module must export memory, alloc and respond")
+	}
+
+	if req.Attributes == nil {
+		req.Attributes = []string{}
+	}
+
+	in, err := json.Marshal(req)
+	if err != nil {
+		return ScriptResult{}, err
+	}
+
+	ptr, err := call(ctx, alloc, uint64(len(in)))
+	if err != nil {
+		return ScriptResult{}, fmt.Errorf("alloc: %w", err)
+	}
+	if !memory.Write(uint32(ptr), in) {
+		return ScriptResult{}, fmt.Errorf("alloc returned %d, out of memory", uint32(ptr))
+	}
+
+	out, err := call(ctx, respond, uint64(uint32(ptr)), uint64(len(in)))
+	if err != nil {
+		return ScriptResult{}, fmt.Errorf("respond: %w", err)
+	}
+
+	data, ok := memory.Read(uint32(out>>32), uint32(out))
+	if !ok {
+		return ScriptResult{}, fmt.Errorf("respond returned %d bytes at %d, out of memory", uint32(out), uint32(out>>32))
+	}
+
+	var result ScriptResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		return ScriptResult{}, fmt.Errorf("module result: %w", err)
+	}
+
+	return result, nil
+}
+
+// call calls fn, which returns one value, with params.
+func call(ctx context.Context, fn api.Function, params ...uint64) (uint64, error) {
+	results, err := fn.Call(ctx, params...)
+	if err != nil {
+		return 0, err
+	}
+	if len(results) != 1 {
+		return 0, fmt.Errorf("%d results, want 1", len(results))
+	}
+
+	return results[0], nil
+}
+
+// compile returns the module at path, compiled again when the file changed.
+func (e *WASMEngine) compile(ctx context.Context, path string) (wazero.CompiledModule, error) {
+	e.once.Do(func() {
+		e.runtime = wazero.NewRuntimeWithConfig(context.Background(), wazero.NewRuntimeConfig().
+			WithCloseOnContextDone(true).WithMemoryLimitPages(maxWASMMemoryPages))
+		_, e.err = wasi_snapshot_preview1.Instantiate(context.Background(), e.runtime)
+	})
+	if e.err != nil {
+		return nil, e.err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("load module: %w", err)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if compiled, ok := e.modules[path]; ok && compiled.modTime.Equal(info.ModTime()) && compiled.size == info.Size() {
+		return compiled.module, compiled.err
+	}
+
+	code, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("load module: %w", err)
+	}
+
+	module, err := e.runtime.CompileModule(ctx, code)
+	if err != nil {
+		err = fmt.Errorf("compile module %s: %w", path, err)
+	}
+
+	if e.modules == nil {
+		e.modules = make(map[string]compiledWASM)
+	}
+	e.modules[path] = compiledWASM{modTime: info.ModTime(), size: info.Size(), module: module, err: err}
+
+	return module, err
+}
+
+// SetWASMEngine sets the engine running the WASM modules of rules; nil
+// removes it, and rules with a module then fail with unwillingToPerform(53).
+// A WASMEngine is set by default.
+func (s *LDAPServer) SetWASMEngine(engine ScriptEngine) {
+	s.scriptMu.Lock()
+	defer s.scriptMu.Unlock()
+
+	s.wasm = engine
+}
+
+// WASMEngine returns the engine running the WASM modules of rules, or nil.
+func (s *LDAPServer) WASMEngine() ScriptEngine {
+	s.scriptMu.RLock()
+	defer s.scriptMu.RUnlock()
+
+	return s.wasm
+}
+
+// runWASM answers req with the WASM module of rule.
+func (s *LDAPServer) runWASM(ctx context.Context, rule *Rule, req SearchRequest) (SearchResult, error) {
+	engine := s.WASMEngine()
+	if engine == nil {
+		return SearchResult{MatchedRule: rule}, ldap.NewError(ldap.LDAPResultUnwillingToPerform,
+			fmt.Errorf("rule %s has a WASM module, but no WASM engine is set", ruleLabel(rule)))
+	}
+
+	result, err := engine.Run(ctx, rule.WASM, scriptRequest(req))
+
+	return scriptSearchResult(rule, "WASM module", result, err)
+}
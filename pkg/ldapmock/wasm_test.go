@@ -0,0 +1,112 @@
+package ldapmock
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"go.uber.org/zap"
+)
+
+// The modules of testdata/wasm are written by testdata/wasm/gen.go.
+
+func TestWASMEngine(t *testing.T) {
+	engine := NewWASMEngine(100 * time.Millisecond)
+	req := ScriptRequest{BaseDN: `ou="quoted",dc=example`, Scope: "sub", Filter: `(cn=a\5cb)`, SizeLimit: 5}
+
+	result, err := engine.Run(context.Background(), "testdata/wasm/echo.wasm", req)
+	if err != nil {
+		t.Fatalf("echo: %v", err)
+	}
+
+	wantUsers := []User{{CN: "uid=wasm,dc=example", Attrs: map[string]string{"uid": "wasm"}}}
+	if !reflect.DeepEqual(result.Users, wantUsers) || result.ResultCode != ldap.LDAPResultSizeLimitExceeded {
+		t.Errorf("echo result = %+v, want %+v and sizeLimitExceeded", result, wantUsers)
+	}
+
+	var echoed ScriptRequest
+	if err := json.Unmarshal([]byte(result.Message), &echoed); err != nil {
+		t.Fatalf("echoed request %q: %v", result.Message, err)
+	}
+	req.Attributes = []string{}
+	if !reflect.DeepEqual(echoed, req) {
+		t.Errorf("echoed request = %+v, want %+v", echoed, req)
+	}
+
+	if _, err := engine.Run(context.Background(), "testdata/wasm/spin.wasm", req); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("spin: err = %v, want a timeout", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	start := time.Now()
+	if _, err := NewWASMEngine(time.Minute).Run(ctx, "testdata/wasm/spin.wasm", req); err == nil {
+		t.Error("spin: no error after the search was abandoned")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("spin stopped after %s, want it stopped when abandoned", elapsed)
+	}
+
+	dir := t.TempDir()
+	noExports := filepath.Join(dir, "empty.wasm")
+	if err := os.WriteFile(noExports, []byte("\x00asm\x01\x00\x00\x00"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	invalid := filepath.Join(dir, "invalid.wasm")
+	if err := os.WriteFile(invalid, []byte("not wasm"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for path, want := range map[string]string{
+		noExports:                    "must export memory, alloc and respond",
+		invalid:                      "compile module",
+		filepath.Join(dir, "absent"): "load module",
+	} {
+		if _, err := engine.Run(context.Background(), path, req); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: err = %v, want %q", filepath.Base(path), err, want)
+		}
+	}
+
+	// Modules are compiled again when their file changes.
+	if err := os.WriteFile(invalid, mustReadFile(t, "testdata/wasm/echo.wasm"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := engine.Run(context.Background(), invalid, req); err != nil {
+		t.Errorf("rewritten module: %v", err)
+	}
+}
+
+func TestLDAPServer_OnSearch_WASM(t *testing.T) {
+	srv := NewLDAPServer(zap.NewNop(), "0", "", "", nil)
+	srv.SetMock(LDAPMock{Rules: []Rule{{ID: "wasm", Filter: "(uid=*)", FilterMatch: FilterMatchSemantic, WASM: "testdata/wasm/echo.wasm"}}})
+
+	result, err := srv.OnSearch(context.Background(), SearchRequest{BaseDN: "dc=example", Filter: "(uid=john)", Scope: ScopeSub})
+	if !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) || len(result.Users) != 1 || result.MatchedRule == nil {
+		t.Fatalf("result %+v, err %v, want uid=wasm and sizeLimitExceeded", result, err)
+	}
+	if !strings.Contains(err.Error(), `"filter":"(uid=john)"`) {
+		t.Errorf("err = %v, want the echoed request", err)
+	}
+
+	srv.SetWASMEngine(nil)
+	if _, err := srv.OnSearch(context.Background(), SearchRequest{Filter: "(uid=john)", Scope: ScopeSub}); !ldap.IsErrorWithCode(err, ldap.LDAPResultUnwillingToPerform) {
+		t.Errorf("without an engine: err = %v, want unwillingToPerform", err)
+	}
+}
+
+func mustReadFile(t *testing.T, path string) []byte {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
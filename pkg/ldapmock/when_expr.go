@@ -0,0 +1,95 @@
+package ldapmock
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/ext"
+)
+
+// whenRequest is the request variable of rule conditions (Rule.WhenExpr).
+type whenRequest struct {
+	BaseDN     string   `cel:"base_dn"`
+	Scope      string   `cel:"scope"`
+	Filter     string   `cel:"filter"`
+	Attributes []string `cel:"attributes"`
+	SizeLimit  int64    `cel:"size_limit"`
+	TimeLimit  int64    `cel:"time_limit"`
+	TypesOnly  bool     `cel:"types_only"`
+}
+
+// whenEnv is the CEL environment of rule conditions: the standard library,
+// the string extensions and the request variable.
+var whenEnv = sync.OnceValues(func() (*cel.Env, error) {
+	return cel.NewEnv(
+		ext.NativeTypes(reflect.TypeFor[whenRequest](), ext.ParseStructTags(true)),
+		ext.Strings(),
+		cel.Variable("request", cel.ObjectType("ldapmock.whenRequest")),
+	)
+})
+
+type parsedWhen struct {
+	text    string
+	program cel.Program
+	err     error
+}
+
+// parseWhen compiles and type-checks a rule condition, which must be a bool.
+func parseWhen(text string) parsedWhen {
+	if text == "" {
+		return parsedWhen{}
+	}
+
+	program, err := compileWhenExpr(text)
+
+	return parsedWhen{text: text, program: program, err: err}
+}
+
+func compileWhenExpr(text string) (cel.Program, error) {
+	env, err := whenEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	ast, issues := env.Compile(text)
+	if issues.Err() != nil {
+		return nil, issues.Err()
+	}
+	if !ast.OutputType().IsExactType(cel.BoolType) {
+		return nil, fmt.Errorf("condition is %s, not bool", ast.OutputType())
+	}
+
+	return env.Program(ast)
+}
+
+// evalWhen reports whether the condition holds for req.
+func evalWhen(program cel.Program, req SearchRequest) (bool, error) {
+	attributes := req.Attributes
+	if attributes == nil {
+		attributes = []string{}
+	}
+
+	out, _, err := program.Eval(map[string]any{
+		"request": whenRequest{
+			BaseDN:     req.BaseDN,
+			Scope:      req.Scope.String(),
+			Filter:     req.Filter,
+			Attributes: attributes,
+			SizeLimit:  req.SizeLimit,
+			TimeLimit:  req.TimeLimit,
+			TypesOnly:  req.TypesOnly,
+		},
+	})
+	if err != nil {
+		return false, err
+	}
+
+	holds, ok := out.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("condition evaluates to %s, not bool", out.Type())
+	}
+
+	return holds, nil
+}
@@ -0,0 +1,108 @@
+package ldapmock
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWhenExpr(t *testing.T) {
+	req := SearchRequest{
+		BaseDN:     "ou=people,dc=example",
+		Scope:      ScopeSub,
+		Filter:     "(&(objectClass=person)(uid=john))",
+		Attributes: []string{"mail", "cn"},
+		SizeLimit:  10,
+	}
+
+	tests := []struct {
+		expr    string
+		want    bool
+		wantErr string
+	}{
+		{expr: `request.filter.contains("uid=") && request.scope == "sub"`, want: true},
+		{expr: `request.filter.contains('uid=') && request.scope == 'base'`, want: false},
+		{expr: `request.base_dn.endsWith("dc=example") || false`, want: true},
+		{expr: `!request.types_only && request.size_limit > 5 && request.size_limit <= 10`, want: true},
+		{expr: `"mail" in request.attributes && size(request.attributes) == 2`, want: true},
+		{expr: `request.attributes.size() >= 3`, want: false},
+		{expr: `request.scope in ["one", "base"]`, want: false},
+		{expr: `request.attributes[1] == "cn"`, want: true},
+		{expr: `request.base_dn.upperAscii().startsWith("OU=PEOPLE")`, want: true},
+		{expr: `request.filter.matches("uid=j[a-z]+")`, want: true},
+		{expr: `(request.scope == "one" || request.scope == "sub") && !(request.size_limit < 1)`, want: true},
+		{expr: `request.size_limit * 2 + 1 == 21`, want: true},
+		{expr: `(request.size_limit > 5 ? "big" : "small") == "big"`, want: true},
+		{expr: `has(request.filter) && request.attributes.exists(a, a == "cn")`, want: true},
+		{expr: `request.attributes.all(a, a.size() > 2)`, want: false},
+
+		{expr: `request.missing == "x"`, wantErr: "undefined field 'missing'"},
+		{expr: `request.size_limit > "5"`, wantErr: "found no matching overload"},
+		{expr: `request.filter`, wantErr: "condition is string, not bool"},
+		{expr: `request.filter.contains(`, wantErr: "Syntax error"},
+		{expr: `request.scope = "sub"`, wantErr: "Syntax error"},
+		{expr: `lookup(request.filter)`, wantErr: "undeclared reference to 'lookup'"},
+		{expr: `request.filter.matches("(")`, wantErr: "error parsing regexp"},
+		{expr: `request.size_limit / (request.time_limit) == 1`, wantErr: "division by zero"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			program, err := compileWhenExpr(tt.expr)
+
+			var got bool
+			if err == nil {
+				got, err = evalWhen(program, req)
+			}
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("result = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindMatchingRule_WhenExpr(t *testing.T) {
+	engine := NewRuleEngine([]Rule{
+		{ID: "broken", Filter: "(uid=john)", WhenExpr: `request.scope ==`, Priority: 3},
+		{ID: "mail-only", Filter: "(uid=john)", WhenExpr: `request.attributes == ["mail"]`, Priority: 2},
+		{ID: "sub", Filter: "(uid=john)", WhenExpr: `request.scope == "sub"`, Priority: 1},
+		{ID: "any", Filter: "(uid=john)"},
+	})
+
+	tests := []struct {
+		req  SearchRequest
+		want string
+	}{
+		{SearchRequest{Filter: "(uid=john)", Scope: ScopeSub, Attributes: []string{"mail"}}, "mail-only"},
+		{SearchRequest{Filter: "(uid=john)", Scope: ScopeSub}, "sub"},
+		{SearchRequest{Filter: "(uid=john)", Scope: ScopeOne}, "any"},
+	}
+
+	for _, tt := range tests {
+		rule := engine.FindMatchingRule(tt.req)
+		if rule == nil || rule.ID != tt.want {
+			t.Errorf("FindMatchingRule(%+v) = %v, want %s", tt.req, rule, tt.want)
+		}
+	}
+
+	evals := engine.Explain(SearchRequest{Filter: "(uid=john)", Scope: ScopeOne})
+	wantReasons := []string{
+		`invalid when_expr: ERROR: <input>:1:17: Syntax error`,
+		`when_expr request.attributes == ["mail"] is false`,
+		`when_expr request.scope == "sub" is false`,
+	}
+	for i, want := range wantReasons {
+		if !strings.HasPrefix(evals[i].Reason, want) {
+			t.Errorf("reason %d = %q, want prefix %q", i, evals[i].Reason, want)
+		}
+	}
+}
@@ -1,6 +0,0 @@
-package main
-
-import _ "embed"
-
-//go:embed ui.html
-var uiIndexHTML string